@@ -0,0 +1,225 @@
+// Package client submits orders to the order processor and throttles
+// itself from the server's backpressure headers. It keeps an AIMD window
+// of requests in flight: the window grows by one per window of accepted
+// orders while the server reports no pressure, and halves when the server
+// rejects an order or asks clients to wait. Rejected orders are retried
+// only while the retry budget lasts, so an overloaded server sees fewer
+// requests, not more.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/pkg/models"
+)
+
+// Order is the order submitted and returned by the server.
+type Order = models.Order
+
+// ErrOverloaded is returned when the server kept rejecting an order and
+// the retries or the retry budget ran out.
+var ErrOverloaded = errors.New("order processor overloaded")
+
+// Error is a non-retryable rejection, such as a validation failure.
+type Error struct {
+	Status int
+	Code   string // X-Error-Code
+	Body   string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("order processor: %d %s: %s", e.Status, e.Code, e.Body)
+}
+
+const (
+	minWindow = 1.0
+	maxWindow = 256.0
+
+	// Each accepted order earns a tenth of a retry, up to budgetCap
+	// retries in reserve.
+	budgetRatio = 0.1
+	budgetCap   = 10.0
+)
+
+type Client struct {
+	BaseURL    string
+	APIKey     string // sent as X-API-Key when set
+	HTTP       *http.Client
+	MaxRetries int // per order, each also paid from the retry budget
+
+	mu         sync.Mutex
+	window     float64 // allowed requests in flight
+	inFlight   int
+	pauseUntil time.Time
+	budget     float64
+	released   chan struct{} // closed and replaced whenever a slot frees up
+}
+
+func New(baseURL string) *Client {
+	return &Client{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		HTTP:       &http.Client{Timeout: 30 * time.Second},
+		MaxRetries: 3,
+		window:     8,
+		budget:     budgetCap,
+		released:   make(chan struct{}),
+	}
+}
+
+// Window returns the current number of requests allowed in flight.
+func (c *Client) Window() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.window
+}
+
+// Submit sends order, waiting for a free slot and any server-requested
+// pause first. Overload rejections are retried within the retry budget.
+func (c *Client) Submit(ctx context.Context, order Order) (Order, error) {
+	body, err := json.Marshal(order)
+	if err != nil {
+		return Order{}, err
+	}
+	for attempt := 0; ; attempt++ {
+		if err := c.acquire(ctx); err != nil {
+			return Order{}, err
+		}
+		accepted, overloaded, err := c.send(ctx, body)
+		c.release()
+		if !overloaded {
+			return accepted, err
+		}
+		if attempt >= c.MaxRetries || !c.spendRetry() {
+			return Order{}, ErrOverloaded
+		}
+	}
+}
+
+// acquire waits until a request may be sent.
+func (c *Client) acquire(ctx context.Context) error {
+	for {
+		c.mu.Lock()
+		wait := time.Until(c.pauseUntil)
+		if wait <= 0 && float64(c.inFlight) < c.window {
+			c.inFlight++
+			c.mu.Unlock()
+			return nil
+		}
+		released := c.released
+		c.mu.Unlock()
+
+		var timer *time.Timer
+		var expired <-chan time.Time
+		if wait > 0 {
+			timer = time.NewTimer(wait)
+			expired = timer.C
+		}
+		select {
+		case <-ctx.Done():
+		case <-expired:
+		case <-released:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+}
+
+func (c *Client) release() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.inFlight--
+	close(c.released)
+	c.released = make(chan struct{})
+}
+
+func (c *Client) spendRetry() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.budget < 1 {
+		return false
+	}
+	c.budget--
+	return true
+}
+
+// send posts one attempt. overloaded reports a rejection worth retrying.
+func (c *Client) send(ctx context.Context, body []byte) (accepted Order, overloaded bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseURL+"/orders", bytes.NewReader(body))
+	if err != nil {
+		return Order{}, false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.APIKey != "" {
+		req.Header.Set("X-API-Key", c.APIKey)
+	}
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return Order{}, false, err
+	}
+	defer resp.Body.Close()
+
+	overloaded = resp.StatusCode == http.StatusServiceUnavailable || resp.StatusCode == http.StatusTooManyRequests
+	c.adapt(resp, overloaded)
+
+	switch {
+	case resp.StatusCode == http.StatusCreated:
+		err = json.NewDecoder(resp.Body).Decode(&accepted)
+		return accepted, false, err
+	case overloaded:
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+		return Order{}, true, nil
+	default:
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+		return Order{}, false, &Error{Status: resp.StatusCode, Code: resp.Header.Get("X-Error-Code"), Body: strings.TrimSpace(string(msg))}
+	}
+}
+
+// adapt applies AIMD to the window from the response's backpressure.
+func (c *Client) adapt(resp *http.Response, overloaded bool) {
+	hint := retryHint(resp)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if hint > 0 {
+		c.pauseUntil = later(c.pauseUntil, time.Now().Add(hint))
+	}
+	switch {
+	case overloaded || hint > 0:
+		c.window = max(c.window/2, minWindow)
+	case resp.StatusCode == http.StatusCreated:
+		c.window = min(c.window+1/c.window, maxWindow)
+		c.budget = min(c.budget+budgetRatio, budgetCap)
+	}
+}
+
+// retryHint reads X-Retry-After-Hint (ms), falling back to Retry-After (s).
+func retryHint(resp *http.Response) time.Duration {
+	if ms, err := strconv.ParseInt(resp.Header.Get("X-Retry-After-Hint"), 10, 64); err == nil {
+		return time.Duration(ms) * time.Millisecond
+	}
+	if s, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		return time.Duration(s) * time.Second
+	}
+	return 0
+}
+
+func later(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
@@ -1,40 +1,783 @@
 package main
 
 import (
+	"cmp"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
 	"log"
+	"net"
 	"net/http"
 	_ "net/http/pprof" // Import for side effects - registers pprof handlers
+	"os"
+	"os/signal"
+	"path/filepath"
 	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/analytics"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/audit"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/auth"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/blobstore"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/boltstore"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/cluster"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/config"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/customer"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/enrich"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/eventbus"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/firewall"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/forensics"
 	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/handler"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/history"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/idempotency"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/jobs"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/journal"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/lifecycle"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/memguard"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/metrics"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/orderstore"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/outbound"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/payload"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/payment"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/pgstore"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/pkg/models"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/problem"
 	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/processor"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/publish"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/quality"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/quarantine"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/reconcile"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/redisq"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/secrets"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/selftest"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/shipping"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/slo"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/source"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/source/kafka"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/stream"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/subscription"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/tenant"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/tracing"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/traffic"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/transform"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/validation"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/view"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/webhook"
+	"github.com/quic-go/quic-go/http3"
 )
 
 func main() {
+	configPath := flag.String("config", "", "path to a JSON config file")
+	dev := flag.Bool("dev", false, "generate synthetic orders (see dev.rate)")
+	selfTest := flag.Bool("selftest", false, "run synthetic orders through every pipeline with fakes, then exit non-zero on any failure")
+	flag.Parse()
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatalf("config: %v", err)
+	}
+
+	// Spans are sent in batches; those still buffered are sent at the end
+	// of shutdown.
+	shutdownTracing := func(context.Context) error { return nil }
+	if t := cfg.Tracing; t.Endpoint != "" {
+		shutdownTracing, err = tracing.Setup(context.Background(), tracing.Config{
+			Endpoint:    t.Endpoint,
+			ServiceName: t.ServiceName,
+			SampleRatio: t.SampleRatio,
+		})
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		log.Printf("Tracing to %s", t.Endpoint)
+	}
+
+	// Shared client for every call to another service
+	out := outbound.New(outbound.Config{
+		Timeout:          cfg.Outbound.Timeout.Duration,
+		Retries:          cfg.Outbound.Retries,
+		Backoff:          cfg.Outbound.Backoff.Duration,
+		FailureThreshold: cfg.Outbound.FailureThreshold,
+		OpenFor:          cfg.Outbound.OpenFor.Duration,
+		MaxIdlePerHost:   cfg.Outbound.MaxIdlePerHost,
+	})
+
+	provider, err := newSecretsProvider(cfg.Secrets, out)
+	if err != nil {
+		log.Fatalf("secrets: %v", err)
+	}
+	secretManager := secrets.NewManager(provider, cfg.Secrets.Refresh.Duration)
+	go secretManager.Run(context.Background())
+
+	adminKey, err := secretManager.Resolve(context.Background(), cfg.Auth.AdminKey)
+	if err != nil {
+		log.Fatalf("secrets: %v", err)
+	}
+
+	var signatures *auth.SignatureVerifier
+	if cfg.Signing.Secret != "" {
+		signingSecret, err := secretManager.Resolve(context.Background(), cfg.Signing.Secret)
+		if err != nil {
+			log.Fatalf("secrets: %v", err)
+		}
+		signatures = auth.NewSignatureVerifier(signingSecret.Get, cfg.Signing.Window.Duration)
+	}
+
+	keys, err := auth.NewKeyStore(cfg.Auth.KeysFile)
+	if err != nil {
+		log.Fatalf("api keys: %v", err)
+	}
+	certs := auth.ClientCerts{}
+	for _, cc := range cfg.TLS.ClientCerts {
+		if err := certs.Add(cc.Subject, cc.Tenant, cc.Name, cc.Scopes); err != nil {
+			log.Fatalf("tls: %v", err)
+		}
+	}
 
 	// Enable mutex profiling for better analysis
 	runtime.SetMutexProfileFraction(1)
 	runtime.SetBlockProfileRate(1)
 
 	mux := http.NewServeMux()
-	pool := processor.Start(context.Background(), 10, 100)
-	defer processor.Close(pool)
+	specs := make([]validation.Spec, len(cfg.Validators))
+	for i, v := range cfg.Validators {
+		specs[i] = validation.Spec(v)
+	}
+	validators, err := validation.Build(specs)
+	if err != nil {
+		log.Fatalf("validators: %v", err)
+	}
+
+	transformSpecs := make(map[string]transform.Spec, len(cfg.Transforms))
+	for name, t := range cfg.Transforms {
+		transformSpecs[name] = transform.Spec(t)
+	}
+	transforms, err := transform.Build(transformSpecs)
+	if err != nil {
+		log.Fatalf("transforms: %v", err)
+	}
+
+	ledger := payment.NewLedger()
+	var gateway payment.Gateway = payment.SimulatedGateway{
+		Latency:      cfg.Payment.GatewayLatency.Duration,
+		DeclineAbove: cfg.Payment.DeclineAbove,
+	}
+	if cfg.Payment.GatewayURL != "" && !*selfTest {
+		gateway = payment.HTTPGateway{URL: cfg.Payment.GatewayURL, Client: out.HTTP(30 * time.Second)}
+	}
+	payments := payment.NewPayments(ledger, gateway)
+	processor.RegisterStep("payment", payments.Step)
+
+	shippingRules, err := buildShippingRules(cfg.Shipping)
+	if err != nil {
+		log.Fatalf("shipping: %v", err)
+	}
+	processor.RegisterStep("shipping", shipping.Step(shippingRules))
+
+	pipelines := []processor.PipelineConfig{{Name: "default", Workers: cfg.Workers, Buffer: cfg.Buffer, Timeout: cfg.ProcessingTimeout.Duration, Retry: retryPolicy(cfg.Retry), Admission: admissionConfig(cfg.Admission), Autoscale: autoscaleConfig(cfg.Autoscale)}}
+	if len(cfg.Pipelines) > 0 {
+		pipelines = pipelines[:0]
+		for _, p := range cfg.Pipelines {
+			retry, admission, timeout := cfg.Retry, cfg.Admission, cfg.ProcessingTimeout
+			if p.ProcessingTimeout != nil {
+				timeout = *p.ProcessingTimeout
+			}
+			if p.Retry != nil {
+				retry = *p.Retry
+			}
+			if p.Admission != nil {
+				admission = *p.Admission
+			}
+			pipelines = append(pipelines, processor.PipelineConfig{
+				Name:    p.Name,
+				Workers: p.Workers,
+				Buffer:  p.Buffer,
+				Steps:   p.Steps,
+				ShardBy: p.ShardBy,
+
+				Scheduling:  p.Scheduling,
+				StarveAfter: p.StarveAfter.Duration,
+
+				Timeout:       timeout.Duration,
+				Deadline:      p.Deadline.Duration,
+				BudgetWeights: p.BudgetWeights,
+				EvictDoomed:   p.EvictDoomed,
+
+				Retry:     retryPolicy(retry),
+				Admission: admissionConfig(admission),
+				Autoscale: autoscaleConfig(p.Autoscale),
+				Canary:    (*processor.CanaryConfig)(p.Canary),
+			})
+		}
+	}
+	routes := make([]processor.Route, len(cfg.Routes))
+	for i, r := range cfg.Routes {
+		routes[i] = processor.Route(r)
+	}
+	if h := cfg.Heavy; h.Workers > 0 {
+		pipelines = append(pipelines, processor.PipelineConfig{Name: "heavy", Workers: h.Workers, Buffer: h.Buffer, Timeout: cfg.ProcessingTimeout.Duration, Retry: retryPolicy(cfg.Retry), Admission: admissionConfig(cfg.Admission)})
+		if h.MinItems > 0 {
+			routes = append(routes, processor.Route{Pipeline: "heavy", MinItems: h.MinItems})
+		}
+		if h.MinAmount > 0 {
+			routes = append(routes, processor.Route{Pipeline: "heavy", MinAmount: h.MinAmount})
+		}
+	}
+
+	if cfg.Spill.Dir != "" {
+		for i := range pipelines {
+			pipelines[i].SpillDir = filepath.Join(cfg.Spill.Dir, pipelines[i].Name)
+			pipelines[i].SpillMax = cfg.Spill.MaxOrders
+		}
+	}
+
+	// The self-test uses the simulated payment gateway and keeps orders in
+	// memory, so it can gate a deployment without touching anything.
+	if *selfTest {
+		if err := selftest.Run(context.Background(), pipelines); err != nil {
+			log.Fatalf("selftest failed:\n%v", err)
+		}
+		log.Printf("selftest passed")
+		return
+	}
+
+	// The bolt engine keeps order records, the event log and captures in
+	// one file. It is closed after the pool.
+	var db *boltstore.DB
+	var orders orderstore.Repository
+	if cfg.Storage.Engine == "bolt" {
+		if db, err = boltstore.Open(cfg.Storage.Path); err != nil {
+			log.Fatalf("storage: %v", err)
+		}
+		defer db.Close()
+		orders = db.Orders(processor.DefaultKeptOrders)
+	}
+	// Postgres keeps only the order records. It is closed after the pool
+	// too.
+	var pg *pgstore.Orders
+	if cfg.Storage.Engine == "postgres" {
+		dsn, err := secretManager.Resolve(context.Background(), cfg.Storage.DSN)
+		if err != nil {
+			log.Fatalf("secrets: %v", err)
+		}
+		pg, err = pgstore.Open(context.Background(), dsn.Get(), cfg.Cluster.NodeID)
+		if err != nil {
+			log.Fatalf("storage: %v", err)
+		}
+		defer pg.Close()
+		orders = pg
+	}
+	// The journal keeps the in-memory records of unfinished orders on
+	// disk instead. It is closed after the pool too.
+	var orderJournal *journal.Journal
+	if j := cfg.Journal; j.Dir != "" {
+		orderJournal, err = journal.Open(journal.Config{Dir: j.Dir, Sync: j.Sync, SyncEvery: j.SyncEvery.Duration}, orderstore.New(processor.DefaultKeptOrders))
+		if err != nil {
+			log.Fatalf("journal: %v", err)
+		}
+		defer orderJournal.Close()
+		orders = orderJournal
+		log.Printf("Journaling orders to %s (sync %s)", j.Dir, j.Sync)
+	}
+
+	// The redis backend queues orders and results in Redis, where they
+	// outlive the process and pipelines are shared with other instances.
+	resultsConfig := processor.ResultsConfig{Overflow: cfg.Results.Overflow, SpillDir: cfg.Results.SpillDir, SpillMax: cfg.Results.SpillMax}
+	if q := cfg.Queue; q.Backend == "redis" {
+		password, err := secretManager.Resolve(context.Background(), q.Redis.Password)
+		if err != nil {
+			log.Fatalf("secrets: %v", err)
+		}
+		client := redisq.New(redisq.Config{
+			Addr:     q.Redis.Addr,
+			Username: q.Redis.Username,
+			Password: password.Get(),
+			DB:       q.Redis.DB,
+			TLS:      q.Redis.TLS,
+			Prefix:   q.Redis.Prefix,
+		})
+		defer client.Close()
+		for i := range pipelines {
+			pipelines[i].Redis, pipelines[i].Node = client, cfg.Cluster.NodeID
+		}
+		resultsConfig = processor.ResultsConfig{Redis: client, Node: cfg.Cluster.NodeID}
+		log.Printf("Queueing orders in Redis at %s as node %s", q.Redis.Addr, cfg.Cluster.NodeID)
+	}
+
+	pool, err := processor.StartPipelines(context.Background(), pipelines, routes, orders, resultsConfig)
+	if err != nil {
+		log.Fatalf("pipelines: %v", err)
+	}
+	if cfg.QueueSnapshot != "" {
+		if _, err := pool.RestoreQueued(cfg.QueueSnapshot); err != nil {
+			log.Fatalf("queue snapshot: %v", err)
+		}
+	}
+
+	datasets := make([]enrich.Dataset, len(cfg.Enrichment))
+	for i, e := range cfg.Enrichment {
+		datasets[i] = enrich.Dataset{
+			Name:   e.Name,
+			Key:    e.Key,
+			Tags:   e.Tags,
+			File:   e.File,
+			Reload: cmp.Or(e.Reload.Duration, time.Minute),
+			URL:    e.URL,
+			TTL:    cmp.Or(e.TTL.Duration, 5*time.Minute),
+			Client: out.HTTP(cmp.Or(e.Timeout.Duration, 2*time.Second)),
+		}
+		if e.Token != "" {
+			secret, err := secretManager.Resolve(context.Background(), e.Token)
+			if err != nil {
+				log.Fatalf("secrets: %v", err)
+			}
+			datasets[i].Token = secret.Get
+		}
+	}
+	enricher, err := enrich.New(datasets)
+	if err != nil {
+		log.Fatalf("enrichment: %v", err)
+	}
+	go enricher.Run(pool.Ctx)
+
+	// Orders of subscriptions are enriched like submitted ones.
+	scheduler := subscription.NewScheduler(submitFunc(func(o models.Order) error {
+		enricher.Enrich(pool.Ctx, &o)
+		return pool.Submit(o)
+	}), time.Second)
+	go scheduler.Run(pool.Ctx)
+
+	windows := make([]time.Duration, len(cfg.SLO.Windows))
+	for i, w := range cfg.SLO.Windows {
+		windows[i] = w.Duration
+	}
+	sloTracker := slo.NewTracker(cfg.SLO.Objective, cfg.SLO.Threshold.Duration, windows)
+
+	var watcher *forensics.Watcher
+	if f := cfg.Forensics; f.Dir != "" {
+		var store blobstore.Store
+		if db != nil {
+			store = db.Blobs()
+		} else if store, err = blobstore.NewDir(f.Dir); err != nil {
+			log.Fatalf("forensics: %v", err)
+		}
+		watcher = forensics.NewWatcher(store, forensics.Config{
+			P99:         f.P99.Duration,
+			ErrorRate:   f.ErrorRate,
+			MinSamples:  f.MinSamples,
+			CheckEvery:  f.CheckEvery.Duration,
+			MinGap:      f.MinGap.Duration,
+			CPUDuration: f.CPUDuration.Duration,
+			Keep:        f.Keep,
+		})
+		go watcher.Run(pool.Ctx)
+	}
+
+	var payloads *payload.Store
+	if pc := cfg.Payloads; pc.Dir != "" {
+		var store blobstore.Store
+		if db != nil {
+			store = db.Blobs()
+		} else if store, err = blobstore.NewDir(pc.Dir); err != nil {
+			log.Fatalf("payloads: %v", err)
+		}
+		payloads = payload.New(store, payload.Config{Retention: pc.Retention.Duration, Mask: pc.Mask})
+		go payloads.Run(pool.Ctx)
+	}
+
+	recorder := history.NewRecorder(100000)
+
+	auditLog, err := audit.Open(cfg.AuditFile)
+	if err != nil {
+		log.Fatalf("audit: %v", err)
+	}
+	defer auditLog.Close()
+
+	jobManager, err := jobs.NewManager(cfg.Jobs.Dir, cfg.Jobs.Workers)
+	if err != nil {
+		log.Fatalf("jobs: %v", err)
+	}
+	go jobManager.Run(pool.Ctx)
+
+	var reconciler *reconcile.Reconciler
+	if rc := cfg.Reconcile; rc.URL != "" {
+		states := make(map[string]orderstore.State, len(rc.States))
+		for name, state := range rc.States {
+			states[name] = orderstore.State(state)
+		}
+		fetcher := reconcile.HTTPFetcher{URL: rc.URL, States: states, Client: out.HTTP(30 * time.Second)}
+		reconciler = reconcile.New(pool.Orders, fetcher, jobManager, rc.Settle.Duration)
+		go reconciler.Run(pool.Ctx, rc.Every.Duration)
+	}
+
+	customers, err := customer.NewDirectory(cfg.CustomersFile)
+	if err != nil {
+		log.Fatalf("customers: %v", err)
+	}
+
+	defaultPolicies := make(map[string]tenant.Policy, len(cfg.Tenants.Policies))
+	for name, p := range cfg.Tenants.Policies {
+		defaultPolicies[name] = tenant.Policy{Retention: p.Retention.Duration, Hide: p.Hide, Mask: p.Mask}
+	}
+	policies, err := tenant.NewPolicies(cfg.Tenants.File, defaultPolicies)
+	if err != nil {
+		log.Fatalf("tenants: %v", err)
+	}
+
+	quarantined, err := quarantine.New(cfg.QuarantineFile)
+	if err != nil {
+		log.Fatalf("quarantine: %v", err)
+	}
+
+	if *dev || cfg.Dev.Enabled {
+		generator := &processor.OrderGenerator{
+			Rate: cfg.Dev.Rate,
+			Submit: func(order models.Order) error {
+				recorder.Record(order.ID, history.EventAccepted, "dev traffic")
+				err := pool.Submit(order)
+				if err != nil {
+					recorder.Record(order.ID, history.EventRejected, err.Error())
+				}
+				return err
+			},
+		}
+		go generator.Run(pool.Ctx)
+		log.Printf("Dev mode: generating %.1f orders/sec", cfg.Dev.Rate)
+	}
+
+	qualityTracker := quality.New(cfg.Quality.Targets)
+
+	// Event bus sources stop taking orders when shutdown begins, and commit
+	// what they queued.
+	ingestCtx, stopIngest := context.WithCancel(context.Background())
+	ingestDone := make(chan struct{})
+	sources := source.NewSupervisor()
+	var kafkaSource *kafka.Source
+	if k := cfg.Kafka; k.ProxyURL != "" {
+		kafkaSource = kafka.New(kafka.Config{
+			ProxyURL:    k.ProxyURL,
+			Topic:       k.Topic,
+			Group:       k.Group,
+			PollTimeout: k.PollTimeout.Duration,
+			MaxBytes:    k.MaxBytes,
+			MaxBackoff:  k.MaxBackoff.Duration,
+			// Not the outbound client, which retries polls.
+			Client: &http.Client{Timeout: k.PollTimeout.Duration + 30*time.Second},
+		}, func(o models.Order) error {
+			if _, ok := pool.Orders.Get(o.ID); ok {
+				return nil // redelivered after a crash before its offset was committed
+			}
+			o.Canonicalize()
+			defaultPriority := o.Priority == 0
+			o.SetDefaultValues()
+			o.Tenant, o.SubmittedBy, o.HeldMs = "", "", 0
+			now := time.Now()
+			for _, err := range []error{o.Validate(), validators.Validate(o), o.ValidateDeadline(now)} {
+				if err != nil {
+					qualityTracker.Rejected(quality.SourceKafka, "", o.ID, err)
+					return err
+				}
+			}
+			qualityTracker.Accepted(quality.SourceKafka, o, defaultPriority)
+			enricher.Enrich(ingestCtx, &o)
+			o.CreatedAt = now
+			recorder.Record(o.ID, history.EventAccepted, "kafka")
+			err := pool.Submit(o)
+			if err != nil {
+				recorder.Record(o.ID, history.EventRejected, err.Error())
+			}
+			return err
+		})
+		sources.Add(kafkaSource)
+		log.Printf("Consuming orders from Kafka topic %s as group %s", k.Topic, k.Group)
+	}
+	go func() {
+		defer close(ingestDone)
+		sources.Run(ingestCtx)
+	}()
+
+	var memGuard *memguard.Guard
+	if m := cfg.Memory; m.ShedAboveMB > 0 || m.PauseAboveMB > 0 {
+		memGuard = memguard.New(uint64(m.ShedAboveMB)<<20, uint64(m.PauseAboveMB)<<20, m.ShedPriority)
+		go memGuard.Run(pool.Ctx, m.Interval.Duration)
+	}
+
+	var dedup *idempotency.Cache
+	if i := cfg.Idempotency; i.TTL.Duration > 0 {
+		dedup = idempotency.New(i.TTL.Duration, i.MaxKeys)
+	}
+
+	dropPolicy, err := stream.ParseDropPolicy(cfg.Streams.DropPolicy)
+	if err != nil {
+		log.Fatalf("streams: %v", err)
+	}
+	results := stream.NewBroker(cfg.Streams.Buffer, dropPolicy)
+	feed := stream.NewFeed(cfg.Streams.Replay, cfg.Streams.Buffer)
+	// With Postgres the streams also carry the orders other instances
+	// process, announced through the database.
+	if pg != nil {
+		listenCtx, stopListening := context.WithCancel(context.Background())
+		defer stopListening()
+		go pg.Listen(listenCtx, cfg.Cluster.NodeID, func(result models.ProcessedOrder) {
+			result = policies.Apply(result)
+			results.Publish(result)
+			feed.Processed(result)
+		})
+	}
+
+	var events *eventbus.Bus
+	if cfg.Events.Dir != "" {
+		if db != nil {
+			events, err = eventbus.New(db.Events(), cfg.Events.Retain)
+		} else {
+			events, err = eventbus.Open(cfg.Events.Dir, cfg.Events.Retain)
+		}
+		if err != nil {
+			log.Fatalf("events: %v", err)
+		}
+		defer events.Close()
+	}
+	go policies.RunRetention(pool.Ctx, pool.Orders, events, cfg.Tenants.CheckEvery.Duration)
+
+	var exporter *analytics.Exporter
+	if a := cfg.Analytics; a.Sink != "" {
+		token := func() string { return "" }
+		if a.Token != "" {
+			secret, err := secretManager.Resolve(context.Background(), a.Token)
+			if err != nil {
+				log.Fatalf("secrets: %v", err)
+			}
+			token = secret.Get
+		}
+		sink, err := analytics.NewSink(a.Sink, analytics.SinkConfig{
+			URL:     a.URL,
+			Table:   a.Table,
+			User:    a.User,
+			Token:   token,
+			Project: a.Project,
+			Dataset: a.Dataset,
+			Client:  out.HTTP(time.Minute),
+		})
+		if err != nil {
+			log.Fatalf("analytics: %v", err)
+		}
+		exporter = analytics.NewExporter(events, sink, analytics.Config{
+			Subscriber: "analytics:" + a.Sink,
+			BatchSize:  a.BatchSize,
+			FlushEvery: a.FlushEvery.Duration,
+			MaxBackoff: a.MaxBackoff.Duration,
+			Transform:  transforms[a.Transform],
+		})
+		go exporter.Run(pool.Ctx)
+	}
+
+	var webhooks []*webhook.Dispatcher
+	for _, w := range cfg.Webhooks {
+		consumer := webhook.Consumer{
+			Name:       w.Name,
+			URL:        w.URL,
+			Encryption: w.Encryption,
+			Transform:  transforms[w.Transform],
+		}
+		if w.Digest != nil {
+			consumer.Digest = &webhook.Digest{Every: w.Digest.Every.Duration, GroupBy: w.Digest.GroupBy, Jobs: jobManager}
+		}
+		if w.Secret != "" {
+			secret, err := secretManager.Resolve(context.Background(), w.Secret)
+			if err != nil {
+				log.Fatalf("secrets: %v", err)
+			}
+			consumer.Secret = secret.Get
+		}
+		if w.Encryption != "" {
+			if consumer.Encrypter, err = webhook.NewEncrypter(w.Encryption, w.PublicKey); err != nil {
+				log.Fatalf("webhook %s: %v", w.Name, err)
+			}
+		}
+		timeout := w.Timeout.Duration
+		if timeout <= 0 {
+			timeout = 30 * time.Second
+		}
+		d := webhook.NewDispatcher(events, out.HTTP(timeout), consumer)
+		go d.Run(pool.Ctx)
+		webhooks = append(webhooks, d)
+	}
+
+	var registry *webhook.Registry
+	if wr := cfg.WebhookRegistrations; wr.Enabled {
+		// Without an allow-list, deliveries may only reach public
+		// addresses, whatever the registered hosts resolve to later.
+		client := out.HTTP(wr.Timeout.Duration)
+		if len(wr.AllowedHosts) == 0 {
+			client = out.PublicHTTP(wr.Timeout.Duration)
+		}
+		registry, err = webhook.NewRegistry(pool.Ctx, events, client, webhook.RegistryConfig{
+			File:         wr.File,
+			AllowedHosts: wr.AllowedHosts,
+			MaxPerTenant: wr.MaxPerTenant,
+		})
+		if err != nil {
+			log.Fatalf("webhook registrations: %v", err)
+		}
+	}
+
+	var publishers []*publish.Publisher
+	for _, p := range cfg.Publishers {
+		var token func() string
+		if p.Token != "" {
+			secret, err := secretManager.Resolve(context.Background(), p.Token)
+			if err != nil {
+				log.Fatalf("secrets: %v", err)
+			}
+			token = secret.Get
+		}
+		timeout := p.Timeout.Duration
+		if timeout <= 0 {
+			timeout = 30 * time.Second
+		}
+		var sink publish.Sink = &publish.JetStream{URL: p.URL, Token: token, Timeout: timeout}
+		if p.Broker == "kafka" {
+			sink = &publish.Kafka{URL: p.URL, Token: token, Client: out.HTTP(timeout)}
+		}
+		publisher := publish.New(events, sink, publish.Config{
+			Name:         p.Name,
+			SuccessTopic: p.SuccessTopic,
+			FailureTopic: p.FailureTopic,
+			Transform:    transforms[p.Transform],
+			MaxBackoff:   time.Minute,
+		})
+		go publisher.Run(pool.Ctx)
+		publishers = append(publishers, publisher)
+	}
+
+	var callbacks *webhook.Callbacks
+	if cb := cfg.Callbacks; cb.Enabled {
+		cc := webhook.CallbackConfig{AllowedHosts: cb.AllowedHosts, MaxAttempts: cb.MaxAttempts, Workers: cb.Workers}
+		if cb.Secret != "" {
+			secret, err := secretManager.Resolve(context.Background(), cb.Secret)
+			if err != nil {
+				log.Fatalf("secrets: %v", err)
+			}
+			cc.Secret = secret.Get
+		}
+		// Like registered webhooks, callbacks without an allow-list may
+		// only reach public addresses.
+		client := out.HTTP(cb.Timeout.Duration)
+		if len(cb.AllowedHosts) == 0 {
+			client = out.PublicHTTP(cb.Timeout.Duration)
+		}
+		callbacks = webhook.NewCallbacks(client, cc)
+		go callbacks.Run(pool.Ctx)
+	}
+
+	metricsRecorder, err := metrics.New(metrics.Config{
+		Labels:    cfg.Metrics.Labels,
+		MaxValues: cfg.Metrics.MaxValues,
+		Values:    cfg.Metrics.Values,
+		Buckets:   cfg.Metrics.Buckets,
+	})
+	if err != nil {
+		log.Fatalf("metrics: %v", err)
+	}
+	pulledMetrics := metricsRecorder
+	if cfg.Metrics.DisablePull {
+		pulledMetrics = nil
+	}
 
 	// Start result processor goroutine
+	resultsDone := make(chan struct{})
 	go func() {
+		defer close(resultsDone)
 		for result := range pool.Results {
+			payments.Finished(result.Order)
+			// Every egress path sees only what the tenant's policy allows.
+			result = policies.Apply(result)
+			results.Publish(result)
+			feed.Processed(result)
+			if pg != nil {
+				pg.Notify(cfg.Cluster.NodeID, result.Order.ID)
+			}
+			metricsRecorder.Observe(result)
+			if callbacks != nil {
+				callbacks.Enqueue(result)
+			}
+			if events != nil {
+				if err := events.Publish(result); err != nil {
+					log.Printf("events: %v", err)
+				}
+			}
+			if result.Order.HeldMs == 0 {
+				sloTracker.Record(result.Success, time.Duration(result.EndToEndTime)*time.Millisecond)
+				if watcher != nil {
+					watcher.Observe(result.Success, time.Duration(result.EndToEndTime)*time.Millisecond)
+				}
+			}
 			if result.Success {
+				recorder.Record(result.Order.ID, history.EventProcessed, result.Result)
 				log.Printf("✅ Order %s processed successfully by worker %d in %dms: %s",
-					result.Order.ID, result.WorkerID, result.ProcessingTime, result.Result)
+					result.Order.ID, result.WorkerID, result.ProcessingTime, result.ResultCode)
 			} else {
-				log.Printf("❌ Order %s processing failed by worker %d: %s",
-					result.Order.ID, result.WorkerID, result.Error)
+				recorder.Record(result.Order.ID, history.EventFailed, result.Error)
+				log.Printf("❌ Order %s processing failed by worker %d: %s (%s)",
+					result.Order.ID, result.WorkerID, result.ErrorCode, result.Error)
 			}
 		}
 	}()
 
-	handler.RegisterRoutes(mux, pool)
+	life := lifecycle.New()
+	handler.RegisterRoutes(mux, pool, handler.Options{
+		NodeID:         cfg.Cluster.NodeID,
+		Cluster:        cluster.NewAggregator(cfg.Cluster.NodeID, cfg.Cluster.Peers, out.HTTP(cfg.Cluster.Timeout.Duration)),
+		Outbound:       out,
+		SLO:            sloTracker,
+		Forensics:      watcher,
+		Payloads:       payloads,
+		Subscriptions:  scheduler,
+		Credits:        ledger,
+		History:        recorder,
+		Customers:      customers,
+		Enricher:       enricher,
+		Quality:        qualityTracker,
+		Tenants:        policies,
+		Quarantine:     quarantined,
+		Views:          &view.Views{Submitter: view.Policy(cfg.Views.Submitter)},
+		Metrics:        pulledMetrics,
+		Audit:          auditLog,
+		Jobs:           jobManager,
+		Reconciliation: reconciler,
+		Lifecycle:      life,
+		Memory:         memGuard,
+		Idempotency:    dedup,
+		Validators:     validators,
+		Tags:           models.TagPolicy{MaxTags: cfg.Tags.MaxTags, Allowed: cfg.Tags.Allowed},
+		Auth:           &auth.Authenticator{Keys: keys, Certs: certs, AdminKey: adminKey.Get},
+		RequireAPIKey:  cfg.Auth.Enabled,
+
+		Results:         results,
+		StreamHeartbeat: cfg.Streams.Heartbeat.Duration,
+		Events:          events,
+		Feed:            feed,
+		Analytics:       exporter,
+		Kafka:           kafkaSource,
+		Sources:         sources,
+		Journal:         orderJournal,
+		Transforms:      transforms,
+		Webhooks:        webhooks,
+		WebhookRegistry: registry,
+		Publishers:      publishers,
+		Callbacks:       callbacks,
+		Shipping:        shippingRules,
+
+		Signatures:       signatures,
+		RequireSignature: cfg.Signing.Required,
+	})
 
 	// Register pprof handlers with our custom mux
 	// The pprof package automatically registers handlers with http.DefaultServeMux
@@ -61,12 +804,300 @@ func main() {
 		http.DefaultServeMux.ServeHTTP(w, r)
 	}))
 
+	rules, err := firewall.New(firewall.Config(cfg.Firewall))
+	if err != nil {
+		log.Fatalf("firewall: %v", err)
+	}
+
+	// Push the metrics /metrics serves; the last push is at shutdown.
+	stopPush, pushDone := func() {}, make(chan struct{})
+	if p := cfg.Metrics.Push; p.Protocol != "" {
+		pusher, err := metrics.NewPusher(metrics.PushConfig{
+			Protocol:    p.Protocol,
+			Addr:        p.Addr,
+			Endpoint:    p.Endpoint,
+			Interval:    p.Interval.Duration,
+			Prefix:      p.Prefix,
+			MaxPacket:   p.MaxPacket,
+			ServiceName: p.ServiceName,
+		}, func(w io.Writer) {
+			handler.WriteMetrics(w, pool, metricsRecorder, qualityTracker)
+		}, out.HTTP(10*time.Second))
+		if err != nil {
+			log.Fatalf("metrics: %v", err)
+		}
+		var pushCtx context.Context
+		pushCtx, stopPush = context.WithCancel(context.Background())
+		go func() {
+			defer close(pushDone)
+			pusher.Run(pushCtx)
+		}()
+	} else {
+		close(pushDone)
+	}
+
+	var app http.Handler = metricsRecorder.HTTP(mux)
+	if t := cfg.RecordTraffic; t.File != "" {
+		recording, err := traffic.Open(t.File, traffic.Config{Paths: t.Paths, Sample: t.Sample, Mask: t.Mask})
+		if err != nil {
+			log.Fatalf("record traffic: %v", err)
+		}
+		defer recording.Close()
+		app = recording.Middleware(app)
+	}
+	if cfg.ErrorDocsURL != "" {
+		problem.DocsURL = cfg.ErrorDocsURL
+	}
+	api := problem.Middleware(rules.Middleware(app))
+	// Requests get serveCtx as their base, so streams and long polls end
+	// once the pool is drained at shutdown.
+	serveCtx, endRequests := context.WithCancel(context.Background())
 	srv := &http.Server{
-		Addr:    ":8080",
-		Handler: mux,
+		Addr:        cfg.Addr,
+		Handler:     api,
+		BaseContext: func(net.Listener) context.Context { return serveCtx },
+	}
+	if cfg.TLS.ClientCAFile != "" {
+		srv.TLSConfig, err = clientAuthTLS(cfg.TLS)
+		if err != nil {
+			log.Fatalf("tls: %v", err)
+		}
+	}
+	mode, _ := strconv.ParseUint(cfg.SocketMode, 8, 32) // checked by config
+	ln, err := listen(cfg.Addr, os.FileMode(mode))
+	if err != nil {
+		log.Fatalf("listen: %v", err)
+	}
+
+	var h3 *http3.Server
+	if cfg.HTTP3.Addr != "" {
+		h3 = &http3.Server{Addr: cfg.HTTP3.Addr, Handler: api}
+		if h3.TLSConfig, err = quicTLS(cfg.TLS, srv.TLSConfig); err != nil {
+			log.Fatalf("http3: %v", err)
+		}
+		go func() {
+			log.Printf("HTTP/3 listening on udp %s", h3.Addr)
+			if err := h3.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				log.Fatal(err)
+			}
+		}()
+		if cfg.HTTP3.AltSvc {
+			srv.Handler = handler.AltSvc(cfg.HTTP3.Addr, cfg.HTTP3.AltSvcMaxAge.Duration, api)
+		}
 	}
 
 	log.Printf("API listening on %s", srv.Addr)
 	log.Printf("Profiling available at http://localhost:8080/debug/pprof/")
-	log.Fatal(srv.ListenAndServe())
+	go func() {
+		var err error
+		if cfg.TLS.CertFile != "" {
+			err = srv.ServeTLS(ln, cfg.TLS.CertFile, cfg.TLS.KeyFile)
+		} else {
+			err = srv.Serve(ln)
+		}
+		if !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
+	life.Advance(lifecycle.Ready)
+
+	signals, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	<-signals.Done()
+	stop() // a second signal kills the process
+
+	// While quiescing /readyz fails and orders are refused, but the
+	// listener stays open so balancers see the failure; every response
+	// closes its connection.
+	life.Advance(lifecycle.Quiescing)
+	srv.SetKeepAlivesEnabled(false)
+	stopIngest()
+	if q := cfg.QuiescePeriod.Duration; q > 0 {
+		log.Printf("shutting down: quiescing for %s", q)
+		time.Sleep(q)
+	}
+	<-ingestDone
+	life.Advance(lifecycle.Draining)
+	log.Printf("shutting down: draining up to %s", cfg.ShutdownTimeout.Duration)
+
+	// New requests are refused while the queued orders are processed;
+	// requests in flight finish alongside.
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout.Duration)
+	defer cancel()
+	httpDone := make(chan error, 1)
+	go func() { httpDone <- srv.Shutdown(ctx) }()
+	abandoned := processor.Drain(ctx, pool)
+	<-resultsDone
+	endRequests()
+	if err := <-httpDone; err != nil {
+		log.Printf("shutdown: %v", err)
+	}
+	if h3 != nil {
+		h3.Close()
+	}
+	life.Advance(lifecycle.Stopped)
+	if abandoned > 0 && cfg.QueueSnapshot != "" {
+		saved, err := pool.SaveQueued(cfg.QueueSnapshot)
+		if err != nil {
+			log.Printf("shutdown: saving queued orders: %v", err)
+		}
+		log.Printf("shutdown: saved %d queued orders to %s", saved, cfg.QueueSnapshot)
+	} else if abandoned > 0 {
+		log.Printf("shutdown: abandoned %d queued orders", abandoned)
+	} else {
+		log.Printf("shutdown: all queued orders processed")
+	}
+	flushCtx, flushCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer flushCancel()
+	if err := shutdownTracing(flushCtx); err != nil {
+		log.Printf("shutdown: tracing: %v", err)
+	}
+	stopPush()
+	<-pushDone
+}
+
+// retryPolicy converts a configured retry policy.
+func retryPolicy(r config.RetryConfig) processor.RetryPolicy {
+	return processor.RetryPolicy{
+		MaxAttempts: r.MaxAttempts,
+		BaseDelay:   r.BaseDelay.Duration,
+		MaxDelay:    r.MaxDelay.Duration,
+		Jitter:      r.Jitter,
+	}
+}
+
+// admissionConfig converts a configured admission strategy.
+func admissionConfig(a config.AdmissionConfig) processor.AdmissionConfig {
+	return processor.AdmissionConfig{
+		Strategy:     a.Strategy,
+		Rate:         a.Rate,
+		Burst:        a.Burst,
+		Target:       a.Target.Duration,
+		Interval:     a.Interval.Duration,
+		ShedLowAt:    a.ShedLowAt,
+		ShedMediumAt: a.ShedMediumAt,
+	}
+}
+
+// autoscaleConfig converts a configured autoscaling policy; nil disables
+// autoscaling.
+func autoscaleConfig(a *config.AutoscaleConfig) *processor.AutoscaleConfig {
+	if a == nil {
+		return nil
+	}
+	return &processor.AutoscaleConfig{
+		MinWorkers: a.MinWorkers,
+		MaxWorkers: a.MaxWorkers,
+		HighWater:  a.HighWater,
+		UpAfter:    a.UpAfter.Duration,
+		DownAfter:  a.DownAfter.Duration,
+	}
+}
+
+// submitFunc adapts a function to subscription.Submitter.
+type submitFunc func(models.Order) error
+
+func (f submitFunc) Submit(o models.Order) error {
+	return f(o)
+}
+
+// listen opens a TCP listener, or a Unix socket for "unix:/path" addresses.
+// A socket left behind by a previous run is replaced.
+func listen(addr string, mode os.FileMode) (net.Listener, error) {
+	path, ok := strings.CutPrefix(addr, "unix:")
+	if !ok {
+		return net.Listen("tcp", addr)
+	}
+	if fi, err := os.Lstat(path); err == nil && fi.Mode().Type() == os.ModeSocket {
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+// clientAuthTLS verifies the client certificates of TLS connections
+// against the CAs of t.ClientCAFile.
+func clientAuthTLS(t config.TLSConfig) (*tls.Config, error) {
+	pem, err := os.ReadFile(t.ClientCAFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates in %s", t.ClientCAFile)
+	}
+	cfg := &tls.Config{ClientCAs: pool, ClientAuth: tls.VerifyClientCertIfGiven}
+	if t.RequireClientCert {
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return cfg, nil
+}
+
+// quicTLS is the TCP listener's TLS config, client certificate checks
+// included, with the server certificate loaded for the HTTP/3 listener;
+// its ListenAndServeTLS would use the certificate alone.
+func quicTLS(t config.TLSConfig, tcp *tls.Config) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &tls.Config{}
+	if tcp != nil {
+		cfg = tcp.Clone()
+	}
+	cfg.Certificates = []tls.Certificate{cert}
+	return cfg, nil
+}
+
+func newSecretsProvider(cfg config.SecretsConfig, out *outbound.Client) (secrets.Provider, error) {
+	switch cfg.Provider {
+	case "file":
+		key, err := secrets.ParseKey(os.Getenv(cfg.KeyEnv))
+		if err != nil {
+			return nil, err
+		}
+		return secrets.FileProvider{Path: cfg.File, Key: key}, nil
+	case "vault":
+		return secrets.VaultProvider{
+			Addr:   cfg.VaultAddr,
+			Mount:  cfg.VaultMount,
+			Token:  os.Getenv(cfg.VaultTokenEnv),
+			Client: out.HTTP(10 * time.Second),
+		}, nil
+	case "aws":
+		region := cmp.Or(cfg.AWSRegion, os.Getenv("AWS_REGION"))
+		if region == "" {
+			return nil, errors.New("secrets: aws provider needs aws_region or AWS_REGION")
+		}
+		return secrets.AWSProvider{
+			Region:          region,
+			Endpoint:        cfg.AWSEndpoint,
+			AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+			Client:          out.HTTP(10 * time.Second),
+		}, nil
+	default:
+		return secrets.EnvProvider{Prefix: cfg.EnvPrefix}, nil
+	}
+}
+
+func buildShippingRules(c config.ShippingConfig) (*shipping.Rules, error) {
+	loc, err := time.LoadLocation(c.Timezone)
+	if err != nil {
+		return nil, err
+	}
+	services := make([]shipping.Service, len(c.Services))
+	for i, s := range c.Services {
+		services[i] = shipping.Service{Name: s.Name, TransitDays: s.TransitDays}
+	}
+	return shipping.NewRules(loc, c.Cutoff, c.BlackoutDates, c.MaxAdvance.Duration, services)
 }
@@ -0,0 +1,218 @@
+// Command mockproviders simulates the external payment, shipping and
+// address-validation providers, and an order management system that
+// records the outcome of every charge, for local development. Latency and failure
+// rates come from a profile per provider and are drawn from a seeded
+// generator, so a chaos scenario replays the same way every run.
+//
+//	mockproviders -addr :9090 -seed 42 -profiles chaos.json
+//
+// A profiles file maps provider names to overrides of the flag defaults:
+//
+//	{"payment": {"latency": "200ms", "jitter": "100ms", "error_rate": 0.2}}
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/config"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/pkg/models"
+)
+
+// profile is how a simulated provider behaves.
+type profile struct {
+	Latency     config.Duration `json:"latency"`
+	Jitter      config.Duration `json:"jitter"`
+	ErrorRate   float64         `json:"error_rate"`   // share of requests answered with 503
+	TimeoutRate float64         `json:"timeout_rate"` // share of requests that hang for 30s
+	DeclineOver models.Money    `json:"decline_over"` // payment only; 0 approves everything
+}
+
+// provider applies a profile to requests using a shared seeded generator.
+type provider struct {
+	name    string
+	profile profile
+
+	mu  *sync.Mutex
+	rng *rand.Rand
+}
+
+func (p provider) draw() (delay time.Duration, fail, hang bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delay = p.profile.Latency.Duration
+	if j := p.profile.Jitter.Duration; j > 0 {
+		delay += time.Duration(p.rng.Int64N(int64(j)))
+	}
+	roll := p.rng.Float64()
+	return delay, roll < p.profile.ErrorRate, roll >= p.profile.ErrorRate && roll < p.profile.ErrorRate+p.profile.TimeoutRate
+}
+
+// wrap delays the request and injects failures before calling next.
+func (p provider) wrap(next func(w http.ResponseWriter, r *http.Request)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		delay, fail, hang := p.draw()
+		if hang {
+			delay = 30 * time.Second
+		}
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+		if fail {
+			log.Printf("%s: injected failure for %s %s", p.name, r.Method, r.URL.Path)
+			http.Error(w, "injected failure", http.StatusServiceUnavailable)
+			return
+		}
+		next(w, r)
+	}
+}
+
+func main() {
+	addr := flag.String("addr", ":9090", "listen address")
+	seed := flag.Uint64("seed", 1, "random seed for latency and failures")
+	latency := flag.Duration("latency", 50*time.Millisecond, "default base latency")
+	jitter := flag.Duration("jitter", 20*time.Millisecond, "default random extra latency")
+	errorRate := flag.Float64("error-rate", 0, "default share of requests failing with 503")
+	profilesPath := flag.String("profiles", "", "JSON file of per-provider profiles")
+	flag.Parse()
+
+	defaults := profile{
+		Latency:   config.Duration{Duration: *latency},
+		Jitter:    config.Duration{Duration: *jitter},
+		ErrorRate: *errorRate,
+	}
+	profiles := map[string]profile{"payment": defaults, "shipping": defaults, "address": defaults, "oms": defaults}
+	if *profilesPath != "" {
+		data, err := os.ReadFile(*profilesPath)
+		if err != nil {
+			log.Fatalf("profiles: %v", err)
+		}
+		// Decode over the defaults so a profile only lists what it changes.
+		overrides := map[string]json.RawMessage{}
+		if err := json.Unmarshal(data, &overrides); err != nil {
+			log.Fatalf("profiles: %v", err)
+		}
+		for name, raw := range overrides {
+			p, ok := profiles[name]
+			if !ok {
+				log.Fatalf("profiles: unknown provider %q", name)
+			}
+			if err := json.Unmarshal(raw, &p); err != nil {
+				log.Fatalf("profiles: %s: %v", name, err)
+			}
+			profiles[name] = p
+		}
+	}
+
+	var mu sync.Mutex
+	rng := rand.New(rand.NewPCG(*seed, *seed))
+	newProvider := func(name string) provider {
+		return provider{name: name, profile: profiles[name], mu: &mu, rng: rng}
+	}
+	payment, shipping, address, oms := newProvider("payment"), newProvider("shipping"), newProvider("address"), newProvider("oms")
+
+	// The order management system learns an order's state from its charge.
+	var omsMu sync.Mutex
+	omsStates := make(map[string]string)
+	setOMSState := func(orderID, state string) {
+		omsMu.Lock()
+		defer omsMu.Unlock()
+		omsStates[orderID] = state
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /payment/charges", payment.wrap(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			OrderID string       `json:"order_id"`
+			Amount  models.Money `json:"amount"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.OrderID == "" {
+			http.Error(w, "order_id and amount are required", http.StatusBadRequest)
+			return
+		}
+		if d := payment.profile.DeclineOver; d > 0 && req.Amount > d {
+			setOMSState(req.OrderID, "failed")
+			writeJSON(w, http.StatusPaymentRequired, map[string]string{"status": "declined"})
+			return
+		}
+		setOMSState(req.OrderID, "processed")
+		writeJSON(w, http.StatusOK, map[string]string{"status": "approved", "reference": "mock_" + req.OrderID})
+	}))
+	mux.HandleFunc("POST /shipping/quotes", shipping.wrap(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Address string   `json:"address"`
+			Items   []string `json:"items"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Address == "" {
+			http.Error(w, "address is required", http.StatusBadRequest)
+			return
+		}
+		cost := models.Whole(5) + models.Money(len(req.Items))*models.Whole(1)
+		writeJSON(w, http.StatusOK, map[string]any{"carrier": "mockship", "cost": cost, "days": 3})
+	}))
+	mux.HandleFunc("POST /shipping/shipments", shipping.wrap(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			OrderID string `json:"order_id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.OrderID == "" {
+			http.Error(w, "order_id is required", http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, http.StatusCreated, map[string]string{"tracking_number": "MOCK" + strings.ToUpper(req.OrderID)})
+	}))
+	mux.HandleFunc("POST /address/validate", address.wrap(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Address string `json:"address"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid JSON", http.StatusBadRequest)
+			return
+		}
+		normalized := strings.Join(strings.Fields(req.Address), " ")
+		// Anything with a house number and a street counts as deliverable.
+		valid := strings.ContainsAny(normalized, "0123456789") && len(strings.Fields(normalized)) >= 2
+		writeJSON(w, http.StatusOK, map[string]any{"valid": valid, "normalized": normalized})
+	}))
+	mux.HandleFunc("POST /oms/orders/states", oms.wrap(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			IDs []string `json:"ids"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid JSON", http.StatusBadRequest)
+			return
+		}
+		states := make(map[string]string, len(req.IDs))
+		omsMu.Lock()
+		for _, id := range req.IDs {
+			if state, ok := omsStates[id]; ok {
+				states[id] = state
+			}
+		}
+		omsMu.Unlock()
+		writeJSON(w, http.StatusOK, map[string]any{"states": states})
+	}))
+
+	for _, name := range []string{"payment", "shipping", "address", "oms"} {
+		p := profiles[name]
+		fmt.Printf("%-8s latency=%s jitter=%s error_rate=%.2f timeout_rate=%.2f\n",
+			name, p.Latency.Duration, p.Jitter.Duration, p.ErrorRate, p.TimeoutRate)
+	}
+	log.Printf("mock providers listening on %s (seed %d)", *addr, *seed)
+	log.Fatal(http.ListenAndServe(*addr, mux))
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
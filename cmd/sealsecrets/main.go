@@ -0,0 +1,53 @@
+// Command sealsecrets encrypts a JSON file of secrets for the "file"
+// secrets provider.
+//
+//	sealsecrets -key $SECRETS_KEY -in secrets.json -out secrets.enc
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/secrets"
+)
+
+func main() {
+	keyHex := flag.String("key", "", "hex encoded 32-byte key")
+	in := flag.String("in", "", "plaintext JSON object of secrets")
+	out := flag.String("out", "", "sealed output file")
+	genKey := flag.Bool("genkey", false, "print a new random key and exit")
+	flag.Parse()
+
+	if *genKey {
+		key := make([]byte, 32)
+		_, _ = rand.Read(key)
+		fmt.Println(hex.EncodeToString(key))
+		return
+	}
+
+	key, err := secrets.ParseKey(*keyHex)
+	if err != nil {
+		log.Fatal(err)
+	}
+	plain, err := os.ReadFile(*in)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var check map[string]string
+	if err := json.Unmarshal(plain, &check); err != nil {
+		log.Fatalf("input must be a JSON object of strings: %v", err)
+	}
+
+	sealed, err := secrets.Seal(key, plain)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile(*out, sealed, 0o600); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,248 @@
+// Package analytics exports result events to an analytics store for
+// offline queries. The exporter reads the durable event bus as a named
+// subscriber and acks a batch only after the sink accepted it, so every
+// event is delivered at least once, also across restarts.
+package analytics
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/eventbus"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/transform"
+)
+
+// Row is the flattened form of one result event written to the sink.
+type Row struct {
+	Seq          uint64    `json:"seq"`
+	EventTime    time.Time `json:"event_time"`
+	OrderID      string    `json:"order_id"`
+	Customer     string    `json:"customer"`
+	Tenant       string    `json:"tenant"`
+	Pipeline     string    `json:"pipeline"`
+	WorkerID     int       `json:"worker_id"`
+	Success      bool      `json:"success"`
+	ErrorCode    string    `json:"error_code"`
+	ResultCode   string    `json:"result_code"`
+	AmountCents  int64     `json:"amount_cents"`
+	Items        []string  `json:"items"`
+	Priority     int       `json:"priority"`
+	CreatedAt    time.Time `json:"created_at"`
+	ProcessingMs int64     `json:"processing_ms"`
+	QueueWaitMs  int64     `json:"queue_wait_ms"`
+	EndToEndMs   int64     `json:"end_to_end_ms"`
+	CPUMicros    int64     `json:"cpu_us"`
+}
+
+func newRow(e eventbus.Event) Row {
+	r := e.Result
+	row := Row{
+		Seq:          e.Seq,
+		EventTime:    e.Time,
+		OrderID:      r.Order.ID,
+		Customer:     r.Order.Customer,
+		Tenant:       r.Order.Tenant,
+		Pipeline:     r.Pipeline,
+		WorkerID:     r.WorkerID,
+		Success:      r.Success,
+		ErrorCode:    r.ErrorCode,
+		ResultCode:   r.ResultCode,
+		AmountCents:  int64(r.Order.Amount),
+		Items:        r.Order.Items,
+		Priority:     int(r.Order.Priority),
+		CreatedAt:    r.Order.CreatedAt,
+		ProcessingMs: r.ProcessingTime,
+		QueueWaitMs:  r.QueueWaitTime,
+		EndToEndMs:   r.EndToEndTime,
+	}
+	if r.Cost != nil {
+		row.CPUMicros = r.Cost.CPUMicros
+	}
+	return row
+}
+
+// Record is one encoded row: a Row, or whatever the exporter's transform
+// made of it.
+type Record struct {
+	Seq     uint64
+	OrderID string
+	Data    json.RawMessage
+}
+
+// Sink writes a batch of records. It must either store the whole batch or
+// return an error; a failed batch is retried as is, so sinks should
+// tolerate duplicates.
+type Sink interface {
+	Insert(ctx context.Context, records []Record) error
+}
+
+type Config struct {
+	Subscriber string               // event bus subscriber name
+	BatchSize  int                  // rows per insert
+	FlushEvery time.Duration        // longest a partial batch waits for more rows
+	MaxBackoff time.Duration        // cap on the wait between failed inserts
+	Transform  *transform.Transform // reshapes each Row; nil writes Rows as is
+}
+
+// Stats describes the exporter's progress. LagSeconds is the age of the
+// oldest event not yet exported.
+type Stats struct {
+	Exported   uint64    `json:"exported"`
+	Batches    uint64    `json:"batches"`
+	Failures   uint64    `json:"failures"`
+	Skipped    uint64    `json:"skipped"` // aged out of the event log before export
+	Pending    uint64    `json:"pending"`
+	LagSeconds float64   `json:"lag_seconds"`
+	LastExport time.Time `json:"last_export,omitzero"`
+	LastError  string    `json:"last_error,omitempty"`
+}
+
+type Exporter struct {
+	bus  *eventbus.Bus
+	sink Sink
+	cfg  Config
+
+	mu       sync.Mutex
+	stats    Stats
+	inFlight time.Time // time of the oldest event being exported
+}
+
+func NewExporter(bus *eventbus.Bus, sink Sink, cfg Config) *Exporter {
+	return &Exporter{bus: bus, sink: sink, cfg: cfg}
+}
+
+// Run exports batches until ctx is done.
+func (e *Exporter) Run(ctx context.Context) {
+	for ctx.Err() == nil {
+		batch, err := e.collect(ctx)
+		if err != nil {
+			log.Printf("analytics: read events: %v", err)
+			sleep(ctx, time.Second)
+			continue
+		}
+		if batch.Skipped > 0 {
+			e.mu.Lock()
+			e.stats.Skipped += batch.Skipped
+			e.mu.Unlock()
+		}
+		if len(batch.Events) == 0 {
+			continue
+		}
+		e.export(ctx, batch.Events)
+	}
+}
+
+// collect waits for at least one event, then up to FlushEvery for the batch
+// to fill.
+func (e *Exporter) collect(ctx context.Context) (eventbus.Batch, error) {
+	batch, err := e.bus.Read(ctx, e.cfg.Subscriber, e.cfg.BatchSize)
+	if err != nil || len(batch.Events) == 0 {
+		return batch, err
+	}
+	deadline := time.Now().Add(e.cfg.FlushEvery)
+	for len(batch.Events) < e.cfg.BatchSize && time.Now().Before(deadline) {
+		sleep(ctx, min(time.Until(deadline), e.cfg.FlushEvery/4))
+		if ctx.Err() != nil {
+			break
+		}
+		// Nothing is acked yet, so this returns the same events plus any new ones.
+		if batch, err = e.bus.Read(ctx, e.cfg.Subscriber, e.cfg.BatchSize); err != nil {
+			return batch, err
+		}
+	}
+	return batch, nil
+}
+
+// export inserts events, retrying with backoff until the sink accepts them
+// or ctx is done, then acks them.
+func (e *Exporter) export(ctx context.Context, events []eventbus.Event) {
+	rows := make([]Record, 0, len(events))
+	for _, ev := range events {
+		data, err := e.cfg.Transform.Apply(newRow(ev))
+		if err != nil {
+			// Retrying won't help; count the event as skipped.
+			log.Printf("analytics: transform event %d: %v", ev.Seq, err)
+			e.mu.Lock()
+			e.stats.Skipped++
+			e.mu.Unlock()
+			continue
+		}
+		rows = append(rows, Record{Seq: ev.Seq, OrderID: ev.Result.Order.ID, Data: data})
+	}
+	e.mu.Lock()
+	e.inFlight = events[0].Time
+	e.mu.Unlock()
+
+	backoff := time.Second
+	for len(rows) > 0 {
+		err := e.sink.Insert(ctx, rows)
+		if err == nil {
+			break
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("analytics: insert %d rows: %v", len(rows), err)
+		e.mu.Lock()
+		e.stats.Failures++
+		e.stats.LastError = err.Error()
+		e.mu.Unlock()
+		sleep(ctx, backoff)
+		backoff = min(backoff*2, e.cfg.MaxBackoff)
+	}
+
+	last := events[len(events)-1].Seq
+	if err := e.bus.Ack(e.cfg.Subscriber, last); err != nil {
+		// The batch will be exported again after a restart.
+		log.Printf("analytics: ack %d: %v", last, err)
+	}
+	e.mu.Lock()
+	e.stats.Exported += uint64(len(rows))
+	e.stats.Batches++
+	e.stats.LastExport = time.Now()
+	e.stats.LastError = ""
+	e.inFlight = time.Time{}
+	e.mu.Unlock()
+}
+
+func (e *Exporter) Stats() Stats {
+	e.mu.Lock()
+	stats := e.stats
+	inFlight := e.inFlight
+	e.mu.Unlock()
+
+	for _, sub := range e.bus.Subscribers() {
+		if sub.Name == e.cfg.Subscriber {
+			stats.Pending = sub.Lag
+		}
+	}
+	if !inFlight.IsZero() {
+		stats.LagSeconds = time.Since(inFlight).Seconds()
+	}
+	return stats
+}
+
+func sleep(ctx context.Context, d time.Duration) {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+	case <-t.C:
+	}
+}
+
+// NewSink returns the sink for kind, "clickhouse" or "bigquery".
+func NewSink(kind string, cfg SinkConfig) (Sink, error) {
+	switch kind {
+	case "clickhouse":
+		return &ClickHouse{URL: cfg.URL, Table: cfg.Table, User: cfg.User, Password: cfg.Token, Client: cfg.Client}, nil
+	case "bigquery":
+		return &BigQuery{BaseURL: cfg.URL, Project: cfg.Project, Dataset: cfg.Dataset, Table: cfg.Table, Token: cfg.Token, Client: cfg.Client}, nil
+	default:
+		return nil, fmt.Errorf("unknown analytics sink %q", kind)
+	}
+}
@@ -0,0 +1,133 @@
+package analytics
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// SinkConfig holds the settings of every sink; each uses the ones it needs.
+type SinkConfig struct {
+	URL     string
+	Table   string
+	User    string
+	Token   func() string // ClickHouse password or BigQuery access token
+	Project string
+	Dataset string
+	Client  *http.Client
+}
+
+// ClickHouse inserts rows through the HTTP interface as JSONEachRow. The
+// table's columns must match the JSON names of Row, or of the transform's
+// output.
+type ClickHouse struct {
+	URL      string
+	Table    string
+	User     string
+	Password func() string
+	Client   *http.Client
+}
+
+func (c *ClickHouse) Insert(ctx context.Context, rows []Record) error {
+	var body bytes.Buffer
+	for _, row := range rows {
+		body.Write(row.Data)
+		body.WriteByte('\n')
+	}
+
+	q := url.Values{}
+	q.Set("query", "INSERT INTO "+c.Table+" FORMAT JSONEachRow")
+	q.Set("date_time_input_format", "best_effort")
+	// Lets a replicated table drop a retried batch it already stored.
+	q.Set("insert_deduplication_token", fmt.Sprintf("%d-%d", rows[0].Seq, rows[len(rows)-1].Seq))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(c.URL, "/")+"/?"+q.Encode(), &body)
+	if err != nil {
+		return err
+	}
+	if c.User != "" {
+		req.Header.Set("X-ClickHouse-User", c.User)
+	}
+	if c.Password != nil {
+		req.Header.Set("X-ClickHouse-Key", c.Password())
+	}
+	return do(c.Client, req, nil)
+}
+
+const bigQueryURL = "https://bigquery.googleapis.com"
+
+// BigQuery streams rows with tabledata.insertAll. Row seqs are sent as
+// insert IDs so BigQuery drops retried rows on a best-effort basis.
+type BigQuery struct {
+	BaseURL string // defaults to the public API
+	Project string
+	Dataset string
+	Table   string
+	Token   func() string // OAuth access token
+	Client  *http.Client
+}
+
+func (b *BigQuery) Insert(ctx context.Context, rows []Record) error {
+	type insertRow struct {
+		InsertID string          `json:"insertId"`
+		JSON     json.RawMessage `json:"json"`
+	}
+	payload := struct {
+		Rows []insertRow `json:"rows"`
+	}{Rows: make([]insertRow, len(rows))}
+	for i, row := range rows {
+		payload.Rows[i] = insertRow{InsertID: row.OrderID + ":" + strconv.FormatUint(row.Seq, 10), JSON: row.Data}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	base := b.BaseURL
+	if base == "" {
+		base = bigQueryURL
+	}
+	endpoint := fmt.Sprintf("%s/bigquery/v2/projects/%s/datasets/%s/tables/%s/insertAll",
+		strings.TrimRight(base, "/"), url.PathEscape(b.Project), url.PathEscape(b.Dataset), url.PathEscape(b.Table))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if b.Token != nil {
+		req.Header.Set("Authorization", "Bearer "+b.Token())
+	}
+
+	var resp struct {
+		InsertErrors []json.RawMessage `json:"insertErrors"`
+	}
+	if err := do(b.Client, req, &resp); err != nil {
+		return err
+	}
+	if len(resp.InsertErrors) > 0 {
+		return fmt.Errorf("bigquery rejected %d rows: %s", len(resp.InsertErrors), resp.InsertErrors[0])
+	}
+	return nil
+}
+
+// do sends req and decodes a JSON response into out when out is not nil.
+func do(client *http.Client, req *http.Request, out any) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
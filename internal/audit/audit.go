@@ -0,0 +1,86 @@
+// Package audit records operator actions such as queue changes. Entries
+// are appended to a JSON-lines file when one is configured and the most
+// recent ones are kept in memory for listing.
+package audit
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+const keepRecent = 1000
+
+// Entry is one audited action.
+type Entry struct {
+	At     time.Time `json:"at"`
+	Actor  string    `json:"actor"`
+	Action string    `json:"action"`
+	Target string    `json:"target"`
+	Detail string    `json:"detail,omitempty"`
+}
+
+type Log struct {
+	mu     sync.Mutex
+	file   *os.File
+	recent []Entry
+}
+
+// Open appends to the file at path; an empty path keeps entries in memory
+// only.
+func Open(path string) (*Log, error) {
+	l := &Log{}
+	if path == "" {
+		return l, nil
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	l.file = f
+	return l, nil
+}
+
+func (l *Log) Record(actor, action, target, detail string) {
+	e := Entry{At: time.Now(), Actor: actor, Action: action, Target: target, Detail: detail}
+	log.Printf("audit: %s %s %s %s", actor, action, target, detail)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.recent = append(l.recent, e)
+	if len(l.recent) > keepRecent {
+		l.recent = slices.Delete(l.recent, 0, len(l.recent)-keepRecent)
+	}
+	if l.file == nil {
+		return
+	}
+	data, err := json.Marshal(e)
+	if err == nil {
+		_, err = l.file.Write(append(data, '\n'))
+	}
+	if err != nil {
+		log.Printf("audit: write: %v", err)
+	}
+}
+
+// Recent returns up to n entries, newest first.
+func (l *Log) Recent(n int) []Entry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n = min(n, len(l.recent))
+	entries := make([]Entry, n)
+	for i := range entries {
+		entries[i] = l.recent[len(l.recent)-1-i]
+	}
+	return entries
+}
+
+func (l *Log) Close() error {
+	if l.file == nil {
+		return nil
+	}
+	return l.file.Close()
+}
@@ -0,0 +1,292 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Scopes understood by the API.
+const (
+	ScopeOrdersWrite = "orders:write"
+	ScopeOrdersRead  = "orders:read"
+	ScopeAdmin       = "admin"
+)
+
+var validScopes = map[string]bool{
+	ScopeOrdersWrite: true,
+	ScopeOrdersRead:  true,
+	ScopeAdmin:       true,
+}
+
+const keyPrefix = "rtop_"
+
+var (
+	ErrKeyNotFound  = errors.New("api key not found")
+	ErrKeyRevoked   = errors.New("api key revoked")
+	ErrKeyExpired   = errors.New("api key expired")
+	ErrInvalidScope = errors.New("invalid scope")
+)
+
+// APIKey describes an integration credential. The raw key is only returned
+// once, at creation or rotation; the store keeps its SHA-256 hash.
+type APIKey struct {
+	ID        string     `json:"id"`
+	Tenant    string     `json:"tenant"`
+	Name      string     `json:"name"`
+	Prefix    string     `json:"prefix"`
+	Scopes    []string   `json:"scopes"`
+	CreatedAt time.Time  `json:"created_at"`
+	RotatedAt *time.Time `json:"rotated_at,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// HasScope reports whether the key grants scope. The admin scope grants all.
+func (k *APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+type storedKey struct {
+	APIKey
+	Hash string `json:"hash"`
+}
+
+// KeyStore keeps hashed API keys in memory and optionally mirrors them to a
+// JSON file so they survive restarts.
+type KeyStore struct {
+	mu     sync.RWMutex
+	keys   map[string]*storedKey // by ID
+	byHash map[string]string     // hash -> ID
+	file   string
+}
+
+// NewKeyStore loads keys from file if it exists. An empty file path keeps
+// keys in memory only.
+func NewKeyStore(file string) (*KeyStore, error) {
+	s := &KeyStore{
+		keys:   make(map[string]*storedKey),
+		byHash: make(map[string]string),
+		file:   file,
+	}
+	if file == "" {
+		return s, nil
+	}
+
+	data, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read api keys: %w", err)
+	}
+
+	var stored []*storedKey
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, fmt.Errorf("parse api keys: %w", err)
+	}
+	for _, k := range stored {
+		s.keys[k.ID] = k
+		s.byHash[k.Hash] = k.ID
+	}
+	return s, nil
+}
+
+// Create issues a new key and returns its raw value alongside the record.
+func (s *KeyStore) Create(tenant, name string, scopes []string, ttl time.Duration) (string, APIKey, error) {
+	for _, scope := range scopes {
+		if !validScopes[scope] {
+			return "", APIKey{}, fmt.Errorf("%w: %q", ErrInvalidScope, scope)
+		}
+	}
+
+	raw, hash := generateKey()
+	now := time.Now()
+	k := &storedKey{
+		APIKey: APIKey{
+			ID:        randomHex(8),
+			Tenant:    tenant,
+			Name:      name,
+			Prefix:    raw[:len(keyPrefix)+6],
+			Scopes:    scopes,
+			CreatedAt: now,
+		},
+		Hash: hash,
+	}
+	if ttl > 0 {
+		expires := now.Add(ttl)
+		k.ExpiresAt = &expires
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[k.ID] = k
+	s.byHash[hash] = k.ID
+	if err := s.saveLocked(); err != nil {
+		return "", APIKey{}, err
+	}
+	return raw, k.APIKey, nil
+}
+
+// Rotate replaces the secret of an existing key. The old value stops
+// working immediately.
+func (s *KeyStore) Rotate(id string) (string, APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k, ok := s.keys[id]
+	if !ok {
+		return "", APIKey{}, ErrKeyNotFound
+	}
+	if k.RevokedAt != nil {
+		return "", APIKey{}, ErrKeyRevoked
+	}
+
+	raw, hash := generateKey()
+	now := time.Now()
+	delete(s.byHash, k.Hash)
+	k.Hash = hash
+	k.Prefix = raw[:len(keyPrefix)+6]
+	k.RotatedAt = &now
+	s.byHash[hash] = id
+	if err := s.saveLocked(); err != nil {
+		return "", APIKey{}, err
+	}
+	return raw, k.APIKey, nil
+}
+
+// Revoke disables a key permanently.
+func (s *KeyStore) Revoke(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k, ok := s.keys[id]
+	if !ok {
+		return ErrKeyNotFound
+	}
+	if k.RevokedAt == nil {
+		now := time.Now()
+		k.RevokedAt = &now
+	}
+	return s.saveLocked()
+}
+
+// Get returns a key by ID.
+func (s *KeyStore) Get(id string) (APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	k, ok := s.keys[id]
+	if !ok {
+		return APIKey{}, ErrKeyNotFound
+	}
+	return k.APIKey, nil
+}
+
+// List returns the keys of a tenant, or all keys when tenant is empty.
+func (s *KeyStore) List(tenant string) []APIKey {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keys := make([]APIKey, 0, len(s.keys))
+	for _, k := range s.keys {
+		if tenant == "" || k.Tenant == tenant {
+			keys = append(keys, k.APIKey)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].CreatedAt.Before(keys[j].CreatedAt) })
+	return keys
+}
+
+// Authenticate resolves a raw key to its record if it is still valid.
+func (s *KeyStore) Authenticate(raw string) (APIKey, error) {
+	hash := hashKey(raw)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	id, ok := s.byHash[hash]
+	if !ok {
+		return APIKey{}, ErrKeyNotFound
+	}
+	k := s.keys[id]
+	if k.RevokedAt != nil {
+		return APIKey{}, ErrKeyRevoked
+	}
+	if k.ExpiresAt != nil && time.Now().After(*k.ExpiresAt) {
+		return APIKey{}, ErrKeyExpired
+	}
+	return k.APIKey, nil
+}
+
+func (s *KeyStore) saveLocked() error {
+	if s.file == "" {
+		return nil
+	}
+
+	stored := make([]*storedKey, 0, len(s.keys))
+	for _, k := range s.keys {
+		stored = append(stored, k)
+	}
+	data, err := json.MarshalIndent(stored, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.file), ".apikeys-*")
+	if err != nil {
+		return fmt.Errorf("save api keys: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("save api keys: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("save api keys: %w", err)
+	}
+	return os.Rename(tmp.Name(), s.file)
+}
+
+func generateKey() (raw, hash string) {
+	raw = keyPrefix + randomHex(24)
+	return raw, hashKey(raw)
+}
+
+func hashKey(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+type contextKey struct{}
+
+// WithKey stores the authenticated key on the context.
+func WithKey(ctx context.Context, key APIKey) context.Context {
+	return context.WithValue(ctx, contextKey{}, key)
+}
+
+// FromContext returns the authenticated key, if any.
+func FromContext(ctx context.Context) (APIKey, bool) {
+	key, ok := ctx.Value(contextKey{}).(APIKey)
+	return key, ok
+}
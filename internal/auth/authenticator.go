@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+var ErrMissingKey = errors.New("missing api key")
+
+// Authenticator resolves the API key presented on a request, either as
+// "Authorization: Bearer <key>" or "X-API-Key: <key>". A request over a
+// connection verified with a client certificate authenticates as the
+// certificate's identity instead.
+type Authenticator struct {
+	Keys *KeyStore
+
+	// Certs maps client certificates to identities; nil maps none.
+	Certs ClientCerts
+
+	// AdminKey returns a bootstrap credential with the admin scope across
+	// all tenants, used to create the first keys. It is called per request
+	// so a rotated secret takes effect immediately.
+	AdminKey func() string
+}
+
+func (a *Authenticator) FromRequest(r *http.Request) (APIKey, error) {
+	if key, ok, err := a.Certs.identify(r.TLS); ok {
+		return key, err
+	}
+
+	raw := r.Header.Get("X-API-Key")
+	if raw == "" {
+		raw = strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	}
+	if raw == "" {
+		return APIKey{}, ErrMissingKey
+	}
+
+	if admin := a.adminKey(); admin != "" && subtle.ConstantTimeCompare([]byte(raw), []byte(admin)) == 1 {
+		return APIKey{ID: "bootstrap", Name: "bootstrap admin", Scopes: []string{ScopeAdmin}}, nil
+	}
+	return a.Keys.Authenticate(raw)
+}
+
+func (a *Authenticator) adminKey() string {
+	if a.AdminKey == nil {
+		return ""
+	}
+	return a.AdminKey()
+}
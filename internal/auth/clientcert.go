@@ -0,0 +1,53 @@
+package auth
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+)
+
+var ErrUnknownCertificate = errors.New("client certificate is not mapped to a tenant")
+
+// ClientCerts maps the subjects of verified client certificates, in RFC
+// 2253 form such as "CN=acme-orders,O=Acme Corp", to the identity they
+// authenticate as. A B2B integration connecting over mutual TLS then
+// needs no API key, and gets the same tenant and scopes checks as one.
+type ClientCerts map[string]APIKey
+
+// Add maps subject to an identity of tenant named name with scopes.
+func (c ClientCerts) Add(subject, tenant, name string, scopes []string) error {
+	if subject == "" {
+		return errors.New("client certificate subject is required")
+	}
+	if _, ok := c[subject]; ok {
+		return fmt.Errorf("client certificate %q is mapped twice", subject)
+	}
+	if len(scopes) == 0 {
+		return fmt.Errorf("client certificate %q: %w", subject, ErrInvalidScope)
+	}
+	for _, s := range scopes {
+		if !validScopes[s] {
+			return fmt.Errorf("client certificate %q: %w: %s", subject, ErrInvalidScope, s)
+		}
+	}
+	if name == "" {
+		name = subject
+	}
+	c[subject] = APIKey{ID: "cert:" + subject, Tenant: tenant, Name: name, Scopes: scopes}
+	return nil
+}
+
+// identify returns the identity of the client certificate the connection
+// was verified with. ok is false when there is none; a certificate that
+// isn't mapped returns ErrUnknownCertificate.
+func (c ClientCerts) identify(state *tls.ConnectionState) (key APIKey, ok bool, err error) {
+	if state == nil || len(state.VerifiedChains) == 0 {
+		return APIKey{}, false, nil
+	}
+	subject := state.VerifiedChains[0][0].Subject.String()
+	key, ok = c[subject]
+	if !ok {
+		return APIKey{}, true, fmt.Errorf("%w: %s", ErrUnknownCertificate, subject)
+	}
+	return key, true, nil
+}
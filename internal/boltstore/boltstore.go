@@ -0,0 +1,212 @@
+// Package boltstore keeps durable state in a single embedded bbolt
+// database file, so a single-binary deployment persists its result log,
+// stored artifacts and order records without a database server. It
+// implements blobstore.Store, eventbus.Storage and orderstore.Repository
+// on top of one file.
+package boltstore
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/blobstore"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/eventbus"
+)
+
+var (
+	blobsBucket   = []byte("blobs")
+	eventsBucket  = []byte("events")
+	cursorsBucket = []byte("cursors")
+)
+
+type DB struct {
+	db *bolt.DB
+}
+
+// Open opens or creates the database at path. It fails after a second if
+// another process has it open.
+func Open(path string) (*DB, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{blobsBucket, eventsBucket, cursorsBucket, ordersBucket, orderSeqBucket, metaBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &DB{db: db}, nil
+}
+
+func (d *DB) Close() error {
+	return d.db.Close()
+}
+
+// Blobs returns the blob store kept in the database.
+func (d *DB) Blobs() *Blobs {
+	return &Blobs{db: d.db}
+}
+
+// Events returns storage for an event bus. Closing it leaves the database
+// open.
+func (d *DB) Events() *Events {
+	return &Events{db: d.db}
+}
+
+// Blobs is a blobstore.Store.
+type Blobs struct {
+	db *bolt.DB
+}
+
+var _ blobstore.Store = (*Blobs)(nil)
+
+func (b *Blobs) Put(key string, data []byte) error {
+	if key == "" {
+		return errors.New("empty blob key")
+	}
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(blobsBucket).Put([]byte(key), data)
+	})
+}
+
+func (b *Blobs) Get(key string) ([]byte, error) {
+	var data []byte
+	err := b.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(blobsBucket).Get([]byte(key))
+		if v == nil {
+			return blobstore.ErrNotFound
+		}
+		data = bytes.Clone(v) // v is only valid during the transaction
+		return nil
+	})
+	return data, err
+}
+
+func (b *Blobs) List(prefix string) ([]string, error) {
+	var keys []string
+	err := b.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(blobsBucket).Cursor()
+		for k, _ := c.Seek([]byte(prefix)); k != nil && bytes.HasPrefix(k, []byte(prefix)); k, _ = c.Next() {
+			keys = append(keys, string(k))
+		}
+		return nil
+	})
+	return keys, err
+}
+
+func (b *Blobs) Delete(key string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(blobsBucket).Delete([]byte(key))
+	})
+}
+
+// Events is an eventbus.Storage. Events are keyed by their big endian
+// sequence number, so they are read back in order.
+type Events struct {
+	db *bolt.DB
+}
+
+var _ eventbus.Storage = (*Events)(nil)
+
+func (e *Events) Load() ([]eventbus.Event, map[string]uint64, error) {
+	var events []eventbus.Event
+	cursors := make(map[string]uint64)
+	err := e.db.View(func(tx *bolt.Tx) error {
+		err := tx.Bucket(eventsBucket).ForEach(func(_, v []byte) error {
+			var ev eventbus.Event
+			if err := json.Unmarshal(v, &ev); err != nil {
+				return err
+			}
+			events = append(events, ev)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(cursorsBucket).ForEach(func(k, v []byte) error {
+			cursors[string(k)] = binary.BigEndian.Uint64(v)
+			return nil
+		})
+	})
+	return events, cursors, err
+}
+
+func (e *Events) Append(ev eventbus.Event) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	return e.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(eventsBucket).Put(seqKey(ev.Seq), data)
+	})
+}
+
+// Rewrite deletes the stored events that aren't in events and stores
+// those that are missing.
+func (e *Events) Rewrite(events []eventbus.Event) error {
+	keep := make(map[uint64]bool, len(events))
+	for _, ev := range events {
+		keep[ev.Seq] = true
+	}
+	return e.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(eventsBucket)
+		c := bucket.Cursor()
+		for k, _ := c.First(); k != nil; {
+			if keep[binary.BigEndian.Uint64(k)] {
+				k, _ = c.Next()
+				continue
+			}
+			if err := c.Delete(); err != nil {
+				return err
+			}
+			// Delete moves the cursor; Seek finds the next key.
+			k, _ = c.Seek(k)
+		}
+		for _, ev := range events {
+			if bucket.Get(seqKey(ev.Seq)) != nil {
+				continue
+			}
+			data, err := json.Marshal(ev)
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put(seqKey(ev.Seq), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (e *Events) SaveCursors(cursors map[string]uint64) error {
+	return e.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(cursorsBucket)
+		for name, seq := range cursors {
+			if err := bucket.Put([]byte(name), seqKey(seq)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Close does nothing; the database is closed with DB.Close.
+func (e *Events) Close() error {
+	return nil
+}
+
+func seqKey(seq uint64) []byte {
+	return binary.BigEndian.AppendUint64(nil, seq)
+}
@@ -0,0 +1,242 @@
+package boltstore
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"log"
+	"slices"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/orderstore"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/pkg/models"
+)
+
+var (
+	ordersBucket   = []byte("orders")    // order ID to record
+	orderSeqBucket = []byte("order_seq") // insertion sequence to order ID
+	metaBucket     = []byte("meta")
+
+	orderCountKey = []byte("order_count")
+)
+
+// Orders is an orderstore.Repository. Records are indexed by insertion,
+// so they are listed newest first and the oldest are dropped beyond max.
+// Writes of concurrent orders are committed together.
+type Orders struct {
+	db  *bolt.DB
+	max int
+}
+
+var _ orderstore.Repository = (*Orders)(nil)
+
+// storedRecord is a record with its position in the insertion index.
+type storedRecord struct {
+	Seq uint64 `json:"seq"`
+	orderstore.Record
+}
+
+// Orders returns the order records kept in the database, at most max.
+func (d *DB) Orders(max int) *Orders {
+	return &Orders{db: d.db, max: max}
+}
+
+func (s *Orders) Put(o models.Order, state orderstore.State) error {
+	return s.db.Batch(func(tx *bolt.Tx) error {
+		if tx.Bucket(ordersBucket).Get([]byte(o.ID)) != nil {
+			return orderstore.ErrExists
+		}
+		return s.put(tx, o.ID, func(rec *orderstore.Record) {
+			rec.Order, rec.State = o, state
+		})
+	})
+}
+
+// put inserts or changes the record of id with fn.
+func (s *Orders) put(tx *bolt.Tx, id string, fn func(*orderstore.Record)) error {
+	orders := tx.Bucket(ordersBucket)
+	var stored storedRecord
+	if v := orders.Get([]byte(id)); v != nil {
+		if err := json.Unmarshal(v, &stored); err != nil {
+			return err
+		}
+	} else if err := s.insert(tx, id, &stored); err != nil {
+		return err
+	}
+	fn(&stored.Record)
+	stored.UpdatedAt = time.Now()
+	data, err := json.Marshal(stored)
+	if err != nil {
+		return err
+	}
+	return orders.Put([]byte(id), data)
+}
+
+// insert indexes a new record and drops the oldest beyond max.
+func (s *Orders) insert(tx *bolt.Tx, id string, stored *storedRecord) error {
+	index := tx.Bucket(orderSeqBucket)
+	seq, err := index.NextSequence()
+	if err != nil {
+		return err
+	}
+	stored.Seq = seq
+	if err := index.Put(seqKey(seq), []byte(id)); err != nil {
+		return err
+	}
+	count := orderCount(tx) + 1
+	for ; count > s.max; count-- {
+		k, oldest := index.Cursor().First()
+		if err := tx.Bucket(ordersBucket).Delete(oldest); err != nil {
+			return err
+		}
+		if err := index.Delete(k); err != nil {
+			return err
+		}
+	}
+	return setOrderCount(tx, count)
+}
+
+func (s *Orders) SetState(id string, state orderstore.State) {
+	s.Update(id, func(rec *orderstore.Record) { rec.State = state })
+}
+
+func (s *Orders) Update(id string, fn func(*orderstore.Record)) {
+	err := s.db.Batch(func(tx *bolt.Tx) error {
+		if tx.Bucket(ordersBucket).Get([]byte(id)) == nil {
+			return nil
+		}
+		return s.put(tx, id, fn)
+	})
+	if err != nil {
+		log.Printf("orders: updating %s: %v", id, err)
+	}
+}
+
+func (s *Orders) Finish(result models.ProcessedOrder) {
+	state := orderstore.Processed
+	if !result.Success {
+		state = orderstore.Failed
+	}
+	err := s.db.Batch(func(tx *bolt.Tx) error {
+		return s.put(tx, result.Order.ID, func(rec *orderstore.Record) {
+			rec.Order, rec.State, rec.Result = result.Order, state, &result
+		})
+	})
+	if err != nil {
+		log.Printf("orders: finishing %s: %v", result.Order.ID, err)
+	}
+}
+
+func (s *Orders) Forget(id string) {
+	err := s.db.Batch(func(tx *bolt.Tx) error {
+		orders := tx.Bucket(ordersBucket)
+		v := orders.Get([]byte(id))
+		if v == nil {
+			return nil
+		}
+		var stored storedRecord
+		if err := json.Unmarshal(v, &stored); err != nil {
+			return err
+		}
+		if err := tx.Bucket(orderSeqBucket).Delete(seqKey(stored.Seq)); err != nil {
+			return err
+		}
+		if err := orders.Delete([]byte(id)); err != nil {
+			return err
+		}
+		return setOrderCount(tx, orderCount(tx)-1)
+	})
+	if err != nil {
+		log.Printf("orders: forgetting %s: %v", id, err)
+	}
+}
+
+func (s *Orders) Prune(tenant string, before time.Time) (int, error) {
+	n := 0
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		orders, index := tx.Bucket(ordersBucket), tx.Bucket(orderSeqBucket)
+		var expired []storedRecord
+		c := index.Cursor()
+		for _, id := c.First(); id != nil; _, id = c.Next() {
+			var stored storedRecord
+			if err := json.Unmarshal(orders.Get(id), &stored); err != nil {
+				return err
+			}
+			if stored.Order.Tenant == tenant && stored.UpdatedAt.Before(before) && !slices.Contains(orderstore.Unfinished, stored.State) {
+				expired = append(expired, stored)
+			}
+		}
+		for _, stored := range expired {
+			if err := index.Delete(seqKey(stored.Seq)); err != nil {
+				return err
+			}
+			if err := orders.Delete([]byte(stored.Order.ID)); err != nil {
+				return err
+			}
+		}
+		n = len(expired)
+		return setOrderCount(tx, orderCount(tx)-n)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+func (s *Orders) Get(id string) (orderstore.Record, bool) {
+	var stored storedRecord
+	found := false
+	err := s.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(ordersBucket).Get([]byte(id))
+		if v == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(v, &stored)
+	})
+	if err != nil {
+		log.Printf("orders: reading %s: %v", id, err)
+		return orderstore.Record{}, false
+	}
+	return stored.Record, found
+}
+
+func (s *Orders) List(q orderstore.Query) ([]orderstore.Record, int) {
+	page := []orderstore.Record{}
+	total := 0
+	err := s.db.View(func(tx *bolt.Tx) error {
+		orders := tx.Bucket(ordersBucket)
+		c := tx.Bucket(orderSeqBucket).Cursor()
+		for _, id := c.Last(); id != nil; _, id = c.Prev() {
+			var stored storedRecord
+			if err := json.Unmarshal(orders.Get(id), &stored); err != nil {
+				return err
+			}
+			if !q.Matches(&stored.Record) {
+				continue
+			}
+			if total >= q.Offset && (q.Limit == 0 || len(page) < q.Limit) {
+				page = append(page, stored.Record)
+			}
+			total++
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("orders: listing: %v", err)
+	}
+	return page, total
+}
+
+func orderCount(tx *bolt.Tx) int {
+	v := tx.Bucket(metaBucket).Get(orderCountKey)
+	if v == nil {
+		return 0
+	}
+	return int(binary.BigEndian.Uint64(v))
+}
+
+func setOrderCount(tx *bolt.Tx, n int) error {
+	return tx.Bucket(metaBucket).Put(orderCountKey, seqKey(uint64(n)))
+}
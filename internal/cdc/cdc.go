@@ -0,0 +1,109 @@
+// Package cdc renders order results as change events in the Debezium JSON
+// envelope (as produced by the JsonConverter with schemas disabled), so
+// existing CDC consumers can treat this service like a database table.
+package cdc
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/pkg/models"
+)
+
+const (
+	Connector = "order-processor"
+	Version   = "1.0"
+
+	OpUpdate = "u" // Debezium operation code
+)
+
+// Row is the "orders" table row carried in before and after.
+type Row struct {
+	ID          string            `json:"id"`
+	Customer    string            `json:"customer"`
+	Tenant      string            `json:"tenant,omitempty"`
+	Status      string            `json:"status"`
+	Amount      string            `json:"amount"` // decimal, as Debezium's string decimal handling
+	Items       []string          `json:"items"`
+	Address     string            `json:"address"`
+	Priority    int               `json:"priority"`
+	Tags        map[string]string `json:"tags,omitempty"`
+	CreatedAt   int64             `json:"created_at"` // epoch ms
+	ProcessedAt *int64            `json:"processed_at"`
+	ResultCode  *string           `json:"result_code"`
+	ErrorCode   *string           `json:"error_code"`
+}
+
+// Source describes where the change came from.
+type Source struct {
+	Version   string `json:"version"`
+	Connector string `json:"connector"`
+	Name      string `json:"name"` // logical server name, the node ID
+	TsMs      int64  `json:"ts_ms"`
+	Snapshot  string `json:"snapshot"`
+	DB        string `json:"db"`
+	Table     string `json:"table"`
+	Sequence  string `json:"sequence,omitempty"` // event log position, if any
+}
+
+// Envelope is one change event.
+type Envelope struct {
+	Before *Row   `json:"before"`
+	After  *Row   `json:"after"`
+	Source Source `json:"source"`
+	Op     string `json:"op"`
+	TsMs   int64  `json:"ts_ms"`
+}
+
+// FromResult describes processing as an update of the order row: before is
+// the order as accepted, after adds its outcome. seq is the event log
+// position, or 0 for results that aren't logged.
+func FromResult(node string, seq uint64, at time.Time, result models.ProcessedOrder) Envelope {
+	before := row(result.Order)
+	if result.PreviousStatus != "" {
+		before.Status = string(result.PreviousStatus)
+	}
+
+	after := row(result.Order)
+	processedAt := result.ProcessedAt.UnixMilli()
+	after.ProcessedAt = &processedAt
+	after.ResultCode = &result.ResultCode
+	if !result.Success {
+		after.ErrorCode = &result.ErrorCode
+	}
+
+	source := Source{
+		Version:   Version,
+		Connector: Connector,
+		Name:      node,
+		TsMs:      at.UnixMilli(),
+		Snapshot:  "false",
+		DB:        "orders",
+		Table:     "orders",
+	}
+	if seq > 0 {
+		source.Sequence = strconv.FormatUint(seq, 10)
+	}
+	return Envelope{
+		Before: &before,
+		After:  &after,
+		Source: source,
+		Op:     OpUpdate,
+		TsMs:   time.Now().UnixMilli(),
+	}
+}
+
+func row(o models.Order) Row {
+	return Row{
+		ID:        o.ID,
+		Customer:  o.Customer,
+		Tenant:    o.Tenant,
+		Status:    string(o.Status),
+		Amount:    o.Amount.String(),
+		Items:     o.Items,
+		Address:   o.Address,
+		Priority:  int(o.Priority),
+		Tags:      o.Tags,
+		CreatedAt: o.CreatedAt.UnixMilli(),
+	}
+}
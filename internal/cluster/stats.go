@@ -0,0 +1,92 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/pkg/models"
+)
+
+// Aggregator pulls /stats from every configured peer and merges them with
+// the local node's view.
+type Aggregator struct {
+	nodeID string
+	peers  []string
+	client *http.Client
+}
+
+// NewAggregator uses client, which should carry the peer timeout, to reach
+// the peers.
+func NewAggregator(nodeID string, peers []string, client *http.Client) *Aggregator {
+	return &Aggregator{
+		nodeID: nodeID,
+		peers:  peers,
+		client: client,
+	}
+}
+
+// Enabled reports whether any peers are configured.
+func (a *Aggregator) Enabled() bool {
+	return a != nil && len(a.peers) > 0
+}
+
+// Collect fetches stats from all peers concurrently. Peers that fail are
+// reported in the node list but left out of the totals.
+func (a *Aggregator) Collect(ctx context.Context, local models.ProcessingStats) models.ClusterStats {
+	nodes := make([]models.NodeStats, len(a.peers)+1)
+	nodes[0] = models.NodeStats{Node: a.nodeID, Stats: &local}
+
+	var wg sync.WaitGroup
+	for i, peer := range a.peers {
+		wg.Add(1)
+		go func(i int, peer string) {
+			defer wg.Done()
+			stats, err := a.fetch(ctx, peer)
+			node := models.NodeStats{Node: peer, Stats: stats}
+			if err != nil {
+				node.Error = err.Error()
+			}
+			nodes[i+1] = node
+		}(i, peer)
+	}
+	wg.Wait()
+
+	result := models.ClusterStats{Nodes: nodes}
+	for _, n := range nodes {
+		if n.Stats == nil {
+			continue
+		}
+		result.Total = result.Total.Merge(*n.Stats)
+		result.Reachable++
+	}
+	return result
+}
+
+func (a *Aggregator) fetch(ctx context.Context, peer string) (*models.ProcessingStats, error) {
+	// Always ask peers for their local view so requests don't fan out recursively.
+	url := strings.TrimRight(peer, "/") + "/stats?scope=local"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("peer returned status %d", resp.StatusCode)
+	}
+
+	var stats models.ProcessingStats
+	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+		return nil, fmt.Errorf("decode peer stats: %w", err)
+	}
+	return &stats, nil
+}
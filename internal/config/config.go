@@ -0,0 +1,1450 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/pkg/models"
+)
+
+// Config holds the service settings loaded at startup.
+type Config struct {
+	Addr       string      `json:"addr"`        // host:port, or unix:/path/to.sock
+	SocketMode string      `json:"socket_mode"` // octal permission of a Unix socket
+	TLS        TLSConfig   `json:"tls"`
+	HTTP3      HTTP3Config `json:"http3"`
+	Workers    int         `json:"workers"`
+	Buffer     int         `json:"buffer"`
+
+	// ShutdownTimeout bounds how long a SIGINT or SIGTERM waits for the
+	// queued orders to be processed before abandoning them.
+	ShutdownTimeout Duration `json:"shutdown_timeout"`
+
+	// Retry tries orders that failed with a retryable error again, in
+	// every pipeline that doesn't set its own retry.
+	Retry RetryConfig `json:"retry"`
+
+	// Admission decides which orders are queued, in every pipeline that
+	// doesn't set its own admission.
+	Admission AdmissionConfig `json:"admission"`
+
+	// ProcessingTimeout bounds how long one order may take to process, in
+	// every pipeline that doesn't set its own. Zero sets none.
+	ProcessingTimeout Duration `json:"processing_timeout"`
+
+	// Autoscale resizes the default pipeline's workers with its queue.
+	// Named pipelines set their own.
+	Autoscale *AutoscaleConfig `json:"autoscale"`
+
+	// QueueSnapshot, if set, is a file where the orders still queued at the
+	// end of shutdown_timeout are saved, to be queued again at the next
+	// start before intake opens.
+	QueueSnapshot string `json:"queue_snapshot"`
+
+	// QuiescePeriod is how long /readyz fails before draining starts, so
+	// load balancers stop routing to the instance first.
+	QuiescePeriod Duration `json:"quiesce_period"`
+
+	Cluster  ClusterConfig  `json:"cluster"`
+	Outbound OutboundConfig `json:"outbound"`
+	Auth     AuthConfig     `json:"auth"`
+	Secrets  SecretsConfig  `json:"secrets"`
+	Firewall FirewallConfig `json:"firewall"`
+	Signing  SigningConfig  `json:"signing"`
+	SLO      SLOConfig      `json:"slo"`
+	Tags     TagsConfig     `json:"tags"`
+
+	// Forensics captures profiles when latency or failures spike.
+	Forensics ForensicsConfig `json:"forensics"`
+
+	// Tracing exports OpenTelemetry spans of submissions and processing.
+	Tracing TracingConfig `json:"tracing"`
+
+	// Pipelines replaces the single default pipeline built from Workers and
+	// Buffer. Orders are sent by the first matching route, or to the first
+	// pipeline.
+	Pipelines []PipelineConfig `json:"pipelines"`
+	Routes    []RouteConfig    `json:"routes"`
+
+	// Heavy adds a "heavy" pipeline for large orders so they don't hold up
+	// small ones. Disabled when Workers is 0.
+	Heavy HeavyConfig `json:"heavy"`
+
+	Payment PaymentConfig `json:"payment"`
+
+	// Shipping holds the delivery rules used to check requested delivery
+	// windows and by the "shipping" pipeline step.
+	Shipping ShippingConfig `json:"shipping"`
+
+	Memory MemoryConfig `json:"memory"`
+
+	// Idempotency deduplicates retried order submissions.
+	Idempotency IdempotencyConfig `json:"idempotency"`
+
+	Streams StreamsConfig `json:"streams"`
+
+	// Metrics guards the label cardinality of GET /metrics.
+	Metrics MetricsConfig `json:"metrics"`
+
+	// Dev generates synthetic traffic so dashboards show live data.
+	Dev DevConfig `json:"dev"`
+
+	// Kafka reads orders from a topic too when ProxyURL is set.
+	Kafka KafkaConfig `json:"kafka"`
+
+	// ErrorDocsURL prefixes error codes to form the type URI of problem
+	// responses; empty uses the server's own GET /errors/{code}.
+	ErrorDocsURL string `json:"error_docs_url"`
+
+	// AuditFile appends operator actions as JSON lines; empty keeps
+	// them in memory only.
+	AuditFile string `json:"audit_file"`
+
+	// RecordTraffic records sanitized requests for replay in staging.
+	RecordTraffic RecordTrafficConfig `json:"record_traffic"`
+
+	// Payloads keeps the raw body of accepted orders for audit.
+	Payloads PayloadsConfig `json:"payloads"`
+
+	// CustomersFile saves customer profiles; empty keeps them in memory
+	// only.
+	CustomersFile string `json:"customers_file"`
+
+	// QuarantineFile saves the quarantine rules operators set; empty
+	// keeps them in memory only.
+	QuarantineFile string `json:"quarantine_file"`
+
+	// Tenants sets how long each tenant's results are kept and which
+	// order fields they show.
+	Tenants TenantsConfig `json:"tenants"`
+
+	// Views lists the fields shown to keys without the admin scope.
+	Views ViewsConfig `json:"views"`
+
+	// Jobs runs background operator jobs such as bulk actions.
+	Jobs JobsConfig `json:"jobs"`
+
+	// Reconcile compares order states with an external system of record.
+	Reconcile ReconcileConfig `json:"reconcile"`
+
+	// Events keeps a durable result log when Dir is set.
+	Events EventsConfig `json:"events"`
+
+	// Storage selects the backend of the event log and forensics captures.
+	Storage StorageConfig `json:"storage"`
+
+	// Queue selects where pipelines queue orders and results.
+	Queue QueueConfig `json:"queue"`
+
+	// Analytics exports the event log to an analytics store.
+	Analytics AnalyticsConfig `json:"analytics"`
+
+	// Webhooks deliver every result event to consumer URLs.
+	Webhooks []WebhookConfig `json:"webhooks"`
+
+	// WebhookRegistrations lets clients register webhooks through the API.
+	WebhookRegistrations WebhookRegistrationsConfig `json:"webhook_registrations"`
+
+	// Publishers publish every result event to a message broker.
+	Publishers []PublisherConfig `json:"publishers"`
+
+	// Callbacks lets clients name a callback_url per order.
+	Callbacks CallbacksConfig `json:"callbacks"`
+
+	// Spill keeps orders that don't fit in a pipeline's queue on disk.
+	Spill SpillConfig `json:"spill"`
+
+	// Journal logs accepted orders to disk so a crash doesn't lose them.
+	Journal JournalConfig `json:"journal"`
+
+	// Results decides what workers do with results when the results
+	// consumer falls behind.
+	Results ResultsConfig `json:"results"`
+
+	// Validators are run after built-in validation, in order.
+	Validators []ValidatorConfig `json:"validators"`
+
+	// Enrichment copies reference data into the tags of submitted
+	// orders, in order.
+	Enrichment []EnrichmentConfig `json:"enrichment"`
+
+	// Quality sets targets for the data quality of incoming orders.
+	Quality QualityConfig `json:"quality"`
+
+	// Transforms are named payload reshapings that consumers and sinks
+	// select by name.
+	Transforms map[string]TransformConfig `json:"transforms"`
+}
+
+// TLSConfig serves the API over HTTPS, and so HTTP/2, when both files
+// are set.
+type TLSConfig struct {
+	CertFile string `json:"cert_file"`
+	KeyFile  string `json:"key_file"`
+
+	// ClientCAFile is a PEM bundle of the CAs client certificates are
+	// verified against. Clients may then connect with a certificate
+	// instead of presenting an API key, unless RequireClientCert makes
+	// one mandatory.
+	ClientCAFile      string `json:"client_ca_file"`
+	RequireClientCert bool   `json:"require_client_cert"`
+	// ClientCerts maps certificate subjects to the tenant and scopes they
+	// authenticate as; a verified certificate that isn't listed is refused.
+	ClientCerts []ClientCertConfig `json:"client_certs"`
+}
+
+// ClientCertConfig identifies the clients presenting a certificate with
+// Subject, in RFC 2253 form such as "CN=acme-orders,O=Acme Corp".
+type ClientCertConfig struct {
+	Subject string   `json:"subject"`
+	Tenant  string   `json:"tenant"`
+	Name    string   `json:"name"`
+	Scopes  []string `json:"scopes"`
+}
+
+// HTTP3Config adds a QUIC listener on the UDP address Addr that serves the
+// same handlers with the TLS certificate. With AltSvc set, TCP responses
+// advertise it so clients can switch.
+type HTTP3Config struct {
+	Addr         string   `json:"addr"`
+	AltSvc       bool     `json:"alt_svc"`
+	AltSvcMaxAge Duration `json:"alt_svc_max_age"`
+}
+
+// OutboundConfig tunes the shared client used for calls to other services.
+type OutboundConfig struct {
+	Timeout          Duration `json:"timeout"` // per attempt
+	Retries          int      `json:"retries"`
+	Backoff          Duration `json:"backoff"`
+	FailureThreshold int      `json:"failure_threshold"`
+	OpenFor          Duration `json:"open_for"`
+	MaxIdlePerHost   int      `json:"max_idle_per_host"`
+}
+
+// ClusterConfig lists the peer instances whose stats can be aggregated.
+type ClusterConfig struct {
+	NodeID  string   `json:"node_id"`
+	Peers   []string `json:"peers"`   // base URLs, e.g. http://10.0.0.2:8080
+	Timeout Duration `json:"timeout"` // per-peer request timeout
+}
+
+// AuthConfig controls API key authentication.
+type AuthConfig struct {
+	Enabled  bool   `json:"enabled"`   // require an API key on order submission
+	AdminKey string `json:"admin_key"` // bootstrap key for /admin/apikeys; may be a "secret:" reference
+	KeysFile string `json:"keys_file"` // where hashed keys are persisted; empty keeps them in memory
+}
+
+// SecretsConfig selects where "secret:<name>" references in the config are
+// resolved from.
+type SecretsConfig struct {
+	Provider      string   `json:"provider"`        // env, file, vault or aws
+	EnvPrefix     string   `json:"env_prefix"`      // env provider: variable prefix
+	File          string   `json:"file"`            // file provider: sealed secrets file
+	KeyEnv        string   `json:"key_env"`         // file provider: env var holding the hex key
+	VaultAddr     string   `json:"vault_addr"`      // vault provider: server address
+	VaultMount    string   `json:"vault_mount"`     // vault provider: KV v2 mount
+	VaultTokenEnv string   `json:"vault_token_env"` // vault provider: env var holding the token
+	AWSRegion     string   `json:"aws_region"`      // aws provider: defaults to $AWS_REGION
+	AWSEndpoint   string   `json:"aws_endpoint"`    // aws provider: overrides the regional endpoint
+	Refresh       Duration `json:"refresh"`         // how often resolved secrets are re-read
+}
+
+// FirewallConfig filters requests before they reach any handler. IPs may
+// be addresses or CIDRs; the block lists are regular expressions.
+type FirewallConfig struct {
+	Allow           []string `json:"allow"` // when set, only these clients are served
+	Deny            []string `json:"deny"`
+	TrustedProxies  []string `json:"trusted_proxies"` // X-Forwarded-For is honoured from these
+	BlockUserAgents []string `json:"block_user_agents"`
+	BlockPaths      []string `json:"block_paths"`
+	BlockPayloads   []string `json:"block_payloads"`
+	InspectBytes    int64    `json:"inspect_bytes"` // body prefix checked against block_payloads
+}
+
+// SigningConfig enables HMAC verification of order submissions.
+type SigningConfig struct {
+	Secret   string   `json:"secret"`   // shared HMAC secret; may be a "secret:" reference
+	Required bool     `json:"required"` // reject unsigned submissions
+	Window   Duration `json:"window"`   // allowed clock skew and nonce retention
+}
+
+// SLOConfig defines the end-to-end latency objective: Objective of orders
+// should reach a terminal state within Threshold of being accepted.
+type SLOConfig struct {
+	Objective float64    `json:"objective"` // e.g. 0.99
+	Threshold Duration   `json:"threshold"`
+	Windows   []Duration `json:"windows"` // burn rate is reported per window
+}
+
+// RecordTrafficConfig appends a Sample of the requests under Paths to File
+// as JSON lines, for "go run ./tools replay". Credentials are dropped and
+// the Mask fields of JSON bodies are replaced with consistent tokens.
+// Empty File disables recording.
+type RecordTrafficConfig struct {
+	File   string   `json:"file"`
+	Paths  []string `json:"paths"`
+	Sample float64  `json:"sample"`
+	Mask   []string `json:"mask"`
+}
+
+// TenantsConfig holds the starting policy per tenant. Policies changed
+// through the API are saved to File, when set, and take precedence.
+// Results past their tenant's retention are deleted from the result log
+// every CheckEvery.
+type TenantsConfig struct {
+	File       string                  `json:"file"`
+	Policies   map[string]TenantPolicy `json:"policies"`
+	CheckEvery Duration                `json:"check_every"`
+}
+
+// TenantPolicy hides or masks order fields, named as in the order JSON,
+// in a tenant's results. Zero Retention keeps them as long as the log
+// does.
+type TenantPolicy struct {
+	Retention Duration `json:"retention"`
+	Hide      []string `json:"hide"`
+	Mask      []string `json:"mask"`
+}
+
+// ViewsConfig reduces the orders and results returned to submitter keys,
+// those without the admin scope, to the listed fields. Submitters only
+// see orders they submitted.
+type ViewsConfig struct {
+	Submitter ViewConfig `json:"submitter"`
+}
+
+// ViewConfig names fields as in the order and result JSON; Result covers
+// the fields of a result besides "order".
+type ViewConfig struct {
+	Order  []string `json:"order"`
+	Result []string `json:"result"`
+}
+
+// ForensicsConfig stores a goroutine dump and a CPU profile of
+// CPUDuration in Dir whenever the end-to-end p99 or the error rate of a
+// CheckEvery interval with at least MinSamples orders exceeds P99 or
+// ErrorRate. Captures are at least MinGap apart and the newest Keep are
+// kept. Empty Dir disables captures.
+type ForensicsConfig struct {
+	Dir         string   `json:"dir"`
+	P99         Duration `json:"p99"`
+	ErrorRate   float64  `json:"error_rate"`
+	MinSamples  int      `json:"min_samples"`
+	CheckEvery  Duration `json:"check_every"`
+	MinGap      Duration `json:"min_gap"`
+	CPUDuration Duration `json:"cpu_duration"`
+	Keep        int      `json:"keep"`
+}
+
+// TracingConfig sends spans over OTLP/HTTP to Endpoint, such as
+// http://localhost:4318/v1/traces, recording SampleRatio of the traces
+// not started by a client. Empty Endpoint disables tracing.
+type TracingConfig struct {
+	Endpoint    string  `json:"endpoint"`
+	ServiceName string  `json:"service_name"`
+	SampleRatio float64 `json:"sample_ratio"`
+}
+
+// PayloadsConfig keeps the body of every accepted order submission, as
+// received but with the values of the Mask fields hashed, for Retention,
+// in Dir or in the database of the bolt engine. Empty Dir disables it.
+type PayloadsConfig struct {
+	Dir       string   `json:"dir"`
+	Retention Duration `json:"retention"`
+	Mask      []string `json:"mask"`
+}
+
+// PipelineConfig is a named pipeline with its own workers and steps.
+type PipelineConfig struct {
+	Name    string   `json:"name"`
+	Workers int      `json:"workers"`
+	Buffer  int      `json:"buffer"`
+	Steps   []string `json:"steps"`    // defaults to simulate, validate, business_rules
+	ShardBy string   `json:"shard_by"` // "customer" or "tag:<name>"; empty shares one queue
+
+	// Scheduling is "priority" (the default) or "fifo" for unsharded
+	// pipelines. StarveAfter bounds how long lower priorities wait behind
+	// higher ones (default 5s).
+	Scheduling  string   `json:"scheduling"`
+	StarveAfter Duration `json:"starve_after"`
+
+	// Deadline bounds processing from acceptance for orders without a
+	// deadline; BudgetWeights splits it between steps (default 1 each).
+	Deadline      Duration           `json:"deadline"`
+	BudgetWeights map[string]float64 `json:"budget_weights"`
+
+	// ProcessingTimeout overrides the top-level processing timeout.
+	ProcessingTimeout *Duration `json:"processing_timeout"`
+
+	// Retry overrides the top-level retry policy.
+	Retry *RetryConfig `json:"retry"`
+
+	// Admission overrides the top-level admission strategy.
+	Admission *AdmissionConfig `json:"admission"`
+
+	// EvictDoomed refuses and evicts orders that would miss their
+	// deadline at the current service rate. Not for sharded pipelines.
+	EvictDoomed bool `json:"evict_doomed"`
+
+	// Canary sends a slice of this pipeline's orders to another one.
+	Canary *CanaryConfig `json:"canary"`
+
+	// Autoscale resizes the pipeline's workers with its queue.
+	Autoscale *AutoscaleConfig `json:"autoscale"`
+}
+
+// AutoscaleConfig keeps a pipeline's workers between MinWorkers and
+// MaxWorkers. A worker is added once more than HighWater orders (default
+// half the buffer) have been queued for UpAfter (default 5s), and an idle
+// one is stopped once the queue has been empty for DownAfter (default
+// 30s).
+type AutoscaleConfig struct {
+	MinWorkers int      `json:"min_workers"`
+	MaxWorkers int      `json:"max_workers"`
+	HighWater  int      `json:"high_water"`
+	UpAfter    Duration `json:"up_after"`
+	DownAfter  Duration `json:"down_after"`
+}
+
+func (a AutoscaleConfig) validate(workers int, shardBy string) error {
+	if a.MinWorkers < 1 || a.MaxWorkers < a.MinWorkers || workers < a.MinWorkers || workers > a.MaxWorkers {
+		return fmt.Errorf("autoscale needs 1 <= min_workers <= workers <= max_workers")
+	}
+	if a.HighWater < 0 || a.UpAfter.Duration < 0 || a.DownAfter.Duration < 0 {
+		return fmt.Errorf("autoscale needs high_water, up_after and down_after >= 0")
+	}
+	if shardBy != "" {
+		return fmt.Errorf("sharded pipelines can't autoscale")
+	}
+	return nil
+}
+
+// CanaryConfig sends Percent of a pipeline's orders to the pipeline named
+// Pipeline, and stops once that one has processed MinOrders (default 100)
+// orders with an error rate more than Tolerance (default 0.05) above the
+// baseline's.
+type CanaryConfig struct {
+	Pipeline  string  `json:"pipeline"`
+	Percent   float64 `json:"percent"`
+	MinOrders int     `json:"min_orders"`
+	Tolerance float64 `json:"tolerance"`
+}
+
+// RetryConfig retries failed orders up to MaxAttempts attempts in total,
+// waiting BaseDelay, doubling up to MaxDelay, between attempts. Jitter is
+// the fraction of each delay that is randomized. MaxAttempts 0 or 1
+// disables retries.
+type RetryConfig struct {
+	MaxAttempts int      `json:"max_attempts"`
+	BaseDelay   Duration `json:"base_delay"`
+	MaxDelay    Duration `json:"max_delay"`
+	Jitter      float64  `json:"jitter"`
+}
+
+func (c *Config) validateCanary(p PipelineConfig) error {
+	canary := p.Canary
+	if canary.Percent <= 0 || canary.Percent >= 100 {
+		return fmt.Errorf("canary.percent must be between 0 and 100")
+	}
+	if canary.MinOrders < 0 || canary.Tolerance < 0 || canary.Tolerance > 1 {
+		return fmt.Errorf("canary needs min_orders >= 0 and tolerance between 0 and 1")
+	}
+	if canary.Pipeline == p.Name {
+		return fmt.Errorf("canary.pipeline must be another pipeline")
+	}
+	for _, other := range c.Pipelines {
+		if other.Name == canary.Pipeline {
+			if other.Canary != nil {
+				return fmt.Errorf("canary %q can't have a canary of its own", canary.Pipeline)
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("canary.pipeline %q is not a pipeline", canary.Pipeline)
+}
+
+func (r RetryConfig) validate() error {
+	if r.MaxAttempts < 0 || r.BaseDelay.Duration < 0 || r.MaxDelay.Duration < 0 || r.Jitter < 0 || r.Jitter > 1 {
+		return fmt.Errorf("retry needs max_attempts, base_delay and max_delay >= 0 and jitter between 0 and 1")
+	}
+	if r.MaxAttempts > 1 && r.BaseDelay.Duration == 0 {
+		return fmt.Errorf("retry.base_delay must be > 0")
+	}
+	return nil
+}
+
+// AdmissionConfig selects an admission strategy: "always", "token_bucket"
+// (Rate orders per second, bursts of Burst), "codel" (refuse while queue
+// waits stay above Target for an Interval, default 100ms and 1s) or
+// "priority_shed" (refuse low and medium priority orders once the queue
+// is ShedLowAt and ShedMediumAt full, default 0.5 and 0.8). Empty admits
+// every order that fits.
+type AdmissionConfig struct {
+	Strategy     string   `json:"strategy"`
+	Rate         float64  `json:"rate"`
+	Burst        int      `json:"burst"`
+	Target       Duration `json:"target"`
+	Interval     Duration `json:"interval"`
+	ShedLowAt    float64  `json:"shed_low_at"`
+	ShedMediumAt float64  `json:"shed_medium_at"`
+}
+
+func (a AdmissionConfig) validate() error {
+	switch a.Strategy {
+	case "", "always", "codel", "priority_shed":
+	case "token_bucket":
+		if a.Rate <= 0 || a.Burst < 1 {
+			return fmt.Errorf("admission: token_bucket needs a rate > 0 and a burst >= 1")
+		}
+	default:
+		return fmt.Errorf("admission.strategy must be always, token_bucket, codel or priority_shed")
+	}
+	if a.Target.Duration < 0 || a.Interval.Duration < 0 || a.ShedLowAt < 0 || a.ShedMediumAt > 1 ||
+		a.ShedLowAt > 1 || a.ShedMediumAt < 0 {
+		return fmt.Errorf("admission needs target and interval >= 0 and shed_low_at and shed_medium_at between 0 and 1")
+	}
+	return nil
+}
+
+// HeavyConfig routes orders with at least MinItems items or at least
+// MinAmount to a separate pipeline. A zero threshold is not checked.
+type HeavyConfig struct {
+	Workers   int          `json:"workers"`
+	Buffer    int          `json:"buffer"`
+	MinItems  int          `json:"min_items"`
+	MinAmount models.Money `json:"min_amount"`
+}
+
+// MemoryConfig sheds low priority orders above ShedAboveMB of live heap and
+// pauses intake above PauseAboveMB. Zero disables a watermark.
+type MemoryConfig struct {
+	ShedAboveMB  int             `json:"shed_above_mb"`
+	PauseAboveMB int             `json:"pause_above_mb"`
+	ShedPriority models.Priority `json:"shed_priority"` // 3 sheds only low, 2 sheds medium and low
+	Interval     Duration        `json:"interval"`
+}
+
+// IdempotencyConfig keeps the responses to order submissions for TTL, by
+// Idempotency-Key header or the order ID, up to MaxKeys of them. A zero
+// TTL turns deduplication off.
+type IdempotencyConfig struct {
+	TTL     Duration `json:"ttl"`
+	MaxKeys int      `json:"max_keys"`
+}
+
+// DevConfig starts an internal generator submitting Rate orders per
+// second when Enabled (or with the -dev flag).
+type DevConfig struct {
+	Enabled bool    `json:"enabled"`
+	Rate    float64 `json:"rate"`
+}
+
+// KafkaConfig consumes orders from Topic as a member of Group, through
+// the Confluent REST Proxy at ProxyURL.
+type KafkaConfig struct {
+	ProxyURL    string   `json:"proxy_url"` // e.g. http://localhost:8082
+	Topic       string   `json:"topic"`
+	Group       string   `json:"group"`
+	PollTimeout Duration `json:"poll_timeout"`
+	MaxBytes    int      `json:"max_bytes"`   // per poll; 0 leaves it to the proxy
+	MaxBackoff  Duration `json:"max_backoff"` // while the queue is full or the proxy fails
+}
+
+// MetricsConfig selects the labels on order metrics: "pipeline",
+// "error_code", "tenant", "customer" or "tag.<key>". Values limits a label
+// to the listed values and Buckets maps a label's values to buckets, such
+// as customers to tiers; otherwise a label keeps its first MaxValues
+// values. Everything else is reported as "other".
+type MetricsConfig struct {
+	Labels    []string                     `json:"labels"`
+	MaxValues int                          `json:"max_values"`
+	Values    map[string][]string          `json:"values"`
+	Buckets   map[string]map[string]string `json:"buckets"`
+
+	// Push sends the metrics of GET /metrics out periodically, for
+	// environments that don't scrape; DisablePull then drops the endpoint.
+	Push        MetricsPushConfig `json:"push"`
+	DisablePull bool              `json:"disable_pull"`
+}
+
+// MetricsPushConfig pushes metrics every Interval when Protocol is set:
+// "statsd" sends them to the UDP address Addr, with names prefixed by
+// Prefix and lines batched into datagrams of up to MaxPacket bytes; "otlp"
+// posts them to the OTLP/HTTP Endpoint, such as
+// http://localhost:4318/v1/metrics, as ServiceName.
+type MetricsPushConfig struct {
+	Protocol    string   `json:"protocol"`
+	Interval    Duration `json:"interval"`
+	Addr        string   `json:"addr"`
+	Prefix      string   `json:"prefix"`
+	MaxPacket   int      `json:"max_packet"`
+	Endpoint    string   `json:"endpoint"`
+	ServiceName string   `json:"service_name"`
+}
+
+// StreamsConfig bounds live result streams. Each subscriber buffers up to
+// Buffer results; when full, DropPolicy (drop_oldest, drop_newest or
+// disconnect) applies. The last Replay order events are kept for event
+// stream clients resuming after a reconnect.
+type StreamsConfig struct {
+	Buffer     int      `json:"buffer"`
+	DropPolicy string   `json:"drop_policy"`
+	Heartbeat  Duration `json:"heartbeat"`
+	Replay     int      `json:"replay"`
+}
+
+// EventsConfig stores the result event log and subscriber cursors in Dir,
+// keeping the last Retain events.
+type EventsConfig struct {
+	Dir    string `json:"dir"`
+	Retain int    `json:"retain"`
+}
+
+// StorageConfig selects where the event log, forensics captures and
+// order records are kept: Engine "files" (default) uses events.dir and
+// forensics.dir and keeps order records in memory, and "bolt" uses one
+// embedded database file at Path. With bolt, setting those directories
+// only turns the features on. "postgres" keeps order records in the
+// PostgreSQL database at DSN and the rest in files, like "files".
+type StorageConfig struct {
+	Engine string `json:"engine"`
+	Path   string `json:"path"`
+	DSN    string `json:"dsn"` // may be a "secret:" reference
+}
+
+// QueueConfig selects the queue backend: "channel", the default, queues
+// orders and results in memory, and "redis" in the Redis server at
+// Redis.Addr, shared by every instance using it. Redis queues are FIFO;
+// pipelines can't be sharded or spilled and results.overflow doesn't
+// apply.
+type QueueConfig struct {
+	Backend string      `json:"backend"`
+	Redis   RedisConfig `json:"redis"`
+}
+
+// RedisConfig addresses a Redis server, version 6.2 or later. Keys start
+// with Prefix.
+type RedisConfig struct {
+	Addr     string `json:"addr"`
+	Username string `json:"username"`
+	Password string `json:"password"` // may be a "secret:" reference
+	DB       int    `json:"db"`
+	TLS      bool   `json:"tls"`
+	Prefix   string `json:"prefix"`
+}
+
+// AnalyticsConfig selects the analytics sink, "clickhouse" or "bigquery";
+// empty disables export. It reads the event log, so events.dir must be set.
+type AnalyticsConfig struct {
+	Sink       string   `json:"sink"`
+	URL        string   `json:"url"` // ClickHouse HTTP endpoint, or a BigQuery API base override
+	Table      string   `json:"table"`
+	User       string   `json:"user"`      // ClickHouse
+	Token      string   `json:"token"`     // ClickHouse password or BigQuery access token; may be a "secret:" reference
+	Project    string   `json:"project"`   // BigQuery
+	Dataset    string   `json:"dataset"`   // BigQuery
+	Transform  string   `json:"transform"` // name of a transform applied to each row
+	BatchSize  int      `json:"batch_size"`
+	FlushEvery Duration `json:"flush_interval"`
+	MaxBackoff Duration `json:"max_backoff"`
+}
+
+// WebhookConfig is one webhook consumer. It reads the event log, so
+// events.dir must be set. Encryption is "", "nacl_box" or "jwe" to
+// PublicKey, a base64 X25519 key.
+type WebhookConfig struct {
+	Name       string   `json:"name"`
+	URL        string   `json:"url"`
+	Secret     string   `json:"secret"` // HMAC signing key; may be a "secret:" reference
+	Encryption string   `json:"encryption"`
+	PublicKey  string   `json:"public_key"`
+	Transform  string   `json:"transform"`
+	Timeout    Duration `json:"timeout"`
+
+	// Digest, when set, sends a summary of the results every interval
+	// instead of one delivery per result.
+	Digest *DigestConfig `json:"digest"`
+}
+
+// DigestConfig groups a webhook's digest by "tenant", "customer" or, when
+// GroupBy is empty, not at all.
+type DigestConfig struct {
+	Every   Duration `json:"every"`
+	GroupBy string   `json:"group_by"`
+}
+
+// PublisherConfig publishes result events to SuccessTopic or
+// FailureTopic by outcome; an empty topic leaves those results out.
+// Broker is "kafka", through the Confluent REST Proxy at URL, or "nats",
+// JetStream at a nats:// URL. It reads the event log, so events.dir must
+// be set.
+type PublisherConfig struct {
+	Name         string   `json:"name"`
+	Broker       string   `json:"broker"`
+	URL          string   `json:"url"`
+	Token        string   `json:"token"` // may be a "secret:" reference
+	SuccessTopic string   `json:"success_topic"`
+	FailureTopic string   `json:"failure_topic"`
+	Transform    string   `json:"transform"`
+	Timeout      Duration `json:"timeout"`
+}
+
+// CallbacksConfig enables per-order result callbacks. AllowedHosts limits
+// the hosts, and their subdomains, that callbacks may be sent to.
+type CallbacksConfig struct {
+	Enabled      bool     `json:"enabled"`
+	Secret       string   `json:"secret"` // HMAC signing key; may be a "secret:" reference
+	AllowedHosts []string `json:"allowed_hosts"`
+	MaxAttempts  int      `json:"max_attempts"`
+	Workers      int      `json:"workers"`
+	Timeout      Duration `json:"timeout"`
+}
+
+// WebhookRegistrationsConfig enables POST /webhooks. Registrations are
+// saved in File, secrets included, so they survive a restart. AllowedHosts
+// limits the hosts, and their subdomains, webhooks may point at.
+type WebhookRegistrationsConfig struct {
+	Enabled      bool     `json:"enabled"`
+	File         string   `json:"file"`
+	AllowedHosts []string `json:"allowed_hosts"`
+	MaxPerTenant int      `json:"max_per_tenant"`
+	Timeout      Duration `json:"timeout"`
+}
+
+// JobsConfig persists job records in Dir when it is set, so their outcome
+// survives a restart. At most Workers jobs run at once; more wait queued.
+type JobsConfig struct {
+	Dir     string `json:"dir"`
+	Workers int    `json:"workers"`
+}
+
+// ReconcileConfig compares the states of finished orders with a system of
+// record at URL every Every, as a background job, once they have settled
+// for Settle. States maps the system's state names to order states. An
+// empty URL disables reconciliation.
+type ReconcileConfig struct {
+	URL    string            `json:"url"` // e.g. http://localhost:9090/oms for cmd/mockproviders
+	States map[string]string `json:"states"`
+	Every  Duration          `json:"every"`
+	Settle Duration          `json:"settle"`
+}
+
+// SpillConfig enables disk spillover when Dir is set. Each pipeline spills
+// to its own subdirectory and holds at most MaxOrders on disk.
+type SpillConfig struct {
+	Dir       string `json:"dir"`
+	MaxOrders int    `json:"max_orders"`
+}
+
+// JournalConfig enables the order journal when Dir is set. Sync is
+// "always" (the default), fsyncing before an order is accepted,
+// "interval", every SyncEvery, or "never".
+type JournalConfig struct {
+	Dir       string   `json:"dir"`
+	Sync      string   `json:"sync"`
+	SyncEvery Duration `json:"sync_every"`
+}
+
+// ResultsConfig sets the overflow policy of the results channel:
+// "block" (the default), "drop_oldest" or "spill", which keeps up to
+// SpillMax results in SpillDir.
+type ResultsConfig struct {
+	Overflow string `json:"overflow"`
+	SpillDir string `json:"spill_dir"`
+	SpillMax int    `json:"spill_max"`
+}
+
+// PaymentConfig tunes the simulated payment gateway used by the "payment"
+// pipeline step.
+type PaymentConfig struct {
+	GatewayLatency Duration     `json:"gateway_latency"`
+	DeclineAbove   models.Money `json:"decline_above"` // charges above this are declined; 0 approves all
+
+	// GatewayURL switches from the simulated gateway to an HTTP provider,
+	// e.g. http://localhost:9090/payment for cmd/mockproviders.
+	GatewayURL string `json:"gateway_url"`
+}
+
+// ShippingConfig sets the shipping day rules. Orders placed after Cutoff
+// ("15:04" in Timezone) ship the next day and nothing ships or arrives on
+// BlackoutDates ("2006-01-02"). Services are tried in order.
+type ShippingConfig struct {
+	Timezone      string                  `json:"timezone"`
+	Cutoff        string                  `json:"cutoff"`
+	BlackoutDates []string                `json:"blackout_dates"`
+	MaxAdvance    Duration                `json:"max_advance"` // how far ahead a window may start
+	Services      []ShippingServiceConfig `json:"services"`
+}
+
+type ShippingServiceConfig struct {
+	Name        string `json:"name"`
+	TransitDays int    `json:"transit_days"`
+}
+
+// RouteConfig sends orders matching every set condition to Pipeline.
+type RouteConfig struct {
+	Pipeline  string            `json:"pipeline"`
+	Tags      map[string]string `json:"tags"`
+	Items     []string          `json:"items"`
+	MinItems  int               `json:"min_items"`
+	MinAmount models.Money      `json:"min_amount"`
+	MaxAmount models.Money      `json:"max_amount"`
+}
+
+// ValidatorConfig selects a registered validator by name.
+type ValidatorConfig struct {
+	Name   string            `json:"name"`
+	Params map[string]string `json:"params"`
+}
+
+// EnrichmentConfig is one reference dataset. Key is "customer",
+// "customer_id", "tenant", "item" or "tag:<name>"; Tags maps attributes
+// to the tags they are copied to. The data comes from File, a JSON object
+// of attributes by key checked for changes every Reload (default 1m), or
+// from URL, looked up per key with "{key}" replaced and cached for TTL
+// (default 5m).
+type EnrichmentConfig struct {
+	Name    string            `json:"name"`
+	Key     string            `json:"key"`
+	Tags    map[string]string `json:"tags"`
+	File    string            `json:"file"`
+	Reload  Duration          `json:"reload"`
+	URL     string            `json:"url"`
+	Token   string            `json:"token"` // may be a "secret:" reference
+	TTL     Duration          `json:"ttl"`
+	Timeout Duration          `json:"timeout"`
+}
+
+// QualityConfig maps data quality indicators, "missing_notes",
+// "default_priority", "validation_failures" and "address_rejections", to
+// the highest acceptable ratio of orders. Sources and tenants over a
+// target are reported as breaching it.
+type QualityConfig struct {
+	Targets map[string]float64 `json:"targets"`
+}
+
+// TransformConfig is a Go template producing JSON, or a mapping of output
+// fields to JSONPath expressions.
+type TransformConfig struct {
+	Template string            `json:"template"`
+	Mapping  map[string]string `json:"mapping"`
+}
+
+// TagsConfig restricts order tags. When Allowed is set only the listed
+// keys are accepted; a key with an empty value list accepts any value.
+type TagsConfig struct {
+	MaxTags int                 `json:"max_tags"`
+	Allowed map[string][]string `json:"allowed"`
+}
+
+// Duration wraps time.Duration so it can be written as "5s" in JSON.
+type Duration struct {
+	time.Duration
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"5s\": %w", err)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = parsed
+	return nil
+}
+
+// Default returns the configuration used when no config file is given.
+func Default() *Config {
+	hostname, _ := os.Hostname()
+	return &Config{
+		Addr:       ":8080",
+		SocketMode: "0660",
+		HTTP3: HTTP3Config{
+			AltSvc:       true,
+			AltSvcMaxAge: Duration{24 * time.Hour},
+		},
+		Workers:         10,
+		Buffer:          100,
+		ShutdownTimeout: Duration{30 * time.Second},
+		Retry: RetryConfig{
+			BaseDelay: Duration{100 * time.Millisecond},
+			MaxDelay:  Duration{30 * time.Second},
+			Jitter:    0.5,
+		},
+		Cluster: ClusterConfig{
+			NodeID:  hostname,
+			Timeout: Duration{2 * time.Second},
+		},
+		Payment: PaymentConfig{
+			GatewayLatency: Duration{20 * time.Millisecond},
+		},
+		Outbound: OutboundConfig{
+			Timeout:          Duration{5 * time.Second},
+			Retries:          2,
+			Backoff:          Duration{100 * time.Millisecond},
+			FailureThreshold: 5,
+			OpenFor:          Duration{30 * time.Second},
+			MaxIdlePerHost:   16,
+		},
+		Dev: DevConfig{
+			Rate: 5,
+		},
+		Kafka: KafkaConfig{
+			Topic:       "orders",
+			Group:       "order-processor",
+			PollTimeout: Duration{time.Second},
+			MaxBackoff:  Duration{30 * time.Second},
+		},
+		Metrics: MetricsConfig{
+			Labels:    []string{"pipeline", "error_code"},
+			MaxValues: 100,
+			Push: MetricsPushConfig{
+				Interval:    Duration{10 * time.Second},
+				MaxPacket:   1432, // fits an Ethernet MTU
+				ServiceName: "order-processor",
+			},
+		},
+		Streams: StreamsConfig{
+			Buffer:     256,
+			DropPolicy: "drop_oldest",
+			Heartbeat:  Duration{15 * time.Second},
+			Replay:     1000,
+		},
+		Events: EventsConfig{
+			Retain: 100000,
+		},
+		Storage: StorageConfig{
+			Engine: "files",
+		},
+		Queue: QueueConfig{
+			Backend: "channel",
+			Redis:   RedisConfig{Prefix: "orders"},
+		},
+		Spill: SpillConfig{
+			MaxOrders: 100000,
+		},
+		Journal: JournalConfig{
+			Sync:      "always",
+			SyncEvery: Duration{time.Second},
+		},
+		Results: ResultsConfig{
+			Overflow: "block",
+			SpillMax: 100000,
+		},
+		Jobs: JobsConfig{
+			Workers: 2,
+		},
+		Reconcile: ReconcileConfig{
+			Every:  Duration{15 * time.Minute},
+			Settle: Duration{5 * time.Minute},
+		},
+		Shipping: ShippingConfig{
+			Timezone:   "UTC",
+			Cutoff:     "15:00",
+			MaxAdvance: Duration{90 * 24 * time.Hour},
+			Services: []ShippingServiceConfig{
+				{Name: "ground", TransitDays: 5},
+				{Name: "express", TransitDays: 2},
+				{Name: "overnight", TransitDays: 1},
+			},
+		},
+		Callbacks: CallbacksConfig{
+			MaxAttempts: 5,
+			Workers:     4,
+			Timeout:     Duration{10 * time.Second},
+		},
+		WebhookRegistrations: WebhookRegistrationsConfig{
+			MaxPerTenant: 10,
+			Timeout:      Duration{30 * time.Second},
+		},
+		Analytics: AnalyticsConfig{
+			BatchSize:  1000,
+			FlushEvery: Duration{5 * time.Second},
+			MaxBackoff: Duration{time.Minute},
+		},
+		Memory: MemoryConfig{
+			ShedPriority: models.PriorityLow,
+			Interval:     Duration{time.Second},
+		},
+		Idempotency: IdempotencyConfig{
+			TTL:     Duration{24 * time.Hour},
+			MaxKeys: 10000,
+		},
+		Tags: TagsConfig{
+			MaxTags: 10,
+		},
+		Signing: SigningConfig{
+			Window: Duration{5 * time.Minute},
+		},
+		RecordTraffic: RecordTrafficConfig{
+			Paths:  []string{"/orders"},
+			Sample: 1,
+			Mask:   []string{"customer", "address", "notes", "callback_url", "credit_account"},
+		},
+		Payloads: PayloadsConfig{
+			Retention: Duration{30 * 24 * time.Hour},
+			Mask:      []string{"address", "notes", "credit_account"},
+		},
+		Tenants: TenantsConfig{
+			CheckEvery: Duration{time.Minute},
+		},
+		Views: ViewsConfig{
+			Submitter: ViewConfig{
+				Order: []string{"id", "amount", "items", "customer", "address", "status", "created_at", "priority",
+					"tags", "customer_id", "address_id", "requested_delivery_window", "deadline", "callback_url"},
+				Result: []string{"processed_at", "success", "error", "error_code", "result", "result_code", "payment", "shipment"},
+			},
+		},
+		Forensics: ForensicsConfig{
+			MinSamples:  20,
+			CheckEvery:  Duration{10 * time.Second},
+			MinGap:      Duration{15 * time.Minute},
+			CPUDuration: Duration{10 * time.Second},
+			Keep:        20,
+		},
+		Tracing: TracingConfig{
+			ServiceName: "order-processor",
+			SampleRatio: 1,
+		},
+		SLO: SLOConfig{
+			Objective: 0.99,
+			Threshold: Duration{2 * time.Second},
+			Windows:   []Duration{{5 * time.Minute}, {time.Hour}, {6 * time.Hour}},
+		},
+		Secrets: SecretsConfig{
+			Provider:      "env",
+			EnvPrefix:     "ORDER_PROCESSOR_",
+			KeyEnv:        "ORDER_PROCESSOR_SECRETS_KEY",
+			VaultMount:    "secret",
+			VaultTokenEnv: "VAULT_TOKEN",
+			Refresh:       Duration{5 * time.Minute},
+		},
+	}
+}
+
+// Load reads a JSON config file on top of the defaults. An empty path
+// returns the defaults unchanged.
+func Load(path string) (*Config, error) {
+	cfg := Default()
+	if path == "" {
+		return cfg, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read config: %w", err)
+	}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("parse config: %w", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Validate checks that the loaded values are usable.
+func (c *Config) Validate() error {
+	if c.Workers <= 0 {
+		return fmt.Errorf("workers must be > 0")
+	}
+	if c.Buffer <= 0 {
+		return fmt.Errorf("buffer must be > 0")
+	}
+	if c.ShutdownTimeout.Duration <= 0 {
+		return fmt.Errorf("shutdown_timeout must be > 0")
+	}
+	if c.QuiescePeriod.Duration < 0 {
+		return fmt.Errorf("quiesce_period must be >= 0")
+	}
+	if c.ProcessingTimeout.Duration < 0 {
+		return fmt.Errorf("processing_timeout must be >= 0")
+	}
+	for _, p := range c.Pipelines {
+		if p.Name == "" || p.Workers <= 0 || p.Buffer <= 0 {
+			return fmt.Errorf("pipelines need a name and workers and buffer > 0")
+		}
+		if p.Deadline.Duration < 0 {
+			return fmt.Errorf("pipeline %q: deadline must be >= 0", p.Name)
+		}
+		if p.ProcessingTimeout != nil && p.ProcessingTimeout.Duration < 0 {
+			return fmt.Errorf("pipeline %q: processing_timeout must be >= 0", p.Name)
+		}
+		if p.Scheduling != "" && p.Scheduling != "priority" && p.Scheduling != "fifo" {
+			return fmt.Errorf("pipeline %q: scheduling must be priority or fifo", p.Name)
+		}
+		if p.StarveAfter.Duration < 0 {
+			return fmt.Errorf("pipeline %q: starve_after must be >= 0", p.Name)
+		}
+		if p.EvictDoomed && p.ShardBy != "" {
+			return fmt.Errorf("pipeline %q: evict_doomed doesn't apply to sharded pipelines", p.Name)
+		}
+		for step, w := range p.BudgetWeights {
+			if w <= 0 {
+				return fmt.Errorf("pipeline %q: budget weight of %q must be > 0", p.Name, step)
+			}
+		}
+		if p.Admission != nil {
+			if err := p.Admission.validate(); err != nil {
+				return fmt.Errorf("pipeline %q: %w", p.Name, err)
+			}
+		}
+		if p.Retry != nil {
+			if err := p.Retry.validate(); err != nil {
+				return fmt.Errorf("pipeline %q: %w", p.Name, err)
+			}
+		}
+		if p.Autoscale != nil {
+			if err := p.Autoscale.validate(p.Workers, p.ShardBy); err != nil {
+				return fmt.Errorf("pipeline %q: %w", p.Name, err)
+			}
+		}
+		if p.Canary != nil {
+			if err := c.validateCanary(p); err != nil {
+				return fmt.Errorf("pipeline %q: %w", p.Name, err)
+			}
+		}
+	}
+	if err := c.Retry.validate(); err != nil {
+		return err
+	}
+	if err := c.Admission.validate(); err != nil {
+		return err
+	}
+	if c.Autoscale != nil {
+		if len(c.Pipelines) > 0 {
+			return fmt.Errorf("autoscale applies to the default pipeline; set it on each pipeline instead")
+		}
+		if err := c.Autoscale.validate(c.Workers, ""); err != nil {
+			return err
+		}
+	}
+	if len(c.Routes) > 0 && len(c.Pipelines) == 0 {
+		return fmt.Errorf("routes require pipelines to be configured")
+	}
+	if !c.Memory.ShedPriority.Valid() {
+		return fmt.Errorf("memory.shed_priority must be 1, 2 or 3")
+	}
+	if c.Outbound.Timeout.Duration <= 0 || c.Outbound.Retries < 0 || c.Outbound.OpenFor.Duration <= 0 {
+		return fmt.Errorf("outbound.timeout and outbound.open_for must be > 0 and retries >= 0")
+	}
+	if c.Dev.Rate <= 0 {
+		return fmt.Errorf("dev.rate must be > 0")
+	}
+	if k := c.Kafka; k.ProxyURL != "" && (k.Topic == "" || k.Group == "" || k.PollTimeout.Duration <= 0 || k.MaxBackoff.Duration <= 0) {
+		return fmt.Errorf("kafka needs a topic, a group and poll_timeout and max_backoff > 0")
+	}
+	if t := c.RecordTraffic; t.File != "" && (len(t.Paths) == 0 || t.Sample <= 0 || t.Sample > 1) {
+		return fmt.Errorf("record_traffic needs paths and a sample in (0, 1]")
+	}
+	if c.Payloads.Dir != "" && c.Payloads.Retention.Duration <= 0 {
+		return fmt.Errorf("payloads.retention must be > 0")
+	}
+	if c.Tenants.CheckEvery.Duration <= 0 {
+		return fmt.Errorf("tenants.check_every must be > 0")
+	}
+	if f := c.Forensics; f.Dir != "" {
+		if f.P99.Duration <= 0 && f.ErrorRate <= 0 {
+			return fmt.Errorf("forensics needs p99 or error_rate")
+		}
+		if f.CheckEvery.Duration <= 0 || f.CPUDuration.Duration <= 0 || f.Keep <= 0 {
+			return fmt.Errorf("forensics.check_every, cpu_duration and keep must be > 0")
+		}
+	}
+	if t := c.Tracing; t.Endpoint != "" && (t.ServiceName == "" || t.SampleRatio <= 0 || t.SampleRatio > 1) {
+		return fmt.Errorf("tracing needs a service_name and a sample_ratio in (0, 1]")
+	}
+	if c.Metrics.MaxValues <= 0 {
+		return fmt.Errorf("metrics.max_values must be > 0")
+	}
+	switch p := c.Metrics.Push; p.Protocol {
+	case "":
+		if c.Metrics.DisablePull {
+			return fmt.Errorf("metrics.disable_pull needs metrics.push")
+		}
+	case "statsd":
+		if p.Addr == "" || p.MaxPacket <= 0 {
+			return fmt.Errorf("metrics.push over statsd needs an addr and a max_packet > 0")
+		}
+	case "otlp":
+		if p.Endpoint == "" || p.ServiceName == "" {
+			return fmt.Errorf("metrics.push over otlp needs an endpoint and a service_name")
+		}
+	default:
+		return fmt.Errorf("metrics.push.protocol must be statsd or otlp")
+	}
+	if c.Metrics.Push.Protocol != "" && c.Metrics.Push.Interval.Duration <= 0 {
+		return fmt.Errorf("metrics.push.interval must be > 0")
+	}
+	if c.Streams.Buffer <= 0 || c.Streams.Heartbeat.Duration <= 0 || c.Streams.Replay <= 0 {
+		return fmt.Errorf("streams.buffer, streams.heartbeat and streams.replay must be > 0")
+	}
+	switch c.Storage.Engine {
+	case "files":
+	case "bolt":
+		if c.Storage.Path == "" {
+			return fmt.Errorf("storage.path is required for the bolt engine")
+		}
+	case "postgres":
+		if c.Storage.DSN == "" {
+			return fmt.Errorf("storage.dsn is required for the postgres engine")
+		}
+	default:
+		return fmt.Errorf("storage.engine must be files, bolt or postgres")
+	}
+	switch c.Queue.Backend {
+	case "channel":
+	case "redis":
+		if c.Queue.Redis.Addr == "" {
+			return fmt.Errorf("queue.redis.addr is required for the redis backend")
+		}
+		if c.Spill.Dir != "" || c.Results.Overflow != "block" {
+			return fmt.Errorf("spill.dir and results.overflow don't apply to the redis backend")
+		}
+		for _, p := range c.Pipelines {
+			if p.ShardBy != "" || p.Scheduling == "priority" {
+				return fmt.Errorf("pipeline %q: redis queues are fifo and can't be sharded", p.Name)
+			}
+		}
+	default:
+		return fmt.Errorf("queue.backend must be channel or redis")
+	}
+	if c.Journal.Dir != "" {
+		if c.Storage.Engine != "files" {
+			return fmt.Errorf("journal.dir is not needed with the %s engine, which keeps order records durably", c.Storage.Engine)
+		}
+		switch c.Journal.Sync {
+		case "always", "never":
+		case "interval":
+			if c.Journal.SyncEvery.Duration <= 0 {
+				return fmt.Errorf("journal.sync_every must be > 0")
+			}
+		default:
+			return fmt.Errorf("journal.sync must be always, interval or never")
+		}
+	}
+	if c.Events.Dir != "" && c.Events.Retain <= 0 {
+		return fmt.Errorf("events.retain must be > 0")
+	}
+	if cb := c.Callbacks; cb.Enabled && (cb.MaxAttempts <= 0 || cb.Workers <= 0 || cb.Timeout.Duration <= 0) {
+		return fmt.Errorf("callbacks.max_attempts, workers and timeout must be > 0")
+	}
+	if wr := c.WebhookRegistrations; wr.Enabled {
+		if c.Events.Dir == "" {
+			return fmt.Errorf("webhook_registrations require events.dir")
+		}
+		if wr.MaxPerTenant < 0 || wr.Timeout.Duration <= 0 {
+			return fmt.Errorf("webhook_registrations.max_per_tenant must be >= 0 and timeout > 0")
+		}
+	}
+	if _, err := time.LoadLocation(c.Shipping.Timezone); err != nil {
+		return fmt.Errorf("shipping.timezone: %w", err)
+	}
+	if len(c.Shipping.Services) == 0 {
+		return fmt.Errorf("shipping.services must not be empty")
+	}
+	for _, s := range c.Shipping.Services {
+		if s.Name == "" || s.TransitDays < 0 {
+			return fmt.Errorf("shipping.services need a name and transit_days >= 0")
+		}
+	}
+	if c.Jobs.Workers <= 0 {
+		return fmt.Errorf("jobs.workers must be > 0")
+	}
+	if r := c.Reconcile; r.URL != "" && (r.Every.Duration <= 0 || r.Settle.Duration < 0) {
+		return fmt.Errorf("reconcile.every must be > 0 and settle >= 0")
+	}
+	if c.Spill.Dir != "" && c.Spill.MaxOrders <= 0 {
+		return fmt.Errorf("spill.max_orders must be > 0")
+	}
+	switch c.Results.Overflow {
+	case "block", "drop_oldest":
+	case "spill":
+		if c.Results.SpillDir == "" || c.Results.SpillMax <= 0 {
+			return fmt.Errorf("results.overflow spill needs spill_dir and spill_max > 0")
+		}
+	default:
+		return fmt.Errorf("results.overflow must be block, drop_oldest or spill")
+	}
+	if i := c.Idempotency; i.TTL.Duration < 0 || (i.TTL.Duration > 0 && i.MaxKeys <= 0) {
+		return fmt.Errorf("idempotency.ttl must be >= 0 and max_keys > 0")
+	}
+	if c.Memory.Interval.Duration <= 0 {
+		return fmt.Errorf("memory.interval must be > 0")
+	}
+	if c.Heavy.Workers > 0 {
+		if c.Heavy.Buffer <= 0 {
+			return fmt.Errorf("heavy.buffer must be > 0")
+		}
+		if c.Heavy.MinItems <= 0 && c.Heavy.MinAmount <= 0 {
+			return fmt.Errorf("heavy needs min_items or min_amount")
+		}
+	}
+	if c.Cluster.Timeout.Duration <= 0 {
+		return fmt.Errorf("cluster.timeout must be > 0")
+	}
+	if _, err := strconv.ParseUint(c.SocketMode, 8, 32); err != nil {
+		return fmt.Errorf("socket_mode must be an octal permission like 0660")
+	}
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		return fmt.Errorf("tls needs both cert_file and key_file")
+	}
+	if c.TLS.ClientCAFile != "" && c.TLS.CertFile == "" {
+		return fmt.Errorf("tls.client_ca_file requires tls to be configured")
+	}
+	if (c.TLS.RequireClientCert || len(c.TLS.ClientCerts) > 0) && c.TLS.ClientCAFile == "" {
+		return fmt.Errorf("tls.require_client_cert and tls.client_certs need tls.client_ca_file")
+	}
+	for i, cc := range c.TLS.ClientCerts {
+		if cc.Subject == "" {
+			return fmt.Errorf("tls.client_certs[%d].subject is required", i)
+		}
+	}
+	if c.HTTP3.Addr != "" && c.TLS.CertFile == "" {
+		return fmt.Errorf("http3 requires tls to be configured")
+	}
+	if c.Signing.Required && c.Signing.Secret == "" {
+		return fmt.Errorf("signing.secret is required when signing.required is set")
+	}
+	if c.Signing.Window.Duration <= 0 {
+		return fmt.Errorf("signing.window must be > 0")
+	}
+	if c.SLO.Objective <= 0 || c.SLO.Objective >= 1 {
+		return fmt.Errorf("slo.objective must be between 0 and 1")
+	}
+	if c.SLO.Threshold.Duration <= 0 {
+		return fmt.Errorf("slo.threshold must be > 0")
+	}
+	if len(c.SLO.Windows) == 0 {
+		return fmt.Errorf("slo.windows must not be empty")
+	}
+	for _, w := range c.SLO.Windows {
+		if w.Duration <= 0 {
+			return fmt.Errorf("slo.windows must be > 0")
+		}
+	}
+	switch a := c.Analytics; a.Sink {
+	case "":
+	case "clickhouse", "bigquery":
+		if c.Events.Dir == "" {
+			return fmt.Errorf("analytics requires events.dir")
+		}
+		if a.Table == "" || a.Sink == "clickhouse" && a.URL == "" || a.Sink == "bigquery" && (a.Project == "" || a.Dataset == "") {
+			return fmt.Errorf("analytics.%s is missing its url, project, dataset or table", a.Sink)
+		}
+		if _, ok := c.Transforms[a.Transform]; a.Transform != "" && !ok {
+			return fmt.Errorf("analytics.transform %q is not defined", a.Transform)
+		}
+		if a.BatchSize <= 0 || a.FlushEvery.Duration <= 0 || a.MaxBackoff.Duration <= 0 {
+			return fmt.Errorf("analytics.batch_size, flush_interval and max_backoff must be > 0")
+		}
+	default:
+		return fmt.Errorf("analytics.sink must be clickhouse or bigquery")
+	}
+	publishers := make(map[string]bool, len(c.Publishers))
+	for _, p := range c.Publishers {
+		if c.Events.Dir == "" {
+			return fmt.Errorf("publishers require events.dir")
+		}
+		if p.Name == "" || p.URL == "" || publishers[p.Name] {
+			return fmt.Errorf("publishers need a unique name and a url")
+		}
+		publishers[p.Name] = true
+		if p.Broker != "kafka" && p.Broker != "nats" {
+			return fmt.Errorf("publisher %q: broker must be kafka or nats", p.Name)
+		}
+		if p.SuccessTopic == "" && p.FailureTopic == "" {
+			return fmt.Errorf("publisher %q needs a success_topic or a failure_topic", p.Name)
+		}
+		if _, ok := c.Transforms[p.Transform]; p.Transform != "" && !ok {
+			return fmt.Errorf("publisher %q: transform %q is not defined", p.Name, p.Transform)
+		}
+		if p.Timeout.Duration < 0 {
+			return fmt.Errorf("publisher %q: timeout must be >= 0", p.Name)
+		}
+	}
+	datasets := make(map[string]bool, len(c.Enrichment))
+	for _, e := range c.Enrichment {
+		if e.Name == "" || datasets[e.Name] {
+			return fmt.Errorf("enrichment datasets need a unique name")
+		}
+		datasets[e.Name] = true
+		switch {
+		case e.Key == "customer", e.Key == "customer_id", e.Key == "tenant", e.Key == "item":
+		case strings.HasPrefix(e.Key, "tag:") && len(e.Key) > len("tag:"):
+		default:
+			return fmt.Errorf("enrichment %q: key must be customer, customer_id, tenant, item or tag:<name>", e.Name)
+		}
+		if len(e.Tags) == 0 {
+			return fmt.Errorf("enrichment %q: tags must map at least one attribute", e.Name)
+		}
+		if (e.File == "") == (e.URL == "") {
+			return fmt.Errorf("enrichment %q: set one of file and url", e.Name)
+		}
+		if e.URL != "" && !strings.Contains(e.URL, "{key}") {
+			return fmt.Errorf("enrichment %q: url must contain {key}", e.Name)
+		}
+		if e.Reload.Duration < 0 || e.TTL.Duration < 0 || e.Timeout.Duration < 0 {
+			return fmt.Errorf("enrichment %q: reload, ttl and timeout must be >= 0", e.Name)
+		}
+	}
+	for indicator, target := range c.Quality.Targets {
+		switch indicator {
+		case "missing_notes", "default_priority", "validation_failures", "address_rejections":
+		default:
+			return fmt.Errorf("quality: indicator %q must be missing_notes, default_priority, validation_failures or address_rejections", indicator)
+		}
+		if target < 0 || target > 1 {
+			return fmt.Errorf("quality: target of %s must be 0-1", indicator)
+		}
+	}
+	webhooks := make(map[string]bool, len(c.Webhooks))
+	for _, w := range c.Webhooks {
+		if c.Events.Dir == "" {
+			return fmt.Errorf("webhooks require events.dir")
+		}
+		if w.Name == "" || w.URL == "" || webhooks[w.Name] {
+			return fmt.Errorf("webhooks need a unique name and a url")
+		}
+		webhooks[w.Name] = true
+		switch w.Encryption {
+		case "":
+		case "nacl_box", "jwe":
+			if w.PublicKey == "" {
+				return fmt.Errorf("webhook %q: encryption requires public_key", w.Name)
+			}
+		default:
+			return fmt.Errorf("webhook %q: encryption must be nacl_box or jwe", w.Name)
+		}
+		if _, ok := c.Transforms[w.Transform]; w.Transform != "" && !ok {
+			return fmt.Errorf("webhook %q: transform %q is not defined", w.Name, w.Transform)
+		}
+		if w.Digest != nil {
+			if w.Digest.Every.Duration < time.Second {
+				return fmt.Errorf("webhook %q: digest.every must be at least 1s", w.Name)
+			}
+			switch w.Digest.GroupBy {
+			case "", "tenant", "customer":
+			default:
+				return fmt.Errorf("webhook %q: digest.group_by must be tenant or customer", w.Name)
+			}
+		}
+	}
+	switch c.Secrets.Provider {
+	case "env", "file", "vault", "aws":
+	default:
+		return fmt.Errorf("secrets.provider must be env, file, vault or aws")
+	}
+	return nil
+}
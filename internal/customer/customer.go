@@ -0,0 +1,339 @@
+// Package customer keeps saved customer profiles with an address book, so
+// repeat orders can name a customer_id and address_id instead of repeating
+// free-form names and addresses. Profiles are kept in memory and written
+// to a file when one is configured.
+package customer
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/pkg/models"
+)
+
+const maxAddresses = 50
+
+var (
+	ErrNotFound        = errors.New("customer not found")
+	ErrAddressNotFound = errors.New("address not found")
+	ErrExists          = errors.New("customer already exists")
+)
+
+// Address is one entry of a customer's address book.
+type Address struct {
+	ID      string `json:"id"`
+	Label   string `json:"label,omitempty"` // e.g. "home" or "office"
+	Address string `json:"address"`
+}
+
+// Profile is a saved customer. DefaultPriority and Notes apply to orders
+// that don't set their own. A profile belongs to the tenant that created
+// it, and only fills in that tenant's orders.
+type Profile struct {
+	ID               string          `json:"id"`
+	Tenant           string          `json:"tenant,omitempty"`
+	Name             string          `json:"name"`
+	Addresses        []Address       `json:"addresses"`
+	DefaultAddressID string          `json:"default_address_id,omitempty"`
+	DefaultPriority  models.Priority `json:"default_priority,omitempty"`
+	Notes            string          `json:"notes,omitempty"`
+	CreatedAt        time.Time       `json:"created_at"`
+	UpdatedAt        time.Time       `json:"updated_at"`
+}
+
+// Directory stores customer profiles. Methods taking a tenant only see
+// its profiles, or every profile for an empty tenant.
+type Directory struct {
+	path string
+
+	mu       sync.Mutex
+	profiles map[string]*Profile
+}
+
+// NewDirectory loads the profiles saved in path, if set.
+func NewDirectory(path string) (*Directory, error) {
+	d := &Directory{path: path, profiles: make(map[string]*Profile)}
+	if path == "" {
+		return d, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return d, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var profiles []*Profile
+	if err := json.Unmarshal(data, &profiles); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for _, p := range profiles {
+		d.profiles[p.ID] = p
+	}
+	return d, nil
+}
+
+// Create saves a new profile of p.Tenant. An ID is generated when p has
+// none, as are the IDs of its addresses.
+func (d *Directory) Create(p Profile) (Profile, error) {
+	if p.ID == "" {
+		p.ID = newID()
+	}
+	if err := p.normalize(); err != nil {
+		return Profile{}, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.profiles[p.ID]; ok {
+		return Profile{}, ErrExists
+	}
+	p.CreatedAt = time.Now()
+	p.UpdatedAt = p.CreatedAt
+	d.profiles[p.ID] = &p
+	d.save()
+	return p.copy(), nil
+}
+
+// Update replaces a profile's name, addresses and defaults.
+func (d *Directory) Update(tenant, id string, p Profile) (Profile, error) {
+	p.ID = id
+	if err := p.normalize(); err != nil {
+		return Profile{}, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	old, ok := d.get(tenant, id)
+	if !ok {
+		return Profile{}, ErrNotFound
+	}
+	p.Tenant, p.CreatedAt = old.Tenant, old.CreatedAt
+	p.UpdatedAt = time.Now()
+	d.profiles[id] = &p
+	d.save()
+	return p.copy(), nil
+}
+
+// AddAddress appends a to the customer's address book.
+func (d *Directory) AddAddress(tenant, id string, a Address) (Profile, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	old, ok := d.get(tenant, id)
+	if !ok {
+		return Profile{}, ErrNotFound
+	}
+	p := old.copy()
+	p.Addresses = append(p.Addresses, a)
+	if err := p.normalize(); err != nil {
+		return Profile{}, err
+	}
+	p.UpdatedAt = time.Now()
+	d.profiles[id] = &p
+	d.save()
+	return p.copy(), nil
+}
+
+// RemoveAddress drops an address, and clears it as the default.
+func (d *Directory) RemoveAddress(tenant, id, addressID string) (Profile, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	p, ok := d.get(tenant, id)
+	if !ok {
+		return Profile{}, ErrNotFound
+	}
+	i := slices.IndexFunc(p.Addresses, func(a Address) bool { return a.ID == addressID })
+	if i < 0 {
+		return Profile{}, ErrAddressNotFound
+	}
+	p.Addresses = slices.Delete(p.Addresses, i, i+1)
+	if p.DefaultAddressID == addressID {
+		p.DefaultAddressID = ""
+	}
+	p.UpdatedAt = time.Now()
+	d.save()
+	return p.copy(), nil
+}
+
+func (d *Directory) Delete(tenant, id string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.get(tenant, id); !ok {
+		return ErrNotFound
+	}
+	delete(d.profiles, id)
+	d.save()
+	return nil
+}
+
+func (d *Directory) Get(tenant, id string) (Profile, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	p, ok := d.get(tenant, id)
+	if !ok {
+		return Profile{}, ErrNotFound
+	}
+	return p.copy(), nil
+}
+
+// get must be called with d.mu held.
+func (d *Directory) get(tenant, id string) (*Profile, bool) {
+	p, ok := d.profiles[id]
+	if !ok || (tenant != "" && p.Tenant != tenant) {
+		return nil, false
+	}
+	return p, true
+}
+
+// List returns the tenant's profiles ordered by ID.
+func (d *Directory) List(tenant string) []Profile {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	list := make([]Profile, 0, len(d.profiles))
+	for _, p := range d.profiles {
+		if tenant == "" || p.Tenant == tenant {
+			list = append(list, p.copy())
+		}
+	}
+	slices.SortFunc(list, func(a, b Profile) int { return strings.Compare(a.ID, b.ID) })
+	return list
+}
+
+// Resolve fills a submitted order from the profile named by its
+// customer_id, which must belong to the order's tenant: the customer becomes the profile's name, the address comes
+// from address_id or else the default address, and the default priority
+// and notes apply when the order sets none. Orders without a customer_id
+// are left as they are. A nil Directory knows no customers.
+func (d *Directory) Resolve(o *models.Order) error {
+	o.CustomerID = strings.TrimSpace(o.CustomerID)
+	o.AddressID = strings.TrimSpace(o.AddressID)
+	if o.CustomerID == "" {
+		if o.AddressID != "" {
+			return models.NewFieldError("address_id", models.CodeAddressIDNeedsCustomer)
+		}
+		return nil
+	}
+	if d == nil {
+		return models.NewFieldError("customer_id", models.CodeUnknownCustomer, o.CustomerID)
+	}
+	d.mu.Lock()
+	profile, ok := d.profiles[o.CustomerID]
+	var p Profile
+	if ok {
+		p = profile.copy()
+	}
+	d.mu.Unlock()
+	if !ok || p.Tenant != o.Tenant {
+		return models.NewFieldError("customer_id", models.CodeUnknownCustomer, o.CustomerID)
+	}
+
+	o.Customer = p.Name
+	switch {
+	case o.AddressID != "":
+		a, ok := p.address(o.AddressID)
+		if !ok {
+			return models.NewFieldError("address_id", models.CodeUnknownAddress, o.AddressID)
+		}
+		o.Address = a.Address
+	case o.Address == "" && p.DefaultAddressID != "":
+		a, _ := p.address(p.DefaultAddressID)
+		o.AddressID, o.Address = a.ID, a.Address
+	}
+	if o.Priority == 0 {
+		o.Priority = p.DefaultPriority
+	}
+	if o.Notes == "" {
+		o.Notes = p.Notes
+	}
+	return nil
+}
+
+func (p *Profile) address(id string) (Address, bool) {
+	i := slices.IndexFunc(p.Addresses, func(a Address) bool { return a.ID == id })
+	if i < 0 {
+		return Address{}, false
+	}
+	return p.Addresses[i], true
+}
+
+// normalize trims p, assigns missing address IDs and checks the result.
+func (p *Profile) normalize() error {
+	p.ID = strings.TrimSpace(p.ID)
+	p.Name = strings.TrimSpace(p.Name)
+	p.Notes = strings.TrimSpace(p.Notes)
+	switch {
+	case p.Name == "":
+		return errors.New("name is required")
+	case p.DefaultPriority != 0 && !p.DefaultPriority.Valid():
+		return errors.New("default_priority must be 1-3")
+	case len(p.Addresses) > maxAddresses:
+		return fmt.Errorf("at most %d addresses are allowed", maxAddresses)
+	}
+	seen := make(map[string]bool, len(p.Addresses))
+	for i := range p.Addresses {
+		a := &p.Addresses[i]
+		a.ID = strings.TrimSpace(a.ID)
+		a.Label = strings.TrimSpace(a.Label)
+		a.Address = strings.TrimSpace(a.Address)
+		if a.ID == "" {
+			a.ID = newID()
+		}
+		if a.Address == "" {
+			return fmt.Errorf("address %s is empty", a.ID)
+		}
+		if seen[a.ID] {
+			return fmt.Errorf("duplicate address id %s", a.ID)
+		}
+		seen[a.ID] = true
+	}
+	if p.DefaultAddressID != "" && !seen[p.DefaultAddressID] {
+		return fmt.Errorf("default_address_id %s is not in addresses", p.DefaultAddressID)
+	}
+	return nil
+}
+
+func (p *Profile) copy() Profile {
+	c := *p
+	c.Addresses = slices.Clone(p.Addresses)
+	if c.Addresses == nil {
+		c.Addresses = []Address{}
+	}
+	return c
+}
+
+// save must be called with d.mu held. Write errors are logged; the
+// profiles stay in memory.
+func (d *Directory) save() {
+	if d.path == "" {
+		return
+	}
+	profiles := make([]*Profile, 0, len(d.profiles))
+	for _, p := range d.profiles {
+		profiles = append(profiles, p)
+	}
+	data, err := json.MarshalIndent(profiles, "", "  ")
+	if err == nil {
+		tmp := d.path + ".tmp"
+		if err = os.WriteFile(tmp, data, 0o600); err == nil {
+			err = os.Rename(tmp, d.path)
+		}
+	}
+	if err != nil {
+		log.Printf("customers: saving %s: %v", d.path, err)
+	}
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
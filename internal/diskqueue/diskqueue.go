@@ -0,0 +1,277 @@
+// Package diskqueue is a FIFO of byte records stored in append-only segment
+// files. Fully consumed segments are deleted and the read position is kept
+// in a cursor file, so records left on disk when the process stops are
+// delivered after Open.
+package diskqueue
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrFull is returned by Push when the queue holds its maximum records.
+var ErrFull = errors.New("disk queue is full")
+
+const (
+	segmentBytes = 8 << 20 // segments roll over after this size
+	headerSize   = 4       // big endian record length
+	segmentExt   = ".seg"
+	cursorFile   = "cursor" // first segment id and read offset, big endian
+)
+
+type Queue struct {
+	dir        string
+	maxRecords int
+
+	mu       sync.Mutex
+	segments []uint64 // oldest first; the last one is written to
+	w        *os.File
+	wSize    int64
+	r        *os.File
+	rOffset  int64
+	cursor   *os.File
+	count    int
+}
+
+// Open opens or creates the queue in dir, keeping at most maxRecords.
+func Open(dir string, maxRecords int) (*Queue, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	q := &Queue{dir: dir, maxRecords: maxRecords}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		id, err := strconv.ParseUint(strings.TrimSuffix(e.Name(), segmentExt), 10, 64)
+		if err == nil && strings.HasSuffix(e.Name(), segmentExt) {
+			q.segments = append(q.segments, id)
+		}
+	}
+	slices.Sort(q.segments)
+
+	if q.cursor, err = os.OpenFile(filepath.Join(dir, cursorFile), os.O_CREATE|os.O_RDWR, 0o600); err != nil {
+		return nil, err
+	}
+	var cursor [16]byte
+	if _, err := q.cursor.ReadAt(cursor[:], 0); err == nil && len(q.segments) > 0 &&
+		binary.BigEndian.Uint64(cursor[:8]) == q.segments[0] {
+		q.rOffset = int64(binary.BigEndian.Uint64(cursor[8:]))
+	}
+
+	for i, id := range q.segments {
+		var from int64
+		if i == 0 {
+			from = q.rOffset
+		}
+		n, size, err := scan(q.path(id), from)
+		if err != nil {
+			return nil, err
+		}
+		q.count += n
+		q.wSize = size
+	}
+	if len(q.segments) == 0 {
+		q.segments = []uint64{1}
+	}
+
+	last := q.path(q.segments[len(q.segments)-1])
+	if q.w, err = os.OpenFile(last, os.O_CREATE|os.O_WRONLY, 0o600); err != nil {
+		return nil, err
+	}
+	// Drop a record torn by a crash so appends start on a boundary.
+	if err := q.w.Truncate(q.wSize); err != nil {
+		return nil, err
+	}
+	if _, err := q.w.Seek(q.wSize, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if q.r, err = os.Open(q.path(q.segments[0])); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// scan counts the complete records in a segment from offset from and
+// returns the size of the segment up to the last of them.
+func scan(path string, from int64) (int, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	st, err := f.Stat()
+	if err != nil {
+		return 0, 0, err
+	}
+	if from > st.Size() {
+		return 0, 0, fmt.Errorf("cursor is beyond the end of %s", path)
+	}
+
+	var n int
+	off := from
+	var header [headerSize]byte
+	for {
+		if _, err := f.ReadAt(header[:], off); err != nil {
+			return n, off, nil
+		}
+		next := off + headerSize + int64(binary.BigEndian.Uint32(header[:]))
+		if next > st.Size() {
+			return n, off, nil
+		}
+		n++
+		off = next
+	}
+}
+
+func (q *Queue) path(id uint64) string {
+	return filepath.Join(q.dir, fmt.Sprintf("%020d%s", id, segmentExt))
+}
+
+// Push appends a record.
+func (q *Queue) Push(record []byte) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.maxRecords > 0 && q.count >= q.maxRecords {
+		return ErrFull
+	}
+	if q.wSize >= segmentBytes {
+		if err := q.roll(); err != nil {
+			return err
+		}
+	}
+
+	buf := make([]byte, headerSize+len(record))
+	binary.BigEndian.PutUint32(buf, uint32(len(record)))
+	copy(buf[headerSize:], record)
+	if _, err := q.w.Write(buf); err != nil {
+		return err
+	}
+	q.wSize += int64(len(buf))
+	q.count++
+	return nil
+}
+
+func (q *Queue) roll() error {
+	id := q.segments[len(q.segments)-1] + 1
+	w, err := os.OpenFile(q.path(id), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	if err := q.w.Close(); err != nil {
+		w.Close()
+		return err
+	}
+	q.w, q.wSize = w, 0
+	q.segments = append(q.segments, id)
+	return nil
+}
+
+// Pop removes and returns the oldest record. ok is false when the queue is
+// empty. A record may be returned together with an error from saving the
+// read position.
+func (q *Queue) Pop() (record []byte, ok bool, err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.count == 0 {
+		return nil, false, nil
+	}
+
+	var header [headerSize]byte
+	for {
+		_, err := q.r.ReadAt(header[:], q.rOffset)
+		if err == nil {
+			break
+		}
+		if err != io.EOF || len(q.segments) == 1 {
+			return nil, false, err
+		}
+		// The oldest segment is exhausted; delete it and move on.
+		if err := q.advance(); err != nil {
+			return nil, false, err
+		}
+	}
+
+	record = make([]byte, binary.BigEndian.Uint32(header[:]))
+	if _, err := q.r.ReadAt(record, q.rOffset+headerSize); err != nil {
+		return nil, false, err
+	}
+	q.rOffset += headerSize + int64(len(record))
+	q.count--
+	return record, true, q.saveCursor()
+}
+
+func (q *Queue) saveCursor() error {
+	var cursor [16]byte
+	binary.BigEndian.PutUint64(cursor[:8], q.segments[0])
+	binary.BigEndian.PutUint64(cursor[8:], uint64(q.rOffset))
+	_, err := q.cursor.WriteAt(cursor[:], 0)
+	return err
+}
+
+func (q *Queue) advance() error {
+	done := q.path(q.segments[0])
+	r, err := os.Open(q.path(q.segments[1]))
+	if err != nil {
+		return err
+	}
+	q.r.Close()
+	q.r, q.rOffset = r, 0
+	q.segments = q.segments[1:]
+	return os.Remove(done)
+}
+
+// Each calls fn with every record on disk, oldest first, without removing
+// them.
+func (q *Queue) Each(fn func(record []byte)) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i, id := range q.segments {
+		var from int64
+		if i == 0 {
+			from = q.rOffset
+		}
+		data, err := os.ReadFile(q.path(id))
+		if err != nil {
+			return err
+		}
+		for off := from; off+headerSize <= int64(len(data)); {
+			next := off + headerSize + int64(binary.BigEndian.Uint32(data[off:]))
+			if next > int64(len(data)) {
+				break // torn or still being written
+			}
+			fn(data[off+headerSize : next])
+			off = next
+		}
+	}
+	return nil
+}
+
+// Len returns the number of records on disk.
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.count
+}
+
+// Cap returns the maximum number of records, or 0 if unlimited.
+func (q *Queue) Cap() int {
+	return q.maxRecords
+}
+
+func (q *Queue) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return errors.Join(q.r.Close(), q.w.Close(), q.cursor.Close())
+}
@@ -0,0 +1,320 @@
+// Package enrich joins orders against reference datasets, such as
+// customer tiers, region codes or product metadata, and copies the
+// matching attributes into the order's tags at submission, so routes,
+// quarantine rules, validators and steps can use them like any tag.
+// A dataset is a file loaded whole and reloaded when it changes, or an
+// API looked up per key with a cache.
+package enrich
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/pkg/models"
+)
+
+// maxCached is how many keys an API dataset caches.
+const maxCached = 10000
+
+// Dataset describes one reference dataset. Key selects what orders are
+// looked up by: "customer", "customer_id", "tenant", "item" or
+// "tag:<name>". Tags maps the attributes to copy to the tag names they
+// are copied to; other attributes are ignored. Exactly one of File and
+// URL is set.
+type Dataset struct {
+	Name string
+	Key  string
+	Tags map[string]string
+
+	// File holds a JSON object of attributes by key, and is checked for
+	// changes every Reload.
+	File   string
+	Reload time.Duration
+
+	// URL is looked up per key, with "{key}" replaced by it; it answers
+	// a JSON object of attributes, or 404. Answers are cached for TTL.
+	URL    string
+	Token  func() string // bearer token; nil sends none
+	TTL    time.Duration
+	Client *http.Client
+}
+
+// Stats describes a dataset's lookups.
+type Stats struct {
+	Name      string    `json:"name"`
+	Entries   int       `json:"entries"` // loaded from the file, or cached
+	Hits      uint64    `json:"hits"`
+	Misses    uint64    `json:"misses"`
+	Errors    uint64    `json:"errors"`
+	LastLoad  time.Time `json:"last_load,omitzero"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+type cached struct {
+	attrs   map[string]string // nil if the API had no entry
+	fetched time.Time
+}
+
+type dataset struct {
+	cfg Dataset
+
+	mu      sync.Mutex
+	entries map[string]map[string]string // file datasets
+	modTime time.Time
+	cache   map[string]cached // API datasets
+	stats   Stats
+}
+
+// Enricher applies datasets in order; a later dataset overwrites the
+// tags of an earlier one. Methods on a nil Enricher do nothing.
+type Enricher struct {
+	datasets []*dataset
+}
+
+// New loads the file datasets. An unreadable file is an error.
+func New(datasets []Dataset) (*Enricher, error) {
+	e := &Enricher{}
+	for _, cfg := range datasets {
+		d := &dataset{cfg: cfg, cache: make(map[string]cached), stats: Stats{Name: cfg.Name}}
+		if cfg.File != "" {
+			if err := d.load(); err != nil {
+				return nil, fmt.Errorf("dataset %s: %w", cfg.Name, err)
+			}
+		}
+		e.datasets = append(e.datasets, d)
+	}
+	return e, nil
+}
+
+// Run reloads changed files until ctx is done.
+func (e *Enricher) Run(ctx context.Context) {
+	if e == nil {
+		return
+	}
+	var wg sync.WaitGroup
+	for _, d := range e.datasets {
+		if d.cfg.File == "" {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ticker := time.NewTicker(d.cfg.Reload)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+				if err := d.load(); err != nil {
+					// Keep enriching from the last good copy.
+					log.Printf("enrich %s: reload: %v", d.cfg.Name, err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// load reads the file if it changed since the last load.
+func (d *dataset) load() error {
+	info, err := os.Stat(d.cfg.File)
+	if err != nil {
+		d.failed(err)
+		return err
+	}
+	d.mu.Lock()
+	unchanged := info.ModTime().Equal(d.modTime)
+	d.mu.Unlock()
+	if unchanged {
+		return nil
+	}
+	data, err := os.ReadFile(d.cfg.File)
+	if err != nil {
+		d.failed(err)
+		return err
+	}
+	var entries map[string]map[string]string
+	if err := json.Unmarshal(data, &entries); err != nil {
+		err = fmt.Errorf("%s: %w", d.cfg.File, err)
+		d.failed(err)
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.entries, d.modTime = entries, info.ModTime()
+	d.stats.Entries = len(entries)
+	d.stats.LastLoad = time.Now()
+	d.stats.LastError = ""
+	return nil
+}
+
+// Enrich copies the attributes matching o into its tags. Tags a dataset
+// sets are removed first, so clients can't supply them. A failed lookup
+// leaves the dataset's tags out; it never fails the order.
+func (e *Enricher) Enrich(ctx context.Context, o *models.Order) {
+	if e == nil {
+		return
+	}
+	for _, d := range e.datasets {
+		for _, tag := range d.cfg.Tags {
+			delete(o.Tags, tag)
+		}
+		values := make(map[string][]string)
+		for _, key := range d.keys(o) {
+			attrs := d.lookup(ctx, key)
+			for attr, tag := range d.cfg.Tags {
+				if v, ok := attrs[attr]; ok && v != "" && !slices.Contains(values[tag], v) {
+					values[tag] = append(values[tag], v)
+				}
+			}
+		}
+		for tag, vs := range values {
+			if o.Tags == nil {
+				o.Tags = make(map[string]string)
+			}
+			// Items can match several entries; their values are listed.
+			slices.Sort(vs)
+			o.Tags[tag] = strings.Join(vs, ",")
+		}
+	}
+}
+
+// keys returns what o is looked up by.
+func (d *dataset) keys(o *models.Order) []string {
+	var keys []string
+	switch d.cfg.Key {
+	case "customer":
+		keys = []string{o.Customer}
+	case "customer_id":
+		keys = []string{o.CustomerID}
+	case "tenant":
+		keys = []string{o.Tenant}
+	case "item":
+		keys = o.Items
+	default:
+		keys = []string{o.Tags[strings.TrimPrefix(d.cfg.Key, "tag:")]}
+	}
+	return slices.DeleteFunc(slices.Clone(keys), func(k string) bool { return k == "" })
+}
+
+func (d *dataset) lookup(ctx context.Context, key string) map[string]string {
+	var attrs map[string]string
+	if d.cfg.File != "" {
+		d.mu.Lock()
+		attrs = d.entries[key]
+		d.mu.Unlock()
+	} else {
+		attrs = d.fetch(ctx, key)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if attrs == nil {
+		d.stats.Misses++
+	} else {
+		d.stats.Hits++
+	}
+	return attrs
+}
+
+// fetch returns key's attributes from the cache or the API. When the API
+// fails, a stale cached answer is used if there is one.
+func (d *dataset) fetch(ctx context.Context, key string) map[string]string {
+	d.mu.Lock()
+	c, ok := d.cache[key]
+	d.mu.Unlock()
+	if ok && time.Since(c.fetched) < d.cfg.TTL {
+		return c.attrs
+	}
+	attrs, err := d.get(ctx, key)
+	if err != nil {
+		log.Printf("enrich %s: lookup %q: %v", d.cfg.Name, key, err)
+		d.failed(err)
+		return c.attrs
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.cache[key]; !ok && len(d.cache) >= maxCached {
+		d.evict()
+	}
+	d.cache[key] = cached{attrs: attrs, fetched: time.Now()}
+	d.stats.Entries = len(d.cache)
+	return attrs
+}
+
+// evict drops the oldest cached answer. It must be called with d.mu held.
+func (d *dataset) evict() {
+	var oldest string
+	var at time.Time
+	for key, c := range d.cache {
+		if at.IsZero() || c.fetched.Before(at) {
+			oldest, at = key, c.fetched
+		}
+	}
+	delete(d.cache, oldest)
+}
+
+func (d *dataset) get(ctx context.Context, key string) (map[string]string, error) {
+	u := strings.ReplaceAll(d.cfg.URL, "{key}", url.PathEscape(key))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if d.cfg.Token != nil {
+		req.Header.Set("Authorization", "Bearer "+d.cfg.Token())
+	}
+	resp, err := d.cfg.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("%s returned %s: %s", d.cfg.Name, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	var attrs map[string]string
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&attrs); err != nil {
+		return nil, fmt.Errorf("decode answer: %w", err)
+	}
+	if attrs == nil {
+		return nil, errors.New("answer is not an object")
+	}
+	return attrs, nil
+}
+
+func (d *dataset) failed(err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.stats.Errors++
+	d.stats.LastError = err.Error()
+}
+
+// Stats lists the datasets in the order they are applied.
+func (e *Enricher) Stats() []Stats {
+	if e == nil {
+		return []Stats{}
+	}
+	out := make([]Stats, 0, len(e.datasets))
+	for _, d := range e.datasets {
+		d.mu.Lock()
+		out = append(out, d.stats)
+		d.mu.Unlock()
+	}
+	return out
+}
@@ -0,0 +1,234 @@
+// Package eventbus keeps a durable log of result events and a cursor per
+// named subscriber. Subscribers read events after their cursor and ack them
+// once handled, so a consumer that restarts resumes where it left off and
+// gets every event at least once.
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/pkg/models"
+)
+
+// ErrUnknownSubscriber is returned by Ack for a name that never read.
+var ErrUnknownSubscriber = errors.New("unknown subscriber")
+
+// Event is one processed order result with its position in the log.
+type Event struct {
+	Seq    uint64                `json:"seq"`
+	Time   time.Time             `json:"time"`
+	Result models.ProcessedOrder `json:"result"`
+}
+
+// Batch is the result of a read. Skipped counts events the subscriber
+// missed because they aged out of retention before it read them.
+type Batch struct {
+	Events  []Event `json:"events"`
+	Skipped uint64  `json:"skipped"`
+}
+
+// SubscriberInfo describes a subscriber's position.
+type SubscriberInfo struct {
+	Name  string `json:"name"`
+	Acked uint64 `json:"acked"`
+	Lag   uint64 `json:"lag"`
+}
+
+type Bus struct {
+	storage Storage
+	retain  int
+
+	mu       sync.Mutex
+	events   []Event // the last retain events, oldest first
+	next     uint64
+	cursors  map[string]uint64 // last acked seq per subscriber
+	stored   int               // events in storage, including ones no longer retained
+	appended chan struct{}     // closed and replaced on every publish
+}
+
+// Storage persists the log and the cursors. Files, the default, keeps
+// them in a directory; other backends, such as an embedded database,
+// implement Storage too.
+type Storage interface {
+	// Load returns the stored events, oldest first, and the cursors.
+	Load() ([]Event, map[string]uint64, error)
+	Append(ev Event) error
+	// Rewrite replaces the stored events with events.
+	Rewrite(events []Event) error
+	SaveCursors(cursors map[string]uint64) error
+	Close() error
+}
+
+// Open loads the bus from files in dir, creating it if needed, and keeps
+// the last retain events.
+func Open(dir string, retain int) (*Bus, error) {
+	storage, err := OpenFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	return New(storage, retain)
+}
+
+// New loads the bus from storage and keeps the last retain events.
+func New(storage Storage, retain int) (*Bus, error) {
+	events, cursors, err := storage.Load()
+	if err != nil {
+		return nil, err
+	}
+	b := &Bus{
+		storage:  storage,
+		retain:   retain,
+		next:     1,
+		cursors:  cursors,
+		stored:   len(events),
+		appended: make(chan struct{}),
+	}
+	if b.cursors == nil {
+		b.cursors = make(map[string]uint64)
+	}
+	if n := len(events); n > 0 {
+		b.next = events[n-1].Seq + 1
+	}
+	b.events = events[max(len(events)-retain, 0):]
+	return b, nil
+}
+
+// Publish appends a result to the log and wakes waiting readers.
+func (b *Bus) Publish(result models.ProcessedOrder) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ev := Event{Seq: b.next, Time: time.Now(), Result: result}
+	if err := b.storage.Append(ev); err != nil {
+		return err
+	}
+	b.next++
+	b.stored++
+	b.events = append(b.events, ev)
+	if len(b.events) > b.retain {
+		b.events = b.events[len(b.events)-b.retain:]
+	}
+	close(b.appended)
+	b.appended = make(chan struct{})
+
+	if b.stored > 2*b.retain {
+		return b.compact()
+	}
+	return nil
+}
+
+// Expire deletes the events for which expired returns true, such as those
+// past a retention period, and reports how many it deleted. Deleted
+// events are no longer delivered, even to subscribers that hadn't read
+// them yet.
+func (b *Bus) Expire(expired func(Event) bool) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	n := len(b.events)
+	b.events = slices.DeleteFunc(b.events, expired)
+	if n -= len(b.events); n == 0 {
+		return 0, nil
+	}
+	return n, b.compact()
+}
+
+// compact drops the events that are no longer retained from storage.
+func (b *Bus) compact() error {
+	if err := b.storage.Rewrite(b.events); err != nil {
+		return err
+	}
+	b.stored = len(b.events)
+	return nil
+}
+
+// Read returns up to max events after subscriber's cursor, waiting until
+// at least one is available or ctx is done. A new subscriber starts at the
+// end of the log and only sees events published from then on.
+func (b *Bus) Read(ctx context.Context, subscriber string, max int) (Batch, error) {
+	b.mu.Lock()
+	if _, ok := b.cursors[subscriber]; !ok {
+		b.cursors[subscriber] = b.next - 1
+		if err := b.storage.SaveCursors(b.cursors); err != nil {
+			b.mu.Unlock()
+			return Batch{}, err
+		}
+	}
+	for {
+		batch := b.after(b.cursors[subscriber], max)
+		if len(batch.Events) > 0 || batch.Skipped > 0 {
+			b.mu.Unlock()
+			return batch, nil
+		}
+		wait := b.appended
+		b.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return Batch{}, nil
+		case <-wait:
+		}
+		b.mu.Lock()
+	}
+}
+
+// after must be called with b.mu held.
+func (b *Bus) after(cursor uint64, max int) Batch {
+	var batch Batch
+	i := sort.Search(len(b.events), func(i int) bool { return b.events[i].Seq > cursor })
+	if i < len(b.events) && b.events[i].Seq > cursor+1 {
+		batch.Skipped = b.events[i].Seq - cursor - 1
+	}
+	end := min(i+max, len(b.events))
+	batch.Events = append([]Event(nil), b.events[i:end]...)
+	return batch
+}
+
+// Ack moves subscriber's cursor to seq. Acks never move a cursor back.
+func (b *Bus) Ack(subscriber string, seq uint64) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	cursor, ok := b.cursors[subscriber]
+	if !ok {
+		return ErrUnknownSubscriber
+	}
+	if seq <= cursor {
+		return nil
+	}
+	b.cursors[subscriber] = min(seq, b.next-1)
+	return b.storage.SaveCursors(b.cursors)
+}
+
+// Remove forgets subscriber's cursor; reading under its name again starts
+// at the end of the log.
+func (b *Bus) Remove(subscriber string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.cursors[subscriber]; !ok {
+		return ErrUnknownSubscriber
+	}
+	delete(b.cursors, subscriber)
+	return b.storage.SaveCursors(b.cursors)
+}
+
+// Subscribers lists every subscriber with its position, by name.
+func (b *Bus) Subscribers() []SubscriberInfo {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	subs := make([]SubscriberInfo, 0, len(b.cursors))
+	for name, acked := range b.cursors {
+		subs = append(subs, SubscriberInfo{Name: name, Acked: acked, Lag: b.next - 1 - acked})
+	}
+	sort.Slice(subs, func(i, j int) bool { return subs[i].Name < subs[j].Name })
+	return subs
+}
+
+func (b *Bus) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.storage.Close()
+}
@@ -0,0 +1,133 @@
+package eventbus
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+const (
+	logFile     = "events.log"
+	cursorsFile = "cursors.json"
+)
+
+// Files stores the log as JSON lines and the cursors as a JSON object in
+// a directory.
+type Files struct {
+	dir string
+	log *os.File
+}
+
+// OpenFiles opens the storage in dir, creating it if needed.
+func OpenFiles(dir string) (*Files, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &Files{dir: dir}, nil
+}
+
+func (f *Files) Load() ([]Event, map[string]uint64, error) {
+	cursors := make(map[string]uint64)
+	if data, err := os.ReadFile(filepath.Join(f.dir, cursorsFile)); err == nil {
+		if err := json.Unmarshal(data, &cursors); err != nil {
+			return nil, nil, err
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, nil, err
+	}
+
+	events, torn, err := f.read()
+	if err != nil {
+		return nil, nil, err
+	}
+	f.log, err = os.OpenFile(filepath.Join(f.dir, logFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, nil, err
+	}
+	if torn {
+		// Rewrite so new events aren't appended after the broken line.
+		if err := f.Rewrite(events); err != nil {
+			return nil, nil, err
+		}
+	}
+	return events, cursors, nil
+}
+
+// read reads the log and reports whether it ended in a torn line.
+func (f *Files) read() (events []Event, torn bool, err error) {
+	file, err := os.Open(filepath.Join(f.dir, logFile))
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var ev Event
+		if err := json.Unmarshal(scanner.Bytes(), &ev); err != nil {
+			return events, true, nil // torn last line after a crash
+		}
+		events = append(events, ev)
+	}
+	return events, false, scanner.Err()
+}
+
+func (f *Files) Append(ev Event) error {
+	line, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	_, err = f.log.Write(append(line, '\n'))
+	return err
+}
+
+// Rewrite replaces the log atomically.
+func (f *Files) Rewrite(events []Event) error {
+	tmp := filepath.Join(f.dir, logFile+".tmp")
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(file)
+	enc := json.NewEncoder(w)
+	for _, ev := range events {
+		if err := enc.Encode(ev); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	if err := errors.Join(w.Flush(), file.Close()); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(f.dir, logFile)); err != nil {
+		return err
+	}
+	f.log.Close()
+	f.log, err = os.OpenFile(filepath.Join(f.dir, logFile), os.O_WRONLY|os.O_APPEND, 0o600)
+	return err
+}
+
+func (f *Files) SaveCursors(cursors map[string]uint64) error {
+	data, err := json.Marshal(cursors)
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(f.dir, cursorsFile+".tmp")
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(f.dir, cursorsFile))
+}
+
+func (f *Files) Close() error {
+	if f.log == nil {
+		return nil
+	}
+	return f.log.Close()
+}
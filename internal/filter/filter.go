@@ -0,0 +1,253 @@
+// Package filter parses the expressions operators use to select orders,
+// such as
+//
+//	customer = "acme" and priority >= 2 and tag.region = eu
+//
+// An expression is one or more comparisons joined by "and". Values may be
+// quoted with single or double quotes when they contain spaces.
+package filter
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/pkg/models"
+)
+
+type kind int
+
+const (
+	text kind = iota
+	number
+	money
+	timestamp
+	list
+)
+
+// fields are the order fields an expression can compare; tag.<key> is
+// accepted as well.
+var fields = map[string]kind{
+	"id":              text,
+	"customer":        text,
+	"customer_id":     text,
+	"status":          text,
+	"address":         text,
+	"tenant":          text,
+	"subscription_id": text,
+	"parent_id":       text,
+	"derivation":      text,
+	"credit_account":  text,
+	"priority":        number,
+	"amount":          money,
+	"created_at":      timestamp,
+	"item":            list,
+}
+
+// operators are matched in order, so two-character ones come first.
+var operators = []string{"!=", ">=", "<=", "=", ">", "<"}
+
+type cond struct {
+	field string
+	kind  kind
+	op    string
+	value string
+	num   int64
+	at    time.Time
+}
+
+// Filter is a parsed expression. The zero Filter matches every order.
+type Filter struct {
+	conds []cond
+}
+
+// Parse reads expr. extra names additional text fields, such as the
+// pipeline, that are passed to Match alongside the order.
+func Parse(expr string, extra ...string) (Filter, error) {
+	var f Filter
+	if strings.TrimSpace(expr) == "" {
+		return f, fmt.Errorf("empty filter")
+	}
+	for _, clause := range splitAnd(expr) {
+		c, err := parseCond(clause, extra)
+		if err != nil {
+			return Filter{}, err
+		}
+		f.conds = append(f.conds, c)
+	}
+	return f, nil
+}
+
+// splitAnd splits on the word "and" outside quotes.
+func splitAnd(expr string) []string {
+	var clauses []string
+	var quote rune
+	start := 0
+	for i, r := range expr {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case i > start && (r == 'a' || r == 'A') && strings.EqualFold(wordAt(expr, i), "and") && isSpace(expr, i-1):
+			clauses = append(clauses, expr[start:i])
+			start = i + 3
+		}
+	}
+	return append(clauses, expr[start:])
+}
+
+func wordAt(s string, i int) string {
+	end := i
+	for end < len(s) && s[end] != ' ' && s[end] != '\t' {
+		end++
+	}
+	if end == len(s) {
+		return "" // "and" at the end is a value, not a separator
+	}
+	return s[i:end]
+}
+
+func isSpace(s string, i int) bool {
+	return s[i] == ' ' || s[i] == '\t'
+}
+
+func parseCond(clause string, extra []string) (cond, error) {
+	clause = strings.TrimSpace(clause)
+	i := strings.IndexAny(clause, "!=<>")
+	if i <= 0 {
+		return cond{}, fmt.Errorf("%q is not a comparison", clause)
+	}
+	op := ""
+	for _, candidate := range operators {
+		if strings.HasPrefix(clause[i:], candidate) {
+			op = candidate
+			break
+		}
+	}
+	if op == "" {
+		return cond{}, fmt.Errorf("%q is not a comparison", clause)
+	}
+	c := cond{
+		field: strings.TrimSpace(clause[:i]),
+		op:    op,
+		value: unquote(strings.TrimSpace(clause[i+len(op):])),
+	}
+	k, ok := fields[c.field]
+	switch {
+	case ok:
+	case strings.HasPrefix(c.field, "tag.") && len(c.field) > len("tag."):
+		k = text
+	case slices.Contains(extra, c.field):
+		k = text
+	default:
+		return cond{}, fmt.Errorf("unknown field %q", c.field)
+	}
+	c.kind = k
+	return c, c.parseValue()
+}
+
+func (c *cond) parseValue() error {
+	ordered := c.op != "=" && c.op != "!="
+	var err error
+	switch c.kind {
+	case number:
+		c.num, err = strconv.ParseInt(c.value, 10, 64)
+	case money:
+		var m models.Money
+		m, err = models.ParseMoney(c.value)
+		c.num = int64(m)
+	case timestamp:
+		c.at, err = time.Parse(time.RFC3339, c.value)
+	default:
+		if ordered {
+			return fmt.Errorf("%s only supports = and !=", c.field)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("invalid value for %s: %q", c.field, c.value)
+	}
+	return nil
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// Match reports whether the order satisfies every comparison. attrs holds
+// the values of the extra fields given to Parse.
+func (f Filter) Match(o models.Order, attrs map[string]string) bool {
+	for _, c := range f.conds {
+		if !c.match(o, attrs) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c cond) match(o models.Order, attrs map[string]string) bool {
+	switch c.kind {
+	case number:
+		return compare(int64(o.Priority), c.num, c.op)
+	case money:
+		return compare(int64(o.Amount), c.num, c.op)
+	case timestamp:
+		return compare(o.CreatedAt.UnixNano(), c.at.UnixNano(), c.op)
+	case list:
+		return slices.Contains(o.Items, c.value) == (c.op == "=")
+	}
+	var v string
+	switch c.field {
+	case "id":
+		v = o.ID
+	case "customer":
+		v = o.Customer
+	case "customer_id":
+		v = o.CustomerID
+	case "status":
+		v = string(o.Status)
+	case "address":
+		v = o.Address
+	case "tenant":
+		v = o.Tenant
+	case "subscription_id":
+		v = o.SubscriptionID
+	case "parent_id":
+		v = o.ParentID
+	case "derivation":
+		v = o.Derivation
+	case "credit_account":
+		v = o.CreditAccount
+	default:
+		if key, ok := strings.CutPrefix(c.field, "tag."); ok {
+			v = o.Tags[key]
+		} else {
+			v = attrs[c.field]
+		}
+	}
+	return (v == c.value) == (c.op == "=")
+}
+
+func compare(a, b int64, op string) bool {
+	switch op {
+	case "=":
+		return a == b
+	case "!=":
+		return a != b
+	case ">":
+		return a > b
+	case ">=":
+		return a >= b
+	case "<":
+		return a < b
+	default:
+		return a <= b
+	}
+}
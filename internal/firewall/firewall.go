@@ -0,0 +1,218 @@
+package firewall
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"regexp"
+	"strings"
+	"sync/atomic"
+
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/problem"
+)
+
+// Rules is a compiled set of IP filters and request rules.
+type Rules struct {
+	allow          []netip.Prefix
+	deny           []netip.Prefix
+	trustedProxies []netip.Prefix
+	userAgents     []*regexp.Regexp
+	paths          []*regexp.Regexp
+	payloads       []*regexp.Regexp
+	inspectBytes   int64
+
+	blocked atomic.Int64
+}
+
+// Config lists the raw rules. IPs may be single addresses or CIDRs and the
+// remaining rules are regular expressions.
+type Config struct {
+	Allow           []string
+	Deny            []string
+	TrustedProxies  []string
+	BlockUserAgents []string
+	BlockPaths      []string
+	BlockPayloads   []string
+	InspectBytes    int64
+}
+
+func New(cfg Config) (*Rules, error) {
+	r := &Rules{inspectBytes: cfg.InspectBytes}
+	var err error
+	if r.allow, err = parsePrefixes(cfg.Allow); err != nil {
+		return nil, fmt.Errorf("allow: %w", err)
+	}
+	if r.deny, err = parsePrefixes(cfg.Deny); err != nil {
+		return nil, fmt.Errorf("deny: %w", err)
+	}
+	if r.trustedProxies, err = parsePrefixes(cfg.TrustedProxies); err != nil {
+		return nil, fmt.Errorf("trusted_proxies: %w", err)
+	}
+	if r.userAgents, err = compile(cfg.BlockUserAgents); err != nil {
+		return nil, fmt.Errorf("block_user_agents: %w", err)
+	}
+	if r.paths, err = compile(cfg.BlockPaths); err != nil {
+		return nil, fmt.Errorf("block_paths: %w", err)
+	}
+	if r.payloads, err = compile(cfg.BlockPayloads); err != nil {
+		return nil, fmt.Errorf("block_payloads: %w", err)
+	}
+	if r.inspectBytes <= 0 {
+		r.inspectBytes = 64 << 10
+	}
+	return r, nil
+}
+
+// Blocked returns how many requests have been rejected.
+func (r *Rules) Blocked() int64 {
+	return r.blocked.Load()
+}
+
+// Middleware rejects requests that fail any rule with 403. Passed
+// requests carry their client IP for ClientIP.
+func (r *Rules) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ip := r.clientIP(req)
+		if reason := r.check(req, ip); reason != "" {
+			r.blocked.Add(1)
+			log.Printf("firewall: blocked %s %s from %s: %s", req.Method, req.URL.Path, ip, reason)
+			problem.Error(w, req, "forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), clientIPKey{}, ip)))
+	})
+}
+
+type clientIPKey struct{}
+
+// ClientIP returns the client IP the middleware resolved, or else the
+// connection's address. It is empty for a Unix socket without a proxy.
+func ClientIP(req *http.Request) string {
+	if ip, ok := req.Context().Value(clientIPKey{}).(netip.Addr); ok {
+		if ip.IsValid() {
+			return ip.String()
+		}
+		return ""
+	}
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
+func (r *Rules) check(req *http.Request, ip netip.Addr) string {
+	if len(r.allow) > 0 && !contains(r.allow, ip) {
+		return "ip not in allowlist"
+	}
+	if contains(r.deny, ip) {
+		return "ip in denylist"
+	}
+	if matchAny(r.userAgents, req.UserAgent()) {
+		return "user agent blocked"
+	}
+	if matchAny(r.paths, req.URL.Path) {
+		return "path blocked"
+	}
+	if len(r.payloads) > 0 && req.Body != nil {
+		// Inspect the head of the body and put it back for the handler.
+		head, err := io.ReadAll(io.LimitReader(req.Body, r.inspectBytes))
+		if err != nil {
+			return "unreadable body"
+		}
+		req.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(head), req.Body), req.Body}
+		for _, re := range r.payloads {
+			if re.Match(head) {
+				return "payload signature matched"
+			}
+		}
+	}
+	return ""
+}
+
+// clientIP uses the connection address, or the right-most untrusted entry
+// of X-Forwarded-For when the connection comes from a trusted proxy.
+// Connections without an IP, i.e. over a Unix socket, come from a local
+// proxy and are always trusted.
+func (r *Rules) clientIP(req *http.Request) netip.Addr {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	ip, _ := netip.ParseAddr(host)
+	ip = ip.Unmap()
+
+	if ip.IsValid() && !contains(r.trustedProxies, ip) {
+		return ip
+	}
+	hops := strings.Split(req.Header.Get("X-Forwarded-For"), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		ip = hop.Unmap()
+		if !contains(r.trustedProxies, ip) {
+			break
+		}
+	}
+	return ip
+}
+
+func parsePrefixes(values []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(values))
+	for _, v := range values {
+		if !strings.Contains(v, "/") {
+			addr, err := netip.ParseAddr(v)
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		p, err := netip.ParsePrefix(v)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, p.Masked())
+	}
+	return prefixes, nil
+}
+
+func compile(patterns []string) ([]*regexp.Regexp, error) {
+	res := make([]*regexp.Regexp, 0, len(patterns))
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
+
+func contains(prefixes []netip.Prefix, ip netip.Addr) bool {
+	for _, p := range prefixes {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchAny(res []*regexp.Regexp, s string) bool {
+	for _, re := range res {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
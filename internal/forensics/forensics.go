@@ -0,0 +1,219 @@
+// Package forensics captures profiles automatically when order latency or
+// failures spike, so incidents leave evidence even if nobody was watching.
+// Each capture stores a goroutine dump taken at the breach, a CPU profile
+// of the seconds after it, and what triggered it.
+package forensics
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"path"
+	"runtime/pprof"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/blobstore"
+)
+
+const (
+	prefix = "captures/"
+
+	// maxSamples bounds the latencies kept per check interval; the p99 of
+	// busier intervals is taken from the first maxSamples orders.
+	maxSamples = 10000
+)
+
+type Config struct {
+	P99       time.Duration // end-to-end p99 that triggers a capture; zero disables
+	ErrorRate float64       // failure rate that triggers a capture; zero disables
+	// MinSamples is how many orders an interval needs before it is judged.
+	MinSamples  int
+	CheckEvery  time.Duration
+	MinGap      time.Duration // at most one capture per MinGap
+	CPUDuration time.Duration
+	Keep        int // captures kept; older ones are deleted
+}
+
+// Capture describes one stored capture. Files are keys in the store.
+type Capture struct {
+	ID        string    `json:"id"`
+	At        time.Time `json:"at"`
+	Reason    string    `json:"reason"`
+	P99Ms     int64     `json:"p99_ms"`
+	ErrorRate float64   `json:"error_rate"`
+	Samples   int       `json:"samples"`
+	Error     string    `json:"error,omitempty"` // a profile that couldn't be taken
+	Files     []string  `json:"files"`
+}
+
+type Watcher struct {
+	store blobstore.Store
+	cfg   Config
+
+	mu        sync.Mutex
+	latencies []time.Duration
+	total     int
+	failed    int
+	last      time.Time
+}
+
+func NewWatcher(store blobstore.Store, cfg Config) *Watcher {
+	return &Watcher{store: store, cfg: cfg}
+}
+
+// Observe counts one terminal order outcome.
+func (w *Watcher) Observe(success bool, endToEnd time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.total++
+	if !success {
+		w.failed++
+	}
+	if len(w.latencies) < maxSamples {
+		w.latencies = append(w.latencies, endToEnd)
+	}
+}
+
+// Run judges each interval until ctx is done, capturing when it breaches a
+// threshold and the last capture is at least MinGap old.
+func (w *Watcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.cfg.CheckEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		w.mu.Lock()
+		latencies, total, failed := w.latencies, w.total, w.failed
+		w.latencies, w.total, w.failed = nil, 0, 0
+		due := time.Since(w.last) >= w.cfg.MinGap
+		w.mu.Unlock()
+
+		if total < w.cfg.MinSamples || total == 0 || !due {
+			continue
+		}
+		slices.Sort(latencies)
+		c := Capture{
+			P99Ms:     latencies[(len(latencies)*99)/100].Milliseconds(),
+			ErrorRate: float64(failed) / float64(total),
+			Samples:   total,
+		}
+		var reasons []string
+		if w.cfg.P99 > 0 && c.P99Ms > w.cfg.P99.Milliseconds() {
+			reasons = append(reasons, fmt.Sprintf("p99 %dms over %s", c.P99Ms, w.cfg.P99))
+		}
+		if w.cfg.ErrorRate > 0 && c.ErrorRate > w.cfg.ErrorRate {
+			reasons = append(reasons, fmt.Sprintf("error rate %.3f over %.3f", c.ErrorRate, w.cfg.ErrorRate))
+		}
+		if len(reasons) == 0 {
+			continue
+		}
+		c.Reason = strings.Join(reasons, "; ")
+
+		w.mu.Lock()
+		w.last = time.Now()
+		w.mu.Unlock()
+		w.capture(ctx, c)
+	}
+}
+
+func (w *Watcher) capture(ctx context.Context, c Capture) {
+	c.At = time.Now().UTC()
+	c.ID = c.At.Format("20060102T150405Z")
+	log.Printf("forensics: capturing %s: %s", c.ID, c.Reason)
+
+	put := func(name string, data []byte) {
+		key := prefix + c.ID + "/" + name
+		if err := w.store.Put(key, data); err != nil {
+			log.Printf("forensics: store %s: %v", key, err)
+			return
+		}
+		c.Files = append(c.Files, key)
+	}
+
+	var goroutines bytes.Buffer
+	if err := pprof.Lookup("goroutine").WriteTo(&goroutines, 2); err == nil {
+		put("goroutines.txt", goroutines.Bytes())
+	}
+
+	// Fails if someone is already profiling the CPU, e.g. via /profile/cpu.
+	var cpu bytes.Buffer
+	if err := pprof.StartCPUProfile(&cpu); err != nil {
+		c.Error = "cpu profile: " + err.Error()
+	} else {
+		t := time.NewTimer(w.cfg.CPUDuration)
+		select {
+		case <-ctx.Done():
+		case <-t.C:
+		}
+		t.Stop()
+		pprof.StopCPUProfile()
+		put("cpu.pprof", cpu.Bytes())
+	}
+
+	data, _ := json.MarshalIndent(c, "", "  ")
+	put("capture.json", data)
+	w.prune()
+}
+
+// prune deletes the oldest captures beyond Keep.
+func (w *Watcher) prune() {
+	keys, err := w.store.List(prefix)
+	if err != nil {
+		log.Printf("forensics: list captures: %v", err)
+		return
+	}
+	ids := captureIDs(keys)
+	if len(ids) <= w.cfg.Keep {
+		return
+	}
+	old := ids[:len(ids)-w.cfg.Keep]
+	for _, key := range keys {
+		if slices.Contains(old, captureID(key)) {
+			if err := w.store.Delete(key); err != nil {
+				log.Printf("forensics: delete %s: %v", key, err)
+			}
+		}
+	}
+}
+
+// Captures lists the stored captures, newest first.
+func (w *Watcher) Captures() ([]Capture, error) {
+	keys, err := w.store.List(prefix)
+	if err != nil {
+		return nil, err
+	}
+	ids := captureIDs(keys)
+	captures := make([]Capture, 0, len(ids))
+	for _, id := range slices.Backward(ids) {
+		c := Capture{ID: id}
+		if data, err := w.store.Get(prefix + id + "/capture.json"); err == nil {
+			_ = json.Unmarshal(data, &c)
+		}
+		captures = append(captures, c)
+	}
+	return captures, nil
+}
+
+func captureID(key string) string {
+	return path.Dir(strings.TrimPrefix(key, prefix))
+}
+
+// captureIDs returns the distinct IDs of keys, oldest first; IDs are
+// timestamps, so they sort by age.
+func captureIDs(keys []string) []string {
+	var ids []string
+	for _, key := range keys {
+		ids = append(ids, captureID(key))
+	}
+	slices.Sort(ids)
+	return slices.Compact(ids)
+}
@@ -0,0 +1,154 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/auth"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/problem"
+)
+
+func RegisterAPIKeyRoutes(router *http.ServeMux, authn *auth.Authenticator) {
+	admin := func(h func(http.ResponseWriter, *http.Request, *auth.KeyStore)) http.HandlerFunc {
+		return RequireScope(authn, auth.ScopeAdmin, func(w http.ResponseWriter, r *http.Request) {
+			h(w, r, authn.Keys)
+		})
+	}
+
+	router.HandleFunc("GET /admin/apikeys", admin(ListAPIKeysHandler))
+	router.HandleFunc("POST /admin/apikeys", admin(CreateAPIKeyHandler))
+	router.HandleFunc("POST /admin/apikeys/{id}/rotate", admin(RotateAPIKeyHandler))
+	router.HandleFunc("DELETE /admin/apikeys/{id}", admin(RevokeAPIKeyHandler))
+}
+
+type createAPIKeyRequest struct {
+	Tenant    string   `json:"tenant"`
+	Name      string   `json:"name"`
+	Scopes    []string `json:"scopes"`
+	ExpiresIn string   `json:"expires_in,omitempty"` // e.g. "720h"
+}
+
+type issuedAPIKey struct {
+	Key    string      `json:"key"`
+	APIKey auth.APIKey `json:"api_key"`
+}
+
+// ListAPIKeysHandler lists keys visible to the caller. Tenant admins only
+// see their own tenant; the bootstrap admin may filter with ?tenant=.
+func ListAPIKeysHandler(w http.ResponseWriter, r *http.Request, keys *auth.KeyStore) {
+	tenant := callerTenant(r)
+	if tenant == "" {
+		tenant = r.URL.Query().Get("tenant")
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(keys.List(tenant))
+}
+
+func CreateAPIKeyHandler(w http.ResponseWriter, r *http.Request, keys *auth.KeyStore) {
+	defer r.Body.Close()
+
+	var req createAPIKeyRequest
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		problem.Error(w, r, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if tenant := callerTenant(r); tenant != "" {
+		if req.Tenant != "" && req.Tenant != tenant {
+			problem.Error(w, r, "cannot create keys for another tenant", http.StatusForbidden)
+			return
+		}
+		req.Tenant = tenant
+	}
+	if req.Tenant == "" {
+		problem.Error(w, r, "tenant is required", http.StatusBadRequest)
+		return
+	}
+	if len(req.Scopes) == 0 {
+		problem.Error(w, r, "scopes must not be empty", http.StatusBadRequest)
+		return
+	}
+
+	var ttl time.Duration
+	if req.ExpiresIn != "" {
+		d, err := time.ParseDuration(req.ExpiresIn)
+		if err != nil || d <= 0 {
+			problem.Error(w, r, "invalid expires_in", http.StatusBadRequest)
+			return
+		}
+		ttl = d
+	}
+
+	raw, key, err := keys.Create(req.Tenant, req.Name, req.Scopes, ttl)
+	if err != nil {
+		writeAPIKeyError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(issuedAPIKey{Key: raw, APIKey: key})
+}
+
+func RotateAPIKeyHandler(w http.ResponseWriter, r *http.Request, keys *auth.KeyStore) {
+	id := r.PathValue("id")
+	if !ownsKey(r, keys, id) {
+		problem.Error(w, r, auth.ErrKeyNotFound.Error(), http.StatusNotFound)
+		return
+	}
+
+	raw, key, err := keys.Rotate(id)
+	if err != nil {
+		writeAPIKeyError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(issuedAPIKey{Key: raw, APIKey: key})
+}
+
+func RevokeAPIKeyHandler(w http.ResponseWriter, r *http.Request, keys *auth.KeyStore) {
+	id := r.PathValue("id")
+	if !ownsKey(r, keys, id) {
+		problem.Error(w, r, auth.ErrKeyNotFound.Error(), http.StatusNotFound)
+		return
+	}
+
+	if err := keys.Revoke(id); err != nil {
+		writeAPIKeyError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// callerTenant returns the tenant the caller is restricted to, or "" for
+// the bootstrap admin.
+func callerTenant(r *http.Request) string {
+	key, _ := auth.FromContext(r.Context())
+	return key.Tenant
+}
+
+func ownsKey(r *http.Request, keys *auth.KeyStore, id string) bool {
+	key, err := keys.Get(id)
+	if err != nil {
+		return false
+	}
+	tenant := callerTenant(r)
+	return tenant == "" || key.Tenant == tenant
+}
+
+func writeAPIKeyError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, auth.ErrKeyNotFound):
+		problem.Error(w, r, err.Error(), http.StatusNotFound)
+	case errors.Is(err, auth.ErrKeyRevoked), errors.Is(err, auth.ErrInvalidScope):
+		problem.Error(w, r, err.Error(), http.StatusBadRequest)
+	default:
+		problem.Error(w, r, "internal error", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/audit"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/auth"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/filter"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/history"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/jobs"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/pkg/models"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/problem"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/processor"
+)
+
+const maxBulkIDs = 10000
+
+// BulkActionRequest selects waiting orders by filter expression or by ID
+// and applies one action to each of them.
+type BulkActionRequest struct {
+	Action   string          `json:"action"` // cancel, hold, requeue or priority
+	Filter   string          `json:"filter,omitempty"`
+	IDs      []string        `json:"ids,omitempty"`
+	Priority models.Priority `json:"priority,omitempty"` // for the priority action
+	Reason   string          `json:"reason,omitempty"`
+}
+
+// RegisterBulkRoutes exposes bulk actions on queued and held orders.
+func RegisterBulkRoutes(router *http.ServeMux, pool *processor.Pool, manager *jobs.Manager, auditLog *audit.Log, recorder *history.Recorder, authn *auth.Authenticator, requireKey bool) {
+	protect := func(h http.HandlerFunc) http.HandlerFunc {
+		if authn != nil && requireKey {
+			return RequireOperator(authn, h)
+		}
+		return h
+	}
+	router.HandleFunc("POST /orders/bulk-action", protect(func(w http.ResponseWriter, r *http.Request) {
+		BulkActionHandler(w, r, pool, manager, auditLog, recorder)
+	}))
+}
+
+// BulkActionHandler resolves the selected orders and starts a job that
+// applies the action to them one by one. It answers 202 with the job;
+// its progress is at GET /jobs/{id}.
+func BulkActionHandler(w http.ResponseWriter, r *http.Request, pool *processor.Pool, manager *jobs.Manager, auditLog *audit.Log, recorder *history.Recorder) {
+	defer r.Body.Close()
+	var req BulkActionRequest
+	dec := json.NewDecoder(io.LimitReader(r.Body, 1<<20))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		problem.Error(w, r, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if len(req.Reason) > maxCommentLength {
+		problem.Error(w, r, "reason must be at most 2000 characters", http.StatusBadRequest)
+		return
+	}
+
+	var apply func(id string) error
+	var event, detail string
+	switch req.Action {
+	case "cancel":
+		apply = func(id string) error { _, err := pool.Remove(id); return err }
+		event, detail = history.EventRemoved, req.Reason
+	case "hold":
+		apply = func(id string) error { return pool.Hold(id, req.Reason) }
+		event, detail = history.EventHeld, req.Reason
+	case "requeue":
+		apply = pool.Release
+		event, detail = history.EventReleased, req.Reason
+	case "priority":
+		if !req.Priority.Valid() {
+			problem.Error(w, r, "priority must be 1-3", http.StatusBadRequest)
+			return
+		}
+		apply = func(id string) error { return pool.SetPriority(id, req.Priority) }
+		event, detail = history.EventReprioritized, strings.TrimSpace(fmt.Sprintf("priority %d %s", req.Priority, req.Reason))
+	default:
+		problem.Error(w, r, "action must be cancel, hold, requeue or priority", http.StatusBadRequest)
+		return
+	}
+
+	ids, err := selectOrders(pool, req)
+	if err != nil {
+		problem.Error(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	actor := operator(r)
+	job, err := manager.Start("bulk."+req.Action, actor, len(ids), func(ctx context.Context, p *jobs.Progress) error {
+		for _, id := range ids {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			err := apply(id)
+			if err == nil && recorder != nil {
+				recorder.RecordBy(id, event, actor, detail)
+			}
+			p.Step(id, err)
+		}
+		return nil
+	})
+	if err != nil {
+		w.Header().Set("Retry-After", "5")
+		problem.Error(w, r, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	auditLog.Record(actor, "orders.bulk."+req.Action, job.ID, strings.TrimSpace(fmt.Sprintf("%d orders %s", len(ids), req.Reason)))
+	w.Header().Set("Location", "/jobs/"+job.ID)
+	writeJSON(w, http.StatusAccepted, job)
+}
+
+// selectOrders returns the IDs the request names, or those of the waiting
+// orders its filter matches. Filters can also compare "pipeline" and
+// "held" (true or false).
+func selectOrders(pool *processor.Pool, req BulkActionRequest) ([]string, error) {
+	switch {
+	case (req.Filter == "") == (len(req.IDs) == 0):
+		return nil, fmt.Errorf("exactly one of filter and ids is required")
+	case len(req.IDs) > maxBulkIDs:
+		return nil, fmt.Errorf("at most %d ids are allowed", maxBulkIDs)
+	case len(req.IDs) > 0:
+		return req.IDs, nil
+	}
+	f, err := filter.Parse(req.Filter, "pipeline", "held")
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter: %v", err)
+	}
+	var ids []string
+	for _, o := range pool.Waiting() {
+		attrs := map[string]string{"pipeline": o.Pipeline, "held": strconv.FormatBool(o.Held)}
+		if f.Match(o.Order, attrs) {
+			ids = append(ids, o.Order.ID)
+		}
+	}
+	return ids, nil
+}
@@ -0,0 +1,40 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/audit"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/auth"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/problem"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/processor"
+)
+
+// RegisterCanaryRoutes lets operators compare canary pipelines with their
+// baselines, roll them back and resume them.
+func RegisterCanaryRoutes(router *http.ServeMux, pool *processor.Pool, auditLog *audit.Log, authn *auth.Authenticator, requireKey bool) {
+	protect := func(h http.HandlerFunc) http.HandlerFunc {
+		if authn != nil && requireKey {
+			return RequireScope(authn, auth.ScopeAdmin, h)
+		}
+		return h
+	}
+	router.HandleFunc("GET /admin/canaries", protect(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, pool.Canaries())
+	}))
+	control := func(action string, fn func(string) (processor.CanaryStatus, error)) http.HandlerFunc {
+		return protect(func(w http.ResponseWriter, r *http.Request) {
+			status, err := fn(r.PathValue("pipeline"))
+			if errors.Is(err, processor.ErrNoCanary) {
+				problem.Error(w, r, err.Error(), http.StatusNotFound)
+				return
+			}
+			if auditLog != nil {
+				auditLog.Record(operator(r), "canary."+action, status.Pipeline, "")
+			}
+			writeJSON(w, http.StatusOK, status)
+		})
+	}
+	router.HandleFunc("POST /admin/canaries/{pipeline}/rollback", control("rollback", pool.RollbackCanary))
+	router.HandleFunc("POST /admin/canaries/{pipeline}/resume", control("resume", pool.ResumeCanary))
+}
@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/auth"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/payment"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/pkg/models"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/problem"
+)
+
+// RegisterCreditRoutes exposes credit balances to keys that read orders
+// and deposits to admin keys, each within the key's tenant.
+func RegisterCreditRoutes(router *http.ServeMux, ledger *payment.Ledger, authn *auth.Authenticator, requireKey bool) {
+	protect := func(scope string, h http.HandlerFunc) http.HandlerFunc {
+		if authn != nil && requireKey {
+			return RequireScope(authn, scope, h)
+		}
+		return h
+	}
+	router.HandleFunc("GET /credits/{account}", protect(auth.ScopeOrdersRead, func(w http.ResponseWriter, r *http.Request) {
+		GetCreditHandler(w, r, ledger)
+	}))
+	router.HandleFunc("POST /credits/{account}/deposit", protect(auth.ScopeAdmin, func(w http.ResponseWriter, r *http.Request) {
+		DepositCreditHandler(w, r, ledger)
+	}))
+}
+
+// GetCreditHandler returns a credit account's balance and recent entries
+func GetCreditHandler(w http.ResponseWriter, r *http.Request, ledger *payment.Ledger) {
+	account, err := ledger.Get(r.PathValue("account"))
+	if t := callerTenant(r); err != nil || (t != "" && account.Tenant != t) {
+		problem.Error(w, r, payment.ErrAccountNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, account)
+}
+
+// DepositCreditHandler issues store credit or loads a gift card. A new
+// account belongs to the caller's tenant (the bootstrap admin may name
+// one) and, if given, a customer; only their orders can spend it.
+func DepositCreditHandler(w http.ResponseWriter, r *http.Request, ledger *payment.Ledger) {
+	defer r.Body.Close()
+
+	var req struct {
+		Amount   models.Money `json:"amount"`
+		Tenant   string       `json:"tenant"`
+		Customer string       `json:"customer"`
+	}
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		problem.Error(w, r, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	id := r.PathValue("account")
+	tenant := callerTenant(r)
+	if tenant == "" {
+		tenant = req.Tenant
+		if existing, err := ledger.Get(id); err == nil && req.Tenant == "" {
+			tenant = existing.Tenant
+		}
+	}
+	account, err := ledger.Deposit(id, tenant, strings.TrimSpace(req.Customer), req.Amount)
+	switch {
+	case errors.Is(err, payment.ErrAccountNotFound):
+		problem.Error(w, r, err.Error(), http.StatusNotFound)
+	case errors.Is(err, payment.ErrAccountOwner):
+		problem.Error(w, r, err.Error(), http.StatusConflict)
+	case err != nil:
+		problem.Error(w, r, err.Error(), http.StatusBadRequest)
+	default:
+		writeJSON(w, http.StatusOK, account)
+	}
+}
@@ -0,0 +1,113 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/auth"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/customer"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/problem"
+)
+
+// RegisterCustomerRoutes exposes the saved customer profiles. Profiles
+// hold personal data, so the routes need an admin key when keys are
+// required, and a tenant's key only sees the tenant's profiles. A key
+// without a tenant may create profiles for any tenant.
+func RegisterCustomerRoutes(router *http.ServeMux, customers *customer.Directory, authn *auth.Authenticator, requireKey bool) {
+	protect := func(h http.HandlerFunc) http.HandlerFunc {
+		if authn != nil && requireKey {
+			return RequireScope(authn, auth.ScopeAdmin, h)
+		}
+		return h
+	}
+	router.HandleFunc("POST /customers", protect(func(w http.ResponseWriter, r *http.Request) {
+		var p customer.Profile
+		if !decodeCustomerRequest(w, r, &p) {
+			return
+		}
+		if tenant := callerTenant(r); tenant != "" {
+			p.Tenant = tenant
+		}
+		p, err := customers.Create(p)
+		if err != nil {
+			customerError(w, r, err)
+			return
+		}
+		w.Header().Set("Location", "/customers/"+p.ID)
+		writeJSON(w, http.StatusCreated, p)
+	}))
+	router.HandleFunc("GET /customers", protect(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, customers.List(callerTenant(r)))
+	}))
+	router.HandleFunc("GET /customers/{id}", protect(func(w http.ResponseWriter, r *http.Request) {
+		p, err := customers.Get(callerTenant(r), r.PathValue("id"))
+		if err != nil {
+			customerError(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, p)
+	}))
+	router.HandleFunc("PUT /customers/{id}", protect(func(w http.ResponseWriter, r *http.Request) {
+		var p customer.Profile
+		if !decodeCustomerRequest(w, r, &p) {
+			return
+		}
+		p, err := customers.Update(callerTenant(r), r.PathValue("id"), p)
+		if err != nil {
+			customerError(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, p)
+	}))
+	router.HandleFunc("DELETE /customers/{id}", protect(func(w http.ResponseWriter, r *http.Request) {
+		if err := customers.Delete(callerTenant(r), r.PathValue("id")); err != nil {
+			customerError(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	router.HandleFunc("POST /customers/{id}/addresses", protect(func(w http.ResponseWriter, r *http.Request) {
+		var a customer.Address
+		if !decodeCustomerRequest(w, r, &a) {
+			return
+		}
+		p, err := customers.AddAddress(callerTenant(r), r.PathValue("id"), a)
+		if err != nil {
+			customerError(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, p)
+	}))
+	router.HandleFunc("DELETE /customers/{id}/addresses/{address}", protect(func(w http.ResponseWriter, r *http.Request) {
+		p, err := customers.RemoveAddress(callerTenant(r), r.PathValue("id"), r.PathValue("address"))
+		if err != nil {
+			customerError(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, p)
+	}))
+}
+
+func decodeCustomerRequest(w http.ResponseWriter, r *http.Request, v any) bool {
+	defer r.Body.Close()
+	dec := json.NewDecoder(io.LimitReader(r.Body, 1<<20))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		problem.Error(w, r, "invalid JSON", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+func customerError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, customer.ErrNotFound), errors.Is(err, customer.ErrAddressNotFound):
+		problem.Error(w, r, err.Error(), http.StatusNotFound)
+	case errors.Is(err, customer.ErrExists):
+		problem.Error(w, r, err.Error(), http.StatusConflict)
+	default:
+		problem.Error(w, r, err.Error(), http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,155 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/audit"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/auth"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/filter"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/history"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/jobs"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/orderstore"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/problem"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/processor"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/transform"
+)
+
+var errNotDeadLettered = errors.New("order is no longer dead-lettered")
+
+// RequeueDeadLettersRequest selects failed orders, optionally by filter
+// expression, and names a transform applied to each before it's queued
+// again.
+type RequeueDeadLettersRequest struct {
+	Filter    string `json:"filter,omitempty"`
+	Transform string `json:"transform,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// RegisterDeadLetterRoutes exposes requeueing of the orders that failed
+// processing, the pool's dead letters.
+func RegisterDeadLetterRoutes(router *http.ServeMux, pool *processor.Pool, manager *jobs.Manager, transforms transform.Set, auditLog *audit.Log, recorder *history.Recorder, authn *auth.Authenticator, requireKey bool) {
+	protect := func(h http.HandlerFunc) http.HandlerFunc {
+		if authn != nil && requireKey {
+			return RequireScope(authn, auth.ScopeAdmin, h)
+		}
+		return h
+	}
+	router.HandleFunc("POST /orders/dead-letter/requeue-all", protect(func(w http.ResponseWriter, r *http.Request) {
+		RequeueDeadLettersHandler(w, r, pool, manager, transforms, auditLog, recorder)
+	}))
+}
+
+// RequeueDeadLettersHandler selects the failed orders and starts a job
+// that transforms and resubmits them one by one. It answers 202 with the
+// job; its progress is at GET /jobs/{id}.
+func RequeueDeadLettersHandler(w http.ResponseWriter, r *http.Request, pool *processor.Pool, manager *jobs.Manager, transforms transform.Set, auditLog *audit.Log, recorder *history.Recorder) {
+	defer r.Body.Close()
+	var req RequeueDeadLettersRequest
+	dec := json.NewDecoder(io.LimitReader(r.Body, 1<<20))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		problem.Error(w, r, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if len(req.Reason) > maxCommentLength {
+		problem.Error(w, r, "reason must be at most 2000 characters", http.StatusBadRequest)
+		return
+	}
+	t, err := transforms.Get(req.Transform)
+	if err != nil {
+		problem.Error(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var f filter.Filter // matches every order
+	if req.Filter != "" {
+		if f, err = filter.Parse(req.Filter, "pipeline"); err != nil {
+			problem.Error(w, r, fmt.Sprintf("invalid filter: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	records, _ := pool.Orders.List(orderstore.Query{States: []orderstore.State{orderstore.Failed}, Tenant: callerTenant(r)})
+	var ids []string
+	for _, rec := range records {
+		attrs := map[string]string{}
+		if rec.Result != nil {
+			attrs["pipeline"] = rec.Result.Pipeline
+		}
+		if f.Match(rec.Order, attrs) {
+			ids = append(ids, rec.Order.ID)
+		}
+	}
+
+	actor := operator(r)
+	job, err := manager.Start("dead-letter.requeue", actor, len(ids), func(ctx context.Context, p *jobs.Progress) error {
+		for _, id := range ids {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			err := requeueDeadLetter(pool, id, t)
+			if err == nil && recorder != nil {
+				recorder.RecordBy(id, history.EventRequeued, actor, req.Reason)
+			}
+			p.Step(id, err)
+		}
+		return nil
+	})
+	if err != nil {
+		w.Header().Set("Retry-After", "5")
+		problem.Error(w, r, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	auditLog.Record(actor, "orders.dead-letter.requeue", job.ID, strings.TrimSpace(fmt.Sprintf("%d orders %s %s", len(ids), req.Transform, req.Reason)))
+	w.Header().Set("Location", "/jobs/"+job.ID)
+	writeJSON(w, http.StatusAccepted, job)
+}
+
+// requeueDeadLetter resubmits a failed order with its status before
+// processing. t's output is merged over the order's fields, so a
+// transform only needs to produce the fields it fixes; the order's
+// identity and ownership can't be changed.
+func requeueDeadLetter(pool *processor.Pool, id string, t *transform.Transform) error {
+	rec, ok := pool.Orders.Get(id)
+	if !ok || rec.State != orderstore.Failed {
+		return errNotDeadLettered
+	}
+	o := rec.Order
+	if rec.Result != nil && rec.Result.PreviousStatus != "" {
+		o.Status = rec.Result.PreviousStatus
+	}
+	if t != nil {
+		out, err := t.Apply(o)
+		if err != nil {
+			return fmt.Errorf("transform: %w", err)
+		}
+		fixed := o
+		if err := json.Unmarshal(out, &fixed); err != nil {
+			return fmt.Errorf("transform: %w", err)
+		}
+		fixed.ID, fixed.Tenant, fixed.SubmittedBy = o.ID, o.Tenant, o.SubmittedBy
+		fixed.Canonicalize()
+		if err := fixed.Validate(); err != nil {
+			return err
+		}
+		o = fixed
+	}
+	o.CreatedAt, o.HeldMs = time.Now(), 0
+	// The order is accepted again under its ID, as a new record.
+	pool.Orders.Forget(id)
+	if err := pool.Submit(o); err != nil {
+		// A failed submit forgets the record; the order stays a dead letter.
+		if pool.Orders.Put(rec.Order, orderstore.Failed) == nil {
+			pool.Orders.Update(id, func(r *orderstore.Record) { r.Result = rec.Result })
+		}
+		return err
+	}
+	return nil
+}
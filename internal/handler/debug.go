@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"cmp"
+	"fmt"
+	"net/http"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/pkg/models"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/problem"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/processor"
+)
+
+// PoolSnapshotHandler returns what every worker is doing and what waits in
+// the queues. With ?format=text it renders a table like top, e.g. for
+// watch -n1 curl -s .../debug/pool?format=text.
+func PoolSnapshotHandler(w http.ResponseWriter, r *http.Request, pool *processor.Pool) {
+	snap := pool.Snapshot()
+	switch r.URL.Query().Get("format") {
+	case "", "json":
+		writeJSON(w, http.StatusOK, snap)
+	case "text":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		writePoolSnapshot(w, snap)
+	default:
+		problem.Error(w, r, "format must be json or text", http.StatusBadRequest)
+	}
+}
+
+func writePoolSnapshot(w http.ResponseWriter, snap processor.PoolSnapshot) {
+	states := map[string]int{}
+	for _, ws := range snap.Workers {
+		states[ws.State]++
+	}
+	res := snap.Results
+	fmt.Fprintf(w, "%s  workers: %d  idle %d  processing %d  sending %d  stopped %d\n",
+		snap.At.Format(time.TimeOnly), len(snap.Workers), states[processor.WorkerIdle], states[processor.WorkerProcessing],
+		states[processor.WorkerSending], states[processor.WorkerStopped])
+	fmt.Fprintf(w, "results: %s  waiting %d  blocked %d  dropped %d  on disk %d\n\n",
+		res.Overflow, res.Waiting, res.Blocked, res.Dropped, res.OnDisk)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PIPELINE\tQUEUED\tSPILLED\tHIGH\tMEDIUM\tLOW\t<1s\t1s-10s\t10s-1m\t>1m\tOLDEST")
+	for _, q := range snap.Queues {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%s\n", q.Pipeline, q.Length, q.Spilled,
+			q.ByPriority[models.PriorityHigh], q.ByPriority[models.PriorityMedium], q.ByPriority[models.PriorityLow],
+			q.ByAge["<1s"], q.ByAge["1s-10s"], q.ByAge["10s-1m"], q.ByAge[">1m"], ms(q.OldestMs))
+	}
+	tw.Flush()
+	fmt.Fprintln(w)
+
+	tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tPIPELINE\tSTATE\tTIME\tORDER\tPRIO\tSTEP\tSTEP TIME\tDONE")
+	for _, ws := range snap.Workers {
+		order, prio, stepTime := "-", "-", "-"
+		if ws.OrderID != "" {
+			order, prio = ws.OrderID, ws.Priority.String()
+		}
+		if ws.Step != "" {
+			stepTime = ms(ws.InStepMs)
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%d\n", ws.ID, ws.Pipeline, ws.State, ms(ws.InStateMs),
+			order, prio, cmp.Or(ws.Step, "-"), stepTime, ws.Processed)
+	}
+	tw.Flush()
+}
+
+// ms formats milliseconds as a short duration.
+func ms(n int64) string {
+	d := time.Duration(n) * time.Millisecond
+	if d >= time.Second {
+		d = d.Round(100 * time.Millisecond)
+	}
+	return d.String()
+}
@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"net/http"
+	"regexp"
+
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/pkg/models"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/problem"
+)
+
+// genericStatuses are the statuses whose generic codes are documented.
+var genericStatuses = []int{
+	http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound,
+	http.StatusMethodNotAllowed, http.StatusConflict, http.StatusRequestEntityTooLarge,
+	http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusServiceUnavailable,
+}
+
+var formatVerb = regexp.MustCompile(`%[a-z]`)
+
+// errorDoc documents an error code; it is what problem type URIs point to
+// by default.
+type errorDoc struct {
+	Code        string `json:"code"`
+	Description string `json:"description"`
+}
+
+// ErrorDocHandler describes the error code in the path. Validation codes
+// are described by their English message, with "…" for the values the
+// message names.
+func ErrorDocHandler(w http.ResponseWriter, r *http.Request) {
+	code := r.PathValue("code")
+	if msg, ok := models.Messages[code]; ok {
+		writeJSON(w, http.StatusOK, errorDoc{Code: code, Description: formatVerb.ReplaceAllString(msg, "…")})
+		return
+	}
+	for _, status := range genericStatuses {
+		if problem.Code(status) == code {
+			writeJSON(w, http.StatusOK, errorDoc{Code: code, Description: http.StatusText(status)})
+			return
+		}
+	}
+	problem.Error(w, r, "unknown error code "+code, http.StatusNotFound)
+}
@@ -0,0 +1,203 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/auth"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/cdc"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/eventbus"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/pkg/models"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/problem"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/transform"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/view"
+)
+
+const (
+	maxEventBatch = 1000
+	maxEventWait  = 60 * time.Second
+)
+
+// formatDebezium renders results as Debezium change events.
+const formatDebezium = "debezium"
+
+// resultFormat reads the ?format ("debezium" or empty) and ?transform
+// query parameters.
+func resultFormat(w http.ResponseWriter, r *http.Request, transforms transform.Set) (string, *transform.Transform, bool) {
+	q := r.URL.Query()
+	format := q.Get("format")
+	if format != "" && format != formatDebezium {
+		problem.Error(w, r, "format must be debezium or omitted", http.StatusBadRequest)
+		return "", nil, false
+	}
+	t, err := transforms.Get(q.Get("transform"))
+	if err != nil {
+		problem.Error(w, r, err.Error(), http.StatusBadRequest)
+		return "", nil, false
+	}
+	return format, t, true
+}
+
+// RegisterEventRoutes exposes the durable result event log. Consumers poll
+// with their subscriber name and ack what they've handled. node names this
+// instance in Debezium-formatted events. Requests for GET /events that
+// accept text/event-stream are served by live instead, unless it's nil.
+func RegisterEventRoutes(router *http.ServeMux, bus *eventbus.Bus, live http.HandlerFunc, authn *auth.Authenticator, requireKey bool, node string, transforms transform.Set, views *view.Views) {
+	protect := func(h http.HandlerFunc) http.HandlerFunc {
+		if authn != nil && requireKey {
+			return RequireScope(authn, auth.ScopeOrdersRead, h)
+		}
+		return h
+	}
+	router.HandleFunc("GET /events", protect(func(w http.ResponseWriter, r *http.Request) {
+		if live != nil && acceptsEventStream(r) {
+			live(w, r)
+			return
+		}
+		ReadEventsHandler(w, r, bus, node, transforms, views)
+	}))
+	router.HandleFunc("POST /events/ack", protect(func(w http.ResponseWriter, r *http.Request) {
+		AckEventsHandler(w, r, bus)
+	}))
+	router.HandleFunc("GET /events/subscribers", protect(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, bus.Subscribers())
+	}))
+}
+
+// ReadEventsHandler long-polls for events after the subscriber's cursor.
+// Query: subscriber (required), max (default 100), wait (default 30s),
+// format=debezium for change events, whose source.sequence is the seq to
+// ack, and transform to reshape each event. summary=true returns one
+// aggregate per second of events instead, with the last_seq to ack.
+// Submitter keys only get events of their own orders, reduced by views;
+// last_seq lets them ack past the events of others.
+func ReadEventsHandler(w http.ResponseWriter, r *http.Request, bus *eventbus.Bus, node string, transforms transform.Set, views *view.Views) {
+	format, t, ok := resultFormat(w, r, transforms)
+	if !ok {
+		return
+	}
+	q := r.URL.Query()
+	subscriber := q.Get("subscriber")
+	if subscriber == "" {
+		problem.Error(w, r, "subscriber is required", http.StatusBadRequest)
+		return
+	}
+	summarize := q.Get("summary") == "true"
+	if summarize && format == formatDebezium {
+		problem.Error(w, r, "summaries can't be sent as change events", http.StatusBadRequest)
+		return
+	}
+	max := 100
+	if v := q.Get("max"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxEventBatch {
+			problem.Error(w, r, "max must be 1-1000", http.StatusBadRequest)
+			return
+		}
+		max = n
+	}
+	wait := 30 * time.Second
+	if v := q.Get("wait"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 || d > maxEventWait {
+			problem.Error(w, r, "wait must be a duration up to 60s", http.StatusBadRequest)
+			return
+		}
+		wait = d
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), wait)
+	defer cancel()
+	batch, err := bus.Read(ctx, subscriber, max)
+	if err != nil {
+		problem.Error(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var lastSeq uint64
+	if n := len(batch.Events); n > 0 {
+		lastSeq = batch.Events[n-1].Seq
+	}
+	viewer := views.For(auth.FromContext(r.Context()))
+	batch.Events = slices.DeleteFunc(batch.Events, func(e eventbus.Event) bool { return !viewer.Owns(e.Result.Order) })
+	if summarize {
+		writeSummaries(w, r, batch, lastSeq, t)
+		return
+	}
+	if format == "" && t == nil && viewer.Role == view.Operator {
+		if batch.Events == nil {
+			batch.Events = []eventbus.Event{}
+		}
+		writeJSON(w, http.StatusOK, batch)
+		return
+	}
+
+	events := make([]json.RawMessage, len(batch.Events))
+	for i, e := range batch.Events {
+		var payload any
+		if format == formatDebezium {
+			payload, err = viewer.Change(cdc.FromResult(node, e.Seq, e.Time, e.Result))
+		} else {
+			payload, err = viewer.Event(e)
+		}
+		if err == nil {
+			events[i], err = t.Apply(payload)
+		}
+		if err != nil {
+			problem.Error(w, r, fmt.Sprintf("transform event %d: %v", e.Seq, err), http.StatusInternalServerError)
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"events": events, "skipped": batch.Skipped, "last_seq": lastSeq})
+}
+
+// writeSummaries aggregates a batch into one summary per second.
+func writeSummaries(w http.ResponseWriter, r *http.Request, batch eventbus.Batch, lastSeq uint64, t *transform.Transform) {
+	var summaries []*models.ResultSummary
+	for _, e := range batch.Events {
+		start := e.Time.Truncate(time.Second)
+		if len(summaries) == 0 || !summaries[len(summaries)-1].Start.Equal(start) {
+			summaries = append(summaries, &models.ResultSummary{Start: start, End: start.Add(time.Second)})
+		}
+		summaries[len(summaries)-1].Add(e.Result)
+	}
+	out := make([]json.RawMessage, len(summaries))
+	for i, s := range summaries {
+		var err error
+		if out[i], err = t.Apply(s); err != nil {
+			problem.Error(w, r, fmt.Sprintf("transform summary: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"summaries": out, "last_seq": lastSeq, "skipped": batch.Skipped})
+}
+
+// AckEventsHandler moves a subscriber's cursor past seq.
+func AckEventsHandler(w http.ResponseWriter, r *http.Request, bus *eventbus.Bus) {
+	defer r.Body.Close()
+
+	var req struct {
+		Subscriber string `json:"subscriber"`
+		Seq        uint64 `json:"seq"`
+	}
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil || req.Subscriber == "" {
+		problem.Error(w, r, "subscriber and seq are required", http.StatusBadRequest)
+		return
+	}
+	if err := bus.Ack(req.Subscriber, req.Seq); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, eventbus.ErrUnknownSubscriber) {
+			status = http.StatusNotFound
+		}
+		problem.Error(w, r, err.Error(), status)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -1,85 +1,614 @@
 package handler
 
 import (
+	"bytes"
 	"crypto/rand"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"maps"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/auth"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/cluster"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/firewall"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/history"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/i18n"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/idempotency"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/lifecycle"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/memguard"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/metrics"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/orderstore"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/payload"
 	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/pkg/models"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/problem"
 	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/processor"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/quality"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/slo"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/tenant"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/view"
 )
 
-func CreateOrderHandler(w http.ResponseWriter, r *http.Request, pool *processor.Pool) {
+func CreateOrderHandler(w http.ResponseWriter, r *http.Request, pool *processor.Pool, opts Options) {
 	if r.Method != http.MethodPost {
-		w.WriteHeader(http.StatusMethodNotAllowed)
+		problem.Error(w, r, r.Method+" is not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 	defer r.Body.Close()
 
-	var o models.Order
-	dec := json.NewDecoder(r.Body)
-	dec.DisallowUnknownFields()
-	if err := dec.Decode(&o); err != nil {
-		http.Error(w, "invalid JSON", http.StatusBadRequest)
+	// Refuse orders once shutdown begins, closing the connection so the
+	// client's balancer reconnects to another instance
+	if err := opts.Lifecycle.Admit(); err != nil {
+		shuttingDown(w, r)
+		return
+	}
+
+	// Keep the body as sent for audit, if payloads are kept, and to tell
+	// retries from other requests reusing their idempotency key
+	in := io.Reader(r.Body)
+	var raw []byte
+	if opts.Payloads != nil || opts.Idempotency != nil {
+		var err error
+		if raw, err = io.ReadAll(r.Body); err != nil {
+			localizedError(w, r, models.NewValidationError(models.CodeInvalidJSON), http.StatusBadRequest)
+			return
+		}
+		in = bytes.NewReader(raw)
+	}
+
+	o, err := models.DecodeOrder(in)
+	if err != nil {
+		opts.Quality.Rejected(quality.SourceHTTP, callerTenant(r), "", err)
+		localizedError(w, r, err, http.StatusBadRequest)
 		return
 	}
 
-	// Set default values before validation
+	// A retry of a request already answered gets the original response
+	// rather than submitting the order again
+	var idemKey string
+	if opts.Idempotency != nil {
+		var ok bool
+		if idemKey, ok = idempotencyKey(w, r, o.ID); !ok {
+			return
+		}
+	}
+	if idemKey != "" {
+		resp, replay, err := opts.Idempotency.Begin(idemKey, raw)
+		switch {
+		case errors.Is(err, idempotency.ErrInFlight):
+			problem.Error(w, r, err.Error(), http.StatusConflict)
+			return
+		case errors.Is(err, idempotency.ErrMismatch):
+			problem.Error(w, r, err.Error(), http.StatusUnprocessableEntity)
+			return
+		case replay:
+			w.Header().Set("Content-Type", resp.ContentType)
+			w.Header().Set(headerIdempotentReplay, "true")
+			w.WriteHeader(resp.Status)
+			_, _ = w.Write(resp.Body)
+			return
+		}
+		// Unless the order is accepted, a retry tries again
+		defer opts.Idempotency.Release(idemKey)
+	}
+
+	o.Tenant, o.SubmittedBy, o.HeldMs = "", "", 0
+	if key, ok := auth.FromContext(r.Context()); ok {
+		o.Tenant, o.SubmittedBy = key.Tenant, key.ID
+	}
+
+	// Fill in a saved customer's details, then normalize and set default
+	// values before validation
+	if err := opts.Customers.Resolve(&o); err != nil {
+		opts.Quality.Rejected(quality.SourceHTTP, callerTenant(r), strings.TrimSpace(o.ID), err)
+		localizedError(w, r, err, http.StatusBadRequest)
+		return
+	}
+	o.Canonicalize()
+	defaultPriority := o.Priority == 0
 	o.SetDefaultValues()
 
 	// Generate ID if not provided
+	sentID := o.ID
 	if o.ID == "" {
 		o.ID = generateID()
 	}
+	trace.SpanFromContext(r.Context()).SetAttributes(attribute.String("order.id", o.ID))
+
+	// Built-in checks run first, then deployment validators; every failure
+	// is reported together.
+	var errs models.ValidationErrors
+	checks := []error{o.Validate(), o.ValidateTags(opts.Tags), opts.Validators.Validate(o), opts.Shipping.Check(o, time.Now()), o.ValidateDeadline(time.Now()), checkParent(r, pool, opts, o)}
+	if o.CallbackURL != "" {
+		checks = append(checks, opts.Callbacks.Check(o.CallbackURL))
+	}
+	for _, err := range checks {
+		if err != nil {
+			errs = append(errs, models.AsValidationErrors(err, models.CodeInvalidField)...)
+		}
+	}
+	if len(errs) > 0 {
+		opts.Quality.Rejected(quality.SourceHTTP, o.Tenant, sentID, errs)
+		localizedError(w, r, errs, http.StatusBadRequest)
+		return
+	}
+	opts.Quality.Accepted(quality.SourceHTTP, o, defaultPriority)
+
+	// Shed or pause intake while the heap is above its watermarks
+	if err := opts.Memory.Admit(o.Priority); err != nil {
+		setBackpressure(w, pool, 5*time.Second)
+		localizedError(w, r, models.NewValidationError(models.CodeMemoryPressure), http.StatusServiceUnavailable)
+		return
+	}
+
+	// Join reference data into the tags, for routing and quarantine rules
+	opts.Enricher.Enrich(r.Context(), &o)
 
-	if err := o.Validate(); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	// Only a replay of the same key and tenant, answered above, may reuse
+	// an accepted order's ID; the check is repeated when it's recorded.
+	if _, taken := pool.Orders.Get(o.ID); taken {
+		problem.Error(w, r, orderstore.ErrExists.Error(), http.StatusConflict)
 		return
 	}
 
 	// Set creation time
 	o.CreatedAt = time.Now()
 
+	// Record acceptance first so it can't land after the worker's result
+	if opts.History != nil {
+		opts.History.Record(o.ID, history.EventAccepted, "")
+	}
+
+	// Send to processing pool, or hold it for review if quarantined
+	rule, quarantined := opts.Quarantine.Match(o, o.SubmittedBy, firewall.ClientIP(r))
+	if quarantined {
+		err = pool.SubmitHeld(o, rule.HoldReason())
+	} else {
+		err = pool.SubmitContext(r.Context(), o)
+	}
+	if errors.Is(err, processor.ErrWouldMissDeadline) {
+		setBackpressure(w, pool, time.Second)
+		if opts.History != nil {
+			opts.History.Record(o.ID, history.EventRejected, err.Error())
+		}
+		localizedError(w, r, models.NewValidationError(models.CodeWouldMissDeadline), http.StatusServiceUnavailable)
+		return
+	}
+	if errors.Is(err, processor.ErrDraining) {
+		if opts.History != nil {
+			opts.History.Record(o.ID, history.EventRejected, err.Error())
+		}
+		shuttingDown(w, r)
+		return
+	}
+	if errors.Is(err, orderstore.ErrExists) {
+		problem.Error(w, r, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		// Queue is full, or admission control refused the order
+		setBackpressure(w, pool, time.Second)
+		if opts.History != nil {
+			opts.History.Record(o.ID, history.EventRejected, err.Error())
+		}
+		localizedError(w, r, models.NewValidationError(models.CodeServiceUnavailable), http.StatusServiceUnavailable)
+		return
+	}
+
+	if quarantined && opts.History != nil {
+		opts.History.Record(o.ID, history.EventHeld, rule.HoldReason())
+	}
+	// The feed sees only what the tenant's policy allows, like results.
+	opts.Feed.Accepted(opts.Tenants.Apply(models.ProcessedOrder{Order: o}).Order)
+	received := payload.Payload{
+		OrderID:     o.ID,
+		ReceivedAt:  o.CreatedAt,
+		Tenant:      o.Tenant,
+		SubmittedBy: o.SubmittedBy,
+		ContentType: r.Header.Get("Content-Type"),
+	}
+	if err := opts.Payloads.Save(received, raw); err != nil {
+		log.Printf("payloads: order %s: %v", o.ID, err)
+	}
+
+	setBackpressure(w, pool, 0)
+	body, err := opts.Views.For(auth.FromContext(r.Context())).Order(o)
+	if err != nil {
+		problem.Error(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var buf bytes.Buffer
+	_ = json.NewEncoder(&buf).Encode(body)
+	if idemKey != "" {
+		opts.Idempotency.Complete(idemKey, idempotency.Response{Status: http.StatusCreated, ContentType: "application/json", Body: buf.Bytes()})
+	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
-	_ = json.NewEncoder(w).Encode(o)
+	_, _ = w.Write(buf.Bytes())
+}
+
+// headerIdempotentReplay marks a response replayed for a retried request.
+const headerIdempotentReplay = "Idempotent-Replayed"
+
+// maxIdempotencyKey bounds the Idempotency-Key header.
+const maxIdempotencyKey = 255
+
+// idempotencyKey returns the key a submission is deduplicated under: its
+// Idempotency-Key header or, without one, the order ID the client chose.
+// Keys are scoped to the caller's tenant and API key, so clients can't
+// collide with each other. It is empty when the request has neither.
+func idempotencyKey(w http.ResponseWriter, r *http.Request, orderID string) (string, bool) {
+	var key string
+	if header := r.Header.Get("Idempotency-Key"); header != "" {
+		if len(header) > maxIdempotencyKey {
+			problem.Error(w, r, fmt.Sprintf("Idempotency-Key must be at most %d characters", maxIdempotencyKey), http.StatusBadRequest)
+			return "", false
+		}
+		key = "key:" + header
+	} else if id := strings.TrimSpace(orderID); id != "" {
+		key = "order:" + id
+	} else {
+		return "", true
+	}
+	apiKey, _ := auth.FromContext(r.Context())
+	return apiKey.Tenant + "\x00" + apiKey.ID + "\x00" + key, true
+}
+
+// orderStatus is an order's record as returned to the caller's view.
+type orderStatus struct {
+	Order     any              `json:"order"`
+	State     orderstore.State `json:"state"`
+	Result    any              `json:"result,omitempty"`
+	UpdatedAt time.Time        `json:"updated_at"`
+}
+
+// orderPage is a page of GET /orders.
+type orderPage struct {
+	Orders []orderStatus `json:"orders"`
+	Total  int           `json:"total"`
+	Limit  int           `json:"limit"`
+	Offset int           `json:"offset"`
+}
+
+const (
+	defaultOrderListing = 50
+	maxOrderListing     = 1000
+)
+
+// GetOrderHandler returns an order's current state and, once processed,
+// its result. Orders of other tenants, and for submitter keys other keys'
+// orders, are not found.
+func GetOrderHandler(w http.ResponseWriter, r *http.Request, pool *processor.Pool, opts Options) {
+	rec, ok := pool.Orders.Get(r.PathValue("id"))
+	viewer := opts.Views.For(auth.FromContext(r.Context()))
+	if t := callerTenant(r); !ok || !viewer.Owns(rec.Order) || (t != "" && rec.Order.Tenant != t) {
+		problem.Error(w, r, "order not found", http.StatusNotFound)
+		return
+	}
+	status, err := renderOrder(rec, viewer, opts.Tenants)
+	if err != nil {
+		problem.Error(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, status)
+}
 
-	// Send to processing pool
-	select {
-	case pool.Orders <- o:
-		// Order queued successfully
-	default:
-		// Queue is full
-		http.Error(w, "service temporarily unavailable", http.StatusServiceUnavailable)
+// CancelOrderHandler cancels a queued or held order so it is never
+// processed. Orders a worker has started or finished can't be cancelled
+// and get 409. Callers can cancel the orders GetOrderHandler would find.
+func CancelOrderHandler(w http.ResponseWriter, r *http.Request, pool *processor.Pool, opts Options) {
+	id := r.PathValue("id")
+	rec, ok := pool.Orders.Get(id)
+	viewer := opts.Views.For(auth.FromContext(r.Context()))
+	if t := callerTenant(r); !ok || !viewer.Owns(rec.Order) || (t != "" && rec.Order.Tenant != t) {
+		problem.Error(w, r, "order not found", http.StatusNotFound)
+		return
+	}
+	switch err := pool.CancelOrder(id); {
+	case errors.Is(err, processor.ErrUnknownOrder):
+		problem.Error(w, r, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, processor.ErrInFlight), errors.Is(err, processor.ErrNotCancellable):
+		problem.Error(w, r, err.Error(), http.StatusConflict)
 		return
+	case err != nil:
+		problem.Error(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if opts.History != nil {
+		opts.History.RecordBy(id, history.EventCancelled, operator(r), "")
 	}
+	writeJSON(w, http.StatusOK, map[string]string{"id": id, "state": string(orderstore.Cancelled)})
 }
 
+// ListOrdersHandler lists orders, newest first, filtered by ?status= (a
+// state such as "processed" or an order status such as "pending"),
+// ?customer= and any number of ?tag=key:value, and paged with ?limit=
+// (default 50) and ?offset=. Callers see the orders GetOrderHandler would
+// find.
+func ListOrdersHandler(w http.ResponseWriter, r *http.Request, pool *processor.Pool, opts Options) {
+	query := r.URL.Query()
+	viewer := opts.Views.For(auth.FromContext(r.Context()))
+	q := orderstore.Query{
+		Status:   query.Get("status"),
+		Customer: query.Get("customer"),
+		Tenant:   callerTenant(r),
+		Limit:    defaultOrderListing,
+	}
+	if viewer.Role == view.Submitter {
+		q.SubmittedBy = viewer.KeyID
+	}
+	for _, tag := range query["tag"] {
+		k, v, ok := strings.Cut(tag, ":")
+		if !ok || k == "" {
+			problem.Error(w, r, "tag must be key:value", http.StatusBadRequest)
+			return
+		}
+		if q.Tags == nil {
+			q.Tags = make(map[string]string)
+		}
+		q.Tags[k] = v
+	}
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxOrderListing {
+			problem.Error(w, r, "limit must be 1-1000", http.StatusBadRequest)
+			return
+		}
+		q.Limit = n
+	}
+	if v := query.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			problem.Error(w, r, "offset must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+		q.Offset = n
+	}
+
+	records, total := pool.Orders.List(q)
+	page := orderPage{Orders: make([]orderStatus, len(records)), Total: total, Limit: q.Limit, Offset: q.Offset}
+	for i, rec := range records {
+		status, err := renderOrder(rec, viewer, opts.Tenants)
+		if err != nil {
+			problem.Error(w, r, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		page.Orders[i] = status
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+// renderOrder applies the order's tenant policy and the viewer's view to
+// a record.
+func renderOrder(rec orderstore.Record, viewer view.Viewer, policies *tenant.Policies) (orderStatus, error) {
+	status := orderStatus{State: rec.State, UpdatedAt: rec.UpdatedAt}
+	var err error
+	order := policies.Apply(models.ProcessedOrder{Order: rec.Order}).Order
+	if status.Order, err = viewer.Order(order); err == nil && rec.Result != nil {
+		status.Result, err = viewer.Result(policies.Apply(*rec.Result))
+	}
+	return status, err
+}
+
+// Backpressure headers on order submissions, so clients can slow down
+// before the queue fills rather than after.
+const (
+	HeaderQueueDepth     = "X-Queue-Depth"
+	HeaderRetryAfterHint = "X-Retry-After-Hint" // milliseconds to wait before the next submission
+)
+
+// maxRetryHint caps the hint, which is the estimated time to work the
+// queues back down to half full.
+const maxRetryHint = 5 * time.Second
+
+// setBackpressure sets the backpressure headers, with a hint of at least
+// floor. A non-zero floor marks a rejection and also sets Retry-After.
+func setBackpressure(w http.ResponseWriter, pool *processor.Pool, floor time.Duration) {
+	depth, capacity := pool.GetQueueLength(), pool.QueueCapacity()
+	var hint time.Duration
+	if excess := depth - capacity/2; excess > 0 {
+		hint = min(pool.DrainTime(excess), maxRetryHint)
+	}
+	hint = max(hint, floor)
+
+	w.Header().Set(HeaderQueueDepth, strconv.Itoa(depth))
+	w.Header().Set(HeaderRetryAfterHint, strconv.FormatInt(hint.Milliseconds(), 10))
+	if floor > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int((hint+time.Second-1)/time.Second)))
+	}
+}
+
+// shuttingDown refuses an order during shutdown. Connection: close makes
+// net/http close the connection after the response.
+func shuttingDown(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Connection", "close")
+	w.Header().Set("Retry-After", "1")
+	localizedError(w, r, models.NewValidationError(models.CodeShuttingDown), http.StatusServiceUnavailable)
+}
+
+// localizedError writes err as a problem in the client's
+// Accept-Language. The problem's code and detail are the first error's;
+// errors lists every error with its field.
+func localizedError(w http.ResponseWriter, r *http.Request, err error, status int) {
+	lang := i18n.Negotiate(r.Header.Get("Accept-Language"))
+	errs := models.AsValidationErrors(err, models.CodeInvalidField)
+
+	localized := make(models.ValidationErrors, len(errs))
+	for i, e := range errs {
+		c := *e
+		c.Message = i18n.Localize(lang, e)
+		localized[i] = &c
+	}
+
+	w.Header().Set("Content-Language", lang)
+	problem.Write(w, r, problem.Details{
+		Status: status,
+		Code:   localized[0].Code,
+		Detail: localized[0].Message,
+		Errors: localized,
+	})
+}
 func generateID() string {
 	var b [16]byte
 	_, _ = rand.Read(b[:])
 	return hex.EncodeToString(b[:])
 }
 
-// GetStatsHandler returns processing statistics
-func GetStatsHandler(w http.ResponseWriter, r *http.Request, pool *processor.Pool) {
+// GetStatsHandler returns processing statistics. With ?scope=cluster it
+// pulls stats from every configured peer and returns the combined view.
+func GetStatsHandler(w http.ResponseWriter, r *http.Request, pool *processor.Pool, peers *cluster.Aggregator) {
 	if r.Method != http.MethodGet {
-		w.WriteHeader(http.StatusMethodNotAllowed)
+		problem.Error(w, r, r.Method+" is not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
 	stats := pool.Stats()
 
 	w.Header().Set("Content-Type", "application/json")
+	if r.URL.Query().Get("scope") == "cluster" {
+		if !peers.Enabled() {
+			problem.Error(w, r, "cluster aggregation is not configured", http.StatusBadRequest)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(peers.Collect(r.Context(), stats))
+		return
+	}
 	_ = json.NewEncoder(w).Encode(stats)
 }
 
+// TopStatsHandler returns the most frequent customers, items and failure
+// reasons. ?k sets the list length (default 10, at most 100).
+func TopStatsHandler(w http.ResponseWriter, r *http.Request, pool *processor.Pool) {
+	k := 10
+	if v := r.URL.Query().Get("k"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 100 {
+			problem.Error(w, r, "k must be 1-100", http.StatusBadRequest)
+			return
+		}
+		k = n
+	}
+	writeJSON(w, http.StatusOK, pool.Top(k))
+}
+
+// CostStatsHandler returns the processing cost per tenant and customer.
+func CostStatsHandler(w http.ResponseWriter, r *http.Request, pool *processor.Pool) {
+	writeJSON(w, http.StatusOK, pool.Costs())
+}
+
+// MetricsHandler serves pool gauges and order counters in the Prometheus
+// text format.
+func MetricsHandler(w http.ResponseWriter, r *http.Request, pool *processor.Pool, recorder *metrics.Recorder, tracker *quality.Tracker) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	WriteMetrics(w, pool, recorder, tracker)
+}
+
+// WriteMetrics writes what MetricsHandler serves, for pushing elsewhere.
+func WriteMetrics(w io.Writer, pool *processor.Pool, recorder *metrics.Recorder, tracker *quality.Tracker) {
+	stats := pool.Stats()
+	metrics.WriteGauge(w, "order_queue_length", "Orders waiting in the queues.", float64(stats.QueueLength))
+	metrics.WriteGauge(w, "order_active_workers", "Workers processing an order.", float64(stats.ActiveWorkers))
+	metrics.WriteGauge(w, "orders_held", "Orders held by operators.", float64(stats.Held))
+	metrics.WriteGauge(w, "order_results_waiting", "Results waiting for the results consumer.", float64(stats.Results.Waiting))
+	metrics.WriteGauge(w, "order_results_on_disk", "Results spilled to disk, waiting for the results consumer.", float64(stats.Results.OnDisk))
+	metrics.WriteCounter(w, "order_timeouts_total", "Orders failed by their processing timeout.", float64(stats.Timeouts))
+	metrics.WriteCounter(w, "order_panics_total", "Panics recovered in pipeline steps and workers.", float64(stats.Panics))
+	metrics.WriteCounter(w, "order_results_delivered_total", "Results put on the results channel.", float64(stats.Results.Delivered))
+	metrics.WriteCounter(w, "order_results_blocked_total", "Results whose worker waited for the results consumer.", float64(stats.Results.Blocked))
+	metrics.WriteCounter(w, "order_results_blocked_seconds_total", "Time workers waited for the results consumer.", float64(stats.Results.BlockedMs)/1000)
+	metrics.WriteCounter(w, "order_results_dropped_total", "Results dropped unread because the results consumer fell behind.", float64(stats.Results.Dropped))
+	metrics.WriteCounter(w, "order_results_spilled_total", "Results spilled to disk because the results consumer fell behind.", float64(stats.Results.Spilled))
+	writeAdmissionMetrics(w, stats.ByPipeline)
+	writeQualityMetrics(w, tracker.Report())
+	recorder.Write(w)
+}
+
+// writeQualityMetrics writes the data quality counters of incoming orders,
+// from which alerts can compute the ratios held to targets.
+func writeQualityMetrics(w io.Writer, report quality.Report) {
+	fmt.Fprintln(w, "# HELP order_quality_submitted_total Orders submitted, by source, tenant and validation outcome.")
+	fmt.Fprintln(w, "# TYPE order_quality_submitted_total counter")
+	for _, g := range report.Groups {
+		fmt.Fprintf(w, "order_quality_submitted_total{source=%q,tenant=%q,outcome=\"accepted\"} %d\n", g.Source, g.Tenant, g.Accepted)
+		fmt.Fprintf(w, "order_quality_submitted_total{source=%q,tenant=%q,outcome=\"rejected\"} %d\n", g.Source, g.Tenant, g.Rejected)
+	}
+	fmt.Fprintln(w, "# HELP order_quality_issues_total Orders missing notes or a priority, or rejected for their address and corrected, by source and tenant.")
+	fmt.Fprintln(w, "# TYPE order_quality_issues_total counter")
+	for _, g := range report.Groups {
+		issues := []struct {
+			name string
+			n    uint64
+		}{
+			{"missing_notes", g.MissingNotes},
+			{"default_priority", g.DefaultPriority},
+			{"address_rejected", g.AddressRejected},
+			{"address_corrected", g.AddressCorrected},
+		}
+		for _, issue := range issues {
+			fmt.Fprintf(w, "order_quality_issues_total{source=%q,tenant=%q,issue=%q} %d\n", g.Source, g.Tenant, issue.name, issue.n)
+		}
+	}
+	fmt.Fprintln(w, "# HELP order_quality_rejections_total Validation errors of submitted orders, by source, tenant and code.")
+	fmt.Fprintln(w, "# TYPE order_quality_rejections_total counter")
+	for _, g := range report.Groups {
+		for _, code := range slices.Sorted(maps.Keys(g.Reasons)) {
+			fmt.Fprintf(w, "order_quality_rejections_total{source=%q,tenant=%q,code=%q} %d\n", g.Source, g.Tenant, code, g.Reasons[code])
+		}
+	}
+}
+
+// writeAdmissionMetrics writes the decisions and state of the pipelines'
+// admission strategies.
+func writeAdmissionMetrics(w io.Writer, byPipeline map[string]models.PipelineStats) {
+	names := slices.Sorted(maps.Keys(byPipeline))
+	fmt.Fprintln(w, "# HELP order_admission_total Orders admitted or refused by admission control, by pipeline and strategy.")
+	fmt.Fprintln(w, "# TYPE order_admission_total counter")
+	for _, name := range names {
+		if a := byPipeline[name].Admission; a != nil {
+			fmt.Fprintf(w, "order_admission_total{pipeline=%q,strategy=%q,decision=\"admitted\"} %d\n", name, a.Strategy, a.Admitted)
+			for _, prio := range slices.Sorted(maps.Keys(a.RefusedByPriority)) {
+				fmt.Fprintf(w, "order_admission_total{pipeline=%q,strategy=%q,decision=\"refused\",priority=%q} %d\n",
+					name, a.Strategy, prio, a.RefusedByPriority[prio])
+			}
+		}
+	}
+	fmt.Fprintln(w, "# HELP order_admission_state State of the admission strategies, such as token_bucket tokens or codel dropping.")
+	fmt.Fprintln(w, "# TYPE order_admission_state gauge")
+	for _, name := range names {
+		if a := byPipeline[name].Admission; a != nil {
+			for _, gauge := range slices.Sorted(maps.Keys(a.Gauges)) {
+				fmt.Fprintf(w, "order_admission_state{pipeline=%q,strategy=%q,name=%q} %g\n", name, a.Strategy, gauge, a.Gauges[gauge])
+			}
+		}
+	}
+}
+
+// SLOHandler returns end-to-end latency SLO compliance and burn rates
+func SLOHandler(w http.ResponseWriter, r *http.Request, tracker *slo.Tracker) {
+	if r.Method != http.MethodGet {
+		problem.Error(w, r, r.Method+" is not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(tracker.Report())
+}
+
 // HealthCheckHandler returns the health status of the service
-func HealthCheckHandler(w http.ResponseWriter, r *http.Request, pool *processor.Pool) {
+func HealthCheckHandler(w http.ResponseWriter, r *http.Request, pool *processor.Pool, mem *memguard.Guard, life *lifecycle.Tracker) {
 	if r.Method != http.MethodGet {
-		w.WriteHeader(http.StatusMethodNotAllowed)
+		problem.Error(w, r, r.Method+" is not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
@@ -89,10 +618,17 @@ func HealthCheckHandler(w http.ResponseWriter, r *http.Request, pool *processor.
 		"pool": map[string]interface{}{
 			"healthy":      pool.IsHealthy(),
 			"queue_length": pool.GetQueueLength(),
-			"workers":      pool.Workers,
+			"workers":      pool.ActiveWorkers(),
 		},
 	}
 
+	if mem != nil {
+		health["memory"] = mem.Status()
+	}
+	if life != nil {
+		health["lifecycle"] = life.Status()
+	}
+
 	if !pool.IsHealthy() {
 		health["status"] = "unhealthy"
 		w.WriteHeader(http.StatusServiceUnavailable)
@@ -101,3 +637,24 @@ func HealthCheckHandler(w http.ResponseWriter, r *http.Request, pool *processor.
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(health)
 }
+
+// LivenessHandler answers GET /healthz: 200 while the process is up,
+// including during shutdown, so orchestrators don't restart an instance
+// that is draining.
+func LivenessHandler(w http.ResponseWriter, r *http.Request, life *lifecycle.Tracker) {
+	status := http.StatusOK
+	if life.State() == lifecycle.Stopped {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, life.Status())
+}
+
+// ReadinessHandler answers GET /readyz: 200 only while the server takes
+// new traffic, so balancers stop routing to it before it drains.
+func ReadinessHandler(w http.ResponseWriter, r *http.Request, pool *processor.Pool, life *lifecycle.Tracker) {
+	status := http.StatusOK
+	if !life.Ready() || pool.Ctx.Err() != nil {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, life.Status())
+}
@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/auth"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/history"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/problem"
+)
+
+const maxCommentLength = 2000
+
+type orderHistory struct {
+	OrderID string          `json:"order_id"`
+	Events  []history.Event `json:"events"`
+}
+
+// OrderHistoryHandler returns the lifecycle events and internal comments of an order
+func OrderHistoryHandler(w http.ResponseWriter, r *http.Request, recorder *history.Recorder) {
+	id := r.PathValue("id")
+	events, err := recorder.History(id)
+	if err != nil {
+		problem.Error(w, r, err.Error(), http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, orderHistory{OrderID: id, Events: events})
+}
+
+// AddCommentHandler attaches an internal operator comment to an order
+func AddCommentHandler(w http.ResponseWriter, r *http.Request, recorder *history.Recorder) {
+	defer r.Body.Close()
+
+	var req struct {
+		Author string `json:"author"`
+		Text   string `json:"text"`
+	}
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		problem.Error(w, r, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	req.Text = strings.TrimSpace(req.Text)
+	if req.Text == "" || len(req.Text) > maxCommentLength {
+		problem.Error(w, r, "text must be 1-2000 characters", http.StatusBadRequest)
+		return
+	}
+	// Prefer the authenticated identity over a self-declared author
+	if key, ok := auth.FromContext(r.Context()); ok && key.Name != "" {
+		req.Author = key.Name
+	}
+
+	event, err := recorder.Comment(r.PathValue("id"), req.Author, req.Text)
+	if err != nil {
+		problem.Error(w, r, err.Error(), http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusCreated, event)
+}
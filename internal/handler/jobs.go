@@ -0,0 +1,54 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/audit"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/auth"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/jobs"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/problem"
+)
+
+// RegisterJobRoutes lets operators follow and cancel background jobs.
+func RegisterJobRoutes(router *http.ServeMux, manager *jobs.Manager, auditLog *audit.Log, authn *auth.Authenticator, requireKey bool) {
+	protect := func(h http.HandlerFunc) http.HandlerFunc {
+		if authn != nil && requireKey {
+			return RequireScope(authn, auth.ScopeAdmin, h)
+		}
+		return h
+	}
+	router.HandleFunc("GET /jobs", protect(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		writeJSON(w, http.StatusOK, manager.List(q.Get("kind"), jobs.State(q.Get("state"))))
+	}))
+	router.HandleFunc("GET /jobs/{id}", protect(func(w http.ResponseWriter, r *http.Request) {
+		job, ok := manager.Get(r.PathValue("id"))
+		if !ok {
+			problem.Error(w, r, jobs.ErrNotFound.Error(), http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, job)
+	}))
+	router.HandleFunc("POST /jobs/{id}/cancel", protect(func(w http.ResponseWriter, r *http.Request) {
+		CancelJobHandler(w, r, manager, auditLog)
+	}))
+}
+
+// CancelJobHandler stops a queued or running job. Cancelling a finished
+// job answers 409 with its final state.
+func CancelJobHandler(w http.ResponseWriter, r *http.Request, manager *jobs.Manager, auditLog *audit.Log) {
+	job, err := manager.Cancel(r.PathValue("id"))
+	switch {
+	case errors.Is(err, jobs.ErrNotFound):
+		problem.Error(w, r, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, jobs.ErrFinished):
+		writeJSON(w, http.StatusConflict, job)
+		return
+	}
+	if auditLog != nil {
+		auditLog.Record(operator(r), "job.cancel", job.ID, job.Kind)
+	}
+	writeJSON(w, http.StatusOK, job)
+}
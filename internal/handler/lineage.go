@@ -0,0 +1,120 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/auth"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/history"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/orderstore"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/pkg/models"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/problem"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/processor"
+)
+
+// maxLineage bounds how many orders a lineage walks, up and down.
+const maxLineage = 1000
+
+// lineageNode is an order in a derivation tree, with the orders derived
+// from it. Attempts counts its processing attempts, retries included, and
+// Requeues how often operators queued it again after it failed.
+type lineageNode struct {
+	ID         string           `json:"id"`
+	ParentID   string           `json:"parent_id,omitempty"`
+	Derivation string           `json:"derivation,omitempty"`
+	State      orderstore.State `json:"state"`
+	Attempts   int              `json:"attempts,omitempty"`
+	Requeues   int              `json:"requeues,omitempty"`
+	CreatedAt  time.Time        `json:"created_at"`
+	Children   []*lineageNode   `json:"children,omitempty"`
+}
+
+// orderLineage is the tree of an order: Root is its oldest known
+// ancestor, whose parent_id, if any, names an order that was forgotten.
+type orderLineage struct {
+	OrderID string       `json:"order_id"`
+	Root    *lineageNode `json:"root"`
+}
+
+// OrderLineageHandler returns the derivation tree an order belongs to,
+// from its oldest known ancestor down to every order derived from it.
+// Orders the caller can't see are left out, along with what derives from
+// them.
+func OrderLineageHandler(w http.ResponseWriter, r *http.Request, pool *processor.Pool, opts Options) {
+	viewer := opts.Views.For(auth.FromContext(r.Context()))
+	t := callerTenant(r)
+	visible := func(o models.Order) bool {
+		return viewer.Owns(o) && (t == "" || o.Tenant == t)
+	}
+	id := r.PathValue("id")
+	rec, ok := pool.Orders.Get(id)
+	if !ok || !visible(rec.Order) {
+		problem.Error(w, r, "order not found", http.StatusNotFound)
+		return
+	}
+
+	seen := map[string]bool{rec.Order.ID: true}
+	for rec.Order.ParentID != "" && len(seen) < maxLineage {
+		parent, ok := pool.Orders.Get(rec.Order.ParentID)
+		if !ok || !visible(parent.Order) || seen[parent.Order.ID] {
+			break
+		}
+		seen[parent.Order.ID] = true
+		rec = parent
+	}
+
+	clear(seen)
+	root := lineageOf(rec, opts.History)
+	seen[root.ID] = true
+	for queue := []*lineageNode{root}; len(queue) > 0 && len(seen) < maxLineage; queue = queue[1:] {
+		node := queue[0]
+		children, _ := pool.Orders.List(orderstore.Query{ParentID: node.ID, Tenant: t})
+		// Oldest first, like the order they were derived in
+		for i := len(children) - 1; i >= 0 && len(seen) < maxLineage; i-- {
+			child := children[i]
+			if seen[child.Order.ID] || !visible(child.Order) {
+				continue
+			}
+			seen[child.Order.ID] = true
+			c := lineageOf(child, opts.History)
+			node.Children = append(node.Children, c)
+			queue = append(queue, c)
+		}
+	}
+	writeJSON(w, http.StatusOK, orderLineage{OrderID: id, Root: root})
+}
+
+func lineageOf(rec orderstore.Record, recorder *history.Recorder) *lineageNode {
+	node := &lineageNode{
+		ID:         rec.Order.ID,
+		ParentID:   rec.Order.ParentID,
+		Derivation: rec.Order.Derivation,
+		State:      rec.State,
+		CreatedAt:  rec.Order.CreatedAt,
+	}
+	if rec.Result != nil {
+		node.Attempts = rec.Result.Attempts
+	}
+	if recorder != nil {
+		events, _ := recorder.History(rec.Order.ID)
+		for _, e := range events {
+			if e.Type == history.EventRequeued {
+				node.Requeues++
+			}
+		}
+	}
+	return node
+}
+
+// checkParent rejects an order derived from one the caller can't see.
+func checkParent(r *http.Request, pool *processor.Pool, opts Options, o models.Order) error {
+	if o.ParentID == "" {
+		return nil
+	}
+	viewer := opts.Views.For(auth.FromContext(r.Context()))
+	rec, ok := pool.Orders.Get(o.ParentID)
+	if t := callerTenant(r); !ok || !viewer.Owns(rec.Order) || (t != "" && rec.Order.Tenant != t) {
+		return models.NewFieldError("parent_id", models.CodeUnknownParent, o.ParentID)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/auth"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/problem"
+)
+
+const maxSignedBody = 1 << 20
+
+// RequireScope rejects requests that don't carry an API key with scope.
+// The authenticated key is stored on the request context.
+func RequireScope(authn *auth.Authenticator, scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key, err := authn.FromRequest(r)
+		if err != nil {
+			problem.Error(w, r, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		if !key.HasScope(scope) {
+			problem.Error(w, r, "api key lacks scope "+scope, http.StatusForbidden)
+			return
+		}
+		next(w, r.WithContext(auth.WithKey(r.Context(), key)))
+	}
+}
+
+// RequireOperator is RequireScope for the admin scope on routes that act
+// on every tenant's orders, which a tenant's admin key is refused.
+func RequireOperator(authn *auth.Authenticator, next http.HandlerFunc) http.HandlerFunc {
+	return RequireScope(authn, auth.ScopeAdmin, func(w http.ResponseWriter, r *http.Request) {
+		if callerTenant(r) != "" {
+			problem.Error(w, r, "api key belongs to a tenant; this route needs an operator key", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	})
+}
+
+// RequireSignature verifies HMAC-signed requests. Unsigned requests are
+// only let through when required is false.
+func RequireSignature(verifier *auth.SignatureVerifier, required bool, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		signature := r.Header.Get(auth.HeaderSignature)
+		if signature == "" {
+			if required {
+				problem.Error(w, r, "request signature required", http.StatusUnauthorized)
+				return
+			}
+			next(w, r)
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxSignedBody))
+		if err != nil {
+			problem.Error(w, r, "unreadable body", http.StatusBadRequest)
+			return
+		}
+		r.Body.Close()
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		err = verifier.Verify(signature, r.Header.Get(auth.HeaderTimestamp), r.Header.Get(auth.HeaderNonce), body)
+		if errors.Is(err, auth.ErrReplayed) {
+			problem.Error(w, r, err.Error(), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			problem.Error(w, r, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// AltSvc advertises an HTTP/3 listener on h3Addr to clients of the TCP
+// server for maxAge.
+func AltSvc(h3Addr string, maxAge time.Duration, next http.Handler) http.Handler {
+	_, port, err := net.SplitHostPort(h3Addr)
+	if err != nil {
+		port = h3Addr
+	}
+	value := fmt.Sprintf(`h3=":%s"; ma=%d`, port, int(maxAge.Seconds()))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Alt-Svc", value)
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,31 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/payload"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/problem"
+)
+
+// orderPayloads are the bodies kept for an order, oldest first; an ID
+// submitted more than once has one per accepted submission.
+type orderPayloads struct {
+	OrderID  string            `json:"order_id"`
+	Payloads []payload.Payload `json:"payloads"`
+}
+
+// OrderPayloadsHandler returns the raw bodies an order was submitted
+// with, for settling disputes about what a client sent.
+func OrderPayloadsHandler(w http.ResponseWriter, r *http.Request, store *payload.Store) {
+	id := r.PathValue("id")
+	payloads, err := store.Get(id)
+	if err != nil {
+		problem.Error(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(payloads) == 0 {
+		problem.Error(w, r, "no payload kept for order", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, orderPayloads{OrderID: id, Payloads: payloads})
+}
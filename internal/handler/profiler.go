@@ -6,7 +6,24 @@ import (
 	"runtime"
 	"runtime/pprof"
 	"runtime/trace"
+	"sync"
 	"time"
+
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/problem"
+)
+
+const (
+	// maxProfileDuration bounds the CPU profiles and execution traces a
+	// request can ask for, as only one of each can run at a time.
+	maxProfileDuration = 5 * time.Minute
+
+	// profileProgressEvery is how often a running profile flushes what it
+	// has written, so clients and proxies see it making progress.
+	profileProgressEvery = time.Second
+
+	// headerProfiled is the trailer giving how long a profile ran for,
+	// which is shorter than asked when the server shut down meanwhile.
+	headerProfiled = "X-Profile-Duration"
 )
 
 func RegisterProfilingRoutes(router *http.ServeMux) {
@@ -32,33 +49,103 @@ func RegisterProfilingRoutes(router *http.ServeMux) {
 
 func CPUTraceHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		w.WriteHeader(http.StatusMethodNotAllowed)
+		problem.Error(w, r, r.Method+" is not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	duration := 30 * time.Second
-	if d := r.URL.Query().Get("duration"); d != "" {
-		dur, err := time.ParseDuration(d)
-		if err != nil {
-			http.Error(w, "invalid duration", http.StatusBadRequest)
-			return
-		}
-		duration = dur
+	duration, ok := profileDuration(w, r, 30*time.Second)
+	if !ok {
+		return
 	}
-	w.Header().Set("Content-Type", "application/octet-stream")
-	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=cpu_profile_%d.prof", time.Now().Unix()))
+	d := &download{ResponseWriter: w, filename: fmt.Sprintf("cpu_profile_%d.prof", time.Now().Unix())}
+	if err := pprof.StartCPUProfile(d); err != nil {
+		problem.Error(w, r, "the CPU is already being profiled", http.StatusConflict)
+		return
+	}
+	profiled := profileFor(d, r, duration)
+	pprof.StopCPUProfile()
+	w.Header().Set(headerProfiled, profiled.String())
+}
+
+// profileDuration reads ?duration, def when it's left out.
+func profileDuration(w http.ResponseWriter, r *http.Request, def time.Duration) (time.Duration, bool) {
+	d := r.URL.Query().Get("duration")
+	if d == "" {
+		return def, true
+	}
+	duration, err := time.ParseDuration(d)
+	if err != nil || duration <= 0 || duration > maxProfileDuration {
+		problem.Error(w, r, fmt.Sprintf("duration must be > 0 and at most %s", maxProfileDuration), http.StatusBadRequest)
+		return 0, false
+	}
+	return duration, true
+}
 
-	if err := pprof.StartCPUProfile(w); err != nil {
-		http.Error(w, "failed to start CPU profile", http.StatusInternalServerError)
+// download is the response of a profile taken over time. Its headers are
+// set by its first write or flush, which come only once the profile has
+// started, so a profile that is already running is refused with a
+// problem instead. The profiler writes from a goroutine of its own while
+// the handler flushes, so the two are serialized.
+type download struct {
+	http.ResponseWriter
+	filename string
+
+	mu      sync.Mutex
+	started bool
+}
+
+// start must be called with d.mu held.
+func (d *download) start() {
+	if d.started {
 		return
 	}
-	defer pprof.StopCPUProfile()
-	time.Sleep(duration)
+	d.started = true
+	h := d.Header()
+	h.Set("Content-Type", "application/octet-stream")
+	h.Set("Content-Disposition", "attachment; filename="+d.filename)
+	h.Set("Trailer", headerProfiled)
+}
+
+func (d *download) Write(p []byte) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.start()
+	return d.ResponseWriter.Write(p)
+}
+
+func (d *download) FlushError() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.start()
+	return http.NewResponseController(d.ResponseWriter).Flush()
+}
+
+// profileFor waits out a profile of duration, flushing the response as it
+// goes, and returns how long it waited. The wait ends early once the
+// request is done: a client that went away, or a server shutting down,
+// doesn't hold the profiler for the rest of it.
+func profileFor(w http.ResponseWriter, r *http.Request, duration time.Duration) time.Duration {
+	rc := http.NewResponseController(w)
+	start := time.Now()
+	done := time.NewTimer(duration)
+	defer done.Stop()
+	progress := time.NewTicker(profileProgressEvery)
+	defer progress.Stop()
+	for {
+		select {
+		case <-done.C:
+			return time.Since(start)
+		case <-r.Context().Done():
+			return time.Since(start)
+		case <-progress.C:
+			_ = rc.Flush()
+		}
+	}
 }
 
 func MemoryTraceHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		w.WriteHeader(http.StatusMethodNotAllowed)
+		problem.Error(w, r, r.Method+" is not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
@@ -68,14 +155,14 @@ func MemoryTraceHandler(w http.ResponseWriter, r *http.Request) {
 	runtime.GC() // Force garbage collection before capturing memory profile
 
 	if err := pprof.WriteHeapProfile(w); err != nil {
-		http.Error(w, "failed to write memory profile", http.StatusInternalServerError)
+		problem.Error(w, r, "failed to write memory profile", http.StatusInternalServerError)
 		return
 	}
 }
 
 func GoroutineTraceHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		w.WriteHeader(http.StatusMethodNotAllowed)
+		problem.Error(w, r, r.Method+" is not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
@@ -83,7 +170,7 @@ func GoroutineTraceHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=goroutine_profile_%d.prof", time.Now().Unix()))
 
 	if err := pprof.Lookup("goroutine").WriteTo(w, 0); err != nil {
-		http.Error(w, "failed to write goroutine profile", http.StatusInternalServerError)
+		problem.Error(w, r, "failed to write goroutine profile", http.StatusInternalServerError)
 		return
 	}
 }
@@ -91,7 +178,7 @@ func GoroutineTraceHandler(w http.ResponseWriter, r *http.Request) {
 // BlockTraceHandler captures block profile
 func BlockTraceHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		w.WriteHeader(http.StatusMethodNotAllowed)
+		problem.Error(w, r, r.Method+" is not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
@@ -99,14 +186,14 @@ func BlockTraceHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=block_profile_%d.prof", time.Now().Unix()))
 
 	if err := pprof.Lookup("block").WriteTo(w, 0); err != nil {
-		http.Error(w, "failed to write block profile", http.StatusInternalServerError)
+		problem.Error(w, r, "failed to write block profile", http.StatusInternalServerError)
 		return
 	}
 }
 
 func MutexTraceHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		w.WriteHeader(http.StatusMethodNotAllowed)
+		problem.Error(w, r, r.Method+" is not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
@@ -114,7 +201,7 @@ func MutexTraceHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=mutex_profile_%d.prof", time.Now().Unix()))
 
 	if err := pprof.Lookup("mutex").WriteTo(w, 0); err != nil {
-		http.Error(w, "failed to write mutex profile", http.StatusInternalServerError)
+		problem.Error(w, r, "failed to write mutex profile", http.StatusInternalServerError)
 		return
 	}
 }
@@ -122,33 +209,30 @@ func MutexTraceHandler(w http.ResponseWriter, r *http.Request) {
 // ExecutionTraceHandler starts execution tracing
 func ExecutionTraceHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		w.WriteHeader(http.StatusMethodNotAllowed)
+		problem.Error(w, r, r.Method+" is not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	duration := 5 * time.Second
-	if d := r.URL.Query().Get("duration"); d != "" {
-		if parsed, err := time.ParseDuration(d); err == nil {
-			duration = parsed
-		}
+	duration, ok := profileDuration(w, r, 5*time.Second)
+	if !ok {
+		return
 	}
 
-	w.Header().Set("Content-Type", "application/octet-stream")
-	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=trace_%d.trace", time.Now().Unix()))
-	if err := trace.Start(w); err != nil {
-		http.Error(w, "Failed to start trace", http.StatusInternalServerError)
+	d := &download{ResponseWriter: w, filename: fmt.Sprintf("trace_%d.trace", time.Now().Unix())}
+	if err := trace.Start(d); err != nil {
+		problem.Error(w, r, "an execution trace is already running", http.StatusConflict)
 		return
 	}
 
-	time.Sleep(duration)
+	profiled := profileFor(d, r, duration)
 	trace.Stop()
-
+	w.Header().Set(headerProfiled, profiled.String())
 }
 
 // GCHandler triggers garbage collection and shows GC stats
 func GCHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		w.WriteHeader(http.StatusMethodNotAllowed)
+		problem.Error(w, r, r.Method+" is not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
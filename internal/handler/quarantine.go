@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/audit"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/auth"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/problem"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/processor"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/quarantine"
+)
+
+// quarantineStatus lists the active rules and the orders they hold.
+type quarantineStatus struct {
+	Rules  []quarantine.Rule     `json:"rules"`
+	Orders []processor.HeldOrder `json:"orders"`
+}
+
+// RegisterQuarantineRoutes lets operators quarantine orders matching a
+// filter. Quarantined orders are held; they are reviewed with the hold
+// routes, released to be processed or cancelled. Rule changes are written
+// to the audit log.
+func RegisterQuarantineRoutes(router *http.ServeMux, pool *processor.Pool, rules *quarantine.Rules, auditLog *audit.Log, authn *auth.Authenticator, requireKey bool) {
+	protect := func(h http.HandlerFunc) http.HandlerFunc {
+		if authn != nil && requireKey {
+			return RequireScope(authn, auth.ScopeAdmin, h)
+		}
+		return h
+	}
+	router.HandleFunc("GET /admin/quarantine", protect(func(w http.ResponseWriter, r *http.Request) {
+		status := quarantineStatus{Rules: rules.List(), Orders: []processor.HeldOrder{}}
+		for _, h := range pool.Held() {
+			if strings.HasPrefix(h.Reason, quarantine.ReasonPrefix) {
+				status.Orders = append(status.Orders, h)
+			}
+		}
+		writeJSON(w, http.StatusOK, status)
+	}))
+	router.HandleFunc("POST /admin/quarantine/rules", protect(func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		var req struct {
+			Filter string `json:"filter"`
+			Reason string `json:"reason"`
+		}
+		dec := json.NewDecoder(io.LimitReader(r.Body, 1<<20))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&req); err != nil {
+			problem.Error(w, r, "invalid JSON", http.StatusBadRequest)
+			return
+		}
+		req.Reason = strings.TrimSpace(req.Reason)
+		if len(req.Reason) > maxCommentLength {
+			problem.Error(w, r, "reason must be at most 2000 characters", http.StatusBadRequest)
+			return
+		}
+		actor := operator(r)
+		rule, err := rules.Add(req.Filter, req.Reason, actor)
+		if err != nil {
+			problem.Error(w, r, "invalid filter: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		auditLog.Record(actor, "quarantine.add", rule.ID, strings.TrimSpace(rule.Filter+" "+rule.Reason))
+		writeJSON(w, http.StatusCreated, rule)
+	}))
+	router.HandleFunc("DELETE /admin/quarantine/rules/{id}", protect(func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		if !rules.Remove(id) {
+			problem.Error(w, r, "no such rule", http.StatusNotFound)
+			return
+		}
+		auditLog.Record(operator(r), "quarantine.remove", id, "")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+}
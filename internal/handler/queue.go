@@ -0,0 +1,336 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/audit"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/auth"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/history"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/pkg/models"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/problem"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/processor"
+)
+
+const maxQueueListing = 1000
+
+// RegisterQueueRoutes exposes the queue inspector for operators: list
+// queued orders, bump one to the front or remove it. Every change is
+// written to the audit log and the order's history.
+func RegisterQueueRoutes(router *http.ServeMux, pool *processor.Pool, auditLog *audit.Log, recorder *history.Recorder, authn *auth.Authenticator, requireKey bool) {
+	protect := func(h http.HandlerFunc) http.HandlerFunc {
+		if authn != nil && requireKey {
+			return RequireOperator(authn, h)
+		}
+		return h
+	}
+	router.HandleFunc("GET /admin/queue", protect(func(w http.ResponseWriter, r *http.Request) {
+		ListQueueHandler(w, r, pool)
+	}))
+	router.HandleFunc("POST /admin/queue/{id}/bump", protect(func(w http.ResponseWriter, r *http.Request) {
+		BumpQueuedHandler(w, r, pool, auditLog, recorder)
+	}))
+	router.HandleFunc("DELETE /admin/queue/{id}", protect(func(w http.ResponseWriter, r *http.Request) {
+		RemoveQueuedHandler(w, r, pool, auditLog, recorder)
+	}))
+	router.HandleFunc("POST /orders/{id}/hold", protect(func(w http.ResponseWriter, r *http.Request) {
+		HoldOrderHandler(w, r, pool, auditLog, recorder)
+	}))
+	router.HandleFunc("POST /orders/{id}/release", protect(func(w http.ResponseWriter, r *http.Request) {
+		ReleaseOrderHandler(w, r, pool, auditLog, recorder)
+	}))
+	router.HandleFunc("POST /orders/{id}/priority", protect(func(w http.ResponseWriter, r *http.Request) {
+		SetPriorityHandler(w, r, pool, auditLog, recorder)
+	}))
+	router.HandleFunc("GET /admin/queue/audit", protect(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, auditLog.Recent(100))
+	}))
+	// The page itself holds no data; it calls the routes above with the
+	// key the operator enters.
+	router.HandleFunc("GET /admin/queue/ui", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Content-Security-Policy", "default-src 'self'; script-src 'unsafe-inline'; style-src 'unsafe-inline'")
+		_, _ = io.WriteString(w, queueInspectorPage)
+	})
+}
+
+// ListQueueHandler returns the queued orders of every pipeline in pop
+// order, at most ?limit (default 100) per pipeline. ?held=true lists the
+// held orders instead.
+func ListQueueHandler(w http.ResponseWriter, r *http.Request, pool *processor.Pool) {
+	if r.URL.Query().Get("held") == "true" {
+		writeJSON(w, http.StatusOK, pool.Held())
+		return
+	}
+	limit := 100
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxQueueListing {
+			problem.Error(w, r, "limit must be 1-1000", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	writeJSON(w, http.StatusOK, pool.Queued(limit))
+}
+
+// BumpQueuedHandler moves a queued order to the front of its queue.
+func BumpQueuedHandler(w http.ResponseWriter, r *http.Request, pool *processor.Pool, auditLog *audit.Log, recorder *history.Recorder) {
+	id := r.PathValue("id")
+	reason, ok := readReason(w, r)
+	if !ok {
+		return
+	}
+	pipeline, err := pool.Bump(id)
+	if err != nil {
+		queueError(w, r, err)
+		return
+	}
+	actor := operator(r)
+	auditLog.Record(actor, "queue.bump", id, reason)
+	if recorder != nil {
+		recorder.RecordBy(id, history.EventBumped, actor, reason)
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"id": id, "pipeline": pipeline, "status": "bumped"})
+}
+
+// RemoveQueuedHandler takes a queued order out of its queue; it is never
+// processed.
+func RemoveQueuedHandler(w http.ResponseWriter, r *http.Request, pool *processor.Pool, auditLog *audit.Log, recorder *history.Recorder) {
+	id := r.PathValue("id")
+	reason, ok := readReason(w, r)
+	if !ok {
+		return
+	}
+	order, err := pool.Remove(id)
+	if err != nil {
+		queueError(w, r, err)
+		return
+	}
+	actor := operator(r)
+	auditLog.Record(actor, "queue.remove", id, reason)
+	if recorder != nil {
+		recorder.RecordBy(id, history.EventRemoved, actor, reason)
+	}
+	writeJSON(w, http.StatusOK, order)
+}
+
+// HoldOrderHandler takes a queued order out of processing until it is
+// released, e.g. while the customer is contacted.
+func HoldOrderHandler(w http.ResponseWriter, r *http.Request, pool *processor.Pool, auditLog *audit.Log, recorder *history.Recorder) {
+	id := r.PathValue("id")
+	reason, ok := readReason(w, r)
+	if !ok {
+		return
+	}
+	if err := pool.Hold(id, reason); err != nil {
+		queueError(w, r, err)
+		return
+	}
+	actor := operator(r)
+	auditLog.Record(actor, "order.hold", id, reason)
+	if recorder != nil {
+		recorder.RecordBy(id, history.EventHeld, actor, reason)
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"id": id, "status": "held"})
+}
+
+// ReleaseOrderHandler puts a held order back at the front of its queue.
+func ReleaseOrderHandler(w http.ResponseWriter, r *http.Request, pool *processor.Pool, auditLog *audit.Log, recorder *history.Recorder) {
+	id := r.PathValue("id")
+	reason, ok := readReason(w, r)
+	if !ok {
+		return
+	}
+	if err := pool.Release(id); err != nil {
+		queueError(w, r, err)
+		return
+	}
+	actor := operator(r)
+	auditLog.Record(actor, "order.release", id, reason)
+	if recorder != nil {
+		recorder.RecordBy(id, history.EventReleased, actor, reason)
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"id": id, "status": "released"})
+}
+
+// SetPriorityHandler changes the priority of a queued or held order with
+// {"priority": 1-3, "reason": "..."}.
+func SetPriorityHandler(w http.ResponseWriter, r *http.Request, pool *processor.Pool, auditLog *audit.Log, recorder *history.Recorder) {
+	defer r.Body.Close()
+	id := r.PathValue("id")
+	var req struct {
+		Priority models.Priority `json:"priority"`
+		Reason   string          `json:"reason"`
+	}
+	dec := json.NewDecoder(io.LimitReader(r.Body, 8<<10))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		problem.Error(w, r, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if !req.Priority.Valid() {
+		problem.Error(w, r, "priority must be 1-3", http.StatusBadRequest)
+		return
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if len(req.Reason) > maxCommentLength {
+		problem.Error(w, r, "reason must be at most 2000 characters", http.StatusBadRequest)
+		return
+	}
+	if err := pool.SetPriority(id, req.Priority); err != nil {
+		queueError(w, r, err)
+		return
+	}
+	detail := strings.TrimSpace(fmt.Sprintf("priority %d %s", req.Priority, req.Reason))
+	actor := operator(r)
+	auditLog.Record(actor, "order.priority", id, detail)
+	if recorder != nil {
+		recorder.RecordBy(id, history.EventReprioritized, actor, detail)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"id": id, "priority": req.Priority, "status": "reprioritized"})
+}
+
+// readReason reads the optional {"reason": "..."} body of a queue change.
+func readReason(w http.ResponseWriter, r *http.Request) (string, bool) {
+	defer r.Body.Close()
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	dec := json.NewDecoder(io.LimitReader(r.Body, 8<<10))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		problem.Error(w, r, "invalid JSON", http.StatusBadRequest)
+		return "", false
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if len(req.Reason) > maxCommentLength {
+		problem.Error(w, r, "reason must be at most 2000 characters", http.StatusBadRequest)
+		return "", false
+	}
+	return req.Reason, true
+}
+
+func queueError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, processor.ErrNotQueued), errors.Is(err, processor.ErrNotHeld):
+		problem.Error(w, r, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, processor.ErrQueueFull), errors.Is(err, processor.ErrDraining), errors.Is(err, processor.ErrWouldMissDeadline):
+		w.Header().Set("Retry-After", "1")
+		problem.Error(w, r, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	problem.Error(w, r, err.Error(), http.StatusInternalServerError)
+}
+
+// operator names the caller for audit entries.
+func operator(r *http.Request) string {
+	if key, ok := auth.FromContext(r.Context()); ok {
+		if key.Name != "" {
+			return key.Name
+		}
+		return key.ID
+	}
+	return "anonymous@" + r.RemoteAddr
+}
+
+const queueInspectorPage = `<!doctype html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Queue inspector</title>
+<style>
+body { font: 14px system-ui, sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; }
+button { margin-right: 4px; }
+#error { color: #b00; }
+</style>
+</head>
+<body>
+<h1>Queue inspector</h1>
+<p>
+  API key <input id="key" type="password" size="40">
+  <button onclick="load()">Refresh</button>
+  <span id="error"></span>
+</p>
+<div id="queues"></div>
+<h2>Recent actions</h2>
+<table id="audit"><tr><th>At</th><th>Actor</th><th>Action</th><th>Order</th><th>Reason</th></tr></table>
+<script>
+const keyInput = document.getElementById("key");
+keyInput.value = sessionStorage.getItem("apiKey") || "";
+
+function api(method, path, body) {
+  sessionStorage.setItem("apiKey", keyInput.value);
+  const headers = {"Content-Type": "application/json"};
+  if (keyInput.value) headers["X-API-Key"] = keyInput.value;
+  return fetch(path, {method, headers, body: body && JSON.stringify(body)}).then(async r => {
+    if (!r.ok) throw new Error(r.status + " " + (await r.text()));
+    return r.json();
+  });
+}
+
+function cell(row, text) {
+  row.insertCell().textContent = text;
+}
+
+function act(method, path, id) {
+  const reason = prompt("Reason for this change (audited):");
+  if (reason === null) return;
+  api(method, path, {reason}).then(load, showError);
+}
+
+function showError(err) {
+  document.getElementById("error").textContent = err.message;
+}
+
+function load() {
+  document.getElementById("error").textContent = "";
+  api("GET", "/admin/queue?limit=200").then(pipelines => {
+    const root = document.getElementById("queues");
+    root.replaceChildren();
+    for (const p of pipelines) {
+      const h = document.createElement("h2");
+      h.textContent = p.pipeline + " (" + p.length + " queued" + (p.spilled ? ", " + p.spilled + " spilled" : "") + ")";
+      root.appendChild(h);
+      const table = document.createElement("table");
+      const head = table.insertRow();
+      for (const t of ["#", "Order", "Customer", "Amount", "Priority", "Created", ""]) cell(head, t);
+      p.orders.forEach((o, i) => {
+        const row = table.insertRow();
+        cell(row, i + 1); cell(row, o.id); cell(row, o.customer); cell(row, o.amount);
+        cell(row, o.priority); cell(row, o.created_at);
+        const actions = row.insertCell();
+        const bump = document.createElement("button");
+        bump.textContent = "Bump";
+        bump.onclick = () => act("POST", "/admin/queue/" + encodeURIComponent(o.id) + "/bump");
+        const remove = document.createElement("button");
+        remove.textContent = "Remove";
+        remove.onclick = () => act("DELETE", "/admin/queue/" + encodeURIComponent(o.id));
+        actions.append(bump, remove);
+      });
+      root.appendChild(table);
+    }
+  }).catch(showError);
+  api("GET", "/admin/queue/audit").then(entries => {
+    const table = document.getElementById("audit");
+    while (table.rows.length > 1) table.deleteRow(1);
+    for (const e of entries) {
+      const row = table.insertRow();
+      cell(row, e.at); cell(row, e.actor); cell(row, e.action); cell(row, e.target); cell(row, e.detail || "");
+    }
+  }).catch(showError);
+}
+
+load();
+</script>
+</body>
+</html>
+`
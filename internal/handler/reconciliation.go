@@ -0,0 +1,46 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/audit"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/auth"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/jobs"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/problem"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/reconcile"
+)
+
+// RegisterReconciliationRoutes shows the last comparison of order states
+// with the system of record and lets operators start one now.
+func RegisterReconciliationRoutes(router *http.ServeMux, reconciler *reconcile.Reconciler, auditLog *audit.Log, authn *auth.Authenticator, requireKey bool) {
+	protect := func(h http.HandlerFunc) http.HandlerFunc {
+		if authn != nil && requireKey {
+			return RequireScope(authn, auth.ScopeAdmin, h)
+		}
+		return h
+	}
+	router.HandleFunc("GET /admin/reconciliation", protect(func(w http.ResponseWriter, r *http.Request) {
+		report, ok := reconciler.Last()
+		if !ok {
+			problem.Error(w, r, "no reconciliation has finished yet", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, report)
+	}))
+	router.HandleFunc("POST /admin/reconciliation/run", protect(func(w http.ResponseWriter, r *http.Request) {
+		job, err := reconciler.Start(operator(r))
+		if errors.Is(err, jobs.ErrBusy) {
+			problem.Error(w, r, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		if err != nil {
+			problem.Error(w, r, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if auditLog != nil {
+			auditLog.Record(operator(r), "reconciliation.run", job.ID, "")
+		}
+		writeJSON(w, http.StatusAccepted, job)
+	}))
+}
@@ -2,30 +2,497 @@ package handler
 
 import (
 	"net/http"
+	"time"
 
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/analytics"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/audit"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/auth"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/cluster"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/customer"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/enrich"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/eventbus"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/forensics"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/history"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/idempotency"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/jobs"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/journal"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/lifecycle"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/memguard"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/metrics"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/orderstore"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/outbound"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/payload"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/payment"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/pkg/models"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/problem"
 	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/processor"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/publish"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/quality"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/quarantine"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/reconcile"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/shipping"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/slo"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/source"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/source/kafka"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/stream"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/subscription"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/tenant"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/tracing"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/transform"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/validation"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/view"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/webhook"
 )
 
-func RegisterRoutes(router *http.ServeMux, pool *processor.Pool) {
+// Options carries the optional subsystems the routes depend on. A nil
+// field disables the related feature.
+type Options struct {
+	// NodeID names this instance, e.g. as the source of change events.
+	NodeID string
+
+	Cluster *cluster.Aggregator
+	Auth    *auth.Authenticator
+	SLO     *slo.Tracker
+
+	// Forensics lists profiles captured on latency or error spikes.
+	Forensics *forensics.Watcher
+
+	// Payloads keeps the raw body of accepted orders for audit; nil keeps
+	// none.
+	Payloads *payload.Store
+
+	// Tags restricts the tags accepted on submitted orders.
+	Tags models.TagPolicy
+
+	// Validators are deployment-specific checks run after built-in validation.
+	Validators validation.Chain
+
+	Subscriptions *subscription.Scheduler
+	Credits       *payment.Ledger
+	History       *history.Recorder
+
+	// Customers resolves customer_id and address_id on submitted orders;
+	// nil rejects orders that reference a customer.
+	Customers *customer.Directory
+
+	// Enricher copies reference data into the tags of valid orders.
+	Enricher *enrich.Enricher
+
+	// Quality counts missing fields and validation failures of submitted
+	// orders per source and tenant.
+	Quality *quality.Tracker
+
+	// Tenants holds per-tenant retention and field visibility policies.
+	Tenants *tenant.Policies
+
+	// Quarantine holds orders matching operator rules for review instead
+	// of queueing them; nil quarantines nothing.
+	Quarantine *quarantine.Rules
+
+	// Views reduces the orders and results returned to submitter keys,
+	// which only see their own orders; nil returns them in full.
+	Views *view.Views
+
+	// Audit records operator actions such as queue changes; nil disables
+	// the queue inspector.
+	Audit *audit.Log
+
+	// Shipping checks requested delivery windows; nil accepts any.
+	Shipping *shipping.Rules
+
+	// Callbacks delivers per-order callbacks; nil rejects orders with a
+	// callback_url.
+	Callbacks *webhook.Callbacks
+
+	// Jobs runs background jobs such as bulk actions, which also need
+	// Audit.
+	Jobs *jobs.Manager
+
+	// Reconciliation compares order states with an external system of
+	// record.
+	Reconciliation *reconcile.Reconciler
+
+	// Metrics serves GET /metrics for Prometheus.
+	Metrics *metrics.Recorder
+
+	// Memory sheds or pauses order intake under heap pressure.
+	Memory *memguard.Guard
+
+	// Idempotency replays the response to retried order submissions; nil
+	// submits every request.
+	Idempotency *idempotency.Cache
+
+	// Lifecycle reports readiness on /readyz and refuses orders once
+	// shutdown begins; nil is always ready.
+	Lifecycle *lifecycle.Tracker
+
+	// Results streams processed orders to SSE clients, with a heartbeat
+	// comment every StreamHeartbeat.
+	Results         *stream.Broker
+	StreamHeartbeat time.Duration
+
+	// Events is the durable result log read by named subscribers.
+	Events *eventbus.Bus
+
+	// Feed streams order lifecycle events to clients of GET /events that
+	// accept text/event-stream.
+	Feed *stream.Feed
+
+	// Transforms reshape streamed and polled results selected with
+	// ?transform=<name>.
+	Transforms transform.Set
+
+	// Analytics exports the event log to an analytics store.
+	Analytics *analytics.Exporter
+
+	// Kafka reads orders from a Kafka topic.
+	Kafka *kafka.Source
+
+	// Sources supervises the ingest adapters.
+	Sources *source.Supervisor
+
+	// Journal is the order journal, if enabled.
+	Journal *journal.Journal
+
+	// Webhooks deliver result events to consumer URLs.
+	Webhooks []*webhook.Dispatcher
+
+	// WebhookRegistry lets clients register webhooks through the API;
+	// nil disables registration.
+	WebhookRegistry *webhook.Registry
+
+	// Publishers publish result events to message brokers.
+	Publishers []*publish.Publisher
+
+	// Outbound is the shared client for calls to other services.
+	Outbound *outbound.Client
+
+	// RequireAPIKey enforces Auth on order submission.
+	RequireAPIKey bool
+
+	// Signatures verifies HMAC-signed order submissions and rejects
+	// replays. RequireSignature rejects unsigned submissions too.
+	Signatures       *auth.SignatureVerifier
+	RequireSignature bool
+}
+
+func RegisterRoutes(router *http.ServeMux, pool *processor.Pool, opts Options) {
+	createOrder := func(w http.ResponseWriter, r *http.Request) {
+		CreateOrderHandler(w, r, pool, opts)
+	}
+	if opts.Signatures != nil {
+		createOrder = RequireSignature(opts.Signatures, opts.RequireSignature, createOrder)
+	}
+	if opts.Auth != nil && opts.RequireAPIKey {
+		createOrder = RequireScope(opts.Auth, auth.ScopeOrdersWrite, createOrder)
+	}
+	createOrder = tracing.Handler("POST /orders", createOrder)
+
+	listOrders := func(w http.ResponseWriter, r *http.Request) {
+		ListOrdersHandler(w, r, pool, opts)
+	}
+	getOrder := func(w http.ResponseWriter, r *http.Request) {
+		GetOrderHandler(w, r, pool, opts)
+	}
+	cancelOrder := func(w http.ResponseWriter, r *http.Request) {
+		CancelOrderHandler(w, r, pool, opts)
+	}
+	orderLineage := func(w http.ResponseWriter, r *http.Request) {
+		OrderLineageHandler(w, r, pool, opts)
+	}
+	if opts.Auth != nil && opts.RequireAPIKey {
+		listOrders = RequireScope(opts.Auth, auth.ScopeOrdersRead, listOrders)
+		getOrder = RequireScope(opts.Auth, auth.ScopeOrdersRead, getOrder)
+		orderLineage = RequireScope(opts.Auth, auth.ScopeOrdersRead, orderLineage)
+		cancelOrder = RequireScope(opts.Auth, auth.ScopeOrdersWrite, cancelOrder)
+	}
+
 	// Order management
 	router.HandleFunc("/orders", func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodPost:
-			CreateOrderHandler(w, r, pool)
+			createOrder(w, r)
+		case http.MethodGet:
+			listOrders(w, r)
 		default:
-			w.WriteHeader(http.StatusMethodNotAllowed)
+			problem.Error(w, r, r.Method+" is not allowed", http.StatusMethodNotAllowed)
 		}
 	})
+	router.HandleFunc("GET /orders/{id}", getOrder)
+	router.HandleFunc("DELETE /orders/{id}", cancelOrder)
+	router.HandleFunc("GET /orders/{id}/lineage", orderLineage)
+	if opts.Payloads != nil {
+		orderPayloads := func(w http.ResponseWriter, r *http.Request) {
+			OrderPayloadsHandler(w, r, opts.Payloads)
+		}
+		if opts.Auth != nil && opts.RequireAPIKey {
+			orderPayloads = RequireOperator(opts.Auth, orderPayloads)
+		}
+		router.HandleFunc("GET /orders/{id}/payloads", orderPayloads)
+	}
+
+	// Order history and internal comments
+	if opts.History != nil {
+		addComment := func(w http.ResponseWriter, r *http.Request) {
+			AddCommentHandler(w, r, opts.History)
+		}
+		orderHistory := func(w http.ResponseWriter, r *http.Request) {
+			OrderHistoryHandler(w, r, opts.History)
+		}
+		if opts.Auth != nil && opts.RequireAPIKey {
+			addComment = RequireOperator(opts.Auth, addComment)
+			orderHistory = RequireOperator(opts.Auth, orderHistory)
+		}
+		router.HandleFunc("POST /orders/{id}/comments", addComment)
+		router.HandleFunc("GET /orders/{id}/history", orderHistory)
+	}
+
+	// Recurring orders
+	if opts.Subscriptions != nil {
+		RegisterSubscriptionRoutes(router, opts.Subscriptions, opts.Tags, opts.Validators, opts.Auth, opts.RequireAPIKey)
+	}
+
+	// Store credit and gift card balances
+	if opts.Credits != nil {
+		RegisterCreditRoutes(router, opts.Credits, opts.Auth, opts.RequireAPIKey)
+	}
+
+	// Saved customers and their address books
+	if opts.Customers != nil {
+		RegisterCustomerRoutes(router, opts.Customers, opts.Auth, opts.RequireAPIKey)
+	}
+
+	// Per-tenant result policies
+	if opts.Tenants != nil {
+		RegisterTenantRoutes(router, opts.Tenants, opts.Auth, opts.RequireAPIKey)
+	}
+
+	// Live results
+	if opts.Results != nil {
+		streamResults := func(w http.ResponseWriter, r *http.Request) {
+			StreamResultsHandler(w, r, opts.Results, opts.StreamHeartbeat, opts.NodeID, opts.Transforms, opts.Views)
+		}
+		if opts.Auth != nil && opts.RequireAPIKey {
+			streamResults = RequireScope(opts.Auth, auth.ScopeOrdersRead, streamResults)
+		}
+		router.HandleFunc("GET /results/stream", streamResults)
+		wsResults := func(w http.ResponseWriter, r *http.Request) {
+			WebSocketResultsHandler(w, r, opts.Results, opts.StreamHeartbeat, opts.NodeID, opts.Transforms, opts.Views)
+		}
+		if opts.Auth != nil && opts.RequireAPIKey {
+			wsResults = RequireScope(opts.Auth, auth.ScopeOrdersRead, wsResults)
+		}
+		router.HandleFunc("GET /ws/results", wsResults)
+		router.HandleFunc("GET /stats/streams", func(w http.ResponseWriter, r *http.Request) {
+			StreamStatsHandler(w, r, opts.Results)
+		})
+	}
+
+	if opts.Audit != nil {
+		RegisterQueueRoutes(router, pool, opts.Audit, opts.History, opts.Auth, opts.RequireAPIKey)
+	}
+	if opts.Jobs != nil {
+		RegisterJobRoutes(router, opts.Jobs, opts.Audit, opts.Auth, opts.RequireAPIKey)
+	}
+	if opts.Audit != nil && opts.Jobs != nil {
+		RegisterBulkRoutes(router, pool, opts.Jobs, opts.Audit, opts.History, opts.Auth, opts.RequireAPIKey)
+		RegisterDeadLetterRoutes(router, pool, opts.Jobs, opts.Transforms, opts.Audit, opts.History, opts.Auth, opts.RequireAPIKey)
+	}
+	if opts.Audit != nil && opts.Quarantine != nil {
+		RegisterQuarantineRoutes(router, pool, opts.Quarantine, opts.Audit, opts.Auth, opts.RequireAPIKey)
+	}
+	if opts.Reconciliation != nil {
+		RegisterReconciliationRoutes(router, opts.Reconciliation, opts.Audit, opts.Auth, opts.RequireAPIKey)
+	}
+	if opts.Sources != nil {
+		RegisterSourceRoutes(router, opts.Sources, opts.Audit, opts.Auth, opts.RequireAPIKey)
+	}
+	if len(pool.Canaries()) > 0 {
+		RegisterCanaryRoutes(router, pool, opts.Audit, opts.Auth, opts.RequireAPIKey)
+	}
+
+	var liveEvents http.HandlerFunc
+	if opts.Feed != nil {
+		liveEvents = func(w http.ResponseWriter, r *http.Request) {
+			StreamEventsHandler(w, r, opts.Feed, opts.StreamHeartbeat, opts.Views)
+		}
+	}
+	if opts.Events != nil {
+		RegisterEventRoutes(router, opts.Events, liveEvents, opts.Auth, opts.RequireAPIKey, opts.NodeID, opts.Transforms, opts.Views)
+	} else if liveEvents != nil {
+		streamEvents := func(w http.ResponseWriter, r *http.Request) {
+			if !acceptsEventStream(r) {
+				problem.Error(w, r, "without an event log, /events is only served as text/event-stream", http.StatusNotAcceptable)
+				return
+			}
+			liveEvents(w, r)
+		}
+		if opts.Auth != nil && opts.RequireAPIKey {
+			streamEvents = RequireScope(opts.Auth, auth.ScopeOrdersRead, streamEvents)
+		}
+		router.HandleFunc("GET /events", streamEvents)
+	}
 
 	// Statistics and monitoring
 	router.HandleFunc("/stats", func(w http.ResponseWriter, r *http.Request) {
-		GetStatsHandler(w, r, pool)
+		GetStatsHandler(w, r, pool, opts.Cluster)
 	})
 
+	// Top customers are email addresses, so like costs they need an
+	// operator key.
+	top := func(w http.ResponseWriter, r *http.Request) {
+		TopStatsHandler(w, r, pool)
+	}
+	if opts.Auth != nil && opts.RequireAPIKey {
+		top = RequireOperator(opts.Auth, top)
+	}
+	router.HandleFunc("GET /stats/top", top)
+
+	costs := func(w http.ResponseWriter, r *http.Request) {
+		CostStatsHandler(w, r, pool)
+	}
+	if opts.Auth != nil && opts.RequireAPIKey {
+		costs = RequireOperator(opts.Auth, costs)
+	}
+	router.HandleFunc("GET /stats/costs", costs)
+
+	// Repositories that outlive the process can count every order, where
+	// /stats starts over at each restart.
+	if summarizer, ok := pool.Orders.(orderstore.Summarizer); ok {
+		router.HandleFunc("GET /stats/orders", func(w http.ResponseWriter, r *http.Request) {
+			summary, err := summarizer.Summary(r.Context())
+			if err != nil {
+				problem.Error(w, r, "order store: "+err.Error(), http.StatusServiceUnavailable)
+				return
+			}
+			writeJSON(w, http.StatusOK, summary)
+		})
+	}
+
+	if opts.Metrics != nil {
+		router.HandleFunc("GET /metrics", func(w http.ResponseWriter, r *http.Request) {
+			MetricsHandler(w, r, pool, opts.Metrics, opts.Quality)
+		})
+	}
+
+	if opts.Analytics != nil {
+		router.HandleFunc("GET /stats/analytics", func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, http.StatusOK, opts.Analytics.Stats())
+		})
+	}
+
+	qualityReport := func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, opts.Quality.Report())
+	}
+	if opts.Auth != nil && opts.RequireAPIKey {
+		qualityReport = RequireOperator(opts.Auth, qualityReport)
+	}
+	router.HandleFunc("GET /stats/quality", qualityReport)
+
+	if len(opts.Enricher.Stats()) > 0 {
+		router.HandleFunc("GET /stats/enrichment", func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, http.StatusOK, opts.Enricher.Stats())
+		})
+	}
+	if opts.Journal != nil {
+		router.HandleFunc("GET /stats/journal", func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, http.StatusOK, opts.Journal.Stats())
+		})
+	}
+	if opts.Kafka != nil {
+		router.HandleFunc("GET /stats/kafka", func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, http.StatusOK, opts.Kafka.Stats())
+		})
+	}
+
+	if len(opts.Webhooks) > 0 {
+		router.HandleFunc("GET /stats/webhooks", func(w http.ResponseWriter, r *http.Request) {
+			stats := make([]webhook.Stats, len(opts.Webhooks))
+			for i, d := range opts.Webhooks {
+				stats[i] = d.Stats()
+			}
+			writeJSON(w, http.StatusOK, stats)
+		})
+	}
+	if len(opts.Webhooks) > 0 || opts.WebhookRegistry != nil {
+		RegisterWebhookRoutes(router, opts.Webhooks, opts.WebhookRegistry, opts.Auth, opts.RequireAPIKey)
+	}
+
+	if len(opts.Publishers) > 0 {
+		router.HandleFunc("GET /stats/publishers", func(w http.ResponseWriter, r *http.Request) {
+			stats := make([]publish.Stats, len(opts.Publishers))
+			for i, p := range opts.Publishers {
+				stats[i] = p.Stats()
+			}
+			writeJSON(w, http.StatusOK, stats)
+		})
+	}
+
+	if opts.Callbacks != nil {
+		router.HandleFunc("GET /stats/callbacks", func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, http.StatusOK, opts.Callbacks.Stats())
+		})
+	}
+	if opts.Outbound != nil {
+		router.HandleFunc("GET /stats/outbound", func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, http.StatusOK, opts.Outbound.Stats())
+		})
+	}
+
+	if opts.SLO != nil {
+		router.HandleFunc("/stats/slo", func(w http.ResponseWriter, r *http.Request) {
+			SLOHandler(w, r, opts.SLO)
+		})
+	}
+
+	if opts.Forensics != nil {
+		captures := func(w http.ResponseWriter, r *http.Request) {
+			list, err := opts.Forensics.Captures()
+			if err != nil {
+				problem.Error(w, r, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			writeJSON(w, http.StatusOK, list)
+		}
+		if opts.Auth != nil && opts.RequireAPIKey {
+			captures = RequireOperator(opts.Auth, captures)
+		}
+		router.HandleFunc("GET /profile/captures", captures)
+	}
+
+	poolSnapshot := func(w http.ResponseWriter, r *http.Request) {
+		PoolSnapshotHandler(w, r, pool)
+	}
+	if opts.Auth != nil && opts.RequireAPIKey {
+		poolSnapshot = RequireOperator(opts.Auth, poolSnapshot)
+	}
+	router.HandleFunc("GET /debug/pool", poolSnapshot)
+
+	workerStats := func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, pool.WorkerStats())
+	}
+	if opts.Auth != nil && opts.RequireAPIKey {
+		workerStats = RequireOperator(opts.Auth, workerStats)
+	}
+	router.HandleFunc("GET /stats/workers", workerStats)
+
+	router.HandleFunc("GET /errors/{code}", ErrorDocHandler)
+
 	// Health check
 	router.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		HealthCheckHandler(w, r, pool)
+		HealthCheckHandler(w, r, pool, opts.Memory, opts.Lifecycle)
+	})
+	router.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		LivenessHandler(w, r, opts.Lifecycle)
 	})
+	router.HandleFunc("GET /readyz", func(w http.ResponseWriter, r *http.Request) {
+		ReadinessHandler(w, r, pool, opts.Lifecycle)
+	})
+
+	// API key management
+	if opts.Auth != nil {
+		RegisterAPIKeyRoutes(router, opts.Auth)
+	}
 
 	RegisterProfilingRoutes(router)
 }
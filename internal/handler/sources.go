@@ -0,0 +1,40 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/audit"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/auth"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/problem"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/source"
+)
+
+// RegisterSourceRoutes lets operators watch the ingest adapters and pause
+// or resume each one.
+func RegisterSourceRoutes(router *http.ServeMux, sources *source.Supervisor, auditLog *audit.Log, authn *auth.Authenticator, requireKey bool) {
+	protect := func(h http.HandlerFunc) http.HandlerFunc {
+		if authn != nil && requireKey {
+			return RequireScope(authn, auth.ScopeAdmin, h)
+		}
+		return h
+	}
+	router.HandleFunc("GET /admin/sources", protect(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, sources.Status())
+	}))
+	control := func(action string, fn func(string) (source.Status, error)) http.HandlerFunc {
+		return protect(func(w http.ResponseWriter, r *http.Request) {
+			status, err := fn(r.PathValue("name"))
+			if errors.Is(err, source.ErrNotFound) {
+				problem.Error(w, r, err.Error(), http.StatusNotFound)
+				return
+			}
+			if auditLog != nil {
+				auditLog.Record(operator(r), "source."+action, status.Name, "")
+			}
+			writeJSON(w, http.StatusOK, status)
+		})
+	}
+	router.HandleFunc("POST /admin/sources/{name}/pause", control("pause", sources.Pause))
+	router.HandleFunc("POST /admin/sources/{name}/resume", control("resume", sources.Resume))
+}
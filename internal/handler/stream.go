@@ -0,0 +1,250 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/auth"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/cdc"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/pkg/models"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/problem"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/stream"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/transform"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/view"
+)
+
+// streamWriteTimeout bounds a single write to a streaming client. A client
+// that stops reading fills its TCP window and is dropped after this long.
+const streamWriteTimeout = 10 * time.Second
+
+// StreamResultsHandler sends processed order results as Server-Sent Events.
+// Heartbeat comments are written every heartbeat so dead connections are
+// noticed even when no results are flowing; the subscription is released
+// as soon as the client goes away. ?format=debezium sends change events
+// with node as the source name and ?transform reshapes each result.
+// ?summary=1s sends one aggregate per interval instead of every result.
+// Submitter keys only receive their own orders, reduced by views.
+func StreamResultsHandler(w http.ResponseWriter, r *http.Request, broker *stream.Broker, heartbeat time.Duration, node string, transforms transform.Set, views *view.Views) {
+	format, t, ok := resultFormat(w, r, transforms)
+	if !ok {
+		return
+	}
+	viewer := views.For(auth.FromContext(r.Context()))
+	if v := r.URL.Query().Get("summary"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < time.Second || d > time.Minute {
+			problem.Error(w, r, "summary must be an interval from 1s to 1m", http.StatusBadRequest)
+			return
+		}
+		if format == formatDebezium {
+			problem.Error(w, r, "summaries can't be sent as change events", http.StatusBadRequest)
+			return
+		}
+		streamSummaries(w, r, broker, heartbeat, d, t, viewer)
+		return
+	}
+	sub := broker.Subscribe()
+	defer sub.Close()
+	send := openEventStream(w)
+	if !send(": subscribed\n\n") {
+		return
+	}
+
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+			if !send(": heartbeat\n\n") {
+				return
+			}
+		case result, ok := <-sub.C:
+			if !ok {
+				// Evicted for falling behind; tell the client why.
+				send("event: disconnected\ndata: subscriber too slow\n\n")
+				return
+			}
+			if !viewer.Owns(result.Order) {
+				continue
+			}
+			var payload any
+			var err error
+			if format == formatDebezium {
+				payload, err = viewer.Change(cdc.FromResult(node, 0, result.ProcessedAt, result))
+			} else {
+				payload, err = viewer.Result(result)
+			}
+			if err != nil {
+				continue
+			}
+			data, err := t.Apply(payload)
+			if err != nil {
+				continue
+			}
+			if !send("event: result\nid: %s\ndata: %s\n\n", result.Order.ID, data) {
+				return
+			}
+		}
+	}
+}
+
+// StreamEventsHandler sends order lifecycle events as Server-Sent Events:
+// order-accepted with the order, order-processed and order-failed with its
+// result, each with its event ID. A client reconnecting with Last-Event-ID
+// first gets the events it missed that are still kept, after an
+// event: skipped with the number that aren't. Submitter keys only receive
+// their own orders, reduced by views.
+func StreamEventsHandler(w http.ResponseWriter, r *http.Request, feed *stream.Feed, heartbeat time.Duration, views *view.Views) {
+	var after uint64
+	lastID := r.Header.Get("Last-Event-ID")
+	if lastID != "" {
+		id, err := strconv.ParseUint(lastID, 10, 64)
+		if err != nil {
+			problem.Error(w, r, "Last-Event-ID must be the ID of an event", http.StatusBadRequest)
+			return
+		}
+		after = id
+	}
+	viewer := views.For(auth.FromContext(r.Context()))
+	sub, backlog, skipped := feed.Subscribe(after, lastID != "")
+	defer sub.Close()
+	send := openEventStream(w)
+	if !send(": subscribed\n\n") {
+		return
+	}
+	if skipped > 0 && !send("event: skipped\ndata: %d\n\n", skipped) {
+		return
+	}
+
+	sendEvent := func(e stream.Event) bool {
+		if !viewer.Owns(e.Owner()) {
+			return true
+		}
+		var payload any
+		var err error
+		if e.Type == stream.EventAccepted {
+			payload, err = viewer.Order(e.Order)
+		} else {
+			payload, err = viewer.Result(e.Result)
+		}
+		if err != nil {
+			return true
+		}
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return true
+		}
+		return send("id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data)
+	}
+	for _, e := range backlog {
+		if !sendEvent(e) {
+			return
+		}
+	}
+
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+			if !send(": heartbeat\n\n") {
+				return
+			}
+		case e, ok := <-sub.C:
+			if !ok {
+				// Fell behind; the client can resume from its last event.
+				send("event: disconnected\ndata: subscriber too slow\n\n")
+				return
+			}
+			if !sendEvent(e) {
+				return
+			}
+		}
+	}
+}
+
+// acceptsEventStream reports whether r asks for Server-Sent Events.
+func acceptsEventStream(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+}
+
+// openEventStream writes the Server-Sent Events headers and returns a
+// function that writes and flushes one chunk. It fails once the client is
+// gone or stops reading.
+func openEventStream(w http.ResponseWriter) func(format string, args ...any) bool {
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	return func(format string, args ...any) bool {
+		_ = rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+		if _, err := fmt.Fprintf(w, format, args...); err != nil {
+			return false
+		}
+		return rc.Flush() == nil
+	}
+}
+
+// streamSummaries sends one summary event per interval that had results,
+// so a busy stream costs the client a fixed rate of events.
+func streamSummaries(w http.ResponseWriter, r *http.Request, broker *stream.Broker, heartbeat, every time.Duration, t *transform.Transform, viewer view.Viewer) {
+	sub := broker.Subscribe()
+	defer sub.Close()
+	send := openEventStream(w)
+	if !send(": subscribed\n\n") {
+		return
+	}
+
+	heartbeats := time.NewTicker(heartbeat)
+	defer heartbeats.Stop()
+	flush := time.NewTicker(every)
+	defer flush.Stop()
+	summary := models.ResultSummary{Start: time.Now()}
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeats.C:
+			if !send(": heartbeat\n\n") {
+				return
+			}
+		case now := <-flush.C:
+			if summary.Count == 0 {
+				summary.Start = now
+				continue
+			}
+			summary.End = now
+			data, err := t.Apply(summary)
+			summary = models.ResultSummary{Start: now}
+			if err != nil {
+				continue
+			}
+			if !send("event: summary\ndata: %s\n\n", data) {
+				return
+			}
+		case result, ok := <-sub.C:
+			if !ok {
+				send("event: disconnected\ndata: subscriber too slow\n\n")
+				return
+			}
+			if viewer.Owns(result.Order) {
+				summary.Add(result)
+			}
+		}
+	}
+}
+
+// StreamStatsHandler returns subscriber and dropped-event metrics.
+func StreamStatsHandler(w http.ResponseWriter, r *http.Request, broker *stream.Broker) {
+	writeJSON(w, http.StatusOK, broker.Stats())
+}
@@ -0,0 +1,134 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/auth"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/pkg/models"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/problem"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/subscription"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/validation"
+)
+
+// RegisterSubscriptionRoutes exposes subscriptions to keys that read
+// orders and changes to them to keys that write orders, each within the
+// key's tenant.
+func RegisterSubscriptionRoutes(router *http.ServeMux, scheduler *subscription.Scheduler, tags models.TagPolicy, validators validation.Chain, authn *auth.Authenticator, requireKey bool) {
+	protect := func(scope string, h http.HandlerFunc) http.HandlerFunc {
+		if authn != nil && requireKey {
+			return RequireScope(authn, scope, h)
+		}
+		return h
+	}
+	router.HandleFunc("POST /subscriptions", protect(auth.ScopeOrdersWrite, func(w http.ResponseWriter, r *http.Request) {
+		CreateSubscriptionHandler(w, r, scheduler, tags, validators)
+	}))
+	router.HandleFunc("GET /subscriptions", protect(auth.ScopeOrdersRead, func(w http.ResponseWriter, r *http.Request) {
+		subs := scheduler.List()
+		if tenant := callerTenant(r); tenant != "" {
+			subs = slices.DeleteFunc(subs, func(sub subscription.Subscription) bool { return sub.Template.Tenant != tenant })
+		}
+		writeJSON(w, http.StatusOK, subs)
+	}))
+	router.HandleFunc("GET /subscriptions/{id}", protect(auth.ScopeOrdersRead, func(w http.ResponseWriter, r *http.Request) {
+		SubscriptionActionHandler(w, r, scheduler, scheduler.Get)
+	}))
+	router.HandleFunc("POST /subscriptions/{id}/pause", protect(auth.ScopeOrdersWrite, func(w http.ResponseWriter, r *http.Request) {
+		SubscriptionActionHandler(w, r, scheduler, scheduler.Pause)
+	}))
+	router.HandleFunc("POST /subscriptions/{id}/resume", protect(auth.ScopeOrdersWrite, func(w http.ResponseWriter, r *http.Request) {
+		SubscriptionActionHandler(w, r, scheduler, scheduler.Resume)
+	}))
+	router.HandleFunc("POST /subscriptions/{id}/cancel", protect(auth.ScopeOrdersWrite, func(w http.ResponseWriter, r *http.Request) {
+		SubscriptionActionHandler(w, r, scheduler, scheduler.Cancel)
+	}))
+}
+
+type createSubscriptionRequest struct {
+	Template models.Order `json:"template"`
+	Interval string       `json:"interval"`           // e.g. "168h"
+	StartAt  time.Time    `json:"start_at,omitempty"` // first run; defaults to one interval from now
+}
+
+// CreateSubscriptionHandler registers a recurring order template. The
+// template is checked like a submitted order, deployment validators
+// included, and every failure is reported together.
+func CreateSubscriptionHandler(w http.ResponseWriter, r *http.Request, scheduler *subscription.Scheduler, tags models.TagPolicy, validators validation.Chain) {
+	defer r.Body.Close()
+
+	var req createSubscriptionRequest
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		problem.Error(w, r, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	interval, err := time.ParseDuration(req.Interval)
+	if err != nil {
+		problem.Error(w, r, "invalid interval", http.StatusBadRequest)
+		return
+	}
+
+	// Validate the template as if it were a real order, submitted by the
+	// caller
+	template := req.Template
+	template.Canonicalize()
+	template.SetDefaultValues()
+	template.Tenant, template.SubmittedBy, template.HeldMs = "", "", 0
+	if key, ok := auth.FromContext(r.Context()); ok {
+		template.Tenant, template.SubmittedBy = key.Tenant, key.ID
+	}
+	check := template
+	check.ID = "template"
+	var errs models.ValidationErrors
+	for _, err := range []error{check.Validate(), check.ValidateTags(tags), validators.Validate(check)} {
+		if err != nil {
+			errs = append(errs, models.AsValidationErrors(err, models.CodeInvalidField)...)
+		}
+	}
+	if len(errs) > 0 {
+		localizedError(w, r, errs, http.StatusBadRequest)
+		return
+	}
+
+	sub, err := scheduler.Create(template, interval, req.StartAt)
+	if err != nil {
+		problem.Error(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusCreated, sub)
+}
+
+// SubscriptionActionHandler applies action to the subscription in the path.
+// Subscriptions of other tenants are not found.
+func SubscriptionActionHandler(w http.ResponseWriter, r *http.Request, scheduler *subscription.Scheduler, action func(id string) (subscription.Subscription, error)) {
+	id := r.PathValue("id")
+	if tenant := callerTenant(r); tenant != "" {
+		if sub, err := scheduler.Get(id); err != nil || sub.Template.Tenant != tenant {
+			problem.Error(w, r, subscription.ErrNotFound.Error(), http.StatusNotFound)
+			return
+		}
+	}
+	sub, err := action(id)
+	switch {
+	case errors.Is(err, subscription.ErrNotFound):
+		problem.Error(w, r, err.Error(), http.StatusNotFound)
+	case errors.Is(err, subscription.ErrCancelled):
+		problem.Error(w, r, err.Error(), http.StatusConflict)
+	case err != nil:
+		problem.Error(w, r, "internal error", http.StatusInternalServerError)
+	default:
+		writeJSON(w, http.StatusOK, sub)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
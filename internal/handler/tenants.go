@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"maps"
+	"net/http"
+
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/auth"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/problem"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/tenant"
+)
+
+// RegisterTenantRoutes lets tenants manage their result retention and
+// field visibility. Tenant admins only see and change their own tenant's
+// policy; the bootstrap admin manages every tenant.
+func RegisterTenantRoutes(router *http.ServeMux, policies *tenant.Policies, authn *auth.Authenticator, requireKey bool) {
+	protect := func(h http.HandlerFunc) http.HandlerFunc {
+		own := func(w http.ResponseWriter, r *http.Request) {
+			if t := callerTenant(r); t != "" && r.PathValue("tenant") != "" && r.PathValue("tenant") != t {
+				problem.Error(w, r, "cannot manage another tenant", http.StatusForbidden)
+				return
+			}
+			h(w, r)
+		}
+		if authn != nil && requireKey {
+			return RequireScope(authn, auth.ScopeAdmin, own)
+		}
+		return own
+	}
+	router.HandleFunc("GET /tenants/policies", protect(func(w http.ResponseWriter, r *http.Request) {
+		all := policies.List()
+		if t := callerTenant(r); t != "" {
+			maps.DeleteFunc(all, func(name string, _ tenant.Policy) bool { return name != t })
+		}
+		writeJSON(w, http.StatusOK, all)
+	}))
+	router.HandleFunc("GET /tenants/{tenant}/policy", protect(func(w http.ResponseWriter, r *http.Request) {
+		p, ok := policies.Get(r.PathValue("tenant"))
+		if !ok {
+			problem.Error(w, r, "no policy for tenant", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, p)
+	}))
+	router.HandleFunc("PUT /tenants/{tenant}/policy", protect(func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		var p tenant.Policy
+		if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&p); err != nil {
+			problem.Error(w, r, "invalid JSON: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := policies.Set(r.PathValue("tenant"), p); err != nil {
+			problem.Error(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, http.StatusOK, p)
+	}))
+	router.HandleFunc("DELETE /tenants/{tenant}/policy", protect(func(w http.ResponseWriter, r *http.Request) {
+		if !policies.Delete(r.PathValue("tenant")) {
+			problem.Error(w, r, "no policy for tenant", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+}
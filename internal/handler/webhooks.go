@@ -0,0 +1,178 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/auth"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/jobs"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/problem"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/webhook"
+)
+
+// RegisterWebhookRoutes exposes tools for debugging webhook receivers and,
+// with registry set, lets clients register webhooks of their own.
+// Configured consumers are addressed by their name and need an admin key;
+// registered webhooks by their ID, and keys of their tenant manage them:
+// reading needs orders:read, changes and test deliveries orders:write.
+func RegisterWebhookRoutes(router *http.ServeMux, webhooks []*webhook.Dispatcher, registry *webhook.Registry, authn *auth.Authenticator, requireKey bool) {
+	protect := func(scope string, h http.HandlerFunc) http.HandlerFunc {
+		if authn != nil && requireKey {
+			return RequireScope(authn, scope, h)
+		}
+		return h
+	}
+	find := func(w http.ResponseWriter, r *http.Request) *webhook.Dispatcher {
+		id := r.PathValue("id")
+		if registry != nil {
+			if reg, d, ok := registry.Get(id); ok && ownsWebhook(r, reg) {
+				return d
+			}
+		}
+		// Configured webhooks carry every tenant's orders.
+		key, _ := auth.FromContext(r.Context())
+		if authn == nil || !requireKey || (key.HasScope(auth.ScopeAdmin) && key.Tenant == "") {
+			for _, d := range webhooks {
+				if d.Name() == id {
+					return d
+				}
+			}
+		}
+		problem.Error(w, r, "webhook not found", http.StatusNotFound)
+		return nil
+	}
+	if registry != nil {
+		router.HandleFunc("POST /webhooks", protect(auth.ScopeOrdersWrite, func(w http.ResponseWriter, r *http.Request) {
+			CreateWebhookHandler(w, r, registry)
+		}))
+		router.HandleFunc("GET /webhooks", protect(auth.ScopeOrdersRead, func(w http.ResponseWriter, r *http.Request) {
+			tenant := callerTenant(r)
+			if tenant == "" {
+				tenant = r.URL.Query().Get("tenant")
+			}
+			writeJSON(w, http.StatusOK, registry.List(tenant))
+		}))
+		router.HandleFunc("GET /webhooks/{id}", protect(auth.ScopeOrdersRead, func(w http.ResponseWriter, r *http.Request) {
+			reg, d, ok := registry.Get(r.PathValue("id"))
+			if !ok || !ownsWebhook(r, reg) {
+				problem.Error(w, r, "webhook not found", http.StatusNotFound)
+				return
+			}
+			writeJSON(w, http.StatusOK, registeredWebhook{Webhook: reg, Stats: d.Stats()})
+		}))
+		router.HandleFunc("DELETE /webhooks/{id}", protect(auth.ScopeOrdersWrite, func(w http.ResponseWriter, r *http.Request) {
+			reg, _, ok := registry.Get(r.PathValue("id"))
+			if !ok || !ownsWebhook(r, reg) || registry.Delete(reg.ID) != nil {
+				problem.Error(w, r, "webhook not found", http.StatusNotFound)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		}))
+	}
+	router.HandleFunc("POST /webhooks/{id}/test", protect(auth.ScopeOrdersWrite, func(w http.ResponseWriter, r *http.Request) {
+		if d := find(w, r); d != nil {
+			WebhookTestHandler(w, r, d)
+		}
+	}))
+	router.HandleFunc("GET /webhooks/{id}/deliveries", protect(auth.ScopeOrdersRead, func(w http.ResponseWriter, r *http.Request) {
+		if d := find(w, r); d != nil {
+			attempts := d.Attempts()
+			if order := r.URL.Query().Get("order"); order != "" {
+				attempts = slices.DeleteFunc(attempts, func(a webhook.Attempt) bool { return a.Order != order })
+			}
+			writeJSON(w, http.StatusOK, attempts)
+		}
+	}))
+	router.HandleFunc("POST /webhooks/{id}/digest", protect(auth.ScopeOrdersWrite, func(w http.ResponseWriter, r *http.Request) {
+		if d := find(w, r); d != nil {
+			WebhookDigestHandler(w, r, d)
+		}
+	}))
+}
+
+type createWebhookRequest struct {
+	Tenant string   `json:"tenant"`
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	Secret string   `json:"secret"`
+}
+
+// registeredWebhook is a registered webhook with its delivery status.
+type registeredWebhook struct {
+	Webhook webhook.Registration `json:"webhook"`
+	Stats   webhook.Stats        `json:"stats"`
+}
+
+// CreateWebhookHandler registers a webhook for the caller's tenant. The
+// bootstrap admin may name a tenant, or none for every tenant's orders.
+func CreateWebhookHandler(w http.ResponseWriter, r *http.Request, registry *webhook.Registry) {
+	defer r.Body.Close()
+
+	var req createWebhookRequest
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		problem.Error(w, r, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if tenant := callerTenant(r); tenant != "" {
+		if req.Tenant != "" && req.Tenant != tenant {
+			problem.Error(w, r, "cannot register webhooks for another tenant", http.StatusForbidden)
+			return
+		}
+		req.Tenant = tenant
+	}
+
+	reg, err := registry.Register(r.Context(), webhook.Registration{
+		Tenant:    req.Tenant,
+		URL:       req.URL,
+		Events:    req.Events,
+		Secret:    req.Secret,
+		CreatedBy: operator(r),
+	})
+	switch {
+	case errors.Is(err, webhook.ErrTooMany):
+		problem.Error(w, r, err.Error(), http.StatusConflict)
+	case err != nil:
+		problem.Error(w, r, err.Error(), http.StatusBadRequest)
+	default:
+		writeJSON(w, http.StatusCreated, reg.Public())
+	}
+}
+
+// ownsWebhook reports whether the caller may manage reg: keys of its
+// tenant, and the bootstrap admin.
+func ownsWebhook(r *http.Request, reg webhook.Registration) bool {
+	tenant := callerTenant(r)
+	return tenant == "" || reg.Tenant == tenant
+}
+
+// WebhookDigestHandler sends a digest of the consumer's pending events
+// now, as a background job, rather than at the next interval.
+func WebhookDigestHandler(w http.ResponseWriter, r *http.Request, d *webhook.Dispatcher) {
+	job, err := d.StartDigest(operator(r))
+	switch {
+	case errors.Is(err, webhook.ErrNoDigest):
+		problem.Error(w, r, err.Error(), http.StatusConflict)
+	case errors.Is(err, jobs.ErrBusy):
+		problem.Error(w, r, err.Error(), http.StatusServiceUnavailable)
+	case err != nil:
+		problem.Error(w, r, err.Error(), http.StatusInternalServerError)
+	default:
+		writeJSON(w, http.StatusAccepted, job)
+	}
+}
+
+// WebhookTestHandler sends a sample payload to the consumer and reports
+// the receiver's response. A receiver error is part of the report, not a
+// failure of the request.
+func WebhookTestHandler(w http.ResponseWriter, r *http.Request, d *webhook.Dispatcher) {
+	attempt, err := d.Test(r.Context())
+	if err != nil {
+		problem.Error(w, r, "encode sample: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, attempt)
+}
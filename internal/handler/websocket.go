@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/coder/websocket"
+
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/auth"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/cdc"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/pkg/models"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/problem"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/stream"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/transform"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/view"
+)
+
+// resultFilter selects the results a WebSocket connection receives.
+type resultFilter struct {
+	customer string
+	status   models.Status
+	success  *bool // nil for both outcomes
+}
+
+// parseResultFilter reads ?customer, ?status and ?outcome (success or
+// failure); each one left out matches every result.
+func parseResultFilter(w http.ResponseWriter, r *http.Request) (resultFilter, bool) {
+	q := r.URL.Query()
+	f := resultFilter{customer: q.Get("customer"), status: models.Status(q.Get("status"))}
+	if f.status != "" && !f.status.Valid() {
+		problem.Error(w, r, "unknown status "+string(f.status), http.StatusBadRequest)
+		return f, false
+	}
+	switch outcome := q.Get("outcome"); outcome {
+	case "":
+	case "success", "failure":
+		success := outcome == "success"
+		f.success = &success
+	default:
+		problem.Error(w, r, "outcome must be success or failure", http.StatusBadRequest)
+		return f, false
+	}
+	return f, true
+}
+
+func (f resultFilter) match(result models.ProcessedOrder) bool {
+	return (f.customer == "" || result.Order.Customer == f.customer) &&
+		(f.status == "" || result.Order.Status == f.status) &&
+		(f.success == nil || result.Success == *f.success)
+}
+
+// WebSocketResultsHandler upgrades to a WebSocket and sends each processed
+// order result matching the connection's filters as a text message, in
+// the same shapes as StreamResultsHandler. The connection is pinged every
+// heartbeat; messages from the client are discarded. A client that falls
+// behind is closed with status 1013 (try again later).
+func WebSocketResultsHandler(w http.ResponseWriter, r *http.Request, broker *stream.Broker, heartbeat time.Duration, node string, transforms transform.Set, views *view.Views) {
+	format, t, ok := resultFormat(w, r, transforms)
+	if !ok {
+		return
+	}
+	filter, ok := parseResultFilter(w, r)
+	if !ok {
+		return
+	}
+	viewer := views.For(auth.FromContext(r.Context()))
+
+	conn, err := websocket.Accept(w, r, nil)
+	if err != nil {
+		return // Accept has written the response
+	}
+	defer conn.CloseNow()
+	sub := broker.Subscribe()
+	defer sub.Close()
+	ctx := conn.CloseRead(r.Context())
+
+	send := func(ctx context.Context, data []byte) bool {
+		ctx, cancel := context.WithTimeout(ctx, streamWriteTimeout)
+		defer cancel()
+		return conn.Write(ctx, websocket.MessageText, data) == nil
+	}
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			// Unless the client closed the connection, the server is
+			// shutting down.
+			if r.Context().Err() != nil {
+				conn.Close(websocket.StatusGoingAway, "server shutting down")
+			}
+			return
+		case <-ticker.C:
+			pingCtx, cancel := context.WithTimeout(ctx, streamWriteTimeout)
+			err := conn.Ping(pingCtx)
+			cancel()
+			if err != nil {
+				return
+			}
+		case result, ok := <-sub.C:
+			if !ok {
+				conn.Close(websocket.StatusTryAgainLater, "subscriber too slow")
+				return
+			}
+			if !viewer.Owns(result.Order) || !filter.match(result) {
+				continue
+			}
+			var payload any
+			if format == formatDebezium {
+				payload, err = viewer.Change(cdc.FromResult(node, 0, result.ProcessedAt, result))
+			} else {
+				payload, err = viewer.Result(result)
+			}
+			if err != nil {
+				continue
+			}
+			data, err := t.Apply(payload)
+			if err != nil {
+				continue
+			}
+			if !send(ctx, data) {
+				return
+			}
+		}
+	}
+}
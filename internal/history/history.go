@@ -0,0 +1,102 @@
+package history
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Event types.
+const (
+	EventAccepted      = "accepted"
+	EventRejected      = "rejected"
+	EventProcessed     = "processed"
+	EventFailed        = "failed"
+	EventComment       = "comment"
+	EventBumped        = "bumped"        // moved to the front of its queue by an operator
+	EventRemoved       = "removed"       // taken out of its queue by an operator
+	EventHeld          = "held"          // kept from processing by an operator
+	EventReleased      = "released"      // returned to its queue after a hold
+	EventReprioritized = "reprioritized" // priority changed by an operator
+	EventCancelled     = "cancelled"     // cancelled by its submitter before processing
+	EventRequeued      = "requeued"      // queued again by an operator after failing
+)
+
+var ErrUnknownOrder = errors.New("order not found")
+
+// Event is one entry in an order's history. Comments are internal operator
+// notes and are never shown to customers, unlike Order.Notes.
+type Event struct {
+	At     time.Time `json:"at"`
+	Type   string    `json:"type"`
+	Detail string    `json:"detail,omitempty"`
+	Author string    `json:"author,omitempty"`
+}
+
+// Recorder keeps the history of the most recent orders in memory. When
+// more than max orders are tracked the oldest is forgotten.
+type Recorder struct {
+	max int
+
+	mu     sync.Mutex
+	events map[string][]Event
+	order  []string // insertion order for eviction
+}
+
+func NewRecorder(max int) *Recorder {
+	return &Recorder{
+		max:    max,
+		events: make(map[string][]Event),
+	}
+}
+
+// Record appends an event to an order's history, starting it if needed.
+func (r *Recorder) Record(orderID, typ, detail string) {
+	r.add(orderID, Event{At: time.Now(), Type: typ, Detail: detail})
+}
+
+// RecordBy is Record for an action taken by author.
+func (r *Recorder) RecordBy(orderID, typ, author, detail string) {
+	r.add(orderID, Event{At: time.Now(), Type: typ, Detail: detail, Author: author})
+}
+
+func (r *Recorder) add(orderID string, e Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.events[orderID]; !ok {
+		r.order = append(r.order, orderID)
+		if len(r.order) > r.max {
+			delete(r.events, r.order[0])
+			r.order = r.order[1:]
+		}
+	}
+	r.events[orderID] = append(r.events[orderID], e)
+}
+
+// Comment attaches an internal comment to a known order.
+func (r *Recorder) Comment(orderID, author, text string) (Event, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	events, ok := r.events[orderID]
+	if !ok {
+		return Event{}, ErrUnknownOrder
+	}
+	e := Event{At: time.Now(), Type: EventComment, Detail: text, Author: author}
+	r.events[orderID] = append(events, e)
+	return e, nil
+}
+
+// History returns an order's events in the order they happened.
+func (r *Recorder) History(orderID string) ([]Event, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	events, ok := r.events[orderID]
+	if !ok {
+		return nil, ErrUnknownOrder
+	}
+	return slices.Clone(events), nil
+}
@@ -0,0 +1,194 @@
+package i18n
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/pkg/models"
+)
+
+// DefaultLanguage is used when the client accepts none of the catalogs.
+// Its messages come from models.Messages.
+const DefaultLanguage = "en"
+
+// catalogs holds translations keyed by language, then message code. Codes
+// missing from a catalog fall back to English.
+var catalogs = map[string]map[string]string{
+	"es": {
+		models.CodeIDRequired:         "el id es obligatorio",
+		models.CodeCustomerRequired:   "el cliente es obligatorio",
+		models.CodeStatusRequired:     "el estado es obligatorio",
+		models.CodeInvalidStatus:      "estado no válido",
+		models.CodeAddressRequired:    "la dirección es obligatoria",
+		models.CodeAmountNotPositive:  "el importe debe ser > 0",
+		models.CodeItemsEmpty:         "los artículos no pueden estar vacíos",
+		models.CodeInvalidPriority:    "prioridad no válida (debe ser 1, 2 o 3)",
+		models.CodeTooManyTags:        "demasiadas etiquetas (máximo %d)",
+		models.CodeInvalidTag:         "las claves de etiqueta deben tener 1-%d caracteres y los valores como máximo %d",
+		models.CodeTagNotAllowed:      "la etiqueta %q no está permitida",
+		models.CodeInvalidTagValue:    "valor %q no válido para la etiqueta %q",
+		models.CodeAmountOverLimit:    "el importe del pedido supera el límite",
+		models.CodeTooManyItems:       "demasiados artículos en el pedido",
+		models.CodeInvalidJSON:        "JSON no válido",
+		models.CodeUnknownField:       "campo desconocido %q",
+		models.CodeInvalidField:       "el campo %q tiene un tipo incorrecto",
+		models.CodeInvalidAmount:      "el importe debe ser un número finito con como máximo 2 decimales",
+		models.CodeInvalidTimestamp:   "las fechas deben ser RFC3339, p. ej. 2024-01-15T10:30:00Z",
+		models.CodeServiceUnavailable: "servicio temporalmente no disponible",
+		models.CodeMemoryPressure:     "el servidor tiene poca memoria, reintente más tarde",
+		models.CodeShuttingDown:       "el servidor se está apagando, reintente más tarde",
+		models.CodeWouldMissDeadline:  "el pedido no puede procesarse antes de su plazo con la carga actual",
+		models.CodeResultPriority:     "Pedido marcado para procesamiento prioritario",
+		models.CodeResultExpedited:    "Pedido acelerado por alta prioridad",
+		models.CodeResultCompleted:    "Procesamiento del pedido completado",
+		models.CodeResultFailed:       "Error al procesar el pedido",
+
+		models.CodeCallbacksDisabled:      "este servidor no admite callback_url",
+		models.CodeInvalidCallbackURL:     "callback_url debe ser una URL http o https absoluta",
+		models.CodeCallbackHostNotAllowed: "el host de callback %q no está permitido",
+
+		models.CodeInvalidDeliveryWindow:     "requested_delivery_window necesita un inicio anterior a su fin",
+		models.CodeDeliveryWindowTooFar:      "requested_delivery_window puede empezar como máximo %d días después",
+		models.CodeDeliveryWindowBlackout:    "requested_delivery_window solo cubre fechas bloqueadas",
+		models.CodeDeliveryWindowUnreachable: "requested_delivery_window termina antes de la primera entrega posible el %s",
+		models.CodeNoShippingService:         "ningún servicio de envío puede entregar dentro de la ventana solicitada",
+
+		models.CodeUnknownCustomer:        "customer_id %q no existe",
+		models.CodeUnknownAddress:         "address_id %q no está en la libreta de direcciones del cliente",
+		models.CodeAddressIDNeedsCustomer: "address_id requiere customer_id",
+
+		models.CodeUnknownParent:     "parent_id %q no existe",
+		models.CodeInvalidParent:     "parent_id debe nombrar otro pedido",
+		models.CodeInvalidDerivation: "derivation debe ser amendment, split o replay, con un parent_id",
+
+		models.CodeDeadlinePassed:     "deadline ya ha pasado",
+		models.CodeDeadlineExceeded:   "deadline venció antes del paso %s",
+		models.CodeStepBudgetExceeded: "el paso %s superó su presupuesto de %s",
+		models.CodeTimeout:            "el procesamiento superó su tiempo límite de %s en el paso %s",
+		models.CodePanic:              "el procesamiento falló inesperadamente",
+	},
+	"de": {
+		models.CodeIDRequired:         "ID ist erforderlich",
+		models.CodeCustomerRequired:   "Kunde ist erforderlich",
+		models.CodeStatusRequired:     "Status ist erforderlich",
+		models.CodeInvalidStatus:      "ungültiger Status",
+		models.CodeAddressRequired:    "Adresse ist erforderlich",
+		models.CodeAmountNotPositive:  "Betrag muss > 0 sein",
+		models.CodeItemsEmpty:         "Artikelliste darf nicht leer sein",
+		models.CodeInvalidPriority:    "ungültige Priorität (muss 1, 2 oder 3 sein)",
+		models.CodeTooManyTags:        "zu viele Tags (maximal %d)",
+		models.CodeInvalidTag:         "Tag-Schlüssel müssen 1-%d Zeichen und Werte höchstens %d Zeichen lang sein",
+		models.CodeTagNotAllowed:      "Tag %q ist nicht erlaubt",
+		models.CodeInvalidTagValue:    "ungültiger Wert %q für Tag %q",
+		models.CodeAmountOverLimit:    "Bestellbetrag überschreitet das Limit",
+		models.CodeTooManyItems:       "zu viele Artikel in der Bestellung",
+		models.CodeInvalidJSON:        "ungültiges JSON",
+		models.CodeUnknownField:       "unbekanntes Feld %q",
+		models.CodeInvalidField:       "Feld %q hat den falschen Typ",
+		models.CodeInvalidAmount:      "Betrag muss eine endliche Zahl mit höchstens 2 Nachkommastellen sein",
+		models.CodeInvalidTimestamp:   "Zeitangaben müssen RFC3339 sein, z. B. 2024-01-15T10:30:00Z",
+		models.CodeServiceUnavailable: "Dienst vorübergehend nicht verfügbar",
+		models.CodeMemoryPressure:     "Server hat zu wenig Speicher, bitte später erneut versuchen",
+		models.CodeShuttingDown:       "Server wird heruntergefahren, bitte später erneut versuchen",
+		models.CodeWouldMissDeadline:  "Die Bestellung kann bei der aktuellen Last nicht vor ihrer Frist bearbeitet werden",
+		models.CodeResultPriority:     "Bestellung für bevorzugte Bearbeitung markiert",
+		models.CodeResultExpedited:    "Bestellung wegen hoher Priorität beschleunigt",
+		models.CodeResultCompleted:    "Bestellungsbearbeitung abgeschlossen",
+		models.CodeResultFailed:       "Bestellungsbearbeitung fehlgeschlagen",
+
+		models.CodeCallbacksDisabled:      "callback_url wird von diesem Server nicht unterstützt",
+		models.CodeInvalidCallbackURL:     "callback_url muss eine absolute http- oder https-URL sein",
+		models.CodeCallbackHostNotAllowed: "Callback-Host %q ist nicht erlaubt",
+
+		models.CodeInvalidDeliveryWindow:     "requested_delivery_window braucht einen Beginn vor dem Ende",
+		models.CodeDeliveryWindowTooFar:      "requested_delivery_window darf höchstens %d Tage im Voraus beginnen",
+		models.CodeDeliveryWindowBlackout:    "requested_delivery_window umfasst nur Sperrtage",
+		models.CodeDeliveryWindowUnreachable: "requested_delivery_window endet vor der frühestmöglichen Lieferung am %s",
+		models.CodeNoShippingService:         "kein Versanddienst kann im gewünschten Zeitraum liefern",
+
+		models.CodeUnknownCustomer:        "customer_id %q existiert nicht",
+		models.CodeUnknownAddress:         "address_id %q ist nicht im Adressbuch des Kunden",
+		models.CodeAddressIDNeedsCustomer: "address_id erfordert customer_id",
+
+		models.CodeUnknownParent:     "parent_id %q existiert nicht",
+		models.CodeInvalidParent:     "parent_id muss eine andere Bestellung nennen",
+		models.CodeInvalidDerivation: "derivation muss amendment, split oder replay sein, mit einer parent_id",
+
+		models.CodeDeadlinePassed:     "deadline ist bereits abgelaufen",
+		models.CodeDeadlineExceeded:   "deadline lief vor dem Schritt %s ab",
+		models.CodeStepBudgetExceeded: "Schritt %s hat sein Budget von %s überschritten",
+		models.CodeTimeout:            "Verarbeitung hat ihr Zeitlimit von %s im Schritt %s überschritten",
+		models.CodePanic:              "Verarbeitung ist unerwartet fehlgeschlagen",
+	},
+}
+
+// Negotiate picks the best supported language from an Accept-Language
+// header, honouring q-values and matching on the primary subtag.
+func Negotiate(header string) string {
+	type candidate struct {
+		lang string
+		q    float64
+	}
+	var candidates []candidate
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if tag == "" {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+		primary, _, _ := strings.Cut(strings.ToLower(tag), "-")
+		candidates = append(candidates, candidate{primary, q})
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].q > candidates[j].q })
+
+	for _, c := range candidates {
+		if c.q <= 0 {
+			continue
+		}
+		if c.lang == DefaultLanguage {
+			return DefaultLanguage
+		}
+		if _, ok := catalogs[c.lang]; ok {
+			return c.lang
+		}
+	}
+	return DefaultLanguage
+}
+
+// Message returns the text for code in lang, falling back to English.
+func Message(lang, code string, args ...any) string {
+	format, ok := catalogs[lang][code]
+	if !ok {
+		return models.Message(code, args...)
+	}
+	if len(args) == 0 {
+		return format
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// Localize returns e's message in lang. Codes without a translation, such
+// as those of custom validators, keep their original message.
+func Localize(lang string, e *models.ValidationError) string {
+	if _, ok := catalogs[lang][e.Code]; !ok {
+		return e.Message
+	}
+	return Message(lang, e.Code, e.Args...)
+}
+
+// Error localizes coded validation errors; other errors keep their text.
+func Error(lang string, err error) string {
+	var ve *models.ValidationError
+	if errors.As(err, &ve) {
+		return Localize(lang, ve)
+	}
+	return err.Error()
+}
@@ -0,0 +1,118 @@
+package idempotency
+
+import (
+	"crypto/sha256"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	ErrInFlight = errors.New("a request with this idempotency key is in progress")
+	ErrMismatch = errors.New("idempotency key was used with a different request")
+)
+
+// Response is a stored response, replayed to retries of its request.
+type Response struct {
+	Status      int
+	ContentType string
+	Body        []byte
+}
+
+type entry struct {
+	fingerprint [sha256.Size]byte
+	done        bool // false while the first request is in progress
+	resp        Response
+	expires     time.Time
+}
+
+// Cache remembers the responses to requests by idempotency key for TTL,
+// so a client that retries a request it didn't get an answer to gets the
+// original response instead of repeating the work. At most max responses
+// are kept; beyond that the oldest are forgotten early. A nil *Cache
+// remembers nothing.
+type Cache struct {
+	ttl time.Duration
+	max int
+
+	mu      sync.Mutex
+	entries map[string]*entry
+	queue   []string // stored keys, oldest first; expiry follows this order
+}
+
+// New returns a cache keeping up to max responses for ttl each.
+func New(ttl time.Duration, max int) *Cache {
+	return &Cache{ttl: ttl, max: max, entries: make(map[string]*entry)}
+}
+
+// Begin claims key for a request with body. If the key's request already
+// completed, its response is returned with true; the caller replays it.
+// Otherwise the caller proceeds and must call Complete or Release. A key
+// claimed by a request still in progress gives ErrInFlight, one used with
+// another body ErrMismatch.
+func (c *Cache) Begin(key string, body []byte) (Response, bool, error) {
+	if c == nil {
+		return Response{}, false, nil
+	}
+	fingerprint := sha256.Sum256(body)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.expire(time.Now())
+	if e, ok := c.entries[key]; ok {
+		switch {
+		case e.fingerprint != fingerprint:
+			return Response{}, false, ErrMismatch
+		case !e.done:
+			return Response{}, false, ErrInFlight
+		}
+		return e.resp, true, nil
+	}
+	c.entries[key] = &entry{fingerprint: fingerprint}
+	return Response{}, false, nil
+}
+
+// Complete stores the response to key's request for replay.
+func (c *Cache) Complete(key string, resp Response) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok || e.done {
+		return
+	}
+	e.done, e.resp, e.expires = true, resp, time.Now().Add(c.ttl)
+	c.queue = append(c.queue, key)
+	for len(c.queue) > c.max {
+		c.forget()
+	}
+}
+
+// Release gives up key's claim without storing a response, so a retry of
+// a request that failed is tried again.
+func (c *Cache) Release(key string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[key]; ok && !e.done {
+		delete(c.entries, key)
+	}
+}
+
+// expire must be called with c.mu held.
+func (c *Cache) expire(now time.Time) {
+	for len(c.queue) > 0 && !now.Before(c.entries[c.queue[0]].expires) {
+		c.forget()
+	}
+}
+
+// forget drops the oldest stored response. It must be called with c.mu
+// held.
+func (c *Cache) forget() {
+	delete(c.entries, c.queue[0])
+	c.queue[0] = ""
+	c.queue = c.queue[1:]
+}
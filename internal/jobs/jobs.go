@@ -0,0 +1,333 @@
+// Package jobs runs long operator actions, such as bulk changes to
+// orders, in the background. A fixed number of workers runs queued jobs;
+// each job reports progress per item and can be cancelled. Job records
+// are written to a directory when one is configured, so their outcome
+// survives a restart.
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	keepFinished = 1000
+	maxErrors    = 100
+	maxQueued    = 1000
+
+	// saveEvery limits how often progress of a running job is written.
+	saveEvery = time.Second
+)
+
+var (
+	ErrNotFound = errors.New("job not found")
+	ErrFinished = errors.New("job has already finished")
+	ErrBusy     = errors.New("too many queued jobs")
+)
+
+type State string
+
+const (
+	Queued    State = "queued"
+	Running   State = "running"
+	Done      State = "done"
+	Failed    State = "failed"
+	Cancelled State = "cancelled"
+)
+
+func (s State) finished() bool {
+	return s == Done || s == Failed || s == Cancelled
+}
+
+// Job is a snapshot of one background job.
+type Job struct {
+	ID         string     `json:"id"`
+	Kind       string     `json:"kind"`
+	State      State      `json:"state"`
+	CreatedBy  string     `json:"created_by,omitempty"`
+	Total      int        `json:"total"`
+	Succeeded  int        `json:"succeeded"`
+	Failed     int        `json:"failed"`
+	Errors     []string   `json:"errors,omitempty"` // the first 100 item failures
+	Error      string     `json:"error,omitempty"`  // why the job itself failed
+	CreatedAt  time.Time  `json:"created_at"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// Func does the work of a job, reporting each item to p. It should stop
+// early once ctx is done, which happens when the job is cancelled or the
+// service shuts down. Returning an error fails the job; failed items
+// alone don't.
+type Func func(ctx context.Context, p *Progress) error
+
+// Progress lets a running job report its items.
+type Progress struct {
+	m  *Manager
+	id string
+}
+
+// Step records one processed item; err marks it failed.
+func (p *Progress) Step(item string, err error) {
+	p.m.mu.Lock()
+	defer p.m.mu.Unlock()
+	e, ok := p.m.jobs[p.id]
+	if !ok {
+		return
+	}
+	if err == nil {
+		e.job.Succeeded++
+	} else {
+		e.job.Failed++
+		if len(e.job.Errors) < maxErrors {
+			e.job.Errors = append(e.job.Errors, fmt.Sprintf("%s: %v", item, err))
+		}
+	}
+	if time.Since(e.saved) >= saveEvery {
+		p.m.save(e)
+	}
+}
+
+type entry struct {
+	job       Job
+	fn        Func
+	cancel    context.CancelFunc
+	cancelled bool
+	saved     time.Time
+}
+
+type Manager struct {
+	dir     string
+	workers int
+	queue   chan string
+
+	mu       sync.Mutex
+	jobs     map[string]*entry
+	finished []string // oldest first, for eviction
+}
+
+// NewManager loads the job records in dir, if set. Jobs that were queued
+// or running when the service stopped are marked failed.
+func NewManager(dir string, workers int) (*Manager, error) {
+	m := &Manager{
+		dir:     dir,
+		workers: workers,
+		queue:   make(chan string, maxQueued),
+		jobs:    make(map[string]*entry),
+	}
+	if dir == "" {
+		return m, nil
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var loaded []*entry
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		e := &entry{}
+		if err := json.Unmarshal(data, &e.job); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		loaded = append(loaded, e)
+	}
+	slices.SortFunc(loaded, func(a, b *entry) int { return a.job.CreatedAt.Compare(b.job.CreatedAt) })
+	for _, e := range loaded {
+		m.jobs[e.job.ID] = e
+		if !e.job.State.finished() {
+			m.end(e, Failed, "interrupted by restart")
+		} else {
+			m.retire(e.job.ID)
+		}
+	}
+	return m, nil
+}
+
+// Run starts the workers and blocks until ctx is done. Running jobs are
+// then interrupted and marked failed.
+func (m *Manager) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for range m.workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case id := <-m.queue:
+					m.run(ctx, id)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// Start queues fn as a job of total items and returns its first snapshot.
+func (m *Manager) Start(kind, createdBy string, total int, fn Func) (Job, error) {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	e := &entry{
+		job: Job{ID: hex.EncodeToString(b), Kind: kind, State: Queued, CreatedBy: createdBy, Total: total, CreatedAt: time.Now()},
+		fn:  fn,
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	select {
+	case m.queue <- e.job.ID:
+	default:
+		return Job{}, ErrBusy
+	}
+	m.jobs[e.job.ID] = e
+	m.save(e)
+	return e.snapshot(), nil
+}
+
+func (m *Manager) run(ctx context.Context, id string) {
+	m.mu.Lock()
+	e, ok := m.jobs[id]
+	if !ok || e.job.State != Queued {
+		m.mu.Unlock()
+		return // cancelled while queued
+	}
+	jobCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	now := time.Now()
+	e.cancel = cancel
+	e.job.State = Running
+	e.job.StartedAt = &now
+	fn := e.fn
+	m.save(e)
+	m.mu.Unlock()
+
+	err := fn(jobCtx, &Progress{m: m, id: id})
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch {
+	case e.cancelled:
+		m.end(e, Cancelled, "")
+	case ctx.Err() != nil:
+		m.end(e, Failed, "interrupted by shutdown")
+	case err != nil:
+		m.end(e, Failed, err.Error())
+	default:
+		m.end(e, Done, "")
+	}
+}
+
+// Cancel stops a queued or running job. A running job stops at its next
+// item; its progress so far is kept.
+func (m *Manager) Cancel(id string) (Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.jobs[id]
+	switch {
+	case !ok:
+		return Job{}, ErrNotFound
+	case e.job.State.finished() || e.cancelled:
+		return e.snapshot(), ErrFinished
+	case e.job.State == Queued:
+		m.end(e, Cancelled, "")
+	default:
+		e.cancelled = true
+		e.cancel()
+	}
+	return e.snapshot(), nil
+}
+
+// Get returns the job with the given ID.
+func (m *Manager) Get(id string) (Job, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return e.snapshot(), true
+}
+
+// List returns the jobs whose kind starts with kind and that are in state,
+// newest first. Empty arguments match every job.
+func (m *Manager) List(kind string, state State) []Job {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	list := []Job{}
+	for _, e := range m.jobs {
+		if (kind == "" || strings.HasPrefix(e.job.Kind, kind)) && (state == "" || e.job.State == state) {
+			list = append(list, e.snapshot())
+		}
+	}
+	slices.SortFunc(list, func(a, b Job) int { return b.CreatedAt.Compare(a.CreatedAt) })
+	return list
+}
+
+func (e *entry) snapshot() Job {
+	j := e.job
+	j.Errors = slices.Clone(e.job.Errors)
+	return j
+}
+
+// end must be called with m.mu held.
+func (m *Manager) end(e *entry, state State, reason string) {
+	now := time.Now()
+	e.job.State = state
+	e.job.Error = reason
+	e.job.FinishedAt = &now
+	e.fn = nil
+	m.save(e)
+	m.retire(e.job.ID)
+}
+
+// retire must be called with m.mu held.
+func (m *Manager) retire(id string) {
+	m.finished = append(m.finished, id)
+	if len(m.finished) <= keepFinished {
+		return
+	}
+	old := m.finished[0]
+	m.finished = m.finished[1:]
+	delete(m.jobs, old)
+	if m.dir != "" {
+		_ = os.Remove(filepath.Join(m.dir, old+".json"))
+	}
+}
+
+// save must be called with m.mu held. Write errors are logged; the job
+// keeps running from memory.
+func (m *Manager) save(e *entry) {
+	e.saved = time.Now()
+	if m.dir == "" {
+		return
+	}
+	data, err := json.Marshal(e.job)
+	if err == nil {
+		path := filepath.Join(m.dir, e.job.ID+".json")
+		tmp := path + ".tmp"
+		if err = os.WriteFile(tmp, data, 0o644); err == nil {
+			err = os.Rename(tmp, path)
+		}
+	}
+	if err != nil {
+		log.Printf("jobs: saving %s: %v", e.job.ID, err)
+	}
+}
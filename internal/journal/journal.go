@@ -0,0 +1,365 @@
+// Package journal is a write-ahead log of accepted orders. It wraps the
+// in-memory order store: every order is appended to the journal before
+// it is queued, and a completion marker is appended when it finishes, so
+// orders accepted before a crash are found unfinished at the next start
+// and the pool queues them again.
+package journal
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/orderstore"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/pkg/models"
+)
+
+// Sync policies: fsync after every append, every interval, or leave
+// flushing to the operating system.
+const (
+	SyncAlways   = "always"
+	SyncInterval = "interval"
+	SyncNever    = "never"
+)
+
+const (
+	journalFile = "orders.journal"
+
+	// compactMin is how many records are appended before the journal is
+	// rewritten with only the unfinished orders; it is rewritten once the
+	// appended records outnumber them compactRatio times as well.
+	compactMin   = 10000
+	compactRatio = 4
+)
+
+// Record kinds.
+const (
+	opPut  = "put"  // an order accepted, changed or released, with its state
+	opHold = "hold" // an accepted order held by an operator
+	opDone = "done" // an order finished, cancelled, removed or forgotten
+)
+
+// record is one line of the journal.
+type record struct {
+	Op    string           `json:"op"`
+	ID    string           `json:"id"`
+	State orderstore.State `json:"state,omitempty"`
+	Order *models.Order    `json:"order,omitempty"`
+}
+
+type Config struct {
+	Dir       string
+	Sync      string        // SyncAlways, SyncInterval or SyncNever
+	SyncEvery time.Duration // for SyncInterval
+}
+
+// Stats describes the journal.
+type Stats struct {
+	Unfinished  int       `json:"unfinished"`
+	Appended    uint64    `json:"appended"` // since the last compaction
+	Compactions uint64    `json:"compactions"`
+	Recovered   int       `json:"recovered"` // unfinished orders found at startup
+	LastSync    time.Time `json:"last_sync,omitzero"`
+	LastError   string    `json:"last_error,omitempty"`
+}
+
+// Journal is an orderstore.Repository that journals the changes it passes
+// on to the repository it wraps.
+type Journal struct {
+	inner orderstore.Repository
+	cfg   Config
+	puts  sync.Mutex // so a taken ID is never journaled
+
+	mu    sync.Mutex
+	file  *os.File
+	live  map[string]record // unfinished orders by ID, as their last put
+	ids   []string          // in accepted order, for compaction; may hold finished or repeated IDs
+	dirty bool              // appended since the last sync
+	stats Stats
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+var _ orderstore.Repository = (*Journal)(nil)
+
+// Open replays the journal in cfg.Dir into inner, compacts it to the
+// unfinished orders and starts journaling inner's changes.
+func Open(cfg Config, inner orderstore.Repository) (*Journal, error) {
+	if err := os.MkdirAll(cfg.Dir, 0o700); err != nil {
+		return nil, err
+	}
+	j := &Journal{inner: inner, cfg: cfg, live: make(map[string]record)}
+	if err := j.replay(); err != nil {
+		return nil, fmt.Errorf("replay journal: %w", err)
+	}
+	if err := j.compact(); err != nil {
+		return nil, err
+	}
+	for _, id := range j.ids {
+		rec := j.live[id]
+		if err := inner.Put(*rec.Order, rec.State); err != nil {
+			return nil, err
+		}
+	}
+	j.stats.Recovered = len(j.live)
+	if cfg.Sync == SyncInterval {
+		j.stop, j.done = make(chan struct{}), make(chan struct{})
+		go j.syncLoop()
+	}
+	return j, nil
+}
+
+// replay reads the journal into j.live. A torn last line, from a crash in
+// the middle of an append, ends the journal.
+func (j *Journal) replay() error {
+	file, err := os.Open(filepath.Join(j.cfg.Dir, journalFile))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var rec record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			log.Printf("journal: ignoring torn record at the end")
+			break
+		}
+		j.apply(rec)
+	}
+	return scanner.Err()
+}
+
+// apply must be called with j.mu held, or before the journal is shared.
+func (j *Journal) apply(rec record) {
+	switch rec.Op {
+	case opPut:
+		if _, ok := j.live[rec.ID]; !ok {
+			j.ids = append(j.ids, rec.ID)
+		}
+		j.live[rec.ID] = rec
+	case opHold:
+		if put, ok := j.live[rec.ID]; ok {
+			put.State = orderstore.Held
+			j.live[rec.ID] = put
+		}
+	case opDone:
+		delete(j.live, rec.ID)
+	}
+}
+
+// compact rewrites the journal with only the unfinished orders, in the
+// order they were accepted. It must be called with j.mu held.
+func (j *Journal) compact() error {
+	path := filepath.Join(j.cfg.Dir, journalFile)
+	tmp := path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(file)
+	enc := json.NewEncoder(w)
+	ids := j.ids[:0]
+	seen := make(map[string]bool, len(j.live))
+	for _, id := range j.ids {
+		rec, ok := j.live[id]
+		if !ok || seen[id] {
+			continue
+		}
+		seen[id] = true
+		ids = append(ids, id)
+		if err := enc.Encode(rec); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	j.ids = ids
+	if err := errors.Join(w.Flush(), file.Sync(), file.Close()); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	if j.file != nil {
+		j.file.Close()
+	}
+	if j.file, err = os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o600); err != nil {
+		return err
+	}
+	j.stats.Appended = 0
+	j.stats.Compactions++
+	return nil
+}
+
+// append writes rec, syncing it under SyncAlways, and applies it.
+func (j *Journal) append(rec record) error {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if _, err := j.file.Write(append(line, '\n')); err != nil {
+		j.stats.LastError = err.Error()
+		return err
+	}
+	if j.cfg.Sync == SyncAlways {
+		if err := j.file.Sync(); err != nil {
+			j.stats.LastError = err.Error()
+			return err
+		}
+		j.stats.LastSync = time.Now()
+	} else {
+		j.dirty = true
+	}
+	j.apply(rec)
+	j.stats.Appended++
+	if j.stats.Appended >= compactMin && j.stats.Appended >= compactRatio*uint64(len(j.live)) {
+		if err := j.compact(); err != nil {
+			// Keep appending to the long journal; the next append retries.
+			log.Printf("journal: compact: %v", err)
+			j.stats.LastError = err.Error()
+		}
+	}
+	return nil
+}
+
+// record appends rec for changes that can't report an error; they are
+// logged instead, like a durable repository does.
+func (j *Journal) record(rec record) {
+	if err := j.append(rec); err != nil {
+		log.Printf("journal: %s %s: %v", rec.Op, rec.ID, err)
+	}
+}
+
+func (j *Journal) syncLoop() {
+	defer close(j.done)
+	ticker := time.NewTicker(j.cfg.SyncEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-j.stop:
+			return
+		case <-ticker.C:
+		}
+		j.mu.Lock()
+		j.sync()
+		j.mu.Unlock()
+	}
+}
+
+// sync must be called with j.mu held.
+func (j *Journal) sync() {
+	if !j.dirty {
+		return
+	}
+	if err := j.file.Sync(); err != nil {
+		log.Printf("journal: sync: %v", err)
+		j.stats.LastError = err.Error()
+		return
+	}
+	j.dirty = false
+	j.stats.LastSync = time.Now()
+}
+
+// Put journals an accepted order before recording it, so an order is
+// never queued unless the journal has it.
+func (j *Journal) Put(o models.Order, state orderstore.State) error {
+	j.puts.Lock()
+	defer j.puts.Unlock()
+	if _, ok := j.inner.Get(o.ID); ok {
+		return orderstore.ErrExists
+	}
+	if err := j.append(record{Op: opPut, ID: o.ID, State: state, Order: &o}); err != nil {
+		return fmt.Errorf("journal: %w", err)
+	}
+	return j.inner.Put(o, state)
+}
+
+func (j *Journal) SetState(id string, state orderstore.State) {
+	switch state {
+	case orderstore.Held:
+		j.record(record{Op: opHold, ID: id})
+	case orderstore.Queued, orderstore.Processing:
+		// Unfinished orders are queued again after a restart anyway.
+	default:
+		j.record(record{Op: opDone, ID: id})
+	}
+	j.inner.SetState(id, state)
+}
+
+// Update journals the changed order while it is unfinished.
+func (j *Journal) Update(id string, fn func(*orderstore.Record)) {
+	j.inner.Update(id, fn)
+	rec, ok := j.inner.Get(id)
+	if !ok {
+		return
+	}
+	switch rec.State {
+	case orderstore.Queued, orderstore.Held, orderstore.Processing:
+		state := rec.State
+		if state == orderstore.Processing {
+			state = orderstore.Queued
+		}
+		j.record(record{Op: opPut, ID: id, State: state, Order: &rec.Order})
+	}
+}
+
+func (j *Journal) Finish(result models.ProcessedOrder) {
+	j.record(record{Op: opDone, ID: result.Order.ID})
+	j.inner.Finish(result)
+}
+
+func (j *Journal) Forget(id string) {
+	j.record(record{Op: opDone, ID: id})
+	j.inner.Forget(id)
+}
+
+// Prune is passed on; finished orders are no longer journaled.
+func (j *Journal) Prune(tenant string, before time.Time) (int, error) {
+	return j.inner.Prune(tenant, before)
+}
+
+func (j *Journal) Get(id string) (orderstore.Record, bool) {
+	return j.inner.Get(id)
+}
+
+func (j *Journal) List(q orderstore.Query) ([]orderstore.Record, int) {
+	return j.inner.List(q)
+}
+
+func (j *Journal) Stats() Stats {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	stats := j.stats
+	stats.Unfinished = len(j.live)
+	return stats
+}
+
+// Close compacts, syncs and closes the journal. It must be called after the pool
+// has stopped.
+func (j *Journal) Close() error {
+	if j.stop != nil {
+		close(j.stop)
+		<-j.done
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	// Leave only the orders a drain didn't finish for the next start.
+	if err := j.compact(); err != nil {
+		log.Printf("journal: compact: %v", err)
+	}
+	j.dirty = true
+	j.sync()
+	return j.file.Close()
+}
@@ -0,0 +1,100 @@
+// Package lifecycle tracks the server's phase from startup to exit, so
+// load balancers can follow it: /readyz passes only while the server is
+// ready for traffic, /healthz while the process is alive, and order
+// submissions are refused once shutdown begins.
+package lifecycle
+
+import (
+	"errors"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// State is the server's phase. It only moves forward.
+type State int32
+
+const (
+	Starting  State = iota // not yet serving
+	Ready                  // serving traffic
+	Quiescing              // not ready, so balancers stop routing to it
+	Draining               // finishing queued orders before exit
+	Stopped
+)
+
+func (s State) String() string {
+	switch s {
+	case Starting:
+		return "starting"
+	case Quiescing:
+		return "quiescing"
+	case Draining:
+		return "draining"
+	case Stopped:
+		return "stopped"
+	}
+	return "ready"
+}
+
+var ErrShuttingDown = errors.New("server is shutting down")
+
+// Tracker holds the current state. A nil *Tracker is always ready.
+type Tracker struct {
+	state atomic.Int32
+	since atomic.Int64 // unix nanoseconds
+}
+
+func New() *Tracker {
+	t := &Tracker{}
+	t.since.Store(time.Now().UnixNano())
+	return t
+}
+
+// Advance moves to state to, reporting false if the tracker is already
+// there or past it.
+func (t *Tracker) Advance(to State) bool {
+	for {
+		from := State(t.state.Load())
+		if from >= to {
+			return false
+		}
+		if t.state.CompareAndSwap(int32(from), int32(to)) {
+			t.since.Store(time.Now().UnixNano())
+			log.Printf("lifecycle: %s -> %s", from, to)
+			return true
+		}
+	}
+}
+
+func (t *Tracker) State() State {
+	if t == nil {
+		return Ready
+	}
+	return State(t.state.Load())
+}
+
+// Ready reports whether the server should receive new traffic.
+func (t *Tracker) Ready() bool {
+	return t.State() == Ready
+}
+
+// Admit returns ErrShuttingDown once shutdown has begun.
+func (t *Tracker) Admit() error {
+	if t.State() >= Quiescing {
+		return ErrShuttingDown
+	}
+	return nil
+}
+
+// Status is the current state, reported by the health endpoints.
+type Status struct {
+	State string    `json:"state"`
+	Since time.Time `json:"since,omitzero"`
+}
+
+func (t *Tracker) Status() Status {
+	if t == nil {
+		return Status{State: Ready.String()}
+	}
+	return Status{State: t.State().String(), Since: time.Unix(0, t.since.Load())}
+}
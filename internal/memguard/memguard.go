@@ -0,0 +1,136 @@
+package memguard
+
+import (
+	"context"
+	"errors"
+	"runtime/metrics"
+	"sync/atomic"
+	"time"
+
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/pkg/models"
+)
+
+// State is the guard's current reaction to heap usage.
+type State int32
+
+const (
+	Normal   State = iota
+	Shedding       // low priority orders are rejected
+	Paused         // all orders are rejected
+)
+
+func (s State) String() string {
+	switch s {
+	case Shedding:
+		return "shedding"
+	case Paused:
+		return "paused"
+	}
+	return "normal"
+}
+
+var (
+	ErrShed   = errors.New("low priority order shed under memory pressure")
+	ErrPaused = errors.New("intake paused under memory pressure")
+)
+
+// resumeRatio is how far below a watermark the heap must drop before the
+// guard steps back, so it doesn't flap around the threshold.
+const resumeRatio = 0.9
+
+const heapMetric = "/memory/classes/heap/objects:bytes"
+
+// Guard samples live heap usage and decides whether new orders are admitted.
+// A nil *Guard admits everything.
+type Guard struct {
+	shedAbove    uint64
+	pauseAbove   uint64
+	shedPriority models.Priority
+
+	state    atomic.Int32
+	heap     atomic.Uint64
+	shed     atomic.Int64
+	rejected atomic.Int64
+}
+
+// New returns a guard that sheds orders with priority >= shedPriority once
+// the heap exceeds shedAbove bytes and rejects everything above pauseAbove.
+// A zero watermark disables that reaction.
+func New(shedAbove, pauseAbove uint64, shedPriority models.Priority) *Guard {
+	return &Guard{shedAbove: shedAbove, pauseAbove: pauseAbove, shedPriority: shedPriority}
+}
+
+// Run samples the heap every interval until ctx is done.
+func (g *Guard) Run(ctx context.Context, interval time.Duration) {
+	sample := []metrics.Sample{{Name: heapMetric}}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		metrics.Read(sample)
+		g.update(sample[0].Value.Uint64())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (g *Guard) update(heap uint64) {
+	g.heap.Store(heap)
+	state := State(g.state.Load())
+	switch {
+	case above(heap, g.pauseAbove, 1):
+		state = Paused
+	case state == Paused && above(heap, g.pauseAbove, resumeRatio):
+		// stay paused until well below the watermark
+	case above(heap, g.shedAbove, 1):
+		state = Shedding
+	case state >= Shedding && above(heap, g.shedAbove, resumeRatio):
+		state = Shedding
+	default:
+		state = Normal
+	}
+	g.state.Store(int32(state))
+}
+
+func above(heap, watermark uint64, ratio float64) bool {
+	return watermark > 0 && float64(heap) > float64(watermark)*ratio
+}
+
+// Admit returns an error if an order with the given priority must be
+// rejected under the current memory pressure.
+func (g *Guard) Admit(priority models.Priority) error {
+	if g == nil {
+		return nil
+	}
+	switch State(g.state.Load()) {
+	case Paused:
+		g.rejected.Add(1)
+		return ErrPaused
+	case Shedding:
+		if priority >= g.shedPriority {
+			g.shed.Add(1)
+			return ErrShed
+		}
+	}
+	return nil
+}
+
+// Status is the guard's state as reported by the health endpoint.
+type Status struct {
+	State     string `json:"state"`
+	HeapBytes uint64 `json:"heap_bytes"`
+	Shed      int64  `json:"shed"`
+	Rejected  int64  `json:"rejected"`
+}
+
+func (g *Guard) Status() Status {
+	return Status{
+		State:     State(g.state.Load()).String(),
+		HeapBytes: g.heap.Load(),
+		Shed:      g.shed.Load(),
+		Rejected:  g.rejected.Load(),
+	}
+}
@@ -0,0 +1,100 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// methods are the request methods counted as themselves; clients choose
+// the method, so the rest are counted as Other.
+var methods = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+	http.MethodPatch, http.MethodDelete, http.MethodOptions,
+}
+
+// httpSeries counts the requests of one method, route and status.
+type httpSeries struct {
+	method, route, code string
+	count               uint64
+	seconds             float64
+}
+
+// HTTP counts the requests next serves by method, route pattern and
+// status code. It must wrap the ServeMux itself, which sets the pattern;
+// requests no route matched count as route "unmatched".
+func (r *Recorder) HTTP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, req)
+		route := req.Pattern
+		if route == "" {
+			route = "unmatched"
+		}
+		method := req.Method
+		if !slices.Contains(methods, method) {
+			method = Other
+		}
+		r.observeHTTP(method, route, sw.status, time.Since(start))
+	})
+}
+
+func (r *Recorder) observeHTTP(method, route string, status int, took time.Duration) {
+	code := strconv.Itoa(status)
+	key := method + "\xff" + route + "\xff" + code
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s, ok := r.requests[key]
+	if !ok {
+		s = &httpSeries{method: method, route: route, code: code}
+		r.requests[key] = s
+	}
+	s.count++
+	s.seconds += took.Seconds()
+}
+
+// writeHTTP must be called with r.mu held.
+func (r *Recorder) writeHTTP(w io.Writer) {
+	keys := make([]string, 0, len(r.requests))
+	for key := range r.requests {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	fmt.Fprintln(w, "# HELP http_requests_total HTTP requests served, by method, route and status code.")
+	fmt.Fprintln(w, "# TYPE http_requests_total counter")
+	for _, key := range keys {
+		s := r.requests[key]
+		fmt.Fprintf(w, "http_requests_total%s %d\n", s.labelSet(), s.count)
+	}
+	fmt.Fprintln(w, "# HELP http_request_duration_seconds Time spent serving HTTP requests.")
+	fmt.Fprintln(w, "# TYPE http_request_duration_seconds summary")
+	for _, key := range keys {
+		s := r.requests[key]
+		fmt.Fprintf(w, "http_request_duration_seconds_sum%s %g\n", s.labelSet(), s.seconds)
+		fmt.Fprintf(w, "http_request_duration_seconds_count%s %d\n", s.labelSet(), s.count)
+	}
+}
+
+func (s *httpSeries) labelSet() string {
+	return fmt.Sprintf(`{method="%s",route="%s",code="%s"}`, escape(s.method), escape(s.route), s.code)
+}
+
+// statusWriter remembers the status of a response.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,220 @@
+// Package metrics exposes processing results in the Prometheus text
+// format, with guards against label cardinality. Only allowlisted labels
+// are kept; a label's values can be limited to a fixed set or mapped to
+// buckets (customer to tier, say), and any label stops taking new values
+// once it has MaxValues of them. Values that don't fit are reported as
+// "other", and counted in metrics_label_overflow_total.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/pkg/models"
+)
+
+// Other replaces label values the guards reject.
+const Other = "other"
+
+// Config selects labels and their guards. Labels are "pipeline",
+// "error_code", "tenant", "customer" or "tag.<key>".
+type Config struct {
+	Labels    []string
+	MaxValues int                          // distinct values per label
+	Values    map[string][]string          // label -> the values kept as-is
+	Buckets   map[string]map[string]string // label -> value -> bucket
+}
+
+var labelName = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+type series struct {
+	values  []string // outcome, then one per label
+	count   uint64
+	seconds float64
+}
+
+// Recorder counts processed orders per label set.
+type Recorder struct {
+	labels    []string
+	names     []string // Prometheus names of labels
+	maxValues int
+	values    map[string]map[string]bool
+	buckets   map[string]map[string]string
+
+	mu       sync.Mutex
+	seen     map[string]map[string]bool
+	overflow map[string]uint64
+	series   map[string]*series
+	requests map[string]*httpSeries
+}
+
+func New(cfg Config) (*Recorder, error) {
+	r := &Recorder{
+		labels:    slices.Clone(cfg.Labels),
+		maxValues: cfg.MaxValues,
+		values:    make(map[string]map[string]bool),
+		buckets:   cfg.Buckets,
+		seen:      make(map[string]map[string]bool),
+		overflow:  make(map[string]uint64),
+		series:    make(map[string]*series),
+		requests:  make(map[string]*httpSeries),
+	}
+	for _, label := range r.labels {
+		switch {
+		case label == "pipeline", label == "error_code", label == "tenant", label == "customer":
+		case strings.HasPrefix(label, "tag.") && len(label) > len("tag."):
+		default:
+			return nil, fmt.Errorf("unsupported label %q", label)
+		}
+		name := labelName.ReplaceAllString(label, "_")
+		if slices.Contains(r.names, name) || name == "outcome" {
+			return nil, fmt.Errorf("duplicate label %q", label)
+		}
+		r.names = append(r.names, name)
+		r.seen[label] = make(map[string]bool)
+	}
+	for label, values := range cfg.Values {
+		if !slices.Contains(r.labels, label) {
+			return nil, fmt.Errorf("values for unlisted label %q", label)
+		}
+		r.values[label] = make(map[string]bool, len(values))
+		for _, v := range values {
+			r.values[label][v] = true
+		}
+	}
+	for label := range cfg.Buckets {
+		if !slices.Contains(r.labels, label) {
+			return nil, fmt.Errorf("buckets for unlisted label %q", label)
+		}
+	}
+	return r, nil
+}
+
+// Observe counts one result.
+func (r *Recorder) Observe(result models.ProcessedOrder) {
+	values := make([]string, 1, len(r.labels)+1)
+	values[0] = "success"
+	if !result.Success {
+		values[0] = "failure"
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, label := range r.labels {
+		values = append(values, r.guard(label, labelValue(result, label)))
+	}
+	key := strings.Join(values, "\xff")
+	s, ok := r.series[key]
+	if !ok {
+		s = &series{values: values}
+		r.series[key] = s
+	}
+	s.count++
+	s.seconds += float64(result.ProcessingTime) / 1000
+}
+
+func labelValue(result models.ProcessedOrder, label string) string {
+	switch label {
+	case "pipeline":
+		return result.Pipeline
+	case "error_code":
+		return result.ErrorCode
+	case "tenant":
+		return result.Order.Tenant
+	case "customer":
+		return result.Order.Customer
+	}
+	return result.Order.Tags[strings.TrimPrefix(label, "tag.")]
+}
+
+// guard must be called with r.mu held.
+func (r *Recorder) guard(label, v string) string {
+	if v == "" {
+		return ""
+	}
+	if buckets, ok := r.buckets[label]; ok {
+		if bucket, ok := buckets[v]; ok {
+			return bucket
+		}
+		return Other
+	}
+	if allowed, ok := r.values[label]; ok && !allowed[v] {
+		r.overflow[label]++
+		return Other
+	}
+	seen := r.seen[label]
+	if !seen[v] {
+		if len(seen) >= r.maxValues {
+			r.overflow[label]++
+			return Other
+		}
+		seen[v] = true
+	}
+	return v
+}
+
+// Write writes the counters, those of HTTP requests included, in the
+// Prometheus text format.
+func (r *Recorder) Write(w io.Writer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	keys := make([]string, 0, len(r.series))
+	for key := range r.series {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	fmt.Fprintln(w, "# HELP orders_processed_total Orders processed, by outcome.")
+	fmt.Fprintln(w, "# TYPE orders_processed_total counter")
+	for _, key := range keys {
+		s := r.series[key]
+		fmt.Fprintf(w, "orders_processed_total%s %d\n", r.labelSet(s.values), s.count)
+	}
+	fmt.Fprintln(w, "# HELP order_processing_seconds Time spent processing orders.")
+	fmt.Fprintln(w, "# TYPE order_processing_seconds summary")
+	for _, key := range keys {
+		s := r.series[key]
+		labels := r.labelSet(s.values)
+		fmt.Fprintf(w, "order_processing_seconds_sum%s %g\n", labels, s.seconds)
+		fmt.Fprintf(w, "order_processing_seconds_count%s %d\n", labels, s.count)
+	}
+	fmt.Fprintln(w, "# HELP metrics_label_overflow_total Label values reported as \"other\" by the cardinality guards.")
+	fmt.Fprintln(w, "# TYPE metrics_label_overflow_total counter")
+	for i, label := range r.labels {
+		fmt.Fprintf(w, "metrics_label_overflow_total{label=%q} %d\n", r.names[i], r.overflow[label])
+	}
+	r.writeHTTP(w)
+}
+
+func (r *Recorder) labelSet(values []string) string {
+	var b strings.Builder
+	b.WriteString(`{outcome="` + values[0] + `"`)
+	for i, v := range values[1:] {
+		if v != "" {
+			fmt.Fprintf(&b, `,%s="%s"`, r.names[i], escape(v))
+		}
+	}
+	b.WriteString("}")
+	return b.String()
+}
+
+var escaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escape(v string) string {
+	return escaper.Replace(v)
+}
+
+// WriteGauge writes one unlabeled gauge.
+func WriteGauge(w io.Writer, name, help string, value float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %g\n", name, help, name, name, value)
+}
+
+// WriteCounter writes one unlabeled counter.
+func WriteCounter(w io.Writer, name, help string, value float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n%s %g\n", name, help, name, name, value)
+}
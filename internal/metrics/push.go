@@ -0,0 +1,352 @@
+package metrics
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Push protocols.
+const (
+	ProtocolStatsd = "statsd"
+	ProtocolOTLP   = "otlp"
+)
+
+// PushConfig sends metrics every Interval, over statsd to the UDP address
+// Addr or over OTLP/HTTP to Endpoint, such as
+// http://localhost:4318/v1/metrics.
+type PushConfig struct {
+	Protocol string
+	Addr     string
+	Endpoint string
+	Interval time.Duration
+	// Prefix is prepended to statsd metric names, e.g. "orders.".
+	Prefix string
+	// MaxPacket bounds the statsd datagrams metrics are batched into.
+	MaxPacket int
+	// ServiceName is the service.name of OTLP metrics.
+	ServiceName string
+}
+
+// Pusher sends what gather writes, metrics in the Prometheus text format,
+// to a statsd server or an OTLP collector, for environments where nothing
+// scrapes /metrics. Pushing the same text keeps both views alike.
+type Pusher struct {
+	cfg    PushConfig
+	gather func(io.Writer)
+	client *http.Client
+	start  time.Time
+
+	pushed map[string]float64 // counters as last sent over statsd
+}
+
+// NewPusher pushes with cfg; client sends OTLP requests.
+func NewPusher(cfg PushConfig, gather func(io.Writer), client *http.Client) (*Pusher, error) {
+	switch cfg.Protocol {
+	case ProtocolStatsd, ProtocolOTLP:
+	default:
+		return nil, fmt.Errorf("unknown push protocol %q", cfg.Protocol)
+	}
+	return &Pusher{
+		cfg:    cfg,
+		gather: gather,
+		client: client,
+		start:  time.Now(),
+		pushed: make(map[string]float64),
+	}, nil
+}
+
+// Run pushes every interval until ctx is done, and once more then, so the
+// last interval isn't lost at shutdown.
+func (p *Pusher) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			final, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := p.push(final); err != nil {
+				log.Printf("metrics push: %v", err)
+			}
+			return
+		case <-ticker.C:
+			if err := p.push(ctx); err != nil {
+				log.Printf("metrics push: %v", err)
+			}
+		}
+	}
+}
+
+func (p *Pusher) push(ctx context.Context) error {
+	var buf bytes.Buffer
+	p.gather(&buf)
+	samples := parseText(&buf)
+	if p.cfg.Protocol == ProtocolStatsd {
+		return p.pushStatsd(samples)
+	}
+	return p.pushOTLP(ctx, samples)
+}
+
+// sample is one line of the Prometheus text format.
+type sample struct {
+	name    string
+	labels  [][2]string
+	value   float64
+	counter bool // a counter, or the sum or count of a summary
+}
+
+func (s sample) key() string {
+	var b strings.Builder
+	b.WriteString(s.name)
+	for _, l := range s.labels {
+		b.WriteString("\xff" + l[0] + "\xff" + l[1])
+	}
+	return b.String()
+}
+
+// parseText reads the samples of metrics in the Prometheus text format, as
+// this package writes them.
+func parseText(r io.Reader) []sample {
+	types := make(map[string]string)
+	var samples []sample
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if rest, ok := strings.CutPrefix(line, "# TYPE "); ok {
+			if name, typ, ok := strings.Cut(rest, " "); ok {
+				types[name] = typ
+			}
+			continue
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		s, ok := parseSample(line)
+		if !ok {
+			continue
+		}
+		typ, ok := types[s.name]
+		if !ok {
+			base := strings.TrimSuffix(strings.TrimSuffix(s.name, "_sum"), "_count")
+			typ = types[base]
+		}
+		s.counter = typ == "counter" || typ == "summary"
+		samples = append(samples, s)
+	}
+	return samples
+}
+
+func parseSample(line string) (sample, bool) {
+	var s sample
+	end := strings.IndexAny(line, "{ ")
+	if end <= 0 {
+		return s, false
+	}
+	s.name, line = line[:end], line[end:]
+	if line[0] == '{' {
+		line = line[1:]
+		for !strings.HasPrefix(line, "}") {
+			name, rest, ok := strings.Cut(line, `="`)
+			if !ok {
+				return s, false
+			}
+			var value strings.Builder
+			i := 0
+			for ; i < len(rest) && rest[i] != '"'; i++ {
+				c := rest[i]
+				if c == '\\' && i+1 < len(rest) {
+					i++
+					if c = rest[i]; c == 'n' {
+						c = '\n'
+					}
+				}
+				value.WriteByte(c)
+			}
+			if i == len(rest) {
+				return s, false
+			}
+			s.labels = append(s.labels, [2]string{strings.TrimPrefix(name, ","), value.String()})
+			line = rest[i+1:]
+			if line == "" {
+				return s, false
+			}
+		}
+		line = line[1:]
+	}
+	value, err := strconv.ParseFloat(strings.TrimSpace(line), 64)
+	if err != nil {
+		return s, false
+	}
+	s.value = value
+	return s, true
+}
+
+var statsdTag = strings.NewReplacer(",", "_", "|", "_", ":", "_", "#", "_", "\n", " ")
+
+// pushStatsd sends gauges as they are and counters as the increase since
+// the last push, with labels as DogStatsD tags, packing lines into
+// datagrams of at most MaxPacket bytes.
+func (p *Pusher) pushStatsd(samples []sample) error {
+	conn, err := net.Dial("udp", p.cfg.Addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var packet []byte
+	flush := func() error {
+		if len(packet) == 0 {
+			return nil
+		}
+		_, err := conn.Write(packet)
+		packet = packet[:0]
+		return err
+	}
+	for _, s := range samples {
+		value, kind := s.value, "g"
+		if s.counter {
+			key := s.key()
+			if last, ok := p.pushed[key]; ok && value >= last {
+				value -= last
+			}
+			p.pushed[key] = s.value
+			if value == 0 {
+				continue
+			}
+			kind = "c"
+		}
+		line := p.cfg.Prefix + s.name + ":" + strconv.FormatFloat(value, 'f', -1, 64) + "|" + kind
+		for i, l := range s.labels {
+			sep := ","
+			if i == 0 {
+				sep = "|#"
+			}
+			line += sep + l[0] + ":" + statsdTag.Replace(l[1])
+		}
+		if len(packet) > 0 && len(packet)+1+len(line) > p.cfg.MaxPacket {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+		if len(packet) > 0 {
+			packet = append(packet, '\n')
+		}
+		packet = append(packet, line...)
+	}
+	return flush()
+}
+
+// The OTLP metrics request, in its JSON encoding.
+type (
+	otlpRequest struct {
+		ResourceMetrics []otlpResourceMetrics `json:"resourceMetrics"`
+	}
+	otlpResourceMetrics struct {
+		Resource     otlpResource       `json:"resource"`
+		ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+	}
+	otlpResource struct {
+		Attributes []otlpAttribute `json:"attributes"`
+	}
+	otlpScopeMetrics struct {
+		Scope   otlpScope    `json:"scope"`
+		Metrics []otlpMetric `json:"metrics"`
+	}
+	otlpScope struct {
+		Name string `json:"name"`
+	}
+	otlpMetric struct {
+		Name  string    `json:"name"`
+		Gauge *otlpData `json:"gauge,omitempty"`
+		Sum   *otlpData `json:"sum,omitempty"`
+	}
+	otlpData struct {
+		DataPoints             []otlpPoint `json:"dataPoints"`
+		AggregationTemporality int         `json:"aggregationTemporality,omitempty"`
+		IsMonotonic            bool        `json:"isMonotonic,omitempty"`
+	}
+	otlpPoint struct {
+		Attributes        []otlpAttribute `json:"attributes,omitempty"`
+		StartTimeUnixNano string          `json:"startTimeUnixNano,omitempty"`
+		TimeUnixNano      string          `json:"timeUnixNano"`
+		AsDouble          float64         `json:"asDouble"`
+	}
+	otlpAttribute struct {
+		Key   string    `json:"key"`
+		Value otlpValue `json:"value"`
+	}
+	otlpValue struct {
+		StringValue string `json:"stringValue"`
+	}
+)
+
+// temporalityCumulative is OTLP's AGGREGATION_TEMPORALITY_CUMULATIVE.
+const temporalityCumulative = 2
+
+// pushOTLP sends all samples in one request, counters as cumulative sums
+// since the pusher started.
+func (p *Pusher) pushOTLP(ctx context.Context, samples []sample) error {
+	now := strconv.FormatInt(time.Now().UnixNano(), 10)
+	start := strconv.FormatInt(p.start.UnixNano(), 10)
+	var metrics []otlpMetric
+	byName := make(map[string]int)
+	for _, s := range samples {
+		i, ok := byName[s.name]
+		if !ok {
+			i = len(metrics)
+			byName[s.name] = i
+			m := otlpMetric{Name: s.name}
+			if s.counter {
+				m.Sum = &otlpData{AggregationTemporality: temporalityCumulative, IsMonotonic: true}
+			} else {
+				m.Gauge = &otlpData{}
+			}
+			metrics = append(metrics, m)
+		}
+		point := otlpPoint{TimeUnixNano: now, AsDouble: s.value}
+		for _, l := range s.labels {
+			point.Attributes = append(point.Attributes, otlpAttribute{Key: l[0], Value: otlpValue{StringValue: l[1]}})
+		}
+		if m := &metrics[i]; m.Sum != nil {
+			point.StartTimeUnixNano = start
+			m.Sum.DataPoints = append(m.Sum.DataPoints, point)
+		} else {
+			m.Gauge.DataPoints = append(m.Gauge.DataPoints, point)
+		}
+	}
+
+	body, err := json.Marshal(otlpRequest{ResourceMetrics: []otlpResourceMetrics{{
+		Resource: otlpResource{Attributes: []otlpAttribute{
+			{Key: "service.name", Value: otlpValue{StringValue: p.cfg.ServiceName}},
+		}},
+		ScopeMetrics: []otlpScopeMetrics{{Scope: otlpScope{Name: "order-processor"}, Metrics: metrics}},
+	}}})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.cfg.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("otlp: %s", resp.Status)
+	}
+	return nil
+}
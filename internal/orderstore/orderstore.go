@@ -0,0 +1,324 @@
+// Package orderstore tracks the orders the pool has accepted as they move
+// through processing, so clients can look up an order's state and result
+// after submitting it, or list orders by state and customer.
+package orderstore
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/pkg/models"
+)
+
+// State is where an order is in the pool.
+type State string
+
+const (
+	Queued     State = "queued"
+	Held       State = "held" // kept from processing by an operator
+	Processing State = "processing"
+	Processed  State = "processed"
+	Failed     State = "failed"
+	Removed    State = "removed" // taken out of its queue by an operator
+	Cancelled  State = "cancelled"
+)
+
+// ErrExists is returned by Put for an order ID that already has a record,
+// which may belong to another tenant.
+var ErrExists = errors.New("an order with this ID already exists")
+
+// Unfinished are the states of orders the pool keeps in memory, which a
+// restart loses unless they were spilled to disk.
+var Unfinished = []State{Queued, Held, Processing}
+
+// Record is an order's current state and, once processed, its result.
+type Record struct {
+	Order     models.Order           `json:"order"`
+	State     State                  `json:"state"`
+	Result    *models.ProcessedOrder `json:"result,omitempty"`
+	UpdatedAt time.Time              `json:"updated_at"`
+}
+
+// Repository is where the pool keeps its order records. Store, the
+// default, keeps them in memory; other backends implement Repository too.
+// Updates of unknown orders are ignored. Only Put and Prune report
+// errors, since an order must not be queued without its record; durable
+// backends log the errors of other writes.
+type Repository interface {
+	// Put records a new order in state. It fails with ErrExists if the
+	// order's ID has a record already.
+	Put(o models.Order, state State) error
+	SetState(id string, state State)
+	// Update changes a known order's record with fn.
+	Update(id string, fn func(*Record))
+	// Finish records an order's result, marking it processed or failed.
+	Finish(result models.ProcessedOrder)
+	// Forget drops an order's record, e.g. when it couldn't be queued
+	// after all.
+	Forget(id string)
+	Get(id string) (Record, bool)
+	// List returns the page of records matching q, newest first, and how
+	// many match in all.
+	List(q Query) ([]Record, int)
+	// Prune deletes tenant's finished records last changed before
+	// before, returning how many it deleted.
+	Prune(tenant string, before time.Time) (int, error)
+}
+
+// Shared is implemented by repositories several instances use at once.
+// They record the instance that accepted each order, so that at startup
+// an instance only takes over its own unfinished orders, and those of
+// instances that stopped.
+type Shared interface {
+	// Adopt makes this instance the owner of the unfinished records of
+	// instances that stopped, returning how many it took over.
+	Adopt(ctx context.Context) (int, error)
+	// Owned returns the records of this instance matching q, newest
+	// first.
+	Owned(q Query) []Record
+}
+
+// Summarizer is implemented by repositories that can summarize every
+// record they keep, such as a database that outlives the process, where
+// the pool's own counters start over at each restart.
+type Summarizer interface {
+	Summary(ctx context.Context) (Summary, error)
+}
+
+// Summary counts the records of a repository.
+type Summary struct {
+	Total            int64           `json:"total"`
+	ByState          map[State]int64 `json:"by_state"`
+	AvgProcessingMs  float64         `json:"avg_processing_ms"`
+	P95ProcessingMs  float64         `json:"p95_processing_ms"`
+	OldestUnfinished *time.Time      `json:"oldest_unfinished,omitempty"` // when its record last changed
+	LastFinished     *time.Time      `json:"last_finished,omitempty"`
+	ComputedAt       time.Time       `json:"computed_at"`
+}
+
+// Query selects records. Empty fields match every record.
+type Query struct {
+	// Status matches the record's state, such as "queued" or "processed",
+	// or the order's status, such as "pending".
+	Status   string
+	Customer string
+
+	// States matches records in any of the states, by state alone.
+	States []State
+
+	// Tenant and SubmittedBy scope the query to one tenant or API key.
+	Tenant      string
+	SubmittedBy string
+
+	// ParentID matches the orders derived from an order.
+	ParentID string
+
+	// Tags matches orders carrying every one of the tags.
+	Tags map[string]string
+
+	Limit  int // zero returns every match
+	Offset int
+}
+
+// Matches reports whether rec is selected by q, ignoring the page.
+func (q Query) Matches(rec *Record) bool {
+	o := &rec.Order
+	return (q.Status == "" || q.Status == string(rec.State) || q.Status == string(o.Status)) &&
+		(len(q.States) == 0 || slices.Contains(q.States, rec.State)) &&
+		(q.Customer == "" || strings.EqualFold(q.Customer, o.Customer)) &&
+		(q.Tenant == "" || q.Tenant == o.Tenant) &&
+		(q.SubmittedBy == "" || q.SubmittedBy == o.SubmittedBy) &&
+		(q.ParentID == "" || q.ParentID == o.ParentID) &&
+		hasTags(o.Tags, q.Tags)
+}
+
+func hasTags(tags, want map[string]string) bool {
+	for k, v := range want {
+		if got, ok := tags[k]; !ok || got != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Store keeps the records of the most recent orders in memory. When more
+// than max orders are tracked the oldest is forgotten. Methods on a nil
+// Store do nothing.
+type Store struct {
+	max int
+
+	mu      sync.RWMutex
+	records map[string]*entry
+	order   []position // insertion order for eviction and listing
+	next    uint64
+}
+
+var _ Repository = (*Store)(nil)
+
+type entry struct {
+	Record
+	seq uint64
+}
+
+// position is where a record was inserted. A forgotten and re-added order
+// is listed once, at its latest position.
+type position struct {
+	id  string
+	seq uint64
+}
+
+func New(max int) *Store {
+	return &Store{
+		max:     max,
+		records: make(map[string]*entry),
+	}
+}
+
+func (s *Store) Put(o models.Order, state State) error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.records[o.ID]; ok {
+		return ErrExists
+	}
+	s.put(o, state)
+	return nil
+}
+
+// put must be called with s.mu held.
+func (s *Store) put(o models.Order, state State) *Record {
+	e, ok := s.records[o.ID]
+	if !ok {
+		s.next++
+		e = &entry{seq: s.next}
+		s.records[o.ID] = e
+		s.order = append(s.order, position{id: o.ID, seq: e.seq})
+		for len(s.records) > s.max {
+			s.evict()
+		}
+		if len(s.order) > 2*s.max {
+			// Forgotten orders leave their positions behind.
+			s.order = slices.DeleteFunc(s.order, s.stale)
+		}
+	}
+	e.Order, e.State, e.UpdatedAt = o, state, time.Now()
+	return &e.Record
+}
+
+// evict must be called with s.mu held.
+func (s *Store) evict() {
+	oldest := s.order[0]
+	s.order = s.order[1:]
+	if !s.stale(oldest) {
+		delete(s.records, oldest.id)
+	}
+}
+
+// stale reports whether pos no longer locates a record. It must be called
+// with s.mu held.
+func (s *Store) stale(pos position) bool {
+	e, ok := s.records[pos.id]
+	return !ok || e.seq != pos.seq
+}
+
+func (s *Store) SetState(id string, state State) {
+	s.Update(id, func(rec *Record) { rec.State = state })
+}
+
+func (s *Store) Update(id string, fn func(*Record)) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.records[id]; ok {
+		fn(&e.Record)
+		e.UpdatedAt = time.Now()
+	}
+}
+
+func (s *Store) Finish(result models.ProcessedOrder) {
+	if s == nil {
+		return
+	}
+	state := Processed
+	if !result.Success {
+		state = Failed
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.put(result.Order, state).Result = &result
+}
+
+func (s *Store) Forget(id string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, id)
+}
+
+func (s *Store) Prune(tenant string, before time.Time) (int, error) {
+	if s == nil {
+		return 0, nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for id, e := range s.records {
+		if e.Order.Tenant == tenant && e.UpdatedAt.Before(before) && !slices.Contains(Unfinished, e.State) {
+			delete(s.records, id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// Get returns a copy of an order's record.
+func (s *Store) Get(id string) (Record, bool) {
+	if s == nil {
+		return Record{}, false
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	e, ok := s.records[id]
+	if !ok {
+		return Record{}, false
+	}
+	return e.Record, true
+}
+
+func (s *Store) List(q Query) ([]Record, int) {
+	if s == nil {
+		return nil, 0
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	page := []Record{}
+	total := 0
+	for i := len(s.order) - 1; i >= 0; i-- {
+		pos := s.order[i]
+		if s.stale(pos) {
+			continue
+		}
+		e := s.records[pos.id]
+		if !q.Matches(&e.Record) {
+			continue
+		}
+		if total >= q.Offset && (q.Limit == 0 || len(page) < q.Limit) {
+			page = append(page, e.Record)
+		}
+		total++
+	}
+	return page, total
+}
@@ -0,0 +1,92 @@
+package outbound
+
+import (
+	"sync"
+	"time"
+)
+
+// destination tracks one host's circuit breaker and metrics. The breaker
+// opens after enough consecutive failures, rejects calls for OpenFor, then
+// lets a single trial call through: success closes it, failure reopens it.
+type destination struct {
+	host string
+
+	mu          sync.Mutex
+	consecutive int
+	openedAt    time.Time // zero while closed
+	trial       bool      // a half-open trial call is in flight
+
+	requests int64
+	failures int64
+	retries  int64
+	rejects  int64
+	latency  time.Duration
+}
+
+func (d *destination) allow(openFor time.Duration) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.openedAt.IsZero() {
+		return true
+	}
+	if time.Since(d.openedAt) < openFor || d.trial {
+		return false
+	}
+	d.trial = true
+	return true
+}
+
+func (d *destination) record(latency time.Duration, failed bool, threshold int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.requests++
+	d.latency += latency
+	wasTrial := d.trial
+	d.trial = false
+	if !failed {
+		d.consecutive = 0
+		d.openedAt = time.Time{}
+		return
+	}
+	d.failures++
+	d.consecutive++
+	if wasTrial || (threshold > 0 && d.consecutive >= threshold) {
+		d.openedAt = time.Now()
+	}
+}
+
+func (d *destination) retried() {
+	d.mu.Lock()
+	d.retries++
+	d.mu.Unlock()
+}
+
+func (d *destination) rejected() {
+	d.mu.Lock()
+	d.rejects++
+	d.mu.Unlock()
+}
+
+func (d *destination) stats(openFor time.Duration) DestinationStats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	s := DestinationStats{
+		Host:     d.host,
+		Requests: d.requests,
+		Failures: d.failures,
+		Retries:  d.retries,
+		Rejected: d.rejects,
+		Circuit:  "closed",
+	}
+	switch {
+	case d.openedAt.IsZero():
+	case time.Since(d.openedAt) < openFor:
+		s.Circuit = "open"
+	default:
+		s.Circuit = "half_open"
+	}
+	if d.requests > 0 {
+		s.AvgLatencyMs = float64(d.latency.Milliseconds()) / float64(d.requests)
+	}
+	return s
+}
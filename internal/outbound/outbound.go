@@ -0,0 +1,192 @@
+// Package outbound is the shared HTTP client for calls to other services.
+// It adds per-attempt timeouts, retries with backoff, a circuit breaker per
+// destination host and per-destination metrics on top of one pooled
+// transport, so integrations only need an *http.Client.
+package outbound
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned while a destination's breaker is open.
+var ErrCircuitOpen = errors.New("circuit open")
+
+type Config struct {
+	Timeout          time.Duration // per attempt
+	Retries          int           // extra attempts for retryable failures
+	Backoff          time.Duration // doubled after every attempt, with jitter
+	FailureThreshold int           // consecutive failures that open the breaker
+	OpenFor          time.Duration // how long an open breaker rejects calls
+	MaxIdlePerHost   int
+}
+
+// Client is an http.RoundTripper; use HTTP or wrap it in your own
+// http.Client to set an overall timeout.
+type Client struct {
+	cfg    Config
+	base   http.RoundTripper
+	public http.RoundTripper // base, connecting to public addresses only
+
+	mu    sync.Mutex
+	dests map[string]*destination
+}
+
+func New(cfg Config) *Client {
+	base := http.DefaultTransport.(*http.Transport).Clone()
+	base.MaxIdleConnsPerHost = cfg.MaxIdlePerHost
+	return &Client{cfg: cfg, base: base, public: publicTransport(base), dests: make(map[string]*destination)}
+}
+
+// HTTP returns an http.Client using c, with an overall timeout.
+func (c *Client) HTTP(timeout time.Duration) *http.Client {
+	return &http.Client{Transport: c, Timeout: timeout}
+}
+
+func (c *Client) RoundTrip(req *http.Request) (*http.Response, error) {
+	return c.roundTrip(req, c.base)
+}
+
+func (c *Client) roundTrip(req *http.Request, base http.RoundTripper) (*http.Response, error) {
+	d := c.destination(req.URL.Host)
+	retryable := canRetry(req)
+	backoff := c.cfg.Backoff
+	usage := usageFrom(req.Context())
+
+	for attempt := 0; ; attempt++ {
+		if !d.allow(c.cfg.OpenFor) {
+			d.rejected()
+			return nil, fmt.Errorf("%s: %w", req.URL.Host, ErrCircuitOpen)
+		}
+
+		if usage != nil {
+			usage.Calls.Add(1)
+		}
+		resp, err := c.attempt(req, base, d)
+		if attempt >= c.cfg.Retries || !retryable || !shouldRetry(req.Context(), resp, err) {
+			return resp, err
+		}
+		if resp != nil {
+			_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+			resp.Body.Close()
+		}
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+
+		d.retried()
+		if usage != nil {
+			usage.Retries.Add(1)
+		}
+		wait := backoff/2 + rand.N(backoff/2+1)
+		backoff *= 2
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+func (c *Client) attempt(req *http.Request, base http.RoundTripper, d *destination) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(req.Context(), c.cfg.Timeout)
+	start := time.Now()
+	resp, err := base.RoundTrip(req.WithContext(ctx))
+	failed := err != nil || resp.StatusCode >= 500
+	d.record(time.Since(start), failed, c.cfg.FailureThreshold)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	// The attempt's deadline keeps applying while the caller reads the body.
+	resp.Body = cancelOnClose{resp.Body, cancel}
+	return resp, nil
+}
+
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// canRetry reports whether sending req twice is safe.
+func canRetry(req *http.Request) bool {
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return req.Header.Get("Idempotency-Key") != ""
+}
+
+func shouldRetry(ctx context.Context, resp *http.Response, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if err != nil {
+		return !errors.Is(err, ErrCircuitOpen) && !errors.Is(err, ErrPrivateAddress)
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+func (c *Client) destination(host string) *destination {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	d, ok := c.dests[host]
+	if !ok {
+		d = &destination{host: host}
+		c.dests[host] = d
+	}
+	return d
+}
+
+// DestinationStats are the metrics of one destination host.
+type DestinationStats struct {
+	Host         string  `json:"host"`
+	Requests     int64   `json:"requests"`
+	Failures     int64   `json:"failures"`
+	Retries      int64   `json:"retries"`
+	Rejected     int64   `json:"rejected"` // refused by the open breaker
+	Circuit      string  `json:"circuit"`  // closed, open or half_open
+	AvgLatencyMs float64 `json:"avg_latency_ms"`
+}
+
+// Stats returns per-destination metrics sorted by host.
+func (c *Client) Stats() []DestinationStats {
+	c.mu.Lock()
+	dests := make([]*destination, 0, len(c.dests))
+	for _, d := range c.dests {
+		dests = append(dests, d)
+	}
+	c.mu.Unlock()
+
+	stats := make([]DestinationStats, len(dests))
+	for i, d := range dests {
+		stats[i] = d.stats(c.cfg.OpenFor)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Host < stats[j].Host })
+	return stats
+}
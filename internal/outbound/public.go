@@ -0,0 +1,66 @@
+package outbound
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// ErrPrivateAddress is returned for connections PublicHTTP refuses.
+var ErrPrivateAddress = errors.New("destination is a loopback, private or link-local address")
+
+// IsPublic reports whether ip may be reached at a URL a client chose: it
+// isn't a loopback, private, link-local (such as a cloud metadata
+// endpoint), interface-local or unspecified address.
+func IsPublic(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsUnspecified())
+}
+
+// PublicHTTP is HTTP for URLs clients chose, such as webhooks they
+// register. Its connections are checked when they are dialed, after the
+// host is resolved, so a host that resolves to a private address later
+// is refused too. Redirects aren't followed: the caller gets the
+// redirect response. It connects directly, without the environment's
+// proxy.
+func (c *Client) PublicHTTP(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Transport: publicOnly{c},
+		Timeout:   timeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// publicOnly is a Client sending over its public transport.
+type publicOnly struct{ c *Client }
+
+func (p publicOnly) RoundTrip(req *http.Request) (*http.Response, error) {
+	return p.c.roundTrip(req, p.c.public)
+}
+
+// publicTransport is base dialing only public addresses.
+func publicTransport(base *http.Transport) *http.Transport {
+	t := base.Clone()
+	t.Proxy = nil
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control: func(_, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !IsPublic(ip) {
+				return fmt.Errorf("%w: %s", ErrPrivateAddress, host)
+			}
+			return nil
+		},
+	}
+	t.DialContext = dialer.DialContext
+	return t
+}
@@ -0,0 +1,25 @@
+package outbound
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// Usage counts the calls made on behalf of one unit of work, such as an
+// order, for cost accounting.
+type Usage struct {
+	Calls   atomic.Int64 // attempts sent, retries included
+	Retries atomic.Int64
+}
+
+type usageKey struct{}
+
+// WithUsage returns a context whose outbound requests are counted in u.
+func WithUsage(ctx context.Context, u *Usage) context.Context {
+	return context.WithValue(ctx, usageKey{}, u)
+}
+
+func usageFrom(ctx context.Context) *Usage {
+	u, _ := ctx.Value(usageKey{}).(*Usage)
+	return u
+}
@@ -0,0 +1,197 @@
+// Package payload keeps the raw body of each accepted order submission
+// for a retention period, so disputes about what a client actually sent
+// can be settled. Sensitive fields are replaced with a hash of their
+// value: a client's copy can still be checked against it, but the value
+// isn't stored.
+package payload
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/url"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/blobstore"
+)
+
+const (
+	prefix = "payloads/"
+
+	// pruneEvery is how often payloads past their retention are deleted.
+	pruneEvery = time.Hour
+
+	// day names the directory of the payloads received on one day.
+	day = "2006-01-02"
+)
+
+type Config struct {
+	Retention time.Duration // at least; payloads are deleted a day at a time
+	Mask      []string      // JSON fields, at any depth, whose values are hashed
+}
+
+// Payload is one submission as it was received.
+type Payload struct {
+	OrderID     string    `json:"order_id"`
+	ReceivedAt  time.Time `json:"received_at"`
+	Tenant      string    `json:"tenant,omitempty"`
+	SubmittedBy string    `json:"submitted_by,omitempty"` // the API key's ID
+	ContentType string    `json:"content_type,omitempty"`
+	Size        int       `json:"size"`
+	// SHA256 is the hash of the body as received, before masking.
+	SHA256 string          `json:"sha256"`
+	Body   json.RawMessage `json:"body,omitempty"`
+	Text   string          `json:"text,omitempty"` // a body that isn't JSON
+	// Masked lists the fields whose values were replaced with
+	// "sha256:<hex>" of their JSON encoding.
+	Masked []string `json:"masked,omitempty"`
+}
+
+type Store struct {
+	blobs blobstore.Store
+	cfg   Config
+}
+
+func New(blobs blobstore.Store, cfg Config) *Store {
+	return &Store{blobs: blobs, cfg: cfg}
+}
+
+// Save keeps body, as received for the order p describes, with the fields
+// of cfg.Mask hashed; the body fields of p are set here. A nil Store saves
+// nothing.
+func (s *Store) Save(p Payload, body []byte) error {
+	if s == nil {
+		return nil
+	}
+	sum := sha256.Sum256(body)
+	p.SHA256 = hex.EncodeToString(sum[:])
+	p.Size = len(body)
+	var doc any
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber() // keep amounts exactly as sent
+	if dec.Decode(&doc) == nil {
+		doc = s.mask(doc, "", &p.Masked)
+		p.Body, _ = json.Marshal(doc)
+	} else {
+		p.Text = string(body)
+	}
+	slices.Sort(p.Masked)
+
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	return s.blobs.Put(key(p.OrderID, p.ReceivedAt), data)
+}
+
+// key files a payload under the day it was received, so pruning needn't
+// read it, and under its order, as an order ID can be submitted again.
+func key(orderID string, at time.Time) string {
+	at = at.UTC()
+	return prefix + at.Format(day) + "/" + escape(orderID) + "/" + strconv.FormatInt(at.UnixNano(), 10)
+}
+
+// escape makes an order ID a single key segment, even "." or "..".
+func escape(orderID string) string {
+	return strings.ReplaceAll(url.PathEscape(orderID), ".", "%2E")
+}
+
+// mask hashes the values of the configured fields of a decoded JSON
+// document, collecting their paths in masked.
+func (s *Store) mask(v any, at string, masked *[]string) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, child := range v {
+			field := strings.TrimPrefix(at+"."+k, ".")
+			if slices.Contains(s.cfg.Mask, k) {
+				v[k] = hashed(child)
+				*masked = append(*masked, field)
+			} else {
+				v[k] = s.mask(child, field, masked)
+			}
+		}
+	case []any:
+		for i, child := range v {
+			v[i] = s.mask(child, at+"["+strconv.Itoa(i)+"]", masked)
+		}
+	}
+	return v
+}
+
+func hashed(v any) string {
+	data, _ := json.Marshal(v)
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// Get returns the payloads kept for orderID, oldest first.
+func (s *Store) Get(orderID string) ([]Payload, error) {
+	keys, err := s.blobs.List(prefix)
+	if err != nil {
+		return nil, err
+	}
+	id := escape(orderID)
+	var payloads []Payload
+	for _, k := range keys {
+		if path.Base(path.Dir(k)) != id {
+			continue
+		}
+		data, err := s.blobs.Get(k)
+		if err != nil {
+			return nil, err
+		}
+		var p Payload
+		if err := json.Unmarshal(data, &p); err != nil {
+			return nil, err
+		}
+		payloads = append(payloads, p)
+	}
+	slices.SortFunc(payloads, func(a, b Payload) int { return a.ReceivedAt.Compare(b.ReceivedAt) })
+	return payloads, nil
+}
+
+// Run deletes payloads past their retention until ctx is done.
+func (s *Store) Run(ctx context.Context) {
+	ticker := time.NewTicker(pruneEvery)
+	defer ticker.Stop()
+	for {
+		s.prune(time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Store) prune(now time.Time) {
+	keys, err := s.blobs.List(prefix)
+	if err != nil {
+		log.Printf("payloads: list: %v", err)
+		return
+	}
+	// A day's payloads go once its last one is past the retention.
+	cutoff := now.UTC().Add(-s.cfg.Retention).Format(day)
+	deleted := 0
+	for _, k := range keys {
+		received, _, _ := strings.Cut(strings.TrimPrefix(k, prefix), "/")
+		if received >= cutoff {
+			continue
+		}
+		if err := s.blobs.Delete(k); err != nil {
+			log.Printf("payloads: delete %s: %v", k, err)
+			continue
+		}
+		deleted++
+	}
+	if deleted > 0 {
+		log.Printf("payloads: deleted %d past their %s retention", deleted, s.cfg.Retention)
+	}
+}
@@ -0,0 +1,183 @@
+package payment
+
+import (
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/pkg/models"
+)
+
+var (
+	ErrAccountNotFound error = permanentError("credit account not found")
+	ErrInvalidAmount   error = permanentError("amount must be > 0")
+	ErrAccountOwner    error = permanentError("credit account belongs to another customer")
+)
+
+// Ledger entry kinds.
+const (
+	EntryDeposit = "deposit"
+	EntryHold    = "hold"
+	EntryCapture = "capture"
+	EntryRelease = "release"
+)
+
+// Entry is one movement on a credit account.
+type Entry struct {
+	At      time.Time    `json:"at"`
+	Kind    string       `json:"kind"`
+	Amount  models.Money `json:"amount"`
+	OrderID string       `json:"order_id,omitempty"`
+}
+
+// Account is a store credit or gift card balance. Held funds are reserved
+// for in-flight orders and not available to others. Only orders of the
+// account's tenant, and of its customer when it has one, can spend it.
+type Account struct {
+	ID       string       `json:"id"`
+	Tenant   string       `json:"tenant,omitempty"`
+	Customer string       `json:"customer,omitempty"`
+	Balance  models.Money `json:"balance"`
+	Held     models.Money `json:"held"`
+	Entries  []Entry      `json:"entries"`
+
+	holds map[string]models.Money // order ID -> held amount
+}
+
+// Available is the balance that can still be applied to new orders.
+func (a *Account) Available() models.Money {
+	return a.Balance - a.Held
+}
+
+// Ledger keeps credit balances in memory.
+type Ledger struct {
+	mu       sync.Mutex
+	accounts map[string]*Account
+}
+
+func NewLedger() *Ledger {
+	return &Ledger{accounts: make(map[string]*Account)}
+}
+
+// Deposit adds credit to an account, creating it for tenant and customer
+// if needed. Deposits to an existing account must name its owner, or no
+// customer.
+func (l *Ledger) Deposit(id, tenant, customer string, amount models.Money) (Account, error) {
+	if amount <= 0 {
+		return Account{}, ErrInvalidAmount
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	a, ok := l.accounts[id]
+	if !ok {
+		a = &Account{ID: id, Tenant: tenant, Customer: customer, holds: make(map[string]models.Money)}
+		l.accounts[id] = a
+	}
+	if a.Tenant != tenant {
+		return Account{}, ErrAccountNotFound
+	}
+	if customer != "" && !strings.EqualFold(a.Customer, customer) {
+		return Account{}, ErrAccountOwner
+	}
+	a.Balance += amount
+	a.record(EntryDeposit, amount, "")
+	return a.copy(), nil
+}
+
+// Get returns an account with its entries.
+func (l *Ledger) Get(id string) (Account, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	a, ok := l.accounts[id]
+	if !ok {
+		return Account{}, ErrAccountNotFound
+	}
+	return a.copy(), nil
+}
+
+// Authorize checks that order may spend the account's credit: it belongs
+// to the account's tenant and, when the account has one, its customer.
+func (l *Ledger) Authorize(id string, order models.Order) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	a, ok := l.accounts[id]
+	if !ok || a.Tenant != order.Tenant {
+		return ErrAccountNotFound
+	}
+	if a.Customer != "" && !strings.EqualFold(a.Customer, order.Customer) {
+		return ErrAccountOwner
+	}
+	return nil
+}
+
+// Hold reserves up to limit of the available balance for an order and
+// returns the amount reserved.
+func (l *Ledger) Hold(id, orderID string, limit models.Money) (models.Money, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	a, ok := l.accounts[id]
+	if !ok {
+		return 0, ErrAccountNotFound
+	}
+	amount := min(a.Available(), limit)
+	if amount <= 0 {
+		return 0, nil
+	}
+	a.holds[orderID] += amount
+	a.Held += amount
+	a.record(EntryHold, amount, orderID)
+	return amount, nil
+}
+
+// Capture turns an order's hold into a debit.
+func (l *Ledger) Capture(id, orderID string) {
+	l.settle(id, orderID, EntryCapture)
+}
+
+// Release returns an order's hold to the available balance.
+func (l *Ledger) Release(id, orderID string) {
+	l.settle(id, orderID, EntryRelease)
+}
+
+func (l *Ledger) settle(id, orderID, kind string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	a, ok := l.accounts[id]
+	if !ok {
+		return
+	}
+	amount, ok := a.holds[orderID]
+	if !ok {
+		return
+	}
+	delete(a.holds, orderID)
+	a.Held -= amount
+	if kind == EntryCapture {
+		a.Balance -= amount
+	}
+	a.record(kind, amount, orderID)
+}
+
+// maxEntries caps the per-account history kept in memory.
+const maxEntries = 200
+
+func (a *Account) record(kind string, amount models.Money, orderID string) {
+	a.Entries = append(a.Entries, Entry{At: time.Now(), Kind: kind, Amount: amount, OrderID: orderID})
+	if len(a.Entries) > maxEntries {
+		a.Entries = a.Entries[len(a.Entries)-maxEntries:]
+	}
+}
+
+func (a *Account) copy() Account {
+	c := *a
+	c.Entries = slices.Clone(a.Entries)
+	c.holds = nil
+	return c
+}
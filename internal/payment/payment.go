@@ -0,0 +1,220 @@
+package payment
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/pkg/models"
+)
+
+// ErrDeclined is permanent: retrying the order won't change the answer.
+var ErrDeclined error = permanentError("payment declined")
+
+// permanentError marks failures that retrying can't fix, for the pool's
+// retry policy.
+type permanentError string
+
+func (e permanentError) Error() string   { return string(e) }
+func (e permanentError) Permanent() bool { return true }
+
+// Gateway charges the part of an order not covered by store credit.
+type Gateway interface {
+	Charge(ctx context.Context, orderID string, amount models.Money) (reference string, err error)
+}
+
+// SimulatedGateway approves charges up to DeclineAbove and declines the
+// rest, after a fixed latency.
+type SimulatedGateway struct {
+	Latency      time.Duration
+	DeclineAbove models.Money // 0 approves everything
+}
+
+func (g SimulatedGateway) Charge(ctx context.Context, orderID string, amount models.Money) (string, error) {
+	select {
+	case <-time.After(g.Latency):
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+	if g.DeclineAbove > 0 && amount > g.DeclineAbove {
+		return "", ErrDeclined
+	}
+	return "sim_" + orderID, nil
+}
+
+// HTTPGateway charges through a provider's HTTP API, e.g. cmd/mockproviders:
+// POST {URL}/charges with the order ID as idempotency key, so retried
+// charges are safe. 402 means declined.
+type HTTPGateway struct {
+	URL    string
+	Client *http.Client
+}
+
+func (g HTTPGateway) Charge(ctx context.Context, orderID string, amount models.Money) (string, error) {
+	body, err := json.Marshal(map[string]any{"order_id": orderID, "amount": amount})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(g.URL, "/")+"/charges", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", orderID)
+
+	resp, err := g.Client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusPaymentRequired:
+		return "", ErrDeclined
+	default:
+		return "", fmt.Errorf("gateway returned status %d", resp.StatusCode)
+	}
+	var charge struct {
+		Reference string `json:"reference"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&charge); err != nil {
+		return "", fmt.Errorf("decode gateway response: %w", err)
+	}
+	return charge.Reference, nil
+}
+
+// maxPaid caps how many payments of unfinished orders Payments
+// remembers.
+const maxPaid = 100000
+
+// paid is the payment of an accepted order, with what it was made for.
+type paid struct {
+	amount  models.Money
+	account string
+	payment models.Payment
+}
+
+// paidOrders remembers the payments of accepted orders until they
+// finish, oldest forgotten first beyond maxPaid.
+type paidOrders struct {
+	mu       sync.Mutex
+	payments map[string]paid
+	order    []string
+}
+
+// acceptance identifies one acceptance of an order: its ID may be taken
+// again by a later order, or the same order accepted again, e.g. from
+// the dead letters, which must be paid anew.
+func acceptance(o models.Order) string {
+	return o.Tenant + "\x00" + o.ID + "\x00" + strconv.FormatInt(o.CreatedAt.UnixNano(), 10)
+}
+
+func (p *paidOrders) get(key string) (paid, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	payment, ok := p.payments[key]
+	return payment, ok
+}
+
+func (p *paidOrders) add(key string, payment paid) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.payments[key]; !ok {
+		p.order = append(p.order, key)
+	}
+	p.payments[key] = payment
+	for len(p.order) > maxPaid {
+		delete(p.payments, p.order[0])
+		p.order[0] = ""
+		p.order = p.order[1:]
+	}
+}
+
+// forget drops key's payment; its position is skipped when it comes up.
+func (p *paidOrders) forget(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.payments, key)
+	if len(p.order) > 2*max(len(p.payments), 1024) {
+		p.order = slices.DeleteFunc(p.order, func(k string) bool {
+			_, ok := p.payments[k]
+			return !ok
+		})
+	}
+}
+
+// Payments applies an order's store credit first and charges the
+// remainder through the gateway. If the charge fails the credit hold is
+// released, so the customer's balance is untouched.
+//
+// An accepted order is paid once: when a later step fails and the order
+// is retried, Step reports the payment made by the earlier attempt
+// instead of holding credit and charging again, as long as the order's
+// amount and credit account are unchanged. Finished must be called with
+// every order that won't be retried.
+type Payments struct {
+	ledger  *Ledger
+	gateway Gateway
+	paid    paidOrders
+}
+
+func NewPayments(ledger *Ledger, gateway Gateway) *Payments {
+	return &Payments{ledger: ledger, gateway: gateway, paid: paidOrders{payments: make(map[string]paid)}}
+}
+
+// Finished forgets the payment of an order that reached its final state.
+func (p *Payments) Finished(o models.Order) {
+	p.paid.forget(acceptance(o))
+}
+
+// Step is the pipeline step.
+func (p *Payments) Step(ctx context.Context, processedOrder *models.ProcessedOrder) error {
+	order := processedOrder.Order
+	key := acceptance(order)
+	if earlier, ok := p.paid.get(key); ok && earlier.amount == order.Amount && earlier.account == order.CreditAccount {
+		payment := earlier.payment
+		processedOrder.Payment = &payment
+		return nil
+	}
+	result := &models.Payment{CreditAccount: order.CreditAccount}
+
+	remainder := order.Amount
+	if order.CreditAccount != "" {
+		if err := p.ledger.Authorize(order.CreditAccount, order); err != nil {
+			return fmt.Errorf("store credit: %w", err)
+		}
+		applied, err := p.ledger.Hold(order.CreditAccount, order.ID, order.Amount)
+		if err != nil {
+			return fmt.Errorf("store credit: %w", err)
+		}
+		result.CreditApplied = applied
+		remainder = order.Amount - applied
+	}
+
+	if remainder > 0 {
+		ref, err := p.gateway.Charge(ctx, order.ID, remainder)
+		if err != nil {
+			if result.CreditApplied > 0 {
+				p.ledger.Release(order.CreditAccount, order.ID)
+			}
+			return fmt.Errorf("charge %s: %w", remainder, err)
+		}
+		result.Charged = remainder
+		result.GatewayReference = ref
+	}
+
+	if result.CreditApplied > 0 {
+		p.ledger.Capture(order.CreditAccount, order.ID)
+	}
+	p.paid.add(key, paid{amount: order.Amount, account: order.CreditAccount, payment: *result})
+	processedOrder.Payment = result
+	return nil
+}
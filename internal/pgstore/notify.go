@@ -0,0 +1,131 @@
+package pgstore
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/pkg/models"
+)
+
+// resultsChannel is where instances announce the orders they finished.
+// A notification carries only the order's ID, since payloads are limited
+// to 8000 bytes; listeners read the result from the order's record.
+const resultsChannel = "order_results"
+
+// noticeBuffer is how many announcements may wait for the database before
+// Notify drops them.
+const noticeBuffer = 1024
+
+type notice struct {
+	Node string `json:"node"`
+	ID   string `json:"id"`
+}
+
+// Notify announces to the instances listening on the database that node
+// finished order id. The order's record must already hold its result.
+// It doesn't wait for the database: announcements are sent in the
+// background, and dropped while noticeBuffer of them are waiting.
+func (s *Orders) Notify(node, id string) {
+	select {
+	case s.notices <- notice{Node: node, ID: id}:
+	default:
+		log.Printf("orders: announcing %s: too many announcements waiting; dropped", id)
+	}
+}
+
+// announce sends the waiting announcements, as many at once as have
+// queued up while the last were sent, until ctx is done.
+func (s *Orders) announce(ctx context.Context) {
+	defer s.wg.Done()
+	for {
+		var first notice
+		select {
+		case <-ctx.Done():
+			return
+		case first = <-s.notices:
+		}
+		batch := []notice{first}
+	drain:
+		for len(batch) < noticeBuffer {
+			select {
+			case n := <-s.notices:
+				batch = append(batch, n)
+			default:
+				break drain
+			}
+		}
+		if err := s.notify(ctx, batch); err != nil && ctx.Err() == nil {
+			log.Printf("orders: announcing %d results: %v", len(batch), err)
+		}
+	}
+}
+
+func (s *Orders) notify(ctx context.Context, batch []notice) error {
+	payloads := make([]string, len(batch))
+	for i, n := range batch {
+		payload, err := json.Marshal(n)
+		if err != nil {
+			return err
+		}
+		payloads[i] = string(payload)
+	}
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	_, err := s.pool.Exec(ctx, `SELECT pg_notify($1, p) FROM unnest($2::text[]) AS p`, resultsChannel, payloads)
+	return err
+}
+
+// Listen calls handle with the result of every order another node
+// announces, until ctx is done. It keeps a connection of its own outside
+// the pool, reconnecting after errors; orders announced while it is
+// disconnected are missed.
+func (s *Orders) Listen(ctx context.Context, node string, handle func(models.ProcessedOrder)) {
+	backoff := time.Second
+	for ctx.Err() == nil {
+		err := s.listen(ctx, node, handle, func() { backoff = time.Second })
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("orders: listening for results: %v; reconnecting in %s", err, backoff)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, 30*time.Second)
+	}
+}
+
+// listen serves one connection, calling connected once it listens.
+func (s *Orders) listen(ctx context.Context, node string, handle func(models.ProcessedOrder), connected func()) error {
+	conn, err := pgx.ConnectConfig(ctx, s.pool.Config().ConnConfig.Copy())
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+	if _, err := conn.Exec(ctx, `LISTEN `+resultsChannel); err != nil {
+		return err
+	}
+	connected()
+	for {
+		n, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		var msg notice
+		if err := json.Unmarshal([]byte(n.Payload), &msg); err != nil {
+			log.Printf("orders: bad result notification %q: %v", n.Payload, err)
+			continue
+		}
+		if msg.Node == node {
+			continue // published where it was processed
+		}
+		if rec, ok := s.Get(msg.ID); ok && rec.Result != nil {
+			handle(*rec.Result)
+		}
+	}
+}
@@ -0,0 +1,449 @@
+// Package pgstore keeps order records in PostgreSQL, so they outlive the
+// process and are shared by every instance pointed at the same database.
+// The schema is created at Open if it doesn't exist. Each record notes the
+// instance that accepted the order, and instances note when they were
+// last seen, so one restarting only takes over its own unfinished orders
+// and those of instances that stopped.
+package pgstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/orderstore"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/pkg/models"
+)
+
+// queryTimeout bounds each statement; the repository's methods have no
+// context of their own.
+const queryTimeout = 5 * time.Second
+
+// schema holds each order's record as JSON next to the columns it is
+// queried by. seq keeps insertion order for listing newest first.
+const schema = `
+CREATE TABLE IF NOT EXISTS orders (
+	id           text PRIMARY KEY,
+	seq          bigint GENERATED ALWAYS AS IDENTITY,
+	state        text NOT NULL,
+	status       text NOT NULL,
+	customer     text NOT NULL,
+	tenant       text NOT NULL,
+	submitted_by text NOT NULL,
+	ord          jsonb NOT NULL,
+	result       jsonb,
+	updated_at   timestamptz NOT NULL
+);
+CREATE INDEX IF NOT EXISTS orders_seq ON orders (seq);
+CREATE INDEX IF NOT EXISTS orders_state ON orders (state, seq);
+CREATE INDEX IF NOT EXISTS orders_customer ON orders (lower(customer), seq);
+CREATE INDEX IF NOT EXISTS orders_tenant ON orders (tenant, seq);
+CREATE INDEX IF NOT EXISTS orders_parent ON orders ((ord->>'parent_id'));
+CREATE INDEX IF NOT EXISTS orders_tags ON orders USING gin ((ord->'tags'));
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS node text NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS orders_node ON orders (node, state);
+CREATE TABLE IF NOT EXISTS nodes (
+	id      text PRIMARY KEY,
+	seen_at timestamptz NOT NULL
+);
+`
+
+const (
+	// heartbeatEvery is how often an instance notes it is running.
+	heartbeatEvery = 10 * time.Second
+	// staleAfter is how long after it was last seen an instance is taken
+	// for stopped, and its unfinished orders may be adopted.
+	staleAfter = time.Minute
+)
+
+// Orders is an orderstore.Repository and orderstore.Summarizer. Unlike
+// the other backends it has no limit on the records it keeps; only
+// tenants' retention prunes them, or prune the table by updated_at.
+type Orders struct {
+	pool *pgxpool.Pool
+	node string
+
+	notices chan notice // for announce
+
+	stop context.CancelFunc
+	wg   sync.WaitGroup
+}
+
+var (
+	_ orderstore.Repository = (*Orders)(nil)
+	_ orderstore.Summarizer = (*Orders)(nil)
+	_ orderstore.Shared     = (*Orders)(nil)
+)
+
+// Open connects to the database at dsn, a postgres:// URL or key=value
+// string, and creates the schema. node names this instance, and must be
+// unique among the instances sharing the database; it is noted as
+// running until Close.
+func Open(ctx context.Context, dsn, node string) (*Orders, error) {
+	pool, err := pgxpool.New(ctx, dsn)
+	if err != nil {
+		return nil, err
+	}
+	setupCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	if _, err := pool.Exec(setupCtx, schema); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("create schema: %w", err)
+	}
+	s := &Orders{pool: pool, node: node, notices: make(chan notice, noticeBuffer)}
+	if err := s.heartbeat(setupCtx); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("register node: %w", err)
+	}
+	var runCtx context.Context
+	runCtx, s.stop = context.WithCancel(context.WithoutCancel(ctx))
+	s.wg.Add(2)
+	go s.heartbeats(runCtx)
+	go s.announce(runCtx)
+	return s, nil
+}
+
+func (s *Orders) Close() {
+	s.stop()
+	s.wg.Wait()
+	s.pool.Close()
+}
+
+// heartbeats notes that the instance is running until ctx is done.
+func (s *Orders) heartbeats(ctx context.Context) {
+	defer s.wg.Done()
+	ticker := time.NewTicker(heartbeatEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		hbCtx, cancel := context.WithTimeout(ctx, queryTimeout)
+		if err := s.heartbeat(hbCtx); err != nil && ctx.Err() == nil {
+			log.Printf("orders: heartbeat: %v", err)
+		}
+		cancel()
+	}
+}
+
+func (s *Orders) heartbeat(ctx context.Context) error {
+	_, err := s.pool.Exec(ctx, `
+		INSERT INTO nodes (id, seen_at) VALUES ($1, now())
+		ON CONFLICT (id) DO UPDATE SET seen_at = EXCLUDED.seen_at`, s.node)
+	return err
+}
+
+// Adopt takes over the unfinished records of instances not seen for
+// staleAfter, and of records written before instances were noted. Each
+// record goes to one instance even if several start at once.
+func (s *Orders) Adopt(ctx context.Context) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	tag, err := s.pool.Exec(ctx, `
+		UPDATE orders SET node = $1
+		WHERE state = ANY($2) AND node <> $1
+		  AND node NOT IN (SELECT id FROM nodes WHERE seen_at > now() - make_interval(secs => $3))`,
+		s.node, unfinished(), staleAfter.Seconds())
+	if err != nil {
+		return 0, err
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+// Owned lists the records accepted by this instance or adopted by it.
+func (s *Orders) Owned(q orderstore.Query) []orderstore.Record {
+	page, _ := s.list(q, s.node)
+	return page
+}
+
+func unfinished() []string {
+	states := make([]string, len(orderstore.Unfinished))
+	for i, st := range orderstore.Unfinished {
+		states[i] = string(st)
+	}
+	return states
+}
+
+func (s *Orders) Put(o models.Order, state orderstore.State) error {
+	ord, err := json.Marshal(o)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+	tag, err := s.pool.Exec(ctx, `
+		INSERT INTO orders (id, state, status, customer, tenant, submitted_by, ord, node, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, now())
+		ON CONFLICT (id) DO NOTHING`,
+		o.ID, string(state), string(o.Status), o.Customer, o.Tenant, o.SubmittedBy, ord, s.node)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return orderstore.ErrExists
+	}
+	return nil
+}
+
+func (s *Orders) SetState(id string, state orderstore.State) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+	if _, err := s.pool.Exec(ctx, `UPDATE orders SET state = $2, updated_at = now() WHERE id = $1`, id, string(state)); err != nil {
+		log.Printf("orders: updating %s: %v", id, err)
+	}
+}
+
+func (s *Orders) Update(id string, fn func(*orderstore.Record)) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+	err := pgx.BeginFunc(ctx, s.pool, func(tx pgx.Tx) error {
+		rec, err := scanRecord(tx.QueryRow(ctx, `SELECT `+columns+` FROM orders WHERE id = $1 FOR UPDATE`, id))
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		fn(&rec)
+		return write(ctx, tx, rec)
+	})
+	if err != nil {
+		log.Printf("orders: updating %s: %v", id, err)
+	}
+}
+
+func (s *Orders) Finish(result models.ProcessedOrder) {
+	state := orderstore.Processed
+	if !result.Success {
+		state = orderstore.Failed
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+	if err := write(ctx, s.pool, orderstore.Record{Order: result.Order, State: state, Result: &result}); err != nil {
+		log.Printf("orders: finishing %s: %v", result.Order.ID, err)
+	}
+}
+
+func (s *Orders) Forget(id string) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+	if _, err := s.pool.Exec(ctx, `DELETE FROM orders WHERE id = $1`, id); err != nil {
+		log.Printf("orders: forgetting %s: %v", id, err)
+	}
+}
+
+func (s *Orders) Prune(tenant string, before time.Time) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+	tag, err := s.pool.Exec(ctx, `
+		DELETE FROM orders WHERE tenant = $1 AND updated_at < $2 AND NOT state = ANY($3)`,
+		tenant, before, unfinished())
+	if err != nil {
+		return 0, err
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+func (s *Orders) Get(id string) (orderstore.Record, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+	rec, err := scanRecord(s.pool.QueryRow(ctx, `SELECT `+columns+` FROM orders WHERE id = $1`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return orderstore.Record{}, false
+	}
+	if err != nil {
+		log.Printf("orders: reading %s: %v", id, err)
+		return orderstore.Record{}, false
+	}
+	return rec, true
+}
+
+func (s *Orders) List(q orderstore.Query) ([]orderstore.Record, int) {
+	return s.list(q, "")
+}
+
+// list is List of the records of node, or of every node if it's empty.
+func (s *Orders) list(q orderstore.Query, node string) ([]orderstore.Record, int) {
+	var where []string
+	var args []any
+	arg := func(v any) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+	if node != "" {
+		where = append(where, "node = "+arg(node))
+	}
+	if q.Status != "" {
+		p := arg(q.Status)
+		where = append(where, "(state = "+p+" OR status = "+p+")")
+	}
+	if q.Customer != "" {
+		where = append(where, "lower(customer) = lower("+arg(q.Customer)+")")
+	}
+	if len(q.States) > 0 {
+		states := make([]string, len(q.States))
+		for i, st := range q.States {
+			states[i] = string(st)
+		}
+		where = append(where, "state = ANY("+arg(states)+")")
+	}
+	if q.Tenant != "" {
+		where = append(where, "tenant = "+arg(q.Tenant))
+	}
+	if q.SubmittedBy != "" {
+		where = append(where, "submitted_by = "+arg(q.SubmittedBy))
+	}
+	if q.ParentID != "" {
+		where = append(where, "ord->>'parent_id' = "+arg(q.ParentID))
+	}
+	if len(q.Tags) > 0 {
+		tags, err := json.Marshal(q.Tags)
+		if err != nil {
+			log.Printf("orders: listing: %v", err)
+			return []orderstore.Record{}, 0
+		}
+		where = append(where, "ord->'tags' @> "+arg(string(tags))+"::jsonb")
+	}
+	filter := ""
+	if len(where) > 0 {
+		filter = " WHERE " + strings.Join(where, " AND ")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+	page := []orderstore.Record{}
+	total := 0
+	if err := s.pool.QueryRow(ctx, `SELECT count(*) FROM orders`+filter, args...).Scan(&total); err != nil {
+		log.Printf("orders: listing: %v", err)
+		return page, 0
+	}
+	sql := `SELECT ` + columns + ` FROM orders` + filter + ` ORDER BY seq DESC OFFSET ` + arg(q.Offset)
+	if q.Limit > 0 {
+		sql += " LIMIT " + arg(q.Limit)
+	}
+	rows, err := s.pool.Query(ctx, sql, args...)
+	if err != nil {
+		log.Printf("orders: listing: %v", err)
+		return page, total
+	}
+	defer rows.Close()
+	for rows.Next() {
+		rec, err := scanRecord(rows)
+		if err != nil {
+			log.Printf("orders: listing: %v", err)
+			continue
+		}
+		page = append(page, rec)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("orders: listing: %v", err)
+	}
+	return page, total
+}
+
+// Summary counts every record by state and summarizes the processing
+// times of finished orders.
+func (s *Orders) Summary(ctx context.Context) (orderstore.Summary, error) {
+	sum := orderstore.Summary{ByState: make(map[orderstore.State]int64), ComputedAt: time.Now()}
+	rows, err := s.pool.Query(ctx, `SELECT state, count(*) FROM orders GROUP BY state`)
+	if err != nil {
+		return sum, err
+	}
+	for rows.Next() {
+		var state string
+		var n int64
+		if err := rows.Scan(&state, &n); err != nil {
+			rows.Close()
+			return sum, err
+		}
+		sum.ByState[orderstore.State(state)] = n
+		sum.Total += n
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return sum, err
+	}
+
+	var avg, p95 *float64
+	err = s.pool.QueryRow(ctx, `
+		SELECT avg(ms), percentile_cont(0.95) WITHIN GROUP (ORDER BY ms), max(updated_at)
+		FROM (SELECT (result->>'processing_time_ms')::float8 AS ms, updated_at
+		      FROM orders WHERE state IN ('processed', 'failed')) finished`,
+	).Scan(&avg, &p95, &sum.LastFinished)
+	if err != nil {
+		return sum, err
+	}
+	if avg != nil {
+		sum.AvgProcessingMs, sum.P95ProcessingMs = *avg, *p95
+	}
+	err = s.pool.QueryRow(ctx, `SELECT min(updated_at) FROM orders WHERE state = ANY($1)`,
+		[]string{string(orderstore.Queued), string(orderstore.Held), string(orderstore.Processing)},
+	).Scan(&sum.OldestUnfinished)
+	return sum, err
+}
+
+// columns are read by scanRecord.
+const columns = `state, ord, result, updated_at`
+
+func scanRecord(row pgx.Row) (orderstore.Record, error) {
+	var rec orderstore.Record
+	var state string
+	var ord, result []byte
+	if err := row.Scan(&state, &ord, &result, &rec.UpdatedAt); err != nil {
+		return rec, err
+	}
+	rec.State = orderstore.State(state)
+	return rec, decode(&rec, ord, result)
+}
+
+func decode(rec *orderstore.Record, ord, result []byte) error {
+	if err := json.Unmarshal(ord, &rec.Order); err != nil {
+		return err
+	}
+	if result == nil {
+		return nil
+	}
+	rec.Result = new(models.ProcessedOrder)
+	return json.Unmarshal(result, rec.Result)
+}
+
+// execer is a pool or a transaction.
+type execer interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
+// write inserts or replaces rec, result included.
+func write(ctx context.Context, db execer, rec orderstore.Record) error {
+	ord, err := json.Marshal(rec.Order)
+	if err != nil {
+		return err
+	}
+	var result []byte
+	if rec.Result != nil {
+		if result, err = json.Marshal(rec.Result); err != nil {
+			return err
+		}
+	}
+	o := rec.Order
+	_, err = db.Exec(ctx, `
+		INSERT INTO orders (id, state, status, customer, tenant, submitted_by, ord, result, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, now())
+		ON CONFLICT (id) DO UPDATE SET
+			state = EXCLUDED.state, status = EXCLUDED.status, customer = EXCLUDED.customer,
+			tenant = EXCLUDED.tenant, submitted_by = EXCLUDED.submitted_by,
+			ord = EXCLUDED.ord, result = EXCLUDED.result, updated_at = EXCLUDED.updated_at`,
+		o.ID, string(rec.State), string(o.Status), o.Customer, o.Tenant, o.SubmittedBy, ord, result)
+	return err
+}
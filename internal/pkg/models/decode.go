@@ -0,0 +1,69 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+// DecodeOrder strictly decodes a single JSON order: unknown fields,
+// trailing data, non-finite or over-precise amounts and non-RFC3339
+// timestamps are rejected with a coded ValidationError.
+func DecodeOrder(r io.Reader) (Order, error) {
+	var o Order
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&o); err != nil {
+		return Order{}, decodeError(err)
+	}
+	if dec.More() {
+		return Order{}, NewValidationError(CodeInvalidJSON)
+	}
+	return o, nil
+}
+
+func decodeError(err error) error {
+	var typeErr *json.UnmarshalTypeError
+	var timeErr *time.ParseError
+	switch {
+	case errors.Is(err, ErrInvalidMoney):
+		return NewValidationError(CodeInvalidAmount)
+	case errors.Is(err, ErrInvalidPriority):
+		return NewFieldError("priority", CodeInvalidPriority)
+	case errors.As(err, &timeErr):
+		return NewValidationError(CodeInvalidTimestamp)
+	case errors.As(err, &typeErr):
+		return NewValidationError(CodeInvalidField, typeErr.Field)
+	}
+	// encoding/json has no typed error for unknown fields
+	if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		return NewValidationError(CodeUnknownField, strings.Trim(field, `"`))
+	}
+	return NewValidationError(CodeInvalidJSON)
+}
+
+// Canonicalize normalizes free-form fields so downstream steps and
+// duplicate detection see consistent values: surrounding and repeated
+// whitespace is collapsed, email-like customers are lower cased and item
+// names are lower cased.
+func (o *Order) Canonicalize() {
+	o.ID = strings.TrimSpace(o.ID)
+	o.Customer = collapseSpace(o.Customer)
+	if strings.Contains(o.Customer, "@") {
+		o.Customer = strings.ToLower(o.Customer)
+	}
+	o.Address = collapseSpace(o.Address)
+	o.Notes = strings.TrimSpace(o.Notes)
+	o.Status = Status(strings.ToLower(strings.TrimSpace(string(o.Status))))
+	o.ParentID = strings.TrimSpace(o.ParentID)
+	o.Derivation = strings.ToLower(strings.TrimSpace(o.Derivation))
+	for i, item := range o.Items {
+		o.Items[i] = strings.ToLower(collapseSpace(item))
+	}
+}
+
+func collapseSpace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
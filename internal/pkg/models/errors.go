@@ -0,0 +1,191 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Message codes identify client-facing validation errors and processing
+// results independently of their wording, so they can be localized.
+const (
+	CodeIDRequired        = "id_required"
+	CodeCustomerRequired  = "customer_required"
+	CodeStatusRequired    = "status_required"
+	CodeInvalidStatus     = "invalid_status"
+	CodeAddressRequired   = "address_required"
+	CodeAmountNotPositive = "amount_not_positive"
+	CodeItemsEmpty        = "items_empty"
+	CodeInvalidPriority   = "invalid_priority"
+	CodeTooManyTags       = "too_many_tags"
+	CodeInvalidTag        = "invalid_tag"
+	CodeTagNotAllowed     = "tag_not_allowed"
+	CodeInvalidTagValue   = "invalid_tag_value"
+	CodeAmountOverLimit   = "amount_over_limit"
+	CodeTooManyItems      = "too_many_items"
+
+	CodeCallbacksDisabled      = "callbacks_disabled"
+	CodeInvalidCallbackURL     = "invalid_callback_url"
+	CodeCallbackHostNotAllowed = "callback_host_not_allowed"
+
+	CodeInvalidDeliveryWindow     = "invalid_delivery_window"
+	CodeDeliveryWindowTooFar      = "delivery_window_too_far"
+	CodeDeliveryWindowBlackout    = "delivery_window_blackout"
+	CodeDeliveryWindowUnreachable = "delivery_window_unreachable"
+	CodeNoShippingService         = "no_shipping_service"
+
+	CodeUnknownCustomer        = "unknown_customer"
+	CodeUnknownAddress         = "unknown_address"
+	CodeAddressIDNeedsCustomer = "address_id_needs_customer"
+
+	CodeUnknownParent     = "unknown_parent"
+	CodeInvalidParent     = "invalid_parent"
+	CodeInvalidDerivation = "invalid_derivation"
+
+	CodeDeadlinePassed     = "deadline_passed"
+	CodeDeadlineExceeded   = "deadline_exceeded"
+	CodeStepBudgetExceeded = "step_budget_exceeded"
+	CodeTimeout            = "timeout"
+	CodePanic              = "panic"
+
+	CodeInvalidJSON        = "invalid_json"
+	CodeUnknownField       = "unknown_field"
+	CodeInvalidField       = "invalid_field"
+	CodeInvalidAmount      = "invalid_amount"
+	CodeInvalidTimestamp   = "invalid_timestamp"
+	CodeServiceUnavailable = "service_unavailable"
+	CodeMemoryPressure     = "memory_pressure"
+	CodeShuttingDown       = "shutting_down"
+	CodeWouldMissDeadline  = "would_miss_deadline"
+
+	CodeResultPriority  = "result_priority_processing"
+	CodeResultExpedited = "result_expedited"
+	CodeResultCompleted = "result_completed"
+	CodeResultFailed    = "result_failed"
+)
+
+// Messages holds the English text for every code. Args are applied with
+// fmt verbs in the order the code's callers pass them.
+var Messages = map[string]string{
+	CodeIDRequired:        "id is required",
+	CodeCustomerRequired:  "customer is required",
+	CodeStatusRequired:    "status is required",
+	CodeInvalidStatus:     "invalid status",
+	CodeAddressRequired:   "address is required",
+	CodeAmountNotPositive: "amount must be > 0",
+	CodeItemsEmpty:        "items must not be empty",
+	CodeInvalidPriority:   "invalid priority (must be 1, 2, or 3)",
+	CodeTooManyTags:       "too many tags (max %d)",
+	CodeInvalidTag:        "tag keys must be 1-%d characters and values at most %d",
+	CodeTagNotAllowed:     "tag %q is not allowed",
+	CodeInvalidTagValue:   "invalid value %q for tag %q",
+	CodeAmountOverLimit:   "order amount exceeds limit",
+	CodeTooManyItems:      "too many items in order",
+
+	CodeCallbacksDisabled:      "callback_url is not supported by this server",
+	CodeInvalidCallbackURL:     "callback_url must be an absolute http or https URL",
+	CodeCallbackHostNotAllowed: "callback host %q is not allowed",
+
+	CodeInvalidDeliveryWindow:     "requested_delivery_window needs a start before its end",
+	CodeDeliveryWindowTooFar:      "requested_delivery_window may start at most %d days ahead",
+	CodeDeliveryWindowBlackout:    "requested_delivery_window only covers blackout dates",
+	CodeDeliveryWindowUnreachable: "requested_delivery_window ends before the earliest possible delivery on %s",
+	CodeNoShippingService:         "no shipping service can deliver within the requested window",
+
+	CodeUnknownCustomer:        "customer_id %q does not exist",
+	CodeUnknownAddress:         "address_id %q is not in the customer's address book",
+	CodeAddressIDNeedsCustomer: "address_id requires customer_id",
+
+	CodeUnknownParent:     "parent_id %q does not exist",
+	CodeInvalidParent:     "parent_id must name another order",
+	CodeInvalidDerivation: "derivation must be amendment, split or replay, with a parent_id",
+
+	CodeDeadlinePassed:     "deadline has already passed",
+	CodeDeadlineExceeded:   "deadline passed before step %s",
+	CodeStepBudgetExceeded: "step %s exceeded its %s budget",
+	CodeTimeout:            "processing exceeded its %s timeout in step %s",
+	CodePanic:              "processing failed unexpectedly",
+
+	CodeInvalidJSON:        "invalid JSON",
+	CodeUnknownField:       "unknown field %q",
+	CodeInvalidField:       "field %q has the wrong type",
+	CodeInvalidAmount:      "amount must be a finite number with at most 2 decimal places",
+	CodeInvalidTimestamp:   "timestamps must be RFC3339, e.g. 2024-01-15T10:30:00Z",
+	CodeServiceUnavailable: "service temporarily unavailable",
+	CodeMemoryPressure:     "server is under memory pressure, retry later",
+	CodeShuttingDown:       "server is shutting down, retry later",
+	CodeWouldMissDeadline:  "the order can't be processed before its deadline at the current load",
+
+	CodeResultPriority:  "Order marked for priority processing",
+	CodeResultExpedited: "Order expedited due to high priority",
+	CodeResultCompleted: "Order processing completed",
+	CodeResultFailed:    "Order processing failed",
+}
+
+type ValidationError struct {
+	Code    string `json:"code"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+	Args    []any  `json:"-"`
+}
+
+// NewValidationError builds a coded error with its English message.
+func NewValidationError(code string, args ...any) *ValidationError {
+	return &ValidationError{Code: code, Message: Message(code, args...), Args: args}
+}
+
+// NewFieldError is NewValidationError for a specific order field.
+func NewFieldError(field, code string, args ...any) *ValidationError {
+	e := NewValidationError(code, args...)
+	e.Field = field
+	return e
+}
+
+func (e *ValidationError) Error() string {
+	return e.Message
+}
+
+// ValidationErrors collects every problem found with an order.
+type ValidationErrors []*ValidationError
+
+func (errs ValidationErrors) Error() string {
+	msgs := make([]string, len(errs))
+	for i, e := range errs {
+		msgs[i] = e.Message
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Err returns nil for an empty list so callers can compare with nil.
+func (errs ValidationErrors) Err() error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// AsValidationErrors flattens err into a list. Errors that aren't
+// validation errors become a single entry with code.
+func AsValidationErrors(err error, code string) ValidationErrors {
+	var list ValidationErrors
+	if errors.As(err, &list) {
+		return list
+	}
+	var single *ValidationError
+	if errors.As(err, &single) {
+		return ValidationErrors{single}
+	}
+	return ValidationErrors{{Code: code, Message: err.Error()}}
+}
+
+// Message returns the English text for code.
+func Message(code string, args ...any) string {
+	format, ok := Messages[code]
+	if !ok {
+		return code
+	}
+	if len(args) == 0 {
+		return format
+	}
+	return fmt.Sprintf(format, args...)
+}
@@ -1,30 +1,142 @@
 package models
 
 import (
-	"errors"
+	"cmp"
+	"maps"
+	"slices"
 	"time"
 )
 
 type Order struct {
-	ID        string    `json:"id"`
-	Amount    float64   `json:"amount"`
-	Items     []string  `json:"items"`
-	Customer  string    `json:"customer"`
-	Status    string    `json:"status"`
-	CreatedAt time.Time `json:"created_at"`
-	Address   string    `json:"address"`
-	Notes     string    `json:"notes,omitempty"`
-	Priority  int       `json:"priority,omitempty"` // 1=high, 2=medium, 3=low
+	ID        string            `json:"id"`
+	Amount    Money             `json:"amount"`
+	Items     []string          `json:"items"`
+	Customer  string            `json:"customer"`
+	Status    Status            `json:"status"`
+	CreatedAt time.Time         `json:"created_at"`
+	Address   string            `json:"address"`
+	Notes     string            `json:"notes,omitempty"`
+	Priority  Priority          `json:"priority,omitempty"`
+	Tags      map[string]string `json:"tags,omitempty"`
+
+	// CreditAccount is a store credit or gift card account applied before
+	// charging the payment gateway.
+	CreditAccount string `json:"credit_account,omitempty"`
+
+	// SubscriptionID links orders generated from a recurring subscription.
+	SubscriptionID string `json:"subscription_id,omitempty"`
+
+	// ParentID links an order derived from another one, by Derivation:
+	// an amendment, a part of a split or a replay. Retries and requeues
+	// keep the order's own ID.
+	ParentID   string `json:"parent_id,omitempty"`
+	Derivation string `json:"derivation,omitempty"`
+
+	// CustomerID and AddressID reference a saved customer profile and one
+	// of its addresses. They fill Customer, Address and the profile's
+	// defaults at submission.
+	CustomerID string `json:"customer_id,omitempty"`
+	AddressID  string `json:"address_id,omitempty"`
+
+	// Tenant and SubmittedBy, the ID of the submitting API key, are set
+	// from the key, never by the client.
+	Tenant      string `json:"tenant,omitempty"`
+	SubmittedBy string `json:"submitted_by,omitempty"`
+
+	// RequestedDeliveryWindow is when the customer wants the order
+	// delivered; the shipping step picks a service that arrives within it.
+	RequestedDeliveryWindow *DeliveryWindow `json:"requested_delivery_window,omitempty"`
+
+	// Deadline is when the order must be processed by. Pipeline steps
+	// share the time left; zero uses the pipeline's deadline, if any.
+	Deadline time.Time `json:"deadline,omitzero"`
+
+	// CallbackURL receives the order's result as a signed POST once it is
+	// processed.
+	CallbackURL string `json:"callback_url,omitempty"`
+
+	// HeldMs is how long operators held the order back from processing.
+	// Held orders don't count towards the latency SLO.
+	HeldMs int64 `json:"held_ms,omitempty"`
+}
+
+// DeliveryWindow is a requested delivery period. Delivery is planned in
+// whole days, so any day the window touches counts.
+type DeliveryWindow struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
 }
 
 type ProcessedOrder struct {
 	Order          Order     `json:"order"`
 	ProcessedAt    time.Time `json:"processed_at"`
 	ProcessingTime int64     `json:"processing_time_ms"`
+	QueueWaitTime  int64     `json:"queue_wait_ms"`
+	EndToEndTime   int64     `json:"end_to_end_time_ms"` // CreatedAt to terminal state
 	WorkerID       int       `json:"worker_id"`
+	Pipeline       string    `json:"pipeline,omitempty"`
 	Success        bool      `json:"success"`
+	FailedStep     string    `json:"failed_step,omitempty"`
 	Error          string    `json:"error,omitempty"`
+	ErrorCode      string    `json:"error_code,omitempty"`
 	Result         string    `json:"result,omitempty"`
+	ResultCode     string    `json:"result_code,omitempty"`
+	Payment        *Payment  `json:"payment,omitempty"`
+	Shipment       *Shipment `json:"shipment,omitempty"`
+	Cost           *Cost     `json:"cost,omitempty"`
+
+	// PreviousStatus is the order's status when it was picked up, if
+	// processing changed it.
+	PreviousStatus Status `json:"previous_status,omitempty"`
+
+	// Attempts is how many times the order was processed, set by
+	// pipelines that retry failed orders.
+	Attempts int `json:"attempts,omitempty"`
+}
+
+// Cost is the resources spent processing one order.
+type Cost struct {
+	CPUMicros     int64 `json:"cpu_us"` // worker thread CPU time; 0 where unsupported
+	ExternalCalls int64 `json:"external_calls"`
+	Retries       int64 `json:"retries"`
+}
+
+// CostStats sums the cost of a group of orders.
+type CostStats struct {
+	Orders        int64 `json:"orders"`
+	CPUMicros     int64 `json:"cpu_us"`
+	ExternalCalls int64 `json:"external_calls"`
+	Retries       int64 `json:"retries"`
+}
+
+func (s *CostStats) Add(c Cost) {
+	s.Orders++
+	s.CPUMicros += c.CPUMicros
+	s.ExternalCalls += c.ExternalCalls
+	s.Retries += c.Retries
+}
+
+// CostReport is the processing cost per tenant and per customer. Orders
+// submitted without an API key are grouped under the empty tenant.
+type CostReport struct {
+	Total      CostStats            `json:"total"`
+	ByTenant   map[string]CostStats `json:"by_tenant"`
+	ByCustomer map[string]CostStats `json:"by_customer"`
+}
+
+// Shipment records the service the shipping step selected.
+type Shipment struct {
+	Service           string    `json:"service"`
+	ShipDate          time.Time `json:"ship_date"`
+	EstimatedDelivery time.Time `json:"estimated_delivery"`
+}
+
+// Payment records how an order was paid when the pipeline has a payment step.
+type Payment struct {
+	CreditAccount    string `json:"credit_account,omitempty"`
+	CreditApplied    Money  `json:"credit_applied"`
+	Charged          Money  `json:"charged"`
+	GatewayReference string `json:"gateway_reference,omitempty"`
 }
 
 type ProcessingStats struct {
@@ -32,50 +144,422 @@ type ProcessingStats struct {
 	SuccessCount       int     `json:"success_count"`
 	ErrorCount         int     `json:"error_count"`
 	AverageProcessTime float64 `json:"average_process_time_ms"`
+	AverageEndToEnd    float64 `json:"average_end_to_end_ms"`
+	AverageQueueWait   float64 `json:"average_queue_wait_ms"`
 	ActiveWorkers      int     `json:"active_workers"`
 	QueueLength        int     `json:"queue_length"`
+	Held               int     `json:"held"`
+	Retries            int     `json:"retries"`  // failed attempts that were retried
+	Retrying           int     `json:"retrying"` // orders waiting out their retry backoff
+	Timeouts           int     `json:"timeouts"` // failed orders that hit their processing timeout
+	Panics             int     `json:"panics"`   // panics recovered in steps and workers
 	Uptime             int64   `json:"uptime_seconds"`
+
+	// ByTag counts processed orders per "key=value" tag.
+	ByTag map[string]int `json:"by_tag,omitempty"`
+
+	ByPipeline map[string]PipelineStats `json:"by_pipeline,omitempty"`
+
+	// ByPriority and ByOutcome break processed orders down by their
+	// priority and by how they ended, one of the Outcome constants.
+	ByPriority map[Priority]ClassStats `json:"by_priority,omitempty"`
+	ByOutcome  map[string]ClassStats   `json:"by_outcome,omitempty"`
+
+	Results ResultStats `json:"results"`
+
+	// UniqueCustomers and UniqueItems are approximate distinct counts per
+	// trailing window ("5m", "1h", "24h"). They can't be added up across
+	// nodes, so Merge leaves them out of cluster totals.
+	UniqueCustomers map[string]uint64 `json:"unique_customers,omitempty"`
+	UniqueItems     map[string]uint64 `json:"unique_items,omitempty"`
+}
+
+// Outcomes are how processed orders ended.
+const (
+	OutcomeSuccess          = "success"
+	OutcomeValidationFailed = "validation_failed" // failed with a coded error, which isn't retried
+	OutcomeTimeout          = "timeout"           // failed by the processing timeout
+	OutcomeDeadLettered     = "dead_lettered"     // failed otherwise, once any retries ran out
+)
+
+// ClassStats are the processed orders of one priority or outcome.
+type ClassStats struct {
+	Processed       int     `json:"processed"`
+	AverageEndToEnd float64 `json:"average_end_to_end_ms"`
+
+	// EndToEnd holds percentiles of the end-to-end latency of the class's
+	// latest orders. They can't be added up across nodes, so Merge leaves
+	// them out of cluster totals.
+	EndToEnd *Percentiles `json:"end_to_end,omitempty"`
+}
+
+// Percentiles of a latency, in milliseconds.
+type Percentiles struct {
+	P50 int64 `json:"p50_ms"`
+	P95 int64 `json:"p95_ms"`
+	P99 int64 `json:"p99_ms"`
+}
+
+// merge adds other into s.
+func (s ClassStats) merge(other ClassStats) ClassStats {
+	processed := s.Processed + other.Processed
+	if processed > 0 {
+		s.AverageEndToEnd = (s.AverageEndToEnd*float64(s.Processed) + other.AverageEndToEnd*float64(other.Processed)) / float64(processed)
+	}
+	s.Processed = processed
+	s.EndToEnd = nil
+	return s
 }
 
-var validStatuses = map[string]bool{
-	"pending":   true,
-	"paid":      true,
-	"shipped":   true,
-	"delivered": true,
-	"cancelled": true,
+// mergeClasses adds the classes of other into those of s.
+func mergeClasses[K comparable](s, other map[K]ClassStats) map[K]ClassStats {
+	if len(other) == 0 {
+		return s
+	}
+	sum := make(map[K]ClassStats, len(s)+len(other))
+	for k, v := range s {
+		v.EndToEnd = nil
+		sum[k] = v
+	}
+	for k, v := range other {
+		sum[k] = sum[k].merge(v)
+	}
+	return sum
 }
 
-var validPriorities = map[int]bool{
-	1: true, // high
-	2: true, // medium
-	3: true, // low
+// ResultStats counts what happened to results by the overflow policy
+// when the results consumer fell behind. Delivered results were put on
+// the results channel, where Waiting are still unread; Dropped of them
+// were discarded unread to make room. Blocked results stalled their
+// worker for BlockedMs in total. Spilled results were written to disk,
+// where OnDisk still wait.
+type ResultStats struct {
+	Overflow  string `json:"overflow"`
+	Waiting   int    `json:"waiting"`
+	Delivered int64  `json:"delivered"`
+	Blocked   int64  `json:"blocked"`
+	BlockedMs int64  `json:"blocked_ms"`
+	Dropped   int64  `json:"dropped"`
+	Spilled   int64  `json:"spilled"`
+	OnDisk    int    `json:"on_disk"`
 }
 
-// Validate checks whether the order has all required fields with acceptable values.
+// TopStats lists the most frequent customers, items and failure reasons
+// of one window, with approximate counts.
+type TopStats struct {
+	Customers []TopEntry `json:"customers"`
+	Items     []TopEntry `json:"items"`
+	Errors    []TopEntry `json:"errors"`
+}
+
+type TopEntry struct {
+	Key   string `json:"key"`
+	Count uint64 `json:"count"`
+}
+
+// ResultSummary aggregates the results of one time interval, for
+// consumers that don't need every order.
+type ResultSummary struct {
+	Start           time.Time      `json:"start"`
+	End             time.Time      `json:"end"`
+	Count           int            `json:"count"`
+	Succeeded       int            `json:"succeeded"`
+	Failed          int            `json:"failed"`
+	Amount          Money          `json:"amount"` // of succeeded orders
+	AvgProcessingMs float64        `json:"avg_processing_ms"`
+	MaxProcessingMs int64          `json:"max_processing_ms"`
+	AvgEndToEndMs   float64        `json:"avg_end_to_end_ms"`
+	ByPipeline      map[string]int `json:"by_pipeline,omitempty"`
+	ByErrorCode     map[string]int `json:"by_error_code,omitempty"`
+}
+
+// Add counts one result into the summary.
+func (s *ResultSummary) Add(r ProcessedOrder) {
+	s.Count++
+	n := float64(s.Count)
+	s.AvgProcessingMs += (float64(r.ProcessingTime) - s.AvgProcessingMs) / n
+	s.AvgEndToEndMs += (float64(r.EndToEndTime) - s.AvgEndToEndMs) / n
+	s.MaxProcessingMs = max(s.MaxProcessingMs, r.ProcessingTime)
+	if r.Success {
+		s.Succeeded++
+		s.Amount += r.Order.Amount
+	} else {
+		s.Failed++
+		if s.ByErrorCode == nil {
+			s.ByErrorCode = make(map[string]int)
+		}
+		code := r.ErrorCode
+		if code == "" {
+			code = "unknown"
+		}
+		s.ByErrorCode[code]++
+	}
+	if r.Pipeline != "" {
+		if s.ByPipeline == nil {
+			s.ByPipeline = make(map[string]int)
+		}
+		s.ByPipeline[r.Pipeline]++
+	}
+}
+
+// PipelineStats describes one named pipeline of the pool.
+type PipelineStats struct {
+	Workers     int `json:"workers"`
+	QueueLength int `json:"queue_length"`
+	Processed   int `json:"processed"`
+	Errors      int `json:"errors"`
+	Retries     int `json:"retries,omitempty"`
+	Timeouts    int `json:"timeouts,omitempty"`
+	Panics      int `json:"panics,omitempty"`
+	Evicted     int `json:"evicted,omitempty"` // refused or evicted as they would miss their deadline
+	Spilled     int `json:"spilled,omitempty"` // queued on disk, included in QueueLength
+
+	// Admission counts the decisions of the pipeline's admission
+	// strategy, if it has one.
+	Admission *AdmissionStats `json:"admission,omitempty"`
+
+	// Autoscale is set for pipelines that autoscale; Workers is then the
+	// number running now.
+	Autoscale *AutoscaleStats `json:"autoscale,omitempty"`
+
+	// Work stealing counters, set for sharded pipelines only.
+	Steals            int   `json:"steals,omitempty"`
+	StolenOrders      int   `json:"stolen_orders,omitempty"`
+	ShardQueueLengths []int `json:"shard_queue_lengths,omitempty"`
+}
+
+// AutoscaleStats are a pipeline's worker bounds and its latest scaling
+// events, oldest first.
+type AutoscaleStats struct {
+	MinWorkers int          `json:"min_workers"`
+	MaxWorkers int          `json:"max_workers"`
+	HighWater  int          `json:"high_water"`
+	Events     []ScaleEvent `json:"events"`
+}
+
+// ScaleEvent is one worker added or stopped.
+type ScaleEvent struct {
+	At          time.Time `json:"at"`
+	From        int       `json:"from"`
+	To          int       `json:"to"`
+	QueueLength int       `json:"queue_length"`
+}
+
+// AdmissionStats are a pipeline's admission decisions. Gauges hold the
+// strategy's state, such as token_bucket's "tokens" or codel's
+// "dropping" and "min_wait_ms".
+type AdmissionStats struct {
+	Strategy          string             `json:"strategy"`
+	Admitted          int                `json:"admitted"`
+	Refused           int                `json:"refused"`
+	RefusedByPriority map[Priority]int   `json:"refused_by_priority"`
+	Gauges            map[string]float64 `json:"gauges,omitempty"`
+}
+
+// NodeStats is one instance's contribution to a cluster-wide stats view.
+type NodeStats struct {
+	Node  string           `json:"node"`
+	Stats *ProcessingStats `json:"stats,omitempty"`
+	Error string           `json:"error,omitempty"`
+}
+
+// ClusterStats combines the stats of every reachable instance.
+type ClusterStats struct {
+	Total     ProcessingStats `json:"total"`
+	Reachable int             `json:"reachable_nodes"`
+	Nodes     []NodeStats     `json:"nodes"`
+}
+
+// Merge adds other into s. Averages are weighted by processed count and
+// uptime is the longest of the two.
+func (s ProcessingStats) Merge(other ProcessingStats) ProcessingStats {
+	processed := s.TotalProcessed + other.TotalProcessed
+	if processed > 0 {
+		weighted := func(a, b float64) float64 {
+			return (a*float64(s.TotalProcessed) + b*float64(other.TotalProcessed)) / float64(processed)
+		}
+		s.AverageProcessTime = weighted(s.AverageProcessTime, other.AverageProcessTime)
+		s.AverageEndToEnd = weighted(s.AverageEndToEnd, other.AverageEndToEnd)
+		s.AverageQueueWait = weighted(s.AverageQueueWait, other.AverageQueueWait)
+	}
+	s.TotalProcessed = processed
+	s.SuccessCount += other.SuccessCount
+	s.ErrorCount += other.ErrorCount
+	s.ActiveWorkers += other.ActiveWorkers
+	s.QueueLength += other.QueueLength
+	s.Held += other.Held
+	s.Retries += other.Retries
+	s.Retrying += other.Retrying
+	s.Timeouts += other.Timeouts
+	s.Panics += other.Panics
+	s.Results.Waiting += other.Results.Waiting
+	s.Results.Delivered += other.Results.Delivered
+	s.Results.Blocked += other.Results.Blocked
+	s.Results.BlockedMs += other.Results.BlockedMs
+	s.Results.Dropped += other.Results.Dropped
+	s.Results.Spilled += other.Results.Spilled
+	s.Results.OnDisk += other.Results.OnDisk
+	switch {
+	case s.Results.Overflow == "":
+		s.Results.Overflow = other.Results.Overflow
+	case other.Results.Overflow != "" && other.Results.Overflow != s.Results.Overflow:
+		s.Results.Overflow = "mixed"
+	}
+	if other.Uptime > s.Uptime {
+		s.Uptime = other.Uptime
+	}
+	if len(other.ByTag) > 0 {
+		byTag := make(map[string]int, len(s.ByTag)+len(other.ByTag))
+		for k, v := range s.ByTag {
+			byTag[k] = v
+		}
+		for k, v := range other.ByTag {
+			byTag[k] += v
+		}
+		s.ByTag = byTag
+	}
+	s.ByPriority = mergeClasses(s.ByPriority, other.ByPriority)
+	s.ByOutcome = mergeClasses(s.ByOutcome, other.ByOutcome)
+	if len(other.ByPipeline) > 0 {
+		byPipeline := make(map[string]PipelineStats, len(s.ByPipeline)+len(other.ByPipeline))
+		for k, v := range s.ByPipeline {
+			byPipeline[k] = v
+		}
+		for k, v := range other.ByPipeline {
+			sum := byPipeline[k]
+			sum.Workers += v.Workers
+			sum.QueueLength += v.QueueLength
+			sum.Processed += v.Processed
+			sum.Errors += v.Errors
+			sum.Retries += v.Retries
+			sum.Timeouts += v.Timeouts
+			sum.Panics += v.Panics
+			sum.Evicted += v.Evicted
+			sum.Admission = sum.Admission.merge(v.Admission)
+			sum.Spilled += v.Spilled
+			sum.Steals += v.Steals
+			sum.StolenOrders += v.StolenOrders
+			sum.ShardQueueLengths = slices.Concat(sum.ShardQueueLengths, v.ShardQueueLengths)
+			byPipeline[k] = sum
+		}
+		s.ByPipeline = byPipeline
+	}
+	return s
+}
+
+// merge adds other into s. The gauges of a strategy's state don't add
+// up, so they are dropped.
+func (s *AdmissionStats) merge(other *AdmissionStats) *AdmissionStats {
+	if s == nil || other == nil {
+		return cmp.Or(s, other)
+	}
+	sum := &AdmissionStats{
+		Strategy:          s.Strategy,
+		Admitted:          s.Admitted + other.Admitted,
+		Refused:           s.Refused + other.Refused,
+		RefusedByPriority: maps.Clone(s.RefusedByPriority),
+	}
+	if other.Strategy != s.Strategy {
+		sum.Strategy = "mixed"
+	}
+	for prio, n := range other.RefusedByPriority {
+		sum.RefusedByPriority[prio] += n
+	}
+	return sum
+}
+
+// Derivations are how an order with a ParentID came from its parent.
+const (
+	DerivationAmendment = "amendment"
+	DerivationSplit     = "split"
+	DerivationReplay    = "replay"
+)
+
+var validDerivations = map[string]bool{
+	DerivationAmendment: true,
+	DerivationSplit:     true,
+	DerivationReplay:    true,
+}
+
+// Validate checks whether the order has all required fields with acceptable
+// values. Every failing field is reported, not just the first.
 func (o *Order) Validate() error {
+	var errs ValidationErrors
 	if o.ID == "" {
-		return errors.New("id is required")
+		errs = append(errs, NewFieldError("id", CodeIDRequired))
 	}
 	if o.Customer == "" {
-		return errors.New("customer is required")
+		errs = append(errs, NewFieldError("customer", CodeCustomerRequired))
 	}
 	if o.Status == "" {
-		return errors.New("status is required")
-	}
-	if !validStatuses[o.Status] {
-		return errors.New("invalid status")
+		errs = append(errs, NewFieldError("status", CodeStatusRequired))
+	} else if !o.Status.Valid() {
+		errs = append(errs, NewFieldError("status", CodeInvalidStatus))
 	}
 	if o.Address == "" {
-		return errors.New("address is required")
+		errs = append(errs, NewFieldError("address", CodeAddressRequired))
 	}
 	if o.Amount <= 0 {
-		return errors.New("amount must be > 0")
+		errs = append(errs, NewFieldError("amount", CodeAmountNotPositive))
 	}
 	if len(o.Items) == 0 {
-		return errors.New("items must not be empty")
+		errs = append(errs, NewFieldError("items", CodeItemsEmpty))
+	}
+	if o.Priority != 0 && !o.Priority.Valid() {
+		errs = append(errs, NewFieldError("priority", CodeInvalidPriority))
+	}
+	if w := o.RequestedDeliveryWindow; w != nil && (w.Start.IsZero() || !w.End.After(w.Start)) {
+		errs = append(errs, NewFieldError("requested_delivery_window", CodeInvalidDeliveryWindow))
 	}
-	if o.Priority != 0 && !validPriorities[o.Priority] {
-		return errors.New("invalid priority (must be 1, 2, or 3)")
+	if o.ParentID != "" {
+		if o.ParentID == o.ID {
+			errs = append(errs, NewFieldError("parent_id", CodeInvalidParent))
+		}
+		if !validDerivations[o.Derivation] {
+			errs = append(errs, NewFieldError("derivation", CodeInvalidDerivation))
+		}
+	} else if o.Derivation != "" {
+		errs = append(errs, NewFieldError("derivation", CodeInvalidDerivation))
+	}
+	return errs.Err()
+}
+
+// ValidateDeadline rejects deadlines that have passed by now.
+func (o *Order) ValidateDeadline(now time.Time) error {
+	if !o.Deadline.IsZero() && !o.Deadline.After(now) {
+		return NewFieldError("deadline", CodeDeadlinePassed)
+	}
+	return nil
+}
+
+// TagPolicy restricts which tags an order may carry. A nil Allowed map
+// accepts any key; a key mapped to an empty list accepts any value.
+type TagPolicy struct {
+	MaxTags int
+	Allowed map[string][]string
+}
+
+const maxTagLength = 64
+
+// ValidateTags checks the order's tags against policy.
+func (o *Order) ValidateTags(policy TagPolicy) error {
+	if policy.MaxTags > 0 && len(o.Tags) > policy.MaxTags {
+		return NewFieldError("tags", CodeTooManyTags, policy.MaxTags)
+	}
+	for k, v := range o.Tags {
+		if k == "" || len(k) > maxTagLength || len(v) > maxTagLength {
+			return NewFieldError("tags", CodeInvalidTag, maxTagLength, maxTagLength)
+		}
+		if policy.Allowed == nil {
+			continue
+		}
+		values, ok := policy.Allowed[k]
+		if !ok {
+			return NewFieldError("tags", CodeTagNotAllowed, k)
+		}
+		if len(values) > 0 && !slices.Contains(values, v) {
+			return NewFieldError("tags", CodeInvalidTagValue, v, k)
+		}
 	}
 	return nil
 }
@@ -83,17 +567,9 @@ func (o *Order) Validate() error {
 // SetDefaultValues sets default values for optional fields
 func (o *Order) SetDefaultValues() {
 	if o.Priority == 0 {
-		o.Priority = 2 // default to medium priority
+		o.Priority = PriorityMedium
 	}
 	if o.Status == "" {
-		o.Status = "pending"
+		o.Status = StatusPending
 	}
 }
-
-type ValidationError struct {
-	Message string `json:"message"`
-}
-
-func (e *ValidationError) Error() string {
-	return e.Message
-}
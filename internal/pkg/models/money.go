@@ -0,0 +1,89 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+)
+
+// Money is an amount in minor units (cents). Arithmetic on it is exact,
+// unlike float64.
+//
+// In JSON it is written as a decimal number with two places (12.5 is
+// written 12.50) and read from a number or a string, so existing clients
+// sending "amount": 99.99 keep working.
+type Money int64
+
+var (
+	ErrInvalidMoney   = errors.New("invalid amount")
+	ErrMoneyPrecision = fmt.Errorf("%w: more than 2 decimal places", ErrInvalidMoney)
+)
+
+// Whole returns a Money of n major units.
+func Whole(n int64) Money {
+	return Money(n * 100)
+}
+
+// ParseMoney reads a decimal string such as "99.99" exactly.
+func ParseMoney(s string) (Money, error) {
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return 0, fmt.Errorf("%w %q", ErrInvalidMoney, s)
+	}
+	r.Mul(r, big.NewRat(100, 1))
+	if !r.IsInt() {
+		return 0, ErrMoneyPrecision
+	}
+	if !r.Num().IsInt64() {
+		return 0, fmt.Errorf("%w: %q out of range", ErrInvalidMoney, s)
+	}
+	return Money(r.Num().Int64()), nil
+}
+
+// Float64 returns the amount in major units, for display and metrics only.
+func (m Money) Float64() float64 {
+	return float64(m) / 100
+}
+
+func (m Money) String() string {
+	sign := ""
+	v := int64(m)
+	if v < 0 {
+		sign = "-"
+		if v == math.MinInt64 {
+			return "-92233720368547758.08"
+		}
+		v = -v
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, v/100, v%100)
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+func (m *Money) UnmarshalJSON(b []byte) error {
+	b = bytes.TrimSpace(b)
+	if bytes.Equal(b, []byte("null")) {
+		return nil
+	}
+	s := string(b)
+	if len(b) > 0 && b[0] == '"' {
+		if err := json.Unmarshal(b, &s); err != nil {
+			return err
+		}
+	} else if _, err := strconv.ParseFloat(s, 64); err != nil {
+		return fmt.Errorf("%w %s", ErrInvalidMoney, s)
+	}
+
+	v, err := ParseMoney(s)
+	if err != nil {
+		return err
+	}
+	*m = v
+	return nil
+}
@@ -0,0 +1,102 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Priority decides which queued orders are processed first. The zero
+// value means none was given; SetDefaultValues makes it PriorityMedium.
+//
+// In JSON it is written as its number and read from a number or a name
+// ("high", "medium" or "low"), so existing clients sending "priority": 1
+// keep working. As a map key it is written as its name.
+type Priority int
+
+const (
+	PriorityHigh   Priority = 1
+	PriorityMedium Priority = 2
+	PriorityLow    Priority = 3
+)
+
+var ErrInvalidPriority = errors.New("invalid priority")
+
+// Priorities lists the valid priorities, highest first.
+var Priorities = []Priority{PriorityHigh, PriorityMedium, PriorityLow}
+
+// ParsePriority reads a priority's name or number.
+func ParsePriority(s string) (Priority, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	for _, p := range Priorities {
+		if s == p.String() || s == strconv.Itoa(int(p)) {
+			return p, nil
+		}
+	}
+	return 0, fmt.Errorf("%w %q", ErrInvalidPriority, s)
+}
+
+// Valid reports whether p is high, medium or low.
+func (p Priority) Valid() bool {
+	return p >= PriorityHigh && p <= PriorityLow
+}
+
+// String names p; other values are written as their number.
+func (p Priority) String() string {
+	switch p {
+	case PriorityHigh:
+		return "high"
+	case PriorityMedium:
+		return "medium"
+	case PriorityLow:
+		return "low"
+	}
+	return strconv.Itoa(int(p))
+}
+
+func (p Priority) MarshalJSON() ([]byte, error) {
+	return strconv.AppendInt(nil, int64(p), 10), nil
+}
+
+// UnmarshalJSON reads any whole number, leaving the range to Validate, so
+// an out of range priority is reported with the order's other problems.
+func (p *Priority) UnmarshalJSON(b []byte) error {
+	b = bytes.TrimSpace(b)
+	if bytes.Equal(b, []byte("null")) {
+		return nil
+	}
+	if len(b) > 0 && b[0] == '"' {
+		var s string
+		if err := json.Unmarshal(b, &s); err != nil {
+			return err
+		}
+		v, err := ParsePriority(s)
+		if err != nil {
+			return err
+		}
+		*p = v
+		return nil
+	}
+	n, err := strconv.Atoi(string(b))
+	if err != nil {
+		return fmt.Errorf("%w %s", ErrInvalidPriority, b)
+	}
+	*p = Priority(n)
+	return nil
+}
+
+func (p Priority) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+func (p *Priority) UnmarshalText(b []byte) error {
+	v, err := ParsePriority(string(b))
+	if err != nil {
+		return err
+	}
+	*p = v
+	return nil
+}
@@ -0,0 +1,49 @@
+package models
+
+import "strings"
+
+// Status is where an order is in its business lifecycle. Clients submit
+// one of the submittable statuses; the processing statuses are set by the
+// pipeline's business rules and can't be submitted.
+//
+// In JSON it is a string, read case-insensitively and without
+// surrounding whitespace, so "Pending " is read as StatusPending.
+type Status string
+
+// Submittable statuses.
+const (
+	StatusPending   Status = "pending"
+	StatusPaid      Status = "paid"
+	StatusShipped   Status = "shipped"
+	StatusDelivered Status = "delivered"
+	StatusCancelled Status = "cancelled"
+)
+
+// Processing statuses, set by applyBusinessRules.
+const (
+	StatusProcessing         Status = "processing"
+	StatusPriorityProcessing Status = "priority_processing"
+	StatusExpedited          Status = "expedited"
+)
+
+// Valid reports whether s may be submitted.
+func (s Status) Valid() bool {
+	switch s {
+	case StatusPending, StatusPaid, StatusShipped, StatusDelivered, StatusCancelled:
+		return true
+	}
+	return false
+}
+
+func (s Status) String() string {
+	return string(s)
+}
+
+func (s Status) MarshalText() ([]byte, error) {
+	return []byte(s), nil
+}
+
+func (s *Status) UnmarshalText(b []byte) error {
+	*s = Status(strings.ToLower(strings.TrimSpace(string(b))))
+	return nil
+}
@@ -0,0 +1,131 @@
+// Package problem writes error responses as RFC 7807 problem details
+// (application/problem+json). Every problem carries a machine-readable
+// code, a type URI documenting that code, and the correlation ID of the
+// request, which is also logged for server errors so a client's report
+// can be matched to the server's logs.
+package problem
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// HeaderCorrelationID carries the correlation ID in both directions.
+const HeaderCorrelationID = "X-Request-ID"
+
+// DocsURL prefixes each code to form the problem's type URI. The default
+// is the server's own GET /errors/{code}; it is set once at startup.
+var DocsURL = "/errors/"
+
+// Details is a problem details object. Errors lists the individual
+// failures of a request that failed validation.
+type Details struct {
+	Type          string `json:"type"`
+	Title         string `json:"title"`
+	Status        int    `json:"status"`
+	Detail        string `json:"detail,omitempty"`
+	Instance      string `json:"instance,omitempty"`
+	Code          string `json:"code"`
+	CorrelationID string `json:"correlation_id,omitempty"`
+	Errors        any    `json:"errors,omitempty"`
+}
+
+// Code is the generic code of responses with status, such as "not_found".
+func Code(status int) string {
+	switch status {
+	case http.StatusInternalServerError:
+		return "internal_error"
+	case http.StatusRequestEntityTooLarge:
+		return "request_too_large"
+	}
+	text := http.StatusText(status)
+	if text == "" {
+		return "error"
+	}
+	return strings.ReplaceAll(strings.ToLower(strings.NewReplacer("-", "", "'", "").Replace(text)), " ", "_")
+}
+
+// Error answers with a problem of status's generic code, like http.Error
+// does with plain text.
+func Error(w http.ResponseWriter, r *http.Request, detail string, status int) {
+	Write(w, r, Details{Status: status, Detail: detail})
+}
+
+// Write answers with d, filling in the code from the status, the type,
+// title, instance and correlation ID where they're unset.
+func Write(w http.ResponseWriter, r *http.Request, d Details) {
+	if d.Code == "" {
+		d.Code = Code(d.Status)
+	}
+	if d.Type == "" {
+		d.Type = DocsURL + d.Code
+	}
+	if d.Title == "" {
+		d.Title = http.StatusText(d.Status)
+	}
+	if d.Instance == "" {
+		d.Instance = r.URL.Path
+	}
+	if d.CorrelationID == "" {
+		d.CorrelationID = CorrelationID(r.Context())
+	}
+	if d.Status >= 500 {
+		log.Printf("error %s: %s %s: %d %s", d.CorrelationID, r.Method, r.URL.Path, d.Status, d.Detail)
+	}
+
+	h := w.Header()
+	h.Del("Content-Length")
+	h.Set("Content-Type", "application/problem+json")
+	h.Set("X-Content-Type-Options", "nosniff")
+	h.Set("X-Error-Code", d.Code)
+	w.WriteHeader(d.Status)
+	_ = json.NewEncoder(w).Encode(d)
+}
+
+type correlationKey struct{}
+
+// CorrelationID returns the ID Middleware gave the request, if any.
+func CorrelationID(ctx context.Context) string {
+	id, _ := ctx.Value(correlationKey{}).(string)
+	return id
+}
+
+// Middleware gives every request a correlation ID: the caller's
+// X-Request-ID when it is a plausible ID, or else a new one. It is echoed
+// in the response header and in problems.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(HeaderCorrelationID)
+		if !valid(id) {
+			id = newID()
+		}
+		w.Header().Set(HeaderCorrelationID, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), correlationKey{}, id)))
+	})
+}
+
+// valid accepts 1-128 characters of letters, digits and "-_.:".
+func valid(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', strings.ContainsRune("-_.:", c):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,244 @@
+package processor
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/pkg/models"
+)
+
+// Admission strategies decide whether Submit queues an order before it
+// reaches the pipeline's queue, so a pipeline can shed load earlier or
+// more selectively than by filling up.
+const (
+	AdmitAlways       = "always"        // accept until the queue is full
+	AdmitTokenBucket  = "token_bucket"  // accept up to a rate, with bursts
+	AdmitCoDel        = "codel"         // refuse while queue waits stay above a target
+	AdmitPriorityShed = "priority_shed" // refuse lower priorities as the queue fills
+)
+
+// Defaults of the codel and priority_shed strategies.
+const (
+	DefaultCoDelTarget   = 100 * time.Millisecond
+	DefaultCoDelInterval = time.Second
+	DefaultShedLowAt     = 0.5
+	DefaultShedMediumAt  = 0.8
+)
+
+// ErrNotAdmitted is returned by Submit for an order the pipeline's
+// admission strategy refused.
+var ErrNotAdmitted = errors.New("order refused by admission control")
+
+// AdmissionConfig selects a pipeline's admission strategy; empty admits
+// every order that fits in the queue without counting. Rate and Burst
+// tune token_bucket, Target and Interval codel, ShedLowAt and
+// ShedMediumAt, fractions of the queue's buffer, priority_shed.
+type AdmissionConfig struct {
+	Strategy     string
+	Rate         float64 // orders per second
+	Burst        int
+	Target       time.Duration
+	Interval     time.Duration
+	ShedLowAt    float64
+	ShedMediumAt float64
+}
+
+// QueueState is what an Admission sees of a pipeline's queue.
+type QueueState struct {
+	Length   int
+	Capacity int
+}
+
+// Admission is an admission control strategy. Admit decides on an order
+// arriving at the queue, and Dequeued is told how long each order waited
+// in it. Gauges reports the strategy's state for stats. Implementations
+// are called concurrently.
+type Admission interface {
+	Admit(o models.Order, q QueueState, now time.Time) bool
+	Dequeued(wait time.Duration, now time.Time)
+	Gauges() map[string]float64
+}
+
+// NewAdmission builds the strategy cfg selects, or nil for none.
+func NewAdmission(cfg AdmissionConfig) (Admission, error) {
+	switch cfg.Strategy {
+	case "":
+		return nil, nil
+	case AdmitAlways:
+		return alwaysAdmit{}, nil
+	case AdmitTokenBucket:
+		if cfg.Rate <= 0 || cfg.Burst < 1 {
+			return nil, fmt.Errorf("admission: token_bucket needs a rate > 0 and a burst >= 1")
+		}
+		return &tokenBucket{rate: cfg.Rate, burst: float64(cfg.Burst), tokens: float64(cfg.Burst)}, nil
+	case AdmitCoDel:
+		c := &coDel{target: cfg.Target, interval: cfg.Interval, windowMin: -1}
+		if c.target <= 0 {
+			c.target = DefaultCoDelTarget
+		}
+		if c.interval <= 0 {
+			c.interval = DefaultCoDelInterval
+		}
+		return c, nil
+	case AdmitPriorityShed:
+		s := priorityShed{low: cfg.ShedLowAt, medium: cfg.ShedMediumAt}
+		if s.low <= 0 {
+			s.low = DefaultShedLowAt
+		}
+		if s.medium <= 0 {
+			s.medium = DefaultShedMediumAt
+		}
+		if s.low > s.medium || s.medium > 1 {
+			return nil, fmt.Errorf("admission: priority_shed needs shed_low_at <= shed_medium_at <= 1")
+		}
+		return s, nil
+	}
+	return nil, fmt.Errorf("admission: unknown strategy %q", cfg.Strategy)
+}
+
+type alwaysAdmit struct{}
+
+func (alwaysAdmit) Admit(models.Order, QueueState, time.Time) bool { return true }
+func (alwaysAdmit) Dequeued(time.Duration, time.Time)              {}
+func (alwaysAdmit) Gauges() map[string]float64                     { return nil }
+
+// tokenBucket admits an order per token; tokens accrue at rate per second
+// up to burst.
+type tokenBucket struct {
+	rate, burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func (b *tokenBucket) Admit(_ models.Order, _ QueueState, now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill(now)
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	if !b.last.IsZero() {
+		b.tokens = min(b.burst, b.tokens+b.rate*now.Sub(b.last).Seconds())
+	}
+	b.last = now
+}
+
+func (b *tokenBucket) Dequeued(time.Duration, time.Time) {}
+
+func (b *tokenBucket) Gauges() map[string]float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill(time.Now())
+	return map[string]float64{"tokens": b.tokens}
+}
+
+// coDel applies CoDel's idea to admission: a queue whose shortest wait
+// over an interval stayed above the target holds a standing backlog
+// rather than a burst, so new orders are refused until an interval's
+// shortest wait falls below the target again or the queue empties.
+type coDel struct {
+	target, interval time.Duration
+
+	mu          sync.Mutex
+	windowStart time.Time
+	windowMin   time.Duration // -1 before the window's first order
+	lastMin     time.Duration
+	dropping    bool
+}
+
+func (c *coDel) Admit(_ models.Order, q QueueState, _ time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if q.Length == 0 {
+		c.dropping = false
+	}
+	return !c.dropping
+}
+
+func (c *coDel) Dequeued(wait time.Duration, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.windowStart.IsZero() {
+		c.windowStart = now
+	}
+	if c.windowMin < 0 || wait < c.windowMin {
+		c.windowMin = wait
+	}
+	if now.Sub(c.windowStart) >= c.interval {
+		c.dropping = c.windowMin > c.target
+		c.lastMin, c.windowStart, c.windowMin = c.windowMin, now, -1
+	}
+}
+
+func (c *coDel) Gauges() map[string]float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	dropping := 0.0
+	if c.dropping {
+		dropping = 1
+	}
+	return map[string]float64{"dropping": dropping, "min_wait_ms": float64(c.lastMin.Milliseconds())}
+}
+
+// priorityShed refuses low priority orders once the queue is low full,
+// and medium ones once it is medium full.
+type priorityShed struct {
+	low, medium float64
+}
+
+func (s priorityShed) Admit(o models.Order, q QueueState, _ time.Time) bool {
+	fill := float64(q.Length) / float64(max(q.Capacity, 1))
+	switch lane(o.Priority) {
+	case models.PriorityLow:
+		return fill < s.low
+	case models.PriorityMedium:
+		return fill < s.medium
+	}
+	return true
+}
+
+func (priorityShed) Dequeued(time.Duration, time.Time) {}
+func (priorityShed) Gauges() map[string]float64        { return nil }
+
+// admit asks pl's strategy about o, counting the decision.
+func (pl *pipeline) admit(o models.Order, now time.Time) bool {
+	if pl.admission == nil {
+		return true
+	}
+	if !pl.admission.Admit(o, QueueState{Length: pl.orders.len(), Capacity: pl.capacity}, now) {
+		pl.admitMu.Lock()
+		pl.refused[lane(o.Priority)]++
+		pl.admitMu.Unlock()
+		return false
+	}
+	pl.admitted.Add(1)
+	return true
+}
+
+func (pl *pipeline) admissionStats() *models.AdmissionStats {
+	if pl.admission == nil {
+		return nil
+	}
+	s := &models.AdmissionStats{
+		Strategy:          pl.strategy,
+		Admitted:          int(pl.admitted.Load()),
+		RefusedByPriority: make(map[models.Priority]int),
+		Gauges:            pl.admission.Gauges(),
+	}
+	pl.admitMu.Lock()
+	defer pl.admitMu.Unlock()
+	for prio, n := range pl.refused {
+		s.Refused += n
+		s.RefusedByPriority[prio] = n
+	}
+	return s
+}
@@ -0,0 +1,234 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/pkg/models"
+)
+
+// Defaults for autoscaling pipelines that don't set UpAfter or DownAfter.
+const (
+	DefaultScaleUpAfter   = 5 * time.Second
+	DefaultScaleDownAfter = 30 * time.Second
+)
+
+// autoscaleInterval is how often queue lengths are checked.
+const autoscaleInterval = time.Second
+
+// maxScaleEvents is how many scaling events each pipeline keeps.
+const maxScaleEvents = 20
+
+// AutoscaleConfig lets a pipeline run between MinWorkers and MaxWorkers
+// workers, starting with its Workers. While its queue holds more than
+// HighWater orders (default half its buffer) for UpAfter, a worker is
+// added; once the queue has been empty for DownAfter, an idle worker is
+// stopped. Zero durations take the defaults above. Sharded pipelines
+// can't scale.
+type AutoscaleConfig struct {
+	MinWorkers int
+	MaxWorkers int
+	HighWater  int
+	UpAfter    time.Duration
+	DownAfter  time.Duration
+}
+
+// scaler starts and stops a pipeline's workers.
+type scaler struct {
+	cfg AutoscaleConfig
+
+	mu         sync.Mutex
+	stops      []context.CancelFunc // by worker index
+	stopped    []chan struct{}      // closed once the worker has exited
+	aboveSince time.Time            // queue over the high-water mark
+	emptySince time.Time
+	events     []models.ScaleEvent
+}
+
+func newScaler(cfg PipelineConfig) (*scaler, error) {
+	a := *cfg.Autoscale
+	switch {
+	case cfg.ShardBy != "":
+		return nil, fmt.Errorf("pipeline %q: sharded pipelines can't autoscale", cfg.Name)
+	case a.MinWorkers < 1 || a.MaxWorkers < a.MinWorkers:
+		return nil, fmt.Errorf("pipeline %q: autoscale needs 1 <= min workers <= max workers", cfg.Name)
+	case cfg.Workers < a.MinWorkers || cfg.Workers > a.MaxWorkers:
+		return nil, fmt.Errorf("pipeline %q: workers must be within the autoscale bounds", cfg.Name)
+	case a.HighWater < 0 || a.UpAfter < 0 || a.DownAfter < 0:
+		return nil, fmt.Errorf("pipeline %q: autoscale high water and durations must be >= 0", cfg.Name)
+	}
+	if a.HighWater == 0 {
+		a.HighWater = cfg.Buffer / 2
+	}
+	if a.UpAfter == 0 {
+		a.UpAfter = DefaultScaleUpAfter
+	}
+	if a.DownAfter == 0 {
+		a.DownAfter = DefaultScaleDownAfter
+	}
+	return &scaler{cfg: a, stops: make([]context.CancelFunc, a.MaxWorkers), stopped: make([]chan struct{}, a.MaxWorkers)}, nil
+}
+
+// startWorker runs the worker at index of pl. Workers of autoscaled
+// pipelines get their own context, so they can be stopped one by one.
+func (p *Pool) startWorker(pl *pipeline, index int) {
+	ctx := p.Ctx
+	var stopped chan struct{}
+	if s := pl.scaler; s != nil {
+		var stop context.CancelFunc
+		ctx, stop = context.WithCancel(p.Ctx)
+		stopped = make(chan struct{})
+		s.stops[index], s.stopped[index] = stop, stopped
+		// Wake the worker if it waits for an order.
+		context.AfterFunc(ctx, func() {
+			if q, ok := pl.orders.(interrupter); ok {
+				q.interrupt()
+			}
+		})
+	}
+	pl.running.Add(1)
+	p.Wg.Add(1)
+	go func() {
+		defer p.Wg.Done()
+		panicked := p.worker(ctx, pl.firstID+index, index, pl)
+		pl.running.Add(-1)
+		if stopped != nil {
+			close(stopped)
+		}
+		if panicked {
+			p.restartWorker(ctx, pl, index)
+		}
+	}()
+}
+
+// restartWorker replaces the worker at index of pl after it panicked,
+// unless the pool closed or autoscaling stopped it meanwhile. The old
+// worker counts in p.Wg until then, so Drain and Close wait for the new
+// one too.
+func (p *Pool) restartWorker(ctx context.Context, pl *pipeline, index int) {
+	if ctx.Err() != nil {
+		return
+	}
+	if s := pl.scaler; s != nil {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.stops[index] == nil {
+			return
+		}
+		s.stops[index]() // release the old worker's context
+	}
+	p.workerStates[pl.firstID+index].restarts.Add(1)
+	log.Printf("♻️ Restarting worker %d of pipeline %s", pl.firstID+index, pl.name)
+	p.startWorker(pl, index)
+}
+
+// autoscale resizes the pipelines that autoscale every autoscaleInterval
+// until ctx is done or the pool drains. It counts in p.Wg, so workers are
+// never added once Drain or Close is waiting for them to exit.
+func (p *Pool) autoscale(ctx context.Context) {
+	defer p.Wg.Done()
+	ticker := time.NewTicker(autoscaleInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if p.draining.Load() {
+			return
+		}
+		for _, pl := range p.pipelines {
+			if pl.scaler != nil {
+				p.scale(pl, time.Now())
+			}
+		}
+	}
+}
+
+// scale adds or stops at most one of pl's workers.
+func (p *Pool) scale(pl *pipeline, now time.Time) {
+	s := pl.scaler
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	length := pl.orders.len()
+	n := s.workers()
+	switch {
+	case length > s.cfg.HighWater:
+		s.emptySince = time.Time{}
+		if s.aboveSince.IsZero() {
+			s.aboveSince = now
+		}
+		if n >= s.cfg.MaxWorkers || now.Sub(s.aboveSince) < s.cfg.UpAfter || !s.exited(n) {
+			return
+		}
+		p.startWorker(pl, n)
+		s.aboveSince = now
+		s.record(pl.name, now, n, n+1, length)
+	case length == 0:
+		s.aboveSince = time.Time{}
+		if s.emptySince.IsZero() {
+			s.emptySince = now
+		}
+		if n <= s.cfg.MinWorkers || now.Sub(s.emptySince) < s.cfg.DownAfter {
+			return
+		}
+		// Only an idle worker is stopped; a busy one is tried again later.
+		if p.workerStates[pl.firstID+n-1].current() != WorkerIdle {
+			return
+		}
+		s.stops[n-1]()
+		s.stops[n-1] = nil
+		s.emptySince = now
+		s.record(pl.name, now, n, n-1, length)
+	default:
+		s.aboveSince, s.emptySince = time.Time{}, time.Time{}
+	}
+}
+
+// workers counts the workers not asked to stop. It must be called with
+// s.mu held; workers run at indexes below it.
+func (s *scaler) workers() int {
+	n := 0
+	for n < len(s.stops) && s.stops[n] != nil {
+		n++
+	}
+	return n
+}
+
+// exited reports whether the worker that last ran at index has exited,
+// so another can take its place. It must be called with s.mu held.
+func (s *scaler) exited(index int) bool {
+	if s.stopped[index] == nil {
+		return true
+	}
+	select {
+	case <-s.stopped[index]:
+		return true
+	default:
+		return false
+	}
+}
+
+// record must be called with s.mu held.
+func (s *scaler) record(pipeline string, at time.Time, from, to, queueLength int) {
+	log.Printf("autoscale %s: %d -> %d workers at queue length %d", pipeline, from, to, queueLength)
+	if len(s.events) == maxScaleEvents {
+		s.events = s.events[1:]
+	}
+	s.events = append(s.events, models.ScaleEvent{At: at, From: from, To: to, QueueLength: queueLength})
+}
+
+func (s *scaler) stats() *models.AutoscaleStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return &models.AutoscaleStats{
+		MinWorkers: s.cfg.MinWorkers,
+		MaxWorkers: s.cfg.MaxWorkers,
+		HighWater:  s.cfg.HighWater,
+		Events:     append([]models.ScaleEvent{}, s.events...),
+	}
+}
@@ -0,0 +1,231 @@
+package processor
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNoCanary is returned for pipelines without a canary.
+var ErrNoCanary = errors.New("pipeline has no canary")
+
+// Defaults for canaries that don't set MinOrders or Tolerance.
+const (
+	DefaultCanaryMinOrders = 100
+	DefaultCanaryTolerance = 0.05
+)
+
+// CanaryConfig sends Percent of the orders routed to a pipeline to the
+// pipeline named Pipeline instead, a small pool running a new version of
+// its steps or settings. Once the canary has processed MinOrders orders
+// since it started, it is rolled back, taking no more orders, if its
+// error rate exceeds the baseline's over the same period by more than
+// Tolerance. Zero values take the defaults above.
+type CanaryConfig struct {
+	Pipeline  string
+	Percent   float64
+	MinOrders int
+	Tolerance float64
+}
+
+type CanaryState string
+
+const (
+	CanaryActive     CanaryState = "active"
+	CanaryRolledBack CanaryState = "rolled_back"
+)
+
+// CanarySide is one side of a canary comparison, counted since the
+// canary started or was resumed.
+type CanarySide struct {
+	Pipeline  string  `json:"pipeline"`
+	Processed int64   `json:"processed"`
+	Errors    int64   `json:"errors"`
+	ErrorRate float64 `json:"error_rate"`
+	ServiceMs float64 `json:"service_ms"` // moving average processing time
+}
+
+// CanaryStatus compares a canary with its baseline side by side.
+type CanaryStatus struct {
+	Pipeline     string      `json:"pipeline"`
+	Percent      float64     `json:"percent"`
+	State        CanaryState `json:"state"`
+	Since        time.Time   `json:"since"`
+	Baseline     CanarySide  `json:"baseline"`
+	Canary       CanarySide  `json:"canary"`
+	RolledBackAt time.Time   `json:"rolled_back_at,omitzero"`
+	Reason       string      `json:"reason,omitempty"`
+}
+
+type canary struct {
+	cfg          CanaryConfig
+	base, target *pipeline
+
+	mu           sync.Mutex
+	state        CanaryState
+	since        time.Time
+	baseFrom     [2]int64 // processed and errors at since
+	targetFrom   [2]int64
+	rolledBackAt time.Time
+	reason       string
+}
+
+// startCanaries links the pipelines configured with a canary to it. It
+// must run before the workers start.
+func (p *Pool) startCanaries(configs []PipelineConfig) error {
+	byName := make(map[string]*pipeline, len(p.pipelines))
+	for _, pl := range p.pipelines {
+		byName[pl.name] = pl
+	}
+	for i, cfg := range configs {
+		if cfg.Canary == nil {
+			continue
+		}
+		base, target := p.pipelines[i], byName[cfg.Canary.Pipeline]
+		switch {
+		case target == nil:
+			return fmt.Errorf("pipeline %q: unknown canary %q", cfg.Name, cfg.Canary.Pipeline)
+		case target == base || target.canary != nil || target.canaryOf != nil || base.canaryOf != nil:
+			return fmt.Errorf("pipeline %q: canary %q must be a separate pipeline used by no other canary", cfg.Name, cfg.Canary.Pipeline)
+		case cfg.Canary.Percent <= 0 || cfg.Canary.Percent >= 100:
+			return fmt.Errorf("pipeline %q: canary percent must be between 0 and 100", cfg.Name)
+		}
+		c := &canary{cfg: *cfg.Canary, base: base, target: target}
+		c.cfg.MinOrders = cmp.Or(c.cfg.MinOrders, DefaultCanaryMinOrders)
+		c.cfg.Tolerance = cmp.Or(c.cfg.Tolerance, DefaultCanaryTolerance)
+		c.reset()
+		base.canary, target.canaryOf = c, c
+	}
+	return nil
+}
+
+// reset starts comparing from now. It must be called with c.mu held, or
+// before c is shared.
+func (c *canary) reset() {
+	c.state, c.since = CanaryActive, time.Now()
+	c.baseFrom = [2]int64{c.base.processed.Load(), c.base.errors.Load()}
+	c.targetFrom = [2]int64{c.target.processed.Load(), c.target.errors.Load()}
+	c.rolledBackAt, c.reason = time.Time{}, ""
+}
+
+// takes reports whether an order goes to the canary. The choice hashes
+// the order's ID, so a resubmitted order takes the same path.
+func (c *canary) takes(id string) bool {
+	c.mu.Lock()
+	active := c.state == CanaryActive
+	c.mu.Unlock()
+	if !active {
+		return false
+	}
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	return float64(h.Sum32()%10000) < c.cfg.Percent*100
+}
+
+// side must be called with c.mu held.
+func (c *canary) side(pl *pipeline, from [2]int64) CanarySide {
+	s := CanarySide{
+		Pipeline:  pl.name,
+		Processed: pl.processed.Load() - from[0],
+		Errors:    pl.errors.Load() - from[1],
+		ServiceMs: float64(pl.serviceTime.Load()) / float64(time.Millisecond),
+	}
+	if s.Processed > 0 {
+		s.ErrorRate = float64(s.Errors) / float64(s.Processed)
+	}
+	return s
+}
+
+// check rolls the canary back once it has enough orders to judge and
+// fails more often than the baseline allows. Workers of the canary call
+// it after each result.
+func (c *canary) check() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.state != CanaryActive {
+		return
+	}
+	base, target := c.side(c.base, c.baseFrom), c.side(c.target, c.targetFrom)
+	if target.Processed < int64(c.cfg.MinOrders) || target.ErrorRate <= base.ErrorRate+c.cfg.Tolerance {
+		return
+	}
+	c.rollBack(fmt.Sprintf("error rate %.1f%% exceeds the baseline's %.1f%% by more than %.1f points",
+		target.ErrorRate*100, base.ErrorRate*100, c.cfg.Tolerance*100))
+}
+
+// rollBack must be called with c.mu held.
+func (c *canary) rollBack(reason string) {
+	c.state, c.rolledBackAt, c.reason = CanaryRolledBack, time.Now(), reason
+	log.Printf("canary %s of %s rolled back: %s", c.target.name, c.base.name, reason)
+}
+
+func (c *canary) status() CanaryStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return CanaryStatus{
+		Pipeline:     c.base.name,
+		Percent:      c.cfg.Percent,
+		State:        c.state,
+		Since:        c.since,
+		Baseline:     c.side(c.base, c.baseFrom),
+		Canary:       c.side(c.target, c.targetFrom),
+		RolledBackAt: c.rolledBackAt,
+		Reason:       c.reason,
+	}
+}
+
+// Canaries compares every canary with its baseline.
+func (p *Pool) Canaries() []CanaryStatus {
+	out := []CanaryStatus{}
+	for _, pl := range p.pipelines {
+		if pl.canary != nil {
+			out = append(out, pl.canary.status())
+		}
+	}
+	return out
+}
+
+// RollbackCanary stops routing orders to the canary of a pipeline. Orders
+// it already queued are still processed by it.
+func (p *Pool) RollbackCanary(pipeline string) (CanaryStatus, error) {
+	c := p.canaryOf(pipeline)
+	if c == nil {
+		return CanaryStatus{}, ErrNoCanary
+	}
+	c.mu.Lock()
+	if c.state == CanaryActive {
+		c.rollBack("rolled back by an operator")
+	}
+	c.mu.Unlock()
+	return c.status(), nil
+}
+
+// ResumeCanary routes orders to a rolled back canary again and starts a
+// new comparison.
+func (p *Pool) ResumeCanary(pipeline string) (CanaryStatus, error) {
+	c := p.canaryOf(pipeline)
+	if c == nil {
+		return CanaryStatus{}, ErrNoCanary
+	}
+	c.mu.Lock()
+	if c.state != CanaryActive {
+		c.reset()
+		log.Printf("canary %s of %s resumed", c.target.name, c.base.name)
+	}
+	c.mu.Unlock()
+	return c.status(), nil
+}
+
+func (p *Pool) canaryOf(pipeline string) *canary {
+	for _, pl := range p.pipelines {
+		if pl.canary != nil && strings.EqualFold(pl.name, pipeline) {
+			return pl.canary
+		}
+	}
+	return nil
+}
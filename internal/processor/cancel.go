@@ -0,0 +1,82 @@
+package processor
+
+import (
+	"errors"
+
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/orderstore"
+)
+
+var (
+	// ErrUnknownOrder is returned by CancelOrder for an order without a
+	// record.
+	ErrUnknownOrder = errors.New("order not found")
+	// ErrInFlight is returned by CancelOrder once a worker has started
+	// the order.
+	ErrInFlight = errors.New("order is being processed")
+	// ErrNotCancellable is returned by CancelOrder for finished orders.
+	ErrNotCancellable = errors.New("order can no longer be cancelled")
+)
+
+// CancelOrder stops a queued or held order from ever being processed.
+// Orders in memory are taken out of their queue; others, such as spilled
+// ones, are registered so the worker that pops them skips them.
+func (p *Pool) CancelOrder(id string) error {
+	for _, pl := range p.pipelines {
+		if q, ok := pl.orders.(inspectable); ok {
+			if _, ok := q.remove(id); ok {
+				p.Orders.SetState(id, orderstore.Cancelled)
+				p.traceDropped(id, "cancelled")
+				return nil
+			}
+		}
+	}
+	p.heldMu.Lock()
+	_, held := p.held[id]
+	delete(p.held, id)
+	p.heldMu.Unlock()
+	if held {
+		p.Orders.SetState(id, orderstore.Cancelled)
+		p.traceDropped(id, "cancelled")
+		return nil
+	}
+
+	// Workers claim orders under cancelMu, so an order is either claimed
+	// already or will see the cancellation.
+	p.cancelMu.Lock()
+	defer p.cancelMu.Unlock()
+	if p.inFlight[id] {
+		return ErrInFlight
+	}
+	rec, ok := p.Orders.Get(id)
+	switch {
+	case !ok:
+		return ErrUnknownOrder
+	case rec.State == orderstore.Queued:
+		p.cancelled[id] = true
+		p.Orders.SetState(id, orderstore.Cancelled)
+		return nil
+	case rec.State == orderstore.Processing:
+		return ErrInFlight
+	}
+	return ErrNotCancellable
+}
+
+// claim marks an order popped by a worker as in flight. It returns false
+// for a cancelled order, which must be skipped.
+func (p *Pool) claim(id string) bool {
+	p.cancelMu.Lock()
+	defer p.cancelMu.Unlock()
+	if p.cancelled[id] {
+		delete(p.cancelled, id)
+		return false
+	}
+	p.inFlight[id] = true
+	return true
+}
+
+// unclaim is called once the order's result is recorded.
+func (p *Pool) unclaim(id string) {
+	p.cancelMu.Lock()
+	defer p.cancelMu.Unlock()
+	delete(p.inFlight, id)
+}
@@ -0,0 +1,18 @@
+package processor
+
+import (
+	"syscall"
+	"time"
+)
+
+const rusageThread = 1 // RUSAGE_THREAD
+
+// threadCPUTime returns the CPU time used by the calling OS thread. The
+// caller must hold runtime.LockOSThread for the result to be meaningful.
+func threadCPUTime() (time.Duration, bool) {
+	var ru syscall.Rusage
+	if err := syscall.Getrusage(rusageThread, &ru); err != nil {
+		return 0, false
+	}
+	return time.Duration(ru.Utime.Nano() + ru.Stime.Nano()), true
+}
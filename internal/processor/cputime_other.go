@@ -0,0 +1,11 @@
+//go:build !linux
+
+package processor
+
+import "time"
+
+// threadCPUTime is only implemented on Linux; elsewhere order costs report
+// no CPU time.
+func threadCPUTime() (time.Duration, bool) {
+	return 0, false
+}
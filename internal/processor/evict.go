@@ -0,0 +1,108 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/pkg/models"
+)
+
+// ErrWouldMissDeadline is returned by Submit for an order that can't be
+// processed before its deadline at the pipeline's current service rate.
+var ErrWouldMissDeadline = errors.New("order would miss its deadline at the current load")
+
+// evictInterval is how often queued orders are checked against their
+// deadlines.
+const evictInterval = 250 * time.Millisecond
+
+// serviceSmoothing weighs each processing time into a pipeline's moving
+// average service time.
+const serviceSmoothing = 0.125
+
+// observeService folds one order's processing time into the pipeline's
+// moving average.
+func (pl *pipeline) observeService(d time.Duration) {
+	old := time.Duration(pl.serviceTime.Load())
+	if old == 0 {
+		pl.serviceTime.Store(int64(d))
+		return
+	}
+	pl.serviceTime.Store(int64(old + time.Duration(serviceSmoothing*float64(d-old))))
+}
+
+// doomed reports whether an order with ahead orders queued in front of it
+// would finish after its deadline, if the workers keep their average
+// service time. Without a deadline or a service time yet, nothing is.
+func (pl *pipeline) doomed(o models.Order, ahead int, now time.Time) bool {
+	deadline := pl.orderDeadline(o)
+	avg := time.Duration(pl.serviceTime.Load())
+	if deadline.IsZero() || avg == 0 {
+		return false
+	}
+	eta := now.Add(time.Duration(ahead/max(int(pl.running.Load()), 1)+1) * avg)
+	return eta.After(deadline)
+}
+
+// evictDoomed takes the queued orders that would miss their deadline out
+// of the pipelines that evict, every evictInterval until ctx is done.
+func (p *Pool) evictDoomed(ctx context.Context) {
+	ticker := time.NewTicker(evictInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		for _, pl := range p.pipelines {
+			if pl.evict {
+				p.evictFrom(pl, time.Now())
+			}
+		}
+	}
+}
+
+func (p *Pool) evictFrom(pl *pipeline, now time.Time) {
+	q, ok := pl.orders.(inspectable)
+	if !ok {
+		return
+	}
+	evicted := 0
+	for i, o := range q.list() {
+		// Orders behind an evicted one move up, so they are checked at
+		// the position they will have.
+		if !pl.doomed(o, i-evicted, now) {
+			continue
+		}
+		if _, ok := q.remove(o.ID); !ok {
+			continue // popped meanwhile
+		}
+		evicted++
+		p.forgetAttempts(o.ID)
+		p.traceDropped(o.ID, "evicted")
+		result := models.ProcessedOrder{
+			Order:       o,
+			ProcessedAt: now,
+			WorkerID:    -1,
+			Pipeline:    pl.name,
+			Error:       ErrWouldMissDeadline.Error(),
+			ErrorCode:   models.CodeWouldMissDeadline,
+			Result:      models.Message(models.CodeResultFailed),
+			ResultCode:  models.CodeResultFailed,
+		}
+		if !o.CreatedAt.IsZero() {
+			result.QueueWaitTime = now.Sub(o.CreatedAt).Milliseconds()
+			result.EndToEndTime = result.QueueWaitTime
+		}
+		p.Orders.Finish(result)
+		pl.evicted.Add(1)
+		if !p.results.send(p.Ctx, result) {
+			return
+		}
+	}
+	if evicted > 0 {
+		log.Printf("evicted %d orders from pipeline %s that would miss their deadline", evicted, pl.name)
+	}
+}
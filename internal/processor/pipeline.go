@@ -0,0 +1,425 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"runtime/trace"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/diskqueue"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/pkg/models"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/redisq"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/tracing"
+)
+
+// Step is one stage of a pipeline. Returning an error fails the order and
+// skips the remaining steps. Outbound calls should use ctx so they are
+// counted in the order's cost.
+type Step func(ctx context.Context, processedOrder *models.ProcessedOrder) error
+
+var steps = map[string]Step{
+	"simulate":       simulateWork,
+	"validate":       validateOrderForProcessing,
+	"business_rules": applyBusinessRules,
+}
+
+// DefaultSteps is used by pipelines that don't list their own steps.
+var DefaultSteps = []string{"simulate", "validate", "business_rules"}
+
+// Processor replaces a pipeline's steps with custom fulfillment logic. The
+// pool still queues, schedules, times and counts every order. Process
+// returns the processed order with its possibly changed Order, Result,
+// Payment and Shipment; the pool fills in the worker, pipeline, timings
+// and cost. An error fails the order in the "process" step. ctx carries
+// the order's deadline, if it has one.
+type Processor interface {
+	Process(ctx context.Context, o models.Order) (models.ProcessedOrder, error)
+}
+
+// ProcessorFunc adapts a function to a Processor.
+type ProcessorFunc func(ctx context.Context, o models.Order) (models.ProcessedOrder, error)
+
+func (f ProcessorFunc) Process(ctx context.Context, o models.Order) (models.ProcessedOrder, error) {
+	return f(ctx, o)
+}
+
+// processStep names a Processor's part in results and traces.
+const processStep = "process"
+
+// RegisterStep makes a step available to pipeline configs by name. It must
+// be called before the pool is started.
+func RegisterStep(name string, step Step) {
+	steps[name] = step
+}
+
+// PipelineConfig describes a named pipeline with its own queue, workers and
+// processing steps.
+type PipelineConfig struct {
+	Name    string
+	Workers int
+	Buffer  int
+	Steps   []string
+
+	// Processor, if set, processes the orders instead of Steps.
+	Processor Processor
+
+	// ShardBy gives every worker its own shard of orders keyed by
+	// "customer" or "tag:<name>", with idle workers stealing from busy
+	// shards. Empty shares one queue between all workers.
+	ShardBy string
+
+	// Scheduling orders the shared queue: "priority", the default, pops
+	// higher priorities first, serving lower-priority orders that have
+	// waited StarveAfter (default DefaultStarveAfter) ahead of them;
+	// "fifo" pops in arrival order.
+	Scheduling  string
+	StarveAfter time.Duration
+
+	// SpillDir, if set, holds up to SpillMax orders on disk when the
+	// in-memory queue is full instead of rejecting them.
+	SpillDir string
+	SpillMax int
+
+	// Redis, if set, keeps the queue in Redis instead of memory, shared
+	// by every instance with a pipeline of the same name. Node names this
+	// instance, to queue again what it was processing if it crashed.
+	// Redis queues are FIFO, and can't be sharded or spilled.
+	Redis *redisq.Client
+	Node  string
+
+	// Deadline is how long after acceptance an order must be processed,
+	// for orders without their own deadline; zero sets none. Time spent
+	// held by operators doesn't count.
+	Deadline time.Duration
+
+	// Timeout bounds how long one order may take to process; zero sets
+	// none. At the timeout the steps' context is cancelled and the worker
+	// moves on even if a step ignores it, failing the order with
+	// CodeTimeout.
+	Timeout time.Duration
+
+	// BudgetWeights splits the time left before an order's deadline
+	// between steps by name; unlisted steps weigh 1.
+	BudgetWeights map[string]float64
+
+	// Retry tries orders that failed with a retryable error again.
+	Retry RetryPolicy
+
+	// EvictDoomed refuses and evicts orders that would miss their
+	// deadline at the pipeline's current service rate, instead of
+	// processing them late. Sharded pipelines can't evict.
+	EvictDoomed bool
+
+	// Admission decides which orders are queued while there's room.
+	Admission AdmissionConfig
+
+	// Autoscale, if set, adds and stops workers with the queue length.
+	Autoscale *AutoscaleConfig
+
+	// Canary, if set, sends a slice of this pipeline's orders to another
+	// pipeline until it fails more often than this one.
+	Canary *CanaryConfig
+}
+
+// Route sends matching orders to Pipeline. All set conditions must match;
+// routes are evaluated in order and the first match wins.
+type Route struct {
+	Pipeline  string
+	Tags      map[string]string // every listed tag must be present with this value
+	Items     []string          // order contains at least one of these items
+	MinItems  int
+	MinAmount models.Money
+	MaxAmount models.Money // 0 means no upper bound
+}
+
+func (r Route) matches(o models.Order) bool {
+	for k, v := range r.Tags {
+		if o.Tags[k] != v {
+			return false
+		}
+	}
+	if len(r.Items) > 0 && !slices.ContainsFunc(o.Items, func(item string) bool {
+		return slices.ContainsFunc(r.Items, func(want string) bool { return strings.EqualFold(want, item) })
+	}) {
+		return false
+	}
+	if len(o.Items) < r.MinItems {
+		return false
+	}
+	if o.Amount < r.MinAmount {
+		return false
+	}
+	if r.MaxAmount > 0 && o.Amount > r.MaxAmount {
+		return false
+	}
+	return true
+}
+
+type namedStep struct {
+	name   string
+	fn     Step
+	weight float64
+}
+
+// call runs the step in a trace region and a span named after it. A
+// panic in the step fails the order with CodePanic, which isn't retried.
+func (s namedStep) call(ctx context.Context, processedOrder *models.ProcessedOrder) (err error) {
+	defer trace.StartRegion(ctx, "step:"+s.name).End()
+	ctx, span := tracing.Tracer().Start(ctx, "step:"+s.name)
+	defer span.End()
+	defer func() {
+		if v := recover(); v != nil {
+			log.Printf("💥 Order %s: step %s panicked: %v\n%s", processedOrder.Order.ID, s.name, v, debug.Stack())
+			err = models.NewValidationError(models.CodePanic)
+		}
+		if err != nil {
+			tracing.Fail(span, err)
+		}
+	}()
+	return s.fn(ctx, processedOrder)
+}
+
+type pipeline struct {
+	name     string
+	steps    []namedStep
+	weights  []float64 // weights[i] sums the weights of steps i and later
+	deadline time.Duration
+	timeout  time.Duration
+	workers  int // at start
+	slots    int // workers it can scale up to
+	firstID  int // pool-wide ID of its first worker
+	running  atomic.Int64
+	scaler   *scaler // nil unless it autoscales
+	orders   queue
+	retry    RetryPolicy
+	evict    bool
+	capacity int
+
+	admission Admission
+	strategy  string
+	admitted  atomic.Int64
+	admitMu   sync.Mutex
+	refused   map[models.Priority]int
+
+	processed   atomic.Int64
+	errors      atomic.Int64
+	retries     atomic.Int64
+	timeouts    atomic.Int64
+	panics      atomic.Int64
+	evicted     atomic.Int64
+	serviceTime atomic.Int64 // moving average processing time in ns
+
+	canary   *canary // taking a slice of this pipeline's orders
+	canaryOf *canary // that this pipeline is the canary of
+}
+
+func newPipeline(cfg PipelineConfig) (*pipeline, error) {
+	names := cfg.Steps
+	if len(names) == 0 {
+		names = DefaultSteps
+	}
+	if cfg.Processor != nil {
+		if len(cfg.Steps) > 0 {
+			return nil, fmt.Errorf("pipeline %q: steps and a processor are exclusive", cfg.Name)
+		}
+		names = nil
+	}
+	pl := &pipeline{
+		name:     cfg.Name,
+		deadline: cfg.Deadline,
+		timeout:  cfg.Timeout,
+		retry:    cfg.Retry,
+		evict:    cfg.EvictDoomed,
+		workers:  cfg.Workers,
+		slots:    cfg.Workers,
+		capacity: cfg.Buffer,
+		strategy: cfg.Admission.Strategy,
+		refused:  make(map[models.Priority]int),
+	}
+	admission, err := NewAdmission(cfg.Admission)
+	if err != nil {
+		return nil, fmt.Errorf("pipeline %q: %w", cfg.Name, err)
+	}
+	pl.admission = admission
+	if cfg.Autoscale != nil {
+		if pl.scaler, err = newScaler(cfg); err != nil {
+			return nil, err
+		}
+		pl.slots = cfg.Autoscale.MaxWorkers
+	}
+	switch by := cfg.ShardBy; {
+	case cfg.Redis != nil && (by != "" || cfg.SpillDir != "" || cfg.Scheduling == "priority"):
+		return nil, fmt.Errorf("pipeline %q: redis queues are fifo and can't be sharded or spilled", cfg.Name)
+	case cfg.Redis != nil:
+		q, err := newRedisQueue(cfg.Redis, cfg.Name, cfg.Node, pl.slots, cfg.Buffer)
+		if err != nil {
+			return nil, fmt.Errorf("pipeline %q: redis: %w", cfg.Name, err)
+		}
+		pl.orders = q
+	case by != "" && cfg.Scheduling != "":
+		return nil, fmt.Errorf("pipeline %q: scheduling doesn't apply to sharded pipelines", cfg.Name)
+	case by != "" && cfg.EvictDoomed:
+		return nil, fmt.Errorf("pipeline %q: sharded pipelines can't evict orders", cfg.Name)
+	case cfg.Scheduling == "fifo":
+		pl.orders = newFIFOQueue(cfg.Buffer)
+	case by == "" && (cfg.Scheduling == "" || cfg.Scheduling == "priority"):
+		pl.orders = newPriorityQueue(cfg.Buffer, cfg.StarveAfter)
+	case by == "":
+		return nil, fmt.Errorf("pipeline %q: scheduling must be priority or fifo", cfg.Name)
+	case by == "customer" || strings.HasPrefix(by, "tag:") && len(by) > len("tag:"):
+		pl.orders = newShardQueue(by, cfg.Workers, cfg.Buffer)
+	default:
+		return nil, fmt.Errorf("pipeline %q: shard_by must be customer or tag:<name>", cfg.Name)
+	}
+	if cfg.SpillDir != "" {
+		disk, err := diskqueue.Open(cfg.SpillDir, cfg.SpillMax)
+		if err != nil {
+			return nil, fmt.Errorf("pipeline %q: spill: %w", cfg.Name, err)
+		}
+		pl.orders = newSpillQueue(pl.orders, disk)
+	}
+	for _, name := range names {
+		step, ok := steps[name]
+		if !ok {
+			return nil, fmt.Errorf("pipeline %q: unknown step %q", cfg.Name, name)
+		}
+		weight := 1.0
+		if w, ok := cfg.BudgetWeights[name]; ok {
+			weight = w
+		}
+		pl.steps = append(pl.steps, namedStep{name: name, fn: step, weight: weight})
+	}
+	if cfg.Processor != nil {
+		pl.steps = []namedStep{{name: processStep, fn: processorStep(cfg.Processor), weight: 1}}
+	}
+	pl.weights = make([]float64, len(pl.steps)+1)
+	for i := len(pl.steps) - 1; i >= 0; i-- {
+		pl.weights[i] = pl.weights[i+1] + pl.steps[i].weight
+	}
+	return pl, nil
+}
+
+// orderDeadline is the order's own deadline, or else the pipeline's
+// counted from acceptance. Zero means none.
+func (pl *pipeline) orderDeadline(o models.Order) time.Time {
+	if !o.Deadline.IsZero() || pl.deadline <= 0 || o.CreatedAt.IsZero() {
+		return o.Deadline
+	}
+	return o.CreatedAt.Add(pl.deadline + time.Duration(o.HeldMs)*time.Millisecond)
+}
+
+// run applies the steps in order and returns the error of the step that
+// failed the order. With a deadline, each step gets its weighted share of
+// the time left as its context deadline, so time a step doesn't use
+// passes on to the later ones.
+func (pl *pipeline) run(ctx context.Context, processedOrder *models.ProcessedOrder, onStep func(name string)) error {
+	deadline := pl.orderDeadline(processedOrder.Order)
+	for i, step := range pl.steps {
+		onStep(step.name)
+		if deadline.IsZero() {
+			if err := step.call(ctx, processedOrder); err != nil {
+				fail(processedOrder, step.name, err)
+				return err
+			}
+			continue
+		}
+
+		left := time.Until(deadline)
+		if left <= 0 {
+			err := models.NewValidationError(models.CodeDeadlineExceeded, step.name)
+			fail(processedOrder, step.name, err)
+			return err
+		}
+		budget := time.Duration(float64(left) * step.weight / pl.weights[i])
+		stepCtx, cancel := context.WithTimeout(ctx, budget)
+		err := step.call(stepCtx, processedOrder)
+		if err != nil && errors.Is(stepCtx.Err(), context.DeadlineExceeded) {
+			err = models.NewValidationError(models.CodeStepBudgetExceeded, step.name, budget.Round(time.Millisecond).String())
+		}
+		cancel()
+		if err != nil {
+			fail(processedOrder, step.name, err)
+			return err
+		}
+	}
+	return nil
+}
+
+func fail(processedOrder *models.ProcessedOrder, step string, err error) {
+	processedOrder.Success = false
+	processedOrder.FailedStep = step
+	processedOrder.Error = err.Error()
+	var ve *models.ValidationError
+	if errors.As(err, &ve) {
+		processedOrder.ErrorCode = ve.Code
+	}
+	processedOrder.Result = models.Message(models.CodeResultFailed)
+	processedOrder.ResultCode = models.CodeResultFailed
+}
+
+// processorStep runs proc as the only step of a pipeline, so a processor
+// gets the same deadline handling as steps do.
+func processorStep(proc Processor) Step {
+	return func(ctx context.Context, processedOrder *models.ProcessedOrder) error {
+		out, err := proc.Process(ctx, processedOrder.Order)
+		if err != nil {
+			return err
+		}
+		if out.Order.ID != "" {
+			processedOrder.Order = out.Order
+		}
+		if out.Result != "" {
+			processedOrder.Result, processedOrder.ResultCode = out.Result, out.ResultCode
+		}
+		processedOrder.Payment, processedOrder.Shipment = out.Payment, out.Shipment
+		return nil
+	}
+}
+
+func simulateWork(_ context.Context, processedOrder *models.ProcessedOrder) error {
+	// Priority-based processing time
+	time.Sleep(time.Duration(processedOrder.Order.Priority) * 10 * time.Millisecond)
+	return nil
+}
+
+func validateOrderForProcessing(_ context.Context, processedOrder *models.ProcessedOrder) error {
+	order := processedOrder.Order
+
+	// Additional business validation
+	if order.Amount > models.Whole(10000) {
+		return models.NewValidationError(models.CodeAmountOverLimit)
+	}
+
+	if len(order.Items) > 50 {
+		return models.NewValidationError(models.CodeTooManyItems)
+	}
+
+	return nil
+}
+
+func applyBusinessRules(_ context.Context, processedOrder *models.ProcessedOrder) error {
+	order := &processedOrder.Order
+
+	// Apply business rules based on order characteristics
+	switch {
+	case order.Amount > models.Whole(1000):
+		order.Status = models.StatusPriorityProcessing
+		processedOrder.ResultCode = models.CodeResultPriority
+	case order.Priority == models.PriorityHigh:
+		order.Status = models.StatusExpedited
+		processedOrder.ResultCode = models.CodeResultExpedited
+	default:
+		order.Status = models.StatusProcessing
+		processedOrder.ResultCode = models.CodeResultCompleted
+	}
+	processedOrder.Result = models.Message(processedOrder.ResultCode)
+
+	return nil
+}
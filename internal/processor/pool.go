@@ -2,150 +2,596 @@ package processor
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"log"
+	"runtime"
+	"runtime/debug"
+	"runtime/trace"
+	"slices"
+	"sort"
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/orderstore"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/outbound"
 	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/pkg/models"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/sketch"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/tracing"
 )
 
+// ErrQueueFull is returned by Submit when the target pipeline has no room.
+var ErrQueueFull = errors.New("queue is full")
+
+// ErrDraining is returned by Submit once the pool is draining for shutdown.
+var ErrDraining = errors.New("pool is shutting down")
+
+// drainPoll is how often Drain checks whether the queues are empty.
+const drainPoll = 50 * time.Millisecond
+
+// DefaultKeptOrders is how many orders the default order store tracks.
+const DefaultKeptOrders = 100000
+
+// classSamples is how many of the latest latencies of each priority and
+// outcome percentiles are taken from.
+const classSamples = 1024
+
 type Pool struct {
-	Orders    chan models.Order
 	Results   chan models.ProcessedOrder
 	Wg        sync.WaitGroup
 	Ctx       context.Context
 	Cancel    context.CancelFunc
 	StartTime time.Time
-	
+
 	// Atomic counters for thread-safe operations
 	Processed    int64
 	SuccessCount int64
 	ErrorCount   int64
 	TotalTime    int64 // total processing time in milliseconds
+	TotalE2E     int64 // total time from CreatedAt to completion in milliseconds
+	TotalWait    int64 // total time spent queued in milliseconds
+
+	Workers int // at start; autoscaling changes ActiveWorkers
+
+	results      *resultSink
+	workerStates []*workerState // by worker ID
+
+	// Retries counts failed attempts that were retried.
+	Retries    int64
+	Timeouts   int64 // orders failed by their processing timeout
+	Panics     int64 // panics recovered in steps and workers
+	retryMu    sync.Mutex
+	attempts   map[string]int        // failed attempts of orders being retried
+	retrying   map[string]SavedOrder // orders waiting out their backoff, by ID
+	draining   atomic.Bool
+	closeOnce  sync.Once
+	queuesDone sync.Once
+
+	// Orders tracks each order's state and result.
+	Orders orderstore.Repository
+
+	pipelines []*pipeline // the first one receives unrouted orders
+	routes    []Route
+
+	tagMu    sync.Mutex
+	tagCount map[string]int // processed orders per "key=value" tag
+
+	classMu    sync.Mutex
+	byPriority map[models.Priority]*classCounter
+	byOutcome  map[string]*classCounter
+
+	customers *sketch.Distinct
+	items     *sketch.Distinct
+
+	topCustomers *sketch.TopK
+	topItems     *sketch.TopK
+	topErrors    *sketch.TopK
 
-	Workers int
+	heldMu sync.Mutex
+	held   map[string]HeldOrder
+
+	cancelMu  sync.Mutex
+	inFlight  map[string]bool // orders claimed by a worker
+	cancelled map[string]bool // cancelled orders still in a queue
+
+	traceMu sync.Mutex
+	traces  map[string]queuedTrace // traced orders waiting in a queue
+
+	costMu     sync.Mutex
+	costTotal  models.CostStats
+	byTenant   map[string]models.CostStats
+	byCustomer map[string]models.CostStats
+}
+
+// Start runs a pool with a single default pipeline, whose orders proc
+// processes. A nil proc runs the default steps.
+func Start(ctx context.Context, workers, buf int, proc Processor) *Pool {
+	pool, err := StartPipelines(ctx, []PipelineConfig{{Name: "default", Workers: workers, Buffer: buf, Processor: proc}}, nil, nil, ResultsConfig{})
+	if err != nil {
+		panic(err) // default steps always exist
+	}
+	return pool
 }
 
-func Start(ctx context.Context, workers, buf int) *Pool {
-	ctx, cancel := context.WithCancel(ctx)
+// StartPipelines runs a pool with several named pipelines. Orders are
+// routed by the first matching route, or to the first pipeline. Order
+// records are kept in orders, or in memory for the last DefaultKeptOrders
+// orders if it is nil; orders a previous run left unfinished in a durable
+// repository are reconciled before the workers start. results decides
+// what workers do when Results is full.
+func StartPipelines(ctx context.Context, configs []PipelineConfig, routes []Route, orders orderstore.Repository, results ResultsConfig) (*Pool, error) {
+	if len(configs) == 0 {
+		return nil, errors.New("at least one pipeline is required")
+	}
+
 	pool := &Pool{
-		Orders:    make(chan models.Order, buf),
-		Results:   make(chan models.ProcessedOrder, buf),
-		Workers:   workers,
-		Ctx:       ctx,
-		Cancel:    cancel,
+		routes:    routes,
 		StartTime: time.Now(),
+		tagCount:  make(map[string]int),
+		customers: sketch.NewDistinct(),
+		items:     sketch.NewDistinct(),
+
+		byPriority: make(map[models.Priority]*classCounter),
+		byOutcome:  make(map[string]*classCounter),
+
+		topCustomers: sketch.NewTopK(),
+		topItems:     sketch.NewTopK(),
+		topErrors:    sketch.NewTopK(),
+
+		Orders:     orders,
+		held:       make(map[string]HeldOrder),
+		inFlight:   make(map[string]bool),
+		cancelled:  make(map[string]bool),
+		attempts:   make(map[string]int),
+		retrying:   make(map[string]SavedOrder),
+		traces:     make(map[string]queuedTrace),
+		byTenant:   make(map[string]models.CostStats),
+		byCustomer: make(map[string]models.CostStats),
+	}
+	names := make(map[string]bool, len(configs))
+	slots, capacity := 0, 0
+	for _, cfg := range configs {
+		if names[cfg.Name] {
+			return nil, fmt.Errorf("duplicate pipeline %q", cfg.Name)
+		}
+		names[cfg.Name] = true
+
+		pl, err := newPipeline(cfg)
+		if err != nil {
+			return nil, err
+		}
+		pool.pipelines = append(pool.pipelines, pl)
+		pl.firstID = slots
+		pool.Workers += cfg.Workers
+		slots += pl.slots
+		capacity += cfg.Buffer
+	}
+	for _, r := range routes {
+		if !names[r.Pipeline] {
+			return nil, fmt.Errorf("route targets unknown pipeline %q", r.Pipeline)
+		}
+	}
+	if err := pool.startCanaries(configs); err != nil {
+		return nil, err
 	}
+	if pool.Orders == nil {
+		pool.Orders = orderstore.New(DefaultKeptOrders)
+	} else if err := pool.reconcile(ctx); err != nil {
+		return nil, fmt.Errorf("reconciling orders: %w", err)
+	}
+
+	sink, err := newResultSink(results, capacity)
+	if err != nil {
+		return nil, err
+	}
+	pool.results, pool.Results = sink, sink.out
+	pool.Ctx, pool.Cancel = context.WithCancel(ctx)
+	go sink.refill(pool.Ctx)
 
-	for i := 0; i < workers; i++ {
+	pool.workerStates = make([]*workerState, slots)
+	for _, pl := range pool.pipelines {
+		for i := range pl.slots {
+			state := WorkerIdle
+			if i >= pl.workers {
+				state = WorkerStopped // until autoscaling starts it
+			}
+			pool.workerStates[pl.firstID+i] = &workerState{state: state, since: time.Now()}
+		}
+	}
+
+	if slices.ContainsFunc(pool.pipelines, func(pl *pipeline) bool { return pl.evict }) {
+		go pool.evictDoomed(pool.Ctx)
+	}
+
+	context.AfterFunc(pool.Ctx, pool.closeQueues)
+	for _, pl := range pool.pipelines {
+		if sq, ok := pl.orders.(*spillQueue); ok {
+			go sq.refill(pool.Ctx)
+		}
+		for i := range pl.workers {
+			pool.startWorker(pl, i)
+		}
+	}
+	if slices.ContainsFunc(pool.pipelines, func(pl *pipeline) bool { return pl.scaler != nil }) {
 		pool.Wg.Add(1)
-		go pool.worker(i)
+		go pool.autoscale(pool.Ctx)
 	}
 
-	return pool
+	return pool, nil
 }
 
+// Close stops the workers right away; orders still queued are dropped
+// unless they were spilled. It may be called more than once.
 func Close(pool *Pool) {
-	pool.Cancel()
+	pool.Cancel() // also closes the pipeline queues
 	pool.Wg.Wait()
-	close(pool.Orders)
-	close(pool.Results)
+	pool.closeOnce.Do(pool.results.close)
 }
 
-func (p *Pool) worker(id int) {
-	defer p.Wg.Done()
-	for {
+// Drain shuts the pool down gracefully: it stops accepting orders, lets
+// the workers finish the queued ones, including those waiting to be
+// retried, and delivers spilled results until ctx is done, then closes
+// the pool. It returns how many queued orders were abandoned. Held
+// orders are never processed and aren't counted. Orders queued in Redis
+// aren't waited for: they stay there.
+func Drain(ctx context.Context, pool *Pool) int {
+	pool.draining.Store(true)
+
+	ticker := time.NewTicker(drainPoll)
+	defer ticker.Stop()
+	for pool.localQueueLength()+pool.waitingRetries() > 0 {
 		select {
-		case <-p.Ctx.Done():
-			return
-		case order, ok := <-p.Orders:
-			if !ok {
-				return
-			}
+		case <-ctx.Done():
+			abandoned := pool.localQueueLength() + pool.waitingRetries()
+			Close(pool)
+			return abandoned
+		case <-ticker.C:
+		}
+	}
 
-			startTime := time.Now()
-			processedOrder := p.processOrder(order, id, startTime)
+	// The queues are empty and refuse new orders; closing them lets the
+	// workers exit once their current order is done.
+	pool.closeQueues()
+	stopped := make(chan struct{})
+	go func() {
+		pool.Wg.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+	}
+	for pool.results.pending() > 0 && ctx.Err() == nil {
+		select {
+		case <-ctx.Done():
+		case <-ticker.C:
+		}
+	}
+	Close(pool)
+	return 0
+}
 
-			// Send result to results channel
-			select {
-			case p.Results <- processedOrder:
-			case <-p.Ctx.Done():
-				return
-			}
+func (p *Pool) closeQueues() {
+	p.queuesDone.Do(func() {
+		for _, pl := range p.pipelines {
+			pl.orders.close()
+		}
+	})
+}
+
+// Submit routes the order to its pipeline and queues it without blocking.
+// It fails with ErrQueueFull, ErrDraining, ErrWouldMissDeadline,
+// orderstore.ErrExists if the order's ID has a record already, or if the
+// record can't be written.
+func (p *Pool) Submit(order models.Order) error {
+	return p.SubmitContext(context.Background(), order)
+}
 
-			// Update statistics
-			atomic.AddInt64(&p.Processed, 1)
-			if processedOrder.Success {
-				atomic.AddInt64(&p.SuccessCount, 1)
-			} else {
-				atomic.AddInt64(&p.ErrorCount, 1)
+// SubmitContext is Submit for an order submitted in the trace of ctx,
+// which its wait in the queue and its processing join.
+func (p *Pool) SubmitContext(ctx context.Context, order models.Order) error {
+	if p.draining.Load() {
+		return ErrDraining
+	}
+	pl := p.route(order)
+	now := time.Now()
+	if pl.evict && pl.doomed(order, pl.orders.len(), now) {
+		pl.evicted.Add(1)
+		return ErrWouldMissDeadline
+	}
+	if !pl.admit(order, now) {
+		return ErrNotAdmitted
+	}
+	// The record is written first, so an order is never queued without
+	// one and a worker that pops it right away finds it. A crash before
+	// the push leaves a queued record, which the next start queues. Put
+	// refuses an ID that has a record, so the record forgotten when the
+	// queue is full is always the one written here.
+	if err := p.Orders.Put(order, orderstore.Queued); err != nil {
+		return err
+	}
+	p.traceQueued(ctx, pl, order)
+	if !pl.orders.push(order) {
+		p.traceDropped(order.ID, "queue full")
+		p.Orders.Forget(order.ID)
+		return ErrQueueFull
+	}
+	return nil
+}
+
+func (p *Pool) route(order models.Order) *pipeline {
+	pl := p.pipelines[0]
+routes:
+	for _, r := range p.routes {
+		if r.matches(order) {
+			for _, target := range p.pipelines {
+				if target.name == r.Pipeline {
+					pl = target
+					break routes
+				}
 			}
-			atomic.AddInt64(&p.TotalTime, processedOrder.ProcessingTime)
 		}
 	}
+	if pl.canary != nil && pl.canary.takes(order.ID) {
+		return pl.canary.target
+	}
+	return pl
+}
+
+// worker processes orders of pl until ctx is done. id is unique across
+// the pool, index is the worker's position within pl. A panic outside
+// the steps, which recover their own, stops the worker: the order it
+// claimed fails with CodePanic and it reports having panicked, so it is
+// started again.
+func (p *Pool) worker(ctx context.Context, id, index int, pl *pipeline) (panicked bool) {
+	ws := p.workerStates[id]
+	defer ws.set(WorkerStopped, models.Order{})
+	var order models.Order
+	var startTime time.Time
+	popped, claimed := false, false // order is still to be marked done, or finished
+	defer func() {
+		v := recover()
+		if v == nil {
+			return
+		}
+		panicked = true
+		log.Printf("💥 Worker %d panicked: %v\n%s", id, v, debug.Stack())
+		if popped {
+			pl.orders.done(index, order)
+		}
+		if !claimed {
+			atomic.AddInt64(&p.Panics, 1)
+			pl.panics.Add(1)
+			return
+		}
+		processedOrder := models.ProcessedOrder{
+			Order:          order,
+			ProcessedAt:    time.Now(),
+			ProcessingTime: time.Since(startTime).Milliseconds(),
+			WorkerID:       id,
+			Pipeline:       pl.name,
+			Cost:           &models.Cost{},
+		}
+		if !order.CreatedAt.IsZero() {
+			processedOrder.QueueWaitTime = startTime.Sub(order.CreatedAt).Milliseconds()
+			processedOrder.EndToEndTime = time.Since(order.CreatedAt).Milliseconds()
+		}
+		fail(&processedOrder, "", models.NewValidationError(models.CodePanic))
+		p.forgetAttempts(order.ID)
+		p.deliver(ws, pl, order, processedOrder)
+	}()
+	for {
+		ws.set(WorkerIdle, models.Order{})
+		var ok bool
+		order, ok = pl.orders.pop(ctx, index)
+		if !ok {
+			return false
+		}
+		popped = true
+
+		if !p.claim(order.ID) {
+			pl.orders.done(index, order) // cancelled while queued
+			popped = false
+			p.forgetAttempts(order.ID)
+			p.traceDropped(order.ID, "cancelled")
+			continue
+		}
+		claimed = true
+		traced := p.tracePopped(order.ID)
+		ws.set(WorkerProcessing, order)
+		p.Orders.SetState(order.ID, orderstore.Processing)
+		startTime = time.Now()
+		if pl.admission != nil && !order.CreatedAt.IsZero() {
+			held := time.Duration(order.HeldMs) * time.Millisecond
+			pl.admission.Dequeued(startTime.Sub(order.CreatedAt)-held, startTime)
+		}
+		processedOrder, err := p.processOrder(traced, order, id, pl, startTime)
+		pl.orders.done(index, order)
+		popped = false
+		pl.observeService(time.Since(startTime))
+		if p.retry(pl, order, &processedOrder, err) {
+			p.traceQueued(traced, pl, order)
+			p.unclaim(order.ID)
+			claimed = false
+			continue
+		}
+		claimed = false
+		if !p.deliver(ws, pl, order, processedOrder) {
+			return false
+		}
+	}
+}
+
+// deliver finishes the record of an order a worker claimed, sends its
+// result and counts it. It reports false once the pool is closed.
+func (p *Pool) deliver(ws *workerState, pl *pipeline, order models.Order, processedOrder models.ProcessedOrder) bool {
+	p.Orders.Finish(processedOrder)
+	p.unclaim(order.ID)
+
+	// Send result to results channel
+	ws.set(WorkerSending, order)
+	if !p.results.send(p.Ctx, processedOrder) {
+		return false
+	}
+	ws.finished(processedOrder)
+
+	// Update statistics
+	atomic.AddInt64(&p.Processed, 1)
+	pl.processed.Add(1)
+	if processedOrder.Success {
+		atomic.AddInt64(&p.SuccessCount, 1)
+	} else {
+		atomic.AddInt64(&p.ErrorCount, 1)
+		pl.errors.Add(1)
+		switch processedOrder.ErrorCode {
+		case models.CodeTimeout:
+			atomic.AddInt64(&p.Timeouts, 1)
+			pl.timeouts.Add(1)
+		case models.CodePanic:
+			atomic.AddInt64(&p.Panics, 1)
+			pl.panics.Add(1)
+		}
+	}
+	if pl.canaryOf != nil {
+		pl.canaryOf.check()
+	}
+	atomic.AddInt64(&p.TotalTime, processedOrder.ProcessingTime)
+	atomic.AddInt64(&p.TotalE2E, processedOrder.EndToEndTime)
+	atomic.AddInt64(&p.TotalWait, processedOrder.QueueWaitTime)
+	p.countTags(order.Tags)
+	p.countClasses(order, processedOrder)
+	p.countDistinct(order)
+	p.countTop(processedOrder)
+	p.countCost(processedOrder)
+	return true
 }
 
-func (p *Pool) processOrder(order models.Order, workerID int, startTime time.Time) models.ProcessedOrder {
+// processOrder runs the pipeline on order, in a span of the trace of ctx,
+// and returns the result with the error that failed it, if any.
+func (p *Pool) processOrder(ctx context.Context, order models.Order, workerID int, pl *pipeline, startTime time.Time) (models.ProcessedOrder, error) {
 	processedOrder := models.ProcessedOrder{
 		Order:       order,
 		ProcessedAt: time.Now(),
 		WorkerID:    workerID,
+		Pipeline:    pl.name,
 		Success:     true,
 		Result:      "Order processed successfully",
 	}
 
-	// Simulate order processing logic
-	time.Sleep(time.Duration(order.Priority) * 10 * time.Millisecond) // Priority-based processing time
+	// Steps aren't cancelled with the pool so in-flight charges complete.
+	// Each order is a trace task, so execution traces group its steps.
+	ctx, span := traceProcessing(ctx, pl, order, workerID, p.attempt(order.ID))
+	defer span.End()
+	var usage outbound.Usage
+	ctx, task := trace.NewTask(outbound.WithUsage(ctx, &usage), "order")
+	trace.Log(ctx, "order_id", order.ID)
+	trace.Log(ctx, "pipeline", pl.name)
+	trace.Log(ctx, "worker", strconv.Itoa(workerID))
+	var cpu time.Duration
+	var err error
+	if pl.timeout > 0 {
+		cpu, err = runWithTimeout(ctx, pl, &processedOrder, p.workerStates[workerID])
+	} else {
+		cpu, err = runPinned(ctx, pl, &processedOrder, p.workerStates[workerID].setStep)
+	}
+	task.End()
+	if err != nil {
+		tracing.Fail(span, err)
+	}
 
-	// Business logic validation and processing
-	if err := p.validateOrderForProcessing(order); err != nil {
-		processedOrder.Success = false
-		processedOrder.Error = err.Error()
-		processedOrder.Result = "Order processing failed"
+	processedOrder.Cost = &models.Cost{
+		CPUMicros:     cpu.Microseconds(),
+		ExternalCalls: usage.Calls.Load(),
+		Retries:       usage.Retries.Load(),
 	}
 
-	// Simulate additional processing steps
-	if processedOrder.Success {
-		processedOrder = p.applyBusinessRules(processedOrder)
+	if processedOrder.Order.Status != order.Status {
+		processedOrder.PreviousStatus = order.Status
 	}
 
 	// Calculate processing time
 	processingTime := time.Since(startTime)
 	processedOrder.ProcessingTime = processingTime.Milliseconds()
 
-	return processedOrder
-}
-
-func (p *Pool) validateOrderForProcessing(order models.Order) error {
-	// Additional business validation
-	if order.Amount > 10000 {
-		return &models.ValidationError{Message: "order amount exceeds limit"}
+	// End-to-end latency and queue wait are measured from order acceptance
+	if !order.CreatedAt.IsZero() {
+		processedOrder.QueueWaitTime = startTime.Sub(order.CreatedAt).Milliseconds()
+		processedOrder.EndToEndTime = time.Since(order.CreatedAt).Milliseconds()
 	}
 
-	if len(order.Items) > 50 {
-		return &models.ValidationError{Message: "too many items in order"}
-	}
+	return processedOrder, err
+}
 
-	return nil
+// runPinned runs pl's steps on a pinned thread, so its CPU time belongs
+// to this order alone, and returns that time, or zero where it can't be
+// measured.
+func runPinned(ctx context.Context, pl *pipeline, processedOrder *models.ProcessedOrder, onStep func(string)) (time.Duration, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	cpuStart, cpuOK := threadCPUTime()
+	err := pl.run(ctx, processedOrder, onStep)
+	cpuEnd, _ := threadCPUTime()
+	if !cpuOK {
+		return 0, err
+	}
+	return cpuEnd - cpuStart, err
 }
 
-func (p *Pool) applyBusinessRules(processedOrder models.ProcessedOrder) models.ProcessedOrder {
-	order := &processedOrder.Order
+// runWithTimeout runs pl's steps on their own goroutine and gives up on
+// them after pl.timeout, failing the order with CodeTimeout. Steps that
+// ignore their cancelled context finish on a copy of the order, and what
+// they do to it is dropped.
+func runWithTimeout(ctx context.Context, pl *pipeline, processedOrder *models.ProcessedOrder, ws *workerState) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, pl.timeout)
+	defer cancel()
 
-	// Apply business rules based on order characteristics
-	switch {
-	case order.Amount > 1000:
-		order.Status = "priority_processing"
-		processedOrder.Result = "Order marked for priority processing"
-	case order.Priority == 1:
-		order.Status = "expedited"
-		processedOrder.Result = "Order expedited due to high priority"
-	default:
-		order.Status = "processing"
-		processedOrder.Result = "Order processing completed"
+	var mu sync.Mutex
+	step, abandoned := "", false
+	onStep := func(name string) {
+		mu.Lock()
+		defer mu.Unlock()
+		if !abandoned {
+			step = name
+			ws.setStep(name)
+		}
 	}
+	type outcome struct {
+		order models.ProcessedOrder
+		cpu   time.Duration
+		err   error
+	}
+	done := make(chan outcome, 1)
+	work := *processedOrder
+	go func() {
+		cpu, err := runPinned(ctx, pl, &work, onStep)
+		done <- outcome{work, cpu, err}
+	}()
 
-	return processedOrder
+	select {
+	case out := <-done:
+		*processedOrder = out.order
+		if out.err == nil || !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return out.cpu, out.err
+		}
+		// The step gave up when the timeout cancelled it.
+		mu.Lock()
+		name := step
+		mu.Unlock()
+		err := models.NewValidationError(models.CodeTimeout, pl.timeout.String(), name)
+		fail(processedOrder, name, err)
+		return out.cpu, err
+	case <-ctx.Done():
+		mu.Lock()
+		abandoned = true
+		name := step
+		mu.Unlock()
+		log.Printf("⏱️ Order %s timed out after %s in step %s", processedOrder.Order.ID, pl.timeout, name)
+		err := models.NewValidationError(models.CodeTimeout, pl.timeout.String(), name)
+		fail(processedOrder, name, err)
+		return 0, err
+	}
 }
 
 func (p *Pool) Stats() models.ProcessingStats {
@@ -153,31 +599,491 @@ func (p *Pool) Stats() models.ProcessingStats {
 	success := atomic.LoadInt64(&p.SuccessCount)
 	error := atomic.LoadInt64(&p.ErrorCount)
 	totalTime := atomic.LoadInt64(&p.TotalTime)
+	totalE2E := atomic.LoadInt64(&p.TotalE2E)
+	totalWait := atomic.LoadInt64(&p.TotalWait)
 
-	var avgTime float64
+	var avgTime, avgE2E, avgWait float64
 	if processed > 0 {
 		avgTime = float64(totalTime) / float64(processed)
+		avgE2E = float64(totalE2E) / float64(processed)
+		avgWait = float64(totalWait) / float64(processed)
 	}
 
 	uptime := int64(time.Since(p.StartTime).Seconds())
 
+	byPipeline := make(map[string]models.PipelineStats, len(p.pipelines))
+	for _, pl := range p.pipelines {
+		ps := models.PipelineStats{
+			Workers:     int(pl.running.Load()),
+			QueueLength: pl.orders.len(),
+			Processed:   int(pl.processed.Load()),
+			Errors:      int(pl.errors.Load()),
+			Retries:     int(pl.retries.Load()),
+			Timeouts:    int(pl.timeouts.Load()),
+			Panics:      int(pl.panics.Load()),
+			Evicted:     int(pl.evicted.Load()),
+			Admission:   pl.admissionStats(),
+		}
+		if pl.scaler != nil {
+			ps.Autoscale = pl.scaler.stats()
+		}
+		orders := pl.orders
+		if sq, ok := orders.(*spillQueue); ok {
+			ps.Spilled = sq.disk.Len()
+			orders = sq.queue
+		}
+		if sq, ok := orders.(*shardQueue); ok {
+			steals, stolen, lengths := sq.stats()
+			ps.Steals, ps.StolenOrders, ps.ShardQueueLengths = int(steals), int(stolen), lengths
+		}
+		byPipeline[pl.name] = ps
+	}
+
 	return models.ProcessingStats{
 		TotalProcessed:     int(processed),
 		SuccessCount:       int(success),
 		ErrorCount:         int(error),
 		AverageProcessTime: avgTime,
-		ActiveWorkers:      p.Workers,
-		QueueLength:        len(p.Orders),
+		AverageEndToEnd:    avgE2E,
+		AverageQueueWait:   avgWait,
+		ActiveWorkers:      p.ActiveWorkers(),
+		QueueLength:        p.GetQueueLength(),
+		Held:               p.heldCount(),
+		Retries:            int(atomic.LoadInt64(&p.Retries)),
+		Retrying:           p.waitingRetries(),
+		Timeouts:           int(atomic.LoadInt64(&p.Timeouts)),
+		Panics:             int(atomic.LoadInt64(&p.Panics)),
 		Uptime:             uptime,
+		ByTag:              p.tagStats(),
+		ByPipeline:         byPipeline,
+		ByPriority:         classStats(p, p.byPriority),
+		ByOutcome:          classStats(p, p.byOutcome),
+		Results:            p.results.stats(),
+		UniqueCustomers:    p.customers.Counts(time.Now()),
+		UniqueItems:        p.items.Counts(time.Now()),
+	}
+}
+
+// maxTagSeries caps the "key=value" tags counted for /stats. Without a tag
+// allowlist clients choose them, so once the cap is reached orders with
+// new tags are counted under tagOverflow instead.
+const maxTagSeries = 1000
+
+// tagOverflow has no "=", so it can't clash with a counted tag.
+const tagOverflow = "other"
+
+func (p *Pool) countTags(tags map[string]string) {
+	if len(tags) == 0 {
+		return
+	}
+	p.tagMu.Lock()
+	defer p.tagMu.Unlock()
+	for k, v := range tags {
+		series := k + "=" + v
+		if _, ok := p.tagCount[series]; !ok && len(p.tagCount) >= maxTagSeries {
+			series = tagOverflow
+		}
+		p.tagCount[series]++
+	}
+}
+
+// classCounter counts the processed orders of one priority or outcome.
+type classCounter struct {
+	processed int
+	totalE2E  int64 // milliseconds
+	latencies *sketch.Latencies
+}
+
+// outcome classifies how a processed order ended.
+func outcome(processedOrder models.ProcessedOrder) string {
+	switch {
+	case processedOrder.Success:
+		return models.OutcomeSuccess
+	case processedOrder.ErrorCode == models.CodeTimeout:
+		return models.OutcomeTimeout
+	case processedOrder.ErrorCode != "" && processedOrder.ErrorCode != models.CodePanic:
+		return models.OutcomeValidationFailed
+	}
+	return models.OutcomeDeadLettered
+}
+
+func (p *Pool) countClasses(order models.Order, processedOrder models.ProcessedOrder) {
+	count := func(c *classCounter) *classCounter {
+		if c == nil {
+			c = &classCounter{latencies: sketch.NewLatencies(classSamples)}
+		}
+		c.processed++
+		c.totalE2E += processedOrder.EndToEndTime
+		c.latencies.Add(processedOrder.EndToEndTime)
+		return c
+	}
+	priority, result := lane(order.Priority), outcome(processedOrder)
+	p.classMu.Lock()
+	defer p.classMu.Unlock()
+	p.byPriority[priority] = count(p.byPriority[priority])
+	p.byOutcome[result] = count(p.byOutcome[result])
+}
+
+func classStats[K comparable](p *Pool, counters map[K]*classCounter) map[K]models.ClassStats {
+	p.classMu.Lock()
+	defer p.classMu.Unlock()
+	if len(counters) == 0 {
+		return nil
+	}
+	stats := make(map[K]models.ClassStats, len(counters))
+	for k, c := range counters {
+		ps := c.latencies.Percentiles(50, 95, 99)
+		stats[k] = models.ClassStats{
+			Processed:       c.processed,
+			AverageEndToEnd: float64(c.totalE2E) / float64(c.processed),
+			EndToEnd:        &models.Percentiles{P50: ps[0], P95: ps[1], P99: ps[2]},
+		}
+	}
+	return stats
+}
+
+func (p *Pool) countDistinct(order models.Order) {
+	now := time.Now()
+	p.customers.Add(order.Customer, now)
+	for _, item := range order.Items {
+		p.items.Add(item, now)
+	}
+}
+
+func (p *Pool) countTop(processedOrder models.ProcessedOrder) {
+	now := time.Now()
+	p.topCustomers.Add(processedOrder.Order.Customer, now)
+	for _, item := range processedOrder.Order.Items {
+		p.topItems.Add(item, now)
+	}
+	if !processedOrder.Success {
+		p.topErrors.Add(processedOrder.Error, now)
+	}
+}
+
+// Top returns the k most frequent customers, items and failure reasons for
+// the last 5 minutes and hour, keyed "5m" and "1h".
+func (p *Pool) Top(k int) map[string]models.TopStats {
+	now := time.Now()
+	top := make(map[string]models.TopStats, 2)
+	for name, span := range map[string]time.Duration{"5m": 5 * time.Minute, "1h": time.Hour} {
+		top[name] = models.TopStats{
+			Customers: topEntries(p.topCustomers.Top(k, span, now)),
+			Items:     topEntries(p.topItems.Top(k, span, now)),
+			Errors:    topEntries(p.topErrors.Top(k, span, now)),
+		}
+	}
+	return top
+}
+
+func topEntries(entries []sketch.Entry) []models.TopEntry {
+	out := make([]models.TopEntry, len(entries))
+	for i, e := range entries {
+		out[i] = models.TopEntry(e)
+	}
+	return out
+}
+
+func (p *Pool) countCost(processedOrder models.ProcessedOrder) {
+	cost := *processedOrder.Cost
+	p.costMu.Lock()
+	defer p.costMu.Unlock()
+	p.costTotal.Add(cost)
+	tenant := p.byTenant[processedOrder.Order.Tenant]
+	tenant.Add(cost)
+	p.byTenant[processedOrder.Order.Tenant] = tenant
+	customer := p.byCustomer[processedOrder.Order.Customer]
+	customer.Add(cost)
+	p.byCustomer[processedOrder.Order.Customer] = customer
+}
+
+// Costs returns the processing cost since start per tenant and customer.
+func (p *Pool) Costs() models.CostReport {
+	p.costMu.Lock()
+	defer p.costMu.Unlock()
+	report := models.CostReport{
+		Total:      p.costTotal,
+		ByTenant:   make(map[string]models.CostStats, len(p.byTenant)),
+		ByCustomer: make(map[string]models.CostStats, len(p.byCustomer)),
+	}
+	for k, v := range p.byTenant {
+		report.ByTenant[k] = v
+	}
+	for k, v := range p.byCustomer {
+		report.ByCustomer[k] = v
+	}
+	return report
+}
+
+func (p *Pool) tagStats() map[string]int {
+	p.tagMu.Lock()
+	defer p.tagMu.Unlock()
+	if len(p.tagCount) == 0 {
+		return nil
+	}
+	byTag := make(map[string]int, len(p.tagCount))
+	for k, v := range p.tagCount {
+		byTag[k] = v
 	}
+	return byTag
 }
 
-// GetQueueLength returns the current number of orders in the queue
+// GetQueueLength returns the current number of orders queued across all pipelines
 func (p *Pool) GetQueueLength() int {
-	return len(p.Orders)
+	n := 0
+	for _, pl := range p.pipelines {
+		n += pl.orders.len()
+	}
+	return n
+}
+
+// localQueueLength counts the orders queued in this process. Orders in
+// Redis queues outlive it, for other instances or the next start.
+func (p *Pool) localQueueLength() int {
+	n := 0
+	for _, pl := range p.pipelines {
+		if _, ok := pl.orders.(*redisQueue); !ok {
+			n += pl.orders.len()
+		}
+	}
+	return n
+}
+
+// ErrNotQueued is returned for orders that aren't waiting in a queue, such
+// as processed, in-flight or spilled ones.
+var ErrNotQueued = errors.New("order is not queued")
+
+// QueueSnapshot lists the orders waiting in one pipeline, in pop order.
+// Spilled orders are only counted.
+type QueueSnapshot struct {
+	Pipeline string         `json:"pipeline"`
+	Length   int            `json:"length"`
+	Spilled  int            `json:"spilled,omitempty"`
+	Orders   []models.Order `json:"orders"`
+}
+
+// Queued returns the queued orders of every pipeline, at most limit each.
+func (p *Pool) Queued(limit int) []QueueSnapshot {
+	snapshots := make([]QueueSnapshot, 0, len(p.pipelines))
+	for _, pl := range p.pipelines {
+		snap := QueueSnapshot{Pipeline: pl.name, Length: pl.orders.len(), Orders: []models.Order{}}
+		if sq, ok := pl.orders.(*spillQueue); ok {
+			snap.Spilled = sq.disk.Len()
+		}
+		if q, ok := pl.orders.(inspectable); ok {
+			orders := q.list()
+			snap.Orders = orders[:min(len(orders), limit)]
+		}
+		snapshots = append(snapshots, snap)
+	}
+	return snapshots
+}
+
+// Bump moves a queued order to the front of its pipeline's queue and
+// returns the pipeline.
+func (p *Pool) Bump(id string) (string, error) {
+	for _, pl := range p.pipelines {
+		if q, ok := pl.orders.(inspectable); ok && q.bump(id) {
+			return pl.name, nil
+		}
+	}
+	return "", ErrNotQueued
+}
+
+// Remove takes a queued or held order out of the pool so it is never
+// processed.
+func (p *Pool) Remove(id string) (models.Order, error) {
+	for _, pl := range p.pipelines {
+		if q, ok := pl.orders.(inspectable); ok {
+			if order, ok := q.remove(id); ok {
+				p.Orders.SetState(id, orderstore.Removed)
+				p.traceDropped(id, "removed")
+				return order, nil
+			}
+		}
+	}
+	p.heldMu.Lock()
+	defer p.heldMu.Unlock()
+	if h, ok := p.held[id]; ok {
+		delete(p.held, id)
+		p.Orders.SetState(id, orderstore.Removed)
+		p.traceDropped(id, "removed")
+		return h.Order, nil
+	}
+	return models.Order{}, ErrNotQueued
+}
+
+// SetPriority changes the priority of a queued or held order. A queued
+// order is repositioned among its neighbours; see fifoQueue.setPriority.
+func (p *Pool) SetPriority(id string, priority models.Priority) error {
+	for _, pl := range p.pipelines {
+		if q, ok := pl.orders.(inspectable); ok && q.setPriority(id, priority) {
+			p.Orders.Update(id, func(rec *orderstore.Record) { rec.Order.Priority = priority })
+			return nil
+		}
+	}
+	p.heldMu.Lock()
+	defer p.heldMu.Unlock()
+	if h, ok := p.held[id]; ok {
+		h.Order.Priority = priority
+		p.held[id] = h
+		p.Orders.Update(id, func(rec *orderstore.Record) { rec.Order.Priority = priority })
+		return nil
+	}
+	return ErrNotQueued
+}
+
+// WaitingOrder is an order the pool hasn't started processing.
+type WaitingOrder struct {
+	Pipeline string
+	Held     bool
+	Order    models.Order
+}
+
+// Waiting returns every queued and held order. Spilled orders are left out.
+func (p *Pool) Waiting() []WaitingOrder {
+	var waiting []WaitingOrder
+	for _, pl := range p.pipelines {
+		if q, ok := pl.orders.(inspectable); ok {
+			for _, o := range q.list() {
+				waiting = append(waiting, WaitingOrder{Pipeline: pl.name, Order: o})
+			}
+		}
+	}
+	for _, h := range p.Held() {
+		waiting = append(waiting, WaitingOrder{Pipeline: h.Pipeline, Held: true, Order: h.Order})
+	}
+	return waiting
+}
+
+// ErrNotHeld is returned when releasing an order that isn't held.
+var ErrNotHeld = errors.New("order is not held")
+
+// HeldOrder is an order taken out of its queue until it is released.
+type HeldOrder struct {
+	Pipeline string       `json:"pipeline"`
+	HeldAt   time.Time    `json:"held_at"`
+	Reason   string       `json:"reason,omitempty"`
+	Order    models.Order `json:"order"`
+}
+
+// Hold takes a queued order out of its queue until Release.
+func (p *Pool) Hold(id, reason string) error {
+	for _, pl := range p.pipelines {
+		q, ok := pl.orders.(inspectable)
+		if !ok {
+			continue
+		}
+		if order, ok := q.remove(id); ok {
+			p.heldMu.Lock()
+			p.held[id] = HeldOrder{Pipeline: pl.name, HeldAt: time.Now(), Reason: reason, Order: order}
+			p.heldMu.Unlock()
+			p.Orders.SetState(id, orderstore.Held)
+			return nil
+		}
+	}
+	return ErrNotQueued
+}
+
+// SubmitHeld accepts an order straight into the held orders of its
+// pipeline, e.g. for review, instead of queueing it.
+func (p *Pool) SubmitHeld(order models.Order, reason string) error {
+	if p.draining.Load() {
+		return ErrDraining
+	}
+	if err := p.Orders.Put(order, orderstore.Held); err != nil {
+		return err
+	}
+	p.heldMu.Lock()
+	p.held[order.ID] = HeldOrder{Pipeline: p.route(order).name, HeldAt: time.Now(), Reason: reason, Order: order}
+	p.heldMu.Unlock()
+	return nil
+}
+
+// Release puts a held order back at the front of its pipeline's queue, as
+// it has already waited its turn. It stays held if the queue is full.
+func (p *Pool) Release(id string) error {
+	p.heldMu.Lock()
+	defer p.heldMu.Unlock()
+	h, ok := p.held[id]
+	if !ok {
+		return ErrNotHeld
+	}
+	h.Order.HeldMs += time.Since(h.HeldAt).Milliseconds()
+	p.Orders.Update(id, func(rec *orderstore.Record) { rec.Order, rec.State = h.Order, orderstore.Queued })
+	for _, pl := range p.pipelines {
+		if pl.name != h.Pipeline {
+			continue
+		}
+		if !pl.orders.push(h.Order) {
+			p.Orders.SetState(id, orderstore.Held)
+			return ErrQueueFull
+		}
+		if q, ok := pl.orders.(inspectable); ok {
+			q.bump(id)
+		}
+	}
+	delete(p.held, id)
+	return nil
+}
+
+// Held returns the held orders, longest held first.
+func (p *Pool) Held() []HeldOrder {
+	p.heldMu.Lock()
+	defer p.heldMu.Unlock()
+	held := make([]HeldOrder, 0, len(p.held))
+	for _, h := range p.held {
+		held = append(held, h)
+	}
+	sort.Slice(held, func(i, j int) bool { return held[i].HeldAt.Before(held[j].HeldAt) })
+	return held
+}
+
+func (p *Pool) heldCount() int {
+	p.heldMu.Lock()
+	defer p.heldMu.Unlock()
+	return len(p.held)
+}
+
+// QueueCapacity returns how many orders all pipelines can queue together.
+func (p *Pool) QueueCapacity() int {
+	n := 0
+	for _, pl := range p.pipelines {
+		n += pl.orders.cap()
+	}
+	return n
+}
+
+// DrainTime estimates how long the workers need for n queued orders at the
+// average processing time so far.
+func (p *Pool) DrainTime(n int) time.Duration {
+	processed := atomic.LoadInt64(&p.Processed)
+	workers := p.ActiveWorkers()
+	if processed == 0 || workers == 0 {
+		return 0
+	}
+	avg := time.Duration(atomic.LoadInt64(&p.TotalTime)) * time.Millisecond / time.Duration(processed)
+	return avg * time.Duration(n) / time.Duration(workers)
+}
+
+// ActiveWorkers counts the workers running now, across pipelines.
+func (p *Pool) ActiveWorkers() int {
+	n := 0
+	for _, pl := range p.pipelines {
+		n += int(pl.running.Load())
+	}
+	return n
 }
 
 // IsHealthy checks if the pool is in a healthy state
 func (p *Pool) IsHealthy() bool {
-	return p.Ctx.Err() == nil && len(p.Orders) < cap(p.Orders)
+	if p.Ctx.Err() != nil {
+		return false
+	}
+	for _, pl := range p.pipelines {
+		if pl.orders.len() >= pl.orders.cap() {
+			return false
+		}
+	}
+	return true
 }
@@ -0,0 +1,216 @@
+package processor
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/pkg/models"
+)
+
+// DefaultStarveAfter is how long a lower-priority order waits at most
+// before it is served ahead of higher-priority ones.
+const DefaultStarveAfter = 5 * time.Second
+
+// bumpedLane holds orders moved to the front by operators, ahead of every
+// priority. Lanes 1 to 3 hold the orders of that priority.
+const bumpedLane = 0
+
+type queued struct {
+	order models.Order
+	at    time.Time
+}
+
+// priorityQueue is shared by all workers of a pipeline and pops higher
+// priority orders first, in FIFO order within a priority. An order of
+// lower priority whose wait exceeds starveAfter is popped next, oldest
+// first, so a steady stream of high-priority orders can't starve it.
+type priorityQueue struct {
+	capacity    int
+	starveAfter time.Duration
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	lanes  [4][]queued
+	n      int
+	closed bool
+}
+
+func newPriorityQueue(capacity int, starveAfter time.Duration) *priorityQueue {
+	if starveAfter <= 0 {
+		starveAfter = DefaultStarveAfter
+	}
+	q := &priorityQueue{capacity: capacity, starveAfter: starveAfter}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+// lane is where orders of priority wait; unknown priorities wait as
+// medium.
+func lane(priority models.Priority) models.Priority {
+	if !priority.Valid() {
+		return models.PriorityMedium
+	}
+	return priority
+}
+
+func (q *priorityQueue) push(order models.Order) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed || q.n >= q.capacity {
+		return false
+	}
+	l := lane(order.Priority)
+	q.lanes[l] = append(q.lanes[l], queued{order: order, at: time.Now()})
+	q.n++
+	q.cond.Signal()
+	return true
+}
+
+func (q *priorityQueue) pop(ctx context.Context, _ int) (models.Order, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for q.n == 0 {
+		if q.closed || ctx.Err() != nil {
+			return models.Order{}, false
+		}
+		q.cond.Wait()
+	}
+	if ctx.Err() != nil {
+		return models.Order{}, false
+	}
+	var heads [4]int
+	l := q.next(&heads, time.Now())
+	order := q.lanes[l][0].order
+	q.lanes[l][0] = queued{}
+	q.lanes[l] = q.lanes[l][1:]
+	q.n--
+	return order, true
+}
+
+// next returns the lane to pop from when each lane's first heads[lane]
+// orders are already taken. It must be called with q.mu held and at
+// least one order left.
+func (q *priorityQueue) next(heads *[4]int, now time.Time) int {
+	if heads[bumpedLane] < len(q.lanes[bumpedLane]) {
+		return bumpedLane
+	}
+	starved, first := -1, -1
+	for l := 1; l < len(q.lanes); l++ {
+		if heads[l] >= len(q.lanes[l]) {
+			continue
+		}
+		if first < 0 {
+			first = l
+		}
+		at := q.lanes[l][heads[l]].at
+		if now.Sub(at) > q.starveAfter && (starved < 0 || at.Before(q.lanes[starved][heads[starved]].at)) {
+			starved = l
+		}
+	}
+	if starved >= 0 {
+		return starved
+	}
+	return first
+}
+
+func (q *priorityQueue) done(int, models.Order) {}
+
+func (q *priorityQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.n
+}
+
+func (q *priorityQueue) cap() int { return q.capacity }
+
+// close stops pops once the queue is empty, like closing a channel.
+func (q *priorityQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	q.cond.Broadcast()
+}
+
+func (q *priorityQueue) interrupt() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.cond.Broadcast()
+}
+
+// list returns the orders in the order they would be popped now.
+func (q *priorityQueue) list() []models.Order {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	orders := make([]models.Order, 0, q.n)
+	var heads [4]int
+	now := time.Now()
+	for range q.n {
+		l := q.next(&heads, now)
+		orders = append(orders, q.lanes[l][heads[l]].order)
+		heads[l]++
+	}
+	return orders
+}
+
+// find must be called with q.mu held.
+func (q *priorityQueue) find(id string) (int, int) {
+	for l, orders := range q.lanes {
+		if i := slices.IndexFunc(orders, func(e queued) bool { return e.order.ID == id }); i >= 0 {
+			return l, i
+		}
+	}
+	return -1, -1
+}
+
+// take must be called with q.mu held.
+func (q *priorityQueue) take(l, i int) queued {
+	e := q.lanes[l][i]
+	q.lanes[l] = slices.Delete(q.lanes[l], i, i+1)
+	return e
+}
+
+func (q *priorityQueue) bump(id string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	l, i := q.find(id)
+	if l < 0 {
+		return false
+	}
+	e := q.take(l, i)
+	q.lanes[bumpedLane] = slices.Insert(q.lanes[bumpedLane], 0, e)
+	return true
+}
+
+func (q *priorityQueue) remove(id string) (models.Order, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	l, i := q.find(id)
+	if l < 0 {
+		return models.Order{}, false
+	}
+	q.n--
+	return q.take(l, i).order, true
+}
+
+// setPriority moves the order to its new priority's lane, where it keeps
+// its place by waiting time. Bumped orders stay in front.
+func (q *priorityQueue) setPriority(id string, priority models.Priority) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	l, i := q.find(id)
+	if l < 0 {
+		return false
+	}
+	if l == bumpedLane {
+		q.lanes[l][i].order.Priority = priority
+		return true
+	}
+	e := q.take(l, i)
+	e.order.Priority = priority
+	to := lane(priority)
+	j, _ := slices.BinarySearchFunc(q.lanes[to], e.at, func(x queued, at time.Time) int { return x.at.Compare(at) })
+	q.lanes[to] = slices.Insert(q.lanes[to], j, e)
+	return true
+}
@@ -0,0 +1,171 @@
+package processor
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/pkg/models"
+)
+
+// queue holds a pipeline's pending orders. worker is the index of the
+// calling worker within its pipeline.
+type queue interface {
+	// push adds an order without blocking and reports whether there was room.
+	push(order models.Order) bool
+	// pop blocks until an order is available for worker, or returns false
+	// once ctx is done or the queue is closed.
+	pop(ctx context.Context, worker int) (models.Order, bool)
+	// done tells the queue that worker finished order.
+	done(worker int, order models.Order)
+	len() int
+	cap() int
+	close()
+}
+
+// interrupter is implemented by queues whose pop waits without watching
+// its context. interrupt wakes the waiting workers to check it.
+type interrupter interface {
+	interrupt()
+}
+
+// inspectable is implemented by queues whose queued orders operators can
+// see and rearrange.
+type inspectable interface {
+	// list returns the queued orders in the order they will be popped.
+	list() []models.Order
+	// bump moves a queued order to the front.
+	bump(id string) bool
+	// remove takes a queued order out of the queue.
+	remove(id string) (models.Order, bool)
+	// setPriority changes a queued order's priority and repositions it
+	// where the queue's ordering allows.
+	setPriority(id string, priority models.Priority) bool
+}
+
+// persistent is implemented by queues that keep orders across restarts.
+type persistent interface {
+	// each calls fn with every order the queue holds, including those
+	// workers are processing, which are inFlight.
+	each(fn func(order models.Order, inFlight bool)) error
+}
+
+// fifoQueue is a plain FIFO shared by all workers of a pipeline.
+type fifoQueue struct {
+	capacity int
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	orders []models.Order
+	closed bool
+}
+
+func newFIFOQueue(capacity int) *fifoQueue {
+	q := &fifoQueue{capacity: capacity}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+func (q *fifoQueue) push(order models.Order) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed || len(q.orders) >= q.capacity {
+		return false
+	}
+	q.orders = append(q.orders, order)
+	q.cond.Signal()
+	return true
+}
+
+func (q *fifoQueue) pop(ctx context.Context, _ int) (models.Order, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.orders) == 0 {
+		if q.closed || ctx.Err() != nil {
+			return models.Order{}, false
+		}
+		q.cond.Wait()
+	}
+	if ctx.Err() != nil {
+		return models.Order{}, false
+	}
+	order := q.orders[0]
+	q.orders[0] = models.Order{}
+	q.orders = q.orders[1:]
+	return order, true
+}
+
+func (q *fifoQueue) done(int, models.Order) {}
+
+func (q *fifoQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.orders)
+}
+
+func (q *fifoQueue) cap() int { return q.capacity }
+
+// close stops pops once the queue is empty, like closing a channel.
+func (q *fifoQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	q.cond.Broadcast()
+}
+
+func (q *fifoQueue) interrupt() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.cond.Broadcast()
+}
+
+func (q *fifoQueue) list() []models.Order {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return slices.Clone(q.orders)
+}
+
+func (q *fifoQueue) bump(id string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	i := slices.IndexFunc(q.orders, func(o models.Order) bool { return o.ID == id })
+	if i < 0 {
+		return false
+	}
+	order := q.orders[i]
+	copy(q.orders[1:i+1], q.orders[:i])
+	q.orders[0] = order
+	return true
+}
+
+func (q *fifoQueue) remove(id string) (models.Order, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	i := slices.IndexFunc(q.orders, func(o models.Order) bool { return o.ID == id })
+	if i < 0 {
+		return models.Order{}, false
+	}
+	order := q.orders[i]
+	q.orders = slices.Delete(q.orders, i, i+1)
+	return order, true
+}
+
+// setPriority moves the order ahead of the lower-priority orders directly
+// in front of it, or behind the higher-priority ones directly after it.
+// Orders of equal priority keep their relative order.
+func (q *fifoQueue) setPriority(id string, priority models.Priority) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	i := slices.IndexFunc(q.orders, func(o models.Order) bool { return o.ID == id })
+	if i < 0 {
+		return false
+	}
+	q.orders[i].Priority = priority
+	for ; i > 0 && q.orders[i-1].Priority > priority; i-- {
+		q.orders[i-1], q.orders[i] = q.orders[i], q.orders[i-1]
+	}
+	for ; i+1 < len(q.orders) && q.orders[i+1].Priority < priority; i++ {
+		q.orders[i+1], q.orders[i] = q.orders[i], q.orders[i+1]
+	}
+	return true
+}
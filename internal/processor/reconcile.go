@@ -0,0 +1,93 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/orderstore"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/pkg/models"
+)
+
+// reconcile repairs the records of orders a previous run left unfinished.
+// Those orders were lost with the in-memory queues unless their queue
+// keeps them, on disk or in Redis: queued and in-flight orders are queued
+// again, so an order that was being processed during a crash is processed
+// again, and held orders are held again. Orders a persistent queue still
+// holds that were cancelled are registered as cancelled again. It must
+// run before the workers start.
+func (p *Pool) reconcile(ctx context.Context) error {
+	// Persisted orders map to whether a worker, possibly of another
+	// instance sharing a Redis queue, is processing them.
+	persisted := make(map[string]bool)
+	for _, pl := range p.pipelines {
+		q, ok := pl.orders.(persistent)
+		if !ok {
+			continue
+		}
+		err := q.each(func(order models.Order, inFlight bool) {
+			persisted[order.ID] = inFlight
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// A repository shared with other instances only gives this one its
+	// own records, and those of instances that stopped; the rest are
+	// being processed elsewhere.
+	query := orderstore.Query{States: append([]orderstore.State{orderstore.Cancelled}, orderstore.Unfinished...)}
+	var records []orderstore.Record
+	if shared, ok := p.Orders.(orderstore.Shared); ok {
+		adopted, err := shared.Adopt(ctx)
+		if err != nil {
+			return fmt.Errorf("adopt orders of stopped instances: %w", err)
+		}
+		if adopted > 0 {
+			log.Printf("orders: adopted %d unfinished orders of stopped instances", adopted)
+		}
+		records = shared.Owned(query)
+	} else {
+		records, _ = p.Orders.List(query)
+	}
+	var requeued, held, lost int
+	// Oldest first, so they are queued in the order they were accepted.
+	for _, rec := range slices.Backward(records) {
+		order := rec.Order
+		inFlight, isPersisted := persisted[order.ID]
+		switch {
+		case rec.State == orderstore.Cancelled:
+			if isPersisted {
+				p.cancelled[order.ID] = true
+			}
+		case inFlight:
+			// Left to the instance processing it.
+		case isPersisted:
+			if rec.State != orderstore.Queued {
+				p.Orders.SetState(order.ID, orderstore.Queued)
+			}
+		case rec.State == orderstore.Held:
+			p.held[order.ID] = HeldOrder{Pipeline: p.route(order).name, HeldAt: rec.UpdatedAt, Reason: "held before restart", Order: order}
+			held++
+		case p.route(order).orders.push(order):
+			if rec.State != orderstore.Queued {
+				p.Orders.SetState(order.ID, orderstore.Queued)
+			}
+			requeued++
+		default:
+			p.Orders.Finish(models.ProcessedOrder{
+				Order:       order,
+				ProcessedAt: time.Now(),
+				Error:       "not queued again after a restart: " + ErrQueueFull.Error(),
+				ErrorCode:   models.CodeServiceUnavailable,
+			})
+			lost++
+		}
+	}
+	if requeued+held+lost > 0 {
+		log.Printf("orders: reconciled unfinished orders: %d queued again, %d held again, %d failed with full queues", requeued, held, lost)
+	}
+	return nil
+}
@@ -0,0 +1,350 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/pkg/models"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/redisq"
+)
+
+// redisPopWait is how long a worker blocks on Redis before checking
+// whether the pool was closed.
+const redisPopWait = time.Second
+
+// redisTimeout bounds the queue's other commands.
+const redisTimeout = 5 * time.Second
+
+// pushScript pushes ARGV[2] unless the list holds ARGV[1] entries.
+const pushScript = `
+if redis.call('LLEN', KEYS[1]) >= tonumber(ARGV[1]) then return 0 end
+redis.call('LPUSH', KEYS[1], ARGV[2])
+return 1`
+
+// bumpScript moves ARGV[1] to the popping end of the list.
+const bumpScript = `
+if redis.call('LREM', KEYS[1], 1, ARGV[1]) == 0 then return 0 end
+redis.call('RPUSH', KEYS[1], ARGV[1])
+return 1`
+
+// replaceScript replaces ARGV[1] with ARGV[2] where it is in the list.
+const replaceScript = `
+local items = redis.call('LRANGE', KEYS[1], 0, -1)
+for i, v in ipairs(items) do
+	if v == ARGV[1] then
+		redis.call('LSET', KEYS[1], i - 1, ARGV[2])
+		return 1
+	end
+end
+return 0`
+
+// requeueScript moves every entry of KEYS[1] to the popping end of
+// KEYS[2].
+const requeueScript = `
+local n = 0
+local v = redis.call('RPOP', KEYS[1])
+while v do
+	redis.call('RPUSH', KEYS[2], v)
+	n = n + 1
+	v = redis.call('RPOP', KEYS[1])
+end
+return n`
+
+// redisQueue keeps a pipeline's orders in a Redis list that every
+// instance using the same server and pipeline name pushes to and pops
+// from, in FIFO order. A worker moves the order it pops to its own
+// in-flight list and removes it once done, so the orders an instance was
+// processing when it crashed are queued again when it starts with the
+// same node name.
+type redisQueue struct {
+	client   *redisq.Client
+	key      string // pushed on the left, popped on the right
+	inFlight string // set of the in-flight lists of every instance
+	node     string
+	capacity int
+	closed   atomic.Bool
+
+	mu     sync.Mutex
+	popped []string // the payload each worker is processing
+}
+
+func newRedisQueue(client *redisq.Client, pipeline, node string, workers, capacity int) (*redisQueue, error) {
+	q := &redisQueue{
+		client:   client,
+		key:      client.Key("pipeline", pipeline, "queue"),
+		inFlight: client.Key("pipeline", pipeline, "inflight"),
+		node:     node,
+		capacity: capacity,
+		popped:   make([]string, workers),
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// Queue again what this node was processing when it stopped, including
+	// the lists of workers it no longer has.
+	lists, err := redisq.Strings(client.Do(ctx, "SMEMBERS", q.inFlight))
+	if err != nil {
+		return nil, err
+	}
+	requeued := int64(0)
+	for _, list := range lists {
+		if !strings.HasPrefix(list, q.inFlight+":"+node+":") {
+			continue
+		}
+		n, err := redisq.Int(client.Eval(ctx, requeueScript, []string{list, q.key}))
+		if err != nil {
+			return nil, err
+		}
+		requeued += n
+		if _, err := client.Do(ctx, "SREM", q.inFlight, list); err != nil {
+			return nil, err
+		}
+	}
+	if requeued > 0 {
+		log.Printf("redis queue %s: queued %d in-flight orders again", pipeline, requeued)
+	}
+	for i := range workers {
+		if _, err := client.Do(ctx, "SADD", q.inFlight, q.worker(i)); err != nil {
+			return nil, err
+		}
+	}
+	return q, nil
+}
+
+// worker is the in-flight list of one of this node's workers.
+func (q *redisQueue) worker(i int) string {
+	return q.inFlight + ":" + q.node + ":" + strconv.Itoa(i)
+}
+
+func (q *redisQueue) push(order models.Order) bool {
+	if q.closed.Load() {
+		return false
+	}
+	data, err := json.Marshal(order)
+	if err != nil {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	pushed, err := redisq.Int(q.client.Eval(ctx, pushScript, []string{q.key}, strconv.Itoa(q.capacity), string(data)))
+	if err != nil {
+		log.Printf("redis queue: %v", err)
+		return false
+	}
+	return pushed == 1
+}
+
+// pop stops right away once the queue is closed: the orders left in Redis
+// are popped by other instances, or by this one after a restart.
+func (q *redisQueue) pop(ctx context.Context, worker int) (models.Order, bool) {
+	for !q.closed.Load() && ctx.Err() == nil {
+		popCtx, cancel := context.WithTimeout(ctx, redisPopWait+redisTimeout)
+		data, ok, err := redisq.String(q.client.Do(popCtx, "BLMOVE", q.key, q.worker(worker), "RIGHT", "LEFT",
+			strconv.FormatFloat(redisPopWait.Seconds(), 'f', -1, 64)))
+		cancel()
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			log.Printf("redis queue: %v", err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(redisPopWait):
+			}
+			continue
+		}
+		if !ok {
+			continue
+		}
+		var order models.Order
+		if err := json.Unmarshal([]byte(data), &order); err != nil {
+			log.Printf("redis queue: dropping unreadable order: %v", err)
+			q.forget(worker, data)
+			continue
+		}
+		q.mu.Lock()
+		q.popped[worker] = data
+		q.mu.Unlock()
+		return order, true
+	}
+	return models.Order{}, false
+}
+
+func (q *redisQueue) done(worker int, _ models.Order) {
+	q.mu.Lock()
+	data := q.popped[worker]
+	q.popped[worker] = ""
+	q.mu.Unlock()
+	q.forget(worker, data)
+}
+
+// forget takes data off worker's in-flight list.
+func (q *redisQueue) forget(worker int, data string) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	if _, err := q.client.Do(ctx, "LREM", q.worker(worker), "1", data); err != nil {
+		log.Printf("redis queue: %v", err)
+	}
+}
+
+// len is the length of the shared queue, across instances.
+func (q *redisQueue) len() int {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	n, err := redisq.Int(q.client.Do(ctx, "LLEN", q.key))
+	if err != nil {
+		return 0
+	}
+	return int(n)
+}
+
+func (q *redisQueue) cap() int { return q.capacity }
+
+func (q *redisQueue) close() { q.closed.Store(true) }
+
+// entries returns the queued payloads in pop order.
+func (q *redisQueue) entries() ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	entries, err := redisq.Strings(q.client.Do(ctx, "LRANGE", q.key, "0", "-1"))
+	slices.Reverse(entries)
+	return entries, err
+}
+
+// find returns the payload and order of a queued order.
+func (q *redisQueue) find(id string) (string, models.Order, bool) {
+	entries, err := q.entries()
+	if err != nil {
+		log.Printf("redis queue: %v", err)
+	}
+	for _, data := range entries {
+		var order models.Order
+		if json.Unmarshal([]byte(data), &order) == nil && order.ID == id {
+			return data, order, true
+		}
+	}
+	return "", models.Order{}, false
+}
+
+func (q *redisQueue) list() []models.Order {
+	entries, err := q.entries()
+	if err != nil {
+		log.Printf("redis queue: %v", err)
+	}
+	orders := make([]models.Order, 0, len(entries))
+	for _, data := range entries {
+		var order models.Order
+		if json.Unmarshal([]byte(data), &order) == nil {
+			orders = append(orders, order)
+		}
+	}
+	return orders
+}
+
+func (q *redisQueue) bump(id string) bool {
+	data, _, ok := q.find(id)
+	return ok && q.eval(bumpScript, data) == 1
+}
+
+func (q *redisQueue) remove(id string) (models.Order, bool) {
+	data, order, ok := q.find(id)
+	if !ok {
+		return models.Order{}, false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	n, err := redisq.Int(q.client.Do(ctx, "LREM", q.key, "1", data))
+	if err != nil {
+		log.Printf("redis queue: %v", err)
+	}
+	return order, n == 1
+}
+
+// setPriority changes the order in place: Redis queues are FIFO.
+func (q *redisQueue) setPriority(id string, priority models.Priority) bool {
+	data, order, ok := q.find(id)
+	if !ok {
+		return false
+	}
+	order.Priority = priority
+	changed, err := json.Marshal(order)
+	return err == nil && q.eval(replaceScript, data, string(changed)) == 1
+}
+
+func (q *redisQueue) eval(script string, args ...string) int64 {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	n, err := redisq.Int(q.client.Eval(ctx, script, []string{q.key}, args...))
+	if err != nil {
+		log.Printf("redis queue: %v", err)
+	}
+	return n
+}
+
+// each reports the queued orders, then those in flight on any instance.
+func (q *redisQueue) each(fn func(order models.Order, inFlight bool)) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	entries, err := redisq.Strings(q.client.Do(ctx, "LRANGE", q.key, "0", "-1"))
+	if err != nil {
+		return err
+	}
+	count := len(entries)
+	lists, err := redisq.Strings(q.client.Do(ctx, "SMEMBERS", q.inFlight))
+	if err != nil {
+		return err
+	}
+	for _, list := range lists {
+		inFlight, err := redisq.Strings(q.client.Do(ctx, "LRANGE", list, "0", "-1"))
+		if err != nil {
+			return err
+		}
+		entries = append(entries, inFlight...)
+	}
+	for i, data := range entries {
+		var order models.Order
+		if json.Unmarshal([]byte(data), &order) == nil {
+			fn(order, i >= count)
+		}
+	}
+	return nil
+}
+
+// redisList holds a node's results in Redis, like a disk spill.
+type redisList struct {
+	client *redisq.Client
+	key    string
+}
+
+func (l *redisList) Push(data []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	_, err := l.client.Do(ctx, "LPUSH", l.key, string(data))
+	return err
+}
+
+func (l *redisList) Pop() ([]byte, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	data, ok, err := redisq.String(l.client.Do(ctx, "RPOP", l.key))
+	return []byte(data), ok, err
+}
+
+func (l *redisList) Len() int {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	n, err := redisq.Int(l.client.Do(ctx, "LLEN", l.key))
+	if err != nil {
+		return 0
+	}
+	return int(n)
+}
+
+func (l *redisList) Close() error { return nil }
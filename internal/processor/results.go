@@ -0,0 +1,259 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/diskqueue"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/pkg/models"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/redisq"
+)
+
+// Overflow policies decide what a worker does with its result when Results
+// is full because the consumer is slow.
+const (
+	OverflowBlock      = "block"       // wait for room, stalling the worker
+	OverflowDropOldest = "drop_oldest" // discard the oldest waiting result
+	OverflowSpill      = "spill"       // write it to disk until there's room
+
+	// OverflowRedis passes every result through a Redis list of the node,
+	// set with ResultsConfig.Redis rather than chosen.
+	OverflowRedis = "redis"
+)
+
+// ResultsConfig sets the overflow policy of Results; the default is
+// OverflowBlock. The spill policy keeps up to SpillMax results in SpillDir.
+// With Redis set, results wait in a Redis list of Node instead, so a
+// restart doesn't lose those the consumer hadn't taken.
+type ResultsConfig struct {
+	Overflow string
+	SpillDir string
+	SpillMax int
+
+	Redis *redisq.Client
+	Node  string
+}
+
+// backlog holds the results waiting for room in Results.
+type backlog interface {
+	Push(data []byte) error
+	Pop() ([]byte, bool, error)
+	Len() int
+	Close() error
+}
+
+// resultSink delivers the workers' results to Results by its policy.
+// Dropped results are only missing from Results: their orders' records
+// hold them.
+type resultSink struct {
+	out      chan models.ProcessedOrder
+	overflow string
+	disk     backlog
+
+	mu      sync.Mutex // serializes spills with refills
+	stopped chan struct{}
+
+	delivered atomic.Int64
+	blocked   atomic.Int64
+	blockedNs atomic.Int64
+	dropped   atomic.Int64
+	spilled   atomic.Int64
+}
+
+func newResultSink(cfg ResultsConfig, capacity int) (*resultSink, error) {
+	s := &resultSink{out: make(chan models.ProcessedOrder, capacity), overflow: cfg.Overflow, stopped: make(chan struct{})}
+	switch {
+	case cfg.Redis != nil && cfg.Overflow != "":
+		return nil, fmt.Errorf("results: overflow %q doesn't apply to results in Redis", cfg.Overflow)
+	case cfg.Redis != nil:
+		s.overflow = OverflowRedis
+		s.disk = &redisList{client: cfg.Redis, key: cfg.Redis.Key("results", cfg.Node)}
+	case cfg.Overflow == "":
+		s.overflow = OverflowBlock
+	case cfg.Overflow == OverflowBlock, cfg.Overflow == OverflowDropOldest:
+	case cfg.Overflow == OverflowSpill:
+		if cfg.SpillDir == "" {
+			return nil, fmt.Errorf("results: overflow %q needs a spill directory", cfg.Overflow)
+		}
+		disk, err := diskqueue.Open(cfg.SpillDir, cfg.SpillMax)
+		if err != nil {
+			return nil, fmt.Errorf("results: spill: %w", err)
+		}
+		s.disk = disk
+	default:
+		return nil, fmt.Errorf("results: unknown overflow policy %q", cfg.Overflow)
+	}
+	return s, nil
+}
+
+// send delivers r, reporting false if ctx was done first.
+func (s *resultSink) send(ctx context.Context, r models.ProcessedOrder) bool {
+	switch s.overflow {
+	case OverflowDropOldest:
+		for {
+			select {
+			case s.out <- r:
+				s.delivered.Add(1)
+				return true
+			default:
+			}
+			select {
+			case <-s.out:
+				s.dropped.Add(1)
+			default:
+			}
+		}
+	case OverflowSpill:
+		if s.spill(r) {
+			return true
+		}
+		// The disk is full too; wait like the block policy.
+	case OverflowRedis:
+		if s.enqueue(r) {
+			return true
+		}
+		// Redis is unreachable; wait like the block policy.
+	}
+
+	select {
+	case s.out <- r:
+		s.delivered.Add(1)
+		return true
+	default:
+	}
+	s.blocked.Add(1)
+	start := time.Now()
+	defer func() { s.blockedNs.Add(int64(time.Since(start))) }()
+	select {
+	case s.out <- r:
+		s.delivered.Add(1)
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// spill delivers r right away if nothing is on disk and there's room, or
+// else puts it on disk behind the results already there, so they stay in
+// order. It reports false if r couldn't be written.
+func (s *resultSink) spill(r models.ProcessedOrder) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.disk.Len() == 0 {
+		select {
+		case s.out <- r:
+			s.delivered.Add(1)
+			return true
+		default:
+		}
+	}
+	data, err := json.Marshal(r)
+	if err != nil {
+		return false
+	}
+	if err := s.disk.Push(data); err != nil {
+		if err != diskqueue.ErrFull {
+			log.Printf("results spill: %v", err)
+		}
+		return false
+	}
+	s.spilled.Add(1)
+	return true
+}
+
+// enqueue puts r in Redis behind the results already there and moves
+// what fits to Results. It reports false if r couldn't be written.
+func (s *resultSink) enqueue(r models.ProcessedOrder) bool {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return false
+	}
+	s.mu.Lock()
+	err = s.disk.Push(data)
+	s.mu.Unlock()
+	if err != nil {
+		log.Printf("results: %v", err)
+		return false
+	}
+	s.move()
+	return true
+}
+
+// refill moves spilled results to Results as the consumer makes room,
+// until ctx is done. Results left on disk are delivered after a restart.
+func (s *resultSink) refill(ctx context.Context) {
+	defer close(s.stopped)
+	if s.disk == nil {
+		return
+	}
+	ticker := time.NewTicker(spillRefillInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		s.move()
+	}
+}
+
+func (s *resultSink) move() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Only sends under mu take room while anything is on disk, so a free
+	// slot stays free.
+	for len(s.out) < cap(s.out) {
+		data, ok, err := s.disk.Pop()
+		if err != nil {
+			log.Printf("results spill: %v", err)
+		}
+		if !ok {
+			return
+		}
+		var r models.ProcessedOrder
+		if err := json.Unmarshal(data, &r); err != nil {
+			log.Printf("results spill: dropping unreadable result: %v", err)
+			continue
+		}
+		s.out <- r
+		s.delivered.Add(1)
+	}
+}
+
+// pending is the number of results on disk.
+func (s *resultSink) pending() int {
+	if s.disk == nil {
+		return 0
+	}
+	return s.disk.Len()
+}
+
+// close closes Results once refill has stopped.
+func (s *resultSink) close() {
+	<-s.stopped
+	close(s.out)
+	if s.disk != nil {
+		if err := s.disk.Close(); err != nil {
+			log.Printf("results spill: %v", err)
+		}
+	}
+}
+
+func (s *resultSink) stats() models.ResultStats {
+	return models.ResultStats{
+		Overflow:  s.overflow,
+		Waiting:   len(s.out),
+		Delivered: s.delivered.Load(),
+		Blocked:   s.blocked.Load(),
+		BlockedMs: s.blockedNs.Load() / int64(time.Millisecond),
+		Dropped:   s.dropped.Load(),
+		Spilled:   s.spilled.Load(),
+		OnDisk:    s.pending(),
+	}
+}
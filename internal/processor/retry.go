@@ -0,0 +1,122 @@
+package processor
+
+import (
+	"errors"
+	"log"
+	"math/rand/v2"
+	"sync/atomic"
+	"time"
+
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/orderstore"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/pkg/models"
+)
+
+// RetryPolicy queues orders that failed with a retryable error again after
+// an exponential backoff: BaseDelay before the second attempt, doubling
+// up to MaxDelay, each delay shortened by a random fraction of at most
+// Jitter so retries of a failed batch spread out. Orders fail for good
+// after MaxAttempts attempts; 0 or 1 disables retries.
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration // 0 doesn't cap the delay
+	Jitter      float64       // 0 to 1
+}
+
+func (r RetryPolicy) enabled() bool { return r.MaxAttempts > 1 }
+
+// delay is the wait after the order's failed attempt number attempt.
+func (r RetryPolicy) delay(attempt int) time.Duration {
+	d := r.BaseDelay << min(attempt-1, 30)
+	if d <= 0 || (r.MaxDelay > 0 && d > r.MaxDelay) {
+		d = r.MaxDelay
+	}
+	if r.Jitter > 0 && d > 0 {
+		d -= time.Duration(rand.Int64N(int64(float64(d)*r.Jitter) + 1))
+	}
+	return d
+}
+
+// Retryable reports whether an order that failed with err may succeed if
+// tried again. Validation errors, such as an amount over the limit or a
+// passed deadline, aren't, nor are errors with a Permanent() bool method
+// returning true, such as a declined payment.
+func Retryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	var ve *models.ValidationError
+	if errors.As(err, &ve) {
+		return false
+	}
+	var perm interface{ Permanent() bool }
+	return !errors.As(err, &perm) || !perm.Permanent()
+}
+
+// retry decides whether the failed order is tried again. If so, the
+// order's record is queued again and the order is pushed back to pl after
+// the backoff. Otherwise the attempt count is set on processedOrder.
+func (p *Pool) retry(pl *pipeline, order models.Order, processedOrder *models.ProcessedOrder, err error) bool {
+	if !pl.retry.enabled() {
+		return false
+	}
+	p.retryMu.Lock()
+	attempt := p.attempts[order.ID] + 1
+	if processedOrder.Success || attempt >= pl.retry.MaxAttempts || !Retryable(err) {
+		delete(p.attempts, order.ID)
+		p.retryMu.Unlock()
+		processedOrder.Attempts = attempt
+		return false
+	}
+	p.attempts[order.ID] = attempt
+	p.retrying[order.ID] = SavedOrder{Pipeline: pl.name, Order: order}
+	p.retryMu.Unlock()
+
+	atomic.AddInt64(&p.Retries, 1)
+	pl.retries.Add(1)
+	p.Orders.SetState(order.ID, orderstore.Queued)
+	delay := pl.retry.delay(attempt)
+	log.Printf("🔁 Order %s attempt %d failed in %s: %v; retrying in %s",
+		order.ID, attempt, processedOrder.FailedStep, err, delay.Round(time.Millisecond))
+	time.AfterFunc(delay, func() { p.requeue(pl, order) })
+	return true
+}
+
+// requeue pushes an order back after its backoff, waiting again while the
+// queue is full. Once the pool is closed the order is left waiting, for
+// SaveQueued, and to its queued record, which a durable repository queues
+// at the next start.
+func (p *Pool) requeue(pl *pipeline, order models.Order) {
+	if p.Ctx.Err() != nil {
+		return
+	}
+	if !pl.orders.push(order) {
+		time.AfterFunc(max(pl.retry.BaseDelay, spillRefillInterval), func() { p.requeue(pl, order) })
+		return
+	}
+	p.retryMu.Lock()
+	delete(p.retrying, order.ID)
+	p.retryMu.Unlock()
+}
+
+// attempt is the number of the attempt at an order about to be processed.
+func (p *Pool) attempt(id string) int {
+	p.retryMu.Lock()
+	defer p.retryMu.Unlock()
+	return p.attempts[id] + 1
+}
+
+// forgetAttempts drops the attempt count of an order that won't be
+// processed again, e.g. one cancelled while waiting to be retried.
+func (p *Pool) forgetAttempts(id string) {
+	p.retryMu.Lock()
+	defer p.retryMu.Unlock()
+	delete(p.attempts, id)
+}
+
+// waitingRetries is the number of orders waiting out their backoff.
+func (p *Pool) waitingRetries() int {
+	p.retryMu.Lock()
+	defer p.retryMu.Unlock()
+	return len(p.retrying)
+}
@@ -0,0 +1,134 @@
+package processor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/orderstore"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/pkg/models"
+)
+
+// SavedOrder is an order that was queued, or waiting out a retry backoff,
+// in Pipeline.
+type SavedOrder struct {
+	Pipeline string       `json:"pipeline"`
+	Order    models.Order `json:"order"`
+}
+
+// savedQueues is the file SaveQueued writes.
+type savedQueues struct {
+	SavedAt time.Time    `json:"saved_at"`
+	Orders  []SavedOrder `json:"orders"`
+}
+
+// SaveQueued writes the orders left in the in-memory queues of a closed
+// pool, and those waiting out a retry backoff, to path, so that
+// RestoreQueued queues them again at the next start. Orders queued in
+// Redis or spilled to disk stay there and aren't saved, nor are orders
+// cancelled while queued. It returns how many orders were saved; with
+// none, no file is written.
+func (p *Pool) SaveQueued(path string) (int, error) {
+	var saved []SavedOrder
+	for _, pl := range p.pipelines {
+		if _, ok := pl.orders.(*redisQueue); ok {
+			continue
+		}
+		q, ok := pl.orders.(inspectable)
+		if !ok {
+			continue
+		}
+		for _, o := range q.list() {
+			saved = append(saved, SavedOrder{Pipeline: pl.name, Order: o})
+		}
+	}
+	p.retryMu.Lock()
+	for _, o := range p.retrying {
+		saved = append(saved, o)
+	}
+	p.retryMu.Unlock()
+
+	p.cancelMu.Lock()
+	kept := saved[:0]
+	for _, o := range saved {
+		if !p.cancelled[o.Order.ID] {
+			kept = append(kept, o)
+		}
+	}
+	p.cancelMu.Unlock()
+	if len(kept) == 0 {
+		return 0, nil
+	}
+
+	data, err := json.Marshal(savedQueues{SavedAt: time.Now(), Orders: kept})
+	if err != nil {
+		return 0, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return 0, err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return 0, err
+	}
+	return len(kept), os.Rename(tmp, path)
+}
+
+// RestoreQueued queues the orders SaveQueued wrote to path again, in the
+// pipeline they were saved from if it still exists and by their route
+// otherwise, and removes the file. Orders the order store already knows,
+// such as those a durable repository queued again at startup, are
+// skipped; orders that no longer fit fail like they do in reconcile. It
+// returns how many orders were queued; a missing file queues none.
+func (p *Pool) RestoreQueued(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	var saved savedQueues
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return 0, fmt.Errorf("%s: %w", path, err)
+	}
+
+	var restored, known, lost int
+	for _, s := range saved.Orders {
+		order := s.Order
+		pl := p.route(order)
+		for _, candidate := range p.pipelines {
+			if candidate.name == s.Pipeline {
+				pl = candidate
+			}
+		}
+		if err := p.Orders.Put(order, orderstore.Queued); errors.Is(err, orderstore.ErrExists) {
+			known++
+			continue
+		} else if err != nil {
+			return restored, err
+		}
+		if pl.orders.push(order) {
+			restored++
+			continue
+		}
+		p.Orders.Finish(models.ProcessedOrder{
+			Order:       order,
+			ProcessedAt: time.Now(),
+			Error:       "not queued again after a restart: " + ErrQueueFull.Error(),
+			ErrorCode:   models.CodeServiceUnavailable,
+		})
+		lost++
+	}
+	if err := os.Remove(path); err != nil {
+		return restored, err
+	}
+	log.Printf("orders: restored queues saved at %s: %d queued again, %d already known, %d failed with full queues",
+		saved.SavedAt.Format(time.RFC3339), restored, known, lost)
+	return restored, nil
+}
@@ -0,0 +1,296 @@
+package processor
+
+import (
+	"context"
+	"hash/fnv"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/pkg/models"
+)
+
+// shardKey returns the key orders are sharded by: "customer" or
+// "tag:<name>". Orders without the tag share the empty key.
+func shardKey(by string, o models.Order) string {
+	if tag, ok := strings.CutPrefix(by, "tag:"); ok {
+		return o.Tags[tag]
+	}
+	return o.Customer
+}
+
+// shardQueue gives every worker its own shard, chosen by hashing the shard
+// key, so orders with the same key are processed one at a time and in
+// order. A worker whose shard is empty steals the newest key from the
+// most loaded shard. All queued orders of that key move together and the
+// key stays with the thief until it drains, which keeps per-key order.
+type shardQueue struct {
+	by       string
+	capacity int
+
+	mu       sync.Mutex
+	cond     *sync.Cond
+	shards   []*shard
+	owner    map[string]int  // shard of every key with queued or in-flight orders
+	inFlight map[string]bool // keys a worker is processing
+	size     int
+	closed   bool
+
+	steals       int64 // keys moved between shards
+	stolenOrders int64 // orders moved with them
+}
+
+type shard struct {
+	keys   []string // keys with queued orders, oldest first
+	orders map[string][]models.Order
+	queued int
+}
+
+func newShardQueue(by string, shards, capacity int) *shardQueue {
+	q := &shardQueue{
+		by:       by,
+		capacity: capacity,
+		owner:    make(map[string]int),
+		inFlight: make(map[string]bool),
+	}
+	q.cond = sync.NewCond(&q.mu)
+	for range shards {
+		q.shards = append(q.shards, &shard{orders: make(map[string][]models.Order)})
+	}
+	return q
+}
+
+func (q *shardQueue) push(order models.Order) bool {
+	key := shardKey(q.by, order)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed || q.size >= q.capacity {
+		return false
+	}
+	i, ok := q.owner[key]
+	if !ok {
+		h := fnv.New32a()
+		h.Write([]byte(key))
+		i = int(h.Sum32() % uint32(len(q.shards)))
+		q.owner[key] = i
+	}
+	q.shards[i].add(key, order)
+	q.size++
+	q.cond.Broadcast()
+	return true
+}
+
+func (q *shardQueue) pop(ctx context.Context, worker int) (models.Order, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for {
+		if q.closed || ctx.Err() != nil {
+			return models.Order{}, false
+		}
+		if order, ok := q.take(worker); ok {
+			return order, true
+		}
+		if q.steal(worker) {
+			continue
+		}
+		q.cond.Wait()
+	}
+}
+
+// take pops the oldest order of the first key in worker's shard that is
+// not already being processed.
+func (q *shardQueue) take(worker int) (models.Order, bool) {
+	s := q.shards[worker]
+	for _, key := range s.keys {
+		if q.inFlight[key] {
+			continue
+		}
+		q.inFlight[key] = true
+		q.size--
+		return s.remove(key), true
+	}
+	return models.Order{}, false
+}
+
+// steal moves the newest idle key of the most loaded other shard to
+// worker's shard.
+func (q *shardQueue) steal(worker int) bool {
+	victim, most := -1, 0
+	for i, s := range q.shards {
+		if i != worker && s.queued > most {
+			victim, most = i, s.queued
+		}
+	}
+	if victim < 0 {
+		return false
+	}
+	from := q.shards[victim]
+	for i := len(from.keys) - 1; i >= 0; i-- {
+		key := from.keys[i]
+		if q.inFlight[key] {
+			continue
+		}
+		orders := from.orders[key]
+		from.keys = append(from.keys[:i], from.keys[i+1:]...)
+		delete(from.orders, key)
+		from.queued -= len(orders)
+
+		to := q.shards[worker]
+		to.keys = append(to.keys, key)
+		to.orders[key] = orders
+		to.queued += len(orders)
+		q.owner[key] = worker
+
+		q.steals++
+		q.stolenOrders += int64(len(orders))
+		return true
+	}
+	return false
+}
+
+func (q *shardQueue) done(worker int, order models.Order) {
+	key := shardKey(q.by, order)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.inFlight, key)
+	if _, queued := q.shards[q.owner[key]].orders[key]; !queued {
+		delete(q.owner, key)
+	}
+	q.cond.Broadcast()
+}
+
+func (q *shardQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.size
+}
+
+func (q *shardQueue) cap() int {
+	return q.capacity
+}
+
+func (q *shardQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	q.cond.Broadcast()
+}
+
+// stats returns the steal counters and the queue length of every shard.
+func (q *shardQueue) stats() (steals, stolen int64, lengths []int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	lengths = make([]int, len(q.shards))
+	for i, s := range q.shards {
+		lengths[i] = s.queued
+	}
+	return q.steals, q.stolenOrders, lengths
+}
+
+// list returns queued orders shard by shard, each in its own pop order.
+func (q *shardQueue) list() []models.Order {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	orders := make([]models.Order, 0, q.size)
+	for _, s := range q.shards {
+		for _, key := range s.keys {
+			orders = append(orders, s.orders[key]...)
+		}
+	}
+	return orders
+}
+
+// find must be called with q.mu held.
+func (q *shardQueue) find(id string) (s *shard, key string, i int, ok bool) {
+	for _, s := range q.shards {
+		for key, orders := range s.orders {
+			if i := slices.IndexFunc(orders, func(o models.Order) bool { return o.ID == id }); i >= 0 {
+				return s, key, i, true
+			}
+		}
+	}
+	return nil, "", 0, false
+}
+
+// bump moves the order to the front of its key and its key to the front of
+// its shard. It still waits for an in-flight order of the same key.
+func (q *shardQueue) bump(id string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	s, key, i, ok := q.find(id)
+	if !ok {
+		return false
+	}
+	orders := s.orders[key]
+	order := orders[i]
+	copy(orders[1:i+1], orders[:i])
+	orders[0] = order
+	s.keys = append([]string{key}, deleteKey(s.keys, key)...)
+	return true
+}
+
+// setPriority leaves the order in place, as orders of one key must keep
+// their submission order.
+func (q *shardQueue) setPriority(id string, priority models.Priority) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	s, key, i, ok := q.find(id)
+	if !ok {
+		return false
+	}
+	s.orders[key][i].Priority = priority
+	return true
+}
+
+func (q *shardQueue) remove(id string) (models.Order, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	s, key, i, ok := q.find(id)
+	if !ok {
+		return models.Order{}, false
+	}
+	order := s.orders[key][i]
+	s.orders[key] = slices.Delete(s.orders[key], i, i+1)
+	if len(s.orders[key]) == 0 {
+		delete(s.orders, key)
+		s.keys = deleteKey(s.keys, key)
+		if !q.inFlight[key] {
+			delete(q.owner, key)
+		}
+	}
+	s.queued--
+	q.size--
+	return order, true
+}
+
+func (s *shard) add(key string, order models.Order) {
+	if _, ok := s.orders[key]; !ok {
+		s.keys = append(s.keys, key)
+	}
+	s.orders[key] = append(s.orders[key], order)
+	s.queued++
+}
+
+func (s *shard) remove(key string) models.Order {
+	orders := s.orders[key]
+	order := orders[0]
+	if len(orders) == 1 {
+		delete(s.orders, key)
+		s.keys = deleteKey(s.keys, key)
+	} else {
+		s.orders[key] = orders[1:]
+	}
+	s.queued--
+	return order
+}
+
+func deleteKey(keys []string, key string) []string {
+	for i, k := range keys {
+		if k == key {
+			return append(keys[:i], keys[i+1:]...)
+		}
+	}
+	return keys
+}
@@ -0,0 +1,224 @@
+package processor
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/pkg/models"
+)
+
+// Worker states reported by Snapshot.
+const (
+	WorkerIdle       = "idle"       // waiting for an order
+	WorkerProcessing = "processing" // running the pipeline's steps
+	WorkerSending    = "sending"    // handing its result to the results consumer
+	WorkerStopped    = "stopped"
+)
+
+// workerState is what one worker is doing, for Snapshot, and what it has
+// done, for WorkerStats.
+type workerState struct {
+	mu        sync.Mutex
+	state     string
+	since     time.Time
+	order     models.Order
+	step      string
+	stepSince time.Time
+	idle      time.Duration // before the current state
+
+	processed atomic.Int64
+	errors    atomic.Int64
+	totalTime atomic.Int64 // processing time in milliseconds
+	restarts  atomic.Int64 // after a panic
+}
+
+func (w *workerState) set(state string, order models.Order) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	now := time.Now()
+	if w.state == WorkerIdle {
+		w.idle += now.Sub(w.since)
+	}
+	w.state, w.since, w.order, w.step = state, now, order, ""
+}
+
+// finished counts an order the worker delivered.
+func (w *workerState) finished(o models.ProcessedOrder) {
+	w.processed.Add(1)
+	if !o.Success {
+		w.errors.Add(1)
+	}
+	w.totalTime.Add(o.ProcessingTime)
+}
+
+func (w *workerState) current() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.state
+}
+
+func (w *workerState) setStep(step string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.step, w.stepSince = step, time.Now()
+}
+
+// WorkerSnapshot is one worker's state. Order fields are set while it has
+// an order; Step while processing.
+type WorkerSnapshot struct {
+	ID        int             `json:"id"`
+	Pipeline  string          `json:"pipeline"`
+	Index     int             `json:"index"`
+	State     string          `json:"state"`
+	InStateMs int64           `json:"in_state_ms"`
+	OrderID   string          `json:"order_id,omitempty"`
+	Priority  models.Priority `json:"priority,omitempty"`
+	Step      string          `json:"step,omitempty"`
+	InStepMs  int64           `json:"in_step_ms,omitempty"`
+	Processed int64           `json:"processed"`
+}
+
+// WorkerStats are one worker's totals since the pool started, with what
+// it is doing now. A worker stuck on an order shows a growing InStateMs
+// while processing; a slow one, a high AvgProcessingMs next to its
+// pipeline's other workers.
+type WorkerStats struct {
+	ID              int     `json:"id"`
+	Pipeline        string  `json:"pipeline"`
+	Index           int     `json:"index"`
+	State           string  `json:"state"`
+	InStateMs       int64   `json:"in_state_ms"`
+	OrderID         string  `json:"order_id,omitempty"`
+	Step            string  `json:"step,omitempty"`
+	Processed       int64   `json:"processed"`
+	Errors          int64   `json:"errors"`
+	AvgProcessingMs float64 `json:"avg_processing_ms"`
+	IdleMs          int64   `json:"idle_ms"` // waiting for orders, including now
+	Restarts        int64   `json:"restarts,omitempty"`
+}
+
+// QueueComposition breaks a pipeline's in-memory queue down by priority
+// and by age since submission.
+type QueueComposition struct {
+	Pipeline   string                  `json:"pipeline"`
+	Length     int                     `json:"length"`
+	Spilled    int                     `json:"spilled,omitempty"`
+	ByPriority map[models.Priority]int `json:"by_priority"`
+	ByAge      map[string]int          `json:"by_age"`
+	OldestMs   int64                   `json:"oldest_ms"`
+}
+
+// PoolSnapshot is a live view of the pool for debugging.
+type PoolSnapshot struct {
+	At      time.Time          `json:"at"`
+	Workers []WorkerSnapshot   `json:"workers"`
+	Queues  []QueueComposition `json:"queues"`
+	Results models.ResultStats `json:"results"`
+}
+
+// ageBuckets are the upper bounds of the queue age buckets, shortest
+// first; older orders fall in the last bucket.
+var ageBuckets = []struct {
+	name  string
+	below time.Duration
+}{
+	{"<1s", time.Second},
+	{"1s-10s", 10 * time.Second},
+	{"10s-1m", time.Minute},
+	{">1m", 0},
+}
+
+// Snapshot returns what every worker is doing and what waits in the
+// queues. Spilled orders are only counted.
+func (p *Pool) Snapshot() PoolSnapshot {
+	now := time.Now()
+	snap := PoolSnapshot{At: now, Workers: make([]WorkerSnapshot, 0, len(p.workerStates)), Results: p.results.stats()}
+
+	for _, pl := range p.pipelines {
+		p.eachWorker(pl, func(id, i int, w *workerState) {
+			ws := WorkerSnapshot{
+				ID:        id,
+				Pipeline:  pl.name,
+				Index:     i,
+				State:     w.state,
+				InStateMs: now.Sub(w.since).Milliseconds(),
+				OrderID:   w.order.ID,
+				Priority:  w.order.Priority,
+				Step:      w.step,
+				Processed: w.processed.Load(),
+			}
+			if w.step != "" {
+				ws.InStepMs = now.Sub(w.stepSince).Milliseconds()
+			}
+			snap.Workers = append(snap.Workers, ws)
+		})
+
+		c := QueueComposition{Pipeline: pl.name, Length: pl.orders.len(), ByPriority: map[models.Priority]int{}, ByAge: map[string]int{}}
+		if sq, ok := pl.orders.(*spillQueue); ok {
+			c.Spilled = sq.disk.Len()
+		}
+		if q, ok := pl.orders.(inspectable); ok {
+			for _, o := range q.list() {
+				// Unknown priorities are counted as medium, like the
+				// priority queue does.
+				c.ByPriority[lane(o.Priority)]++
+				age := now.Sub(o.CreatedAt)
+				c.OldestMs = max(c.OldestMs, age.Milliseconds())
+				for _, b := range ageBuckets {
+					if b.below == 0 || age < b.below {
+						c.ByAge[b.name]++
+						break
+					}
+				}
+			}
+		}
+		snap.Queues = append(snap.Queues, c)
+	}
+	return snap
+}
+
+// WorkerStats returns every worker's totals and current state.
+func (p *Pool) WorkerStats() []WorkerStats {
+	now := time.Now()
+	stats := make([]WorkerStats, 0, len(p.workerStates))
+	for _, pl := range p.pipelines {
+		p.eachWorker(pl, func(id, i int, w *workerState) {
+			ws := WorkerStats{
+				ID:        id,
+				Pipeline:  pl.name,
+				Index:     i,
+				State:     w.state,
+				InStateMs: now.Sub(w.since).Milliseconds(),
+				OrderID:   w.order.ID,
+				Step:      w.step,
+				Processed: w.processed.Load(),
+				Errors:    w.errors.Load(),
+				IdleMs:    w.idle.Milliseconds(),
+				Restarts:  w.restarts.Load(),
+			}
+			if ws.Processed > 0 {
+				ws.AvgProcessingMs = float64(w.totalTime.Load()) / float64(ws.Processed)
+			}
+			if w.state == WorkerIdle {
+				ws.IdleMs += ws.InStateMs
+			}
+			stats = append(stats, ws)
+		})
+	}
+	return stats
+}
+
+// eachWorker calls fn with the ID, index and locked state of each of pl's
+// workers, skipping those autoscaling stopped.
+func (p *Pool) eachWorker(pl *pipeline, fn func(id, index int, w *workerState)) {
+	running := int(pl.running.Load())
+	for i := range pl.slots {
+		w := p.workerStates[pl.firstID+i]
+		w.mu.Lock()
+		if i < running || w.state != WorkerStopped {
+			fn(pl.firstID+i, i, w)
+		}
+		w.mu.Unlock()
+	}
+}
@@ -0,0 +1,148 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/diskqueue"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/pkg/models"
+)
+
+// spillRefillInterval bounds how long spilled orders wait for room in
+// memory when no worker has finished an order in the meantime.
+const spillRefillInterval = 50 * time.Millisecond
+
+// spillQueue puts orders that don't fit in the in-memory queue on disk and
+// moves them back as workers make room. Once anything is spilled, new
+// orders go to disk too until it drains, so FIFO order is kept.
+type spillQueue struct {
+	queue
+	disk *diskqueue.Queue
+
+	mu   sync.Mutex // serializes pushes with refills
+	wake chan struct{}
+}
+
+func newSpillQueue(mem queue, disk *diskqueue.Queue) *spillQueue {
+	return &spillQueue{queue: mem, disk: disk, wake: make(chan struct{}, 1)}
+}
+
+func (q *spillQueue) push(order models.Order) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.disk.Len() == 0 && q.queue.push(order) {
+		return true
+	}
+	data, err := json.Marshal(order)
+	if err != nil {
+		return false
+	}
+	if err := q.disk.Push(data); err != nil {
+		if err != diskqueue.ErrFull {
+			log.Printf("spill: %v", err)
+		}
+		return false
+	}
+	return true
+}
+
+func (q *spillQueue) done(worker int, order models.Order) {
+	q.queue.done(worker, order)
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (q *spillQueue) len() int { return q.queue.len() + q.disk.Len() }
+func (q *spillQueue) cap() int { return q.queue.cap() + q.disk.Cap() }
+
+func (q *spillQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.queue.close()
+	if err := q.disk.Close(); err != nil {
+		log.Printf("spill: %v", err)
+	}
+}
+
+func (q *spillQueue) interrupt() {
+	if mem, ok := q.queue.(interrupter); ok {
+		mem.interrupt()
+	}
+}
+
+// list, bump and remove only reach orders in memory; spilled orders can't
+// be inspected until they are moved back.
+func (q *spillQueue) list() []models.Order {
+	if mem, ok := q.queue.(inspectable); ok {
+		return mem.list()
+	}
+	return nil
+}
+
+func (q *spillQueue) bump(id string) bool {
+	mem, ok := q.queue.(inspectable)
+	return ok && mem.bump(id)
+}
+
+func (q *spillQueue) remove(id string) (models.Order, bool) {
+	if mem, ok := q.queue.(inspectable); ok {
+		return mem.remove(id)
+	}
+	return models.Order{}, false
+}
+
+func (q *spillQueue) setPriority(id string, priority models.Priority) bool {
+	mem, ok := q.queue.(inspectable)
+	return ok && mem.setPriority(id, priority)
+}
+
+// each reports the spilled orders; those in memory are lost on a restart.
+func (q *spillQueue) each(fn func(order models.Order, inFlight bool)) error {
+	return q.disk.Each(func(data []byte) {
+		var order models.Order
+		if json.Unmarshal(data, &order) == nil {
+			fn(order, false)
+		}
+	})
+}
+
+// refill moves spilled orders into memory until ctx is done.
+func (q *spillQueue) refill(ctx context.Context) {
+	ticker := time.NewTicker(spillRefillInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-q.wake:
+		case <-ticker.C:
+		}
+		q.move()
+	}
+}
+
+func (q *spillQueue) move() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	// Only pushes take room and they hold mu, so a free slot stays free.
+	for q.queue.len() < q.queue.cap() {
+		data, ok, err := q.disk.Pop()
+		if err != nil {
+			log.Printf("spill: %v", err)
+		}
+		if !ok {
+			return
+		}
+		var order models.Order
+		if err := json.Unmarshal(data, &order); err != nil {
+			log.Printf("spill: dropping unreadable order: %v", err)
+			continue
+		}
+		q.queue.push(order)
+	}
+}
@@ -1,7 +1,9 @@
 package processor
 
 import (
+	"context"
 	"fmt"
+	"log"
 	"math/rand"
 	"time"
 
@@ -13,21 +15,20 @@ func CreateTestOrder(id int) models.Order {
 	rand.Seed(time.Now().UnixNano())
 
 	items := []string{"laptop", "mouse", "keyboard", "monitor", "headphones", "webcam", "speaker", "tablet"}
-	itemCount := rand.Intn(5) + 1 
+	itemCount := rand.Intn(5) + 1
 
 	orderItems := make([]string, itemCount)
 	for i := 0; i < itemCount; i++ {
 		orderItems[i] = items[rand.Intn(len(items))]
 	}
 
-	priorities := []int{1, 2, 3} // High, Medium, Low
-	priority := priorities[rand.Intn(len(priorities))]
+	priority := models.Priorities[rand.Intn(len(models.Priorities))]
 
 	// Create some high-value orders for priority processing
-	amount := float64(rand.Intn(2000) + 10) // $10-$2010
-	if rand.Float64() < 0.1 {               // 10% chance of high-value order
-		amount = float64(rand.Intn(5000) + 1000) // $1000-$6000
-		priority = 1                             // High priority for high-value orders
+	amount := models.Whole(int64(rand.Intn(2000) + 10)) // $10-$2010
+	if rand.Float64() < 0.1 {                           // 10% chance of high-value order
+		amount = models.Whole(int64(rand.Intn(5000) + 1000)) // $1000-$6000
+		priority = models.PriorityHigh                       // High priority for high-value orders
 	}
 
 	return models.Order{
@@ -35,9 +36,47 @@ func CreateTestOrder(id int) models.Order {
 		Amount:   amount,
 		Items:    orderItems,
 		Customer: fmt.Sprintf("customer%d@example.com", rand.Intn(1000)),
-		Status:   "pending",
+		Status:   models.StatusPending,
 		Address:  fmt.Sprintf("%d Test Street, City %d", rand.Intn(1000), rand.Intn(100)),
 		Priority: priority,
 		Notes:    fmt.Sprintf("Test order %d", id),
 	}
 }
+
+// OrderGenerator feeds synthetic orders from CreateTestOrder into Submit at
+// Rate orders per second, for demos and dev mode.
+type OrderGenerator struct {
+	Rate   float64
+	Submit func(models.Order) error
+}
+
+// Run generates orders until ctx is done. Rejected orders are counted and
+// reported every 10 seconds rather than logged one by one.
+func (g *OrderGenerator) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / g.Rate))
+	defer ticker.Stop()
+	report := time.NewTicker(10 * time.Second)
+	defer report.Stop()
+
+	var id, rejected int
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-report.C:
+			if rejected > 0 {
+				log.Printf("order generator: %d orders rejected in the last 10s", rejected)
+				rejected = 0
+			}
+		case <-ticker.C:
+			id++
+			order := CreateTestOrder(id)
+			order.ID = fmt.Sprintf("dev_%d_%d", time.Now().Unix(), id)
+			order.Tags = map[string]string{"source": "dev"}
+			order.CreatedAt = time.Now()
+			if err := g.Submit(order); err != nil {
+				rejected++
+			}
+		}
+	}
+}
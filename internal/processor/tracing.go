@@ -0,0 +1,84 @@
+package processor
+
+import (
+	"context"
+	"strconv"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/pkg/models"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/tracing"
+)
+
+// queuedTrace carries a queued order's trace to the worker that pops it.
+// Queues hold plain orders, some of them on disk or in Redis, so the
+// trace waits beside them, by order ID, like retry attempts do.
+type queuedTrace struct {
+	parent trace.SpanContext // whoever submitted the order, or wait
+	wait   trace.Span        // the order's wait in the queue
+}
+
+// traceQueued starts the wait span of an order pushed to pl, in the
+// trace of ctx. Orders queued in Redis may be popped by another instance,
+// which starts a trace of its own, so their wait isn't traced.
+func (p *Pool) traceQueued(ctx context.Context, pl *pipeline, order models.Order) {
+	if _, ok := pl.orders.(*redisQueue); ok {
+		return
+	}
+	_, span := tracing.Tracer().Start(ctx, "order.queued", trace.WithAttributes(
+		attribute.String("order.id", order.ID),
+		attribute.String("order.pipeline", pl.name),
+		attribute.String("order.priority", order.Priority.String()),
+	))
+	if !span.IsRecording() {
+		return
+	}
+	// Orders submitted outside a trace start one with their wait.
+	parent := trace.SpanContextFromContext(ctx)
+	if !parent.IsValid() {
+		parent = span.SpanContext()
+	}
+	p.traceMu.Lock()
+	p.traces[order.ID] = queuedTrace{parent: parent, wait: span}
+	p.traceMu.Unlock()
+}
+
+// tracePopped ends the wait span of an order a worker popped and returns
+// the context its processing span belongs in. Untraced orders start a
+// trace of their own.
+func (p *Pool) tracePopped(id string) context.Context {
+	p.traceMu.Lock()
+	qt, ok := p.traces[id]
+	delete(p.traces, id)
+	p.traceMu.Unlock()
+	if !ok {
+		return context.Background()
+	}
+	qt.wait.End()
+	return trace.ContextWithSpanContext(context.Background(), qt.parent)
+}
+
+// traceDropped ends the wait span of an order that left its queue
+// without being processed, e.g. because it was cancelled.
+func (p *Pool) traceDropped(id, reason string) {
+	p.traceMu.Lock()
+	qt, ok := p.traces[id]
+	delete(p.traces, id)
+	p.traceMu.Unlock()
+	if ok {
+		qt.wait.SetAttributes(attribute.String("order.dropped", reason))
+		qt.wait.End()
+	}
+}
+
+// traceProcessing starts the span of a worker's attempt at order, the
+// first being 1.
+func traceProcessing(ctx context.Context, pl *pipeline, order models.Order, workerID, attempt int) (context.Context, trace.Span) {
+	return tracing.Tracer().Start(ctx, "order.process", trace.WithAttributes(
+		attribute.String("order.id", order.ID),
+		attribute.String("order.pipeline", pl.name),
+		attribute.String("worker.id", strconv.Itoa(workerID)),
+		attribute.Int("order.attempt", attempt),
+	))
+}
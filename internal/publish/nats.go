@@ -0,0 +1,221 @@
+package publish
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// JetStream publishes to NATS JetStream subjects over the NATS protocol
+// and waits for the stream's ack. Messages carry a Nats-Msg-Id header, so
+// the stream drops republished events within its duplicate window.
+type JetStream struct {
+	URL     string        // nats://host:4222
+	Token   func() string // auth token; nil sends none
+	Timeout time.Duration // for connecting and for each ack
+
+	mu    sync.Mutex
+	conn  net.Conn
+	r     *bufio.Reader
+	inbox string
+	next  uint64
+}
+
+func (j *JetStream) Publish(ctx context.Context, m Message) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if err := j.publish(ctx, m); err != nil {
+		// Start over on a fresh connection rather than resync this one.
+		j.closeConn()
+		return fmt.Errorf("nats: %w", err)
+	}
+	return nil
+}
+
+func (j *JetStream) publish(ctx context.Context, m Message) error {
+	if j.conn == nil {
+		if err := j.connect(ctx); err != nil {
+			return err
+		}
+	}
+	deadline := time.Now().Add(j.Timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err := j.conn.SetDeadline(deadline); err != nil {
+		return err
+	}
+	stop := context.AfterFunc(ctx, func() { j.conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	j.next++
+	reply := j.inbox + "." + strconv.FormatUint(j.next, 10)
+	header := "NATS/1.0\r\nNats-Msg-Id: " + m.ID + "\r\n\r\n"
+	if _, err := fmt.Fprintf(j.conn, "HPUB %s %s %d %d\r\n%s%s\r\n",
+		m.Topic, reply, len(header), len(header)+len(m.Value), header, m.Value); err != nil {
+		return err
+	}
+	for {
+		subject, status, payload, err := j.readMsg()
+		if err != nil {
+			return err
+		}
+		if subject != reply {
+			continue // the ack of an earlier attempt that timed out
+		}
+		if status == "503" {
+			return fmt.Errorf("no stream stores subject %s", m.Topic)
+		}
+		var ack struct {
+			Stream string `json:"stream"`
+			Error  *struct {
+				Description string `json:"description"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal(payload, &ack); err != nil {
+			return fmt.Errorf("decode ack: %w", err)
+		}
+		if ack.Error != nil {
+			return errors.New(ack.Error.Description)
+		}
+		return nil
+	}
+}
+
+// connect opens a connection, authenticates and subscribes to the inbox
+// that receives acks.
+func (j *JetStream) connect(ctx context.Context) error {
+	u, err := url.Parse(j.URL)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "nats" {
+		return fmt.Errorf("url must be nats://host:port")
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "4222")
+	}
+	dialer := net.Dialer{Timeout: j.Timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return err
+	}
+	j.conn, j.r = conn, bufio.NewReader(conn)
+	if err := conn.SetDeadline(time.Now().Add(j.Timeout)); err != nil {
+		return err
+	}
+	line, err := j.readLine()
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "INFO ") {
+		return fmt.Errorf("unexpected greeting %q", line)
+	}
+
+	opts := map[string]any{"verbose": false, "pedantic": false, "headers": true, "no_responders": true,
+		"name": "order-processor", "lang": "go", "version": "1", "protocol": 1}
+	if j.Token != nil {
+		opts["auth_token"] = j.Token()
+	}
+	connect, err := json.Marshal(opts)
+	if err != nil {
+		return err
+	}
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	j.inbox = "_INBOX." + hex.EncodeToString(b)
+	if _, err := fmt.Fprintf(conn, "CONNECT %s\r\nSUB %s.* 1\r\nPING\r\n", connect, j.inbox); err != nil {
+		return err
+	}
+	for {
+		line, err := j.readLine()
+		switch {
+		case err != nil:
+			return err
+		case line == "PONG":
+			return nil
+		case strings.HasPrefix(line, "-ERR"):
+			return errors.New(strings.Trim(strings.TrimPrefix(line, "-ERR "), "'"))
+		}
+	}
+}
+
+// readMsg reads up to the next message, answering pings on the way, and
+// returns its subject, its header status, if any, and its payload.
+func (j *JetStream) readMsg() (subject, status string, payload []byte, err error) {
+	for {
+		line, err := j.readLine()
+		if err != nil {
+			return "", "", nil, err
+		}
+		op, args, _ := strings.Cut(line, " ")
+		switch op {
+		case "PING":
+			if _, err := io.WriteString(j.conn, "PONG\r\n"); err != nil {
+				return "", "", nil, err
+			}
+			continue
+		case "-ERR":
+			return "", "", nil, errors.New(strings.Trim(args, "'"))
+		case "MSG", "HMSG":
+		default:
+			continue // +OK, PONG or INFO updates
+		}
+
+		// MSG <subject> <sid> [reply] <size>
+		// HMSG <subject> <sid> [reply] <header size> <total size>
+		f := strings.Fields(args)
+		if len(f) < 3 {
+			return "", "", nil, fmt.Errorf("malformed %s", op)
+		}
+		hdrLen := 0
+		total, err := strconv.Atoi(f[len(f)-1])
+		if err == nil && op == "HMSG" {
+			hdrLen, err = strconv.Atoi(f[len(f)-2])
+		}
+		if err != nil || hdrLen > total {
+			return "", "", nil, fmt.Errorf("malformed %s", op)
+		}
+		data := make([]byte, total+2)
+		if _, err := io.ReadFull(j.r, data); err != nil {
+			return "", "", nil, err
+		}
+		if hdrLen > 0 {
+			// NATS/1.0 503 for no responders
+			first, _, _ := strings.Cut(string(data[:hdrLen]), "\r\n")
+			status, _, _ = strings.Cut(strings.TrimSpace(strings.TrimPrefix(first, "NATS/1.0")), " ")
+		}
+		return f[0], status, data[hdrLen:total], nil
+	}
+}
+
+func (j *JetStream) readLine() (string, error) {
+	line, err := j.r.ReadString('\n')
+	return strings.TrimRight(line, "\r\n"), err
+}
+
+func (j *JetStream) closeConn() {
+	if j.conn != nil {
+		j.conn.Close()
+		j.conn, j.r = nil, nil
+	}
+}
+
+func (j *JetStream) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.closeConn()
+	return nil
+}
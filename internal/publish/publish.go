@@ -0,0 +1,182 @@
+// Package publish sends result events to message brokers, Kafka or NATS
+// JetStream, on a topic chosen by the result's outcome, so downstream
+// systems can react to orders completing. Like webhooks, each publisher
+// reads the durable event bus under its own subscriber name and acks an
+// event once the broker has stored it, so events are published in order
+// and at least once.
+package publish
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/eventbus"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/transform"
+)
+
+// readBatch is how many events a publisher reads at a time.
+const readBatch = 100
+
+// Message is one event on its way to a broker.
+type Message struct {
+	Topic string
+	Key   string // the order ID, so an order's events stay in order
+	ID    string // unique per event, for brokers that drop duplicates
+	Value []byte
+}
+
+// Sink sends messages to a broker. Publish returns once the broker has
+// stored the message.
+type Sink interface {
+	Publish(ctx context.Context, m Message) error
+	Close() error
+}
+
+// Config is one publisher. Results are published to SuccessTopic or
+// FailureTopic by outcome; an empty topic leaves those results out.
+type Config struct {
+	Name         string
+	SuccessTopic string
+	FailureTopic string
+	Transform    *transform.Transform
+	MaxBackoff   time.Duration
+}
+
+// Stats describes a publisher's events.
+type Stats struct {
+	Name        string    `json:"name"`
+	Published   uint64    `json:"published"`
+	Unrouted    uint64    `json:"unrouted"` // results of an outcome without a topic
+	Failures    uint64    `json:"failures"`
+	Skipped     uint64    `json:"skipped"` // aged out of the event log, or failed to encode
+	Pending     uint64    `json:"pending"`
+	LastPublish time.Time `json:"last_publish,omitzero"`
+	LastError   string    `json:"last_error,omitempty"`
+}
+
+type Publisher struct {
+	bus  *eventbus.Bus
+	sink Sink
+	cfg  Config
+
+	mu    sync.Mutex
+	stats Stats
+}
+
+func New(bus *eventbus.Bus, sink Sink, cfg Config) *Publisher {
+	return &Publisher{bus: bus, sink: sink, cfg: cfg, stats: Stats{Name: cfg.Name}}
+}
+
+func (p *Publisher) subscriber() string {
+	return "publish:" + p.cfg.Name
+}
+
+// Run publishes events until ctx is done, then closes the sink.
+func (p *Publisher) Run(ctx context.Context) {
+	defer p.sink.Close()
+	for ctx.Err() == nil {
+		batch, err := p.bus.Read(ctx, p.subscriber(), readBatch)
+		if err != nil {
+			log.Printf("publish %s: read events: %v", p.cfg.Name, err)
+			sleep(ctx, time.Second)
+			continue
+		}
+		p.count(func(s *Stats) { s.Skipped += batch.Skipped })
+		for _, e := range batch.Events {
+			if !p.publish(ctx, e) {
+				return
+			}
+		}
+	}
+}
+
+// publish sends e until the broker stores it, retrying with backoff. It
+// returns false if ctx ended first.
+func (p *Publisher) publish(ctx context.Context, e eventbus.Event) bool {
+	topic := p.cfg.FailureTopic
+	if e.Result.Success {
+		topic = p.cfg.SuccessTopic
+	}
+	if topic == "" {
+		p.count(func(s *Stats) { s.Unrouted++ })
+		p.ack(e.Seq)
+		return true
+	}
+	value, err := p.cfg.Transform.Apply(e)
+	if err != nil {
+		// Retrying can't fix an encoding error; skip the event.
+		log.Printf("publish %s: encode event %d: %v", p.cfg.Name, e.Seq, err)
+		p.count(func(s *Stats) {
+			s.Skipped++
+			s.LastError = err.Error()
+		})
+		p.ack(e.Seq)
+		return true
+	}
+	m := Message{
+		Topic: topic,
+		Key:   e.Result.Order.ID,
+		ID:    p.subscriber() + ":" + strconv.FormatUint(e.Seq, 10),
+		Value: value,
+	}
+
+	backoff := time.Second
+	for {
+		err := p.sink.Publish(ctx, m)
+		if err == nil {
+			p.count(func(s *Stats) {
+				s.Published++
+				s.LastPublish = time.Now()
+				s.LastError = ""
+			})
+			p.ack(e.Seq)
+			return true
+		}
+		if ctx.Err() != nil {
+			return false
+		}
+		p.count(func(s *Stats) {
+			s.Failures++
+			s.LastError = err.Error()
+		})
+		sleep(ctx, backoff)
+		backoff = min(backoff*2, p.cfg.MaxBackoff)
+	}
+}
+
+func (p *Publisher) ack(seq uint64) {
+	if err := p.bus.Ack(p.subscriber(), seq); err != nil {
+		// The event will be published again after a restart.
+		log.Printf("publish %s: ack %d: %v", p.cfg.Name, seq, err)
+	}
+}
+
+func (p *Publisher) count(f func(*Stats)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	f(&p.stats)
+}
+
+func (p *Publisher) Stats() Stats {
+	p.mu.Lock()
+	stats := p.stats
+	p.mu.Unlock()
+	for _, sub := range p.bus.Subscribers() {
+		if sub.Name == p.subscriber() {
+			stats.Pending = sub.Lag
+		}
+	}
+	return stats
+}
+
+func sleep(ctx context.Context, d time.Duration) {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+	case <-t.C:
+	}
+}
@@ -0,0 +1,213 @@
+// Package quality tracks the data quality of incoming orders per source
+// and tenant: how many come without notes or a priority, how many are
+// rejected and why, and how many rejected for their address are resent
+// corrected. Targets turn the ratios into SLAs that upstream teams can be
+// held to.
+package quality
+
+import (
+	"cmp"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/pkg/models"
+)
+
+// Sources of orders.
+const (
+	SourceHTTP  = "http"
+	SourceKafka = "kafka"
+)
+
+// Indicators that targets can be set for. Each is a ratio: the first
+// two of accepted orders, the others of submitted ones.
+const (
+	MissingNotes       = "missing_notes"
+	DefaultPriority    = "default_priority"
+	ValidationFailures = "validation_failures"
+	AddressRejections  = "address_rejections"
+)
+
+var Indicators = []string{MissingNotes, DefaultPriority, ValidationFailures, AddressRejections}
+
+// maxRejected is how many orders rejected for their address are
+// remembered to spot their correction, for at most rejectedFor.
+const (
+	maxRejected = 10000
+	rejectedFor = 24 * time.Hour
+)
+
+// addressCodes are the validation errors of an order's address.
+var addressCodes = []string{models.CodeAddressRequired, models.CodeUnknownAddress, models.CodeAddressIDNeedsCustomer}
+
+// Group is the quality of one source and tenant's orders.
+type Group struct {
+	Source    string `json:"source"`
+	Tenant    string `json:"tenant"`
+	Submitted uint64 `json:"submitted"`
+	Accepted  uint64 `json:"accepted"`
+	Rejected  uint64 `json:"rejected"`
+
+	MissingNotes    uint64 `json:"missing_notes"`
+	DefaultPriority uint64 `json:"default_priority"`
+
+	// AddressRejected orders failed validation for their address, and
+	// AddressCorrected of them were resent with the same ID and accepted.
+	AddressRejected  uint64 `json:"address_rejected"`
+	AddressCorrected uint64 `json:"address_corrected"`
+
+	// Reasons counts validation errors by code. An order can fail for
+	// several reasons.
+	Reasons map[string]uint64 `json:"reasons"`
+
+	Ratios   map[string]float64 `json:"ratios"`
+	Breaches []string           `json:"breaches,omitempty"` // indicators over their target
+}
+
+// Report lists the groups by source and tenant.
+type Report struct {
+	Since   time.Time          `json:"since"`
+	Targets map[string]float64 `json:"targets,omitempty"`
+	Groups  []Group            `json:"groups"`
+}
+
+type groupKey struct{ source, tenant string }
+
+// Tracker counts order quality. Methods on a nil Tracker do nothing.
+type Tracker struct {
+	targets map[string]float64
+	since   time.Time
+
+	mu       sync.Mutex
+	groups   map[groupKey]*Group
+	rejected map[string]time.Time // tenant and ID of orders rejected for their address
+}
+
+// New returns a Tracker checking targets, the highest acceptable ratio
+// of each indicator.
+func New(targets map[string]float64) *Tracker {
+	return &Tracker{
+		targets:  targets,
+		since:    time.Now(),
+		groups:   make(map[groupKey]*Group),
+		rejected: make(map[string]time.Time),
+	}
+}
+
+// group must be called with t.mu held.
+func (t *Tracker) group(source, tenant string) *Group {
+	k := groupKey{source, tenant}
+	g, ok := t.groups[k]
+	if !ok {
+		g = &Group{Source: source, Tenant: tenant, Reasons: make(map[string]uint64)}
+		t.groups[k] = g
+	}
+	return g
+}
+
+// Accepted records an order that passed validation. defaultPriority
+// reports whether it was sent without a priority.
+func (t *Tracker) Accepted(source string, o models.Order, defaultPriority bool) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	g := t.group(source, o.Tenant)
+	g.Submitted++
+	g.Accepted++
+	if o.Notes == "" {
+		g.MissingNotes++
+	}
+	if defaultPriority {
+		g.DefaultPriority++
+	}
+	key := o.Tenant + "\x00" + o.ID
+	if at, ok := t.rejected[key]; ok {
+		delete(t.rejected, key)
+		if time.Since(at) < rejectedFor {
+			g.AddressCorrected++
+		}
+	}
+}
+
+// Rejected records an order of tenant that failed validation with err.
+// id is the ID the client sent, if any, to spot its correction.
+func (t *Tracker) Rejected(source, tenant, id string, err error) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	g := t.group(source, tenant)
+	g.Submitted++
+	g.Rejected++
+	address := false
+	for _, e := range models.AsValidationErrors(err, models.CodeInvalidField) {
+		g.Reasons[e.Code]++
+		address = address || slices.Contains(addressCodes, e.Code)
+	}
+	if !address {
+		return
+	}
+	g.AddressRejected++
+	if id == "" {
+		return
+	}
+	if len(t.rejected) >= maxRejected {
+		t.evict()
+	}
+	t.rejected[tenant+"\x00"+id] = time.Now()
+}
+
+// evict drops the oldest rejection. It must be called with t.mu held.
+func (t *Tracker) evict() {
+	var oldest string
+	var at time.Time
+	for key, rejectedAt := range t.rejected {
+		if at.IsZero() || rejectedAt.Before(at) {
+			oldest, at = key, rejectedAt
+		}
+	}
+	delete(t.rejected, oldest)
+}
+
+// Report returns every group's counts and ratios since startup.
+func (t *Tracker) Report() Report {
+	if t == nil {
+		return Report{Groups: []Group{}}
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	report := Report{Since: t.since, Targets: t.targets, Groups: make([]Group, 0, len(t.groups))}
+	for _, g := range t.groups {
+		c := *g
+		c.Reasons = maps.Clone(g.Reasons)
+		c.Ratios = map[string]float64{
+			MissingNotes:       ratio(g.MissingNotes, g.Accepted),
+			DefaultPriority:    ratio(g.DefaultPriority, g.Accepted),
+			ValidationFailures: ratio(g.Rejected, g.Submitted),
+			AddressRejections:  ratio(g.AddressRejected, g.Submitted),
+		}
+		for _, indicator := range Indicators {
+			if target, ok := t.targets[indicator]; ok && c.Ratios[indicator] > target {
+				c.Breaches = append(c.Breaches, indicator)
+			}
+		}
+		report.Groups = append(report.Groups, c)
+	}
+	slices.SortFunc(report.Groups, func(a, b Group) int {
+		return cmp.Or(strings.Compare(a.Source, b.Source), strings.Compare(a.Tenant, b.Tenant))
+	})
+	return report
+}
+
+func ratio(n, of uint64) float64 {
+	if of == 0 {
+		return 0
+	}
+	return float64(n) / float64(of)
+}
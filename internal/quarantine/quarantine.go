@@ -0,0 +1,167 @@
+// Package quarantine holds the operator's quarantine rules. Orders that
+// match a rule are still accepted, but held for review instead of being
+// processed, e.g. while abuse or a misbehaving integration is looked into.
+package quarantine
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/filter"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/pkg/models"
+)
+
+// Fields are the request attributes a rule can compare besides the order's
+// own fields: the submitting API key's ID and the client IP.
+var Fields = []string{"api_key", "ip"}
+
+// Rule quarantines the orders its filter matches.
+type Rule struct {
+	ID        string    `json:"id"`
+	Filter    string    `json:"filter"`
+	Reason    string    `json:"reason,omitempty"`
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+	Matched   int64     `json:"matched"`
+
+	filter filter.Filter
+}
+
+// ReasonPrefix starts the hold reason of quarantined orders.
+const ReasonPrefix = "quarantine "
+
+// HoldReason is the reason quarantined orders are held with, naming the
+// rule.
+func (r Rule) HoldReason() string {
+	if r.Reason == "" {
+		return ReasonPrefix + r.ID
+	}
+	return ReasonPrefix + r.ID + ": " + r.Reason
+}
+
+// Rules is the set of active rules. Rules are written to a file when one
+// is configured. Methods on a nil Rules match nothing.
+type Rules struct {
+	path string
+
+	mu    sync.RWMutex
+	rules []*Rule // oldest first; the first match wins
+}
+
+// New loads the rules saved in path, if set.
+func New(path string) (*Rules, error) {
+	q := &Rules{path: path}
+	if path == "" {
+		return q, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return q, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var saved []*Rule
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for _, r := range saved {
+		if r.filter, err = filter.Parse(r.Filter, Fields...); err != nil {
+			return nil, fmt.Errorf("%s: rule %s: %w", path, r.ID, err)
+		}
+	}
+	q.rules = saved
+	return q, nil
+}
+
+// Add parses and activates a rule, filling in its ID and creation time.
+func (q *Rules) Add(expr, reason, createdBy string) (Rule, error) {
+	f, err := filter.Parse(expr, Fields...)
+	if err != nil {
+		return Rule{}, err
+	}
+	r := &Rule{ID: newID(), Filter: expr, Reason: reason, CreatedBy: createdBy, CreatedAt: time.Now(), filter: f}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.rules = append(q.rules, r)
+	q.save()
+	return *r, nil
+}
+
+// Remove deactivates a rule, reporting whether it existed. Orders it
+// quarantined stay held.
+func (q *Rules) Remove(id string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	i := slices.IndexFunc(q.rules, func(r *Rule) bool { return r.ID == id })
+	if i < 0 {
+		return false
+	}
+	q.rules = slices.Delete(q.rules, i, i+1)
+	q.save()
+	return true
+}
+
+// List returns the rules, oldest first.
+func (q *Rules) List() []Rule {
+	if q == nil {
+		return nil
+	}
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	rules := make([]Rule, len(q.rules))
+	for i, r := range q.rules {
+		rules[i] = *r
+	}
+	return rules
+}
+
+// Match returns the first rule matching an order submitted with apiKey
+// from ip, and counts the match.
+func (q *Rules) Match(o models.Order, apiKey, ip string) (Rule, bool) {
+	if q == nil {
+		return Rule{}, false
+	}
+	attrs := map[string]string{"api_key": apiKey, "ip": ip}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, r := range q.rules {
+		if r.filter.Match(o, attrs) {
+			r.Matched++
+			return *r, true
+		}
+	}
+	return Rule{}, false
+}
+
+// save must be called with q.mu held. Match counts are saved along with
+// the next change of rules.
+func (q *Rules) save() {
+	if q.path == "" {
+		return
+	}
+	data, err := json.MarshalIndent(q.rules, "", "  ")
+	if err == nil {
+		tmp := q.path + ".tmp"
+		if err = os.WriteFile(tmp, data, 0o600); err == nil {
+			err = os.Rename(tmp, q.path)
+		}
+	}
+	if err != nil {
+		log.Printf("quarantine: saving %s: %v", q.path, err)
+	}
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,210 @@
+// Package reconcile compares the pool's order records with an external
+// system of record, such as an ERP or OMS, on a schedule. Each run is a
+// background job that flags every order whose states disagree; the last
+// run is kept as a report.
+package reconcile
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/jobs"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/orderstore"
+)
+
+const (
+	// JobKind is the kind of the background jobs that reconcile.
+	JobKind = "reconciliation"
+
+	batchSize     = 100
+	maxMismatches = 1000 // kept in the report; all are counted
+)
+
+// finished are the states an order keeps once the pool is done with it,
+// which the system of record should agree with.
+var finished = []orderstore.State{orderstore.Processed, orderstore.Failed, orderstore.Cancelled, orderstore.Removed}
+
+// Fetcher looks orders up in the system of record. It returns the state
+// of each order the system knows, by ID, as an order state.
+type Fetcher interface {
+	Fetch(ctx context.Context, ids []string) (map[string]orderstore.State, error)
+}
+
+// HTTPFetcher asks an HTTP API, e.g. cmd/mockproviders:
+// POST {URL}/orders/states with {"ids": [...]}, answered with
+// {"states": {"<id>": "<state>"}}. States maps the system's own state
+// names to order states; names it doesn't list are taken as they are.
+type HTTPFetcher struct {
+	URL    string
+	States map[string]orderstore.State
+	Client *http.Client
+}
+
+func (f HTTPFetcher) Fetch(ctx context.Context, ids []string) (map[string]orderstore.State, error) {
+	body, err := json.Marshal(map[string][]string{"ids": ids})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(f.URL, "/")+"/orders/states", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := f.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("system of record returned status %d", resp.StatusCode)
+	}
+	var out struct {
+		States map[string]string `json:"states"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("decode system of record response: %w", err)
+	}
+	states := make(map[string]orderstore.State, len(out.States))
+	for id, s := range out.States {
+		state, ok := f.States[s]
+		if !ok {
+			state = orderstore.State(s)
+		}
+		states[id] = state
+	}
+	return states, nil
+}
+
+// Mismatch is an order whose states disagree. External is empty when the
+// system of record doesn't know the order.
+type Mismatch struct {
+	OrderID  string           `json:"order_id"`
+	Local    orderstore.State `json:"local"`
+	External orderstore.State `json:"external,omitempty"`
+}
+
+func (m Mismatch) Error() string {
+	if m.External == "" {
+		return fmt.Sprintf("%s here, unknown to the system of record", m.Local)
+	}
+	return fmt.Sprintf("%s here, %s in the system of record", m.Local, m.External)
+}
+
+// Report is the outcome of one run.
+type Report struct {
+	StartedAt     time.Time  `json:"started_at"`
+	FinishedAt    time.Time  `json:"finished_at"`
+	Checked       int        `json:"checked"`
+	MismatchCount int        `json:"mismatch_count"`
+	Mismatches    []Mismatch `json:"mismatches"` // the first 1000
+	Error         string     `json:"error,omitempty"`
+}
+
+// Reconciler checks the orders the pool finished at least settle ago, so
+// the system of record has had time to catch up.
+type Reconciler struct {
+	orders  orderstore.Repository
+	fetcher Fetcher
+	jobs    *jobs.Manager
+	settle  time.Duration
+
+	mu   sync.Mutex
+	last *Report
+}
+
+func New(orders orderstore.Repository, fetcher Fetcher, manager *jobs.Manager, settle time.Duration) *Reconciler {
+	return &Reconciler{orders: orders, fetcher: fetcher, jobs: manager, settle: settle}
+}
+
+// Run starts a reconciliation job every interval until ctx is done.
+func (r *Reconciler) Run(ctx context.Context, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if _, err := r.Start("scheduler"); err != nil {
+			log.Printf("reconcile: %v", err)
+		}
+	}
+}
+
+// Start queues a reconciliation job of the orders settled by now.
+func (r *Reconciler) Start(createdBy string) (jobs.Job, error) {
+	cutoff := time.Now().Add(-r.settle)
+	records, _ := r.orders.List(orderstore.Query{States: finished})
+	ids := make([]string, 0, len(records))
+	local := make(map[string]orderstore.State, len(records))
+	for _, rec := range records {
+		if rec.UpdatedAt.Before(cutoff) {
+			ids = append(ids, rec.Order.ID)
+			local[rec.Order.ID] = rec.State
+		}
+	}
+	return r.jobs.Start(JobKind, createdBy, len(ids), func(ctx context.Context, p *jobs.Progress) error {
+		report := Report{StartedAt: time.Now(), Mismatches: []Mismatch{}}
+		defer func() {
+			report.FinishedAt = time.Now()
+			if report.MismatchCount > 0 {
+				log.Printf("reconcile: %d of %d orders disagree with the system of record", report.MismatchCount, report.Checked)
+			}
+			r.mu.Lock()
+			r.last = &report
+			r.mu.Unlock()
+		}()
+		for start := 0; start < len(ids); start += batchSize {
+			if ctx.Err() != nil {
+				report.Error = ctx.Err().Error()
+				return ctx.Err()
+			}
+			batch := ids[start:min(start+batchSize, len(ids))]
+			external, err := r.fetcher.Fetch(ctx, batch)
+			if err != nil {
+				report.Error = err.Error()
+				return err
+			}
+			for _, id := range batch {
+				report.Checked++
+				if agree(local[id], external[id]) {
+					p.Step(id, nil)
+					continue
+				}
+				m := Mismatch{OrderID: id, Local: local[id], External: external[id]}
+				report.MismatchCount++
+				if len(report.Mismatches) < maxMismatches {
+					report.Mismatches = append(report.Mismatches, m)
+				}
+				p.Step(id, m)
+			}
+		}
+		return nil
+	})
+}
+
+// agree reports whether the states match. Orders cancelled or removed
+// before processing may never have reached the system of record.
+func agree(local, external orderstore.State) bool {
+	return local == external ||
+		(external == "" && (local == orderstore.Cancelled || local == orderstore.Removed))
+}
+
+// Last returns the report of the last finished run.
+func (r *Reconciler) Last() (Report, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.last == nil {
+		return Report{}, false
+	}
+	return *r.last, true
+}
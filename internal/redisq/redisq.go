@@ -0,0 +1,315 @@
+// Package redisq is a small Redis client for the commands the pool's
+// Redis queues need. It speaks RESP2 over pooled connections; a command
+// that fails on the wire closes its connection, and the next one dials
+// again.
+package redisq
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultTimeout bounds commands whose context has no deadline.
+const defaultTimeout = 5 * time.Second
+
+// maxIdle is how many idle connections are kept for reuse.
+const maxIdle = 64
+
+// maxBulk caps the size of a reply's strings.
+const maxBulk = 64 << 20
+
+// Error is an error reply, such as a wrong type or a script error.
+type Error string
+
+func (e Error) Error() string { return string(e) }
+
+// Config addresses a server. Keys are prefixed with Prefix and a colon.
+type Config struct {
+	Addr     string
+	Username string // for ACL users; empty authenticates with Password alone
+	Password string
+	DB       int
+	TLS      bool
+	Prefix   string
+
+	DialTimeout time.Duration
+}
+
+// Client runs commands on a pool of connections. It is safe for
+// concurrent use; blocking commands hold a connection until they return.
+type Client struct {
+	cfg Config
+
+	mu     sync.Mutex
+	idle   []*conn
+	closed bool
+}
+
+type conn struct {
+	net.Conn
+	r *bufio.Reader
+	w *bufio.Writer
+
+	// interrupted is set once a cancelled context has moved the deadline,
+	// after which the connection can't be reused.
+	interrupted bool
+}
+
+// New returns a client for cfg. Connections are dialed on first use.
+func New(cfg Config) *Client {
+	if cfg.DialTimeout == 0 {
+		cfg.DialTimeout = defaultTimeout
+	}
+	return &Client{cfg: cfg}
+}
+
+// Key joins parts under the client's prefix.
+func (c *Client) Key(parts ...string) string {
+	if c.cfg.Prefix == "" {
+		return strings.Join(parts, ":")
+	}
+	return c.cfg.Prefix + ":" + strings.Join(parts, ":")
+}
+
+// Ping checks that the server answers.
+func (c *Client) Ping(ctx context.Context) error {
+	_, err := c.Do(ctx, "PING")
+	return err
+}
+
+// Do runs one command. Replies are a string, an int64, nil for a nil
+// reply, a []any for an array, or an Error.
+func (c *Client) Do(ctx context.Context, args ...string) (any, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, defaultTimeout)
+		defer cancel()
+	}
+	cn, err := c.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	reply, err := cn.do(ctx, args)
+	var redisErr Error
+	if cn.interrupted || err != nil && !errors.As(err, &redisErr) {
+		cn.Close()
+	} else {
+		c.put(cn)
+	}
+	return reply, err
+}
+
+// Eval runs a Lua script on keys with args.
+func (c *Client) Eval(ctx context.Context, script string, keys []string, args ...string) (any, error) {
+	cmd := append([]string{"EVAL", script, strconv.Itoa(len(keys))}, keys...)
+	return c.Do(ctx, append(cmd, args...)...)
+}
+
+// Close closes the idle connections; connections in use are closed when
+// they are returned.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	for _, cn := range c.idle {
+		cn.Close()
+	}
+	c.idle = nil
+	return nil
+}
+
+func (c *Client) get(ctx context.Context) (*conn, error) {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil, net.ErrClosed
+	}
+	if n := len(c.idle); n > 0 {
+		cn := c.idle[n-1]
+		c.idle = c.idle[:n-1]
+		c.mu.Unlock()
+		return cn, nil
+	}
+	c.mu.Unlock()
+	return c.dial(ctx)
+}
+
+func (c *Client) put(cn *conn) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed || len(c.idle) >= maxIdle {
+		cn.Close()
+		return
+	}
+	c.idle = append(c.idle, cn)
+}
+
+func (c *Client) dial(ctx context.Context) (*conn, error) {
+	dialer := &net.Dialer{Timeout: c.cfg.DialTimeout}
+	var nc net.Conn
+	var err error
+	if c.cfg.TLS {
+		host, _, _ := net.SplitHostPort(c.cfg.Addr)
+		td := &tls.Dialer{NetDialer: dialer, Config: &tls.Config{ServerName: host}}
+		nc, err = td.DialContext(ctx, "tcp", c.cfg.Addr)
+	} else {
+		nc, err = dialer.DialContext(ctx, "tcp", c.cfg.Addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	cn := &conn{Conn: nc, r: bufio.NewReader(nc), w: bufio.NewWriter(nc)}
+	var setup [][]string
+	switch {
+	case c.cfg.Username != "":
+		setup = append(setup, []string{"AUTH", c.cfg.Username, c.cfg.Password})
+	case c.cfg.Password != "":
+		setup = append(setup, []string{"AUTH", c.cfg.Password})
+	}
+	if c.cfg.DB != 0 {
+		setup = append(setup, []string{"SELECT", strconv.Itoa(c.cfg.DB)})
+	}
+	for _, args := range setup {
+		if _, err := cn.do(ctx, args); err != nil {
+			nc.Close()
+			return nil, fmt.Errorf("%s: %w", args[0], err)
+		}
+	}
+	return cn, nil
+}
+
+func (cn *conn) do(ctx context.Context, args []string) (any, error) {
+	deadline, _ := ctx.Deadline()
+	if err := cn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+	// Unblock a blocking command as soon as ctx is cancelled.
+	stop := context.AfterFunc(ctx, func() { cn.SetDeadline(time.Unix(1, 0)) })
+	defer func() {
+		if !stop() {
+			cn.interrupted = true
+		}
+	}()
+
+	fmt.Fprintf(cn.w, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(cn.w, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if err := cn.w.Flush(); err != nil {
+		return nil, err
+	}
+	reply, err := cn.read()
+	if err != nil && ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	return reply, err
+}
+
+func (cn *conn) read() (any, error) {
+	line, err := cn.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("redis: empty reply")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, Error(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n > maxBulk {
+			return nil, fmt.Errorf("redis: bad bulk length %q", line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(cn.r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("redis: bad array length %q", line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		items := make([]any, n)
+		var itemErr error
+		for i := range items {
+			item, err := cn.read()
+			var redisErr Error
+			if errors.As(err, &redisErr) {
+				itemErr = err // the rest of the array is still read
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			items[i] = item
+		}
+		return items, itemErr
+	}
+	return nil, fmt.Errorf("redis: unexpected reply %q", line)
+}
+
+// Int returns an integer reply.
+func Int(reply any, err error) (int64, error) {
+	if err != nil {
+		return 0, err
+	}
+	n, ok := reply.(int64)
+	if !ok {
+		return 0, fmt.Errorf("redis: reply %T is not an integer", reply)
+	}
+	return n, nil
+}
+
+// String returns a string reply and whether it was not nil.
+func String(reply any, err error) (string, bool, error) {
+	if err != nil || reply == nil {
+		return "", false, err
+	}
+	s, ok := reply.(string)
+	if !ok {
+		return "", false, fmt.Errorf("redis: reply %T is not a string", reply)
+	}
+	return s, true, nil
+}
+
+// Strings returns an array reply of strings.
+func Strings(reply any, err error) ([]string, error) {
+	if err != nil || reply == nil {
+		return nil, err
+	}
+	items, ok := reply.([]any)
+	if !ok {
+		return nil, fmt.Errorf("redis: reply %T is not an array", reply)
+	}
+	out := make([]string, 0, len(items))
+	for _, item := range items {
+		s, ok := item.(string)
+		if !ok {
+			return nil, fmt.Errorf("redis: array item %T is not a string", item)
+		}
+		out = append(out, s)
+	}
+	return out, nil
+}
@@ -0,0 +1,166 @@
+package secrets
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// EnvProvider reads secrets from environment variables. The name is upper
+// cased and prefixed, so "admin_key" becomes "<Prefix>ADMIN_KEY".
+type EnvProvider struct {
+	Prefix string
+}
+
+func (p EnvProvider) Get(_ context.Context, name string) (string, error) {
+	v, ok := os.LookupEnv(p.Prefix + strings.ToUpper(name))
+	if !ok {
+		return "", ErrNotFound
+	}
+	return v, nil
+}
+
+// FileProvider reads secrets from a JSON object sealed with AES-256-GCM.
+// The file is re-read on every Get so replacing it rotates the secrets.
+type FileProvider struct {
+	Path string
+	Key  []byte // 32 bytes
+}
+
+func (p FileProvider) Get(_ context.Context, name string) (string, error) {
+	sealed, err := os.ReadFile(p.Path)
+	if err != nil {
+		return "", err
+	}
+	plain, err := Open(p.Key, sealed)
+	if err != nil {
+		return "", err
+	}
+
+	var values map[string]string
+	if err := json.Unmarshal(plain, &values); err != nil {
+		return "", fmt.Errorf("parse secrets file: %w", err)
+	}
+	v, ok := values[name]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return v, nil
+}
+
+// Seal encrypts plaintext with AES-256-GCM, prefixing the random nonce.
+func Seal(key, plaintext []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// Open reverses Seal.
+func Open(key, sealed []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("sealed data too short")
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	plain, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt secrets: %w", err)
+	}
+	return plain, nil
+}
+
+// ParseKey decodes a hex encoded 32-byte key.
+func ParseKey(s string) ([]byte, error) {
+	key, err := hex.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("secrets key must be hex: %w", err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("secrets key must be 32 bytes, got %d", len(key))
+	}
+	return key, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// VaultProvider reads from a HashiCorp Vault KV v2 engine. Names take the
+// form "path#field"; the field defaults to "value".
+type VaultProvider struct {
+	Addr   string
+	Mount  string // defaults to "secret"
+	Token  string
+	Client *http.Client
+}
+
+func (p VaultProvider) Get(ctx context.Context, name string) (string, error) {
+	path, field, ok := strings.Cut(name, "#")
+	if !ok {
+		field = "value"
+	}
+	mount := p.Mount
+	if mount == "" {
+		mount = "secret"
+	}
+	client := p.Client
+	if client == nil {
+		client = &http.Client{Timeout: 5 * time.Second}
+	}
+
+	url := fmt.Sprintf("%s/v1/%s/data/%s", strings.TrimRight(p.Addr, "/"), mount, path)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", p.Token)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return "", ErrNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vault returned status %d", resp.StatusCode)
+	}
+
+	var body struct {
+		Data struct {
+			Data map[string]any `json:"data"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("decode vault response: %w", err)
+	}
+	v, ok := body.Data.Data[field].(string)
+	if !ok {
+		return "", ErrNotFound
+	}
+	return v, nil
+}
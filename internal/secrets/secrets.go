@@ -0,0 +1,119 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RefPrefix marks a config value as a reference to a secret rather than a
+// literal, e.g. "secret:admin_key".
+const RefPrefix = "secret:"
+
+var ErrNotFound = errors.New("secret not found")
+
+// Provider fetches the current value of a named secret.
+type Provider interface {
+	Get(ctx context.Context, name string) (string, error)
+}
+
+// Value holds a resolved secret. It is updated in place on rotation, so
+// callers should read it with Get on every use instead of copying it.
+type Value struct {
+	ref string
+	v   atomic.Value
+}
+
+func (v *Value) Get() string {
+	s, _ := v.v.Load().(string)
+	return s
+}
+
+// Manager resolves secret references through a provider and refreshes
+// them periodically so rotated secrets are picked up without a restart.
+type Manager struct {
+	provider Provider
+	refresh  time.Duration
+
+	mu     sync.Mutex
+	values map[string]*Value
+}
+
+func NewManager(provider Provider, refresh time.Duration) *Manager {
+	return &Manager{
+		provider: provider,
+		refresh:  refresh,
+		values:   make(map[string]*Value),
+	}
+}
+
+// Resolve returns the value behind ref. Strings without the "secret:"
+// prefix are treated as literals and never refreshed.
+func (m *Manager) Resolve(ctx context.Context, ref string) (*Value, error) {
+	name, ok := strings.CutPrefix(ref, RefPrefix)
+	if !ok {
+		v := &Value{}
+		v.v.Store(ref)
+		return v, nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if v, ok := m.values[name]; ok {
+		return v, nil
+	}
+
+	s, err := m.provider.Get(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("resolve secret %q: %w", name, err)
+	}
+	v := &Value{ref: name}
+	v.v.Store(s)
+	m.values[name] = v
+	return v, nil
+}
+
+// Run refreshes all resolved secrets until ctx is cancelled. A failed
+// refresh keeps the previous value.
+func (m *Manager) Run(ctx context.Context) {
+	if m.refresh <= 0 {
+		return
+	}
+	ticker := time.NewTicker(m.refresh)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.refreshAll(ctx)
+		}
+	}
+}
+
+func (m *Manager) refreshAll(ctx context.Context) {
+	m.mu.Lock()
+	values := make([]*Value, 0, len(m.values))
+	for _, v := range m.values {
+		values = append(values, v)
+	}
+	m.mu.Unlock()
+
+	for _, v := range values {
+		s, err := m.provider.Get(ctx, v.ref)
+		if err != nil {
+			log.Printf("secrets: refresh %q failed: %v", v.ref, err)
+			continue
+		}
+		if s != v.Get() {
+			log.Printf("secrets: %q rotated", v.ref)
+			v.v.Store(s)
+		}
+	}
+}
@@ -0,0 +1,264 @@
+// Package selftest runs synthetic orders through the pool before the
+// service takes traffic, as a deployment gate. Each configured pipeline
+// processes one order with its real steps, and a pipeline with a fake
+// processor takes orders down every path: success, a validation failure,
+// a retry, a dead letter and a panic. Queues and order records are kept in memory,
+// so nothing outside the process is touched.
+package selftest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/orderstore"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/pkg/models"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/processor"
+)
+
+// timeout bounds how long a pool may take to deliver its results.
+const timeout = 30 * time.Second
+
+// errTransient fails orders the way an unreachable provider would, so
+// they are retried.
+var errTransient = errors.New("selftest: transient failure")
+
+// Run checks pipelines and every order path, logging each check that
+// passes. It returns the failed checks joined, or nil.
+func Run(ctx context.Context, pipelines []processor.PipelineConfig) error {
+	var errs []error
+	for _, cfg := range pipelines {
+		if err := checkPipeline(ctx, cfg); err != nil {
+			errs = append(errs, fmt.Errorf("pipeline %q: %w", cfg.Name, err))
+		}
+	}
+	if err := checkPaths(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("paths: %w", err))
+	}
+	return errors.Join(errs...)
+}
+
+// checkPipeline processes one valid order with cfg's steps. The pipeline
+// runs on its own, in memory and without a canary.
+func checkPipeline(ctx context.Context, cfg processor.PipelineConfig) error {
+	cfg.Redis, cfg.Node, cfg.SpillDir, cfg.Canary = nil, "", "", nil
+	r, err := start(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer r.stop()
+
+	o := order("selftest-" + cfg.Name)
+	if err := r.pool.Submit(o); err != nil {
+		return fmt.Errorf("submit: %w", err)
+	}
+	results, err := r.wait(o.ID)
+	if err != nil {
+		return err
+	}
+	if res := results[o.ID]; !res.Success {
+		return fmt.Errorf("order failed in %s: %s", res.FailedStep, res.Error)
+	}
+	if err := r.expectState(o.ID, orderstore.Processed); err != nil {
+		return err
+	}
+	if s := r.pool.Stats(); s.TotalProcessed != 1 || s.SuccessCount != 1 || s.ErrorCount != 0 {
+		return fmt.Errorf("counted %d processed, %d succeeded, %d failed; want 1, 1, 0", s.TotalProcessed, s.SuccessCount, s.ErrorCount)
+	}
+	log.Printf("selftest: pipeline %s ok", cfg.Name)
+	return nil
+}
+
+// path is an order's way through the fake pipeline and what it must end
+// with.
+type path struct {
+	name     string
+	success  bool
+	attempts int
+	code     string
+	state    orderstore.State
+}
+
+var paths = []path{
+	{name: "success", success: true, attempts: 1, state: orderstore.Processed},
+	{name: "validation", attempts: 1, code: models.CodeAmountOverLimit, state: orderstore.Failed},
+	{name: "retry", success: true, attempts: 2, state: orderstore.Processed},
+	{name: "dead-letter", attempts: 3, state: orderstore.Failed},
+	{name: "panic", attempts: 1, code: models.CodePanic, state: orderstore.Failed},
+}
+
+// checkPaths sends an order down each path of a pipeline whose fake
+// processor fails orders by their "selftest" tag, and one invalid order
+// that must be rejected before it is queued.
+func checkPaths(ctx context.Context) error {
+	var mu sync.Mutex
+	attempts := make(map[string]int)
+	fake := processor.ProcessorFunc(func(_ context.Context, o models.Order) (models.ProcessedOrder, error) {
+		mu.Lock()
+		attempts[o.ID]++
+		n := attempts[o.ID]
+		mu.Unlock()
+		switch o.Tags["selftest"] {
+		case "validation":
+			return models.ProcessedOrder{}, models.NewValidationError(models.CodeAmountOverLimit)
+		case "retry":
+			if n == 1 {
+				return models.ProcessedOrder{}, errTransient
+			}
+		case "dead-letter":
+			return models.ProcessedOrder{}, errTransient
+		case "panic":
+			panic("selftest: panicking processor")
+		}
+		return models.ProcessedOrder{Order: o}, nil
+	})
+	r, err := start(ctx, processor.PipelineConfig{
+		Name:      "selftest",
+		Workers:   2,
+		Buffer:    len(paths),
+		Processor: fake,
+		Retry:     processor.RetryPolicy{MaxAttempts: 3, BaseDelay: 10 * time.Millisecond, MaxDelay: 50 * time.Millisecond},
+	})
+	if err != nil {
+		return err
+	}
+	defer r.stop()
+
+	invalid := order("selftest-rejected")
+	invalid.Address = ""
+	if err := invalid.Validate(); err == nil || !slices.ContainsFunc(models.AsValidationErrors(err, ""), func(e *models.ValidationError) bool {
+		return e.Code == models.CodeAddressRequired
+	}) {
+		return fmt.Errorf("order without an address wasn't rejected: %v", err)
+	}
+
+	ids := make([]string, len(paths))
+	for i, p := range paths {
+		o := order("selftest-" + p.name)
+		o.Tags["selftest"] = p.name
+		if err := o.Validate(); err != nil {
+			return fmt.Errorf("%s: %w", p.name, err)
+		}
+		if err := r.pool.Submit(o); err != nil {
+			return fmt.Errorf("%s: submit: %w", p.name, err)
+		}
+		ids[i] = o.ID
+	}
+	results, err := r.wait(ids...)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for i, p := range paths {
+		res := results[ids[i]]
+		if res.Success != p.success || res.Attempts != p.attempts || res.ErrorCode != p.code {
+			errs = append(errs, fmt.Errorf("%s: got success %t after %d attempts with code %q; want %t, %d, %q",
+				p.name, res.Success, res.Attempts, res.ErrorCode, p.success, p.attempts, p.code))
+		}
+		if err := r.expectState(ids[i], p.state); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", p.name, err))
+		}
+	}
+	failed, _ := r.pool.Orders.List(orderstore.Query{States: []orderstore.State{orderstore.Failed}})
+	if !slices.ContainsFunc(failed, func(rec orderstore.Record) bool { return rec.Order.ID == "selftest-dead-letter" }) {
+		errs = append(errs, errors.New("dead-letter: not listed among the failed orders"))
+	}
+	if _, ok := r.pool.Orders.Get(invalid.ID); ok {
+		errs = append(errs, errors.New("rejected order has a record"))
+	}
+	s := r.pool.Stats()
+	if s.TotalProcessed != 5 || s.SuccessCount != 2 || s.ErrorCount != 3 || s.Retries != 3 || s.Panics != 1 {
+		errs = append(errs, fmt.Errorf("counted %d processed, %d succeeded, %d failed, %d retries, %d panics; want 5, 2, 3, 3, 1",
+			s.TotalProcessed, s.SuccessCount, s.ErrorCount, s.Retries, s.Panics))
+	}
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+	log.Printf("selftest: paths ok")
+	return nil
+}
+
+// run is a pool under test with the results it delivered.
+type run struct {
+	pool *processor.Pool
+
+	mu      sync.Mutex
+	results map[string]models.ProcessedOrder
+}
+
+func start(ctx context.Context, cfg processor.PipelineConfig) (*run, error) {
+	pool, err := processor.StartPipelines(ctx, []processor.PipelineConfig{cfg}, nil, nil, processor.ResultsConfig{})
+	if err != nil {
+		return nil, err
+	}
+	r := &run{pool: pool, results: make(map[string]models.ProcessedOrder)}
+	go func() {
+		for res := range pool.Results {
+			r.mu.Lock()
+			r.results[res.Order.ID] = res
+			r.mu.Unlock()
+		}
+	}()
+	return r, nil
+}
+
+// wait returns the results of ids once all have arrived.
+func (r *run) wait(ids ...string) (map[string]models.ProcessedOrder, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		r.mu.Lock()
+		missing := slices.DeleteFunc(slices.Clone(ids), func(id string) bool {
+			_, ok := r.results[id]
+			return ok
+		})
+		results := make(map[string]models.ProcessedOrder, len(ids))
+		for _, id := range ids {
+			results[id] = r.results[id]
+		}
+		r.mu.Unlock()
+		if len(missing) == 0 {
+			return results, nil
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("no result for %v after %s", missing, timeout)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func (r *run) expectState(id string, state orderstore.State) error {
+	rec, ok := r.pool.Orders.Get(id)
+	if !ok {
+		return fmt.Errorf("order %s has no record", id)
+	}
+	if rec.State != state {
+		return fmt.Errorf("order %s is %s, want %s", id, rec.State, state)
+	}
+	return nil
+}
+
+func (r *run) stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	processor.Drain(ctx, r.pool)
+}
+
+func order(id string) models.Order {
+	o := models.Order{
+		ID:        id,
+		Customer:  "selftest@example.com",
+		Address:   "1 Self Test Way",
+		Amount:    models.Whole(5),
+		Items:     []string{"selftest"},
+		Notes:     "self-test order",
+		Tags:      map[string]string{"source": "selftest"},
+		CreatedAt: time.Now(),
+	}
+	o.SetDefaultValues()
+	return o
+}
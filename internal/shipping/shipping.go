@@ -0,0 +1,172 @@
+// Package shipping plans deliveries for the "shipping" pipeline step. Days
+// are counted in the rules' time zone: orders placed after the daily
+// cutoff ship the next day, and nothing ships or arrives on blackout
+// dates. Services are tried in configured order, so list the preferred
+// (usually cheapest) first.
+package shipping
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/pkg/models"
+)
+
+// maxPlanDays bounds how far ahead deliveries are planned.
+const maxPlanDays = 366
+
+var ErrNoService = errors.New("no shipping service fits")
+
+// Service is a shipping service that delivers TransitDays shipping days
+// after the ship date.
+type Service struct {
+	Name        string
+	TransitDays int
+}
+
+type Rules struct {
+	Location   *time.Location
+	Cutoff     time.Duration // time of day; zero ships same-day orders at any hour
+	Blackouts  map[string]bool
+	MaxAdvance time.Duration // how far ahead a window may start; zero is unlimited
+	Services   []Service
+}
+
+// NewRules parses cutoff as "15:04" and blackouts as "2006-01-02" dates.
+func NewRules(loc *time.Location, cutoff string, blackouts []string, maxAdvance time.Duration, services []Service) (*Rules, error) {
+	r := &Rules{Location: loc, Blackouts: make(map[string]bool), MaxAdvance: maxAdvance, Services: services}
+	if cutoff != "" {
+		t, err := time.Parse("15:04", cutoff)
+		if err != nil {
+			return nil, fmt.Errorf("cutoff must be HH:MM: %w", err)
+		}
+		r.Cutoff = time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	}
+	for _, d := range blackouts {
+		if _, err := time.Parse(time.DateOnly, d); err != nil {
+			return nil, fmt.Errorf("blackout date %q must be YYYY-MM-DD", d)
+		}
+		r.Blackouts[d] = true
+	}
+	if len(services) == 0 {
+		return nil, errors.New("at least one service is required")
+	}
+	return r, nil
+}
+
+func (r *Rules) day(t time.Time) time.Time {
+	y, m, d := t.In(r.Location).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, r.Location)
+}
+
+func (r *Rules) blackout(day time.Time) bool {
+	return r.Blackouts[day.Format(time.DateOnly)]
+}
+
+// nextOpen returns day, or the first day after it that isn't a blackout.
+func (r *Rules) nextOpen(day time.Time) time.Time {
+	for i := 0; i < maxPlanDays && r.blackout(day); i++ {
+		day = day.AddDate(0, 0, 1)
+	}
+	return day
+}
+
+// firstShipDay is today before the cutoff and tomorrow after it.
+func (r *Rules) firstShipDay(now time.Time) time.Time {
+	today := r.day(now)
+	if r.Cutoff > 0 && now.In(r.Location).Sub(today) >= r.Cutoff {
+		today = today.AddDate(0, 0, 1)
+	}
+	return r.nextOpen(today)
+}
+
+// arrival counts transit days from ship, skipping blackouts.
+func (r *Rules) arrival(ship time.Time, s Service) time.Time {
+	day := ship
+	for range s.TransitDays {
+		day = r.nextOpen(day.AddDate(0, 0, 1))
+	}
+	return day
+}
+
+// Plan picks the first service, and the earliest ship date, that delivers
+// within the order's window. Orders without a window take the first
+// service as soon as possible.
+func (r *Rules) Plan(o models.Order, now time.Time) (models.Shipment, error) {
+	first := r.firstShipDay(now)
+	w := o.RequestedDeliveryWindow
+	if w == nil {
+		s := r.Services[0]
+		return models.Shipment{Service: s.Name, ShipDate: first, EstimatedDelivery: r.arrival(first, s)}, nil
+	}
+	start, end := r.day(w.Start), r.day(w.End)
+	for _, s := range r.Services {
+		// Shipping later can move an early arrival into the window.
+		for ship, i := first, 0; i < maxPlanDays; ship, i = r.nextOpen(ship.AddDate(0, 0, 1)), i+1 {
+			arrive := r.arrival(ship, s)
+			if arrive.After(end) {
+				break
+			}
+			if !arrive.Before(start) {
+				return models.Shipment{Service: s.Name, ShipDate: ship, EstimatedDelivery: arrive}, nil
+			}
+		}
+	}
+	return models.Shipment{}, ErrNoService
+}
+
+// Check validates an order's requested delivery window at submission, so
+// windows that can't be met are rejected up front. Orders without a
+// window, or with a malformed one reported by Order.Validate, pass. A nil
+// Rules accepts any window.
+func (r *Rules) Check(o models.Order, now time.Time) error {
+	w := o.RequestedDeliveryWindow
+	if r == nil || w == nil || !w.End.After(w.Start) {
+		return nil
+	}
+	const field = "requested_delivery_window"
+	if r.MaxAdvance > 0 && w.Start.After(now.Add(r.MaxAdvance)) {
+		return models.NewFieldError(field, models.CodeDeliveryWindowTooFar, int(r.MaxAdvance.Hours()/24))
+	}
+	if _, err := r.Plan(o, now); err == nil {
+		return nil
+	}
+	open := false
+	for day, i := r.day(w.Start), 0; !day.After(r.day(w.End)) && i < maxPlanDays; day, i = day.AddDate(0, 0, 1), i+1 {
+		if !r.blackout(day) {
+			open = true
+			break
+		}
+	}
+	if !open {
+		return models.NewFieldError(field, models.CodeDeliveryWindowBlackout)
+	}
+	earliest := r.arrival(r.firstShipDay(now), r.fastest())
+	return models.NewFieldError(field, models.CodeDeliveryWindowUnreachable, earliest.Format(time.DateOnly))
+}
+
+func (r *Rules) fastest() Service {
+	fastest := r.Services[0]
+	for _, s := range r.Services[1:] {
+		if s.TransitDays < fastest.TransitDays {
+			fastest = s
+		}
+	}
+	return fastest
+}
+
+// Step returns a pipeline step that records the planned shipment on the
+// order. An order whose window can no longer be met fails with
+// models.CodeNoShippingService.
+func Step(rules *Rules) func(context.Context, *models.ProcessedOrder) error {
+	return func(_ context.Context, processedOrder *models.ProcessedOrder) error {
+		shipment, err := rules.Plan(processedOrder.Order, time.Now())
+		if err != nil {
+			return models.NewValidationError(models.CodeNoShippingService)
+		}
+		processedOrder.Shipment = &shipment
+		return nil
+	}
+}
@@ -0,0 +1,62 @@
+// Package sketch has compact probabilistic summaries for stats that would
+// otherwise need unbounded memory.
+package sketch
+
+import (
+	"math"
+	"math/bits"
+)
+
+// HLL is a HyperLogLog distinct counter. With precision p it uses 2^p bytes
+// and has a standard error of about 1.04/sqrt(2^p), e.g. 1.6% for p=12.
+type HLL struct {
+	p         uint8
+	registers []uint8
+}
+
+func NewHLL(p uint8) *HLL {
+	return &HLL{p: p, registers: make([]uint8, 1<<p)}
+}
+
+// Add records a 64-bit hash of an item.
+func (h *HLL) Add(hash uint64) {
+	idx := hash >> (64 - h.p)
+	w := hash<<h.p | 1<<(h.p-1) // guard bit bounds the run of zeros
+	rho := uint8(bits.LeadingZeros64(w)) + 1
+	if rho > h.registers[idx] {
+		h.registers[idx] = rho
+	}
+}
+
+// Merge folds other, which must have the same precision, into h.
+func (h *HLL) Merge(other *HLL) {
+	for i, r := range other.registers {
+		if r > h.registers[i] {
+			h.registers[i] = r
+		}
+	}
+}
+
+func (h *HLL) Reset() {
+	clear(h.registers)
+}
+
+// Estimate returns the approximate number of distinct items added.
+func (h *HLL) Estimate() uint64 {
+	m := float64(len(h.registers))
+	var sum float64
+	zeros := 0
+	for _, r := range h.registers {
+		sum += 1 / float64(uint64(1)<<r)
+		if r == 0 {
+			zeros++
+		}
+	}
+	alpha := 0.7213 / (1 + 1.079/m)
+	estimate := alpha * m * m / sum
+	// Small cardinalities are more accurate with linear counting.
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return uint64(estimate + 0.5)
+}
@@ -0,0 +1,51 @@
+package sketch
+
+import "slices"
+
+// Latencies keeps the latest samples of a latency, in fixed memory, to
+// estimate its percentiles over recent traffic. It isn't safe for
+// concurrent use.
+type Latencies struct {
+	samples []int64
+	next    int
+	full    bool
+}
+
+// NewLatencies keeps the latest size samples.
+func NewLatencies(size int) *Latencies {
+	return &Latencies{samples: make([]int64, size)}
+}
+
+func (l *Latencies) Add(v int64) {
+	l.samples[l.next] = v
+	l.next++
+	if l.next == len(l.samples) {
+		l.next, l.full = 0, true
+	}
+}
+
+// Len is the number of samples kept.
+func (l *Latencies) Len() int {
+	if l.full {
+		return len(l.samples)
+	}
+	return l.next
+}
+
+// Percentiles returns the nearest-rank percentile of the kept samples for
+// each of ps, which are between 0 and 100. Without samples it returns
+// zeros.
+func (l *Latencies) Percentiles(ps ...float64) []int64 {
+	out := make([]int64, len(ps))
+	n := l.Len()
+	if n == 0 {
+		return out
+	}
+	sorted := slices.Clone(l.samples[:n])
+	slices.Sort(sorted)
+	for i, p := range ps {
+		rank := int(p / 100 * float64(n))
+		out[i] = sorted[min(rank, n-1)]
+	}
+	return out
+}
@@ -0,0 +1,147 @@
+package sketch
+
+import (
+	"hash/maphash"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	cmsDepth      = 4
+	cmsWidth      = 2048
+	maxCandidates = 256
+	topResolution = 5 * time.Minute
+	topBuckets    = 12 // one hour of history
+)
+
+// CountMin estimates item frequencies in fixed memory. Estimates never
+// undercount and overcount by at most a small share of the total.
+type CountMin struct {
+	counts [cmsDepth * cmsWidth]uint32
+}
+
+// rows derives one index per row from a single hash by double hashing.
+func rows(hash uint64) [cmsDepth]int {
+	h1, h2 := uint32(hash), uint32(hash>>32)|1
+	var idx [cmsDepth]int
+	for i := range idx {
+		idx[i] = i*cmsWidth + int((h1+uint32(i)*h2)%cmsWidth)
+	}
+	return idx
+}
+
+func (c *CountMin) Add(hash uint64) {
+	for _, i := range rows(hash) {
+		c.counts[i]++
+	}
+}
+
+func (c *CountMin) Estimate(hash uint64) uint64 {
+	least := ^uint32(0)
+	for _, i := range rows(hash) {
+		least = min(least, c.counts[i])
+	}
+	return uint64(least)
+}
+
+func (c *CountMin) Merge(other *CountMin) {
+	for i, n := range other.counts {
+		c.counts[i] += n
+	}
+}
+
+// Entry is one item of a top-K list.
+type Entry struct {
+	Key   string `json:"key"`
+	Count uint64 `json:"count"`
+}
+
+// TopK tracks the most frequent strings over the last 5 minutes and hour.
+// Each 5-minute bucket keeps a count-min sketch and up to 256 candidate
+// keys; a window's ranking re-estimates the union of its candidates
+// against the merged sketches.
+type TopK struct {
+	seed maphash.Seed
+
+	mu      sync.Mutex
+	buckets [topBuckets]topBucket
+}
+
+type topBucket struct {
+	start      time.Time
+	cms        CountMin
+	candidates map[string]uint64 // key to hash
+}
+
+func NewTopK() *TopK {
+	return &TopK{seed: maphash.MakeSeed()}
+}
+
+// Add counts one occurrence of s at now.
+func (t *TopK) Add(s string, now time.Time) {
+	hash := maphash.String(t.seed, s)
+	start := now.Truncate(topResolution)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	b := &t.buckets[int(start.UnixNano()/int64(topResolution))%topBuckets]
+	if !b.start.Equal(start) {
+		*b = topBucket{start: start, candidates: make(map[string]uint64)}
+	}
+	b.cms.Add(hash)
+	if _, ok := b.candidates[s]; ok {
+		return
+	}
+	if len(b.candidates) < maxCandidates {
+		b.candidates[s] = hash
+		return
+	}
+	// Replace the weakest candidate if s now outranks it.
+	weakest, weakestCount := "", ^uint64(0)
+	for k, h := range b.candidates {
+		if n := b.cms.Estimate(h); n < weakestCount {
+			weakest, weakestCount = k, n
+		}
+	}
+	if b.cms.Estimate(hash) > weakestCount {
+		delete(b.candidates, weakest)
+		b.candidates[s] = hash
+	}
+}
+
+// Top returns the k most frequent strings seen within span of now, most
+// frequent first.
+func (t *TopK) Top(k int, span time.Duration, now time.Time) []Entry {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var merged CountMin
+	candidates := make(map[string]uint64)
+	oldest := now.Truncate(topResolution).Add(-span + topResolution)
+	for i := range t.buckets {
+		b := &t.buckets[i]
+		if b.start.IsZero() || b.start.Before(oldest) || b.start.After(now) {
+			continue
+		}
+		merged.Merge(&b.cms)
+		for key, hash := range b.candidates {
+			candidates[key] = hash
+		}
+	}
+
+	entries := make([]Entry, 0, len(candidates))
+	for key, hash := range candidates {
+		entries = append(entries, Entry{Key: key, Count: merged.Estimate(hash)})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Count != entries[j].Count {
+			return entries[i].Count > entries[j].Count
+		}
+		return entries[i].Key < entries[j].Key
+	})
+	if len(entries) > k {
+		entries = entries[:k]
+	}
+	return entries
+}
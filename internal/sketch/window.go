@@ -0,0 +1,89 @@
+package sketch
+
+import (
+	"hash/maphash"
+	"sync"
+	"time"
+)
+
+const windowPrecision = 12
+
+// Distinct counts distinct strings over trailing windows of 5 minutes, 1
+// hour and 24 hours using one HLL per minute for the last hour and one per
+// hour for the last day, about 340KB in total.
+type Distinct struct {
+	seed maphash.Seed
+
+	mu      sync.Mutex
+	minutes ring
+	hours   ring
+}
+
+type ring struct {
+	resolution time.Duration
+	buckets    []bucket
+}
+
+type bucket struct {
+	start time.Time
+	hll   *HLL
+}
+
+func NewDistinct() *Distinct {
+	return &Distinct{
+		seed:    maphash.MakeSeed(),
+		minutes: newRing(time.Minute, 60),
+		hours:   newRing(time.Hour, 24),
+	}
+}
+
+func newRing(resolution time.Duration, n int) ring {
+	r := ring{resolution: resolution, buckets: make([]bucket, n)}
+	for i := range r.buckets {
+		r.buckets[i].hll = NewHLL(windowPrecision)
+	}
+	return r
+}
+
+// Add records s as seen at now.
+func (d *Distinct) Add(s string, now time.Time) {
+	hash := maphash.String(d.seed, s)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.minutes.add(hash, now)
+	d.hours.add(hash, now)
+}
+
+func (r *ring) add(hash uint64, now time.Time) {
+	start := now.Truncate(r.resolution)
+	b := &r.buckets[int(start.UnixNano()/int64(r.resolution))%len(r.buckets)]
+	if !b.start.Equal(start) {
+		b.start = start
+		b.hll.Reset()
+	}
+	b.hll.Add(hash)
+}
+
+// count estimates distinct items in buckets that started within span of now.
+func (r *ring) count(span time.Duration, now time.Time) uint64 {
+	merged := NewHLL(windowPrecision)
+	oldest := now.Truncate(r.resolution).Add(-span + r.resolution)
+	for _, b := range r.buckets {
+		if !b.start.IsZero() && !b.start.Before(oldest) && !b.start.After(now) {
+			merged.Merge(b.hll)
+		}
+	}
+	return merged.Estimate()
+}
+
+// Counts estimates distinct items per trailing window, keyed "5m", "1h"
+// and "24h".
+func (d *Distinct) Counts(now time.Time) map[string]uint64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return map[string]uint64{
+		"5m":  d.minutes.count(5*time.Minute, now),
+		"1h":  d.minutes.count(time.Hour, now),
+		"24h": d.hours.count(24*time.Hour, now),
+	}
+}
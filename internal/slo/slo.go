@@ -0,0 +1,110 @@
+package slo
+
+import (
+	"sync"
+	"time"
+)
+
+// Tracker counts good and bad events in time buckets and reports the error
+// budget burn rate over several trailing windows. An event is bad if it
+// failed or its end-to-end latency exceeded the threshold.
+type Tracker struct {
+	objective  float64
+	threshold  time.Duration
+	windows    []time.Duration
+	resolution time.Duration
+
+	mu      sync.Mutex
+	buckets []bucket
+}
+
+type bucket struct {
+	start time.Time
+	good  int64
+	bad   int64
+}
+
+// WindowReport summarises one trailing window.
+type WindowReport struct {
+	Window    string  `json:"window"`
+	Total     int64   `json:"total"`
+	Bad       int64   `json:"bad"`
+	ErrorRate float64 `json:"error_rate"`
+	BurnRate  float64 `json:"burn_rate"` // 1.0 spends the budget exactly over the SLO period
+}
+
+// Report is the SLO state returned by the API.
+type Report struct {
+	Objective   float64        `json:"objective"`
+	ThresholdMs int64          `json:"threshold_ms"`
+	Windows     []WindowReport `json:"windows"`
+}
+
+func NewTracker(objective float64, threshold time.Duration, windows []time.Duration) *Tracker {
+	longest, shortest := windows[0], windows[0]
+	for _, w := range windows {
+		longest = max(longest, w)
+		shortest = min(shortest, w)
+	}
+	// Keep ~30 buckets in the shortest window so it is reasonably precise.
+	resolution := max(shortest/30, time.Second)
+
+	return &Tracker{
+		objective:  objective,
+		threshold:  threshold,
+		windows:    windows,
+		resolution: resolution,
+		buckets:    make([]bucket, int(longest/resolution)+1),
+	}
+}
+
+// Record adds one terminal order outcome.
+func (t *Tracker) Record(success bool, endToEnd time.Duration) {
+	now := time.Now()
+	start := now.Truncate(t.resolution)
+	idx := int(start.UnixNano()/int64(t.resolution)) % len(t.buckets)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	b := &t.buckets[idx]
+	if !b.start.Equal(start) {
+		*b = bucket{start: start}
+	}
+	if success && endToEnd <= t.threshold {
+		b.good++
+	} else {
+		b.bad++
+	}
+}
+
+// Report computes error and burn rates for every configured window.
+func (t *Tracker) Report() Report {
+	now := time.Now()
+	report := Report{
+		Objective:   t.objective,
+		ThresholdMs: t.threshold.Milliseconds(),
+		Windows:     make([]WindowReport, 0, len(t.windows)),
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, w := range t.windows {
+		cutoff := now.Add(-w)
+		wr := WindowReport{Window: w.String()}
+		for _, b := range t.buckets {
+			if b.start.IsZero() || b.start.Before(cutoff) {
+				continue
+			}
+			wr.Total += b.good + b.bad
+			wr.Bad += b.bad
+		}
+		if wr.Total > 0 {
+			wr.ErrorRate = float64(wr.Bad) / float64(wr.Total)
+			wr.BurnRate = wr.ErrorRate / (1 - t.objective)
+		}
+		report.Windows = append(report.Windows, wr)
+	}
+	return report
+}
@@ -0,0 +1,328 @@
+// Package kafka feeds orders from a Kafka topic to the pool, next to the
+// HTTP API. It consumes through the Confluent REST Proxy's v2 consumer
+// API as a member of a consumer group, so no Kafka client is needed, and
+// commits a record's offset only once its order is queued: a crash
+// redelivers the orders that weren't, rather than losing them.
+package kafka
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/orderstore"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/pkg/models"
+)
+
+const (
+	contentType = "application/vnd.kafka.v2+json"
+	recordsType = "application/vnd.kafka.binary.v2+json"
+
+	// leaveTimeout bounds the calls that commit and leave the group once
+	// the source is stopped.
+	leaveTimeout = 5 * time.Second
+)
+
+// Config sets where orders are read from.
+type Config struct {
+	ProxyURL    string // e.g. http://localhost:8082
+	Topic       string
+	Group       string
+	PollTimeout time.Duration // how long the proxy waits for records
+	MaxBytes    int           // per poll; 0 leaves it to the proxy
+	MaxBackoff  time.Duration // between attempts to queue an order or reach the proxy
+
+	// Client must not retry requests: a retried poll whose first response
+	// was lost would skip that response's records.
+	Client *http.Client
+}
+
+// Submit queues an order read from the topic. Orders failing with a
+// validation error are skipped; any other error, such as a full queue, is
+// retried with backoff, holding up the records behind it.
+type Submit func(models.Order) error
+
+// Stats are the source's counters since start.
+type Stats struct {
+	Topic     string        `json:"topic"`
+	Group     string        `json:"group"`
+	Connected bool          `json:"connected"`
+	Consumed  int64         `json:"consumed"`
+	Queued    int64         `json:"queued"`
+	Rejected  int64         `json:"rejected"` // records skipped as invalid
+	Retries   int64         `json:"retries"`  // failed attempts to queue an order
+	Commits   int64         `json:"commits"`
+	Offsets   map[int]int64 `json:"offsets"` // last committed offset per partition
+	LastError string        `json:"last_error,omitempty"`
+}
+
+// Source consumes orders from one topic.
+type Source struct {
+	cfg    Config
+	submit Submit
+
+	mu    sync.Mutex
+	stats Stats
+}
+
+func New(cfg Config, submit Submit) *Source {
+	return &Source{
+		cfg:    cfg,
+		submit: submit,
+		stats:  Stats{Topic: cfg.Topic, Group: cfg.Group, Offsets: make(map[int]int64)},
+	}
+}
+
+func (s *Source) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := s.stats
+	st.Offsets = maps.Clone(s.stats.Offsets)
+	return st
+}
+
+// record is a message as the proxy returns it in the binary format.
+type record struct {
+	Partition int    `json:"partition"`
+	Offset    int64  `json:"offset"`
+	Value     []byte `json:"value"`
+}
+
+// Run consumes until ctx is done, then commits what it queued and leaves
+// the group. Whenever the proxy fails, the consumer is recreated so it
+// resumes from the committed offsets, so Run only returns once ctx is
+// done.
+func (s *Source) Run(ctx context.Context) error {
+	backoff := time.Second
+	for ctx.Err() == nil {
+		base, err := s.join(ctx)
+		if err == nil {
+			err = s.consume(ctx, base, &backoff)
+			s.leave(ctx, base)
+		}
+		if err == nil || ctx.Err() != nil {
+			continue
+		}
+		s.failed(err)
+		log.Printf("kafka: %v; reconnecting in %s", err, backoff)
+		sleep(ctx, backoff)
+		backoff = min(backoff*2, s.cfg.MaxBackoff)
+	}
+	return nil
+}
+
+// Name names the source for a source.Supervisor.
+func (s *Source) Name() string {
+	return "kafka"
+}
+
+// join creates a consumer instance in the group, subscribed to the topic,
+// and returns its base URI.
+func (s *Source) join(ctx context.Context) (string, error) {
+	var created struct {
+		BaseURI string `json:"base_uri"`
+	}
+	err := s.call(ctx, http.MethodPost, strings.TrimRight(s.cfg.ProxyURL, "/")+"/consumers/"+url.PathEscape(s.cfg.Group), map[string]string{
+		"format":             "binary",
+		"auto.offset.reset":  "earliest",
+		"auto.commit.enable": "false",
+	}, &created)
+	if err != nil {
+		return "", fmt.Errorf("create consumer: %w", err)
+	}
+	if err := s.call(ctx, http.MethodPost, created.BaseURI+"/subscription", map[string][]string{"topics": {s.cfg.Topic}}, nil); err != nil {
+		s.leave(ctx, created.BaseURI)
+		return "", fmt.Errorf("subscribe to %s: %w", s.cfg.Topic, err)
+	}
+	return created.BaseURI, nil
+}
+
+// leave deletes the consumer instance so the group rebalances right away.
+func (s *Source) leave(ctx context.Context, base string) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), leaveTimeout)
+	defer cancel()
+	if err := s.call(ctx, http.MethodDelete, base, nil, nil); err != nil {
+		log.Printf("kafka: leave group: %v", err)
+	}
+	s.mu.Lock()
+	s.stats.Connected = false
+	s.mu.Unlock()
+}
+
+// consume polls records and queues their orders in order, committing
+// after each poll, until ctx is done or the proxy fails.
+func (s *Source) consume(ctx context.Context, base string, backoff *time.Duration) error {
+	q := url.Values{}
+	q.Set("timeout", strconv.FormatInt(s.cfg.PollTimeout.Milliseconds(), 10))
+	if s.cfg.MaxBytes > 0 {
+		q.Set("max_bytes", strconv.Itoa(s.cfg.MaxBytes))
+	}
+	for {
+		var records []record
+		if err := s.call(ctx, http.MethodGet, base+"/records?"+q.Encode(), nil, &records); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("poll: %w", err)
+		}
+		*backoff = time.Second
+		s.mu.Lock()
+		s.stats.Connected = true
+		s.mu.Unlock()
+
+		done := make(map[int]int64)
+		for _, r := range records {
+			if !s.enqueue(ctx, r) {
+				break
+			}
+			done[r.Partition] = r.Offset
+		}
+		if err := s.commit(ctx, base, done); err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+	}
+}
+
+// enqueue hands the record's order to Submit until it's queued or found
+// invalid, reporting false if ctx was done first. Orders without an ID get
+// one from the record's position, so a redelivered order keeps its ID and
+// is skipped as already accepted.
+func (s *Source) enqueue(ctx context.Context, r record) bool {
+	s.count(func(st *Stats) { st.Consumed++ })
+	o, err := models.DecodeOrder(bytes.NewReader(r.Value))
+	if err == nil && o.ID == "" {
+		o.ID = fmt.Sprintf("kafka-%s-%d-%d", s.cfg.Topic, r.Partition, r.Offset)
+	}
+	wait := 100 * time.Millisecond
+	for {
+		if err == nil {
+			err = s.submit(o)
+		}
+		if err == nil {
+			s.count(func(st *Stats) { st.Queued++ })
+			return true
+		}
+		if errors.Is(err, orderstore.ErrExists) {
+			log.Printf("kafka: skipping partition %d offset %d: order %s was accepted already", r.Partition, r.Offset, o.ID)
+			return true
+		}
+		if invalid(err) {
+			s.count(func(st *Stats) { st.Rejected++ })
+			log.Printf("kafka: skipping partition %d offset %d: %v", r.Partition, r.Offset, err)
+			return true
+		}
+		s.count(func(st *Stats) { st.Retries++ })
+		if !sleep(ctx, wait) {
+			return false
+		}
+		wait = min(wait*2, s.cfg.MaxBackoff)
+		err = nil
+	}
+}
+
+// commit commits the last handled offset of each partition. The proxy
+// commits the position after the given offsets. It runs even once ctx is
+// done, so queued orders aren't delivered again.
+func (s *Source) commit(ctx context.Context, base string, done map[int]int64) error {
+	if len(done) == 0 {
+		return nil
+	}
+	type offset struct {
+		Topic     string `json:"topic"`
+		Partition int    `json:"partition"`
+		Offset    int64  `json:"offset"`
+	}
+	var offsets []offset
+	for p, o := range done {
+		offsets = append(offsets, offset{Topic: s.cfg.Topic, Partition: p, Offset: o})
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), leaveTimeout)
+	defer cancel()
+	if err := s.call(ctx, http.MethodPost, base+"/offsets", map[string][]offset{"offsets": offsets}, nil); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	s.count(func(st *Stats) {
+		st.Commits++
+		maps.Copy(st.Offsets, done)
+	})
+	return nil
+}
+
+func (s *Source) call(ctx context.Context, method, u string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if method == http.MethodGet {
+		req.Header.Set("Accept", recordsType)
+	} else {
+		req.Header.Set("Accept", contentType)
+	}
+	resp, err := s.cfg.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (s *Source) count(f func(*Stats)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f(&s.stats)
+}
+
+func (s *Source) failed(err error) {
+	s.count(func(st *Stats) { st.LastError = err.Error() })
+}
+
+// invalid reports whether err means the order can never be queued.
+func invalid(err error) bool {
+	var list models.ValidationErrors
+	var single *models.ValidationError
+	return errors.As(err, &list) || errors.As(err, &single)
+}
+
+// sleep waits for d, reporting false if ctx was done first.
+func sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
@@ -0,0 +1,244 @@
+// Package source runs the adapters that take orders from outside the HTTP
+// API, such as a Kafka topic. A Supervisor starts each adapter, restarts
+// it with backoff when it fails or panics, and lets operators pause and
+// resume it independently of the others.
+package source
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxBackoff caps the delay between restarts of a failing adapter. An
+// adapter that ran for stableAfter before failing restarts right away.
+const (
+	maxBackoff  = time.Minute
+	stableAfter = time.Minute
+)
+
+var ErrNotFound = errors.New("source not found")
+
+// Adapter is one ingest source. Run takes orders until ctx is done; a
+// return before that, with or without an error, is a failure.
+type Adapter interface {
+	Name() string
+	Run(ctx context.Context) error
+}
+
+type State string
+
+const (
+	Running    State = "running"
+	Restarting State = "restarting" // waiting out the backoff after a failure
+	Paused     State = "paused"
+	Stopped    State = "stopped"
+)
+
+// Status describes a supervised adapter.
+type Status struct {
+	Name        string    `json:"name"`
+	State       State     `json:"state"`
+	StartedAt   time.Time `json:"started_at,omitzero"` // of the current or last run
+	Restarts    int       `json:"restarts"`
+	LastError   string    `json:"last_error,omitempty"`
+	LastFailure time.Time `json:"last_failure,omitzero"`
+	RestartAt   time.Time `json:"restart_at,omitzero"` // while restarting
+}
+
+type supervised struct {
+	adapter Adapter
+	status  Status
+	paused  bool
+	cancel  context.CancelFunc // of the current run
+	wake    chan struct{}      // signalled on pause and resume
+}
+
+type Supervisor struct {
+	mu       sync.Mutex
+	adapters []*supervised
+}
+
+func NewSupervisor() *Supervisor {
+	return &Supervisor{}
+}
+
+// Add registers an adapter. It must be called before Run.
+func (s *Supervisor) Add(a Adapter) {
+	s.adapters = append(s.adapters, &supervised{
+		adapter: a,
+		status:  Status{Name: a.Name(), State: Stopped},
+		wake:    make(chan struct{}, 1),
+	})
+}
+
+// Len is the number of adapters.
+func (s *Supervisor) Len() int {
+	return len(s.adapters)
+}
+
+// Run runs every adapter until ctx is done and returns once all of them
+// have stopped.
+func (s *Supervisor) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, sv := range s.adapters {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.supervise(ctx, sv)
+		}()
+	}
+	wg.Wait()
+}
+
+func (s *Supervisor) supervise(ctx context.Context, sv *supervised) {
+	name := sv.status.Name
+	defer s.update(sv, func(st *Status) { st.State, st.RestartAt = Stopped, time.Time{} })
+	backoff := time.Second
+	for {
+		if !s.waitResumed(ctx, sv) {
+			return
+		}
+		runCtx, cancel := context.WithCancel(ctx)
+		started := time.Now()
+		s.mu.Lock()
+		sv.cancel = cancel
+		sv.status.State, sv.status.StartedAt, sv.status.RestartAt = Running, started, time.Time{}
+		s.mu.Unlock()
+
+		err := run(runCtx, sv.adapter)
+		cancel()
+		s.mu.Lock()
+		paused := sv.paused
+		s.mu.Unlock()
+		if ctx.Err() != nil {
+			return
+		}
+		if paused {
+			continue
+		}
+
+		if err == nil {
+			err = errors.New("stopped unexpectedly")
+		}
+		if time.Since(started) >= stableAfter {
+			backoff = time.Second
+		}
+		log.Printf("source %s: %v; restarting in %s", name, err, backoff)
+		s.update(sv, func(st *Status) {
+			st.State = Restarting
+			st.Restarts++
+			st.LastError = err.Error()
+			st.LastFailure = time.Now()
+			st.RestartAt = time.Now().Add(backoff)
+		})
+		t := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return
+		case <-sv.wake: // paused or resumed early
+			t.Stop()
+		case <-t.C:
+		}
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+// waitResumed blocks while sv is paused. It returns false if ctx ended
+// first.
+func (s *Supervisor) waitResumed(ctx context.Context, sv *supervised) bool {
+	for {
+		s.mu.Lock()
+		paused := sv.paused
+		if paused {
+			sv.status.State, sv.status.RestartAt = Paused, time.Time{}
+		}
+		s.mu.Unlock()
+		if !paused {
+			return ctx.Err() == nil
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-sv.wake:
+		}
+	}
+}
+
+// run runs a, turning a panic into an error so the adapter is restarted
+// rather than the process crashing.
+func run(ctx context.Context, a Adapter) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			log.Printf("source %s: panic: %v\n%s", a.Name(), v, debug.Stack())
+			err = fmt.Errorf("panic: %v", v)
+		}
+	}()
+	return a.Run(ctx)
+}
+
+// Pause stops an adapter until Resume. Orders it already handed over
+// stay queued.
+func (s *Supervisor) Pause(name string) (Status, error) {
+	return s.set(name, true)
+}
+
+// Resume restarts a paused adapter, or one waiting to restart after a
+// failure, right away.
+func (s *Supervisor) Resume(name string) (Status, error) {
+	return s.set(name, false)
+}
+
+func (s *Supervisor) set(name string, paused bool) (Status, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, sv := range s.adapters {
+		if !strings.EqualFold(sv.status.Name, name) {
+			continue
+		}
+		changed := sv.paused != paused
+		sv.paused = paused
+		switch {
+		case paused && changed:
+			sv.status.State, sv.status.RestartAt = Paused, time.Time{}
+			if sv.cancel != nil {
+				sv.cancel()
+			}
+		case changed:
+			sv.status.State, sv.status.RestartAt = Restarting, time.Now()
+		}
+		if changed || sv.status.State == Restarting {
+			select {
+			case sv.wake <- struct{}{}:
+			default:
+			}
+		}
+		return sv.status, nil
+	}
+	return Status{}, ErrNotFound
+}
+
+// Status lists the adapters by name.
+func (s *Supervisor) Status() []Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]Status, 0, len(s.adapters))
+	for _, sv := range s.adapters {
+		out = append(out, sv.status)
+	}
+	slices.SortFunc(out, func(a, b Status) int { return strings.Compare(a.Name, b.Name) })
+	return out
+}
+
+func (s *Supervisor) update(sv *supervised, fn func(*Status)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(&sv.status)
+}
@@ -0,0 +1,143 @@
+package stream
+
+import (
+	"sync"
+
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/pkg/models"
+)
+
+// Feed event types.
+const (
+	EventAccepted  = "order-accepted"
+	EventProcessed = "order-processed"
+	EventFailed    = "order-failed"
+)
+
+// Event is one entry of a Feed. IDs count up from 1 per process.
+type Event struct {
+	ID     uint64
+	Type   string
+	Order  models.Order          // of order-accepted events
+	Result models.ProcessedOrder // of the others
+}
+
+// Owner returns the order the event is about.
+func (e Event) Owner() models.Order {
+	if e.Type == EventAccepted {
+		return e.Order
+	}
+	return e.Result.Order
+}
+
+// Feed fans order lifecycle events out to live subscribers, keeping the
+// most recent ones in memory so a subscriber that reconnects can resume
+// after the last event it saw. A subscriber that falls behind is
+// disconnected; it resumes the same way.
+type Feed struct {
+	buffer int
+
+	mu   sync.Mutex
+	ring []Event // event n is at ring[(n-1)%len(ring)]
+	last uint64  // ID of the newest event
+	subs map[*FeedSubscription]struct{}
+}
+
+// NewFeed keeps the last replay events and buffers up to buffer events per
+// subscriber.
+func NewFeed(replay, buffer int) *Feed {
+	return &Feed{
+		buffer: buffer,
+		ring:   make([]Event, replay),
+		subs:   make(map[*FeedSubscription]struct{}),
+	}
+}
+
+// FeedSubscription receives events on C until it is closed, by Close or
+// for falling behind, after which C is closed.
+type FeedSubscription struct {
+	C <-chan Event
+
+	ch   chan Event
+	feed *Feed
+	once sync.Once
+}
+
+// Accepted publishes an order-accepted event. A nil Feed publishes nothing.
+func (f *Feed) Accepted(o models.Order) {
+	if f != nil {
+		f.publish(Event{Type: EventAccepted, Order: o})
+	}
+}
+
+// Processed publishes an order-processed or, for a failure, order-failed
+// event. A nil Feed publishes nothing.
+func (f *Feed) Processed(result models.ProcessedOrder) {
+	if f == nil {
+		return
+	}
+	e := Event{Type: EventProcessed, Result: result}
+	if !result.Success {
+		e.Type = EventFailed
+	}
+	f.publish(e)
+}
+
+func (f *Feed) publish(e Event) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.last++
+	e.ID = f.last
+	f.ring[(e.ID-1)%uint64(len(f.ring))] = e
+	for s := range f.subs {
+		select {
+		case s.ch <- e:
+		default:
+			s.close()
+		}
+	}
+}
+
+// Subscribe starts a subscription. With resume set it also returns the
+// kept events after the one with ID after, and how many of those weren't
+// kept anymore. An ID beyond the newest is from before a restart, so all
+// kept events are returned.
+func (f *Feed) Subscribe(after uint64, resume bool) (sub *FeedSubscription, backlog []Event, skipped uint64) {
+	ch := make(chan Event, f.buffer)
+	sub = &FeedSubscription{C: ch, ch: ch, feed: f}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.subs[sub] = struct{}{}
+	if !resume {
+		return sub, nil, 0
+	}
+	if after > f.last {
+		after = 0
+	}
+	oldest := uint64(1)
+	if kept := uint64(len(f.ring)); f.last > kept {
+		oldest = f.last - kept + 1
+	}
+	if after+1 < oldest {
+		skipped = oldest - after - 1
+		after = oldest - 1
+	}
+	for id := after + 1; id <= f.last; id++ {
+		backlog = append(backlog, f.ring[(id-1)%uint64(len(f.ring))])
+	}
+	return sub, backlog, skipped
+}
+
+// Close unsubscribes. It is safe to call more than once.
+func (s *FeedSubscription) Close() {
+	s.feed.mu.Lock()
+	defer s.feed.mu.Unlock()
+	s.close()
+}
+
+// close must be called with the feed locked.
+func (s *FeedSubscription) close() {
+	s.once.Do(func() {
+		delete(s.feed.subs, s)
+		close(s.ch)
+	})
+}
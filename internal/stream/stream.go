@@ -0,0 +1,131 @@
+// Package stream fans processed order results out to live subscribers such
+// as SSE connections. Each subscriber has a bounded buffer so a slow client
+// can't hold up the results loop or other subscribers.
+package stream
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/pkg/models"
+)
+
+// DropPolicy decides what happens when a subscriber's buffer is full.
+type DropPolicy string
+
+const (
+	DropOldest DropPolicy = "drop_oldest" // discard the oldest buffered result
+	DropNewest DropPolicy = "drop_newest" // discard the result being published
+	Disconnect DropPolicy = "disconnect"  // end the subscription
+)
+
+// ParseDropPolicy validates a policy name.
+func ParseDropPolicy(s string) (DropPolicy, error) {
+	switch p := DropPolicy(s); p {
+	case DropOldest, DropNewest, Disconnect:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown drop policy %q", s)
+}
+
+type Broker struct {
+	buffer int
+	policy DropPolicy
+
+	mu   sync.Mutex
+	subs map[*Subscription]struct{}
+
+	dropped      atomic.Int64
+	disconnected atomic.Int64
+}
+
+// Stats are the broker's subscriber metrics.
+type Stats struct {
+	ActiveSubscribers int   `json:"active_subscribers"`
+	DroppedEvents     int64 `json:"dropped_events"`
+	Disconnected      int64 `json:"disconnected_slow_subscribers"`
+}
+
+func NewBroker(buffer int, policy DropPolicy) *Broker {
+	return &Broker{buffer: buffer, policy: policy, subs: make(map[*Subscription]struct{})}
+}
+
+// Subscription receives results on C until it is closed, by Close or by the
+// Disconnect policy, after which C is closed.
+type Subscription struct {
+	C <-chan models.ProcessedOrder
+
+	ch      chan models.ProcessedOrder
+	broker  *Broker
+	once    sync.Once
+	dropped atomic.Int64
+}
+
+func (b *Broker) Subscribe() *Subscription {
+	ch := make(chan models.ProcessedOrder, b.buffer)
+	s := &Subscription{C: ch, ch: ch, broker: b}
+	b.mu.Lock()
+	b.subs[s] = struct{}{}
+	b.mu.Unlock()
+	return s
+}
+
+// Close unsubscribes. It is safe to call more than once.
+func (s *Subscription) Close() {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+	s.close()
+}
+
+// close must be called with the broker locked.
+func (s *Subscription) close() {
+	s.once.Do(func() {
+		delete(s.broker.subs, s)
+		close(s.ch)
+	})
+}
+
+// Dropped returns how many results this subscriber missed.
+func (s *Subscription) Dropped() int64 {
+	return s.dropped.Load()
+}
+
+// Publish delivers result to every subscriber without blocking.
+func (b *Broker) Publish(result models.ProcessedOrder) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for s := range b.subs {
+		select {
+		case s.ch <- result:
+			continue
+		default:
+		}
+
+		switch b.policy {
+		case Disconnect:
+			b.disconnected.Add(1)
+			s.close()
+			continue
+		case DropOldest:
+			select {
+			case <-s.ch:
+			default:
+			}
+			s.ch <- result // only publishers, holding mu, fill the buffer
+		}
+		s.dropped.Add(1)
+		b.dropped.Add(1)
+	}
+}
+
+func (b *Broker) Stats() Stats {
+	b.mu.Lock()
+	active := len(b.subs)
+	b.mu.Unlock()
+	return Stats{
+		ActiveSubscribers: active,
+		DroppedEvents:     b.dropped.Load(),
+		Disconnected:      b.disconnected.Load(),
+	}
+}
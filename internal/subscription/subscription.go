@@ -0,0 +1,224 @@
+package subscription
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/pkg/models"
+)
+
+// Subscription states.
+const (
+	StatusActive    = "active"
+	StatusPaused    = "paused"
+	StatusCancelled = "cancelled"
+)
+
+// MinInterval is the shortest allowed schedule.
+const MinInterval = time.Minute
+
+// maxLinkedOrders caps how many generated order IDs a subscription keeps.
+const maxLinkedOrders = 100
+
+var (
+	ErrNotFound      = errors.New("subscription not found")
+	ErrCancelled     = errors.New("subscription is cancelled")
+	ErrShortInterval = fmt.Errorf("interval must be at least %s", MinInterval)
+)
+
+// Subscription is a recurring order template.
+type Subscription struct {
+	ID        string       `json:"id"`
+	Template  models.Order `json:"template"`
+	Interval  string       `json:"interval"`
+	Status    string       `json:"status"`
+	CreatedAt time.Time    `json:"created_at"`
+	NextRunAt time.Time    `json:"next_run_at"`
+	LastRunAt *time.Time   `json:"last_run_at,omitempty"`
+	Runs      int          `json:"runs"`
+	OrderIDs  []string     `json:"order_ids"` // most recent generated orders
+
+	interval time.Duration
+}
+
+// Submitter queues materialized orders; *processor.Pool implements it.
+type Submitter interface {
+	Submit(order models.Order) error
+}
+
+// Scheduler stores subscriptions and materializes their orders on cadence.
+type Scheduler struct {
+	submitter Submitter
+	tick      time.Duration
+
+	mu   sync.Mutex
+	subs map[string]*Subscription
+}
+
+func NewScheduler(submitter Submitter, tick time.Duration) *Scheduler {
+	return &Scheduler{
+		submitter: submitter,
+		tick:      tick,
+		subs:      make(map[string]*Subscription),
+	}
+}
+
+// Create registers a subscription. The first order is generated at startAt,
+// or one interval from now when startAt is zero.
+func (s *Scheduler) Create(template models.Order, interval time.Duration, startAt time.Time) (Subscription, error) {
+	if interval < MinInterval {
+		return Subscription{}, ErrShortInterval
+	}
+
+	now := time.Now()
+	if startAt.IsZero() {
+		startAt = now.Add(interval)
+	}
+	template.ID = ""
+	sub := &Subscription{
+		ID:        "sub_" + randomHex(8),
+		Template:  template,
+		Interval:  interval.String(),
+		Status:    StatusActive,
+		CreatedAt: now,
+		NextRunAt: startAt,
+		OrderIDs:  []string{},
+		interval:  interval,
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.subs[sub.ID] = sub
+	return copySub(sub), nil
+}
+
+func (s *Scheduler) Get(id string) (Subscription, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sub, ok := s.subs[id]
+	if !ok {
+		return Subscription{}, ErrNotFound
+	}
+	return copySub(sub), nil
+}
+
+func (s *Scheduler) List() []Subscription {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	subs := make([]Subscription, 0, len(s.subs))
+	for _, sub := range s.subs {
+		subs = append(subs, copySub(sub))
+	}
+	sort.Slice(subs, func(i, j int) bool { return subs[i].CreatedAt.Before(subs[j].CreatedAt) })
+	return subs
+}
+
+// Pause stops generating orders until Resume is called.
+func (s *Scheduler) Pause(id string) (Subscription, error) {
+	return s.setStatus(id, StatusPaused)
+}
+
+// Resume reactivates a paused subscription. Runs missed while paused are
+// skipped; the next run is one interval from now.
+func (s *Scheduler) Resume(id string) (Subscription, error) {
+	return s.setStatus(id, StatusActive)
+}
+
+// Cancel ends a subscription permanently.
+func (s *Scheduler) Cancel(id string) (Subscription, error) {
+	return s.setStatus(id, StatusCancelled)
+}
+
+func (s *Scheduler) setStatus(id, status string) (Subscription, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sub, ok := s.subs[id]
+	if !ok {
+		return Subscription{}, ErrNotFound
+	}
+	if sub.Status == StatusCancelled {
+		return Subscription{}, ErrCancelled
+	}
+	if status == StatusActive && sub.Status == StatusPaused {
+		sub.NextRunAt = time.Now().Add(sub.interval)
+	}
+	sub.Status = status
+	return copySub(sub), nil
+}
+
+// Run materializes due orders until ctx is cancelled.
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.tick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.runDue(now)
+		}
+	}
+}
+
+func (s *Scheduler) runDue(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, sub := range s.subs {
+		if sub.Status != StatusActive || now.Before(sub.NextRunAt) {
+			continue
+		}
+
+		// The submitter may change the order, e.g. enrich its tags, so it
+		// mustn't share them with the template.
+		order := sub.Template
+		order.Items = slices.Clone(sub.Template.Items)
+		order.Tags = maps.Clone(sub.Template.Tags)
+		order.ID = fmt.Sprintf("%s_%d", sub.ID, sub.Runs+1)
+		order.SubscriptionID = sub.ID
+		order.CreatedAt = now
+
+		if err := s.submitter.Submit(order); err != nil {
+			// Leave NextRunAt as is so the next tick retries.
+			log.Printf("subscription %s: submit failed: %v", sub.ID, err)
+			continue
+		}
+
+		sub.Runs++
+		sub.LastRunAt = &now
+		sub.NextRunAt = sub.NextRunAt.Add(sub.interval)
+		if sub.NextRunAt.Before(now) {
+			// Don't burst through runs missed while the queue was full.
+			sub.NextRunAt = now.Add(sub.interval)
+		}
+		sub.OrderIDs = append(sub.OrderIDs, order.ID)
+		if len(sub.OrderIDs) > maxLinkedOrders {
+			sub.OrderIDs = sub.OrderIDs[len(sub.OrderIDs)-maxLinkedOrders:]
+		}
+	}
+}
+
+func copySub(sub *Subscription) Subscription {
+	c := *sub
+	c.Template.Items = slices.Clone(sub.Template.Items)
+	c.Template.Tags = maps.Clone(sub.Template.Tags)
+	c.OrderIDs = slices.Clone(sub.OrderIDs)
+	return c
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
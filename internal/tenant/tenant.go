@@ -0,0 +1,302 @@
+// Package tenant keeps per-tenant data policies: how long a tenant's
+// results are retained, and which order fields its results may show once
+// they leave the processor. Policies are applied before results are
+// stored or published, so the result log, live streams, webhooks,
+// callbacks and exports all see the same view.
+package tenant
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/eventbus"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/orderstore"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/pkg/models"
+)
+
+// Fields are the order fields, by JSON name, a policy can hide or mask.
+var Fields = []string{"customer", "address", "notes", "items", "tags", "customer_id", "address_id", "credit_account"}
+
+// Policy is one tenant's policy. Hidden fields are removed; masked ones
+// keep their shape, e.g. "j***@example.com", but not their content.
+type Policy struct {
+	Retention time.Duration // zero keeps results as long as the log does
+	Hide      []string
+	Mask      []string
+}
+
+// policyJSON is Policy's wire form, with the retention as a duration
+// string such as "720h".
+type policyJSON struct {
+	Retention string   `json:"retention,omitempty"`
+	Hide      []string `json:"hide,omitempty"`
+	Mask      []string `json:"mask,omitempty"`
+}
+
+func (p Policy) MarshalJSON() ([]byte, error) {
+	j := policyJSON{Hide: p.Hide, Mask: p.Mask}
+	if p.Retention > 0 {
+		j.Retention = p.Retention.String()
+	}
+	return json.Marshal(j)
+}
+
+func (p *Policy) UnmarshalJSON(data []byte) error {
+	var j policyJSON
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&j); err != nil {
+		return err
+	}
+	*p = Policy{Hide: j.Hide, Mask: j.Mask}
+	if j.Retention != "" {
+		d, err := time.ParseDuration(j.Retention)
+		if err != nil {
+			return fmt.Errorf("retention: %w", err)
+		}
+		p.Retention = d
+	}
+	return nil
+}
+
+func (p Policy) validate() error {
+	if p.Retention < 0 {
+		return errors.New("retention must not be negative")
+	}
+	for _, f := range slices.Concat(p.Hide, p.Mask) {
+		if !slices.Contains(Fields, f) {
+			return fmt.Errorf("unknown field %q; use one of %s", f, strings.Join(Fields, ", "))
+		}
+	}
+	return nil
+}
+
+// Policies stores the policy of each tenant. Policies set at runtime are
+// written to a file when one is configured.
+type Policies struct {
+	path string
+
+	mu       sync.RWMutex
+	byTenant map[string]Policy
+}
+
+// NewPolicies starts from defaults, then loads the policies saved in
+// path, if set, which take precedence.
+func NewPolicies(path string, defaults map[string]Policy) (*Policies, error) {
+	p := &Policies{path: path, byTenant: make(map[string]Policy, len(defaults))}
+	for tenant, policy := range defaults {
+		if err := policy.validate(); err != nil {
+			return nil, fmt.Errorf("tenant %s: %w", tenant, err)
+		}
+		p.byTenant[tenant] = policy
+	}
+	if path == "" {
+		return p, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return p, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var saved map[string]Policy
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	maps.Copy(p.byTenant, saved)
+	return p, nil
+}
+
+func (p *Policies) Get(tenant string) (Policy, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	policy, ok := p.byTenant[tenant]
+	return policy, ok
+}
+
+// List returns every policy by tenant.
+func (p *Policies) List() map[string]Policy {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return maps.Clone(p.byTenant)
+}
+
+// Set replaces a tenant's policy. It applies to results processed from
+// now on; retention applies to stored results too.
+func (p *Policies) Set(tenant string, policy Policy) error {
+	if tenant == "" {
+		return errors.New("tenant is required")
+	}
+	if err := policy.validate(); err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.byTenant[tenant] = policy
+	p.save()
+	return nil
+}
+
+// Delete removes a tenant's policy, reporting whether it had one.
+func (p *Policies) Delete(tenant string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.byTenant[tenant]; !ok {
+		return false
+	}
+	delete(p.byTenant, tenant)
+	p.save()
+	return true
+}
+
+// Apply returns the view of a result its tenant's policy allows. A nil
+// Policies, or a tenant without a policy, returns the result unchanged.
+func (p *Policies) Apply(result models.ProcessedOrder) models.ProcessedOrder {
+	if p == nil {
+		return result
+	}
+	policy, ok := p.Get(result.Order.Tenant)
+	if !ok {
+		return result
+	}
+	o := &result.Order
+	for _, f := range policy.Mask {
+		switch f {
+		case "customer":
+			o.Customer = mask(o.Customer)
+		case "address":
+			o.Address = mask(o.Address)
+		case "notes":
+			o.Notes = mask(o.Notes)
+		case "items":
+			items := make([]string, len(o.Items))
+			for i, item := range o.Items {
+				items[i] = mask(item)
+			}
+			o.Items = items
+		case "tags":
+			tags := make(map[string]string, len(o.Tags))
+			for k, v := range o.Tags {
+				tags[k] = mask(v)
+			}
+			o.Tags = tags
+		case "customer_id":
+			o.CustomerID = mask(o.CustomerID)
+		case "address_id":
+			o.AddressID = mask(o.AddressID)
+		case "credit_account":
+			o.CreditAccount = mask(o.CreditAccount)
+			if result.Payment != nil {
+				payment := *result.Payment
+				payment.CreditAccount = mask(payment.CreditAccount)
+				result.Payment = &payment
+			}
+		}
+	}
+	for _, f := range policy.Hide {
+		switch f {
+		case "customer":
+			o.Customer = ""
+		case "address":
+			o.Address = ""
+		case "notes":
+			o.Notes = ""
+		case "items":
+			o.Items = nil
+		case "tags":
+			o.Tags = nil
+		case "customer_id":
+			o.CustomerID = ""
+		case "address_id":
+			o.AddressID = ""
+		case "credit_account":
+			o.CreditAccount = ""
+			if result.Payment != nil {
+				payment := *result.Payment
+				payment.CreditAccount = ""
+				result.Payment = &payment
+			}
+		}
+	}
+	return result
+}
+
+// mask keeps the first letter and domain of an email address and nothing
+// of other values. Masking a masked value changes nothing.
+func mask(s string) string {
+	if s == "" {
+		return s
+	}
+	if at := strings.LastIndexByte(s, '@'); at > 0 {
+		return s[:1] + "***" + s[at:]
+	}
+	return "***"
+}
+
+// RunRetention deletes results older than their tenant's retention from
+// the order records and, if bus is set, the result log every interval
+// until ctx is done.
+func (p *Policies) RunRetention(ctx context.Context, orders orderstore.Repository, bus *eventbus.Bus, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		now := time.Now()
+		for tenant, policy := range p.List() {
+			if policy.Retention <= 0 {
+				continue
+			}
+			n, err := orders.Prune(tenant, now.Add(-policy.Retention))
+			if err != nil {
+				log.Printf("tenants: pruning %s's orders: %v", tenant, err)
+			} else if n > 0 {
+				log.Printf("tenants: pruned %d of %s's orders", n, tenant)
+			}
+		}
+		if bus == nil {
+			continue
+		}
+		n, err := bus.Expire(func(ev eventbus.Event) bool {
+			policy, ok := p.Get(ev.Result.Order.Tenant)
+			return ok && policy.Retention > 0 && now.Sub(ev.Time) > policy.Retention
+		})
+		if err != nil {
+			log.Printf("tenants: expiring results: %v", err)
+		} else if n > 0 {
+			log.Printf("tenants: expired %d results", n)
+		}
+	}
+}
+
+// save must be called with p.mu held. Write errors are logged; the
+// policies stay in memory.
+func (p *Policies) save() {
+	if p.path == "" {
+		return
+	}
+	data, err := json.MarshalIndent(p.byTenant, "", "  ")
+	if err == nil {
+		tmp := p.path + ".tmp"
+		if err = os.WriteFile(tmp, data, 0o600); err == nil {
+			err = os.Rename(tmp, p.path)
+		}
+	}
+	if err != nil {
+		log.Printf("tenants: saving %s: %v", p.path, err)
+	}
+}
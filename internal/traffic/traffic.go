@@ -0,0 +1,200 @@
+// Package traffic records incoming requests to a JSON-lines file, so
+// production traffic can be replayed against another environment with
+// the load tool. Credentials are never recorded, and personal fields in
+// JSON bodies and query strings are replaced with tokens: equal values get
+// equal tokens, so per-customer patterns such as sharding survive. Other
+// bodies are recorded only by their size and a token.
+package traffic
+
+import (
+	"bytes"
+	"crypto/hmac"
+	crand "crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxBody is the largest body recorded; larger requests are recorded
+// without one.
+const maxBody = 1 << 20
+
+// replayHeaders are the request headers kept in recordings.
+var replayHeaders = []string{"Content-Type", "Accept", "Accept-Language", "Idempotency-Key"}
+
+// Entry is one recorded request.
+type Entry struct {
+	At      time.Time         `json:"at"`
+	Method  string            `json:"method"`
+	Path    string            `json:"path"` // with the query string
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    json.RawMessage   `json:"body,omitempty"`
+
+	// A body that isn't JSON can't be masked field by field, so only its
+	// size and a token of it are kept.
+	TextSize  int    `json:"text_size,omitempty"`
+	TextToken string `json:"text_token,omitempty"`
+}
+
+type Config struct {
+	Paths  []string // path prefixes to record
+	Sample float64  // fraction of matching requests recorded
+	Mask   []string // JSON fields, at any depth, and query parameters whose values are tokenized
+}
+
+type Recorder struct {
+	cfg Config
+	key []byte // per-recording key for tokens, so they can't be reversed by guessing
+
+	mu   sync.Mutex
+	file *os.File
+}
+
+// Open appends recordings to the file at path.
+func Open(path string, cfg Config) (*Recorder, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	key := make([]byte, 32)
+	_, _ = crand.Read(key)
+	return &Recorder{cfg: cfg, key: key, file: f}, nil
+}
+
+// Middleware records matching requests before passing them on.
+func (rec *Recorder) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if rec.matches(r) {
+			rec.record(r)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (rec *Recorder) matches(r *http.Request) bool {
+	if !slices.ContainsFunc(rec.cfg.Paths, func(p string) bool { return strings.HasPrefix(r.URL.Path, p) }) {
+		return false
+	}
+	return rec.cfg.Sample >= 1 || rand.Float64() < rec.cfg.Sample
+}
+
+func (rec *Recorder) record(r *http.Request) {
+	e := Entry{At: time.Now(), Method: r.Method, Path: rec.path(r.URL)}
+	for _, h := range replayHeaders {
+		if v := r.Header.Get(h); v != "" {
+			if e.Headers == nil {
+				e.Headers = make(map[string]string)
+			}
+			e.Headers[h] = v
+		}
+	}
+
+	if r.Body != nil {
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxBody+1))
+		// The handler still reads the whole body.
+		r.Body = readCloser{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+		if err == nil && len(body) <= maxBody && len(body) > 0 {
+			var doc any
+			dec := json.NewDecoder(bytes.NewReader(body))
+			dec.UseNumber() // keep amounts exactly as sent
+			if dec.Decode(&doc) == nil {
+				e.Body, _ = json.Marshal(rec.mask(doc))
+			} else {
+				e.TextSize, e.TextToken = len(body), rec.tokenize(string(body)).(string)
+			}
+		}
+	}
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if _, err := rec.file.Write(append(data, '\n')); err != nil {
+		log.Printf("traffic: write: %v", err)
+	}
+}
+
+// path is u's path and query, with the values of masked query parameters
+// tokenized.
+func (rec *Recorder) path(u *url.URL) string {
+	query := u.Query()
+	masked := false
+	for k, vs := range query {
+		if !slices.Contains(rec.cfg.Mask, k) {
+			continue
+		}
+		for i, v := range vs {
+			vs[i] = rec.tokenize(v).(string)
+		}
+		masked = true
+	}
+	if !masked {
+		return u.RequestURI()
+	}
+	tokenized := *u
+	tokenized.RawQuery = query.Encode()
+	return tokenized.RequestURI()
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// mask tokenizes the configured fields of a decoded JSON document.
+func (rec *Recorder) mask(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, child := range v {
+			if slices.Contains(rec.cfg.Mask, k) {
+				v[k] = rec.tokenize(child)
+			} else {
+				v[k] = rec.mask(child)
+			}
+		}
+	case []any:
+		for i, child := range v {
+			v[i] = rec.mask(child)
+		}
+	}
+	return v
+}
+
+func (rec *Recorder) tokenize(v any) any {
+	switch v := v.(type) {
+	case string:
+		if v == "" {
+			return v
+		}
+		mac := hmac.New(sha256.New, rec.key)
+		mac.Write([]byte(v))
+		return "masked_" + hex.EncodeToString(mac.Sum(nil))[:16]
+	case []any:
+		for i, child := range v {
+			v[i] = rec.tokenize(child)
+		}
+	case map[string]any:
+		for k, child := range v {
+			v[k] = rec.tokenize(child)
+		}
+	}
+	return v
+}
+
+func (rec *Recorder) Close() error {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	return rec.file.Close()
+}
@@ -0,0 +1,208 @@
+// Package transform reshapes published JSON payloads per consumer. A
+// transform is either a Go text/template that renders JSON, or a mapping
+// of output fields to JSONPath expressions. Both see the payload as
+// decoded JSON, so fields are addressed by their JSON names.
+package transform
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// Spec configures one transform. Exactly one of Template or Mapping is set.
+// Mapping keys are output fields, dotted for nesting ("customer.email");
+// values are JSONPath expressions such as "$.order.items[0]" or
+// "$.order.items[*]".
+type Spec struct {
+	Template string
+	Mapping  map[string]string
+}
+
+type Transform struct {
+	tmpl    *template.Template
+	mapping map[string][]segment
+}
+
+// Set holds named transforms.
+type Set map[string]*Transform
+
+// Build compiles named specs.
+func Build(specs map[string]Spec) (Set, error) {
+	set := make(Set, len(specs))
+	for name, spec := range specs {
+		t, err := New(spec)
+		if err != nil {
+			return nil, fmt.Errorf("transform %q: %w", name, err)
+		}
+		set[name] = t
+	}
+	return set, nil
+}
+
+// Get returns the named transform. The empty name returns nil, the
+// identity; an unknown name is an error.
+func (s Set) Get(name string) (*Transform, error) {
+	if name == "" {
+		return nil, nil
+	}
+	t, ok := s[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown transform %q", name)
+	}
+	return t, nil
+}
+
+func New(spec Spec) (*Transform, error) {
+	switch {
+	case spec.Template != "" && spec.Mapping != nil:
+		return nil, errors.New("set template or mapping, not both")
+	case spec.Template != "":
+		tmpl, err := template.New("").Option("missingkey=zero").Funcs(template.FuncMap{
+			"json": func(v any) (string, error) {
+				b, err := json.Marshal(v)
+				return string(b), err
+			},
+		}).Parse(spec.Template)
+		if err != nil {
+			return nil, err
+		}
+		return &Transform{tmpl: tmpl}, nil
+	case len(spec.Mapping) > 0:
+		t := &Transform{mapping: make(map[string][]segment, len(spec.Mapping))}
+		for field, path := range spec.Mapping {
+			segs, err := parsePath(path)
+			if err != nil {
+				return nil, fmt.Errorf("mapping %q: %w", field, err)
+			}
+			t.mapping[field] = segs
+		}
+		return t, nil
+	default:
+		return nil, errors.New("template or mapping is required")
+	}
+}
+
+// Apply marshals v and reshapes it. A nil Transform returns v's JSON as is.
+func (t *Transform) Apply(v any) (json.RawMessage, error) {
+	data, err := json.Marshal(v)
+	if err != nil || t == nil {
+		return data, err
+	}
+	var doc any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	if t.tmpl != nil {
+		var out bytes.Buffer
+		if err := t.tmpl.Execute(&out, doc); err != nil {
+			return nil, err
+		}
+		if !json.Valid(out.Bytes()) {
+			return nil, errors.New("template did not produce valid JSON")
+		}
+		return out.Bytes(), nil
+	}
+
+	out := make(map[string]any)
+	for field, segs := range t.mapping {
+		set(out, strings.Split(field, "."), eval(doc, segs))
+	}
+	return json.Marshal(out)
+}
+
+func set(obj map[string]any, keys []string, v any) {
+	for _, k := range keys[:len(keys)-1] {
+		next, ok := obj[k].(map[string]any)
+		if !ok {
+			next = make(map[string]any)
+			obj[k] = next
+		}
+		obj = next
+	}
+	obj[keys[len(keys)-1]] = v
+}
+
+// segment is one step of a path: a key, an index, or every element.
+type segment struct {
+	key   string
+	index int
+	all   bool
+}
+
+// parsePath supports the JSONPath subset $, .key, ['key'], [n] and [*].
+func parsePath(path string) ([]segment, error) {
+	rest, ok := strings.CutPrefix(path, "$")
+	if !ok {
+		return nil, fmt.Errorf("path %q must start with $", path)
+	}
+	var segs []segment
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("path %q: empty key", path)
+			}
+			segs = append(segs, segment{key: rest[:end]})
+			rest = rest[end:]
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("path %q: unclosed [", path)
+			}
+			inner := rest[1:end]
+			rest = rest[end+1:]
+			switch {
+			case inner == "*":
+				segs = append(segs, segment{all: true})
+			case len(inner) >= 2 && inner[0] == '\'' && inner[len(inner)-1] == '\'':
+				segs = append(segs, segment{key: inner[1 : len(inner)-1]})
+			default:
+				n, err := strconv.Atoi(inner)
+				if err != nil {
+					return nil, fmt.Errorf("path %q: bad index %q", path, inner)
+				}
+				segs = append(segs, segment{index: n})
+			}
+		default:
+			return nil, fmt.Errorf("path %q: unexpected %q", path, rest[0])
+		}
+	}
+	return segs, nil
+}
+
+// eval resolves segs against v. Missing values are nil; after [*] the
+// rest of the path is applied to every element.
+func eval(v any, segs []segment) any {
+	for i, seg := range segs {
+		switch {
+		case seg.all:
+			arr, _ := v.([]any)
+			out := make([]any, len(arr))
+			for j, elem := range arr {
+				out[j] = eval(elem, segs[i+1:])
+			}
+			return out
+		case seg.key != "":
+			obj, _ := v.(map[string]any)
+			v = obj[seg.key]
+		default:
+			arr, _ := v.([]any)
+			if seg.index < 0 || seg.index >= len(arr) {
+				return nil
+			}
+			v = arr[seg.index]
+		}
+	}
+	return v
+}
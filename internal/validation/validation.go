@@ -0,0 +1,158 @@
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/pkg/models"
+)
+
+// Validator is a deployment-specific check that runs after the built-in
+// validation. It may see orders that already failed built-in checks, so it
+// must tolerate missing fields. Returning a *models.ValidationError (or
+// models.ValidationErrors) controls the reported code and field; any other
+// error is reported under the validator's name.
+type Validator interface {
+	Validate(o models.Order) error
+}
+
+// ValidatorFunc adapts a function to Validator.
+type ValidatorFunc func(o models.Order) error
+
+func (f ValidatorFunc) Validate(o models.Order) error {
+	return f(o)
+}
+
+// Factory builds a validator from its config params.
+type Factory func(params map[string]string) (Validator, error)
+
+var factories = map[string]Factory{
+	"email_domain": emailDomain,
+	"required_tag": requiredTag,
+	"max_amount":   maxAmount,
+}
+
+// Register makes a validator available to the config by name. Call it
+// before Build, typically from main.
+func Register(name string, factory Factory) {
+	factories[name] = factory
+}
+
+// Spec selects a registered validator and its params.
+type Spec struct {
+	Name   string
+	Params map[string]string
+}
+
+type namedValidator struct {
+	name string
+	Validator
+}
+
+// Chain runs validators in order and collects all their errors.
+type Chain []namedValidator
+
+// Build instantiates the configured validators.
+func Build(specs []Spec) (Chain, error) {
+	chain := make(Chain, 0, len(specs))
+	for _, spec := range specs {
+		factory, ok := factories[spec.Name]
+		if !ok {
+			return nil, fmt.Errorf("unknown validator %q (available: %s)", spec.Name, available())
+		}
+		v, err := factory(spec.Params)
+		if err != nil {
+			return nil, fmt.Errorf("validator %q: %w", spec.Name, err)
+		}
+		chain = append(chain, namedValidator{spec.Name, v})
+	}
+	return chain, nil
+}
+
+// Validate returns models.ValidationErrors with every failure, or nil.
+func (c Chain) Validate(o models.Order) error {
+	var errs models.ValidationErrors
+	for _, v := range c {
+		if err := v.Validate(o); err != nil {
+			errs = append(errs, models.AsValidationErrors(err, v.name)...)
+		}
+	}
+	return errs.Err()
+}
+
+func available() string {
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// emailDomain requires the customer to be an email on one of
+// params["domains"] (comma separated).
+func emailDomain(params map[string]string) (Validator, error) {
+	var domains []string
+	for _, d := range strings.Split(params["domains"], ",") {
+		if d = strings.ToLower(strings.TrimSpace(d)); d != "" {
+			domains = append(domains, d)
+		}
+	}
+	if len(domains) == 0 {
+		return nil, errors.New("domains is required")
+	}
+
+	return ValidatorFunc(func(o models.Order) error {
+		_, domain, ok := strings.Cut(strings.ToLower(o.Customer), "@")
+		for _, d := range domains {
+			if ok && domain == d {
+				return nil
+			}
+		}
+		return &models.ValidationError{
+			Code:    "customer_domain_not_allowed",
+			Field:   "customer",
+			Message: "customer email must be on one of: " + strings.Join(domains, ", "),
+		}
+	}), nil
+}
+
+// requiredTag requires the tag params["key"] to be present.
+func requiredTag(params map[string]string) (Validator, error) {
+	key := params["key"]
+	if key == "" {
+		return nil, errors.New("key is required")
+	}
+
+	return ValidatorFunc(func(o models.Order) error {
+		if o.Tags[key] != "" {
+			return nil
+		}
+		return &models.ValidationError{
+			Code:    "tag_required",
+			Field:   "tags",
+			Message: fmt.Sprintf("tag %q is required", key),
+		}
+	}), nil
+}
+
+// maxAmount caps the order amount at params["amount"].
+func maxAmount(params map[string]string) (Validator, error) {
+	limit, err := models.ParseMoney(params["amount"])
+	if err != nil {
+		return nil, fmt.Errorf("amount: %w", err)
+	}
+
+	return ValidatorFunc(func(o models.Order) error {
+		if o.Amount <= limit {
+			return nil
+		}
+		return &models.ValidationError{
+			Code:    "amount_above_deployment_limit",
+			Field:   "amount",
+			Message: fmt.Sprintf("amount must not exceed %s", limit),
+		}
+	}), nil
+}
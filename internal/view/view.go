@@ -0,0 +1,143 @@
+// Package view is the serialization policy for API responses. Operators
+// see orders and results as they are; submitters see only the orders they
+// submitted, reduced to the fields their policy lists. Policies project
+// the JSON form of a response, so each role's view is declared once as
+// field names rather than as per-role copies of the models.
+package view
+
+import (
+	"encoding/json"
+	"slices"
+
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/auth"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/cdc"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/eventbus"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/pkg/models"
+)
+
+type Role string
+
+const (
+	// Operator is a key with the admin scope, or a caller on a route that
+	// doesn't check keys. The admin key of a tenant only sees the
+	// tenant's orders.
+	Operator  Role = "operator"
+	Submitter Role = "submitter"
+)
+
+// Policy lists the fields a role sees, by JSON name. Result fields are
+// those of a processed order besides "order", which is reduced to Order.
+type Policy struct {
+	Order  []string
+	Result []string
+}
+
+// Views holds the policy of each restricted role.
+type Views struct {
+	Submitter Policy
+}
+
+// Viewer is who a response is rendered for.
+type Viewer struct {
+	Role   Role
+	KeyID  string
+	Tenant string  // the key's tenant; empty sees every tenant
+	policy *Policy // nil shows everything
+}
+
+// For returns the viewer for a request's API key, as returned by
+// auth.FromContext. A nil Views shows everyone everything.
+func (v *Views) For(key auth.APIKey, ok bool) Viewer {
+	if v == nil || !ok || key.HasScope(auth.ScopeAdmin) {
+		return Viewer{Role: Operator, KeyID: key.ID, Tenant: key.Tenant}
+	}
+	return Viewer{Role: Submitter, KeyID: key.ID, Tenant: key.Tenant, policy: &v.Submitter}
+}
+
+// Owns reports whether the viewer may see an order at all.
+func (v Viewer) Owns(o models.Order) bool {
+	if v.Tenant != "" && o.Tenant != v.Tenant {
+		return false
+	}
+	return v.policy == nil || (o.SubmittedBy != "" && o.SubmittedBy == v.KeyID)
+}
+
+func (v Viewer) Order(o models.Order) (any, error) {
+	if v.policy == nil {
+		return o, nil
+	}
+	return project(o, v.policy.Order)
+}
+
+func (v Viewer) Result(r models.ProcessedOrder) (any, error) {
+	if v.policy == nil {
+		return r, nil
+	}
+	out, err := project(r, v.policy.Result)
+	if err != nil {
+		return nil, err
+	}
+	order, err := project(r.Order, v.policy.Order)
+	if err != nil {
+		return nil, err
+	}
+	out["order"], err = json.Marshal(order)
+	return out, err
+}
+
+// Event reduces the result carried by a durable result event.
+func (v Viewer) Event(e eventbus.Event) (any, error) {
+	if v.policy == nil {
+		return e, nil
+	}
+	result, err := v.Result(e.Result)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{"seq": e.Seq, "time": e.Time, "result": result}, nil
+}
+
+// Change reduces the rows of a change event. Row columns are named like
+// order and result fields, so they follow both lists.
+func (v Viewer) Change(e cdc.Envelope) (any, error) {
+	if v.policy == nil {
+		return e, nil
+	}
+	columns := slices.Concat(v.policy.Order, v.policy.Result)
+	out, err := project(e, []string{"source", "op", "ts_ms"})
+	if err != nil {
+		return nil, err
+	}
+	for name, row := range map[string]*cdc.Row{"before": e.Before, "after": e.After} {
+		var reduced any
+		if row != nil {
+			if reduced, err = project(row, columns); err != nil {
+				return nil, err
+			}
+		}
+		if out[name], err = json.Marshal(reduced); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// project keeps the listed top-level fields of v's JSON object. Values
+// stay as encoded, so amounts keep their exact decimals.
+func project(v any, fields []string) (map[string]json.RawMessage, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	out := make(map[string]json.RawMessage, len(fields))
+	for _, f := range fields {
+		if raw, ok := doc[f]; ok {
+			out[f] = raw
+		}
+	}
+	return out, nil
+}
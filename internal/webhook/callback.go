@@ -0,0 +1,175 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/outbound"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/pkg/models"
+)
+
+// HeaderCallbackOrder names the order a callback is about.
+const HeaderCallbackOrder = "X-Callback-Order"
+
+const callbackQueue = 10000
+
+// CallbackConfig configures per-order callbacks.
+type CallbackConfig struct {
+	Secret       func() string // HMAC key for auth.Sign; nil sends unsigned
+	AllowedHosts []string      // hosts and their subdomains; empty allows any public host
+	MaxAttempts  int
+	Workers      int
+}
+
+// CallbackStats describes callback deliveries since startup.
+type CallbackStats struct {
+	Delivered uint64 `json:"delivered"`
+	Failures  uint64 `json:"failures"`  // failed attempts, including retried ones
+	Abandoned uint64 `json:"abandoned"` // gave up after the last attempt
+	Dropped   uint64 `json:"dropped"`   // not queued because the queue was full
+	Pending   int    `json:"pending"`
+	LastError string `json:"last_error,omitempty"`
+}
+
+// Callbacks posts an order's result to the callback_url it was submitted
+// with, for integrators that want one result without a standing webhook.
+// Pending callbacks are kept in memory: they are retried with backoff but
+// lost on restart.
+type Callbacks struct {
+	client *http.Client
+	cfg    CallbackConfig
+	queue  chan models.ProcessedOrder
+
+	mu    sync.Mutex
+	stats CallbackStats
+}
+
+func NewCallbacks(client *http.Client, cfg CallbackConfig) *Callbacks {
+	cfg.AllowedHosts = slices.Clone(cfg.AllowedHosts)
+	for i, host := range cfg.AllowedHosts {
+		cfg.AllowedHosts[i] = strings.ToLower(host)
+	}
+	return &Callbacks{client: client, cfg: cfg, queue: make(chan models.ProcessedOrder, callbackQueue)}
+}
+
+// Check validates the callback_url of a submitted order. Callbacks are
+// disabled when c is nil.
+func (c *Callbacks) Check(raw string) error {
+	if c == nil {
+		return models.NewFieldError("callback_url", models.CodeCallbacksDisabled)
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" || u.User != nil {
+		return models.NewFieldError("callback_url", models.CodeInvalidCallbackURL)
+	}
+	host := strings.ToLower(u.Hostname())
+	if !hostAllowed(host, c.cfg.AllowedHosts) {
+		return models.NewFieldError("callback_url", models.CodeCallbackHostNotAllowed, host)
+	}
+	// Without an allow-list names aren't resolved here; the client, an
+	// outbound.Client's PublicHTTP, refuses their private addresses when
+	// it connects.
+	if ip := net.ParseIP(host); len(c.cfg.AllowedHosts) == 0 && (host == "localhost" || ip != nil && !outbound.IsPublic(ip)) {
+		return models.NewFieldError("callback_url", models.CodeCallbackHostNotAllowed, host)
+	}
+	return nil
+}
+
+// hostAllowed reports whether host is one of allowed, lower-cased hosts,
+// or a subdomain of one. Any host is allowed when allowed is empty.
+func hostAllowed(host string, allowed []string) bool {
+	return len(allowed) == 0 || slices.ContainsFunc(allowed, func(a string) bool {
+		return host == a || strings.HasSuffix(host, "."+a)
+	})
+}
+
+// Enqueue schedules the callback for a result whose order has a
+// callback_url. It never blocks the results loop; when the queue is full
+// the callback is dropped.
+func (c *Callbacks) Enqueue(result models.ProcessedOrder) {
+	if result.Order.CallbackURL == "" {
+		return
+	}
+	select {
+	case c.queue <- result:
+	default:
+		c.mu.Lock()
+		c.stats.Dropped++
+		c.mu.Unlock()
+		log.Printf("callback %s: queue full, dropped", result.Order.ID)
+	}
+}
+
+// Run delivers callbacks until ctx is done.
+func (c *Callbacks) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for range c.cfg.Workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case result := <-c.queue:
+					c.deliver(ctx, result)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func (c *Callbacks) deliver(ctx context.Context, result models.ProcessedOrder) {
+	body, err := json.Marshal(result)
+	if err != nil {
+		log.Printf("callback %s: encode result: %v", result.Order.ID, err)
+		return
+	}
+	header := http.Header{}
+	header.Set(HeaderCallbackOrder, result.Order.ID)
+	header.Set("Idempotency-Key", "callback:"+result.Order.ID)
+
+	backoff := time.Second
+	for attempt := 1; ; attempt++ {
+		_, err := postSigned(ctx, c.client, result.Order.CallbackURL, body, "application/json", header.Clone(), c.cfg.Secret)
+		if ctx.Err() != nil {
+			return
+		}
+		c.mu.Lock()
+		if err == nil {
+			c.stats.Delivered++
+			c.mu.Unlock()
+			return
+		}
+		c.stats.Failures++
+		c.stats.LastError = err.Error()
+		abandon := attempt >= c.cfg.MaxAttempts
+		if abandon {
+			c.stats.Abandoned++
+		}
+		c.mu.Unlock()
+		if abandon {
+			log.Printf("callback %s: giving up after %d attempts: %v", result.Order.ID, attempt, err)
+			return
+		}
+		sleep(ctx, backoff)
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+func (c *Callbacks) Stats() CallbackStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.Pending = len(c.queue)
+	return stats
+}
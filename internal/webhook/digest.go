@@ -0,0 +1,218 @@
+package webhook
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/eventbus"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/jobs"
+)
+
+const (
+	// DigestJobKind is the kind of the background jobs that send digests.
+	DigestJobKind = "webhook.digest"
+
+	// HeaderDigest carries a digest's event range, "<from>-<to>".
+	HeaderDigest = "X-Webhook-Digest"
+
+	// maxDigestEvents is how many events one digest covers; the rest wait
+	// for the next. maxDigestOrders caps the orders listed per group; the
+	// counts always cover all of them.
+	maxDigestEvents = 10000
+	maxDigestOrders = 1000
+)
+
+// ErrNoDigest is returned by StartDigest for consumers that get every
+// event on its own.
+var ErrNoDigest = errors.New("webhook does not send digests")
+
+// Digest replaces per-event deliveries with one summary per group every
+// interval. GroupBy is "tenant", "customer" or "" for a single group.
+type Digest struct {
+	Every   time.Duration
+	GroupBy string
+	Jobs    *jobs.Manager // runs each digest as a background job
+}
+
+// DigestPayload summarizes one group's results between two digests.
+// FromSeq and ToSeq bound the events covered. A digest that fails for any
+// group is sent again, widened, with the next one, so receivers should
+// ignore events up to the highest ToSeq they have seen.
+type DigestPayload struct {
+	Consumer  string        `json:"consumer"`
+	GroupBy   string        `json:"group_by,omitempty"`
+	Group     string        `json:"group,omitempty"`
+	From      time.Time     `json:"from"`
+	To        time.Time     `json:"to"`
+	FromSeq   uint64        `json:"from_seq"`
+	ToSeq     uint64        `json:"to_seq"`
+	Completed int           `json:"completed"`
+	Failed    int           `json:"failed"`
+	Orders    []DigestOrder `json:"orders"` // the first 1000
+}
+
+type DigestOrder struct {
+	ID          string    `json:"id"`
+	Success     bool      `json:"success"`
+	ProcessedAt time.Time `json:"processed_at"`
+	Result      string    `json:"result,omitempty"`
+	ErrorCode   string    `json:"error_code,omitempty"`
+	Error       string    `json:"error,omitempty"`
+}
+
+// runDigests starts a digest job every interval until ctx is done. A tick
+// is skipped when no events are pending or the previous digest is still
+// queued or running.
+func (d *Dispatcher) runDigests(ctx context.Context) {
+	digest := d.consumer.Digest
+	// Register the subscriber now, so results from startup on are covered.
+	if _, err := d.pending(ctx, 1); err != nil {
+		log.Printf("webhook %s: read events: %v", d.consumer.Name, err)
+	}
+	ticker := time.NewTicker(digest.Every)
+	defer ticker.Stop()
+	var last string
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if d.Stats().Pending == 0 {
+			continue
+		}
+		if job, ok := digest.Jobs.Get(last); ok && (job.State == jobs.Queued || job.State == jobs.Running) {
+			continue
+		}
+		job, err := d.StartDigest("scheduler")
+		if err != nil {
+			log.Printf("webhook %s: digest: %v", d.consumer.Name, err)
+			continue
+		}
+		last = job.ID
+	}
+}
+
+// StartDigest queues a digest job of the events pending now. Each group
+// is one item of the job. The events are acked only if every group was
+// delivered.
+func (d *Dispatcher) StartDigest(createdBy string) (jobs.Job, error) {
+	digest := d.consumer.Digest
+	if digest == nil {
+		return jobs.Job{}, ErrNoDigest
+	}
+	batch, err := d.pending(context.Background(), maxDigestEvents)
+	if err != nil {
+		return jobs.Job{}, err
+	}
+	d.mu.Lock()
+	d.stats.Skipped += batch.Skipped
+	d.mu.Unlock()
+	groups := d.group(batch.Events)
+	return digest.Jobs.Start(DigestJobKind, createdBy, len(groups), func(ctx context.Context, p *jobs.Progress) error {
+		if len(batch.Events) == 0 {
+			return nil
+		}
+		from, to := batch.Events[0], batch.Events[len(batch.Events)-1]
+		delivered := true
+		for _, g := range groups {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			g.From, g.To, g.FromSeq, g.ToSeq = from.Time, to.Time, from.Seq, to.Seq
+			err := d.sendDigest(ctx, g)
+			p.Step(cmp.Or(g.Group, "all"), err)
+			delivered = delivered && err == nil
+		}
+		if delivered {
+			d.ack(to.Seq)
+		}
+		return nil
+	})
+}
+
+// pending returns the unacked events without waiting for new ones.
+func (d *Dispatcher) pending(ctx context.Context, max int) (eventbus.Batch, error) {
+	// Read returns what it has at once when its context is already done.
+	done, cancel := context.WithCancel(ctx)
+	cancel()
+	return d.bus.Read(done, d.subscriber(), max)
+}
+
+// group summarizes events per group, in order of group name.
+func (d *Dispatcher) group(events []eventbus.Event) []*DigestPayload {
+	byKey := make(map[string]*DigestPayload)
+	for _, e := range events {
+		var key string
+		switch d.consumer.Digest.GroupBy {
+		case "tenant":
+			key = e.Result.Order.Tenant
+		case "customer":
+			key = e.Result.Order.Customer
+		}
+		g, ok := byKey[key]
+		if !ok {
+			g = &DigestPayload{Consumer: d.consumer.Name, GroupBy: d.consumer.Digest.GroupBy, Group: key, Orders: []DigestOrder{}}
+			byKey[key] = g
+		}
+		if e.Result.Success {
+			g.Completed++
+		} else {
+			g.Failed++
+		}
+		if len(g.Orders) < maxDigestOrders {
+			g.Orders = append(g.Orders, DigestOrder{
+				ID:          e.Result.Order.ID,
+				Success:     e.Result.Success,
+				ProcessedAt: e.Result.ProcessedAt,
+				Result:      e.Result.Result,
+				ErrorCode:   e.Result.ErrorCode,
+				Error:       e.Result.Error,
+			})
+		}
+	}
+	groups := slices.Collect(maps.Values(byKey))
+	slices.SortFunc(groups, func(a, b *DigestPayload) int { return cmp.Compare(a.Group, b.Group) })
+	return groups
+}
+
+// sendDigest posts one group's digest once; a failure is retried with the
+// next digest.
+func (d *Dispatcher) sendDigest(ctx context.Context, g *DigestPayload) error {
+	body, err := json.Marshal(g)
+	if err != nil {
+		return err
+	}
+	contentType := "application/json"
+	if d.consumer.Encrypter != nil {
+		if body, contentType, err = d.consumer.Encrypter.Encrypt(body); err != nil {
+			return err
+		}
+	}
+	span := strconv.FormatUint(g.FromSeq, 10) + "-" + strconv.FormatUint(g.ToSeq, 10)
+	header := http.Header{}
+	header.Set(HeaderDigest, span)
+	header.Set("Idempotency-Key", d.subscriber()+":digest:"+g.Group+":"+span)
+	if d.consumer.Encrypter != nil {
+		header.Set(HeaderEncryption, d.consumer.Encryption)
+	}
+	attempt, err := postSigned(ctx, d.client, d.consumer.URL, body, contentType, header, d.consumer.Secret)
+	attempt.Event = g.ToSeq
+	if ctx.Err() == nil {
+		d.record(attempt)
+	}
+	if err != nil {
+		d.failed(err)
+		return err
+	}
+	d.delivered()
+	return nil
+}
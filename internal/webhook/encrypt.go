@@ -0,0 +1,114 @@
+package webhook
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+
+	"golang.org/x/crypto/nacl/box"
+)
+
+// Encrypter seals a payload for one consumer's public key.
+type Encrypter interface {
+	Encrypt(plain []byte) (body []byte, contentType string, err error)
+}
+
+// NewEncrypter returns the encrypter for kind, "nacl_box" or "jwe", to
+// the consumer's base64 X25519 public key.
+func NewEncrypter(kind, publicKey string) (Encrypter, error) {
+	raw, err := base64.StdEncoding.DecodeString(publicKey)
+	if err != nil || len(raw) != 32 {
+		return nil, fmt.Errorf("public key must be a base64 X25519 key")
+	}
+	switch kind {
+	case "nacl_box":
+		var key naclBox
+		copy(key[:], raw)
+		return &key, nil
+	case "jwe":
+		pub, err := ecdh.X25519().NewPublicKey(raw)
+		if err != nil {
+			return nil, err
+		}
+		return jwe{pub: pub}, nil
+	default:
+		return nil, fmt.Errorf("unknown encryption %q", kind)
+	}
+}
+
+// naclBox is an anonymous NaCl sealed box: only the consumer's private key
+// opens it (box.OpenAnonymous), and the sender stays unauthenticated, so
+// pair it with HMAC signing.
+type naclBox [32]byte
+
+func (k *naclBox) Encrypt(plain []byte) ([]byte, string, error) {
+	sealed, err := box.SealAnonymous(nil, plain, (*[32]byte)(k), rand.Reader)
+	return sealed, "application/octet-stream", err
+}
+
+// jwe produces compact JWE with ECDH-ES key agreement over X25519 and
+// A256GCM content encryption (RFC 7516, 7518 and 8037).
+type jwe struct {
+	pub *ecdh.PublicKey
+}
+
+func (j jwe) Encrypt(plain []byte) ([]byte, string, error) {
+	eph, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, "", err
+	}
+	shared, err := eph.ECDH(j.pub)
+	if err != nil {
+		return nil, "", err
+	}
+
+	b64 := base64.RawURLEncoding
+	header, err := json.Marshal(map[string]any{
+		"alg": "ECDH-ES",
+		"enc": "A256GCM",
+		"epk": map[string]string{"kty": "OKP", "crv": "X25519", "x": b64.EncodeToString(eph.PublicKey().Bytes())},
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	protected := b64.EncodeToString(header)
+
+	block, err := aes.NewCipher(concatKDF(shared, "A256GCM", 256))
+	if err != nil {
+		return nil, "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, "", err
+	}
+	iv := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(iv); err != nil {
+		return nil, "", err
+	}
+	sealed := gcm.Seal(nil, iv, plain, []byte(protected))
+	ciphertext, tag := sealed[:len(sealed)-gcm.Overhead()], sealed[len(sealed)-gcm.Overhead():]
+
+	// Direct key agreement leaves the encrypted key part empty.
+	compact := protected + ".." + b64.EncodeToString(iv) + "." + b64.EncodeToString(ciphertext) + "." + b64.EncodeToString(tag)
+	return []byte(compact), "application/jose", nil
+}
+
+// concatKDF is the single-round Concat KDF of RFC 7518 section 4.6.2 with
+// empty PartyUInfo and PartyVInfo.
+func concatKDF(shared []byte, alg string, bits uint32) []byte {
+	h := sha256.New()
+	_ = binary.Write(h, binary.BigEndian, uint32(1))
+	h.Write(shared)
+	_ = binary.Write(h, binary.BigEndian, uint32(len(alg)))
+	h.Write([]byte(alg))
+	_ = binary.Write(h, binary.BigEndian, uint32(0)) // PartyUInfo
+	_ = binary.Write(h, binary.BigEndian, uint32(0)) // PartyVInfo
+	_ = binary.Write(h, binary.BigEndian, bits)
+	return h.Sum(nil)[:bits/8]
+}
@@ -0,0 +1,269 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/eventbus"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/outbound"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/stream"
+)
+
+var (
+	ErrNotRegistered  = errors.New("webhook not found")
+	ErrInvalidURL     = errors.New("url must be an absolute http or https URL")
+	ErrHostNotAllowed = errors.New("webhook host is not allowed")
+	ErrPrivateHost    = errors.New("webhook host must not be a loopback, private or link-local address")
+	ErrInvalidType    = errors.New("events may only be order-processed and order-failed")
+	ErrTooMany        = errors.New("tenant has too many webhooks")
+)
+
+// Registration is a webhook registered by a client through the API rather
+// than configured. Its deliveries work like a configured consumer's.
+type Registration struct {
+	ID     string `json:"id"`
+	Tenant string `json:"tenant,omitempty"` // only this tenant's orders; empty for all
+	URL    string `json:"url"`
+	// Events are the types delivered: order-processed, order-failed or
+	// both.
+	Events []string `json:"events"`
+	// Secret signs deliveries; it is kept, but never shown again once
+	// registered.
+	Secret    string    `json:"secret,omitempty"`
+	CreatedBy string    `json:"created_by,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// RegistryConfig bounds client-registered webhooks. Registrations are
+// saved to File; empty keeps them in memory.
+type RegistryConfig struct {
+	File string
+	// AllowedHosts are the hosts, and their subdomains, webhooks may point
+	// at. Empty allows any host but those at loopback, private or
+	// link-local addresses.
+	AllowedHosts []string
+	MaxPerTenant int
+}
+
+type registered struct {
+	reg      Registration
+	dispatch *Dispatcher
+	stop     context.CancelFunc
+	done     chan struct{}
+}
+
+// Registry runs a dispatcher per registered webhook, each reading the
+// event bus under its own subscriber, so a new webhook gets the events
+// published after it was registered.
+type Registry struct {
+	ctx    context.Context
+	bus    *eventbus.Bus
+	client *http.Client
+	cfg    RegistryConfig
+
+	mu   sync.Mutex
+	regs map[string]*registered
+}
+
+// NewRegistry starts the dispatchers of the webhooks saved in cfg.File.
+// They run until ctx is done. Without cfg.AllowedHosts, client should be
+// an outbound.Client's PublicHTTP.
+func NewRegistry(ctx context.Context, bus *eventbus.Bus, client *http.Client, cfg RegistryConfig) (*Registry, error) {
+	cfg.AllowedHosts = slices.Clone(cfg.AllowedHosts)
+	for i, host := range cfg.AllowedHosts {
+		cfg.AllowedHosts[i] = strings.ToLower(host)
+	}
+	r := &Registry{ctx: ctx, bus: bus, client: client, cfg: cfg, regs: make(map[string]*registered)}
+	if cfg.File == "" {
+		return r, nil
+	}
+	data, err := os.ReadFile(cfg.File)
+	if errors.Is(err, os.ErrNotExist) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var saved []Registration
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, fmt.Errorf("%s: %w", cfg.File, err)
+	}
+	for _, reg := range saved {
+		r.start(reg)
+	}
+	return r, nil
+}
+
+// Register validates reg and starts delivering to it. The ID and creation
+// time are set here; no events means both types.
+func (r *Registry) Register(ctx context.Context, reg Registration) (Registration, error) {
+	u, err := url.Parse(reg.URL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" || u.User != nil {
+		return Registration{}, ErrInvalidURL
+	}
+	host := strings.ToLower(u.Hostname())
+	if !hostAllowed(host, r.cfg.AllowedHosts) {
+		return Registration{}, fmt.Errorf("%w: %s", ErrHostNotAllowed, host)
+	}
+	// Clients choose the URL, so unless the operator listed the hosts
+	// they mustn't make the server call its own or internal services.
+	// This check is for the client's sake; deliveries are checked when
+	// they connect, by the registry's client.
+	if len(r.cfg.AllowedHosts) == 0 {
+		if err := checkPublic(ctx, host); err != nil {
+			return Registration{}, err
+		}
+	}
+	if len(reg.Events) == 0 {
+		reg.Events = []string{stream.EventProcessed, stream.EventFailed}
+	}
+	for _, typ := range reg.Events {
+		if typ != stream.EventProcessed && typ != stream.EventFailed {
+			return Registration{}, fmt.Errorf("%w: %q", ErrInvalidType, typ)
+		}
+	}
+	reg.Events = slices.Compact(slices.Sorted(slices.Values(reg.Events)))
+	reg.ID = "wh_" + randomNonce()[:16]
+	reg.CreatedAt = time.Now().UTC()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.cfg.MaxPerTenant > 0 && len(r.list(reg.Tenant)) >= r.cfg.MaxPerTenant {
+		return Registration{}, ErrTooMany
+	}
+	r.start(reg)
+	r.save()
+	return reg, nil
+}
+
+// checkPublic returns ErrPrivateHost if host is, or resolves to, a
+// loopback, private, link-local (such as a cloud metadata endpoint) or
+// unspecified address.
+func checkPublic(ctx context.Context, host string) error {
+	var ips []net.IP
+	if ip := net.ParseIP(host); ip != nil {
+		ips = append(ips, ip)
+	} else {
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return fmt.Errorf("%w: %s does not resolve", ErrHostNotAllowed, host)
+		}
+		for _, addr := range addrs {
+			ips = append(ips, addr.IP)
+		}
+	}
+	for _, ip := range ips {
+		if !outbound.IsPublic(ip) {
+			return fmt.Errorf("%w: %s", ErrPrivateHost, host)
+		}
+	}
+	return nil
+}
+
+// start must be called with r.mu held, or before r is shared.
+func (r *Registry) start(reg Registration) {
+	consumer := Consumer{Name: reg.ID, URL: reg.URL, Tenant: reg.Tenant, Types: reg.Events}
+	if secret := reg.Secret; secret != "" {
+		consumer.Secret = func() string { return secret }
+	}
+	ctx, stop := context.WithCancel(r.ctx)
+	rg := &registered{reg: reg, dispatch: NewDispatcher(r.bus, r.client, consumer), stop: stop, done: make(chan struct{})}
+	r.regs[reg.ID] = rg
+	go func() {
+		defer close(rg.done)
+		rg.dispatch.Run(ctx)
+	}()
+}
+
+// Get returns a registered webhook, without its secret, and its
+// dispatcher.
+func (r *Registry) Get(id string) (Registration, *Dispatcher, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rg, ok := r.regs[id]
+	if !ok {
+		return Registration{}, nil, false
+	}
+	return rg.reg.Public(), rg.dispatch, true
+}
+
+// List returns the webhooks registered for tenant, or for every tenant
+// when it's empty, oldest first and without their secrets.
+func (r *Registry) List(tenant string) []Registration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	regs := r.list(tenant)
+	for i := range regs {
+		regs[i] = regs[i].Public()
+	}
+	return regs
+}
+
+// list must be called with r.mu held.
+func (r *Registry) list(tenant string) []Registration {
+	regs := []Registration{}
+	for _, rg := range r.regs {
+		if tenant == "" || rg.reg.Tenant == tenant {
+			regs = append(regs, rg.reg)
+		}
+	}
+	slices.SortFunc(regs, func(a, b Registration) int { return a.CreatedAt.Compare(b.CreatedAt) })
+	return regs
+}
+
+// Delete stops delivering to a webhook and forgets its place in the event
+// log.
+func (r *Registry) Delete(id string) error {
+	r.mu.Lock()
+	rg, ok := r.regs[id]
+	if ok {
+		delete(r.regs, id)
+		r.save()
+	}
+	r.mu.Unlock()
+	if !ok {
+		return ErrNotRegistered
+	}
+	rg.stop()
+	<-rg.done
+	if err := r.bus.Remove(rg.dispatch.subscriber()); err != nil && !errors.Is(err, eventbus.ErrUnknownSubscriber) {
+		log.Printf("webhook %s: remove subscriber: %v", id, err)
+	}
+	return nil
+}
+
+// Public returns reg without its secret.
+func (reg Registration) Public() Registration {
+	reg.Secret = ""
+	return reg
+}
+
+// save must be called with r.mu held.
+func (r *Registry) save() {
+	if r.cfg.File == "" {
+		return
+	}
+	data, err := json.MarshalIndent(r.list(""), "", "  ")
+	if err == nil {
+		tmp := r.cfg.File + ".tmp"
+		if err = os.WriteFile(tmp, data, 0o600); err == nil {
+			err = os.Rename(tmp, r.cfg.File)
+		}
+	}
+	if err != nil {
+		log.Printf("webhooks: saving %s: %v", r.cfg.File, err)
+	}
+}
@@ -0,0 +1,350 @@
+// Package webhook delivers result events to consumer URLs. Each consumer
+// reads the durable event bus under its own subscriber name and acks an
+// event only after a 2xx response, so deliveries are in order and at
+// least once. Payloads can be HMAC-signed and encrypted per consumer.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/auth"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/eventbus"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/pkg/models"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/stream"
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/transform"
+)
+
+// Headers added to every delivery besides the auth signature headers.
+const (
+	HeaderEvent      = "X-Webhook-Event" // event seq, stable across retries
+	HeaderType       = "X-Webhook-Type"  // order-processed or order-failed
+	HeaderEncryption = "X-Webhook-Encryption"
+	HeaderTest       = "X-Webhook-Test" // "true" on sample payloads from Test
+)
+
+const (
+	maxBackoff = time.Minute
+
+	// keepAttempts is how many recent delivery attempts each consumer
+	// remembers, and maxResponse how much of each response body.
+	keepAttempts = 50
+	maxResponse  = 1 << 10
+)
+
+type Consumer struct {
+	Name       string
+	URL        string
+	Secret     func() string // HMAC key for auth.Sign; nil sends unsigned
+	Encryption string        // "nacl_box" or "jwe", for HeaderEncryption
+	Encrypter  Encrypter     // nil sends plaintext JSON
+	Transform  *transform.Transform
+	Digest     *Digest // nil delivers every event on its own
+
+	// Tenant limits deliveries to the orders of one tenant, and Types to
+	// events of the listed types; empty delivers all of them.
+	Tenant string
+	Types  []string
+}
+
+// eventType is the type of result event e, as in the event stream.
+func eventType(e eventbus.Event) string {
+	if e.Result.Success {
+		return stream.EventProcessed
+	}
+	return stream.EventFailed
+}
+
+// wants reports whether the consumer is sent e.
+func (c Consumer) wants(e eventbus.Event) bool {
+	return (c.Tenant == "" || e.Result.Order.Tenant == c.Tenant) &&
+		(len(c.Types) == 0 || slices.Contains(c.Types, eventType(e)))
+}
+
+// Stats describes a consumer's deliveries.
+type Stats struct {
+	Name         string    `json:"name"`
+	Delivered    uint64    `json:"delivered"`
+	Failures     uint64    `json:"failures"`
+	Skipped      uint64    `json:"skipped"` // aged out of the event log, or failed to encode
+	Pending      uint64    `json:"pending"`
+	LastDelivery time.Time `json:"last_delivery,omitzero"`
+	LastError    string    `json:"last_error,omitempty"`
+}
+
+// Attempt is one delivery attempt, kept so integrators can debug their
+// receivers.
+type Attempt struct {
+	At        time.Time `json:"at"`
+	Event     uint64    `json:"event,omitempty"` // zero for test payloads
+	Order     string    `json:"order,omitempty"`
+	Test      bool      `json:"test,omitempty"`
+	Status    int       `json:"status,omitempty"` // zero if no response arrived
+	LatencyMs int64     `json:"latency_ms"`
+	Response  string    `json:"response,omitempty"` // start of the response body
+	Error     string    `json:"error,omitempty"`
+}
+
+type Dispatcher struct {
+	bus      *eventbus.Bus
+	client   *http.Client
+	consumer Consumer
+
+	mu       sync.Mutex
+	stats    Stats
+	attempts []Attempt // oldest first
+}
+
+func NewDispatcher(bus *eventbus.Bus, client *http.Client, c Consumer) *Dispatcher {
+	return &Dispatcher{bus: bus, client: client, consumer: c, stats: Stats{Name: c.Name}}
+}
+
+// Name is the consumer's name.
+func (d *Dispatcher) Name() string {
+	return d.consumer.Name
+}
+
+func (d *Dispatcher) subscriber() string {
+	return "webhook:" + d.consumer.Name
+}
+
+// Run delivers events, or digests of them, until ctx is done.
+func (d *Dispatcher) Run(ctx context.Context) {
+	if d.consumer.Digest != nil {
+		d.runDigests(ctx)
+		return
+	}
+	for ctx.Err() == nil {
+		batch, err := d.bus.Read(ctx, d.subscriber(), 1)
+		if err != nil {
+			log.Printf("webhook %s: read events: %v", d.consumer.Name, err)
+			sleep(ctx, time.Second)
+			continue
+		}
+		d.mu.Lock()
+		d.stats.Skipped += batch.Skipped
+		d.mu.Unlock()
+		for _, e := range batch.Events {
+			if !d.consumer.wants(e) {
+				d.ack(e.Seq)
+				continue
+			}
+			if !d.deliver(ctx, e) {
+				return
+			}
+		}
+	}
+}
+
+// deliver posts e until it is accepted, retrying with backoff. It returns
+// false if ctx ended first.
+func (d *Dispatcher) deliver(ctx context.Context, e eventbus.Event) bool {
+	body, contentType, err := d.encode(e)
+	if err != nil {
+		// Retrying can't fix an encoding error; skip the event.
+		log.Printf("webhook %s: encode event %d: %v", d.consumer.Name, e.Seq, err)
+		d.mu.Lock()
+		d.stats.Skipped++
+		d.stats.LastError = err.Error()
+		d.mu.Unlock()
+		d.ack(e.Seq)
+		return true
+	}
+
+	backoff := time.Second
+	for {
+		attempt, err := d.post(ctx, e, body, contentType)
+		if ctx.Err() == nil {
+			d.record(attempt)
+		}
+		if err == nil {
+			d.delivered()
+			d.ack(e.Seq)
+			return true
+		}
+		if ctx.Err() != nil {
+			return false
+		}
+		d.failed(err)
+		sleep(ctx, backoff)
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+func (d *Dispatcher) encode(e eventbus.Event) ([]byte, string, error) {
+	body, err := d.consumer.Transform.Apply(e)
+	if err != nil || d.consumer.Encrypter == nil {
+		return body, "application/json", err
+	}
+	return d.consumer.Encrypter.Encrypt(body)
+}
+
+func (d *Dispatcher) post(ctx context.Context, e eventbus.Event, body []byte, contentType string) (Attempt, error) {
+	header := http.Header{}
+	header.Set(HeaderEvent, strconv.FormatUint(e.Seq, 10))
+	header.Set(HeaderType, eventType(e))
+	// The event seq makes retries safe to repeat.
+	header.Set("Idempotency-Key", d.subscriber()+":"+strconv.FormatUint(e.Seq, 10))
+	if d.consumer.Encrypter != nil {
+		header.Set(HeaderEncryption, d.consumer.Encryption)
+	}
+	attempt, err := postSigned(ctx, d.client, d.consumer.URL, body, contentType, header, d.consumer.Secret)
+	attempt.Event = e.Seq
+	attempt.Order = e.Result.Order.ID
+	return attempt, err
+}
+
+// Test sends a signed sample result, encoded like real events, and
+// returns the receiver's response. Test payloads carry HeaderTest and
+// are recorded with the consumer's attempts; the event log is untouched.
+func (d *Dispatcher) Test(ctx context.Context) (Attempt, error) {
+	now := time.Now()
+	sample := eventbus.Event{Time: now, Result: models.ProcessedOrder{
+		Order: models.Order{
+			ID: "test_" + randomNonce()[:16], Amount: 1999, Items: []string{"sample item"},
+			Customer: "test customer", Status: models.StatusDelivered, CreatedAt: now.Add(-time.Second), Address: "1 Test Street",
+		},
+		ProcessedAt: now, ProcessingTime: 100, EndToEndTime: 1000, Success: true, Result: "sample",
+	}}
+	body, contentType, err := d.encode(sample)
+	if err != nil {
+		return Attempt{}, err
+	}
+	header := http.Header{}
+	header.Set(HeaderTest, "true")
+	header.Set("Idempotency-Key", d.subscriber()+":"+sample.Result.Order.ID)
+	if d.consumer.Encrypter != nil {
+		header.Set(HeaderEncryption, d.consumer.Encryption)
+	}
+	attempt, _ := postSigned(ctx, d.client, d.consumer.URL, body, contentType, header, d.consumer.Secret)
+	attempt.Test = true
+	attempt.Order = sample.Result.Order.ID
+	d.record(attempt)
+	return attempt, nil
+}
+
+// Attempts returns the consumer's recent delivery attempts, newest first.
+func (d *Dispatcher) Attempts() []Attempt {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	attempts := slices.Clone(d.attempts)
+	slices.Reverse(attempts)
+	if attempts == nil {
+		attempts = []Attempt{}
+	}
+	return attempts
+}
+
+func (d *Dispatcher) record(a Attempt) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.attempts) == keepAttempts {
+		d.attempts = slices.Delete(d.attempts, 0, 1)
+	}
+	d.attempts = append(d.attempts, a)
+}
+
+// postSigned posts body with header and, when secret is set, the auth.Sign
+// headers. Any status but 2xx is an error; the returned Attempt describes
+// the exchange either way.
+func postSigned(ctx context.Context, client *http.Client, url string, body []byte, contentType string, header http.Header, secret func() string) (attempt Attempt, err error) {
+	start := time.Now()
+	attempt.At = start
+	defer func() {
+		attempt.LatencyMs = time.Since(start).Milliseconds()
+		if err != nil {
+			attempt.Error = err.Error()
+		}
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return attempt, err
+	}
+	req.Header = header
+	req.Header.Set("Content-Type", contentType)
+	if secret != nil {
+		// The signature covers the body as sent, so it is checked before
+		// decrypting.
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		nonce := randomNonce()
+		req.Header.Set(auth.HeaderTimestamp, timestamp)
+		req.Header.Set(auth.HeaderNonce, nonce)
+		req.Header.Set(auth.HeaderSignature, auth.Sign(secret(), timestamp, nonce, body))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return attempt, err
+	}
+	defer resp.Body.Close()
+	attempt.Status = resp.StatusCode
+	var head [maxResponse]byte
+	n, _ := io.ReadFull(resp.Body, head[:])
+	attempt.Response = strings.ToValidUTF8(string(head[:n]), "")
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode/100 != 2 {
+		return attempt, fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	return attempt, nil
+}
+
+func (d *Dispatcher) ack(seq uint64) {
+	if err := d.bus.Ack(d.subscriber(), seq); err != nil {
+		// The event will be delivered again after a restart.
+		log.Printf("webhook %s: ack %d: %v", d.consumer.Name, seq, err)
+	}
+}
+
+func (d *Dispatcher) delivered() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.stats.Delivered++
+	d.stats.LastDelivery = time.Now()
+	d.stats.LastError = ""
+}
+
+func (d *Dispatcher) failed(err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.stats.Failures++
+	d.stats.LastError = err.Error()
+}
+
+func (d *Dispatcher) Stats() Stats {
+	d.mu.Lock()
+	stats := d.stats
+	d.mu.Unlock()
+	for _, sub := range d.bus.Subscribers() {
+		if sub.Name == d.subscriber() {
+			stats.Pending = sub.Lag
+		}
+	}
+	return stats
+}
+
+func randomNonce() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func sleep(ctx context.Context, d time.Duration) {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+	case <-t.C:
+	}
+}
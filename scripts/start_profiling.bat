@@ -49,7 +49,7 @@ exit /b 1
 :app_started
 REM Start load generation in background
 echo 📊 Starting load generation...
-start /b go run tools/load_test.go
+start /b go run ./tools
 
 REM Wait a bit for load to build up
 echo ⏳ Waiting for load to build up...
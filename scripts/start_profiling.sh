@@ -49,7 +49,7 @@ fi
 
 # Start load generation in background
 echo "📊 Starting load generation..."
-go run tools/load_test.go &
+go run ./tools &
 LOAD_PID=$!
 
 # Wait a bit for load to build up
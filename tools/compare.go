@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"text/tabwriter"
+)
+
+// metric is one compared value; higherIsBetter decides which direction
+// is a regression.
+type metric struct {
+	name           string
+	value          func(ScenarioResult) float64
+	higherIsBetter bool
+}
+
+var metrics = []metric{
+	{"throughput/s", func(r ScenarioResult) float64 { return r.Throughput }, true},
+	{"p50 ms", func(r ScenarioResult) float64 { return r.P50Ms }, false},
+	{"p95 ms", func(r ScenarioResult) float64 { return r.P95Ms }, false},
+	{"p99 ms", func(r ScenarioResult) float64 { return r.P99Ms }, false},
+	{"error %", func(r ScenarioResult) float64 { return r.ErrorRate * 100 }, false},
+}
+
+// compare prints a before/after report of two saved runs. It returns 1
+// when a metric got worse by more than the threshold, so builds can be
+// gated on it.
+func compare(args []string) int {
+	fs := flag.NewFlagSet("compare", flag.ExitOnError)
+	threshold := fs.Float64("threshold", 10, "percent change that counts as a regression")
+	_ = fs.Parse(args)
+	if fs.NArg() != 2 {
+		fmt.Fprintln(os.Stderr, "usage: compare [-threshold 10] before.json after.json")
+		return 2
+	}
+	before, err := loadRun(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	after, err := loadRun(fs.Arg(1))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	regressions := 0
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "scenario\tmetric\tbefore\tafter\tchange\t")
+	for _, b := range before.Scenarios {
+		a, ok := findScenario(after, b.Name)
+		if !ok {
+			fmt.Fprintf(tw, "%s\t(missing in after)\t\t\t\t\n", b.Name)
+			continue
+		}
+		for _, m := range metrics {
+			old, cur := m.value(b), m.value(a)
+			change := percentChange(old, cur)
+			worse := change > *threshold
+			if m.higherIsBetter {
+				worse = -change > *threshold
+			}
+			mark := ""
+			if worse {
+				mark = "REGRESSION"
+				regressions++
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%.2f\t%.2f\t%+.1f%%\t%s\n", b.Name, m.name, old, cur, change, mark)
+		}
+	}
+	_ = tw.Flush()
+
+	if regressions > 0 {
+		fmt.Printf("\n%d regression(s) over %.0f%%\n", regressions, *threshold)
+		return 1
+	}
+	fmt.Printf("\nNo regressions over %.0f%%\n", *threshold)
+	return 0
+}
+
+func loadRun(path string) (Run, error) {
+	var run Run
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return run, err
+	}
+	if err := json.Unmarshal(data, &run); err != nil {
+		return run, fmt.Errorf("%s: %w", path, err)
+	}
+	return run, nil
+}
+
+func findScenario(run Run, name string) (ScenarioResult, bool) {
+	for _, s := range run.Scenarios {
+		if s.Name == name {
+			return s, true
+		}
+	}
+	return ScenarioResult{}, false
+}
+
+// percentChange is the change from old to cur in percent. From zero, any
+// increase counts as +100%.
+func percentChange(old, cur float64) float64 {
+	switch {
+	case old == cur:
+		return 0
+	case old == 0:
+		return math.Copysign(100, cur)
+	}
+	return (cur - old) / old * 100
+}
@@ -3,42 +3,110 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/pkg/models"
 )
 
+// Usage:
+//
+//	go run ./tools [run] [-url URL] [-scenarios normal,high,burst] [-out results.json]
+//	go run ./tools compare [-threshold 10] before.json after.json
+//	go run ./tools replay [-url URL] [-speed 1] [-out results.json] traffic.jsonl
+//	go run ./tools soak [-url URL] [-rate 20] [-duration 4h] [-check 1m]
 func main() {
-	baseURL := "http://localhost:8080"
-
-	// Test different scenarios
-	fmt.Println("Starting load test...")
-
-	// Scenario 1: Normal load
-	fmt.Println("Scenario 1: Normal load (10 orders/sec for 30 seconds)")
-	runLoadTest(baseURL, 10, 30*time.Second, "normal")
+	args := os.Args[1:]
+	if len(args) > 0 && args[0] == "compare" {
+		os.Exit(compare(args[1:]))
+	}
+	if len(args) > 0 && args[0] == "replay" {
+		os.Exit(replay(args[1:]))
+	}
+	if len(args) > 0 && args[0] == "soak" {
+		os.Exit(soak(args[1:]))
+	}
+	if len(args) > 0 && args[0] == "run" {
+		args = args[1:]
+	}
 
-	time.Sleep(5 * time.Second)
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	baseURL := fs.String("url", "http://localhost:8080", "service to load")
+	names := fs.String("scenarios", "normal,high,burst", "comma-separated scenarios to run")
+	out := fs.String("out", "", "save the results as JSON, for compare")
+	_ = fs.Parse(args)
+
+	scenarios := []struct {
+		name     string
+		rate     int
+		duration time.Duration
+	}{
+		{"normal", 10, 30 * time.Second},
+		{"high", 50, 20 * time.Second},
+		{"burst", 100, 10 * time.Second},
+	}
 
-	// Scenario 2: High load
-	fmt.Println("Scenario 2: High load (50 orders/sec for 20 seconds)")
-	runLoadTest(baseURL, 50, 20*time.Second, "high")
+	fmt.Println("Starting load test...")
+	run := Run{StartedAt: time.Now(), URL: *baseURL}
+	for _, sc := range scenarios {
+		if !slices.Contains(strings.Split(*names, ","), sc.name) {
+			continue
+		}
+		if len(run.Scenarios) > 0 {
+			time.Sleep(5 * time.Second)
+		}
+		fmt.Printf("Scenario %s: %d orders/sec for %s\n", sc.name, sc.rate, sc.duration)
+		result := runLoadTest(*baseURL, sc.rate, sc.duration, sc.name)
+		fmt.Printf("  %d sent, %.1f/s accepted, p95 %.1fms, p99 %.1fms, %.2f%% errors\n",
+			result.Sent, result.Throughput, result.P95Ms, result.P99Ms, result.ErrorRate*100)
+		run.Scenarios = append(run.Scenarios, result)
+	}
 
-	time.Sleep(5 * time.Second)
+	if *out != "" {
+		data, _ := json.MarshalIndent(run, "", "  ")
+		if err := os.WriteFile(*out, data, 0o644); err != nil {
+			log.Fatalf("save results: %v", err)
+		}
+		fmt.Printf("Results saved to %s\n", *out)
+	}
+	fmt.Println("Load test completed!")
+}
 
-	// Scenario 3: Burst load
-	fmt.Println("Scenario 3: Burst load (100 orders/sec for 10 seconds)")
-	runLoadTest(baseURL, 100, 10*time.Second, "burst")
+// Run is the saved result of one load test.
+type Run struct {
+	StartedAt time.Time        `json:"started_at"`
+	URL       string           `json:"url"`
+	Scenarios []ScenarioResult `json:"scenarios"`
+}
 
-	fmt.Println("Load test completed!")
+// ScenarioResult describes one scenario. Latencies are of the submission
+// request; throughput counts accepted orders per second.
+type ScenarioResult struct {
+	Name       string  `json:"name"`
+	Rate       int     `json:"rate"`
+	Seconds    float64 `json:"seconds"`
+	Sent       int     `json:"sent"`
+	Accepted   int     `json:"accepted"`
+	Failed     int     `json:"failed"`
+	Throughput float64 `json:"throughput"`
+	ErrorRate  float64 `json:"error_rate"`
+	P50Ms      float64 `json:"p50_ms"`
+	P95Ms      float64 `json:"p95_ms"`
+	P99Ms      float64 `json:"p99_ms"`
 }
 
-func runLoadTest(baseURL string, ordersPerSecond int, duration time.Duration, scenario string) {
+func runLoadTest(baseURL string, ordersPerSecond int, duration time.Duration, scenario string) ScenarioResult {
 	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var latencies []time.Duration
+	failed := 0
 	interval := time.Second / time.Duration(ordersPerSecond)
 
 	start := time.Now()
@@ -46,38 +114,74 @@ func runLoadTest(baseURL string, ordersPerSecond int, duration time.Duration, sc
 
 	for time.Since(start) < duration {
 		wg.Add(1)
-		go func() {
+		go func(id int) {
 			defer wg.Done()
-			sendOrder(baseURL, orderCount, scenario)
-		}()
+			latency, ok := sendOrder(baseURL, id, scenario)
+			mu.Lock()
+			defer mu.Unlock()
+			if ok {
+				latencies = append(latencies, latency)
+			} else {
+				failed++
+			}
+		}(orderCount)
 
 		orderCount++
 		time.Sleep(interval)
 	}
 
 	wg.Wait()
-	fmt.Printf("Sent %d orders in %s scenario\n", orderCount, scenario)
+	elapsed := time.Since(start)
+	slices.Sort(latencies)
+	return ScenarioResult{
+		Name:       scenario,
+		Rate:       ordersPerSecond,
+		Seconds:    elapsed.Seconds(),
+		Sent:       orderCount,
+		Accepted:   len(latencies),
+		Failed:     failed,
+		Throughput: float64(len(latencies)) / elapsed.Seconds(),
+		ErrorRate:  float64(failed) / float64(max(orderCount, 1)),
+		P50Ms:      percentile(latencies, 50),
+		P95Ms:      percentile(latencies, 95),
+		P99Ms:      percentile(latencies, 99),
+	}
 }
 
-func sendOrder(baseURL string, id int, scenario string) {
+// percentile takes sorted latencies.
+func percentile(latencies []time.Duration, p int) float64 {
+	if len(latencies) == 0 {
+		return 0
+	}
+	d := latencies[min(len(latencies)*p/100, len(latencies)-1)]
+	return float64(d.Microseconds()) / 1000
+}
+
+// sendOrder submits one order and reports its latency and whether it was
+// accepted.
+func sendOrder(baseURL string, id int, scenario string) (time.Duration, bool) {
 	order := createTestOrder(id, scenario)
 
 	jsonData, err := json.Marshal(order)
 	if err != nil {
 		log.Printf("Error marshaling order: %v", err)
-		return
+		return 0, false
 	}
 
+	start := time.Now()
 	resp, err := http.Post(baseURL+"/orders", "application/json", bytes.NewBuffer(jsonData))
 	if err != nil {
 		log.Printf("Error sending order: %v", err)
-		return
+		return 0, false
 	}
 	defer resp.Body.Close()
+	latency := time.Since(start)
 
 	if resp.StatusCode != http.StatusCreated {
 		log.Printf("Order %d failed with status: %d", id, resp.StatusCode)
+		return latency, false
 	}
+	return latency, true
 }
 
 func createTestOrder(id int, scenario string) models.Order {
@@ -86,45 +190,45 @@ func createTestOrder(id int, scenario string) models.Order {
 	case "normal":
 		return models.Order{
 			ID:       fmt.Sprintf("normal_%d", id),
-			Amount:   float64(50 + id%200), // $50-$250
+			Amount:   models.Whole(int64(50 + id%200)), // $50-$250
 			Items:    []string{"item1", "item2"},
 			Customer: fmt.Sprintf("customer%d@example.com", id),
-			Status:   "pending",
+			Status:   models.StatusPending,
 			Address:  fmt.Sprintf("%d Main St", id),
-			Priority: 2, // Medium priority
+			Priority: models.PriorityMedium,
 			Notes:    "Normal order",
 		}
 	case "high":
 		return models.Order{
 			ID:       fmt.Sprintf("high_%d", id),
-			Amount:   float64(500 + id%1000), // $500-$1500
+			Amount:   models.Whole(int64(500 + id%1000)), // $500-$1500
 			Items:    []string{"expensive_item1", "expensive_item2"},
 			Customer: fmt.Sprintf("vip_customer%d@example.com", id),
-			Status:   "pending",
+			Status:   models.StatusPending,
 			Address:  fmt.Sprintf("%d VIP Street", id),
-			Priority: 1, // High priority
+			Priority: models.PriorityHigh,
 			Notes:    "High value order",
 		}
 	case "burst":
 		return models.Order{
 			ID:       fmt.Sprintf("burst_%d", id),
-			Amount:   float64(10 + id%100), // $10-$110
+			Amount:   models.Whole(int64(10 + id%100)), // $10-$110
 			Items:    []string{"quick_item"},
 			Customer: fmt.Sprintf("burst_customer%d@example.com", id),
-			Status:   "pending",
+			Status:   models.StatusPending,
 			Address:  fmt.Sprintf("%d Quick St", id),
-			Priority: 3, // Low priority
+			Priority: models.PriorityLow,
 			Notes:    "Burst order",
 		}
 	default:
 		return models.Order{
 			ID:       fmt.Sprintf("test_%d", id),
-			Amount:   100.0,
+			Amount:   models.Whole(100),
 			Items:    []string{"test_item"},
 			Customer: "test@example.com",
-			Status:   "pending",
+			Status:   models.StatusPending,
 			Address:  "Test Address",
-			Priority: 2,
+			Priority: models.PriorityMedium,
 			Notes:    "Test order",
 		}
 	}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ali-assar/Real-Time-Order-Processor.git/internal/traffic"
+)
+
+// replay fires the requests of a traffic recording at a target, keeping
+// their original spacing divided by -speed. Results are saved like a load
+// test run, so replays of two builds can be compared.
+func replay(args []string) int {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	baseURL := fs.String("url", "http://localhost:8080", "service to replay against")
+	speed := fs.Float64("speed", 1, "rate multiplier; 2 replays twice as fast")
+	out := fs.String("out", "", "save the results as JSON, for compare")
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 || *speed <= 0 {
+		fmt.Fprintln(os.Stderr, "usage: replay [-url URL] [-speed 1] [-out results.json] traffic.jsonl")
+		return 2
+	}
+
+	entries, err := loadTraffic(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if len(entries) == 0 {
+		fmt.Fprintln(os.Stderr, "no requests recorded")
+		return 2
+	}
+	fmt.Printf("Replaying %d requests at %gx\n", len(entries), *speed)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var latencies []time.Duration
+	statuses := make(map[int]int)
+	failed := 0
+
+	first := entries[0].At
+	start := time.Now()
+	for _, e := range entries {
+		offset := time.Duration(float64(e.At.Sub(first)) / *speed)
+		time.Sleep(time.Until(start.Add(offset)))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			status, latency := send(*baseURL, e)
+			mu.Lock()
+			defer mu.Unlock()
+			statuses[status]++
+			if status >= 200 && status < 500 {
+				// 4xx answers are replayed faithfully, e.g. validation errors.
+				latencies = append(latencies, latency)
+			} else {
+				failed++
+			}
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	codes := make([]int, 0, len(statuses))
+	for code := range statuses {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	for _, code := range codes {
+		label := fmt.Sprint(code)
+		if code == 0 {
+			label = "error"
+		}
+		fmt.Printf("  %s: %d\n", label, statuses[code])
+	}
+
+	slices.Sort(latencies)
+	result := ScenarioResult{
+		Name:       "replay",
+		Rate:       int(float64(len(entries)) / elapsed.Seconds()),
+		Seconds:    elapsed.Seconds(),
+		Sent:       len(entries),
+		Accepted:   len(latencies),
+		Failed:     failed,
+		Throughput: float64(len(latencies)) / elapsed.Seconds(),
+		ErrorRate:  float64(failed) / float64(len(entries)),
+		P50Ms:      percentile(latencies, 50),
+		P95Ms:      percentile(latencies, 95),
+		P99Ms:      percentile(latencies, 99),
+	}
+	fmt.Printf("  %.1f/s answered, p95 %.1fms, p99 %.1fms, %.2f%% errors\n",
+		result.Throughput, result.P95Ms, result.P99Ms, result.ErrorRate*100)
+
+	if *out != "" {
+		data, _ := json.MarshalIndent(Run{StartedAt: start, URL: *baseURL, Scenarios: []ScenarioResult{result}}, "", "  ")
+		if err := os.WriteFile(*out, data, 0o644); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Printf("Results saved to %s\n", *out)
+	}
+	return 0
+}
+
+func loadTraffic(path string) ([]traffic.Entry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var entries []traffic.Entry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 4<<20)
+	for line := 1; scanner.Scan(); line++ {
+		var e traffic.Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		entries = append(entries, e)
+	}
+	slices.SortStableFunc(entries, func(a, b traffic.Entry) int { return a.At.Compare(b.At) })
+	return entries, scanner.Err()
+}
+
+// send replays one request; status 0 means it got no response.
+func send(baseURL string, e traffic.Entry) (int, time.Duration) {
+	var body io.Reader
+	switch {
+	case len(e.Body) > 0:
+		body = bytes.NewReader(e.Body)
+	case e.TextSize > 0:
+		// Only the size was recorded; send a stand-in as large.
+		body = bytes.NewReader(bytes.Repeat([]byte{'x'}, e.TextSize))
+	}
+	req, err := http.NewRequest(e.Method, baseURL+e.Path, body)
+	if err != nil {
+		return 0, 0
+	}
+	for k, v := range e.Headers {
+		req.Header.Set(k, v)
+	}
+	start := time.Now()
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, 0
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return resp.StatusCode, time.Since(start)
+}
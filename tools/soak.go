@@ -0,0 +1,227 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// snapshot is the server's resource usage at one point of a soak.
+type snapshot struct {
+	Goroutines int
+	HeapMB     float64 // live heap right after a forced GC
+	Queue      int
+}
+
+// soak submits steady traffic for a long time and periodically checks that
+// the server's goroutines, heap and queue stay bounded. Growth is measured
+// against a baseline taken after the warmup. On a breach it saves
+// goroutine and heap dumps and exits with status 1.
+func soak(args []string) int {
+	fs := flag.NewFlagSet("soak", flag.ExitOnError)
+	baseURL := fs.String("url", "http://localhost:8080", "service to soak")
+	rate := fs.Int("rate", 20, "orders per second")
+	duration := fs.Duration("duration", 4*time.Hour, "how long to submit traffic")
+	warmup := fs.Duration("warmup", 5*time.Minute, "traffic before the baseline is taken")
+	every := fs.Duration("check", time.Minute, "time between checks")
+	maxGoroutines := fs.Int("max-goroutine-growth", 100, "goroutines allowed over the baseline")
+	maxHeap := fs.Float64("max-heap-growth", 64, "MB of live heap allowed over the baseline")
+	maxQueue := fs.Int("max-queue", 1000, "largest queue depth allowed")
+	dumps := fs.String("dumps", "soak-dumps", "directory for diagnostic dumps")
+	_ = fs.Parse(args)
+	if *rate <= 0 || *warmup >= *duration {
+		fmt.Fprintln(os.Stderr, "soak: -rate must be positive and -warmup shorter than -duration")
+		return 2
+	}
+
+	var sent, failed atomic.Int64
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(time.Second / time.Duration(*rate))
+		defer ticker.Stop()
+		for id := 0; ; id++ {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				sent.Add(1)
+				if _, ok := sendOrder(*baseURL, id, "normal"); !ok {
+					failed.Add(1)
+				}
+			}()
+		}
+	}()
+	finish := func() {
+		close(stop)
+		wg.Wait()
+	}
+
+	fmt.Printf("Soaking %s at %d orders/sec for %s\n", *baseURL, *rate, *duration)
+	time.Sleep(*warmup)
+	base, err := sample(*baseURL)
+	if err != nil {
+		finish()
+		fmt.Fprintln(os.Stderr, "soak: baseline:", err)
+		return 1
+	}
+	fmt.Printf("Baseline: %d goroutines, %.1f MB heap, queue %d\n", base.Goroutines, base.HeapMB, base.Queue)
+
+	check := func(s snapshot) []string {
+		var breaches []string
+		if growth := s.Goroutines - base.Goroutines; growth > *maxGoroutines {
+			breaches = append(breaches, fmt.Sprintf("goroutines grew by %d", growth))
+		}
+		if growth := s.HeapMB - base.HeapMB; growth > *maxHeap {
+			breaches = append(breaches, fmt.Sprintf("heap grew by %.1f MB", growth))
+		}
+		if s.Queue > *maxQueue {
+			breaches = append(breaches, fmt.Sprintf("queue depth %d", s.Queue))
+		}
+		return breaches
+	}
+	fail := func(breaches []string) int {
+		fmt.Printf("LEAK: %s\n", strings.Join(breaches, "; "))
+		if dir, err := saveDumps(*baseURL, *dumps); err != nil {
+			fmt.Fprintln(os.Stderr, "soak: dumps:", err)
+		} else {
+			fmt.Printf("Dumps saved to %s\n", dir)
+		}
+		return 1
+	}
+
+	end := time.Now().Add(*duration - *warmup)
+	ticker := time.NewTicker(*every)
+	defer ticker.Stop()
+	for time.Now().Before(end) {
+		<-ticker.C
+		s, err := sample(*baseURL)
+		if err != nil {
+			finish()
+			fmt.Fprintln(os.Stderr, "soak:", err)
+			return 1
+		}
+		fmt.Printf("%s  %d goroutines, %.1f MB heap, queue %d, %d sent, %d failed\n",
+			time.Now().Format(time.TimeOnly), s.Goroutines, s.HeapMB, s.Queue, sent.Load(), failed.Load())
+		if breaches := check(s); len(breaches) > 0 {
+			finish()
+			return fail(breaches)
+		}
+	}
+
+	// Once traffic stops, the queue must drain and whatever the traffic
+	// started must wind down.
+	finish()
+	var s snapshot
+	for deadline := time.Now().Add(*every); ; time.Sleep(time.Second) {
+		if s, err = sample(*baseURL); err != nil {
+			fmt.Fprintln(os.Stderr, "soak:", err)
+			return 1
+		}
+		if s.Queue == 0 || time.Now().After(deadline) {
+			break
+		}
+	}
+	breaches := check(s)
+	if s.Queue > 0 {
+		breaches = append(breaches, fmt.Sprintf("queue did not drain, %d left", s.Queue))
+	}
+	if len(breaches) > 0 {
+		return fail(breaches)
+	}
+	fmt.Printf("Soak passed: %d sent, %d failed; final %d goroutines, %.1f MB heap\n",
+		sent.Load(), failed.Load(), s.Goroutines, s.HeapMB)
+	return 0
+}
+
+// sample reads resource usage through the profiling and stats endpoints.
+func sample(baseURL string) (snapshot, error) {
+	var s snapshot
+
+	goroutines, err := fetch(baseURL + "/debug/pprof/goroutine?debug=1")
+	if err != nil {
+		return s, err
+	}
+	// The first line reads "goroutine profile: total N".
+	line, _, _ := strings.Cut(string(goroutines), "\n")
+	if _, err := fmt.Sscanf(line, "goroutine profile: total %d", &s.Goroutines); err != nil {
+		return s, fmt.Errorf("goroutine profile: %w", err)
+	}
+
+	gc, err := fetch(baseURL + "/profile/gc")
+	if err != nil {
+		return s, err
+	}
+	var mem struct {
+		After struct {
+			AllocMB float64 `json:"alloc_mb"`
+		} `json:"after_gc"`
+	}
+	if err := json.Unmarshal(gc, &mem); err != nil {
+		return s, fmt.Errorf("gc stats: %w", err)
+	}
+	s.HeapMB = mem.After.AllocMB
+
+	stats, err := fetch(baseURL + "/stats")
+	if err != nil {
+		return s, err
+	}
+	var st struct {
+		QueueLength int `json:"queue_length"`
+	}
+	if err := json.Unmarshal(stats, &st); err != nil {
+		return s, fmt.Errorf("stats: %w", err)
+	}
+	s.Queue = st.QueueLength
+	return s, nil
+}
+
+// saveDumps stores full goroutine stacks, a heap profile and the stats
+// under a timestamped directory.
+func saveDumps(baseURL, root string) (string, error) {
+	dir := filepath.Join(root, time.Now().UTC().Format("20060102T150405Z"))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	files := map[string]string{
+		"goroutines.txt": "/debug/pprof/goroutine?debug=2",
+		"heap.pprof":     "/debug/pprof/heap",
+		"stats.json":     "/stats",
+	}
+	for name, path := range files {
+		data, err := fetch(baseURL + path)
+		if err != nil {
+			return dir, err
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			return dir, err
+		}
+	}
+	return dir, nil
+}
+
+func fetch(url string) ([]byte, error) {
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}